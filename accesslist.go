@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// createAccessList 用 eth_createAccessList 生成调用会访问的账户与存储槽
+func (srv *Server) createAccessList(ctx context.Context, msg ethereum.CallMsg) (types.AccessList, error) {
+	var result struct {
+		AccessList types.AccessList `json:"accessList"`
+		GasUsed    hexutil.Uint64   `json:"gasUsed"`
+		Error      string           `json:"error,omitempty"`
+	}
+	if err := srv.eth().Client().CallContext(ctx, &result, "eth_createAccessList", toCallArg(msg), "latest"); err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("%s", result.Error)
+	}
+	return result.AccessList, nil
+}
+
+// withAccessList 为钱包调用尝试构造 EIP-2930 交易 (gas.access_list)
+//
+// 预先声明钱包与代币的存储槽后，首次访问按 warm 计价；只有带列表估算的 gas
+// 比 gasLimit 更低时才使用，返回新的 gas limit 与列表，否则返回 nil。
+func (srv *Server) withAccessList(ctx context.Context, msg ethereum.CallMsg, gasLimit uint64) (types.AccessList, uint64) {
+	if !srv.Config().Gas.AccessList || msg.To == nil {
+		return nil, gasLimit
+	}
+	list, err := srv.createAccessList(ctx, msg)
+	if err != nil || len(list) == 0 {
+		return nil, gasLimit
+	}
+	msg.AccessList = list
+	gas, err := srv.eth().EstimateGas(ctx, msg)
+	if err != nil || gas >= gasLimit {
+		return nil, gasLimit
+	}
+	return list, gas
+}
+
+// newRelayTx 创建中继交易，accessList 非空时为 EIP-2930 交易，否则为 legacy 交易
+func (srv *Server) newRelayTx(nonce uint64, to common.Address, value *big.Int, gasLimit uint64, gasPrice *big.Int, data []byte, accessList types.AccessList) *types.Transaction {
+	if len(accessList) == 0 {
+		return types.NewTransaction(nonce, to, value, gasLimit, gasPrice, data)
+	}
+	return types.NewTx(&types.AccessListTx{
+		ChainID:    srv.chainID,
+		Nonce:      nonce,
+		GasPrice:   gasPrice,
+		Gas:        gasLimit,
+		To:         &to,
+		Value:      value,
+		Data:       data,
+		AccessList: accessList,
+	})
+}
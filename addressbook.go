@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AddressBookEntry 地址簿条目
+type AddressBookEntry struct {
+	Label   string `json:"label"`
+	Address string `json:"address"`
+}
+
+// addressBook 按钱包隔离的地址簿 (nsAddressBook，key = wallet/label)
+type addressBook struct {
+	st Storage
+}
+
+func newAddressBook(st Storage) *addressBook {
+	return &addressBook{st: st}
+}
+
+func addressBookKey(wallet common.Address, label string) string {
+	return wallet.Hex() + "/" + label
+}
+
+// list 返回钱包的全部条目，按 label 排序
+func (b *addressBook) list(wallet common.Address) ([]AddressBookEntry, error) {
+	kvs, err := b.st.List(nsAddressBook, addressBookKey(wallet, ""))
+	if err != nil {
+		return nil, err
+	}
+	list := make([]AddressBookEntry, 0, len(kvs))
+	for _, kv := range kvs {
+		var entry AddressBookEntry
+		if err := json.Unmarshal(kv.Value, &entry); err != nil {
+			return nil, err
+		}
+		list = append(list, entry)
+	}
+	return list, nil
+}
+
+// put 新增或更新条目
+func (b *addressBook) put(wallet common.Address, label string, addr common.Address) error {
+	entry := AddressBookEntry{Label: label, Address: addr.Hex()}
+	return putJSON(b.st, nsAddressBook, addressBookKey(wallet, label), entry, 0)
+}
+
+// remove 删除条目，返回是否存在
+func (b *addressBook) remove(wallet common.Address, label string) (bool, error) {
+	return b.st.Delete(nsAddressBook, addressBookKey(wallet, label))
+}
+
+// labelOf 查找地址对应的 label
+func (b *addressBook) labelOf(wallet, addr common.Address) (string, bool) {
+	list, err := b.list(wallet)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range list {
+		if common.HexToAddress(entry.Address) == addr {
+			return entry.Label, true
+		}
+	}
+	return "", false
+}
+
+// handleAddressBook 地址簿 CRUD (需要钱包会话)
+//
+//	GET    /api/addressbook              列出条目
+//	POST   /api/addressbook              {label, address} 新增/更新
+//	DELETE /api/addressbook?label=...    删除
+func (srv *Server) handleAddressBook(w http.ResponseWriter, r *http.Request) {
+	sess, ok := srv.requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		list, err := srv.addressBook.list(sess.Wallet)
+		if err != nil {
+			sendError(w, "读取地址簿失败: "+err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Data:    list,
+		})
+
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var entry AddressBookEntry
+		if err := json.Unmarshal(body, &entry); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		entry.Label = strings.TrimSpace(entry.Label)
+		if entry.Label == "" {
+			sendError(w, "缺少参数: label")
+			return
+		}
+		if !common.IsHexAddress(entry.Address) {
+			sendError(w, "address 地址格式错误")
+			return
+		}
+		addr := common.HexToAddress(entry.Address)
+		if err := srv.addressBook.put(sess.Wallet, entry.Label, addr); err != nil {
+			sendError(w, "保存地址簿失败: "+err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "已保存",
+			Data:    AddressBookEntry{Label: entry.Label, Address: addr.Hex()},
+		})
+
+	case "DELETE":
+		label := r.URL.Query().Get("label")
+		removed, err := srv.addressBook.remove(sess.Wallet, label)
+		if err != nil {
+			sendError(w, "删除失败: "+err.Error())
+			return
+		}
+		if !removed {
+			sendError(w, "地址簿中不存在: "+label)
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "已删除",
+		})
+	}
+}
+
+// recipientWarnings 发送到未标记地址时给出提示 (不阻断转账)
+func (srv *Server) recipientWarnings(wallet, to common.Address) []string {
+	if _, ok := srv.addressBook.labelOf(wallet, to); ok {
+		return nil
+	}
+	return []string{"接收地址 " + to.Hex() + " 不在地址簿中，请确认地址无误"}
+}
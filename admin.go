@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// adminOnly 管理接口中间件: 校验 Authorization: Bearer <admin_token>，未配置 admin_token 时管理接口不可用
+func (srv *Server) adminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expected := srv.Config().AdminToken
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			sendError(w, "管理接口认证失败")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// LoggingData /api/admin/logging 请求与返回数据
+type LoggingData struct {
+	Payloads bool `json:"payloads"`
+}
+
+// handleAdminLogging 运行时开关完整请求/响应日志
+//
+//	GET  /api/admin/logging                  查看当前状态
+//	POST /api/admin/logging {"payloads":true} 开启/关闭
+func (srv *Server) handleAdminLogging(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req LoggingData
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		srv.logPayloads.Store(req.Payloads)
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    LoggingData{Payloads: srv.logPayloads.Load()},
+	})
+}
+
+// MaintenanceData /api/admin/maintenance 请求与返回数据
+type MaintenanceData struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"` // 返回给被拒绝请求的提示
+	Since   int64  `json:"since,omitempty"`
+}
+
+// message 维护期间拒绝请求时的提示
+func (m *MaintenanceData) message() string {
+	if m.Message != "" {
+		return "维护中: " + m.Message
+	}
+	return "服务维护中，请稍后再试"
+}
+
+// handleAdminMaintenance 维护模式: 开启后所有改变状态的接口返回 503，查询接口不受影响
+//
+//	GET  /api/admin/maintenance
+//	POST /api/admin/maintenance {"enabled":true,"message":"..."}
+func (srv *Server) handleAdminMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req MaintenanceData
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		if req.Enabled {
+			req.Since = time.Now().Unix()
+			srv.maintenance.Store(&req)
+			log.Printf("已开启维护模式: %s", req.Message)
+		} else {
+			srv.maintenance.Store(nil)
+			log.Println("已关闭维护模式")
+		}
+	}
+
+	data := MaintenanceData{}
+	if m := srv.maintenance.Load(); m != nil {
+		data = *m
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// PolicyData /api/admin/policies 请求与返回数据
+//
+// POST 只替换请求中出现的部分，修改只作用于运行中的进程，
+// 配置文件热加载后以文件为准。
+type PolicyData struct {
+	RateLimit        *RateLimitConfig   `json:"rateLimit,omitempty"`
+	MinTransfer      *MinTransferConfig `json:"minTransfer,omitempty"`
+	BlockedAddresses *[]string          `json:"blockedAddresses,omitempty"`
+}
+
+// handleAdminPolicies 查看与调整运行时策略 (限流、最小转账金额、合规名单)
+//
+//	GET  /api/admin/policies
+//	POST /api/admin/policies {"rateLimit":{...}}
+func (srv *Server) handleAdminPolicies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req PolicyData
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		cfg := srv.Config()
+		if req.RateLimit != nil {
+			if req.RateLimit.Mode != "" && req.RateLimit.Mode != rateLimitReject && req.RateLimit.Mode != rateLimitQueue {
+				sendError(w, "rateLimit.mode 只能是 reject 或 queue")
+				return
+			}
+			cfg.RateLimit = *req.RateLimit
+		}
+		if req.MinTransfer != nil {
+			for token := range req.MinTransfer.Tokens {
+				if !common.IsHexAddress(token) {
+					sendError(w, "地址格式错误: "+token)
+					return
+				}
+				if _, err := req.MinTransfer.minTransferFor(common.HexToAddress(token)); err != nil {
+					sendError(w, err.Error())
+					return
+				}
+			}
+			if _, err := req.MinTransfer.minTransferFor(common.Address{}); err != nil {
+				sendError(w, err.Error())
+				return
+			}
+			cfg.MinTransfer = *req.MinTransfer
+		}
+		if req.BlockedAddresses != nil {
+			for _, addr := range *req.BlockedAddresses {
+				if !common.IsHexAddress(addr) {
+					sendError(w, "地址格式错误: "+addr)
+					return
+				}
+			}
+			cfg.Compliance.BlockedAddresses = *req.BlockedAddresses
+		}
+		srv.SetConfig(&cfg)
+		log.Println("已通过管理接口更新运行时策略")
+	}
+
+	cfg := srv.Config()
+	blocked := cfg.Compliance.BlockedAddresses
+	if blocked == nil {
+		blocked = []string{}
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data: PolicyData{
+			RateLimit:        &cfg.RateLimit,
+			MinTransfer:      &cfg.MinTransfer,
+			BlockedAddresses: &blocked,
+		},
+	})
+}
+
+// handleAdminQueue 查看中继排队队列，或移除尚未处理的请求
+//
+//	GET    /api/admin/queue
+//	DELETE /api/admin/queue?ticket=...
+func (srv *Server) handleAdminQueue(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "DELETE":
+		ticket := r.URL.Query().Get("ticket")
+		if ticket == "" {
+			sendError(w, "缺少参数: ticket")
+			return
+		}
+		if !srv.limiter.drop(ticket) {
+			sendError(w, "未找到排队中的请求 (可能已开始处理): "+ticket)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    srv.limiter.status(),
+	})
+}
+
+// StatsData /api/admin/stats 返回数据
+type StatsData struct {
+	UptimeSeconds  int64   `json:"uptimeSeconds"`
+	ReadOnly       bool    `json:"readOnly"`
+	Maintenance    bool    `json:"maintenance"`
+	Relayer        string  `json:"relayer,omitempty"`
+	RelayerBalance string  `json:"relayerBalance,omitempty"` // wei
+	NextNonce      *uint64 `json:"nextNonce,omitempty"`
+	QueueLength    int     `json:"queueLength"`
+	ScheduledJobs  int     `json:"scheduledJobs"` // 未结束的定时任务
+	DeadLetters    int     `json:"deadLetters"`
+	RPCRateLimited int64   `json:"rpcRateLimited"` // 启动以来被上游 RPC 限流的次数
+	RelayedToday   int     `json:"relayedToday"`   // 当天 (UTC) 审计日志中已中继的转账
+	RejectedToday  int     `json:"rejectedToday"`  // 当天 (UTC) 被拒绝的转账
+
+	RPCEndpoints []RPCEndpointStatus `json:"rpcEndpoints"` // rpc 与 rpc_fallbacks 的健康状况
+	RPCMethods   []RPCMethodStats    `json:"rpcMethods"`   // 启动以来各 JSON-RPC 方法的耗时与错误率
+}
+
+// handleAdminStats 服务运行概况
+//
+//	GET /api/admin/stats
+func (srv *Server) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	data := StatsData{
+		UptimeSeconds:  int64(time.Since(srv.started).Seconds()),
+		ReadOnly:       srv.Config().ReadOnly,
+		Maintenance:    srv.maintenance.Load() != nil,
+		QueueLength:    srv.limiter.status().Length,
+		ScheduledJobs:  srv.scheduler.active(),
+		RPCRateLimited: srv.rpc.throttle.limited.Load(),
+		RPCEndpoints:   srv.rpc.status(),
+		RPCMethods:     srv.rpc.metrics.snapshot(),
+	}
+	if s := srv.signer(); s != nil {
+		from := s.Address()
+		data.Relayer = from.Hex()
+		if balance, err := srv.eth().BalanceAt(r.Context(), from, nil); err == nil {
+			data.RelayerBalance = balance.String()
+		}
+		if nonce, err := srv.nonces.peek(); err == nil {
+			data.NextNonce = &nonce
+		}
+	}
+	if list, err := srv.deadLetters(); err == nil {
+		data.DeadLetters = len(list)
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if entries, err := srv.complianceReport(today, today); err == nil {
+		for _, e := range entries {
+			if e.Decision == decisionRelayed {
+				data.RelayedToday++
+			} else {
+				data.RejectedToday++
+			}
+		}
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    data,
+	})
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envAdminToken 命令行管理工具读取的 admin token 环境变量 (优先于配置文件)
+const envAdminToken = "PASSKEY_ADMIN_TOKEN"
+
+// adminUsage -action admin 的子命令
+const adminUsage = `用法: -action admin [-server URL] [-token TOKEN] <命令>
+
+  stats                             运行概况 (中继账户、队列、死信、当天中继数)
+  maintenance [on [说明]|off]       查看 / 开启 / 关闭维护模式
+  policies [set <JSON|@文件>]       查看 / 调整限流、最小转账金额、合规名单
+  queue [drop <ticket>]             查看中继队列 / 移除排队请求
+  deadletter [resubmit|drop <id>]   查看 / 重新提交 / 丢弃中继失败的转账
+  logging [on|off]                  查看 / 切换完整请求日志
+  relayers                          中继池各账户的余额、nonce、在途交易数
+  stuck                             查看中继账户卡住的 nonce (空洞 / 长时间未上链)
+  cancel [账户] <nonce> [gasPrice]  以 0 值自转账取消卡住的 nonce (默认主中继账户)
+  rotate [start|cancel]             查看 / 开始 (输入新私钥) / 取消主中继账户轮换
+  registry export [csv|history]     导出钱包登记到标准输出 (JSON，csv 只含钱包，history 含转账历史)
+  registry import <文件>            导入 registry export 导出的 JSON 或 CSV`
+
+// adminClient 调用运行中服务的管理接口
+type adminClient struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// do 发送请求并解码统一响应，HTTP 错误或 success=false 时返回错误
+func (c *adminClient) do(method, path string, body interface{}) (*APIResponse, error) {
+	var payload io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, c.base+path, payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 %s 失败: %v", path, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var out APIResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("响应解析失败 (HTTP %d)", resp.StatusCode)
+	}
+	if !out.Success {
+		return nil, fmt.Errorf("%s (HTTP %d)", out.Message, resp.StatusCode)
+	}
+	return &out, nil
+}
+
+// download 原样输出非 APIResponse 的响应 (导出文件)，失败时解码错误信息
+func (c *adminClient) download(path string, w io.Writer) error {
+	req, err := http.NewRequest("GET", c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求 %s 失败: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Disposition") == "" {
+		var out APIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return fmt.Errorf("响应解析失败 (HTTP %d)", resp.StatusCode)
+		}
+		return fmt.Errorf("%s (HTTP %d)", out.Message, resp.StatusCode)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// runAdmin 执行管理子命令，server 为空时使用本机配置端口
+func runAdmin(cfg *Config, server, token string, args []string) error {
+	if server == "" {
+		port := cfg.Port
+		if port == 0 {
+			port = 8080
+		}
+		server = fmt.Sprintf("http://localhost:%d", port)
+	}
+	if token == "" {
+		token = os.Getenv(envAdminToken)
+	}
+	if token == "" {
+		token = cfg.AdminToken
+	}
+	if token == "" {
+		return fmt.Errorf("缺少 admin token: 使用 -token、环境变量 %s 或配置 admin_token", envAdminToken)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("缺少命令\n%s", adminUsage)
+	}
+
+	c := &adminClient{base: strings.TrimRight(server, "/"), token: token, http: &http.Client{Timeout: time.Minute}}
+	cmd, rest := args[0], args[1:]
+	var (
+		res *APIResponse
+		err error
+	)
+	switch {
+	case cmd == "stats" && len(rest) == 0:
+		res, err = c.do("GET", "/api/admin/stats", nil)
+
+	case cmd == "maintenance" && len(rest) == 0:
+		res, err = c.do("GET", "/api/admin/maintenance", nil)
+	case cmd == "maintenance" && rest[0] == "on":
+		res, err = c.do("POST", "/api/admin/maintenance", MaintenanceData{Enabled: true, Message: strings.Join(rest[1:], " ")})
+	case cmd == "maintenance" && rest[0] == "off" && len(rest) == 1:
+		res, err = c.do("POST", "/api/admin/maintenance", MaintenanceData{})
+
+	case cmd == "policies" && (len(rest) == 0 || (len(rest) == 1 && rest[0] == "get")):
+		res, err = c.do("GET", "/api/admin/policies", nil)
+	case cmd == "policies" && rest[0] == "set" && len(rest) == 2:
+		raw := []byte(rest[1])
+		if name, ok := strings.CutPrefix(rest[1], "@"); ok {
+			if raw, err = os.ReadFile(name); err != nil {
+				return fmt.Errorf("读取策略文件失败: %v", err)
+			}
+		}
+		var policy PolicyData
+		if err := json.Unmarshal(raw, &policy); err != nil {
+			return fmt.Errorf("策略 JSON 解析失败: %v", err)
+		}
+		res, err = c.do("POST", "/api/admin/policies", policy)
+
+	case cmd == "queue" && len(rest) == 0:
+		res, err = c.do("GET", "/api/admin/queue", nil)
+	case cmd == "queue" && rest[0] == "drop" && len(rest) == 2:
+		res, err = c.do("DELETE", "/api/admin/queue?ticket="+url.QueryEscape(rest[1]), nil)
+
+	case cmd == "deadletter" && len(rest) == 0:
+		res, err = c.do("GET", "/api/admin/deadletter", nil)
+	case cmd == "deadletter" && rest[0] == "resubmit" && len(rest) == 2:
+		res, err = c.do("POST", "/api/admin/deadletter", DeadLetterRequest{ID: rest[1]})
+	case cmd == "deadletter" && rest[0] == "drop" && len(rest) == 2:
+		res, err = c.do("DELETE", "/api/admin/deadletter?id="+url.QueryEscape(rest[1]), nil)
+
+	case cmd == "logging" && len(rest) == 0:
+		res, err = c.do("GET", "/api/admin/logging", nil)
+	case cmd == "logging" && len(rest) == 1 && (rest[0] == "on" || rest[0] == "off"):
+		res, err = c.do("POST", "/api/admin/logging", LoggingData{Payloads: rest[0] == "on"})
+
+	case cmd == "relayers" && len(rest) == 0:
+		res, err = c.do("GET", "/api/admin/relayers", nil)
+
+	case cmd == "stuck" && len(rest) == 0:
+		res, err = c.do("GET", "/api/admin/stuck", nil)
+	case cmd == "cancel" && len(rest) >= 1 && len(rest) <= 3:
+		var req CancelRequest
+		if strings.HasPrefix(rest[0], "0x") {
+			req.Relayer, rest = rest[0], rest[1:]
+		}
+		if len(rest) == 0 || len(rest) > 2 {
+			return fmt.Errorf("未知命令: %s\n%s", strings.Join(args, " "), adminUsage)
+		}
+		nonce, perr := strconv.ParseUint(rest[0], 10, 64)
+		if perr != nil {
+			return fmt.Errorf("nonce 格式错误: %s", rest[0])
+		}
+		req.Nonce = nonce
+		if len(rest) == 2 {
+			req.GasPrice = rest[1]
+		}
+		res, err = c.do("POST", "/api/admin/stuck", req)
+
+	case cmd == "rotate" && len(rest) == 0:
+		res, err = c.do("GET", "/api/admin/rotate", nil)
+	case cmd == "rotate" && rest[0] == "start" && len(rest) == 1:
+		// 私钥不放在命令行参数中，避免留在 shell 历史
+		key, kerr := readPassword("新中继私钥 (十六进制或 enc:v1:): ")
+		if kerr != nil {
+			return kerr
+		}
+		res, err = c.do("POST", "/api/admin/rotate", RotateRequest{PrivateKey: strings.TrimSpace(key)})
+	case cmd == "rotate" && rest[0] == "cancel" && len(rest) == 1:
+		res, err = c.do("DELETE", "/api/admin/rotate", nil)
+
+	case cmd == "registry" && len(rest) >= 1 && len(rest) <= 2 && rest[0] == "export":
+		path := "/api/admin/registry"
+		if len(rest) == 2 {
+			switch rest[1] {
+			case "csv":
+				path += "?format=csv"
+			case "history":
+				path += "?history=true"
+			default:
+				return fmt.Errorf("未知命令: %s\n%s", strings.Join(args, " "), adminUsage)
+			}
+		}
+		return c.download(path, os.Stdout)
+	case cmd == "registry" && len(rest) == 2 && rest[0] == "import":
+		data, rerr := os.ReadFile(rest[1])
+		if rerr != nil {
+			return fmt.Errorf("读取导入文件失败: %v", rerr)
+		}
+		exp, perr := parseRegistryExport(data)
+		if perr != nil {
+			return perr
+		}
+		res, err = c.do("POST", "/api/admin/registry", exp)
+
+	default:
+		return fmt.Errorf("未知命令: %s\n%s", strings.Join(args, " "), adminUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	if res.Message != "" {
+		fmt.Fprintln(os.Stderr, res.Message)
+	}
+	if res.TxHash != "" {
+		fmt.Println(res.TxHash)
+	}
+	if res.Data != nil {
+		out, _ := json.MarshalIndent(res.Data, "", "  ")
+		fmt.Println(string(out))
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+)
+
+// 授权方式
+const (
+	approveModeSet      = "approve"  // approve(spender, amount)，覆盖原额度
+	approveModeIncrease = "increase" // increaseAllowance(spender, amount)，在原额度上增加
+)
+
+// approveUnlimited amount 取该值时授权 2^256-1 (无限额度)
+const approveUnlimited = "max"
+
+// ERC20 授权 ABI
+const erc20AllowanceABI = `[
+	{
+		"inputs": [
+			{"name": "spender", "type": "address"},
+			{"name": "amount", "type": "uint256"}
+		],
+		"name": "approve",
+		"outputs": [{"type": "bool"}],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "spender", "type": "address"},
+			{"name": "addedValue", "type": "uint256"}
+		],
+		"name": "increaseAllowance",
+		"outputs": [{"type": "bool"}],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "owner", "type": "address"},
+			{"name": "spender", "type": "address"}
+		],
+		"name": "allowance",
+		"outputs": [{"type": "uint256"}],
+		"stateMutability": "view",
+		"type": "function"
+	}
+]`
+
+// ApproveRequest 授权请求 (签名 approve challenge)
+type ApproveRequest struct {
+	PasskeyData
+	Wallet  string `json:"wallet"`         // 用户的 PasskeyWallet 合约地址
+	Token   string `json:"token"`          // ERC20 代币合约地址
+	Spender string `json:"spender"`        // 被授权方 (DeFi 协议合约)
+	Amount  string `json:"amount"`         // 授权额度 (最小单位)，"max" 为无限额度；0 表示撤销授权
+	Mode    string `json:"mode,omitempty"` // approve (默认) / increase
+
+	MaxGasPrice string `json:"maxGasPrice,omitempty"` // 可选: 本次授权接受的最高 gas price (wei)
+
+	requestID string
+}
+
+// AllowanceData 授权额度查询结果
+type AllowanceData struct {
+	Token     string `json:"token"`
+	Owner     string `json:"owner"`
+	Spender   string `json:"spender"`
+	Allowance string `json:"allowance"` // 原始值 (最小单位)
+	Formatted string `json:"formatted"`
+	Symbol    string `json:"symbol"`
+	Decimals  uint8  `json:"decimals"`
+	Unlimited bool   `json:"unlimited"` // 额度为 2^256-1
+}
+
+// asTransfer 转换为转账请求，复用合规筛查、费用检查与审计 (对方记为 spender)
+func (req *ApproveRequest) asTransfer() *ERC20TransferRequest {
+	return &ERC20TransferRequest{
+		PasskeyData: req.PasskeyData,
+		Wallet:      req.Wallet,
+		Token:       req.Token,
+		To:          req.Spender,
+		Amount:      req.Amount,
+		MaxGasPrice: req.MaxGasPrice,
+		requestID:   req.requestID,
+	}
+}
+
+// amount 解析授权额度
+func (req *ApproveRequest) amount() (*big.Int, error) {
+	if req.Amount == approveUnlimited {
+		return new(big.Int).Set(math.MaxBig256), nil
+	}
+	amount, ok := new(big.Int).SetString(req.Amount, 10)
+	if !ok || amount.Sign() < 0 || amount.BitLen() > 256 {
+		return nil, fmt.Errorf("金额格式错误: %s", req.Amount)
+	}
+	return amount, nil
+}
+
+// getAllowance 查询 owner 给 spender 的授权额度
+func (srv *Server) getAllowance(token, owner, spender common.Address) (*big.Int, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(erc20AllowanceABI))
+	data, _ := parsedABI.Pack("allowance", owner, spender)
+	out, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) != 32 {
+		return nil, fmt.Errorf("%s 不支持 allowance()", token.Hex())
+	}
+	return new(big.Int).SetBytes(out), nil
+}
+
+// validateApproveRequest 校验授权请求，返回额度与按当前额度给出的提示
+func (srv *Server) validateApproveRequest(req *ApproveRequest) (*big.Int, []string, error) {
+	if req.Wallet == "" || req.Token == "" || req.Spender == "" || req.Amount == "" {
+		return nil, nil, fmt.Errorf("缺少必要参数: wallet, token, spender, amount")
+	}
+	for name, addr := range map[string]string{"wallet": req.Wallet, "token": req.Token, "spender": req.Spender} {
+		if !common.IsHexAddress(addr) {
+			return nil, nil, fmt.Errorf("%s 地址格式错误: %s", name, addr)
+		}
+	}
+	switch req.Mode {
+	case "":
+		req.Mode = approveModeSet
+	case approveModeSet, approveModeIncrease:
+	default:
+		return nil, nil, fmt.Errorf("mode 只能是 approve 或 increase")
+	}
+	wallet := common.HexToAddress(req.Wallet)
+	if srv.walletFrozen(wallet) {
+		return nil, nil, fmt.Errorf("钱包已冻结，解除冻结前不能授权")
+	}
+	amount, err := req.amount()
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.Mode == approveModeIncrease && amount.Sign() == 0 {
+		return nil, nil, fmt.Errorf("increase 的额度必须大于 0")
+	}
+
+	transfer := req.asTransfer()
+	if err := srv.screenTransfer(transfer); err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	if amount.Cmp(math.MaxBig256) == 0 {
+		warnings = append(warnings, "无限额度授权: spender 可以随时转走钱包中该代币的全部余额")
+	}
+	current, err := srv.getAllowance(common.HexToAddress(req.Token), wallet, common.HexToAddress(req.Spender))
+	if err != nil {
+		return nil, nil, fmt.Errorf("查询当前授权失败: %v", err)
+	}
+	if req.Mode == approveModeSet && current.Sign() > 0 && amount.Sign() > 0 {
+		// USDT 等代币要求先清零再设置新额度，否则 approve 回滚
+		warnings = append(warnings, fmt.Sprintf("当前已有授权额度 %s，部分代币 (如 USDT) 需要先授权 0 再设置新额度", current))
+	}
+	return amount, warnings, srv.checkTransferFees(transfer)
+}
+
+// walletApproveCall 按钱包类型编码授权调用 (经钱包的 execute，msg.sender 为钱包自身)
+func (srv *Server) walletApproveCall(wt *WalletTypeConfig, req *ApproveRequest, amount *big.Int) (common.Address, []byte, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(erc20AllowanceABI))
+	method := "approve"
+	if req.Mode == approveModeIncrease {
+		method = "increaseAllowance"
+	}
+	inner, err := parsedABI.Pack(method, common.HexToAddress(req.Spender), amount)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	return srv.walletExecuteCall(wt, common.HexToAddress(req.Wallet), common.HexToAddress(req.Token), big.NewInt(0), inner, &req.PasskeyData, req.requestID)
+}
+
+// recordApprove 记录一次授权 (to 为 spender，金额为授权额度)
+func (srv *Server) recordApprove(req *ApproveRequest, amount *big.Int, txHash common.Hash) {
+	token := common.HexToAddress(req.Token)
+	parsedABI, _ := abi.JSON(strings.NewReader(erc20ABI))
+	meta := srv.getTokenMetadata(parsedABI, token)
+	precision, locale := srv.formatOptions("", "")
+	typ := "approve"
+	if req.Mode == approveModeIncrease {
+		typ = "increase_allowance"
+	}
+	srv.addHistory(HistoryRecord{
+		Type:      typ,
+		Wallet:    common.HexToAddress(req.Wallet).Hex(),
+		Token:     token.Hex(),
+		To:        common.HexToAddress(req.Spender).Hex(),
+		Amount:    amount.String(),
+		Formatted: formatAmount(amount, meta.Decimals, precision, locale),
+		Decimals:  meta.Decimals,
+		Symbol:    meta.Symbol,
+		TxHash:    txHash.Hex(),
+	})
+}
+
+// handleAllowance 查询授权额度
+//
+//	GET /api/allowance?token=0x..&owner=0x..&spender=0x..
+func (srv *Server) handleAllowance(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	for _, name := range []string{"token", "owner", "spender"} {
+		if !common.IsHexAddress(q.Get(name)) {
+			sendError(w, name+" 地址格式错误: "+q.Get(name))
+			return
+		}
+	}
+	token := common.HexToAddress(q.Get("token"))
+	owner := common.HexToAddress(q.Get("owner"))
+	spender := common.HexToAddress(q.Get("spender"))
+
+	allowance, err := srv.getAllowance(token, owner, spender)
+	if err != nil {
+		sendError(w, "查询授权失败: "+err.Error())
+		return
+	}
+	parsedABI, _ := abi.JSON(strings.NewReader(erc20ABI))
+	meta := srv.getTokenMetadata(parsedABI, token)
+	precision, locale := srv.formatOptions(q.Get("precision"), q.Get("locale"))
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data: AllowanceData{
+			Token:     token.Hex(),
+			Owner:     owner.Hex(),
+			Spender:   spender.Hex(),
+			Allowance: allowance.String(),
+			Formatted: formatAmount(allowance, meta.Decimals, precision, locale),
+			Symbol:    meta.Symbol,
+			Decimals:  meta.Decimals,
+			Unlimited: allowance.Cmp(math.MaxBig256) == 0,
+		},
+	})
+}
+
+// handleApprove 中继钱包的 approve / increaseAllowance，流程与 /api/transfer 相同 (challenge 使用 approve 操作)
+func (srv *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	if !srv.canRelayTransfer() {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req ApproveRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	req.requestID = requestIDFrom(r)
+	transfer := req.asTransfer()
+
+	amount, warnings, err := srv.validateApproveRequest(&req)
+	if err != nil {
+		srv.audit(auditApprove, transfer, common.Hash{}, err)
+		sendError(w, err.Error())
+		return
+	}
+
+	wallet := common.HexToAddress(req.Wallet)
+	wt := srv.walletTypeFor(wallet)
+	target, callData, err := srv.walletApproveCall(wt, &req, amount)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	if err := srv.authorizeWalletCall(r, &req.PasskeyData, wallet, opApprove, target, callData); err != nil {
+		srv.audit(auditApprove, transfer, common.Hash{}, err)
+		sendVerificationError(w, err)
+		return
+	}
+
+	if !broadcastRequested(r) {
+		if wt.Encoder == walletEncoderAA {
+			sendError(w, "签名授权交易失败: 4337 账户不支持 broadcast=false")
+			return
+		}
+		signedTx, err := srv.signWalletCall(target, callData)
+		if err != nil {
+			srv.audit(auditApprove, transfer, common.Hash{}, err)
+			sendError(w, "签名授权交易失败: "+err.Error())
+			return
+		}
+		srv.audit(auditApprove, transfer, signedTx.Hash(), nil)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success:     true,
+			Message:     "交易已签名，未广播",
+			TxHash:      signedTx.Hash().Hex(),
+			SNormalized: req.Signature.Normalized(),
+			Data:        srv.rawTxData(signedTx),
+			Warnings:    warnings,
+		})
+		return
+	}
+
+	txHash, batch, err := srv.sendWalletCall(wallet, wt, target, callData, &req.PasskeyData)
+	srv.audit(auditApprove, transfer, txHash, err)
+	if err != nil {
+		sendError(w, "授权失败: "+err.Error())
+		return
+	}
+	srv.recordApprove(&req, amount, txHash)
+
+	message := "授权交易已发送"
+	if wt.Encoder == walletEncoderAA {
+		message = "授权 UserOperation 已提交 (txHash 为 userOpHash)"
+	}
+	resp := APIResponse{
+		Success:     true,
+		Message:     message,
+		TxHash:      txHash.Hex(),
+		SNormalized: req.Signature.Normalized(),
+		Warnings:    append(warnings, srv.recipientWarnings(wallet, common.HexToAddress(req.Spender))...),
+	}
+	if batch != nil {
+		resp.Data = batch
+	}
+	srv.awaitTransfer(r, &resp, txHash, batch, "授权")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,614 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// 注册时要求的 attestation 等级 (webauthn.required_attestation)
+const (
+	attestationLevelNone     = "none"     // 接受任意格式，包括 none 与自签名 (默认)
+	attestationLevelAttested = "attested" // 要求由认证器证书签名的 attestation (证书签名有效即可)
+	attestationLevelTrusted  = "trusted"  // 要求证书链能验证到 attestation_roots，且密钥由硬件保护
+)
+
+// attestation 类型 (WebAuthn §6.5.4)
+const (
+	attestationTypeNone    = "none"
+	attestationTypeSelf    = "self"
+	attestationTypeBasic   = "basic"   // 证书签名有效，未验证证书链
+	attestationTypeTrusted = "trusted" // 证书链验证到已配置的根证书
+)
+
+// 证书扩展 OID
+var (
+	oidFIDOAAGUID          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+	oidAppleNonce          = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 8, 2}
+	oidAndroidKeyDesc      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 1, 17}
+	oidTCGKPAIKCertificate = asn1.ObjectIdentifier{2, 23, 133, 8, 3}
+)
+
+// attestationResult attestation 校验结果
+type attestationResult struct {
+	Type     string `json:"type"`     // none / self / basic / trusted
+	Hardware bool   `json:"hardware"` // 密钥由硬件 (Secure Enclave / TEE / TPM / 认证过的安全密钥) 保护
+}
+
+// attestationInput 各格式校验共用的输入
+type attestationInput struct {
+	att            *parsedAttestation
+	clientDataHash []byte
+	certs          []*x509.Certificate // x5c，叶子证书在前
+}
+
+// signedData authData ‖ clientDataHash
+func (in *attestationInput) signedData() []byte {
+	return append(append([]byte{}, in.att.AuthData...), in.clientDataHash...)
+}
+
+// verifyAttestation 按格式校验 attestation 声明，并在配置了根证书时验证证书链
+func verifyAttestation(att *parsedAttestation, clientDataHash []byte, roots *x509.CertPool) (*attestationResult, error) {
+	in := &attestationInput{att: att, clientDataHash: clientDataHash}
+	if x5c, ok := att.AttStmt["x5c"].([]interface{}); ok {
+		for _, item := range x5c {
+			der, _ := item.([]byte)
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("attestation 证书解析失败: %v", err)
+			}
+			in.certs = append(in.certs, cert)
+		}
+	}
+
+	var res *attestationResult
+	var err error
+	switch att.Format {
+	case "none":
+		if len(att.AttStmt) != 0 {
+			return nil, fmt.Errorf("none attestation 的 attStmt 必须为空")
+		}
+		return &attestationResult{Type: attestationTypeNone}, nil
+	case "packed":
+		res, err = verifyPackedAttestation(in)
+	case "apple":
+		res, err = verifyAppleAttestation(in)
+	case "android-key":
+		res, err = verifyAndroidKeyAttestation(in)
+	case "tpm":
+		res, err = verifyTPMAttestation(in)
+	default:
+		return nil, fmt.Errorf("不支持的 attestation 格式: %s", att.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s attestation: %v", att.Format, err)
+	}
+
+	if res.Type == attestationTypeBasic && roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, cert := range in.certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := in.certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			CurrentTime:   time.Now(),
+		})
+		if err == nil {
+			res.Type = attestationTypeTrusted
+		} else if att.Format != "packed" {
+			// apple / android-key / tpm 的证书链必然来自厂商根证书，配置了根证书却验证失败视为伪造
+			return nil, fmt.Errorf("%s attestation 证书链验证失败: %v", att.Format, err)
+		}
+	}
+	// packed 只有在证书链可信时才能认定为硬件密钥 (FIDO 认证的安全密钥)
+	if att.Format == "packed" {
+		res.Hardware = res.Type == attestationTypeTrusted
+	}
+	return res, nil
+}
+
+// enforceAttestationLevel 检查结果是否满足配置的等级
+func enforceAttestationLevel(level string, res *attestationResult) error {
+	switch level {
+	case "", attestationLevelNone:
+		return nil
+	case attestationLevelAttested:
+		if res.Type == attestationTypeBasic || res.Type == attestationTypeTrusted {
+			return nil
+		}
+		return fmt.Errorf("服务要求认证器证书签名的 attestation，当前为 %s", res.Type)
+	case attestationLevelTrusted:
+		if res.Type == attestationTypeTrusted && res.Hardware {
+			return nil
+		}
+		return fmt.Errorf("服务要求可信的硬件密钥 attestation，当前为 %s (hardware=%v)", res.Type, res.Hardware)
+	}
+	return fmt.Errorf("未知的 required_attestation: %s", level)
+}
+
+// loadAttestationRoots 读取 PEM 根证书，未配置时返回 nil (不验证证书链)
+func loadAttestationRoots(files []string) (*x509.CertPool, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取 attestation 根证书失败: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("attestation 根证书 %s 不是有效的 PEM", file)
+		}
+	}
+	return pool, nil
+}
+
+// verifyPackedAttestation packed 格式 (WebAuthn §8.2)
+func verifyPackedAttestation(in *attestationInput) (*attestationResult, error) {
+	alg, _ := in.att.AttStmt["alg"].(int64)
+	sig, _ := in.att.AttStmt["sig"].([]byte)
+
+	if len(in.certs) == 0 {
+		// 自签名: 用凭证公钥签名，算法必须与凭证一致
+		if alg != coseAlgES256 {
+			return nil, fmt.Errorf("自签名算法与凭证公钥不一致")
+		}
+		if err := verifyCOSESignature(in.att.PublicKey, alg, in.signedData(), sig); err != nil {
+			return nil, err
+		}
+		return &attestationResult{Type: attestationTypeSelf}, nil
+	}
+
+	leaf := in.certs[0]
+	if err := verifyCOSESignature(leaf.PublicKey, alg, in.signedData(), sig); err != nil {
+		return nil, err
+	}
+	if leaf.Version != 3 {
+		return nil, fmt.Errorf("证书版本必须为 3")
+	}
+	if !slices.Contains(leaf.Subject.OrganizationalUnit, "Authenticator Attestation") ||
+		len(leaf.Subject.Country) == 0 || len(leaf.Subject.Organization) == 0 || leaf.Subject.CommonName == "" {
+		return nil, fmt.Errorf("证书 subject 不符合 packed attestation 要求")
+	}
+	if leaf.IsCA {
+		return nil, fmt.Errorf("attestation 证书不能是 CA 证书")
+	}
+	if err := checkAAGUIDExtension(leaf, in.att.AAGUID); err != nil {
+		return nil, err
+	}
+	return &attestationResult{Type: attestationTypeBasic}, nil
+}
+
+// verifyAppleAttestation Apple 匿名 attestation (WebAuthn §8.8)
+func verifyAppleAttestation(in *attestationInput) (*attestationResult, error) {
+	if len(in.certs) == 0 {
+		return nil, fmt.Errorf("缺少 x5c")
+	}
+	leaf := in.certs[0]
+	nonce := sha256.Sum256(in.signedData())
+
+	var ext struct {
+		Nonce []byte `asn1:"tag:1,explicit"`
+	}
+	found := false
+	for _, e := range leaf.Extensions {
+		if e.Id.Equal(oidAppleNonce) {
+			if _, err := asn1.Unmarshal(e.Value, &ext); err != nil {
+				return nil, fmt.Errorf("nonce 扩展解析失败: %v", err)
+			}
+			found = true
+		}
+	}
+	if !found || !bytes.Equal(ext.Nonce, nonce[:]) {
+		return nil, fmt.Errorf("证书 nonce 与 authData/clientDataHash 不匹配")
+	}
+	if !samePublicKey(leaf.PublicKey, in.att.PublicKey) {
+		return nil, fmt.Errorf("证书公钥与凭证公钥不一致")
+	}
+	return &attestationResult{Type: attestationTypeBasic, Hardware: true}, nil
+}
+
+// androidKeyDescription Android Keystore 证书扩展 (KeyDescription)
+type androidKeyDescription struct {
+	AttestationVersion       int
+	AttestationSecurityLevel asn1.Enumerated
+	KeymasterVersion         int
+	KeymasterSecurityLevel   asn1.Enumerated
+	AttestationChallenge     []byte
+	UniqueID                 []byte
+	SoftwareEnforced         asn1.RawValue
+	TeeEnforced              asn1.RawValue
+}
+
+// Android KeyMaster 授权列表的 tag
+const (
+	kmTagPurpose         = 1
+	kmTagAllApplications = 600
+	kmTagOrigin          = 702
+
+	kmPurposeSign     = 2
+	kmOriginGenerated = 0
+)
+
+// verifyAndroidKeyAttestation android-key 格式 (WebAuthn §8.4)
+func verifyAndroidKeyAttestation(in *attestationInput) (*attestationResult, error) {
+	if len(in.certs) == 0 {
+		return nil, fmt.Errorf("缺少 x5c")
+	}
+	alg, _ := in.att.AttStmt["alg"].(int64)
+	sig, _ := in.att.AttStmt["sig"].([]byte)
+	leaf := in.certs[0]
+	if err := verifyCOSESignature(leaf.PublicKey, alg, in.signedData(), sig); err != nil {
+		return nil, err
+	}
+	if !samePublicKey(leaf.PublicKey, in.att.PublicKey) {
+		return nil, fmt.Errorf("证书公钥与凭证公钥不一致")
+	}
+
+	var desc androidKeyDescription
+	found := false
+	for _, e := range leaf.Extensions {
+		if e.Id.Equal(oidAndroidKeyDesc) {
+			if _, err := asn1.Unmarshal(e.Value, &desc); err != nil {
+				return nil, fmt.Errorf("KeyDescription 解析失败: %v", err)
+			}
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("证书缺少 KeyDescription 扩展")
+	}
+	if !bytes.Equal(desc.AttestationChallenge, in.clientDataHash) {
+		return nil, fmt.Errorf("attestationChallenge 与 clientDataHash 不一致")
+	}
+
+	software, err := parseKMAuthorizationList(desc.SoftwareEnforced)
+	if err != nil {
+		return nil, err
+	}
+	tee, err := parseKMAuthorizationList(desc.TeeEnforced)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := software[kmTagAllApplications]; ok {
+		return nil, fmt.Errorf("密钥不能绑定 allApplications")
+	}
+	if _, ok := tee[kmTagAllApplications]; ok {
+		return nil, fmt.Errorf("密钥不能绑定 allApplications")
+	}
+	origin, ok := tee[kmTagOrigin]
+	if !ok {
+		origin, ok = software[kmTagOrigin]
+	}
+	if !ok || !kmIntegerEquals(origin, kmOriginGenerated) {
+		return nil, fmt.Errorf("密钥不是在认证器内生成的")
+	}
+	purpose, ok := tee[kmTagPurpose]
+	if !ok {
+		purpose, ok = software[kmTagPurpose]
+	}
+	if !ok || !kmSetContains(purpose, kmPurposeSign) {
+		return nil, fmt.Errorf("密钥用途不包含签名")
+	}
+
+	// SecurityLevel: 0 Software, 1 TrustedEnvironment, 2 StrongBox
+	return &attestationResult{Type: attestationTypeBasic, Hardware: desc.AttestationSecurityLevel >= 1}, nil
+}
+
+// parseKMAuthorizationList 把授权列表解析为 tag -> 显式标签内的原始内容
+func parseKMAuthorizationList(list asn1.RawValue) (map[int][]byte, error) {
+	out := make(map[int][]byte)
+	rest := list.Bytes
+	for len(rest) > 0 {
+		var item asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &item)
+		if err != nil {
+			return nil, fmt.Errorf("授权列表解析失败: %v", err)
+		}
+		out[item.Tag] = item.Bytes
+	}
+	return out, nil
+}
+
+func kmIntegerEquals(raw []byte, want int) bool {
+	var v int
+	_, err := asn1.Unmarshal(raw, &v)
+	return err == nil && v == want
+}
+
+func kmSetContains(raw []byte, want int) bool {
+	var values []int
+	if _, err := asn1.UnmarshalWithParams(raw, &values, "set"); err != nil {
+		return false
+	}
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// TPM 结构常量
+const (
+	tpmGeneratedValue  = 0xff544347
+	tpmStAttestCertify = 0x8017
+	tpmAlgECC          = 0x0023
+	tpmAlgNull         = 0x0010
+	tpmECCNistP256     = 0x0003
+)
+
+// verifyTPMAttestation tpm 格式 (WebAuthn §8.3)，只支持 ECC P-256 凭证
+func verifyTPMAttestation(in *attestationInput) (*attestationResult, error) {
+	if ver, _ := in.att.AttStmt["ver"].(string); ver != "2.0" {
+		return nil, fmt.Errorf("只支持 TPM 2.0")
+	}
+	if len(in.certs) == 0 {
+		return nil, fmt.Errorf("缺少 x5c (不支持 ECDAA)")
+	}
+	alg, _ := in.att.AttStmt["alg"].(int64)
+	sig, _ := in.att.AttStmt["sig"].([]byte)
+	certInfo, _ := in.att.AttStmt["certInfo"].([]byte)
+	pubArea, _ := in.att.AttStmt["pubArea"].([]byte)
+
+	// pubArea 中的公钥必须与凭证公钥一致
+	nameAlg, x, y, err := parseTPMPublicECC(pubArea)
+	if err != nil {
+		return nil, err
+	}
+	var credX, credY [32]byte
+	in.att.PublicKey.X.FillBytes(credX[:])
+	in.att.PublicKey.Y.FillBytes(credY[:])
+	if !bytes.Equal(x, credX[:]) || !bytes.Equal(y, credY[:]) {
+		return nil, fmt.Errorf("pubArea 公钥与凭证公钥不一致")
+	}
+
+	// certInfo: magic, type, extraData = H_alg(authData ‖ clientDataHash), attested.name = nameAlg ‖ H_nameAlg(pubArea)
+	hash, ok := coseHash(alg)
+	if !ok {
+		return nil, fmt.Errorf("不支持的签名算法: %d", alg)
+	}
+	extraData, attestedName, err := parseTPMCertInfo(certInfo)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(in.signedData())
+	if !bytes.Equal(extraData, h.Sum(nil)) {
+		return nil, fmt.Errorf("certInfo.extraData 与 authData/clientDataHash 不匹配")
+	}
+	nameHash, ok := tpmHash(nameAlg)
+	if !ok {
+		return nil, fmt.Errorf("不支持的 TPM nameAlg: 0x%04x", nameAlg)
+	}
+	nh := nameHash.New()
+	nh.Write(pubArea)
+	wantName := binary.BigEndian.AppendUint16(nil, nameAlg)
+	if !bytes.Equal(attestedName, append(wantName, nh.Sum(nil)...)) {
+		return nil, fmt.Errorf("certInfo.attested.name 与 pubArea 不匹配")
+	}
+
+	leaf := in.certs[0]
+	if err := verifyCOSESignature(leaf.PublicKey, alg, certInfo, sig); err != nil {
+		return nil, err
+	}
+	if leaf.Version != 3 {
+		return nil, fmt.Errorf("AIK 证书版本必须为 3")
+	}
+	if len(leaf.Subject.Names) != 0 {
+		return nil, fmt.Errorf("AIK 证书 subject 必须为空")
+	}
+	if leaf.IsCA {
+		return nil, fmt.Errorf("AIK 证书不能是 CA 证书")
+	}
+	aik := false
+	for _, eku := range leaf.UnknownExtKeyUsage {
+		if eku.Equal(oidTCGKPAIKCertificate) {
+			aik = true
+		}
+	}
+	if !aik {
+		return nil, fmt.Errorf("AIK 证书缺少 tcg-kp-AIKCertificate 用途")
+	}
+	if err := checkAAGUIDExtension(leaf, in.att.AAGUID); err != nil {
+		return nil, err
+	}
+	return &attestationResult{Type: attestationTypeBasic, Hardware: true}, nil
+}
+
+// tpmReader 顺序读取 TPM 大端结构
+type tpmReader struct {
+	buf []byte
+	err error
+}
+
+func (r *tpmReader) u16() uint16 {
+	if r.err != nil || len(r.buf) < 2 {
+		r.err = fmt.Errorf("TPM 结构长度不足")
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.buf)
+	r.buf = r.buf[2:]
+	return v
+}
+
+func (r *tpmReader) bytes(n int) []byte {
+	if r.err != nil || len(r.buf) < n {
+		r.err = fmt.Errorf("TPM 结构长度不足")
+		return nil
+	}
+	v := r.buf[:n]
+	r.buf = r.buf[n:]
+	return v
+}
+
+// sized TPM2B: uint16 长度 + 内容
+func (r *tpmReader) sized() []byte {
+	return r.bytes(int(r.u16()))
+}
+
+// parseTPMPublicECC 解析 TPMT_PUBLIC (ECC)，返回 nameAlg 与公钥坐标
+func parseTPMPublicECC(pubArea []byte) (uint16, []byte, []byte, error) {
+	r := &tpmReader{buf: pubArea}
+	typ := r.u16()
+	nameAlg := r.u16()
+	r.bytes(4) // objectAttributes
+	r.sized()  // authPolicy
+	if r.err == nil && typ != tpmAlgECC {
+		return 0, nil, nil, fmt.Errorf("pubArea 不是 ECC 密钥")
+	}
+	if r.u16() != tpmAlgNull { // symmetric
+		r.bytes(4)
+	}
+	if r.u16() != tpmAlgNull { // scheme
+		r.bytes(2)
+	}
+	curve := r.u16()
+	if r.u16() != tpmAlgNull { // kdf
+		r.bytes(2)
+	}
+	x := r.sized()
+	y := r.sized()
+	if r.err != nil {
+		return 0, nil, nil, fmt.Errorf("pubArea 解析失败: %v", r.err)
+	}
+	if curve != tpmECCNistP256 {
+		return 0, nil, nil, fmt.Errorf("pubArea 曲线不是 P-256")
+	}
+	return nameAlg, x, y, nil
+}
+
+// parseTPMCertInfo 解析 TPMS_ATTEST，返回 extraData 与 attested.name
+func parseTPMCertInfo(certInfo []byte) ([]byte, []byte, error) {
+	r := &tpmReader{buf: certInfo}
+	magic := r.bytes(4)
+	typ := r.u16()
+	r.sized() // qualifiedSigner
+	extra := r.sized()
+	r.bytes(17) // clockInfo
+	r.bytes(8)  // firmwareVersion
+	name := r.sized()
+	r.sized() // qualifiedName
+	if r.err != nil {
+		return nil, nil, fmt.Errorf("certInfo 解析失败: %v", r.err)
+	}
+	if binary.BigEndian.Uint32(magic) != tpmGeneratedValue {
+		return nil, nil, fmt.Errorf("certInfo.magic 无效")
+	}
+	if typ != tpmStAttestCertify {
+		return nil, nil, fmt.Errorf("certInfo.type 不是 TPM_ST_ATTEST_CERTIFY")
+	}
+	return extra, name, nil
+}
+
+func tpmHash(alg uint16) (crypto.Hash, bool) {
+	switch alg {
+	case 0x0004:
+		return crypto.SHA1, true
+	case 0x000B:
+		return crypto.SHA256, true
+	case 0x000C:
+		return crypto.SHA384, true
+	case 0x000D:
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// coseHash COSE 签名算法对应的摘要算法
+func coseHash(alg int64) (crypto.Hash, bool) {
+	switch alg {
+	case -7, -257, -37:
+		return crypto.SHA256, true
+	case -35, -258, -38:
+		return crypto.SHA384, true
+	case -36, -259, -39:
+		return crypto.SHA512, true
+	case -65535:
+		return crypto.SHA1, true
+	}
+	return 0, false
+}
+
+// verifyCOSESignature 按 COSE 算法校验签名 (ECDSA / RSA PKCS#1 v1.5 / RSA-PSS / Ed25519)
+func verifyCOSESignature(pub crypto.PublicKey, alg int64, data, sig []byte) error {
+	if alg == -8 {
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(key, data, sig) {
+			return fmt.Errorf("签名无效")
+		}
+		return nil
+	}
+
+	hash, ok := coseHash(alg)
+	if !ok {
+		return fmt.Errorf("不支持的签名算法: %d", alg)
+	}
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum(data)
+		digest = sum[:]
+	} else {
+		h := hash.New()
+		h.Write(data)
+		digest = h.Sum(nil)
+	}
+
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		if alg == -7 || alg == -35 || alg == -36 {
+			if ecdsa.VerifyASN1(key, digest, sig) {
+				return nil
+			}
+		}
+	case *rsa.PublicKey:
+		switch alg {
+		case -257, -258, -259, -65535:
+			if rsa.VerifyPKCS1v15(key, hash, digest, sig) == nil {
+				return nil
+			}
+		case -37, -38, -39:
+			if rsa.VerifyPSS(key, hash, digest, sig, nil) == nil {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("签名无效")
+}
+
+// checkAAGUIDExtension 证书带 id-fido-gen-ce-aaguid 扩展时必须与 authData 中的 AAGUID 一致
+func checkAAGUIDExtension(cert *x509.Certificate, aaguid []byte) error {
+	for _, e := range cert.Extensions {
+		if !e.Id.Equal(oidFIDOAAGUID) {
+			continue
+		}
+		if e.Critical {
+			return fmt.Errorf("AAGUID 扩展不能标记为 critical")
+		}
+		var value []byte
+		if _, err := asn1.Unmarshal(e.Value, &value); err != nil || !bytes.Equal(value, aaguid) {
+			return fmt.Errorf("证书 AAGUID 与 authData 不一致")
+		}
+	}
+	return nil
+}
+
+func samePublicKey(certKey crypto.PublicKey, cred *ecdsa.PublicKey) bool {
+	key, ok := certKey.(*ecdsa.PublicKey)
+	return ok && key.Equal(cred)
+}
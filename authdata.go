@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// authenticatorData flags
+const (
+	authFlagUserPresent    = 0x01 // UP
+	authFlagUserVerified   = 0x04 // UV
+	authFlagBackupEligible = 0x08 // BE
+	authFlagBackedUp       = 0x10 // BS
+	authFlagAttested       = 0x40 // AT
+	authFlagExtensions     = 0x80 // ED
+)
+
+// authDataMinLength rpIdHash(32) + flags(1) + signCount(4)
+const authDataMinLength = 37
+
+// AuthenticatorFlags authenticatorData 中的标志位
+type AuthenticatorFlags struct {
+	UserPresent    bool `json:"up"`
+	UserVerified   bool `json:"uv"`
+	BackupEligible bool `json:"be"`
+	BackedUp       bool `json:"bs"`
+	Attested       bool `json:"at"`
+	Extensions     bool `json:"ed"`
+}
+
+// AuthenticatorDataInfo 解析后的 authenticatorData，校验失败时随错误一起返回给客户端
+type AuthenticatorDataInfo struct {
+	RPIDHash         string             `json:"rpIdHash"`
+	ExpectedRPID     string             `json:"expectedRpId,omitempty"`
+	ExpectedRPIDHash string             `json:"expectedRpIdHash,omitempty"`
+	Flags            AuthenticatorFlags `json:"flags"`
+	RawFlags         string             `json:"rawFlags"` // 十六进制
+	SignCount        uint32             `json:"signCount"`
+
+	flags byte
+}
+
+// authDataError authenticatorData 校验失败，附带解析结果便于定位原因
+type authDataError struct {
+	reason string
+	info   *AuthenticatorDataInfo
+}
+
+func (e *authDataError) Error() string { return e.reason }
+
+// parseAuthenticatorData 解析 authenticatorData 的固定头部
+func parseAuthenticatorData(raw []byte) (*AuthenticatorDataInfo, error) {
+	if len(raw) < authDataMinLength {
+		return nil, fmt.Errorf("authenticatorData 长度不足: %d 字节 (至少 %d)", len(raw), authDataMinLength)
+	}
+	flags := raw[32]
+	return &AuthenticatorDataInfo{
+		RPIDHash: "0x" + hex.EncodeToString(raw[:32]),
+		Flags: AuthenticatorFlags{
+			UserPresent:    flags&authFlagUserPresent != 0,
+			UserVerified:   flags&authFlagUserVerified != 0,
+			BackupEligible: flags&authFlagBackupEligible != 0,
+			BackedUp:       flags&authFlagBackedUp != 0,
+			Attested:       flags&authFlagAttested != 0,
+			Extensions:     flags&authFlagExtensions != 0,
+		},
+		RawFlags:  fmt.Sprintf("0x%02x", flags),
+		SignCount: binary.BigEndian.Uint32(raw[33:37]),
+		flags:     flags,
+	}, nil
+}
+
+// checkAuthenticatorData 校验 rpIdHash 与 RP ID 一致、UP 已置位，requireUV 时还要求 UV
+func checkAuthenticatorData(raw []byte, rpID string, requireUV bool) (*AuthenticatorDataInfo, error) {
+	info, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := sha256.Sum256([]byte(rpID))
+	if !bytes.Equal(raw[:32], expected[:]) {
+		info.ExpectedRPID = rpID
+		info.ExpectedRPIDHash = "0x" + hex.EncodeToString(expected[:])
+		return info, &authDataError{reason: fmt.Sprintf("rpIdHash 与 RP ID %q 不匹配 (Passkey 可能注册在其他域名下)", rpID), info: info}
+	}
+	if !info.Flags.UserPresent {
+		return info, &authDataError{reason: "认证器未确认用户在场 (UP 未置位)", info: info}
+	}
+	if requireUV && !info.Flags.UserVerified {
+		return info, &authDataError{reason: "认证器未完成用户验证 (UV 未置位，需要指纹/Face ID/PIN)", info: info}
+	}
+	return info, nil
+}
+
+// sendVerificationError 返回错误，authenticatorData 校验失败时在 data 中附带解析结果，
+// signCount 未递增时在 warnings 中提示凭证可能被克隆
+func sendVerificationError(w http.ResponseWriter, err error) {
+	var scErr *signCountError
+	if errors.As(err, &scErr) {
+		json.NewEncoder(w).Encode(APIResponse{
+			Success:  false,
+			Message:  scErr.Error(),
+			Warnings: []string{scErr.warning()},
+		})
+		return
+	}
+	var adErr *authDataError
+	if errors.As(err, &adErr) {
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: false,
+			Message: adErr.reason,
+			Data:    adErr.info,
+		})
+		return
+	}
+	sendError(w, err.Error())
+}
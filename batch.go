@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// multicall3Address Multicall3 在各链上的统一部署地址
+var multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// Multicall3 ABI (aggregate3、getEthBalance)
+const multicall3ABI = `[
+	{
+		"inputs": [
+			{
+				"name": "calls",
+				"type": "tuple[]",
+				"components": [
+					{"name": "target", "type": "address"},
+					{"name": "allowFailure", "type": "bool"},
+					{"name": "callData", "type": "bytes"}
+				]
+			}
+		],
+		"name": "aggregate3",
+		"outputs": [
+			{
+				"name": "returnData",
+				"type": "tuple[]",
+				"components": [
+					{"name": "success", "type": "bool"},
+					{"name": "returnData", "type": "bytes"}
+				]
+			}
+		],
+		"stateMutability": "payable",
+		"type": "function"
+	},
+	{"inputs":[{"name":"addr","type":"address"}],"name":"getEthBalance","outputs":[{"name":"balance","type":"uint256"}],"stateMutability":"view","type":"function"}
+]`
+
+// EntryPoint 的 FailedOp 错误，用于从批量 handleOps 中剔除验证失败的 op
+const failedOpABI = `[
+	{
+		"inputs": [
+			{"name": "opIndex", "type": "uint256"},
+			{"name": "reason", "type": "string"}
+		],
+		"name": "FailedOp",
+		"type": "error"
+	}
+]`
+
+// defaultBatchMaxSize 配置了 window 但未配置 max_size 时的批量上限
+const defaultBatchMaxSize = 10
+
+// BatchConfig 转账聚合配置，window_ms 为 0 时不聚合
+type BatchConfig struct {
+	WindowMs int `yaml:"window_ms"` // 第一笔请求到达后等待的时间 (毫秒)
+	MaxSize  int `yaml:"max_size"`  // 达到该数量立即发送
+}
+
+// BatchInfo 单个请求在批量交易中的归属
+type BatchInfo struct {
+	Mode   string `json:"mode"` // multicall / handleOps
+	TxHash string `json:"txHash"`
+	Index  int    `json:"index"`
+	Size   int    `json:"size"`
+}
+
+// multicall3Call / multicall3Result aggregate3 参数与返回值
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// batchEntry 等待聚合的请求 (call 或 op 二选一)
+type batchEntry struct {
+	to       common.Address
+	callData []byte
+	op       *UserOperation
+
+	done chan batchResult
+}
+
+type batchResult struct {
+	hash common.Hash // EOA 模式为交易哈希，4337 模式为 userOpHash
+	info *BatchInfo
+	err  error
+}
+
+// batchQueue 按时间窗口与数量聚合请求，flush 负责发送并回填每个请求的结果
+type batchQueue struct {
+	mu      sync.Mutex
+	entries []*batchEntry
+	timer   *time.Timer
+	flush   func([]*batchEntry)
+}
+
+// submit 入队并阻塞到所在批次发送完成
+func (q *batchQueue) submit(e *batchEntry, cfg BatchConfig) batchResult {
+	maxSize := cfg.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultBatchMaxSize
+	}
+	e.done = make(chan batchResult, 1)
+
+	q.mu.Lock()
+	q.entries = append(q.entries, e)
+	switch {
+	case len(q.entries) >= maxSize:
+		entries := q.take()
+		q.mu.Unlock()
+		go q.flush(entries)
+	case len(q.entries) == 1:
+		q.timer = time.AfterFunc(time.Duration(cfg.WindowMs)*time.Millisecond, q.flushNow)
+		q.mu.Unlock()
+	default:
+		q.mu.Unlock()
+	}
+	return <-e.done
+}
+
+// take 取出当前批次 (调用方持有锁)
+func (q *batchQueue) take() []*batchEntry {
+	entries := q.entries
+	q.entries = nil
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+	return entries
+}
+
+func (q *batchQueue) flushNow() {
+	q.mu.Lock()
+	entries := q.take()
+	q.mu.Unlock()
+	if len(entries) > 0 {
+		q.flush(entries)
+	}
+}
+
+// batcher EOA 模式用 Multicall3 聚合 transferERC20，自建 bundler 模式聚合为一次 handleOps
+type batcher struct {
+	srv   *Server
+	calls batchQueue
+	ops   batchQueue
+}
+
+func newBatcher(srv *Server) *batcher {
+	b := &batcher{srv: srv}
+	b.calls.flush = b.flushCalls
+	b.ops.flush = b.flushOps
+	return b
+}
+
+func (b *batcher) enabled() bool {
+	return b.srv.Config().Batch.WindowMs > 0
+}
+
+// submitCall 提交一笔由中继账户发起的钱包调用
+func (b *batcher) submitCall(to common.Address, callData []byte) (common.Hash, *BatchInfo, error) {
+	res := b.calls.submit(&batchEntry{to: to, callData: callData}, b.srv.Config().Batch)
+	return res.hash, res.info, res.err
+}
+
+// submitUserOp 提交一个已填好 gas 与签名的 op
+func (b *batcher) submitUserOp(op *UserOperation) (common.Hash, *BatchInfo, error) {
+	res := b.ops.submit(&batchEntry{op: op}, b.srv.Config().Batch)
+	return res.hash, res.info, res.err
+}
+
+// flushCalls 先 eth_call 预演 aggregate3，失败的调用单独返回错误，其余合并为一笔交易
+func (b *batcher) flushCalls(entries []*batchEntry) {
+	srv := b.srv
+	parsedABI, _ := abi.JSON(strings.NewReader(multicall3ABI))
+
+	pack := func(entries []*batchEntry) []byte {
+		calls := make([]multicall3Call, len(entries))
+		for i, e := range entries {
+			calls[i] = multicall3Call{Target: e.to, AllowFailure: true, CallData: e.callData}
+		}
+		data, _ := parsedABI.Pack("aggregate3", calls)
+		return data
+	}
+
+	msg := ethereum.CallMsg{To: &multicall3Address, Data: pack(entries)}
+	if s := srv.signer(); s != nil {
+		msg.From = s.Address()
+	}
+	out, err := srv.eth().CallContract(context.Background(), msg, nil)
+	if err != nil {
+		failAll(entries, fmt.Errorf("预演批量交易失败: %v", decodeRevert(err)))
+		return
+	}
+	var results []multicall3Result
+	if err := parsedABI.UnpackIntoInterface(&results, "aggregate3", out); err != nil || len(results) != len(entries) {
+		failAll(entries, fmt.Errorf("解析批量预演结果失败 (链上是否部署了 Multicall3?)"))
+		return
+	}
+
+	var ok []*batchEntry
+	for i, e := range entries {
+		if results[i].Success {
+			ok = append(ok, e)
+			continue
+		}
+		reason := "调用回滚"
+		if r, err := abi.UnpackRevert(results[i].ReturnData); err == nil {
+			reason = r
+		}
+		e.done <- batchResult{err: fmt.Errorf("批量预演失败: %s", reason)}
+	}
+	if len(ok) == 0 {
+		return
+	}
+
+	// 只剩一笔时直接发送，省去 Multicall3 的开销
+	var txHash common.Hash
+	if len(ok) == 1 {
+		txHash, err = srv.sendTransaction(ok[0].to, big.NewInt(0), ok[0].callData)
+	} else {
+		txHash, err = srv.sendTransaction(multicall3Address, big.NewInt(0), pack(ok))
+	}
+	if err != nil {
+		failAll(ok, err)
+		return
+	}
+	for i, e := range ok {
+		e.done <- batchResult{hash: txHash, info: &BatchInfo{Mode: "multicall", TxHash: txHash.Hex(), Index: i, Size: len(ok)}}
+	}
+}
+
+// flushOps 预演 handleOps，按 FailedOp(opIndex) 逐个剔除验证失败的 op，其余一次提交
+func (b *batcher) flushOps(entries []*batchEntry) {
+	srv := b.srv
+	s := srv.signer()
+	if s == nil {
+		failAll(entries, fmt.Errorf("自建 bundler 需要配置中继私钥"))
+		return
+	}
+	beneficiary := s.Address()
+	ep := srv.entryPointAddress()
+	parsedABI, _ := abi.JSON(strings.NewReader(entryPointABI))
+	errorsABI, _ := abi.JSON(strings.NewReader(failedOpABI))
+
+	var callData []byte
+	for len(entries) > 0 {
+		ops := make([]packedUserOp, len(entries))
+		for i, e := range entries {
+			ops[i] = e.op.pack()
+		}
+		var err error
+		callData, err = parsedABI.Pack("handleOps", ops, beneficiary)
+		if err != nil {
+			failAll(entries, fmt.Errorf("编码 handleOps 失败: %v", err))
+			return
+		}
+
+		_, err = srv.eth().CallContract(context.Background(), ethereum.CallMsg{From: beneficiary, To: &ep, Data: callData}, nil)
+		if err == nil {
+			break
+		}
+		index, reason, ok := decodeFailedOp(errorsABI, err)
+		if !ok || index >= len(entries) {
+			failAll(entries, fmt.Errorf("预演 handleOps 失败: %v", decodeRevert(err)))
+			return
+		}
+		entries[index].done <- batchResult{err: fmt.Errorf("UserOperation 验证失败: %s", reason)}
+		entries = append(entries[:index], entries[index+1:]...)
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	txHash, err := srv.sendTransaction(ep, big.NewInt(0), callData)
+	if err != nil {
+		failAll(entries, err)
+		return
+	}
+	for i, e := range entries {
+		opHash := userOpHash(e.op, ep, srv.chainID)
+		srv.userOps.update(opHash, func(st *UserOpStatus) {
+			st.TxHash = txHash.Hex()
+			st.State = "pending"
+		})
+		go srv.trackUserOpInclusion(opHash, txHash)
+		e.done <- batchResult{hash: opHash, info: &BatchInfo{Mode: "handleOps", TxHash: txHash.Hex(), Index: i, Size: len(entries)}}
+	}
+}
+
+// decodeFailedOp 从 handleOps 回滚数据中解析 FailedOp(opIndex, reason)
+func decodeFailedOp(errorsABI abi.ABI, err error) (int, string, bool) {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return 0, "", false
+	}
+	s, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return 0, "", false
+	}
+	data := common.FromHex(s)
+	failedOp := errorsABI.Errors["FailedOp"]
+	if len(data) < 4 || !bytes.Equal(data[:4], failedOp.ID[:4]) {
+		return 0, "", false
+	}
+	values, err := failedOp.Inputs.Unpack(data[4:])
+	if err != nil || len(values) != 2 {
+		return 0, "", false
+	}
+	index, _ := values[0].(*big.Int)
+	reason, _ := values[1].(string)
+	if index == nil {
+		return 0, "", false
+	}
+	return int(index.Int64()), reason, true
+}
+
+func failAll(entries []*batchEntry, err error) {
+	for _, e := range entries {
+		e.done <- batchResult{err: err}
+	}
+}
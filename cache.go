@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 缓存键
+const (
+	cacheKeyConfig = "config"
+	cacheKeyChain  = "chain"
+	cacheKeyTokens = "tokens" // 按 chainId 区分: tokens/<chainId>
+)
+
+// responseCache 简单的服务端响应缓存 (TTL + 显式失效)
+type responseCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]*cacheEntry
+}
+
+// cacheEntry 单条缓存记录
+type cacheEntry struct {
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// get 返回未过期的缓存记录
+func (c *responseCache) get(key string) (*cacheEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// set 写入缓存记录，ETag 取响应体的 SHA-256 前 8 字节
+func (c *responseCache) set(key string, body []byte) *cacheEntry {
+	sum := sha256.Sum256(body)
+	entry := &cacheEntry{
+		body:    body,
+		etag:    `"` + hex.EncodeToString(sum[:8]) + `"`,
+		expires: time.Now().Add(c.ttl),
+	}
+
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+	return entry
+}
+
+// invalidate 使指定键失效，不传参数时清空全部缓存
+func (c *responseCache) invalidate(keys ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(keys) == 0 {
+		c.entries = make(map[string]*cacheEntry)
+		return
+	}
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+}
+
+// serveCached 从缓存返回 JSON 响应，未命中时调用 build 生成并写入缓存
+// 同时设置 Cache-Control / ETag，客户端携带 If-None-Match 时返回 304
+func (c *responseCache) serveCached(w http.ResponseWriter, r *http.Request, key string, build func() (interface{}, error)) error {
+	entry, ok := c.get(key)
+	if !ok {
+		v, err := build()
+		if err != nil {
+			return err
+		}
+		body, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		entry = c.set(key, body)
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(c.ttl.Seconds())))
+	w.Header().Set("ETag", entry.etag)
+	if r.Header.Get("If-None-Match") == entry.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Write(entry.body)
+	return nil
+}
+
+// tokenMetadata ERC20 代币元数据 (symbol/decimals 不可变，可长期缓存)
+type tokenMetadata struct {
+	Symbol   string
+	Decimals uint8
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRedisPrefix  = "passkey:"
+	redisTimeout        = 5 * time.Second
+	redisMaxIdle        = 16
+	redisMaxBulkLen     = 64 << 20 // 单个返回值上限，防止错误的服务端耗尽内存
+	redisMaxArrayLength = 1 << 20
+)
+
+func init() {
+	registerCacheDriver("redis", func(cfg CacheConfig) (Cache, error) {
+		return openRedisCache(cfg)
+	})
+}
+
+// errRedisNil redis 返回的空值 (key 不存在)
+var errRedisNil = errors.New("redis: nil")
+
+// redisCache 基于 Redis 的共享缓存 (cache.driver: redis)
+//
+// 只使用 GET / SET (PX、NX) / GETDEL / DEL 命令 (需要 Redis 6.2+)，
+// 内置 RESP 客户端，不依赖第三方库；连接按需建立，空闲连接复用。
+type redisCache struct {
+	addr     string
+	useTLS   bool
+	username string
+	password string
+	db       int
+	prefix   string
+	idle     chan *redisConn
+}
+
+// redisConn 单个连接
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// openRedisCache 解析 url 并检查连接 (PING)
+func openRedisCache(cfg CacheConfig) (*redisCache, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("cache.url 不能为空")
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("cache.url 格式错误: %v", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("cache.url 只支持 redis:// 或 rediss://")
+	}
+	c := &redisCache{
+		addr:   u.Host,
+		useTLS: u.Scheme == "rediss",
+		prefix: cfg.Prefix,
+		idle:   make(chan *redisConn, redisMaxIdle),
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if c.prefix == "" {
+		c.prefix = defaultRedisPrefix
+	}
+	if u.User != nil {
+		c.password, _ = u.User.Password()
+		if c.password != "" {
+			c.username = u.User.Username()
+		} else {
+			// redis://secret@host 视为只有密码
+			c.password = u.User.Username()
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("cache.url 数据库编号错误: %s", db)
+		}
+	}
+	if c.password != "" {
+		registerLogSecret(c.password)
+	}
+	if _, err := c.do("PING"); err != nil {
+		return nil, fmt.Errorf("连接 redis %s 失败: %v", c.addr, err)
+	}
+	return c, nil
+}
+
+// dial 建立连接并完成认证、选择数据库
+func (c *redisCache) dial() (*redisConn, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	if c.useTLS {
+		host, _, _ := net.SplitHostPort(c.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.username != "" {
+			args = []string{"AUTH", c.username, c.password}
+		}
+		if _, err := rc.do(args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("认证失败: %v", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.do("SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+// do 取一个空闲连接执行命令；网络错误时丢弃连接，redis 返回的错误不影响连接复用
+func (c *redisCache) do(args ...string) (interface{}, error) {
+	var rc *redisConn
+	select {
+	case rc = <-c.idle:
+	default:
+		var err error
+		if rc, err = c.dial(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := rc.do(args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) && err != errRedisNil {
+		rc.conn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- rc:
+	default:
+		rc.conn.Close()
+	}
+	return reply, err
+}
+
+// key 带前缀的 redis key
+func (c *redisCache) key(ns, key string) string {
+	return c.prefix + ns + ":" + key
+}
+
+func (c *redisCache) Get(ns, key string) ([]byte, bool, error) {
+	return bulkReply(c.do("GET", c.key(ns, key)))
+}
+
+func (c *redisCache) Set(ns, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", c.key(ns, key), string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.do(args...)
+	return err
+}
+
+func (c *redisCache) SetNX(ns, key string, value []byte, ttl time.Duration) (bool, error) {
+	args := []string{"SET", c.key(ns, key), string(value), "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.do(args...)
+	if err == errRedisNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *redisCache) Take(ns, key string) ([]byte, bool, error) {
+	return bulkReply(c.do("GETDEL", c.key(ns, key)))
+}
+
+func (c *redisCache) Delete(ns, key string) error {
+	_, err := c.do("DEL", c.key(ns, key))
+	return err
+}
+
+func (c *redisCache) Close() error {
+	for {
+		select {
+		case rc := <-c.idle:
+			rc.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// bulkReply 把 GET / GETDEL 的返回值转换为 (value, ok, err)
+func bulkReply(reply interface{}, err error) ([]byte, bool, error) {
+	if err == errRedisNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis: 意外的返回类型 %T", reply)
+	}
+	return value, true, nil
+}
+
+// redisError redis 返回的错误 (-ERR ...)
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// do 发送一条命令并读取返回值
+func (rc *redisConn) do(args ...string) (interface{}, error) {
+	rc.conn.SetDeadline(time.Now().Add(redisTimeout))
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := io.WriteString(rc.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return rc.read()
+}
+
+// read 解析一个 RESP2 返回值: 简单字符串为 string，整数为 int64，bulk 为 []byte，数组为 []interface{}
+func (rc *redisConn) read() (interface{}, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: 无效的返回: %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n > redisMaxBulkLen {
+			return nil, fmt.Errorf("redis: 无效的长度: %q", body)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n > redisMaxArrayLength {
+			return nil, fmt.Errorf("redis: 无效的长度: %q", body)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := rc.read()
+			var redisErr redisError
+			switch {
+			case errors.As(err, &redisErr):
+				item = redisErr
+			case err != nil && err != errRedisNil:
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: 无效的返回: %q", line)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 转账热路径的调用数据模板
+//
+// transferERC20 / transferETH 与 execute 的参数布局是固定的，方法选择器在启动时从 ABI 计算一次，
+// 每次请求只需按 32 字节槽位写入参数，避免 abi.JSON 解析与 abi.Pack 的反射开销。
+
+const wordSize = 32
+
+var (
+	selTransferERC20 = methodID(walletABI, "transferERC20")
+	selTransferETH   = methodID(walletABI, "transferETH")
+	selExecute       = methodID(walletABI, "execute")
+	selERC20Transfer = methodID(erc20ABI, "transfer")
+)
+
+// methodID 计算方法选择器，ABI 常量有误时直接 panic (启动即暴露)
+func methodID(abiJSON, name string) [4]byte {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		panic(fmt.Sprintf("解析 ABI 失败: %v", err))
+	}
+	method, ok := parsed.Methods[name]
+	if !ok {
+		panic("ABI 中没有方法: " + name)
+	}
+	var id [4]byte
+	copy(id[:], method.ID)
+	return id
+}
+
+// putAddress 写入左侧补零的地址
+func putAddress(word []byte, addr common.Address) {
+	copy(word[wordSize-common.AddressLength:wordSize], addr[:])
+}
+
+// putUint256 写入 uint256，超出范围时报错 (与 abi.Pack 一致)
+func putUint256(word []byte, v *big.Int) error {
+	if v.Sign() < 0 || v.BitLen() > 256 {
+		return fmt.Errorf("数值超出 uint256 范围: %s", v)
+	}
+	v.FillBytes(word[:wordSize])
+	return nil
+}
+
+// padded 按 32 字节对齐后的长度
+func padded(n int) int {
+	return (n + wordSize - 1) / wordSize * wordSize
+}
+
+// putTail 写入动态参数的尾部 (长度 + 右侧补零的内容)，返回占用的字节数
+func putTail(out []byte, b []byte) int {
+	new(big.Int).SetUint64(uint64(len(b))).FillBytes(out[:wordSize])
+	copy(out[wordSize:], b)
+	return wordSize + padded(len(b))
+}
+
+// putOffset 写入动态参数在参数区中的偏移量
+func putOffset(word []byte, offset int) {
+	new(big.Int).SetUint64(uint64(offset)).FillBytes(word[:wordSize])
+}
+
+// encodeTransferERC20 transferERC20(address token, address to, uint256 amount, bytes signature)
+// extra 为调用方将要追加的字节数 (如追踪标记)，预留容量避免二次分配
+func encodeTransferERC20(token, to common.Address, amount *big.Int, sig []byte, extra int) ([]byte, error) {
+	size := 4 + 4*wordSize + wordSize + padded(len(sig))
+	out := make([]byte, size, size+extra)
+	copy(out, selTransferERC20[:])
+	args := out[4:]
+	putAddress(args[0:], token)
+	putAddress(args[wordSize:], to)
+	if err := putUint256(args[2*wordSize:], amount); err != nil {
+		return nil, err
+	}
+	putOffset(args[3*wordSize:], 4*wordSize)
+	putTail(args[4*wordSize:], sig)
+	return out, nil
+}
+
+// encodeTransferETH transferETH(address to, uint256 amount, bytes signature)
+func encodeTransferETH(to common.Address, amount *big.Int, sig []byte, extra int) ([]byte, error) {
+	size := 4 + 3*wordSize + wordSize + padded(len(sig))
+	out := make([]byte, size, size+extra)
+	copy(out, selTransferETH[:])
+	args := out[4:]
+	putAddress(args[0:], to)
+	if err := putUint256(args[wordSize:], amount); err != nil {
+		return nil, err
+	}
+	putOffset(args[2*wordSize:], 3*wordSize)
+	putTail(args[3*wordSize:], sig)
+	return out, nil
+}
+
+// encodeERC20TransferWithSuffix transfer(address to, uint256 amount) 后追加任意字节 (备注)
+func encodeERC20TransferWithSuffix(to common.Address, amount *big.Int, suffix []byte) ([]byte, error) {
+	out := make([]byte, 4+2*wordSize, 4+2*wordSize+len(suffix))
+	copy(out, selERC20Transfer[:])
+	putAddress(out[4:], to)
+	if err := putUint256(out[4+wordSize:], amount); err != nil {
+		return nil, err
+	}
+	return append(out, suffix...), nil
+}
+
+// encodeExecute execute(address to, uint256 value, bytes data, bytes signature)
+// 头部 4 个槽位，data 与 signature 为动态参数: 头部写偏移量，尾部依次写长度与右侧补零的内容
+func encodeExecute(to common.Address, value *big.Int, data []byte, sig []byte, extra int) ([]byte, error) {
+	size := 4 + 4*wordSize + wordSize + padded(len(data)) + wordSize + padded(len(sig))
+	out := make([]byte, size, size+extra)
+	copy(out, selExecute[:])
+	args := out[4:]
+	putAddress(args[0:], to)
+	if err := putUint256(args[wordSize:], value); err != nil {
+		return nil, err
+	}
+	putOffset(args[2*wordSize:], 4*wordSize)
+	n := putTail(args[4*wordSize:], data)
+	putOffset(args[3*wordSize:], 4*wordSize+n)
+	putTail(args[4*wordSize+n:], sig)
+	return out, nil
+}
+
+// webauthnSignature 钱包合约各操作的 signature 参数: abi.encode(WebAuthnAuth)
+//
+//	struct WebAuthnAuth { bytes authenticatorData; string clientDataJSON; uint256 challengeIndex; uint256 typeIndex; bytes32 r; bytes32 s; }
+//
+// 两个 index 为 clientDataJSON 中 "challenge":"..." 与 "type":"webauthn.get" 的起始位置，合约据此核对
+// challenge 是否为本次操作的摘要。数据不完整 (如预估 gas 时未签名) 时照常编码，由合约判定签名无效。
+func webauthnSignature(data *PasskeyData) []byte {
+	authData := common.FromHex(data.WebAuthn.AuthenticatorData)
+	clientData, _ := decodeB64URL(data.WebAuthn.ClientDataJSON)
+	r := hexToBytes32(data.Signature.R)
+	s := hexToBytes32(data.Signature.S)
+
+	authTail := wordSize + padded(len(authData))
+	out := make([]byte, wordSize+6*wordSize+authTail+wordSize+padded(len(clientData)))
+	putOffset(out, wordSize)
+	tuple := out[wordSize:]
+	putOffset(tuple[0:], 6*wordSize)
+	putOffset(tuple[wordSize:], 6*wordSize+authTail)
+	putOffset(tuple[2*wordSize:], max(bytes.Index(clientData, []byte(`"challenge":"`)), 0))
+	putOffset(tuple[3*wordSize:], max(bytes.Index(clientData, []byte(`"type":"webauthn.get"`)), 0))
+	copy(tuple[4*wordSize:], r[:])
+	copy(tuple[5*wordSize:], s[:])
+	putTail(tuple[6*wordSize:], authData)
+	putTail(tuple[6*wordSize+authTail:], clientData)
+	return out
+}
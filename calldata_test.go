@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 模板编码必须与 abi.Pack 逐字节一致
+//
+//	go test -run '^$' -bench Calldata -benchmem
+
+var (
+	benchToken  = common.HexToAddress("0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238")
+	benchTo     = common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+	benchAmount = big.NewInt(1234567890)
+	benchMemo   = []byte("INV-2026-0001")
+	benchSig    = webauthnSignature(benchPasskey())
+)
+
+// benchPasskey 一份格式完整的断言 (签名值为占位)
+func benchPasskey() *PasskeyData {
+	var data PasskeyData
+	data.WebAuthn.AuthenticatorData = "0x" + strings.Repeat("49", 32) + "0500000007"
+	data.WebAuthn.ClientDataJSON = base64.RawURLEncoding.EncodeToString(
+		[]byte(`{"type":"webauthn.get","challenge":"` + strings.Repeat("A", 43) + `","origin":"http://localhost:8080"}`))
+	data.Signature.R = "0x" + strings.Repeat("22", 32)
+	data.Signature.S = "0x" + strings.Repeat("33", 32)
+	return &data
+}
+
+func mustParseABI(t testing.TB, raw string) abi.ABI {
+	t.Helper()
+	parsed, err := abi.JSON(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestCalldataMatchesABIPack(t *testing.T) {
+	wallet := mustParseABI(t, walletABI)
+	erc20 := mustParseABI(t, erc20ABI)
+	maxUint := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+	for _, amount := range []*big.Int{big.NewInt(0), benchAmount, maxUint} {
+		want, err := wallet.Pack("transferERC20", benchToken, benchTo, amount, benchSig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := encodeTransferERC20(benchToken, benchTo, amount, benchSig, 0)
+		if err != nil || !bytes.Equal(want, got) {
+			t.Errorf("transferERC20(%s) 与 abi.Pack 不一致: %v", amount, err)
+		}
+
+		want, err = wallet.Pack("transferETH", benchTo, amount, benchSig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = encodeTransferETH(benchTo, amount, benchSig, 0)
+		if err != nil || !bytes.Equal(want, got) {
+			t.Errorf("transferETH(%s) 与 abi.Pack 不一致: %v", amount, err)
+		}
+	}
+
+	// 备注长度覆盖空、不足一个槽位、恰好对齐 (transfer 调用数据 68 字节 + 28 = 96) 与跨槽位
+	for _, memo := range [][]byte{nil, benchMemo, bytes.Repeat([]byte{0xab}, 28), bytes.Repeat([]byte{0xcd}, 100)} {
+		inner, err := erc20.Pack("transfer", benchTo, benchAmount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inner = append(inner, memo...)
+		got, err := encodeERC20TransferWithSuffix(benchTo, benchAmount, memo)
+		if err != nil || !bytes.Equal(inner, got) {
+			t.Errorf("transfer + %d 字节备注与 abi.Pack 不一致: %v", len(memo), err)
+		}
+
+		want, err := wallet.Pack("execute", benchToken, big.NewInt(0), inner, benchSig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err = encodeExecute(benchToken, big.NewInt(0), inner, benchSig, 0)
+		if err != nil || !bytes.Equal(want, got) {
+			t.Errorf("execute (data %d 字节) 与 abi.Pack 不一致: %v", len(inner), err)
+		}
+	}
+
+	tooLarge := new(big.Int).Lsh(big.NewInt(1), 256)
+	if _, err := encodeTransferERC20(benchToken, benchTo, tooLarge, benchSig, 0); err == nil {
+		t.Error("超出 uint256 的金额应当报错")
+	}
+	if _, err := encodeTransferETH(benchTo, big.NewInt(-1), benchSig, 0); err == nil {
+		t.Error("负数金额应当报错")
+	}
+}
+
+// webauthnSignature 的手工编码必须能按合约的 abi.decode(signature, (WebAuthnAuth)) 解出原值
+func TestWebAuthnSignatureMatchesABI(t *testing.T) {
+	tuple, err := abi.NewType("tuple", "", []abi.ArgumentMarshaling{
+		{Name: "authenticatorData", Type: "bytes"},
+		{Name: "clientDataJSON", Type: "string"},
+		{Name: "challengeIndex", Type: "uint256"},
+		{Name: "typeIndex", Type: "uint256"},
+		{Name: "r", Type: "bytes32"},
+		{Name: "s", Type: "bytes32"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := abi.Arguments{{Type: tuple}}
+
+	data := benchPasskey()
+	clientData, _ := decodeB64URL(data.WebAuthn.ClientDataJSON)
+	auth := struct {
+		AuthenticatorData []byte   `abi:"authenticatorData"`
+		ClientDataJSON    string   `abi:"clientDataJSON"`
+		ChallengeIndex    *big.Int `abi:"challengeIndex"`
+		TypeIndex         *big.Int `abi:"typeIndex"`
+		R                 [32]byte `abi:"r"`
+		S                 [32]byte `abi:"s"`
+	}{
+		AuthenticatorData: common.FromHex(data.WebAuthn.AuthenticatorData),
+		ClientDataJSON:    string(clientData),
+		ChallengeIndex:    big.NewInt(int64(bytes.Index(clientData, []byte(`"challenge":"`)))),
+		TypeIndex:         big.NewInt(int64(bytes.Index(clientData, []byte(`"type":"webauthn.get"`)))),
+		R:                 hexToBytes32(data.Signature.R),
+		S:                 hexToBytes32(data.Signature.S),
+	}
+	want, err := args.Pack(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := webauthnSignature(data); !bytes.Equal(want, got) {
+		t.Fatalf("webauthnSignature 与 abi.Pack 不一致\n got %x\nwant %x", got, want)
+	}
+	if auth.ChallengeIndex.Sign() <= 0 || auth.TypeIndex.Sign() < 0 {
+		t.Fatalf("clientDataJSON 中未找到 challenge/type: %d %d", auth.ChallengeIndex, auth.TypeIndex)
+	}
+
+	// 未签名的请求 (预估 gas、生成 challenge) 同样可以编码
+	if got := webauthnSignature(&PasskeyData{}); len(got) != 9*wordSize {
+		t.Fatalf("空断言编码长度 %d，期望 %d", len(got), 9*wordSize)
+	}
+}
+
+func BenchmarkCalldataABIJSONPack(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		parsed, _ := abi.JSON(strings.NewReader(walletABI))
+		parsed.Pack("transferERC20", benchToken, benchTo, benchAmount, benchSig)
+	}
+}
+
+func BenchmarkCalldataABIPack(b *testing.B) {
+	parsed := mustParseABI(b, walletABI)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		parsed.Pack("transferERC20", benchToken, benchTo, benchAmount, benchSig)
+	}
+}
+
+func BenchmarkCalldataTemplate(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		encodeTransferERC20(benchToken, benchTo, benchAmount, benchSig, 0)
+	}
+}
+
+func BenchmarkCalldataTemplateExecuteMemo(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		inner, _ := encodeERC20TransferWithSuffix(benchTo, benchAmount, benchMemo)
+		encodeExecute(benchToken, big.NewInt(0), inner, benchSig, 0)
+	}
+}
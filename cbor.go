@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// cborMaxDepth 嵌套深度上限，防止恶意输入导致深递归
+const cborMaxDepth = 16
+
+// cborDecode 解码一个 CBOR 数据项，返回值与剩余字节
+//
+// 只实现 WebAuthn attestationObject / COSE_Key 用到的子集:
+// 整数 (int64)、字节串 ([]byte)、文本串 (string)、数组 ([]interface{})、
+// 映射 (map[interface{}]interface{})、false / true / null。不支持不定长编码与浮点数。
+func cborDecode(data []byte) (interface{}, []byte, error) {
+	return cborDecodeDepth(data, 0)
+}
+
+func cborDecodeDepth(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, fmt.Errorf("CBOR 嵌套过深")
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("CBOR 数据不完整")
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	rest := data[1:]
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info == 24 && len(rest) >= 1:
+		arg, rest = uint64(rest[0]), rest[1:]
+	case info == 25 && len(rest) >= 2:
+		arg, rest = uint64(binary.BigEndian.Uint16(rest)), rest[2:]
+	case info == 26 && len(rest) >= 4:
+		arg, rest = uint64(binary.BigEndian.Uint32(rest)), rest[4:]
+	case info == 27 && len(rest) >= 8:
+		arg, rest = binary.BigEndian.Uint64(rest), rest[8:]
+	default:
+		return nil, nil, fmt.Errorf("不支持的 CBOR 头: 0x%02x", data[0])
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("CBOR 整数溢出")
+		}
+		return int64(arg), rest, nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("CBOR 整数溢出")
+		}
+		return -1 - int64(arg), rest, nil
+	case 2, 3:
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("CBOR 数据不完整")
+		}
+		b := rest[:arg]
+		if major == 3 {
+			return string(b), rest[arg:], nil
+		}
+		return append([]byte{}, b...), rest[arg:], nil
+	case 4:
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("CBOR 数组长度无效")
+		}
+		list := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, r, err := cborDecodeDepth(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			list, rest = append(list, v), r
+		}
+		return list, rest, nil
+	case 5:
+		if arg > uint64(len(rest)) {
+			return nil, nil, fmt.Errorf("CBOR 映射长度无效")
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, r, err := cborDecodeDepth(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("不支持的 CBOR 映射键类型")
+			}
+			if _, dup := m[k]; dup {
+				return nil, nil, fmt.Errorf("CBOR 映射键重复: %v", k)
+			}
+			v, r, err := cborDecodeDepth(r, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[k], rest = v, r
+		}
+		return m, rest, nil
+	case 7:
+		switch info {
+		case 20:
+			return false, rest, nil
+		case 21:
+			return true, rest, nil
+		case 22:
+			return nil, rest, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("不支持的 CBOR 类型: major=%d info=%d", major, info)
+}
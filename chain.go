@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func (srv *Server) verifySignatureCall(data *PasskeyData, walletAddr string) (bool, error) {
+	return srv.verifySignatureCallWith(data, walletAddr, nil)
+}
+
+// verifySignatureCallWith 带状态覆盖的 verifySignature，用于预演未部署的钱包
+// 覆盖状态中的公钥来自请求本身，结果不能作为钱包所有权证明
+func (srv *Server) verifySignatureCallWith(data *PasskeyData, walletAddr string, overrides *stateOverrides) (bool, error) {
+	hash := hexToBytes32(data.WebAuthn.MessageHash)
+	r := hexToBytes32(data.Signature.R)
+	s := hexToBytes32(data.Signature.S)
+
+	parsedABI, _ := abi.JSON(strings.NewReader(walletABI))
+	callData, err := parsedABI.Pack("verifySignature", hash, r, s)
+	if err != nil {
+		return false, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+
+	wallet := common.HexToAddress(walletAddr)
+	result, err := srv.callContractWithOverrides(context.Background(), ethereum.CallMsg{
+		To:   &wallet,
+		Data: callData,
+	}, overrides)
+	if err != nil {
+		return false, fmt.Errorf("调用合约失败: %v", err)
+	}
+
+	var valid bool
+	err = parsedABI.UnpackIntoInterface(&valid, "verifySignature", result)
+	if err != nil {
+		return false, fmt.Errorf("解析结果失败: %v", err)
+	}
+
+	return valid, nil
+}
+
+func (srv *Server) sendVerifyTransaction(data *PasskeyData, walletAddr string) (common.Hash, error) {
+	hash := hexToBytes32(data.WebAuthn.MessageHash)
+	r := hexToBytes32(data.Signature.R)
+	s := hexToBytes32(data.Signature.S)
+
+	parsedABI, _ := abi.JSON(strings.NewReader(walletABI))
+	callData, err := parsedABI.Pack("verifySignature", hash, r, s)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+
+	return srv.sendTransaction(common.HexToAddress(walletAddr), big.NewInt(0), callData)
+}
+
+// sendERC20Transfer 发送 ERC20 转账，按钱包登记的类型选择编码与提交方式
+// 4337 账户返回的是 userOpHash；开启聚合时同时返回该请求在批量交易中的位置
+func (srv *Server) sendERC20Transfer(req *ERC20TransferRequest) (common.Hash, *BatchInfo, error) {
+	wallet := common.HexToAddress(req.Wallet)
+	wt := srv.walletTypeFor(wallet)
+	target, callData, err := srv.walletCall(wt, req)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	return srv.sendWalletCall(wallet, wt, target, callData, &req.PasskeyData)
+}
+
+// sendWalletCall 提交已编码的钱包调用: 4337 账户提交签发 challenge 时准备的 UserOperation (签名覆盖其 userOpHash)，
+// 其余预执行后由中继账户发送到 target (开启聚合时并入批量交易)
+func (srv *Server) sendWalletCall(wallet common.Address, wt *WalletTypeConfig, target common.Address, callData []byte, data *PasskeyData) (common.Hash, *BatchInfo, error) {
+	if wt.Encoder == walletEncoderAA {
+		op, err := srv.preparedUserOp(data, true)
+		if err != nil {
+			return common.Hash{}, nil, err
+		}
+		op.Signature = webauthnSignature(data)
+		return srv.sendUserOp(op)
+	}
+
+	if err := srv.dryRun(target, callData); err != nil {
+		return common.Hash{}, nil, err
+	}
+	if srv.batcher.enabled() {
+		return srv.batcher.submitCall(target, callData)
+	}
+
+	// 发送到用户的钱包合约 (safe-module 为模块合约)
+	txHash, err := srv.sendTransaction(target, big.NewInt(0), callData)
+	return txHash, nil, err
+}
+
+// signERC20Transfer 签名钱包转账交易但不广播 (broadcast=false)，绕过聚合与 4337 路径
+func (srv *Server) signERC20Transfer(req *ERC20TransferRequest) (*types.Transaction, error) {
+	wt := srv.walletTypeFor(common.HexToAddress(req.Wallet))
+	if wt.Encoder == walletEncoderAA {
+		return nil, fmt.Errorf("4337 账户不支持 broadcast=false")
+	}
+	target, callData, err := srv.walletCall(wt, req)
+	if err != nil {
+		return nil, err
+	}
+	return srv.signWalletCall(target, callData)
+}
+
+// signWalletCall 预执行后签名钱包调用但不广播
+func (srv *Server) signWalletCall(target common.Address, callData []byte) (*types.Transaction, error) {
+	if err := srv.dryRun(target, callData); err != nil {
+		return nil, err
+	}
+	return srv.relayTransaction(target, big.NewInt(0), callData, false)
+}
+
+// broadcastRequested 请求是否要求广播交易，?broadcast=false 时只返回签名后的原始交易
+func broadcastRequested(r *http.Request) bool {
+	return r.URL.Query().Get("broadcast") != "false"
+}
+
+// asyncRequested ?async=true 时不等待确认，广播后立即返回
+func asyncRequested(r *http.Request) bool {
+	return r.URL.Query().Get("async") == "true"
+}
+
+// rawTxData 已签名交易的 RLP 编码与哈希
+func (srv *Server) rawTxData(signedTx *types.Transaction) RawTxData {
+	raw, _ := signedTx.MarshalBinary()
+	data := RawTxData{
+		RawTransaction: hexutil.Encode(raw),
+		TxHash:         signedTx.Hash().Hex(),
+		Nonce:          signedTx.Nonce(),
+	}
+	if s := srv.signer(); s != nil {
+		data.From = s.Address().Hex()
+	}
+	return data
+}
+
+// erc20TransferCallData 编码钱包转账调用数据
+func (srv *Server) erc20TransferCallData(req *ERC20TransferRequest) ([]byte, error) {
+	// 解析参数
+	token := common.HexToAddress(req.Token)
+	to := common.HexToAddress(req.To)
+	amount, ok := new(big.Int).SetString(req.Amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("金额格式错误")
+	}
+
+	sig := webauthnSignature(&req.PasskeyData)
+
+	cfg := srv.Config()
+	extra := 0
+	if cfg.TraceCalldata {
+		extra = len(traceTagMagic) + traceIDBytes
+	}
+
+	// 调用 PasskeyWallet.transferERC20(token, to, amount, signature)，按预计算模板编码
+	callData, err := encodeTransferERC20(token, to, amount, sig, extra)
+	if req.Memo != "" && cfg.MemoOnChain {
+		// 备注上链: execute(token, 0, transfer(to, amount) ++ memo, signature)
+		// ERC20 会忽略 ABI 参数之后的多余字节，备注可在交易 input 中查到
+		var transferData []byte
+		transferData, err = encodeERC20TransferWithSuffix(to, amount, []byte(req.Memo))
+		if err == nil {
+			callData, err = encodeExecute(token, big.NewInt(0), transferData, sig, extra)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	if cfg.TraceCalldata {
+		callData = appendTraceTag(callData, req.requestID)
+	}
+	return callData, nil
+}
+
+// getERC20Balance 查询 ERC20 余额
+func (srv *Server) getERC20Balance(tokenAddr, userAddr string) (*big.Int, string, uint8, error) {
+	token := common.HexToAddress(tokenAddr)
+	user := common.HexToAddress(userAddr)
+
+	parsedABI, _ := abi.JSON(strings.NewReader(erc20ABI))
+
+	// 余额与 (未缓存的) symbol / decimals 在同一个 batch 请求中查询
+	var (
+		b          rpcBatch
+		balanceOut hexutil.Bytes
+		fetch      *tokenMetadataFetch
+	)
+	balanceData, _ := parsedABI.Pack("balanceOf", user)
+	i := b.call(token, balanceData, &balanceOut)
+	meta, cached := srv.cachedTokenMetadata(token)
+	if !cached {
+		fetch = addTokenMetadataCalls(&b, parsedABI, token)
+	}
+	if err := srv.sendBatch(context.Background(), &b); err != nil {
+		return nil, "", 0, err
+	}
+	if err := b.err(i); err != nil {
+		return nil, "", 0, err
+	}
+
+	var balance *big.Int
+	parsedABI.UnpackIntoInterface(&balance, "balanceOf", balanceOut)
+
+	if fetch != nil {
+		meta = srv.storeTokenMetadata(&b, parsedABI, token, fetch)
+	}
+	return balance, meta.Symbol, meta.Decimals, nil
+}
+
+// tokenMetadataFetch batch 中 symbol / decimals 请求的序号与结果
+type tokenMetadataFetch struct {
+	symbolIdx, decimalsIdx int
+	symbol, decimals       hexutil.Bytes
+}
+
+// addTokenMetadataCalls 把 symbol / decimals 调用加入 batch
+func addTokenMetadataCalls(b *rpcBatch, parsedABI abi.ABI, token common.Address) *tokenMetadataFetch {
+	f := &tokenMetadataFetch{}
+	symbolData, _ := parsedABI.Pack("symbol")
+	decimalsData, _ := parsedABI.Pack("decimals")
+	f.symbolIdx = b.call(token, symbolData, &f.symbol)
+	f.decimalsIdx = b.call(token, decimalsData, &f.decimals)
+	return f
+}
+
+// storeTokenMetadata 解析 batch 结果，两项都成功时缓存
+func (srv *Server) storeTokenMetadata(b *rpcBatch, parsedABI abi.ABI, token common.Address, f *tokenMetadataFetch) tokenMetadata {
+	var meta tokenMetadata
+	parsedABI.UnpackIntoInterface(&meta.Symbol, "symbol", f.symbol)
+	parsedABI.UnpackIntoInterface(&meta.Decimals, "decimals", f.decimals)
+	if b.err(f.symbolIdx) == nil && b.err(f.decimalsIdx) == nil {
+		srv.setTokenMetadata(token, meta)
+	}
+	return meta
+}
+
+// cachedTokenMetadata 先查进程内缓存，再查共享缓存 (其它实例查询过的代币)
+func (srv *Server) cachedTokenMetadata(token common.Address) (tokenMetadata, bool) {
+	if v, ok := srv.tokenMeta.Load(token); ok {
+		return v.(tokenMetadata), true
+	}
+	var meta tokenMetadata
+	if ok, err := getCacheJSON(srv.shared, nsTokenMeta, token.Hex(), &meta); err == nil && ok {
+		srv.tokenMeta.Store(token, meta)
+		return meta, true
+	}
+	return tokenMetadata{}, false
+}
+
+// setTokenMetadata 写入进程内缓存与共享缓存
+func (srv *Server) setTokenMetadata(token common.Address, meta tokenMetadata) {
+	srv.tokenMeta.Store(token, meta)
+	setCacheJSON(srv.shared, nsTokenMeta, token.Hex(), meta, tokenMetaTTL)
+}
+
+// getTokenMetadata 查询代币 symbol/decimals (一次 batch 请求)，结果按地址缓存
+func (srv *Server) getTokenMetadata(parsedABI abi.ABI, token common.Address) tokenMetadata {
+	if meta, ok := srv.cachedTokenMetadata(token); ok {
+		return meta
+	}
+
+	var b rpcBatch
+	f := addTokenMetadataCalls(&b, parsedABI, token)
+	if err := srv.sendBatch(context.Background(), &b); err != nil {
+		return tokenMetadata{}
+	}
+	return srv.storeTokenMetadata(&b, parsedABI, token, f)
+}
+
+// sendTransaction 中继发送交易，账户由中继池选择，nonce 由该账户的 nonceManager 分配
+func (srv *Server) sendTransaction(to common.Address, value *big.Int, data []byte) (common.Hash, error) {
+	signedTx, err := srv.relayTransaction(to, value, data, true)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return signedTx.Hash(), nil
+}
+
+// relayTransaction 中继账户签名交易，broadcast 为 false 时只签名不广播，且不占用 nonce
+// (只签名的交易总是使用主中继账户，调用方按其 nonce 顺序提交)
+func (srv *Server) relayTransaction(to common.Address, value *big.Int, data []byte, broadcast bool) (*types.Transaction, error) {
+	if !broadcast {
+		nonce, err := srv.relayerNonce()
+		if err != nil {
+			return nil, err
+		}
+		return srv.relayTransactionAt(nonce, to, value, data, false)
+	}
+	r, err := srv.relayers.pick()
+	if err != nil {
+		return nil, err
+	}
+	defer srv.relayers.release(r)
+	nonce, err := r.nonces.reserve()
+	if err != nil {
+		return nil, err
+	}
+	signedTx, err := srv.relayTransactionWith(r.signer(), nonce, to, value, data, true)
+	r.nonces.complete(nonce, err)
+	return signedTx, err
+}
+
+// relayerNonce 中继账户的下一个 nonce (不占用)，只签名不广播的交易使用
+func (srv *Server) relayerNonce() (uint64, error) {
+	return srv.nonces.peek()
+}
+
+// relayTransactionAt 主中继账户用指定 nonce 签名交易，broadcast 为 false 时只签名不广播
+// (接口的 broadcast=false 选项，由调用方自行提交)
+func (srv *Server) relayTransactionAt(nonce uint64, to common.Address, value *big.Int, data []byte, broadcast bool) (*types.Transaction, error) {
+	return srv.relayTransactionWith(srv.signer(), nonce, to, value, data, broadcast)
+}
+
+// relayTransactionWith 用指定中继账户与 nonce 签名交易，广播后登记提价重发
+func (srv *Server) relayTransactionWith(signer Signer, nonce uint64, to common.Address, value *big.Int, data []byte, broadcast bool) (*types.Transaction, error) {
+	if signer == nil {
+		return nil, fmt.Errorf("未配置私钥")
+	}
+	signedTx, err := srv.signTransaction(signer, nonce, to, value, data)
+	if err != nil || !broadcast {
+		return signedTx, err
+	}
+	// 先写交易日志再广播，进程在广播前后退出都能在重启后恢复
+	srv.submissions.track(signer.Address(), signedTx)
+	if err := srv.broadcast(signedTx); err != nil {
+		srv.submissions.forget(signedTx.Hash())
+		return signedTx, err
+	}
+	return signedTx, nil
+}
+
+// signAndSend 用指定账户签名并广播交易 (treasury 充值使用，不经过提价重发)
+func (srv *Server) signAndSend(signer Signer, nonce uint64, to common.Address, value *big.Int, data []byte) (common.Hash, error) {
+	signedTx, err := srv.signTransaction(signer, nonce, to, value, data)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := srv.broadcast(signedTx); err != nil {
+		return common.Hash{}, err
+	}
+	return signedTx.Hash(), nil
+}
+
+// signTransaction 估算 gas 并签名交易，不广播
+func (srv *Server) signTransaction(signer Signer, nonce uint64, to common.Address, value *big.Int, data []byte) (*types.Transaction, error) {
+	fromAddress := signer.Address()
+
+	gasPrice, err := srv.gasPrice(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	msg := ethereum.CallMsg{
+		From:  fromAddress,
+		To:    &to,
+		Value: value,
+		Data:  data,
+	}
+	gasLimit, err := srv.eth().EstimateGas(context.Background(), msg)
+	var accessList types.AccessList
+	estimated := err == nil
+	if !estimated {
+		gasLimit = srv.fallbackGasLimit() // ERC20 转账可能需要更多 gas
+	} else {
+		accessList, gasLimit = srv.withAccessList(context.Background(), msg, gasLimit)
+	}
+
+	tx := srv.newRelayTx(nonce, to, value, gasLimit, gasPrice, data, accessList)
+	l1 := srv.l1CostOrZero(context.Background(), tx)
+	if !estimated && l1.InGasLimit && l1.Gas > 0 {
+		// Arbitrum 的 L1 成本按 gas 计，兜底值需要加上
+		gasLimit += l1.Gas
+		tx = srv.newRelayTx(nonce, to, value, gasLimit, gasPrice, data, accessList)
+	}
+	if err := srv.checkFeeCaps(gasPrice, gasLimit, l1.extraFee(), nil); err != nil {
+		return nil, err
+	}
+	signedTx, err := signer.SignTx(tx, srv.chainID)
+	if err != nil {
+		return nil, fmt.Errorf("签名交易失败: %v", err)
+	}
+	return signedTx, nil
+}
+
+// broadcast 广播已签名的交易
+func (srv *Server) broadcast(signedTx *types.Transaction) error {
+	if err := srv.eth().SendTransaction(context.Background(), signedTx); err != nil {
+		srv.rpc.reportError(err)
+		return fmt.Errorf("发送交易失败: %v", err)
+	}
+	return nil
+}
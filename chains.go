@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ChainConfig 同一服务实例额外中继的链，未列出的配置项沿用顶层配置
+//
+//	chains:
+//	  - name: "base-sepolia"
+//	    chain_id: 84532
+//	    rpc: "https://sepolia.base.org"
+//	    rpc_fallbacks: ["https://base-sepolia-rpc.publicnode.com"]
+//	    contract: "0x工厂地址"
+//	    private_key: ""   # 留空沿用主中继账户 (同一 EOA 在各链上地址相同)
+type ChainConfig struct {
+	Name         string   `yaml:"name"`
+	ChainID      int64    `yaml:"chain_id"`
+	RPC          string   `yaml:"rpc"`
+	RPCFallbacks []string `yaml:"rpc_fallbacks"`
+	Contract     string   `yaml:"contract"`
+	PrivateKey   string   `yaml:"private_key"`
+}
+
+// chainIDHeader 请求头中指定目标链 (与 chainId 参数等价)
+const chainIDHeader = "X-Chain-ID"
+
+// ChainInfo GET /api/chains 返回的单条链信息
+type ChainInfo struct {
+	ChainID  int64  `json:"chainId"`
+	Name     string `json:"name"`
+	Contract string `json:"contract"`
+	Relayer  string `json:"relayer,omitempty"`
+	Default  bool   `json:"default"`
+}
+
+// chainRegistry 按 chainId 管理各链的服务实例
+//
+// 每条链是一个独立的 Server (RPC、中继账户、nonce、队列各自独立)，请求按 chainId 路由；
+// 未指定 chainId 的请求交给默认链 (顶层配置)，与单链部署的行为一致。
+type chainRegistry struct {
+	def      int64
+	chains   map[int64]*Server
+	names    map[int64]string
+	handlers map[int64]http.Handler
+}
+
+func newChainRegistry(def *Server) *chainRegistry {
+	reg := &chainRegistry{
+		chains:   make(map[int64]*Server),
+		names:    make(map[int64]string),
+		handlers: make(map[int64]http.Handler),
+	}
+	reg.def = def.chainID.Int64()
+	reg.add(def, "")
+	return reg
+}
+
+// add 注册一条链，chainId 重复时返回错误
+func (reg *chainRegistry) add(srv *Server, name string) error {
+	id := srv.chainID.Int64()
+	if _, ok := reg.chains[id]; ok {
+		return fmt.Errorf("链 %d 重复配置", id)
+	}
+	reg.chains[id] = srv
+	reg.names[id] = name
+	reg.handlers[id] = srv.routes()
+	return nil
+}
+
+// get 返回指定链的服务实例
+func (reg *chainRegistry) get(chainID int64) (*Server, bool) {
+	srv, ok := reg.chains[chainID]
+	return srv, ok
+}
+
+// ids 按 chainId 升序返回已注册的链
+func (reg *chainRegistry) ids() []int64 {
+	ids := make([]int64, 0, len(reg.chains))
+	for id := range reg.chains {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// requestChainID 读取请求指定的链: ?chainId=、X-Chain-ID 请求头或 JSON 请求体中的 chainId
+//
+// 读取请求体后会原样放回，后续 handler 不受影响。未指定时返回 0。
+func requestChainID(r *http.Request) (int64, error) {
+	raw := r.URL.Query().Get("chainId")
+	if raw == "" {
+		raw = r.Header.Get(chainIDHeader)
+	}
+	if raw == "" && r.Method == "POST" && r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return 0, fmt.Errorf("读取请求失败")
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var probe struct {
+			ChainID json.RawMessage `json:"chainId"`
+		}
+		if json.Unmarshal(body, &probe) == nil && len(probe.ChainID) > 0 {
+			raw = strings.Trim(string(probe.ChainID), `"`)
+		}
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("chainId 格式错误: %s", raw)
+	}
+	return id, nil
+}
+
+// Handler 按 chainId 把请求转给对应链的路由
+//
+// 请求 ID 与 panic 恢复在分发之前统一处理；/api/chains 与选链失败的错误经默认链的请求日志与响应头中间件返回。
+func (reg *chainRegistry) Handler() http.Handler {
+	def := reg.chains[reg.def]
+	rt := newRouter()
+	rt.get("/api/chains", reg.handleChains)
+	local := def.payloadLogger(apiHeaders(rt.mux))
+	fail := func(w http.ResponseWriter, r *http.Request, msg string) {
+		def.payloadLogger(apiHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sendError(w, msg)
+		}))).ServeHTTP(w, r)
+	}
+
+	return def.requestIDs(recovered(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/chains" {
+			local.ServeHTTP(w, r)
+			return
+		}
+		id, err := requestChainID(r)
+		if err != nil {
+			fail(w, r, err.Error())
+			return
+		}
+		if id == 0 {
+			id = reg.def
+		}
+		h, ok := reg.handlers[id]
+		// /api/tokens 的 chainId 只用于过滤列表，未接入的链同样可以查询
+		if !ok && r.URL.Path == "/api/tokens" {
+			h, ok = reg.handlers[reg.def], true
+		}
+		if !ok {
+			fail(w, r, fmt.Sprintf("不支持的链: %d", id))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})))
+}
+
+// handleChains 列出本实例接入的链
+func (reg *chainRegistry) handleChains(w http.ResponseWriter, r *http.Request) {
+	chains := make([]ChainInfo, 0, len(reg.chains))
+	for _, id := range reg.ids() {
+		srv := reg.chains[id]
+		info := ChainInfo{
+			ChainID:  id,
+			Name:     reg.names[id],
+			Contract: srv.Config().Contract,
+			Default:  id == reg.def,
+		}
+		if s := srv.signer(); s != nil {
+			info.Relayer = s.Address().Hex()
+		}
+		chains = append(chains, info)
+	}
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Data: chains})
+}
+
+// Start 启动各链的后台任务，并在配置的端口上提供全部链的接口
+func (reg *chainRegistry) Start() error {
+	// SIGHUP 显式清空缓存
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			for _, srv := range reg.chains {
+				srv.invalidateCaches()
+			}
+			log.Println("已清空响应缓存")
+		}
+	}()
+
+	for _, id := range reg.ids() {
+		reg.chains[id].startWorkers()
+	}
+
+	addr := fmt.Sprintf(":%d", reg.chains[reg.def].Config().Port)
+	fmt.Printf("\n服务器启动: http://localhost%s\n", addr)
+	fmt.Println("打开浏览器访问上述地址，使用指纹/Face ID 进行签名测试")
+
+	return http.ListenAndServe(addr, reg.Handler())
+}
+
+// chainServerConfig 由顶层配置派生某条链的配置
+//
+// 链单独配置了中继私钥时只使用该账户，不沿用顶层的 keystore / signer / relayer_pool。
+// chains 列表保留 (用于 /api/config 的 multiChain)，但去掉各链的私钥。
+func chainServerConfig(base *Config, chain ChainConfig) *Config {
+	cfg := *base
+	cfg.Chains = make([]ChainConfig, len(base.Chains))
+	for i, c := range base.Chains {
+		c.PrivateKey = ""
+		cfg.Chains[i] = c
+	}
+	cfg.RPC = chain.RPC
+	cfg.RPCFallbacks = chain.RPCFallbacks
+	cfg.ChainID = chain.ChainID
+	if chain.Contract != "" {
+		cfg.Contract = chain.Contract
+	}
+	if chain.PrivateKey != "" {
+		cfg.PrivateKey = chain.PrivateKey
+		cfg.Keystore = ""
+		cfg.Signer = SignerConfig{}
+		cfg.RelayerPool = RelayerPoolConfig{}
+	}
+	return &cfg
+}
+
+// openChain 连接 chains 中的一条链并创建其服务实例
+//
+// 存储、缓存与默认链共用一个后端，命名空间按 chainId 隔离。
+func openChain(base *Config, chain ChainConfig, signer Signer, st Storage, c Cache) (*Server, error) {
+	if chain.RPC == "" || chain.ChainID <= 0 {
+		return nil, fmt.Errorf("chains: %q 缺少 rpc 或 chain_id", chain.Name)
+	}
+	cfg := chainServerConfig(base, chain)
+	if chain.PrivateKey != "" {
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(chain.PrivateKey, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("chains: %q 私钥格式错误: %v", chain.Name, err)
+		}
+		signer = newKeySigner(key)
+	}
+
+	conn, err := dialRPC(base.RPCClient, chain.RPC, chain.RPCFallbacks...)
+	if err != nil {
+		return nil, fmt.Errorf("chains: 连接 %q 失败: %v", chain.Name, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	chainID, err := conn.get().NetworkID(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("chains: 获取 %q 的链 ID 失败: %v", chain.Name, err)
+	}
+	if chainID.Cmp(big.NewInt(chain.ChainID)) != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("chains: %q 配置的 chain_id 为 %d，节点返回 %s", chain.Name, chain.ChainID, chainID)
+	}
+
+	srv := NewServer(cfg, conn, chainID, signer, newChainStorage(st, chainID.Int64()), newChainCache(c, chainID.Int64()))
+	srv.DetectP256()
+	return srv, nil
+}
+
+// chainStorage 给命名空间加上 chainId 前缀，多条链共用一个存储后端
+type chainStorage struct {
+	Storage
+	prefix string
+}
+
+func newChainStorage(st Storage, chainID int64) Storage {
+	return chainStorage{Storage: st, prefix: fmt.Sprintf("chain/%d/", chainID)}
+}
+
+func (s chainStorage) Get(ns, key string) ([]byte, bool, error) {
+	return s.Storage.Get(s.prefix+ns, key)
+}
+
+func (s chainStorage) Put(ns, key string, value []byte, ttl time.Duration) error {
+	return s.Storage.Put(s.prefix+ns, key, value, ttl)
+}
+
+func (s chainStorage) Delete(ns, key string) (bool, error) {
+	return s.Storage.Delete(s.prefix+ns, key)
+}
+
+func (s chainStorage) List(ns, prefix string) ([]KV, error) {
+	return s.Storage.List(s.prefix+ns, prefix)
+}
+
+// Close 共用的后端由默认链关闭
+func (s chainStorage) Close() error { return nil }
@@ -0,0 +1,225 @@
+// Package chaintest 基于 go-ethereum simulated backend 的集成测试夹具
+//
+// 夹具 (钱包已部署、代币已铸造等) 只构建一次并记录快照，之后每个用例
+// 从快照恢复链状态，避免重复部署合约。
+//
+//	chain := chaintest.New()
+//	defer chain.Close()
+//	err := chain.Fixture("wallet-deployed", func(c *chaintest.Chain) error {
+//		wallet, err = c.Deploy(walletABI, walletBytecode, x, y)
+//		return err
+//	})
+//
+// 本包不附带合约编译产物，bytecode 由调用方提供 (见 contract/ 目录)。
+package chaintest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// simulated backend 固定使用 chainID 1337
+var ChainID = big.NewInt(1337)
+
+// 中继账户初始余额
+var defaultBalance = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))
+
+// Snapshot 链状态快照 (记录时的区块哈希)
+type Snapshot common.Hash
+
+// Chain 模拟链与快照管理
+type Chain struct {
+	Backend *simulated.Backend
+	Client  simulated.Client
+	Relayer *ecdsa.PrivateKey // 预置余额的部署/中继账户
+
+	mu       sync.Mutex
+	fixtures map[string]Snapshot
+}
+
+// New 创建模拟链，extra 中的地址会获得与中继账户相同的初始余额
+func New(extra ...common.Address) *Chain {
+	alloc := types.GenesisAlloc{}
+	for _, addr := range extra {
+		alloc[addr] = types.Account{Balance: defaultBalance}
+	}
+	return newChain(alloc)
+}
+
+// NewWithRPC 创建模拟链并在本地随机端口开放 HTTP JSON-RPC，返回节点地址
+// alloc 合并进创世状态，可用于预置合约代码；供需要真实 RPC 连接的调用方使用 (如压测)
+func NewWithRPC(alloc types.GenesisAlloc) (*Chain, string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", fmt.Errorf("分配 RPC 端口失败: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	c := newChain(alloc, func(nodeConf *node.Config, _ *ethconfig.Config) {
+		nodeConf.HTTPHost = "127.0.0.1"
+		nodeConf.HTTPPort = port
+		nodeConf.HTTPModules = []string{"eth", "net", "web3"}
+	})
+	return c, fmt.Sprintf("http://127.0.0.1:%d", port), nil
+}
+
+// newChain 在 alloc 基础上为新生成的中继账户预置余额并启动模拟链
+func newChain(alloc types.GenesisAlloc, options ...func(*node.Config, *ethconfig.Config)) *Chain {
+	relayer, _ := crypto.GenerateKey()
+	genesis := types.GenesisAlloc{
+		crypto.PubkeyToAddress(relayer.PublicKey): {Balance: defaultBalance},
+	}
+	for addr, account := range alloc {
+		genesis[addr] = account
+	}
+
+	backend := simulated.NewBackend(genesis, options...)
+	return &Chain{
+		Backend:  backend,
+		Client:   backend.Client(),
+		Relayer:  relayer,
+		fixtures: make(map[string]Snapshot),
+	}
+}
+
+// Close 关闭模拟链
+func (c *Chain) Close() error {
+	return c.Backend.Close()
+}
+
+// RelayerAddress 中继账户地址
+func (c *Chain) RelayerAddress() common.Address {
+	return crypto.PubkeyToAddress(c.Relayer.PublicKey)
+}
+
+// Snapshot 提交未打包的交易并记录当前链头
+func (c *Chain) Snapshot() Snapshot {
+	return Snapshot(c.Backend.Commit())
+}
+
+// Restore 丢弃未打包的交易，并把规范链回退到快照所在区块
+func (c *Chain) Restore(snap Snapshot) error {
+	c.Backend.Rollback()
+	if err := c.Backend.Fork(common.Hash(snap)); err != nil {
+		return fmt.Errorf("恢复快照失败: %v", err)
+	}
+	// 回退后交易池会把被丢弃区块中的交易重新放回，再清空一次
+	c.Backend.Rollback()
+	return nil
+}
+
+// Fixture 首次调用时执行 setup 并记录快照，之后直接恢复到该快照
+func (c *Chain) Fixture(name string, setup func(*Chain) error) error {
+	c.mu.Lock()
+	snap, ok := c.fixtures[name]
+	c.mu.Unlock()
+	if ok {
+		return c.Restore(snap)
+	}
+
+	if err := setup(c); err != nil {
+		return fmt.Errorf("构建夹具 %s 失败: %v", name, err)
+	}
+	snap = c.Snapshot()
+
+	c.mu.Lock()
+	c.fixtures[name] = snap
+	c.mu.Unlock()
+	return nil
+}
+
+// Deploy 部署合约并打包，返回合约地址
+func (c *Chain) Deploy(abiJSON string, bytecode []byte, args ...interface{}) (common.Address, error) {
+	parsedABI, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return common.Address{}, fmt.Errorf("解析 ABI 失败: %v", err)
+	}
+	ctorArgs, err := parsedABI.Pack("", args...)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("编码构造参数失败: %v", err)
+	}
+
+	receipt, err := c.send(nil, nil, append(append([]byte{}, bytecode...), ctorArgs...))
+	if err != nil {
+		return common.Address{}, err
+	}
+	return receipt.ContractAddress, nil
+}
+
+// Transact 由中继账户调用合约方法并打包
+func (c *Chain) Transact(to common.Address, abiJSON, method string, args ...interface{}) (*types.Receipt, error) {
+	parsedABI, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		return nil, fmt.Errorf("解析 ABI 失败: %v", err)
+	}
+	data, err := parsedABI.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	return c.send(&to, nil, data)
+}
+
+// Fund 由中继账户向 to 转 ETH 并打包
+func (c *Chain) Fund(to common.Address, value *big.Int) error {
+	_, err := c.send(&to, value, nil)
+	return err
+}
+
+// send 签名、发送交易并立即打包，交易失败时返回错误
+func (c *Chain) send(to *common.Address, value *big.Int, data []byte) (*types.Receipt, error) {
+	ctx := context.Background()
+	from := c.RelayerAddress()
+	if value == nil {
+		value = big.NewInt(0)
+	}
+
+	nonce, err := c.Client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("获取 nonce 失败: %v", err)
+	}
+	gasPrice, err := c.Client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取 gas price 失败: %v", err)
+	}
+
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		To:       to,
+		Value:    value,
+		Gas:      5_000_000,
+		GasPrice: gasPrice,
+		Data:     data,
+	})
+	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(ChainID), c.Relayer)
+	if err != nil {
+		return nil, fmt.Errorf("签名交易失败: %v", err)
+	}
+	if err := c.Client.SendTransaction(ctx, signedTx); err != nil {
+		return nil, fmt.Errorf("发送交易失败: %v", err)
+	}
+	c.Backend.Commit()
+
+	receipt, err := c.Client.TransactionReceipt(ctx, signedTx.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("获取回执失败: %v", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, fmt.Errorf("交易执行失败: %s", signedTx.Hash().Hex())
+	}
+	return receipt, nil
+}
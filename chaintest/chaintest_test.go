@@ -0,0 +1,137 @@
+package chaintest
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// 最小存储合约: 任何调用都把 calldata[4:36] 写入 slot 0
+//
+//	init:    PUSH1 7 PUSH1 12 PUSH1 0 CODECOPY PUSH1 7 PUSH1 0 RETURN
+//	runtime: PUSH1 4 CALLDATALOAD PUSH1 0 SSTORE STOP
+var (
+	storeBytecode = hexutil.MustDecode("0x6007600c60003960076000f3" + "60043560005500")
+	storeABI      = `[{"type":"function","name":"set","inputs":[{"name":"v","type":"uint256"}],"outputs":[],"stateMutability":"nonpayable"}]`
+)
+
+func slot0(t *testing.T, c *Chain, addr common.Address) *big.Int {
+	t.Helper()
+	raw, err := c.Client.StorageAt(context.Background(), addr, common.Hash{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return new(big.Int).SetBytes(raw)
+}
+
+func balance(t *testing.T, c *Chain, addr common.Address) *big.Int {
+	t.Helper()
+	b, err := c.Client.BalanceAt(context.Background(), addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	c := New()
+	defer c.Close()
+	ctx := context.Background()
+
+	store, err := c.Deploy(storeABI, storeBytecode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Transact(store, storeABI, "set", big.NewInt(7)); err != nil {
+		t.Fatal(err)
+	}
+	snap := c.Snapshot()
+	head, err := c.Client.BlockNumber(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := c.Client.NonceAt(ctx, c.RelayerAddress(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 快照之后修改存储、转账
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	if _, err := c.Transact(store, storeABI, "set", big.NewInt(42)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Fund(recipient, big.NewInt(1e18)); err != nil {
+		t.Fatal(err)
+	}
+	if got := slot0(t, c, store); got.Int64() != 42 {
+		t.Fatalf("修改后 slot 0 = %s, 期望 42", got)
+	}
+	if got := balance(t, c, recipient); got.Sign() == 0 {
+		t.Fatal("转账后余额仍为 0")
+	}
+
+	if err := c.Restore(snap); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := slot0(t, c, store); got.Int64() != 7 {
+		t.Fatalf("恢复后 slot 0 = %s, 期望 7", got)
+	}
+	if got := balance(t, c, recipient); got.Sign() != 0 {
+		t.Fatalf("恢复后余额 = %s, 期望 0", got)
+	}
+	if got, err := c.Client.BlockNumber(ctx); err != nil || got != head {
+		t.Fatalf("恢复后区块高度 = %d (%v), 期望 %d", got, err, head)
+	}
+	if got, err := c.Client.NonceAt(ctx, c.RelayerAddress(), nil); err != nil || got != nonce {
+		t.Fatalf("恢复后 nonce = %d (%v), 期望 %d", got, err, nonce)
+	}
+	// 被丢弃区块中的交易不应留在交易池里
+	if got, err := c.Client.PendingNonceAt(ctx, c.RelayerAddress()); err != nil || got != nonce {
+		t.Fatalf("恢复后 pending nonce = %d (%v), 期望 %d", got, err, nonce)
+	}
+
+	// 恢复后链可以继续出块
+	if _, err := c.Transact(store, storeABI, "set", big.NewInt(9)); err != nil {
+		t.Fatal(err)
+	}
+	if got := slot0(t, c, store); got.Int64() != 9 {
+		t.Fatalf("恢复后再次写入 slot 0 = %s, 期望 9", got)
+	}
+}
+
+func TestFixtureRunsSetupOnce(t *testing.T) {
+	c := New()
+	defer c.Close()
+
+	var store common.Address
+	runs := 0
+	setup := func(c *Chain) error {
+		runs++
+		var err error
+		if store, err = c.Deploy(storeABI, storeBytecode); err != nil {
+			return err
+		}
+		_, err = c.Transact(store, storeABI, "set", big.NewInt(1))
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := c.Fixture("store", setup); err != nil {
+			t.Fatal(err)
+		}
+		if got := slot0(t, c, store); got.Int64() != 1 {
+			t.Fatalf("第 %d 次加载夹具 slot 0 = %s, 期望 1", i+1, got)
+		}
+		// 用例修改的状态不应影响下一次加载
+		if _, err := c.Transact(store, storeABI, "set", big.NewInt(int64(100+i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runs != 1 {
+		t.Fatalf("setup 执行了 %d 次, 期望 1", runs)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// assertionTTL 签名 challenge 有效期
+const assertionTTL = 2 * time.Minute
+
+// 需要 challenge 的操作
+const (
+	opTransfer       = "transfer" // ERC20 转账 (/api/transfer)
+	opSession        = "session"
+	opAddKey         = "add-key"         // 为钱包添加新设备公钥
+	opRevokeKey      = "revoke-key"      // 撤销钱包的一个凭证
+	opFreeze         = "freeze"          // 紧急冻结钱包
+	opUnfreeze       = "unfreeze"        // 解除冻结
+	opExecute        = "execute"         // 通用合约调用
+	opApprove        = "approve"         // ERC20 授权 (approve / increaseAllowance)
+	opTransferETH    = "transfer-eth"    // ETH 转账
+	opTransferMulti  = "transfer-multi"  // 批量转账
+	opTransfer1155   = "transfer-1155"   // ERC-1155 转账
+	opGuardians      = "guardians"       // 设置社交恢复守护人
+	opCancelRecovery = "cancel-recovery" // 取消进行中的恢复
+	opSchedule       = "schedule"        // 创建定时转账 (登记会话密钥)
+)
+
+// userOpOperations 经 sendWalletCall 中继的操作: 4337 账户封装为 UserOperation 提交，challenge 为 userOpHash
+var userOpOperations = map[string]bool{
+	opTransfer:      true,
+	opTransferETH:   true,
+	opTransferMulti: true,
+	opTransfer1155:  true,
+	opApprove:       true,
+	opExecute:       true,
+}
+
+// challengeCalls 按待提交的请求 (不含签名) 编码各操作的钱包调用，challenge 即该调用的摘要 (见 walletCallDigest)
+//
+// 返回的调用数据为 nil 表示该请求没有链上调用 (如作废待添加的凭证)；不在表中的操作 (session) 同样使用随机 challenge。
+var challengeCalls = map[string]func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error){
+	opTransfer: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		var req ERC20TransferRequest
+		if err := decodeChallengeRequest(body, &req); err != nil {
+			return common.Address{}, nil, err
+		}
+		req.Wallet = wallet.Hex()
+		return srv.walletCall(srv.walletTypeFor(wallet), &req)
+	},
+	opTransferETH: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		var req ETHTransferRequest
+		if err := decodeChallengeRequest(body, &req); err != nil {
+			return common.Address{}, nil, err
+		}
+		req.Wallet = wallet.Hex()
+		return srv.walletETHCall(srv.walletTypeFor(wallet), &req)
+	},
+	opTransferMulti: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		var req MultiTransferRequest
+		if err := decodeChallengeRequest(body, &req); err != nil {
+			return common.Address{}, nil, err
+		}
+		req.Wallet = wallet.Hex()
+		return srv.walletMultiTransferCall(srv.walletTypeFor(wallet), &req)
+	},
+	opTransfer1155: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		var req ERC1155TransferRequest
+		if err := decodeChallengeRequest(body, &req); err != nil {
+			return common.Address{}, nil, err
+		}
+		req.Wallet = wallet.Hex()
+		t, err := req.parse()
+		if err != nil {
+			return common.Address{}, nil, err
+		}
+		return srv.walletERC1155Call(srv.walletTypeFor(wallet), &req, t)
+	},
+	opApprove: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		var req ApproveRequest
+		if err := decodeChallengeRequest(body, &req); err != nil {
+			return common.Address{}, nil, err
+		}
+		req.Wallet = wallet.Hex()
+		amount, err := req.amount()
+		if err != nil {
+			return common.Address{}, nil, err
+		}
+		return srv.walletApproveCall(srv.walletTypeFor(wallet), &req, amount)
+	},
+	opExecute: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		var c ExecuteCall
+		if err := decodeChallengeRequest(body, &c); err != nil {
+			return common.Address{}, nil, err
+		}
+		call, err := c.parse(srv.Config().Execute)
+		if err != nil {
+			return common.Address{}, nil, err
+		}
+		return srv.walletExecuteCall(srv.walletTypeFor(wallet), wallet, call.to, call.value, call.data, &PasskeyData{}, "")
+	},
+	opFreeze: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		callData, err := walletFreezeCall("freeze", &PasskeyData{})
+		return wallet, callData, err
+	},
+	opUnfreeze: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		callData, err := walletFreezeCall("unfreeze", &PasskeyData{})
+		return wallet, callData, err
+	},
+	opAddKey: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		var req AddCredentialRequest
+		if err := decodeChallengeRequest(body, &req); err != nil {
+			return common.Address{}, nil, err
+		}
+		_, callData, err := srv.credentialKeyCall(wallet, req.CredentialID, true, &PasskeyData{})
+		return wallet, callData, err
+	},
+	opRevokeKey: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		var req AddCredentialRequest
+		if err := decodeChallengeRequest(body, &req); err != nil {
+			return common.Address{}, nil, err
+		}
+		_, callData, err := srv.credentialKeyCall(wallet, req.CredentialID, false, &PasskeyData{})
+		return wallet, callData, err
+	},
+	opGuardians: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		var req GuardiansRequest
+		if err := decodeChallengeRequest(body, &req); err != nil {
+			return common.Address{}, nil, err
+		}
+		callData, err := req.call()
+		return wallet, callData, err
+	},
+	opCancelRecovery: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		callData, err := recoveryCall("cancelRecovery", webauthnSignature(&PasskeyData{}))
+		return wallet, callData, err
+	},
+	opSchedule: func(srv *Server, wallet common.Address, body []byte) (common.Address, []byte, error) {
+		var req ScheduleRequest
+		if err := decodeChallengeRequest(body, &req); err != nil {
+			return common.Address{}, nil, err
+		}
+		callData, err := req.call()
+		return wallet, callData, err
+	},
+}
+
+// decodeChallengeRequest 解析 /api/challenge 携带的待提交请求
+func decodeChallengeRequest(body []byte, v interface{}) error {
+	if len(body) == 0 {
+		return fmt.Errorf("需要 request: 签名后将要提交的请求 (不含签名)")
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("request 解析失败: %v", err)
+	}
+	return nil
+}
+
+// assertionChallenge 签名 challenge 记录 (nsChallenges，key = assert/<challenge>)
+type assertionChallenge struct {
+	Wallet    string `json:"wallet"`
+	Operation string `json:"operation"`
+}
+
+// ChallengeRequest /api/challenge 请求
+type ChallengeRequest struct {
+	Wallet    string          `json:"wallet"`
+	Operation string          `json:"operation"`         // transfer (默认) / transfer-eth / transfer-multi / transfer-1155 / approve / execute / add-key / revoke-key / freeze / unfreeze / guardians / cancel-recovery / schedule / session
+	Request   json.RawMessage `json:"request,omitempty"` // 签名后将要提交的请求 (不含签名)，challenge 即据此编码的钱包调用的摘要
+	Call      *ExecuteCall    `json:"call,omitempty"`    // execute 也可以只传调用 {to, value, data}
+}
+
+// ChallengeData /api/challenge 返回数据
+type ChallengeData struct {
+	Challenge  string `json:"challenge"` // base64url，直接作为 navigator.credentials.get 的 challenge
+	RPID       string `json:"rpId"`
+	ExpiresAt  int64  `json:"expiresAt"`
+	Nonce      string `json:"nonce,omitempty"`      // challenge 为调用摘要时，摘要使用的钱包 nonce (4337 账户为 EntryPoint nonce)
+	SessionKey string `json:"sessionKey,omitempty"` // schedule: 为任务生成的会话密钥地址，创建任务时随请求提交
+}
+
+// takeChallenge 原子地读取并删除 challenge，保证只能使用一次 (多实例共享缓存时同样成立)
+func (srv *Server) takeChallenge(key string, v interface{}) bool {
+	data, ok, err := srv.shared.Take(nsChallenges, key)
+	if err != nil || !ok {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// checkAssertion 校验 authenticatorData (rpIdHash、UP/UV) 与 clientDataJSON 携带了有效的服务端 challenge，
+// 且与钱包、操作匹配。同时要求 messageHash = sha256(authenticatorData || sha256(clientDataJSON))，
+// 防止提交与签名内容不一致的 clientDataJSON。
+func (srv *Server) checkAssertion(r *http.Request, data *PasskeyData, wallet common.Address, operation string) error {
+	cd, clientDataRaw, err := parseClientData(data.WebAuthn.ClientDataJSON, "webauthn.get")
+	if err != nil {
+		return err
+	}
+
+	authData := common.FromHex(data.WebAuthn.AuthenticatorData)
+	if _, err := checkAuthenticatorData(authData, srv.rpID(r), srv.Config().WebAuthn.RequireUV); err != nil {
+		return err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataRaw)
+	signed := append(authData, clientDataHash[:]...)
+	messageHash := sha256.Sum256(signed)
+	if !bytes.Equal(messageHash[:], common.FromHex(data.WebAuthn.MessageHash)) {
+		return fmt.Errorf("messageHash 与 authenticatorData/clientDataJSON 不一致")
+	}
+
+	var record assertionChallenge
+	if !srv.takeChallenge("assert/"+strings.TrimRight(cd.Challenge, "="), &record) {
+		return fmt.Errorf("challenge 无效、已过期或已使用，请重新获取")
+	}
+	if !strings.EqualFold(record.Wallet, wallet.Hex()) || record.Operation != operation {
+		return fmt.Errorf("challenge 与钱包或操作不匹配")
+	}
+	if !srv.originAllowed(cd.Origin, srv.rpID(r)) {
+		return fmt.Errorf("origin 不被允许: %s", cd.Origin)
+	}
+	return nil
+}
+
+// handleChallenge 签发绑定钱包与操作的一次性签名 challenge
+func (srv *Server) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req ChallengeRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	if !common.IsHexAddress(req.Wallet) {
+		sendError(w, "wallet 地址格式错误: "+req.Wallet)
+		return
+	}
+	if req.Operation == "" {
+		req.Operation = opTransfer
+	}
+	wallet := common.HexToAddress(req.Wallet)
+	buildCall, signed := challengeCalls[req.Operation]
+	if !signed && req.Operation != opSession {
+		sendError(w, "不支持的操作: "+req.Operation)
+		return
+	}
+
+	challenge := make([]byte, 32)
+	rand.Read(challenge)
+	var nonce, sessionKey string
+	if signed {
+		// 签名绑定本次钱包调用的参数与钱包 nonce，合约执行时按同样规则重算核对
+		if req.Operation == opExecute && len(req.Request) == 0 && req.Call != nil {
+			req.Request, _ = json.Marshal(req.Call)
+		}
+		if req.Operation == opSchedule {
+			// 定时转账: 先为任务生成会话密钥，签名同时覆盖其地址
+			if req.Request, sessionKey, err = srv.issueScheduleKey(req.Request); err != nil {
+				sendError(w, req.Operation+": "+err.Error())
+				return
+			}
+		}
+		target, callData, err := buildCall(srv, wallet, req.Request)
+		if err != nil {
+			sendError(w, req.Operation+": "+err.Error())
+			return
+		}
+		if target == wallet && callData != nil {
+			prepare := srv.callChallenge
+			if userOpOperations[req.Operation] && srv.walletTypeFor(wallet).Encoder == walletEncoderAA {
+				// 4337 账户: 先确定 UserOperation 的 gas 与 paymaster 字段，签名覆盖整个 userOpHash
+				prepare = srv.prepareUserOpChallenge
+			}
+			digest, walletNonce, err := prepare(wallet, callData)
+			if err != nil {
+				sendError(w, err.Error())
+				return
+			}
+			challenge, nonce = digest[:], walletNonce.String()
+		}
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(challenge)
+
+	record := assertionChallenge{Wallet: wallet.Hex(), Operation: req.Operation}
+	if err := setCacheJSON(srv.shared, nsChallenges, "assert/"+encoded, record, assertionTTL); err != nil {
+		sendError(w, "保存 challenge 失败: "+err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data: ChallengeData{
+			Challenge:  encoded,
+			RPID:       srv.rpID(r),
+			ExpiresAt:  time.Now().Add(assertionTTL).Unix(),
+			Nonce:      nonce,
+			SessionKey: sessionKey,
+		},
+	})
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 审计记录
+const (
+	auditTransfer          = "transfer"
+	auditScheduledTransfer = "scheduled_transfer"
+	auditTransferETH       = "transfer_eth"
+	auditTransfer1155      = "transfer_1155"
+	auditTransferMulti     = "transfer_multi" // 批量转账，每项一条
+	auditExecute           = "execute"        // 通用合约调用
+	auditApprove           = "approve"        // ERC20 授权，对方为 spender
+
+	screeningClear   = "clear"
+	screeningBlocked = "blocked"
+
+	decisionRelayed  = "relayed"
+	decisionRejected = "rejected"
+
+	maxReportDays = 366
+	reportDateFmt = "2006-01-02"
+)
+
+// ComplianceConfig 合规筛查与报告导出
+type ComplianceConfig struct {
+	BlockedAddresses []string `yaml:"blocked_addresses"` // 禁止作为钱包或收款方的地址 (如 OFAC SDN 列表中的地址)
+	BlocklistFile    string   `yaml:"blocklist_file"`    // 每行一个地址的名单文件 (# 开头为注释)，修改后自动重新加载
+	ExportDir        string   `yaml:"export_dir"`        // 非空时每天导出前一天 (UTC) 的报告 (CSV + JSON)
+}
+
+// AuditEntry 审计日志中的一次中继决定 (nsJournal，key = 日期/纳秒时间戳)
+type AuditEntry struct {
+	Time         int64  `json:"time"`
+	RequestID    string `json:"requestId,omitempty"`
+	Action       string `json:"action"` // transfer / scheduled_transfer
+	Wallet       string `json:"wallet"`
+	Token        string `json:"token"`
+	Counterparty string `json:"counterparty"`
+	Amount       string `json:"amount"`
+	Screening    string `json:"screening"` // clear / blocked
+	Decision     string `json:"decision"`  // relayed / rejected
+	Reason       string `json:"reason,omitempty"`
+	TxHash       string `json:"txHash,omitempty"`
+}
+
+// blocklist 名单文件缓存，按修改时间重新加载
+type blocklist struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	entries map[common.Address]bool
+}
+
+// load 返回名单文件中的地址，读取失败时沿用上次结果
+func (b *blocklist) load(path string) map[common.Address]bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("读取合规名单失败: %v", err)
+		return b.entries
+	}
+	if path == b.path && info.ModTime().Equal(b.modTime) {
+		return b.entries
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("读取合规名单失败: %v", err)
+		return b.entries
+	}
+	defer f.Close()
+
+	entries := make(map[common.Address]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if common.IsHexAddress(line) {
+			entries[common.HexToAddress(line)] = true
+		}
+	}
+	b.path, b.modTime, b.entries = path, info.ModTime(), entries
+	log.Printf("已加载合规名单 %s: %d 个地址", path, len(entries))
+	return entries
+}
+
+// screen 筛查钱包与收款方，命中名单时返回命中的地址
+func (srv *Server) screen(addrs ...common.Address) (common.Address, bool) {
+	cfg := srv.Config().Compliance
+	var fromFile map[common.Address]bool
+	if cfg.BlocklistFile != "" {
+		fromFile = srv.blocklist.load(cfg.BlocklistFile)
+	}
+	for _, addr := range addrs {
+		if fromFile[addr] {
+			return addr, true
+		}
+		for _, blocked := range cfg.BlockedAddresses {
+			if common.HexToAddress(blocked) == addr {
+				return addr, true
+			}
+		}
+	}
+	return common.Address{}, false
+}
+
+// screenTransfer 转账涉及名单地址时拒绝
+func (srv *Server) screenTransfer(req *ERC20TransferRequest) error {
+	if addr, hit := srv.screen(common.HexToAddress(req.Wallet), common.HexToAddress(req.To)); hit {
+		return fmt.Errorf("地址 %s 未通过合规筛查，拒绝中继", addr.Hex())
+	}
+	return nil
+}
+
+// audit 记录一次转账中继决定，err 为 nil 表示已中继
+func (srv *Server) audit(action string, req *ERC20TransferRequest, txHash common.Hash, err error) {
+	now := time.Now()
+	entry := AuditEntry{
+		Time:         now.Unix(),
+		RequestID:    req.requestID,
+		Action:       action,
+		Wallet:       req.Wallet,
+		Token:        req.Token,
+		Counterparty: req.To,
+		Amount:       req.Amount,
+		Screening:    screeningClear,
+		Decision:     decisionRelayed,
+	}
+	if common.IsHexAddress(req.Wallet) && common.IsHexAddress(req.To) {
+		entry.Wallet = common.HexToAddress(req.Wallet).Hex()
+		entry.Counterparty = common.HexToAddress(req.To).Hex()
+		if _, hit := srv.screen(common.HexToAddress(req.Wallet), common.HexToAddress(req.To)); hit {
+			entry.Screening = screeningBlocked
+		}
+	}
+	if err != nil {
+		entry.Decision = decisionRejected
+		entry.Reason = err.Error()
+	} else {
+		entry.TxHash = txHash.Hex()
+	}
+
+	key := fmt.Sprintf("%s/%020d", now.UTC().Format(reportDateFmt), now.UnixNano())
+	if err := putJSON(srv.storage, nsJournal, key, entry, 0); err != nil {
+		log.Printf("写入审计日志失败: %v", err)
+	}
+}
+
+// complianceReport 读取 [from, to] (UTC 日期，含两端) 的审计记录
+func (srv *Server) complianceReport(from, to time.Time) ([]AuditEntry, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("结束日期早于开始日期")
+	}
+	if to.Sub(from) > maxReportDays*24*time.Hour {
+		return nil, fmt.Errorf("报告区间最多 %d 天", maxReportDays)
+	}
+
+	entries := []AuditEntry{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		kvs, err := srv.storage.List(nsJournal, day.Format(reportDateFmt)+"/")
+		if err != nil {
+			return nil, fmt.Errorf("读取审计日志失败: %v", err)
+		}
+		for _, kv := range kvs {
+			var entry AuditEntry
+			if err := json.Unmarshal(kv.Value, &entry); err == nil {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// parseReportRange 解析 YYYY-MM-DD 日期区间，默认为当天
+func parseReportRange(fromStr, toStr string) (time.Time, time.Time, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today, today
+	var err error
+	if fromStr != "" {
+		if from, err = time.Parse(reportDateFmt, fromStr); err != nil {
+			return from, to, fmt.Errorf("开始日期格式错误 (YYYY-MM-DD): %s", fromStr)
+		}
+		to = from
+	}
+	if toStr != "" {
+		if to, err = time.Parse(reportDateFmt, toStr); err != nil {
+			return from, to, fmt.Errorf("结束日期格式错误 (YYYY-MM-DD): %s", toStr)
+		}
+	}
+	return from, to, nil
+}
+
+// writeComplianceReport 按 csv / json 写出报告
+func writeComplianceReport(w io.Writer, format string, entries []AuditEntry) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	case "csv", "":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"time", "request_id", "action", "wallet", "token", "counterparty", "amount", "screening", "decision", "reason", "tx_hash"})
+		for _, e := range entries {
+			cw.Write([]string{
+				time.Unix(e.Time, 0).UTC().Format(time.RFC3339), e.RequestID, e.Action,
+				e.Wallet, e.Token, e.Counterparty, e.Amount,
+				e.Screening, e.Decision, e.Reason, e.TxHash,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("不支持的报告格式: %s (csv / json)", format)
+}
+
+// handleAdminCompliance 导出合规报告
+//
+//	GET /api/admin/compliance?from=2026-01-01&to=2026-01-31&format=csv
+func (srv *Server) handleAdminCompliance(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to, err := parseReportRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	format := q.Get("format")
+	if format != "json" && format != "csv" && format != "" {
+		sendError(w, "不支持的报告格式: "+format+" (csv / json)")
+		return
+	}
+	entries, err := srv.complianceReport(from, to)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	name := fmt.Sprintf("compliance-%s_%s", from.Format(reportDateFmt), to.Format(reportDateFmt))
+	if format == "json" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.json"`)
+	} else {
+		format = "csv"
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+	}
+	w.Header().Set("X-Record-Count", strconv.Itoa(len(entries)))
+	writeComplianceReport(w, format, entries)
+}
+
+// runComplianceReport 命令行导出，out 为空时写到标准输出
+// 默认内存存储在新进程中为空，需配合持久化存储后端使用
+func runComplianceReport(srv *Server, fromStr, toStr, format, out string) error {
+	from, to, err := parseReportRange(fromStr, toStr)
+	if err != nil {
+		return err
+	}
+	entries, err := srv.complianceReport(from, to)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("创建报告文件失败: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeComplianceReport(w, format, entries); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已导出 %d 条记录 (%s ~ %s)\n", len(entries), from.Format(reportDateFmt), to.Format(reportDateFmt))
+	return nil
+}
+
+// runComplianceExports 每小时检查一次，导出尚未导出的前一天报告
+func (srv *Server) runComplianceExports(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if dir := srv.Config().Compliance.ExportDir; dir != "" {
+			day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+			if err := srv.exportComplianceDay(dir, day); err != nil {
+				log.Printf("导出合规报告失败: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// exportComplianceDay 写出某一天的 CSV 与 JSON 报告，已存在时跳过
+func (srv *Server) exportComplianceDay(dir string, day time.Time) error {
+	base := filepath.Join(dir, "compliance-"+day.Format(reportDateFmt))
+	if _, err := os.Stat(base + ".csv"); err == nil {
+		return nil
+	}
+	entries, err := srv.complianceReport(day, day)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	// 先写 JSON，CSV 最后写入，作为"已导出"的标记
+	for _, format := range []string{"json", "csv"} {
+		f, err := os.OpenFile(base+"."+format, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+		if err != nil {
+			return err
+		}
+		err = writeComplianceReport(f, format, entries)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("已导出合规报告 %s (%d 条)", base, len(entries))
+	return nil
+}
@@ -7,13 +7,100 @@ contract PasskeyWallet {
     /// @notice P256VERIFY 预编译合约地址 (EIP-7212)
     address constant P256VERIFY = 0x0000000000000000000000000000000000000100;
 
+    /// @notice 没有预编译的链上使用的 Solidity 实现 (Daimo P256Verifier，输入格式与预编译相同)
+    address constant P256_FALLBACK_VERIFIER = 0xc2b78104907F722DABAc4C69f826a522B2754De4;
+
+    /// @notice ERC-4337 EntryPoint v0.7
+    address public constant ENTRY_POINT = 0x0000000071727De22E5E9d8BAf0edAc6f37da032;
+
+    /// @notice ERC-4337 v0.7 打包格式的 UserOperation
+    struct PackedUserOperation {
+        address sender;
+        uint256 nonce;
+        bytes initCode;
+        bytes callData;
+        bytes32 accountGasLimits;
+        uint256 preVerificationGas;
+        bytes32 gasFees;
+        bytes paymasterAndData;
+        bytes signature;
+    }
+
+    /// @notice WebAuthn 断言，各操作的 signature 参数为 abi.encode(WebAuthnAuth)
+    struct WebAuthnAuth {
+        bytes authenticatorData;
+        string clientDataJSON;
+        uint256 challengeIndex; // clientDataJSON 中 "challenge":"..." 的起始位置
+        uint256 typeIndex; // clientDataJSON 中 "type":"webauthn.get" 的起始位置
+        bytes32 r;
+        bytes32 s;
+    }
+
+    /// @notice 各操作摘要的类型标识，见 _digest
+    bytes32 constant TRANSFER_ERC20_TYPEHASH =
+        keccak256("PasskeyWallet.transferERC20(address token,address to,uint256 amount,uint256 nonce)");
+    bytes32 constant TRANSFER_ETH_TYPEHASH = keccak256("PasskeyWallet.transferETH(address to,uint256 amount,uint256 nonce)");
+    bytes32 constant EXECUTE_TYPEHASH = keccak256("PasskeyWallet.execute(address to,uint256 value,bytes data,uint256 nonce)");
+    bytes32 constant EXECUTE_BATCH_TYPEHASH =
+        keccak256("PasskeyWallet.executeBatch(address[] to,uint256[] values,bytes[] data,uint256 nonce)");
+    bytes32 constant UPDATE_PUBLIC_KEY_TYPEHASH =
+        keccak256("PasskeyWallet.updatePublicKey(bytes32 newX,bytes32 newY,uint256 nonce)");
+    bytes32 constant ADD_PUBLIC_KEY_TYPEHASH = keccak256("PasskeyWallet.addPublicKey(bytes32 x,bytes32 y,uint256 nonce)");
+    bytes32 constant REMOVE_PUBLIC_KEY_TYPEHASH = keccak256("PasskeyWallet.removePublicKey(bytes32 x,bytes32 y,uint256 nonce)");
+    bytes32 constant FREEZE_TYPEHASH = keccak256("PasskeyWallet.freeze(uint256 nonce)");
+    bytes32 constant UNFREEZE_TYPEHASH = keccak256("PasskeyWallet.unfreeze(uint256 nonce)");
+    bytes32 constant SET_GUARDIANS_TYPEHASH =
+        keccak256("PasskeyWallet.setGuardians(address[] newGuardians,uint256 threshold,uint256 nonce)");
+    bytes32 constant CANCEL_RECOVERY_TYPEHASH = keccak256("PasskeyWallet.cancelRecovery(uint256 nonce)");
+    bytes32 constant ADD_SCHEDULE_TYPEHASH = keccak256(
+        "PasskeyWallet.addSchedule(address sessionKey,address token,address to,uint256 amount,uint64 interval,uint32 maxRuns,uint64 validUntil,uint256 nonce)"
+    );
+    /// @notice 会话密钥对每次定时转账的签名: keccak256(abi.encode(typeHash, chainid, 钱包地址, sessionKey, run))
+    bytes32 constant SCHEDULED_RUN_TYPEHASH = keccak256("PasskeyWallet.executeScheduled(address sessionKey,uint256 run)");
+
     /// @notice 钱包所有者的 Passkey 公钥
     bytes32 public publicKeyX;
     bytes32 public publicKeyY;
 
+    /// @notice 其他设备的 Passkey 公钥 (多设备)，与主公钥同等授权
+    bytes32[2][] private extraKeys;
+
     /// @notice 防重放攻击的 nonce
     uint256 public nonce;
 
+    /// @notice 紧急冻结: 冻结期间拒绝一切转出 (transferERC20 / transferETH / execute / executeScheduled)
+    bool public frozen;
+
+    /// @notice 社交恢复: 守护人、门限与时间锁
+    uint256 public constant RECOVERY_DELAY = 2 days;
+    address[] private guardianList;
+    mapping(address => bool) public isGuardian;
+    uint256 public guardianThreshold;
+
+    /// @notice 待执行的恢复 (executeAfter 为 0 表示没有)
+    struct Recovery {
+        bytes32 x;
+        bytes32 y;
+        uint64 executeAfter;
+    }
+    Recovery public pendingRecovery;
+
+    /// @notice 定时转账: 会话密钥只能按登记的代币、收款人、金额与周期转出，次数与截止时间由合约约束
+    struct Schedule {
+        address token;
+        address to;
+        uint256 amount; // 为 0 表示没有登记
+        uint64 nextRun; // 下一次最早可执行的时间
+        uint64 interval; // 周期 (秒)，0 表示一次性
+        uint64 validUntil; // 截止时间，0 表示不限
+        uint32 maxRuns; // 最多执行次数，0 表示不限
+        uint32 runs;
+    }
+    mapping(address => Schedule) public schedules;
+
+    /// @notice 定时转账允许提前执行的时间，容忍中继调度与出块时间的偏差
+    uint256 public constant SCHEDULE_TOLERANCE = 1 minutes;
+
     /// @notice 转账事件
     event ERC20Transferred(
         address indexed token,
@@ -25,6 +112,29 @@ contract PasskeyWallet {
     /// @notice 公钥更新事件
     event PublicKeyUpdated(bytes32 x, bytes32 y);
 
+    /// @notice 多设备公钥增删事件
+    event PublicKeyAdded(bytes32 x, bytes32 y);
+    event PublicKeyRemoved(bytes32 x, bytes32 y);
+
+    /// @notice 冻结 / 解冻事件
+    event WalletFrozen();
+    event WalletUnfrozen();
+
+    /// @notice 社交恢复事件
+    event GuardiansUpdated(address[] guardians, uint256 threshold);
+    event RecoveryInitiated(bytes32 x, bytes32 y, uint64 executeAfter);
+    event RecoveryCancelled();
+
+    /// @notice 定时转账事件
+    event ScheduleAdded(address indexed sessionKey, address indexed token, address indexed to, uint256 amount);
+    event ScheduledTransferExecuted(address indexed sessionKey, uint256 run);
+
+    /// @notice 冻结期间禁止转出资产
+    modifier notFrozen() {
+        require(!frozen, "Wallet frozen");
+        _;
+    }
+
     /// @notice 初始化钱包，设置 Passkey 公钥
     /// @param x 公钥 X 坐标
     /// @param y 公钥 Y 坐标
@@ -34,40 +144,158 @@ contract PasskeyWallet {
         emit PublicKeyUpdated(x, y);
     }
 
-    /// @notice 验证 P256 签名
+    /// @notice 验证 P256 签名，任一已授权公钥验证通过即有效
+    /// @dev 依次尝试主公钥与其他设备公钥，每多一把公钥最多多一次验证
     function verifySignature(
         bytes32 hash,
         bytes32 r,
         bytes32 s
     ) public view returns (bool) {
-        (bool success, bytes memory result) = P256VERIFY.staticcall(
-            abi.encodePacked(hash, r, s, publicKeyX, publicKeyY)
-        );
+        if (verifyWithKey(hash, r, s, publicKeyX, publicKeyY)) {
+            return true;
+        }
+        for (uint256 i = 0; i < extraKeys.length; i++) {
+            if (verifyWithKey(hash, r, s, extraKeys[i][0], extraKeys[i][1])) {
+                return true;
+            }
+        }
+        return false;
+    }
 
-        if (!success || result.length == 0) {
-            return false;
+    /// @notice 用指定公钥验证 P256 签名
+    /// @dev 优先走预编译 (约 3450 gas)；预编译不存在时返回空数据，此时回退到 Solidity 验证合约
+    function verifyWithKey(
+        bytes32 hash,
+        bytes32 r,
+        bytes32 s,
+        bytes32 x,
+        bytes32 y
+    ) internal view returns (bool) {
+        bytes memory input = abi.encodePacked(hash, r, s, x, y);
+
+        (bool success, bytes memory result) = P256VERIFY.staticcall(input);
+        if (success && result.length == 32) {
+            return abi.decode(result, (uint256)) == 1;
         }
 
+        if (P256_FALLBACK_VERIFIER.code.length == 0) {
+            return false;
+        }
+        (success, result) = P256_FALLBACK_VERIFIER.staticcall(input);
+        if (!success || result.length != 32) {
+            return false;
+        }
         return abi.decode(result, (uint256)) == 1;
     }
 
+    /// @notice 操作摘要: keccak256(abi.encode(typeHash, chainid, 钱包地址, 参数..., nonce))
+    /// @dev params 为参与摘要的参数的 abi.encode (bytes 与数组先取 keccak256)。摘要由合约按实际执行的参数与
+    ///      当前 nonce 重算，签名不能用于其它参数，也不能在 nonce 推进后重放
+    function _digest(bytes32 typeHash, bytes memory params) internal view returns (bytes32) {
+        return keccak256(abi.encodePacked(typeHash, block.chainid, uint256(uint160(address(this))), params, nonce));
+    }
+
+    /// @notice 验证 WebAuthn 断言: clientDataJSON 的 challenge 必须是 base64url(challenge)，
+    ///         签名消息 sha256(authenticatorData || sha256(clientDataJSON)) 由任一已授权公钥签名
+    /// @param signature abi.encode(WebAuthnAuth)
+    function _verifyWebAuthn(bytes32 challenge, bytes calldata signature) internal view returns (bool) {
+        WebAuthnAuth memory auth = abi.decode(signature, (WebAuthnAuth));
+
+        // authenticatorData = rpIdHash (32) || flags (1) || signCount (4)，要求 UP (用户在场)
+        if (auth.authenticatorData.length < 37 || (uint8(auth.authenticatorData[32]) & 0x01) == 0) {
+            return false;
+        }
+        bytes memory clientData = bytes(auth.clientDataJSON);
+        if (!_matchAt(clientData, auth.typeIndex, '"type":"webauthn.get"')) {
+            return false;
+        }
+        if (!_matchAt(clientData, auth.challengeIndex, abi.encodePacked('"challenge":"', _base64Url(challenge), '"'))) {
+            return false;
+        }
+        bytes32 hash = sha256(abi.encodePacked(auth.authenticatorData, sha256(clientData)));
+        return verifySignature(hash, auth.r, auth.s);
+    }
+
+    /// @notice 签名操作的授权: EntryPoint 调用时 validateUserOp 已验证过覆盖 callData 的 userOpHash 断言，
+    ///         其它调用方须提供 challenge 为本次操作摘要的断言
+    function _authorized(bytes32 typeHash, bytes memory params, bytes calldata signature) internal view returns (bool) {
+        return msg.sender == ENTRY_POINT || _verifyWebAuthn(_digest(typeHash, params), signature);
+    }
+
+    /// @notice data 从 at 开始是否为 expected
+    function _matchAt(bytes memory data, uint256 at, bytes memory expected) private pure returns (bool) {
+        if (at > data.length || data.length - at < expected.length) {
+            return false;
+        }
+        for (uint256 i = 0; i < expected.length; i++) {
+            if (data[at + i] != expected[i]) {
+                return false;
+            }
+        }
+        return true;
+    }
+
+    /// @notice 32 字节的 base64url 编码 (43 字符，无填充)，与浏览器写入 clientDataJSON 的 challenge 一致
+    function _base64Url(bytes32 data) private pure returns (bytes memory out) {
+        bytes memory table = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_";
+        uint256 v = uint256(data);
+        out = new bytes(43);
+        // 从高位起每 6 位一个字符，最后剩余的 4 位左移 2 位补零
+        for (uint256 i = 0; i < 42; i++) {
+            out[i] = table[(v >> (250 - 6 * i)) & 0x3f];
+        }
+        out[42] = table[(v << 2) & 0x3f];
+    }
+
+    /// @notice EIP-1271 签名验证
+    /// @dev signature = abi.encode(r, s)，hash 为 WebAuthn 签名消息哈希
+    /// @return magicValue 签名有效时返回 0x1626ba7e
+    function isValidSignature(bytes32 hash, bytes calldata signature) external view returns (bytes4 magicValue) {
+        if (signature.length != 64) {
+            return 0xffffffff;
+        }
+        (bytes32 r, bytes32 s) = abi.decode(signature, (bytes32, bytes32));
+        return verifySignature(hash, r, s) ? bytes4(0x1626ba7e) : bytes4(0xffffffff);
+    }
+
+    /// @notice ERC-4337 账户验证
+    /// @dev signature = abi.encode(WebAuthnAuth)，challenge 必须是 userOpHash: 断言覆盖整个 UserOperation
+    ///      (callData、gas、paymaster 与 EntryPoint nonce)，不能换到其它操作上
+    /// @param userOp 用户操作
+    /// @param userOpHash EntryPoint 计算的 UserOperation 哈希
+    /// @param missingAccountFunds 需要补给 EntryPoint 的预付款
+    /// @return validationData 0 表示签名有效，1 表示签名无效
+    function validateUserOp(
+        PackedUserOperation calldata userOp,
+        bytes32 userOpHash,
+        uint256 missingAccountFunds
+    ) external returns (uint256 validationData) {
+        require(msg.sender == ENTRY_POINT, "Not from EntryPoint");
+
+        validationData = _verifyWebAuthn(userOpHash, userOp.signature) ? 0 : 1;
+
+        if (missingAccountFunds > 0) {
+            (bool success, ) = payable(msg.sender).call{value: missingAccountFunds}("");
+            (success);
+        }
+    }
+
     /// @notice 执行 ERC20 转账（需要 Passkey 签名授权）
     /// @param token ERC20 代币合约地址
     /// @param to 接收地址
     /// @param amount 转账金额
-    /// @param hash WebAuthn 签名消息哈希
-    /// @param r 签名 r 值
-    /// @param s 签名 s 值
+    /// @param signature WebAuthn 断言 abi.encode(WebAuthnAuth)，challenge 为本次操作的摘要
     function transferERC20(
         address token,
         address to,
         uint256 amount,
-        bytes32 hash,
-        bytes32 r,
-        bytes32 s
-    ) external {
-        // 验证 P256 签名
-        require(verifySignature(hash, r, s), "Invalid signature");
+        bytes calldata signature
+    ) external notFrozen {
+        // 验证 Passkey 签名覆盖 (token, to, amount, nonce)
+        require(
+            _authorized(TRANSFER_ERC20_TYPEHASH, abi.encode(token, to, amount), signature),
+            "Invalid signature"
+        );
 
         uint256 currentNonce = nonce;
         nonce++;
@@ -92,17 +320,13 @@ contract PasskeyWallet {
     /// @notice 执行 ETH 转账（需要 Passkey 签名授权）
     /// @param to 接收地址
     /// @param amount 转账金额 (wei)
-    /// @param hash WebAuthn 签名消息哈希
-    /// @param r 签名 r 值
-    /// @param s 签名 s 值
+    /// @param signature WebAuthn 断言 abi.encode(WebAuthnAuth)，challenge 为本次操作的摘要
     function transferETH(
         address payable to,
         uint256 amount,
-        bytes32 hash,
-        bytes32 r,
-        bytes32 s
-    ) external {
-        require(verifySignature(hash, r, s), "Invalid signature");
+        bytes calldata signature
+    ) external notFrozen {
+        require(_authorized(TRANSFER_ETH_TYPEHASH, abi.encode(to, amount), signature), "Invalid signature");
 
         nonce++;
 
@@ -114,18 +338,17 @@ contract PasskeyWallet {
     /// @param to 目标合约地址
     /// @param value ETH 数量
     /// @param data 调用数据
-    /// @param hash WebAuthn 签名消息哈希
-    /// @param r 签名 r 值
-    /// @param s 签名 s 值
+    /// @param signature WebAuthn 断言 abi.encode(WebAuthnAuth)，challenge 为本次操作的摘要
     function execute(
         address to,
         uint256 value,
         bytes calldata data,
-        bytes32 hash,
-        bytes32 r,
-        bytes32 s
-    ) external returns (bytes memory) {
-        require(verifySignature(hash, r, s), "Invalid signature");
+        bytes calldata signature
+    ) external notFrozen returns (bytes memory) {
+        require(
+            _authorized(EXECUTE_TYPEHASH, abi.encode(to, value, keccak256(data)), signature),
+            "Invalid signature"
+        );
 
         nonce++;
 
@@ -135,20 +358,63 @@ contract PasskeyWallet {
         return result;
     }
 
+    /// @notice 批量执行（一次 Passkey 签名授权多笔调用，任一失败整体回滚）
+    /// @param to 目标地址列表
+    /// @param values 每笔调用的 ETH 数量
+    /// @param data 每笔调用的调用数据
+    /// @param signature WebAuthn 断言 abi.encode(WebAuthnAuth)，challenge 为本次操作的摘要
+    /// @return results 每笔调用的返回数据
+    function executeBatch(
+        address[] calldata to,
+        uint256[] calldata values,
+        bytes[] calldata data,
+        bytes calldata signature
+    ) external notFrozen returns (bytes[] memory results) {
+        require(to.length == values.length && to.length == data.length, "Length mismatch");
+        bytes32 calls = keccak256(abi.encode(to, values, data));
+        require(_authorized(EXECUTE_BATCH_TYPEHASH, abi.encode(calls), signature), "Invalid signature");
+
+        nonce++;
+
+        results = new bytes[](to.length);
+        for (uint256 i = 0; i < to.length; i++) {
+            (bool success, bytes memory result) = to[i].call{value: values[i]}(data[i]);
+            if (!success) {
+                // 带上失败的序号，便于定位
+                revert(string(abi.encodePacked("Batch call ", _toString(i), " failed")));
+            }
+            results[i] = result;
+        }
+    }
+
+    /// @notice 十进制字符串
+    function _toString(uint256 value) private pure returns (string memory) {
+        if (value == 0) {
+            return "0";
+        }
+        uint256 digits;
+        for (uint256 v = value; v != 0; v /= 10) {
+            digits++;
+        }
+        bytes memory buf = new bytes(digits);
+        while (value != 0) {
+            digits--;
+            buf[digits] = bytes1(uint8(48 + (value % 10)));
+            value /= 10;
+        }
+        return string(buf);
+    }
+
     /// @notice 更新公钥（需要当前 Passkey 签名授权）
     /// @param newX 新公钥 X 坐标
     /// @param newY 新公钥 Y 坐标
-    /// @param hash WebAuthn 签名消息哈希
-    /// @param r 签名 r 值
-    /// @param s 签名 s 值
+    /// @param signature WebAuthn 断言 abi.encode(WebAuthnAuth)，challenge 为本次操作的摘要
     function updatePublicKey(
         bytes32 newX,
         bytes32 newY,
-        bytes32 hash,
-        bytes32 r,
-        bytes32 s
+        bytes calldata signature
     ) external {
-        require(verifySignature(hash, r, s), "Invalid signature");
+        require(_authorized(UPDATE_PUBLIC_KEY_TYPEHASH, abi.encode(newX, newY), signature), "Invalid signature");
 
         publicKeyX = newX;
         publicKeyY = newY;
@@ -157,11 +423,298 @@ contract PasskeyWallet {
         emit PublicKeyUpdated(newX, newY);
     }
 
+    /// @notice 添加其他设备的公钥（需要任一已授权 Passkey 签名）
+    function addPublicKey(
+        bytes32 x,
+        bytes32 y,
+        bytes calldata signature
+    ) external {
+        require(_authorized(ADD_PUBLIC_KEY_TYPEHASH, abi.encode(x, y), signature), "Invalid signature");
+        require(!isAuthorizedKey(x, y), "Key already authorized");
+
+        extraKeys.push([x, y]);
+        nonce++;
+
+        emit PublicKeyAdded(x, y);
+    }
+
+    /// @notice 撤销一把公钥（需要任一已授权 Passkey 签名），至少保留一把
+    /// @dev 撤销主公钥时由最后一把其他设备公钥接替
+    function removePublicKey(
+        bytes32 x,
+        bytes32 y,
+        bytes calldata signature
+    ) external {
+        require(_authorized(REMOVE_PUBLIC_KEY_TYPEHASH, abi.encode(x, y), signature), "Invalid signature");
+        require(extraKeys.length > 0, "Cannot remove last key");
+
+        uint256 last = extraKeys.length - 1;
+        if (x == publicKeyX && y == publicKeyY) {
+            publicKeyX = extraKeys[last][0];
+            publicKeyY = extraKeys[last][1];
+            extraKeys.pop();
+            emit PublicKeyUpdated(publicKeyX, publicKeyY);
+        } else {
+            bool found = false;
+            for (uint256 i = 0; i < extraKeys.length; i++) {
+                if (extraKeys[i][0] == x && extraKeys[i][1] == y) {
+                    extraKeys[i] = extraKeys[last];
+                    extraKeys.pop();
+                    found = true;
+                    break;
+                }
+            }
+            require(found, "Key not authorized");
+        }
+        nonce++;
+
+        emit PublicKeyRemoved(x, y);
+    }
+
+    /// @notice 冻结钱包（需要任一已授权 Passkey 签名），用于怀疑设备被盗时紧急止损
+    /// @dev 冻结期间仍可增删公钥与社交恢复，便于撤销被盗设备
+    function freeze(bytes calldata signature) external {
+        require(_authorized(FREEZE_TYPEHASH, "", signature), "Invalid signature");
+        require(!frozen, "Already frozen");
+
+        frozen = true;
+        nonce++;
+
+        emit WalletFrozen();
+    }
+
+    /// @notice 解除冻结（需要任一已授权 Passkey 签名）
+    function unfreeze(bytes calldata signature) external {
+        require(_authorized(UNFREEZE_TYPEHASH, "", signature), "Invalid signature");
+        require(frozen, "Not frozen");
+
+        frozen = false;
+        nonce++;
+
+        emit WalletUnfrozen();
+    }
+
+    /// @notice 公钥是否已授权
+    function isAuthorizedKey(bytes32 x, bytes32 y) public view returns (bool) {
+        if (x == publicKeyX && y == publicKeyY) {
+            return true;
+        }
+        for (uint256 i = 0; i < extraKeys.length; i++) {
+            if (extraKeys[i][0] == x && extraKeys[i][1] == y) {
+                return true;
+            }
+        }
+        return false;
+    }
+
+    /// @notice 获取全部已授权公钥，第一把为主公钥
+    function getPublicKeys() external view returns (bytes32[] memory xs, bytes32[] memory ys) {
+        xs = new bytes32[](extraKeys.length + 1);
+        ys = new bytes32[](extraKeys.length + 1);
+        xs[0] = publicKeyX;
+        ys[0] = publicKeyY;
+        for (uint256 i = 0; i < extraKeys.length; i++) {
+            xs[i + 1] = extraKeys[i][0];
+            ys[i + 1] = extraKeys[i][1];
+        }
+    }
+
+    /// @notice 设置守护人（需要当前 Passkey 签名授权），会取消进行中的恢复
+    /// @param newGuardians 守护人 EOA 地址
+    /// @param threshold 发起恢复所需的守护人签名数
+    function setGuardians(
+        address[] calldata newGuardians,
+        uint256 threshold,
+        bytes calldata signature
+    ) external {
+        require(
+            _authorized(SET_GUARDIANS_TYPEHASH, abi.encode(keccak256(abi.encode(newGuardians)), threshold), signature),
+            "Invalid signature"
+        );
+        require(threshold > 0 && threshold <= newGuardians.length, "Invalid threshold");
+
+        for (uint256 i = 0; i < guardianList.length; i++) {
+            isGuardian[guardianList[i]] = false;
+        }
+        delete guardianList;
+        for (uint256 i = 0; i < newGuardians.length; i++) {
+            require(newGuardians[i] != address(0) && !isGuardian[newGuardians[i]], "Invalid guardian");
+            isGuardian[newGuardians[i]] = true;
+            guardianList.push(newGuardians[i]);
+        }
+        guardianThreshold = threshold;
+        delete pendingRecovery;
+        nonce++;
+
+        emit GuardiansUpdated(newGuardians, threshold);
+    }
+
+    /// @notice 获取守护人列表
+    function getGuardians() external view returns (address[] memory) {
+        return guardianList;
+    }
+
+    /// @notice 守护人需要签名 (EIP-191 personal_sign) 的恢复摘要，绑定钱包、链与当前 nonce
+    function recoveryHash(bytes32 newX, bytes32 newY) public view returns (bytes32) {
+        return keccak256(abi.encode(address(this), block.chainid, nonce, newX, newY));
+    }
+
+    /// @notice 凭守护人签名发起恢复，时间锁到期后可执行
+    /// @param signatures 65 字节 ECDSA 签名，按签名者地址升序排列
+    function initiateRecovery(bytes32 newX, bytes32 newY, bytes[] calldata signatures) external {
+        require(guardianThreshold > 0, "No guardians");
+        require(signatures.length >= guardianThreshold, "Not enough signatures");
+
+        bytes32 digest = keccak256(abi.encodePacked("\x19Ethereum Signed Message:\n32", recoveryHash(newX, newY)));
+        address last = address(0);
+        for (uint256 i = 0; i < signatures.length; i++) {
+            address signer = recoverSigner(digest, signatures[i]);
+            require(signer > last && isGuardian[signer], "Invalid guardian signature");
+            last = signer;
+        }
+
+        uint64 executeAfter = uint64(block.timestamp + RECOVERY_DELAY);
+        pendingRecovery = Recovery(newX, newY, executeAfter);
+        emit RecoveryInitiated(newX, newY, executeAfter);
+    }
+
+    /// @notice 时间锁到期后执行恢复，轮换 Passkey 公钥（任何人可调用），其他设备公钥全部撤销
+    function executeRecovery() external {
+        Recovery memory rec = pendingRecovery;
+        require(rec.executeAfter != 0, "No pending recovery");
+        require(block.timestamp >= rec.executeAfter, "Timelock not expired");
+
+        publicKeyX = rec.x;
+        publicKeyY = rec.y;
+        delete extraKeys;
+        delete pendingRecovery;
+        nonce++;
+
+        emit PublicKeyUpdated(rec.x, rec.y);
+    }
+
+    /// @notice 所有者取消进行中的恢复（需要当前 Passkey 签名授权）
+    function cancelRecovery(bytes calldata signature) external {
+        require(_authorized(CANCEL_RECOVERY_TYPEHASH, "", signature), "Invalid signature");
+        require(pendingRecovery.executeAfter != 0, "No pending recovery");
+
+        delete pendingRecovery;
+        nonce++;
+
+        emit RecoveryCancelled();
+    }
+
+    /// @notice 登记定时转账的会话密钥（需要 Passkey 签名授权）
+    /// @dev 签名覆盖会话密钥与全部转账约束，之后每次执行只需会话密钥签名，不再使用 Passkey
+    /// @param sessionKey 服务端为本任务生成的 secp256k1 会话密钥地址，每个任务一把
+    /// @param interval 周期 (秒)，0 表示一次性
+    /// @param maxRuns 最多执行次数，0 表示不限 (周期任务需设置 maxRuns 或 validUntil)
+    /// @param validUntil 截止时间 (unix 秒)，0 表示不限
+    function addSchedule(
+        address sessionKey,
+        address token,
+        address to,
+        uint256 amount,
+        uint64 interval,
+        uint32 maxRuns,
+        uint64 validUntil,
+        bytes calldata signature
+    ) external {
+        require(
+            _authorized(
+                ADD_SCHEDULE_TYPEHASH,
+                abi.encode(sessionKey, token, to, amount, interval, maxRuns, validUntil),
+                signature
+            ),
+            "Invalid signature"
+        );
+        require(sessionKey != address(0) && schedules[sessionKey].amount == 0, "Invalid session key");
+        require(amount > 0, "Invalid amount");
+        require(interval == 0 || maxRuns > 0 || validUntil > 0, "Unbounded schedule");
+
+        nonce++;
+        schedules[sessionKey] = Schedule({
+            token: token,
+            to: to,
+            amount: amount,
+            nextRun: 0,
+            interval: interval,
+            validUntil: validUntil,
+            maxRuns: interval == 0 ? 1 : maxRuns,
+            runs: 0
+        });
+
+        emit ScheduleAdded(sessionKey, token, to, amount);
+    }
+
+    /// @notice 执行一次定时转账（会话密钥签名，任何人可提交）
+    /// @param sessionSignature 会话密钥对 SCHEDULED_RUN_TYPEHASH 摘要的 65 字节 eth_sign 签名
+    function executeScheduled(address sessionKey, bytes calldata sessionSignature) external notFrozen {
+        Schedule storage s = schedules[sessionKey];
+        require(s.amount != 0, "Unknown schedule");
+        require(s.maxRuns == 0 || s.runs < s.maxRuns, "Schedule finished");
+        require(s.validUntil == 0 || block.timestamp <= s.validUntil, "Schedule expired");
+        require(block.timestamp + SCHEDULE_TOLERANCE >= s.nextRun, "Schedule not due");
+
+        uint256 run = s.runs;
+        bytes32 digest = keccak256(abi.encode(SCHEDULED_RUN_TYPEHASH, block.chainid, address(this), sessionKey, run));
+        require(
+            recoverSigner(keccak256(abi.encodePacked("\x19Ethereum Signed Message:\n32", digest)), sessionSignature) == sessionKey,
+            "Invalid session signature"
+        );
+
+        // 按周期推进，延迟执行后不能连续补跑
+        s.runs = uint32(run + 1);
+        s.nextRun = uint64((block.timestamp > s.nextRun ? block.timestamp : s.nextRun) + s.interval);
+
+        (bool success, bytes memory result) = s.token.call(
+            abi.encodeWithSignature("transfer(address,uint256)", s.to, s.amount)
+        );
+        require(success, "Transfer call failed");
+        if (result.length > 0) {
+            require(abi.decode(result, (bool)), "Transfer returned false");
+        }
+
+        emit ScheduledTransferExecuted(sessionKey, run);
+    }
+
+    function recoverSigner(bytes32 digest, bytes calldata sig) private pure returns (address) {
+        require(sig.length == 65, "Invalid signature length");
+        bytes32 r = bytes32(sig[0:32]);
+        bytes32 s = bytes32(sig[32:64]);
+        uint8 v = uint8(sig[64]);
+        if (v < 27) {
+            v += 27;
+        }
+        return ecrecover(digest, v, r, s);
+    }
+
     /// @notice 获取钱包公钥
     function getPublicKey() external view returns (bytes32 x, bytes32 y) {
         return (publicKeyX, publicKeyY);
     }
 
+    /// @notice ERC-1155 接收回调，钱包才能通过 safeTransferFrom / mint 接收 ERC-1155 代币
+    function onERC1155Received(address, address, uint256, uint256, bytes calldata) external pure returns (bytes4) {
+        return this.onERC1155Received.selector;
+    }
+
+    /// @notice ERC-1155 批量接收回调
+    function onERC1155BatchReceived(
+        address,
+        address,
+        uint256[] calldata,
+        uint256[] calldata,
+        bytes calldata
+    ) external pure returns (bytes4) {
+        return this.onERC1155BatchReceived.selector;
+    }
+
+    /// @notice EIP-165: IERC165 (0x01ffc9a7)、IERC1155Receiver (0x4e2312e0)
+    function supportsInterface(bytes4 interfaceId) external pure returns (bool) {
+        return interfaceId == 0x01ffc9a7 || interfaceId == 0x4e2312e0;
+    }
+
     /// @notice 接收 ETH
     receive() external payable {}
 }
@@ -175,6 +728,9 @@ contract PasskeyWalletFactory {
     /// @notice 用户地址 => 钱包地址（可选，用于查询）
     mapping(address => address) public wallets;
 
+    /// @notice keccak256(x, y) => 钱包地址，同一公钥创建多个钱包时记录最后一个
+    mapping(bytes32 => address) public walletsByKey;
+
     /// @notice 创建新钱包
     /// @param x 公钥 X 坐标
     /// @param y 公钥 Y 坐标
@@ -183,9 +739,25 @@ contract PasskeyWalletFactory {
         PasskeyWallet newWallet = new PasskeyWallet(x, y);
         wallet = address(newWallet);
         wallets[msg.sender] = wallet;
+        walletsByKey[keccak256(abi.encodePacked(x, y))] = wallet;
         emit WalletCreated(wallet, x, y);
     }
 
+    /// @notice 批量创建钱包（迁移已有用户），不写入 wallets 映射
+    /// @param xs 公钥 X 坐标列表
+    /// @param ys 公钥 Y 坐标列表
+    /// @return created 新钱包地址，与输入顺序一致
+    function createWallets(bytes32[] calldata xs, bytes32[] calldata ys) external returns (address[] memory created) {
+        require(xs.length == ys.length, "Length mismatch");
+        created = new address[](xs.length);
+        for (uint256 i = 0; i < xs.length; i++) {
+            PasskeyWallet newWallet = new PasskeyWallet(xs[i], ys[i]);
+            created[i] = address(newWallet);
+            walletsByKey[keccak256(abi.encodePacked(xs[i], ys[i]))] = created[i];
+            emit WalletCreated(created[i], xs[i], ys[i]);
+        }
+    }
+
     /// @notice 使用 CREATE2 创建钱包（可预测地址）
     /// @param x 公钥 X 坐标
     /// @param y 公钥 Y 坐标
@@ -199,9 +771,18 @@ contract PasskeyWalletFactory {
         PasskeyWallet newWallet = new PasskeyWallet{salt: salt}(x, y);
         wallet = address(newWallet);
         wallets[msg.sender] = wallet;
+        walletsByKey[keccak256(abi.encodePacked(x, y))] = wallet;
         emit WalletCreated(wallet, x, y);
     }
 
+    /// @notice 按公钥查询钱包地址
+    /// @param x 公钥 X 坐标
+    /// @param y 公钥 Y 坐标
+    /// @return 钱包地址，未创建时为零地址
+    function getWallet(bytes32 x, bytes32 y) external view returns (address) {
+        return walletsByKey[keccak256(abi.encodePacked(x, y))];
+    }
+
     /// @notice 计算 CREATE2 钱包地址
     /// @param x 公钥 X 坐标
     /// @param y 公钥 Y 坐标
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.24;
+
+interface IERC20Permit {
+    function permit(address owner, address spender, uint256 value, uint256 deadline, uint8 v, bytes32 r, bytes32 s) external;
+}
+
+/// @title PermitTransfer - 凭 EIP-2612 permit 签名在一笔交易内完成授权与转账
+/// @notice 代币持有人离线签名 permit (spender 为本合约)，中继调用 permitAndTransfer，
+///         持有人不需要先发送 approve 交易，也不需要持有 ETH
+contract PermitTransfer {
+    address public owner;
+
+    /// @notice 允许调用 permitAndTransfer 的中继账户
+    mapping(address => bool) public isRelayer;
+
+    event RelayerUpdated(address indexed relayer, bool allowed);
+    event PermitTransferred(address indexed token, address indexed from, address indexed to, uint256 value);
+
+    constructor() {
+        owner = msg.sender;
+        isRelayer[msg.sender] = true;
+        emit RelayerUpdated(msg.sender, true);
+    }
+
+    /// @notice 授权 / 撤销中继账户 (中继池的每个账户都需要授权)
+    function setRelayer(address relayer, bool allowed) external {
+        require(msg.sender == owner, "Not owner");
+        isRelayer[relayer] = allowed;
+        emit RelayerUpdated(relayer, allowed);
+    }
+
+    /// @notice 执行 permit 后立即 transferFrom(from, to, value)
+    /// @dev 只允许中继调用: permit 签名在交易池中公开，任何人都能调用时抢跑者可以把 to 换成自己的地址。
+    ///      permit 被抢先单独提交时 nonce 已使用，只要额度已经生效仍继续转账。
+    function permitAndTransfer(
+        address token,
+        address from,
+        address to,
+        uint256 value,
+        uint256 deadline,
+        uint8 v,
+        bytes32 r,
+        bytes32 s
+    ) external {
+        require(isRelayer[msg.sender], "Not relayer");
+
+        try IERC20Permit(token).permit(from, address(this), value, deadline, v, r, s) {} catch {
+            (bool ok, bytes memory res) = token.staticcall(
+                abi.encodeWithSignature("allowance(address,address)", from, address(this))
+            );
+            require(ok && res.length == 32 && abi.decode(res, (uint256)) >= value, "Permit failed");
+        }
+
+        (bool success, bytes memory result) = token.call(
+            abi.encodeWithSignature("transferFrom(address,address,uint256)", from, to, value)
+        );
+        require(success && (result.length == 0 || abi.decode(result, (bool))), "TransferFrom failed");
+
+        emit PermitTransferred(token, from, to, value);
+    }
+}
@@ -12,6 +12,12 @@ contract TestToken {
     mapping(address => uint256) public balanceOf;
     mapping(address => mapping(address => uint256)) public allowance;
 
+    /// @notice EIP-2612: permit 签名的 nonce 与 EIP-712 域
+    mapping(address => uint256) public nonces;
+    bytes32 public immutable DOMAIN_SEPARATOR;
+    bytes32 public constant PERMIT_TYPEHASH =
+        keccak256("Permit(address owner,address spender,uint256 value,uint256 nonce,uint256 deadline)");
+
     event Transfer(address indexed from, address indexed to, uint256 value);
     event Approval(address indexed owner, address indexed spender, uint256 value);
 
@@ -19,6 +25,20 @@ contract TestToken {
         totalSupply = initialSupply * 10 ** decimals;
         balanceOf[msg.sender] = totalSupply;
         emit Transfer(address(0), msg.sender, totalSupply);
+        DOMAIN_SEPARATOR = keccak256(
+            abi.encode(
+                keccak256("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"),
+                keccak256(bytes(name)),
+                keccak256(bytes("1")),
+                block.chainid,
+                address(this)
+            )
+        );
+    }
+
+    /// @notice 版本号 (EIP-712 域的 version)
+    function version() external pure returns (string memory) {
+        return "1";
     }
 
     function transfer(address to, uint256 amount) external returns (bool) {
@@ -40,6 +60,30 @@ contract TestToken {
         return _transfer(from, to, amount);
     }
 
+    /// @notice EIP-2612 离线签名授权，持有人无需发送 approve 交易
+    function permit(
+        address owner,
+        address spender,
+        uint256 value,
+        uint256 deadline,
+        uint8 v,
+        bytes32 r,
+        bytes32 s
+    ) external {
+        require(block.timestamp <= deadline, "Permit expired");
+        bytes32 digest = keccak256(
+            abi.encodePacked(
+                "\x19\x01",
+                DOMAIN_SEPARATOR,
+                keccak256(abi.encode(PERMIT_TYPEHASH, owner, spender, value, nonces[owner]++, deadline))
+            )
+        );
+        address signer = ecrecover(digest, v, r, s);
+        require(signer != address(0) && signer == owner, "Invalid permit");
+        allowance[owner][spender] = value;
+        emit Approval(owner, spender, value);
+    }
+
     function _transfer(address from, address to, uint256 amount) internal returns (bool) {
         require(from != address(0), "Transfer from zero address");
         require(to != address(0), "Transfer to zero address");
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// PasskeyWallet 存储布局 (见 contract/PasskeyWallet.sol)
+var (
+	walletSlotPublicKeyX = common.BigToHash(common.Big0)
+	walletSlotPublicKeyY = common.BigToHash(common.Big1)
+	walletSlotNonce      = common.BigToHash(common.Big2)
+)
+
+// stateOverrides eth_call / eth_estimateGas 的状态覆盖参数
+type stateOverrides = map[common.Address]ethereum.OverrideAccount
+
+// walletRuntimeCode 返回 PasskeyWallet 的 runtime bytecode
+//
+// 合约没有 immutable 变量，所有钱包的 runtime code 相同，
+// 从 wallet_template 或此前见过的任一已部署钱包复制即可。
+func (srv *Server) walletRuntimeCode(ctx context.Context) ([]byte, error) {
+	srv.mu.RLock()
+	code := srv.walletCode
+	srv.mu.RUnlock()
+	if len(code) > 0 {
+		return code, nil
+	}
+
+	template := srv.Config().WalletTemplate
+	if !common.IsHexAddress(template) {
+		return nil, fmt.Errorf("未配置 wallet_template，无法预演未部署的钱包")
+	}
+	code, err := srv.eth().CodeAt(ctx, common.HexToAddress(template), nil)
+	if err != nil {
+		return nil, fmt.Errorf("读取模板钱包代码失败: %v", err)
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("wallet_template %s 未部署", template)
+	}
+	srv.rememberWalletCode(code)
+	return code, nil
+}
+
+// rememberWalletCode 缓存钱包 runtime code
+func (srv *Server) rememberWalletCode(code []byte) {
+	srv.mu.Lock()
+	if len(srv.walletCode) == 0 {
+		srv.walletCode = code
+	}
+	srv.mu.Unlock()
+}
+
+// walletOverrides 钱包尚未部署时，构造注入钱包代码与公钥的状态覆盖
+// 钱包已部署时返回 nil (直接使用链上状态)
+func (srv *Server) walletOverrides(ctx context.Context, wallet common.Address, data *PasskeyData) (*stateOverrides, error) {
+	code, err := srv.eth().CodeAt(ctx, wallet, nil)
+	if err != nil {
+		return nil, fmt.Errorf("查询钱包代码失败: %v", err)
+	}
+	if len(code) > 0 {
+		srv.rememberWalletCode(code)
+		return nil, nil
+	}
+
+	if strings.TrimPrefix(data.PublicKey.X, "0x") == "" || strings.TrimPrefix(data.PublicKey.Y, "0x") == "" {
+		return nil, fmt.Errorf("钱包未部署，预演需要提供 publicKey")
+	}
+	runtime, err := srv.walletRuntimeCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := stateOverrides{
+		wallet: {
+			Code: runtime,
+			State: map[common.Hash]common.Hash{
+				walletSlotPublicKeyX: hexToBytes32(data.PublicKey.X),
+				walletSlotPublicKeyY: hexToBytes32(data.PublicKey.Y),
+				walletSlotNonce:      {},
+			},
+		},
+	}
+	return &overrides, nil
+}
+
+// callContractWithOverrides 带状态覆盖的 eth_call，overrides 为 nil 时等同 CallContract
+func (srv *Server) callContractWithOverrides(ctx context.Context, msg ethereum.CallMsg, overrides *stateOverrides) ([]byte, error) {
+	if overrides == nil {
+		return srv.eth().CallContract(ctx, msg, nil)
+	}
+
+	var result hexutil.Bytes
+	if err := srv.eth().Client().CallContext(ctx, &result, "eth_call", toCallArg(msg), "latest", overrides); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// estimateGasWithOverrides 带状态覆盖的 eth_estimateGas，overrides 为 nil 时等同 EstimateGas
+func (srv *Server) estimateGasWithOverrides(ctx context.Context, msg ethereum.CallMsg, overrides *stateOverrides) (uint64, error) {
+	if overrides == nil {
+		return srv.eth().EstimateGas(ctx, msg)
+	}
+
+	var gas hexutil.Uint64
+	if err := srv.eth().Client().CallContext(ctx, &gas, "eth_estimateGas", toCallArg(msg), "latest", overrides); err != nil {
+		return 0, err
+	}
+	return uint64(gas), nil
+}
+
+// toCallArg 将 CallMsg 编码为 JSON-RPC 调用参数 (与 ethclient 内部格式一致)
+func toCallArg(msg ethereum.CallMsg) map[string]interface{} {
+	arg := map[string]interface{}{
+		"from": msg.From,
+		"to":   msg.To,
+	}
+	if len(msg.Data) > 0 {
+		arg["input"] = hexutil.Bytes(msg.Data)
+	}
+	if msg.Value != nil {
+		arg["value"] = (*hexutil.Big)(msg.Value)
+	}
+	if msg.Gas != 0 {
+		arg["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	return arg
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// deadLetterTTL 死信保留时间
+const deadLetterTTL = 7 * 24 * time.Hour
+
+// DeadLetter 签名已验证但中继失败的转账 (nsDeadLetter，key = id)
+//
+// 广播失败多为节点或中继账户的临时问题 (余额不足、RPC 超时)，排除后运维可以用
+// 原请求重新提交，无需用户再签一次。
+type DeadLetter struct {
+	ID        string `json:"id"`
+	Time      int64  `json:"time"`
+	Source    string `json:"source"` // transfer / scheduled_transfer
+	RequestID string `json:"requestId,omitempty"`
+	Wallet    string `json:"wallet"`
+	Token     string `json:"token"`
+	To        string `json:"to"`
+	Amount    string `json:"amount"`
+	Error     string `json:"error"`
+	Attempts  int    `json:"attempts"` // 失败次数 (含首次)
+}
+
+// deadLetterRecord 存储中的死信，附带原始请求
+type deadLetterRecord struct {
+	DeadLetter
+	Request ERC20TransferRequest `json:"request"`
+}
+
+// deadLetter 记录一次中继失败
+func (srv *Server) deadLetter(source string, req *ERC20TransferRequest, err error) {
+	now := time.Now()
+	rec := deadLetterRecord{
+		DeadLetter: DeadLetter{
+			ID:        strconv.FormatInt(now.UnixNano(), 10),
+			Time:      now.Unix(),
+			Source:    source,
+			RequestID: req.requestID,
+			Wallet:    common.HexToAddress(req.Wallet).Hex(),
+			Token:     common.HexToAddress(req.Token).Hex(),
+			To:        common.HexToAddress(req.To).Hex(),
+			Amount:    req.Amount,
+			Error:     err.Error(),
+			Attempts:  1,
+		},
+		Request: *req,
+	}
+	if err := putJSON(srv.storage, nsDeadLetter, rec.ID, rec, deadLetterTTL); err != nil {
+		log.Printf("保存死信失败: %v", err)
+	}
+}
+
+// deadLetters 按时间顺序列出死信
+func (srv *Server) deadLetters() ([]DeadLetter, error) {
+	kvs, err := srv.storage.List(nsDeadLetter, "")
+	if err != nil {
+		return nil, err
+	}
+	list := []DeadLetter{}
+	for _, kv := range kvs {
+		var rec deadLetterRecord
+		if err := json.Unmarshal(kv.Value, &rec); err != nil {
+			continue
+		}
+		list = append(list, rec.DeadLetter)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Time < list[j].Time })
+	return list, nil
+}
+
+// resubmitDeadLetter 重新校验并中继死信，成功后删除；再次失败时更新错误与次数
+func (srv *Server) resubmitDeadLetter(id string) (common.Hash, error) {
+	srv.deadLetterMu.Lock()
+	defer srv.deadLetterMu.Unlock()
+
+	var rec deadLetterRecord
+	found, err := getJSON(srv.storage, nsDeadLetter, id, &rec)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if !found {
+		return common.Hash{}, fmt.Errorf("未找到死信: %s", id)
+	}
+
+	req := rec.Request
+	req.requestID = rec.RequestID
+	var txHash common.Hash
+	err = srv.validateTransferRequest(&req)
+	if err == nil {
+		txHash, _, err = srv.sendERC20Transfer(&req)
+	}
+	srv.audit(rec.Source, &req, txHash, err)
+	if err != nil {
+		rec.Error = err.Error()
+		rec.Attempts++
+		if perr := putJSON(srv.storage, nsDeadLetter, id, rec, deadLetterTTL); perr != nil {
+			log.Printf("更新死信失败: %v", perr)
+		}
+		return common.Hash{}, err
+	}
+
+	srv.recordTransfer(&req, txHash)
+	srv.storage.Delete(nsDeadLetter, id)
+	return txHash, nil
+}
+
+// DeadLetterRequest /api/admin/deadletter 请求
+type DeadLetterRequest struct {
+	ID string `json:"id"`
+}
+
+// handleAdminDeadLetter 死信管理
+//
+//	GET    /api/admin/deadletter          列出死信
+//	POST   /api/admin/deadletter {"id"}   重新提交
+//	DELETE /api/admin/deadletter?id=...   丢弃
+func (srv *Server) handleAdminDeadLetter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		list, err := srv.deadLetters()
+		if err != nil {
+			sendError(w, "读取死信失败: "+err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Data:    list,
+		})
+
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req DeadLetterRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		if req.ID == "" {
+			sendError(w, "缺少参数: id")
+			return
+		}
+		if !srv.canRelayTransfer() {
+			sendError(w, "未配置私钥，无法发送交易")
+			return
+		}
+		txHash, err := srv.resubmitDeadLetter(req.ID)
+		if err != nil {
+			sendError(w, "重新提交失败: "+err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "已重新提交",
+			TxHash:  txHash.Hex(),
+		})
+
+	case "DELETE":
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			sendError(w, "缺少参数: id")
+			return
+		}
+		deleted, err := srv.storage.Delete(nsDeadLetter, id)
+		if err != nil {
+			sendError(w, "删除死信失败: "+err.Error())
+			return
+		}
+		if !deleted {
+			sendError(w, "未找到死信: "+id)
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "已丢弃",
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 本地开发模式 (-dev) 的默认值
+const (
+	devRPC = "http://127.0.0.1:8545"
+
+	devRelayerBalance = 10000 // 中继账户余额 (ETH)
+	devWalletBalance  = 10    // 新钱包余额 (ETH)
+	devWalletTokens   = 1000  // 新钱包的测试代币 (TEST)
+	devTokenSupply    = 1000000
+)
+
+// devFactoryArtifacts / devTokenArtifacts 编译产物的默认位置 (forge build / hardhat compile)
+var (
+	devFactoryArtifacts = []string{
+		"out/PasskeyWallet.sol/PasskeyWalletFactory.json",
+		"contract/out/PasskeyWallet.sol/PasskeyWalletFactory.json",
+		"artifacts/contract/PasskeyWallet.sol/PasskeyWalletFactory.json",
+	}
+	devTokenArtifacts = []string{
+		"out/TestToken.sol/TestToken.json",
+		"contract/out/TestToken.sol/TestToken.json",
+		"artifacts/contract/TestToken.sol/TestToken.json",
+	}
+)
+
+// TestToken.mint 任何人都可以调用
+const devTokenABI = `[
+	{"inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"name":"mint","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+// devChain -dev 模式下的本地链: 新创建的钱包自动获得测试 ETH 与测试代币
+type devChain struct {
+	client string         // web3_clientVersion
+	token  common.Address // 测试代币，零地址表示未部署
+}
+
+// detectDevNode 确认 url 是本地 anvil / hardhat 节点，返回 web3_clientVersion
+//
+// 测试网 / 主网节点不支持 hardhat_setBalance，也不应该自动部署合约，这里直接拒绝。
+func detectDevNode(url string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+	var version string
+	if err := client.CallContext(ctx, &version, "web3_clientVersion"); err != nil {
+		return "", fmt.Errorf("%s 无响应 (请先启动 anvil 或 npx hardhat node): %v", url, err)
+	}
+	lower := strings.ToLower(version)
+	if !strings.Contains(lower, "anvil") && !strings.Contains(lower, "hardhat") {
+		return "", fmt.Errorf("%s 不是本地开发节点 (%s)，-dev 只支持 anvil / hardhat", url, version)
+	}
+	return version, nil
+}
+
+// prepareDevConfig 在连接节点前调整 -dev 模式的配置: 默认连接本地节点，
+// 没有配置中继账户时生成一个临时私钥 (启动后由 setupDev 充值)
+func prepareDevConfig(cfg *Config) (*devChain, error) {
+	if cfg.RPC == "" {
+		cfg.RPC = devRPC
+	}
+	version, err := detectDevNode(cfg.RPC)
+	if err != nil {
+		return nil, err
+	}
+	// 本地节点不需要备用端点，也不应该回落到远程节点
+	cfg.RPCFallbacks = nil
+	cfg.ReadOnly = false
+	// 本地链重启后状态清空，未指定存储时不落盘，避免沿用上一条链的钱包登记
+	if cfg.Storage.Driver == "" {
+		cfg.Storage.Driver = "memory"
+	}
+
+	if cfg.PrivateKey == "" && cfg.Keystore == "" && (cfg.Signer.Type == "" || cfg.Signer.Type == signerTypeKey) && cfg.RelayerPool.HD.Mnemonic == "" {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		cfg.PrivateKey = hex.EncodeToString(crypto.FromECDSA(key))
+	}
+	return &devChain{client: version}, nil
+}
+
+// setBalance 通过 hardhat_setBalance 设置余额 (anvil 也支持)
+func (srv *Server) setBalance(ctx context.Context, addr common.Address, eth int64) error {
+	wei := new(big.Int).Mul(big.NewInt(eth), big.NewInt(1e18))
+	if err := srv.eth().Client().CallContext(ctx, nil, "hardhat_setBalance", addr, (*hexutil.Big)(wei)); err != nil {
+		return fmt.Errorf("hardhat_setBalance %s: %v", addr.Hex(), err)
+	}
+	return nil
+}
+
+// findArtifact 返回第一个存在的编译产物
+func findArtifact(paths []string) (*contractArtifact, string, error) {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		art, err := loadArtifact(path)
+		if err != nil {
+			return nil, path, fmt.Errorf("%s: %v", path, err)
+		}
+		return art, path, nil
+	}
+	return nil, "", os.ErrNotExist
+}
+
+// deployDev 部署合约并等待上链
+func (srv *Server) deployDev(art *contractArtifact, args ...interface{}) (common.Address, error) {
+	code := art.Bytecode
+	if len(args) > 0 {
+		packed, err := art.ABI.Pack("", args...)
+		if err != nil {
+			return common.Address{}, fmt.Errorf("编码构造参数失败: %v", err)
+		}
+		code = append(append([]byte{}, code...), packed...)
+	}
+	hash, addr, err := srv.deployContract(code)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if _, err := srv.waitReceipt(hash); err != nil {
+		return common.Address{}, err
+	}
+	return addr, nil
+}
+
+// setupDev 充值中继账户，按需部署工厂与测试代币，并开启新钱包自动充值
+//
+// artifact 为 -artifact 指定的工厂编译产物，留空时在 forge / hardhat 的默认输出目录中查找。
+func (srv *Server) setupDev(dev *devChain, artifact string) error {
+	ctx := context.Background()
+	for _, r := range srv.relayers.members {
+		if err := srv.setBalance(ctx, r.address(), devRelayerBalance); err != nil {
+			return err
+		}
+	}
+
+	cfg := srv.Config()
+	if cfg.Contract != "" {
+		code, err := srv.eth().CodeAt(ctx, common.HexToAddress(cfg.Contract), nil)
+		if err != nil {
+			return fmt.Errorf("读取工厂合约失败: %v", err)
+		}
+		if len(code) == 0 {
+			log.Printf("配置的工厂 %s 在本地链上没有代码，重新部署", cfg.Contract)
+			cfg.Contract = ""
+		}
+	}
+	if cfg.Contract == "" {
+		art, path, err := findArtifact(append([]string{artifact}, devFactoryArtifacts...))
+		if os.IsNotExist(err) {
+			return fmt.Errorf("未找到 PasskeyWalletFactory 编译产物，请先在 contract 目录执行 forge build，或用 -artifact 指定")
+		}
+		if err != nil {
+			return err
+		}
+		addr, err := srv.deployDev(art)
+		if err != nil {
+			return fmt.Errorf("部署工厂失败: %v", err)
+		}
+		log.Printf("已部署工厂 %s (%s)", addr.Hex(), path)
+		cfg.Contract = addr.Hex()
+	}
+
+	if art, path, err := findArtifact(devTokenArtifacts); err == nil {
+		supply := new(big.Int).Mul(big.NewInt(devTokenSupply), big.NewInt(1e18))
+		addr, err := srv.deployDev(art, supply)
+		if err != nil {
+			return fmt.Errorf("部署测试代币失败: %v", err)
+		}
+		log.Printf("已部署测试代币 %s (%s)", addr.Hex(), path)
+		dev.token = addr
+		cfg.TokenList.Tokens = append(cfg.TokenList.Tokens, TokenListEntry{Address: addr.Hex()})
+	} else if !os.IsNotExist(err) {
+		return err
+	} else {
+		log.Printf("未找到 TestToken 编译产物，新钱包只充值 ETH")
+	}
+
+	srv.SetConfig(&cfg)
+	srv.dev = dev
+	return nil
+}
+
+// fundDevWallet -dev 模式下给新钱包充值测试 ETH 与测试代币
+func (srv *Server) fundDevWallet(wallet common.Address) {
+	dev := srv.dev
+	if dev == nil {
+		return
+	}
+	if err := srv.setBalance(context.Background(), wallet, devWalletBalance); err != nil {
+		log.Printf("给钱包充值失败: %v", err)
+		return
+	}
+	if dev.token == (common.Address{}) {
+		return
+	}
+	tokenABI, _ := abi.JSON(strings.NewReader(devTokenABI))
+	amount := new(big.Int).Mul(big.NewInt(devWalletTokens), big.NewInt(1e18))
+	data, _ := tokenABI.Pack("mint", wallet, amount)
+	if _, err := srv.sendTransaction(dev.token, big.NewInt(0), data); err != nil {
+		log.Printf("给钱包 %s 发放测试代币失败: %v", wallet.Hex(), err)
+		return
+	}
+	log.Printf("已给钱包 %s 充值 %d ETH 与 %d TEST", wallet.Hex(), devWalletBalance, devWalletTokens)
+}
+
+// printDevInfo 打印可直接使用的地址
+func printDevInfo(srv *Server) {
+	cfg := srv.Config()
+	base := fmt.Sprintf("http://localhost:%d", cfg.Port)
+	fmt.Println()
+	fmt.Printf("开发模式: %s (链 ID %s)\n", srv.dev.client, srv.chainID)
+	fmt.Printf("  节点:     %s\n", cfg.RPC)
+	fmt.Printf("  工厂合约: %s\n", cfg.Contract)
+	if srv.dev.token != (common.Address{}) {
+		fmt.Printf("  测试代币: %s\n", srv.dev.token.Hex())
+	}
+	fmt.Printf("  Web 界面: %s\n", base)
+	fmt.Printf("  配置接口: %s/api/config\n", base)
+	fmt.Printf("  代币列表: %s/api/tokens\n", base)
+	fmt.Println()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 钱包操作摘要
+//
+// PasskeyWallet 的签名操作由合约按实际执行的参数与当前 nonce 重算摘要，要求 WebAuthn 断言的 challenge
+// 就是这个摘要 (见合约 _digest / _verifyWebAuthn)。/api/challenge 按同样的规则从将要发送的调用数据计算摘要，
+// 中继前再按提交的请求与钱包当前 nonce 重算核对: 签名只能用于这一次调用，钱包执行过其它操作后即失效。
+
+// walletSignedMethods 需要签名的钱包方法 (最后一个参数为 bytes signature)，按选择器索引
+var walletSignedMethods = func() map[[4]byte]abi.Method {
+	methods := make(map[[4]byte]abi.Method)
+	for _, raw := range []string{walletABI, walletFreezeABI, walletKeysABI, recoveryABI, walletScheduleABI} {
+		parsed, err := abi.JSON(strings.NewReader(raw))
+		if err != nil {
+			panic(fmt.Sprintf("解析 ABI 失败: %v", err))
+		}
+		for _, m := range parsed.Methods {
+			n := len(m.Inputs)
+			if m.IsConstant() || n == 0 || m.Inputs[n-1].Name != "signature" || m.Inputs[n-1].Type.T != abi.BytesTy {
+				continue
+			}
+			var id [4]byte
+			copy(id[:], m.ID)
+			methods[id] = m
+		}
+	}
+	return methods
+}()
+
+// walletTypeHash 方法的摘要类型标识: keccak256("PasskeyWallet.<方法>(<参数类型 参数名>...,uint256 nonce)")
+func walletTypeHash(m abi.Method) common.Hash {
+	params := make([]string, 0, len(m.Inputs))
+	for _, in := range m.Inputs[:len(m.Inputs)-1] {
+		params = append(params, in.Type.String()+" "+in.Name)
+	}
+	params = append(params, "uint256 nonce")
+	return crypto.Keccak256Hash([]byte("PasskeyWallet." + m.RawName + "(" + strings.Join(params, ",") + ")"))
+}
+
+// walletDigestParams 参与摘要的参数，与合约各方法传给 _digest 的 params 一致:
+// 静态参数依次编码，execute 的 data 取 keccak256，executeBatch 的三个数组合并取 keccak256(abi.encode(...))，
+// setGuardians 的守护人列表取 keccak256(abi.encode(...))
+func walletDigestParams(m abi.Method, args []interface{}) ([]byte, error) {
+	inputs := m.Inputs[:len(m.Inputs)-1]
+	args = args[:len(inputs)]
+	switch m.RawName {
+	case "execute":
+		head, err := inputs[:2].Pack(args[0], args[1])
+		if err != nil {
+			return nil, err
+		}
+		return append(head, crypto.Keccak256(args[2].([]byte))...), nil
+	case "executeBatch":
+		calls, err := inputs.Pack(args...)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(calls), nil
+	case "setGuardians":
+		guardians, err := inputs[:1].Pack(args[0])
+		if err != nil {
+			return nil, err
+		}
+		threshold, err := inputs[1:].Pack(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return append(crypto.Keccak256(guardians), threshold...), nil
+	}
+	for _, in := range inputs {
+		if in.Type.T == abi.BytesTy || in.Type.T == abi.SliceTy || in.Type.T == abi.StringTy {
+			return nil, fmt.Errorf("%s 的动态参数 %s 没有摘要规则", m.RawName, in.Name)
+		}
+	}
+	return inputs.Pack(args...)
+}
+
+// walletDigest keccak256(abi.encode(typeHash, chainId, wallet, params..., nonce))
+func walletDigest(chainID *big.Int, wallet common.Address, typeHash common.Hash, params []byte, nonce *big.Int) common.Hash {
+	return crypto.Keccak256Hash(
+		typeHash[:],
+		common.LeftPadBytes(chainID.Bytes(), 32),
+		common.LeftPadBytes(wallet[:], 32),
+		params,
+		common.LeftPadBytes(nonce.Bytes(), 32),
+	)
+}
+
+// walletCallDigest 从钱包调用数据计算操作摘要，末尾追加的追踪标记不影响解码
+func walletCallDigest(chainID *big.Int, wallet common.Address, callData []byte, nonce *big.Int) (common.Hash, error) {
+	if len(callData) < 4 {
+		return common.Hash{}, fmt.Errorf("调用数据过短")
+	}
+	var id [4]byte
+	copy(id[:], callData[:4])
+	m, ok := walletSignedMethods[id]
+	if !ok {
+		return common.Hash{}, fmt.Errorf("不是需要签名的钱包方法: %x", id)
+	}
+	args, err := m.Inputs.Unpack(callData[4:])
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("解码 %s 调用数据失败: %v", m.RawName, err)
+	}
+	params, err := walletDigestParams(m, args)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("编码 %s 摘要参数失败: %v", m.RawName, err)
+	}
+	return walletDigest(chainID, wallet, walletTypeHash(m), params, nonce), nil
+}
+
+// walletNonce 读取钱包合约的 nonce()，未部署的钱包为 0 (首个操作随部署一起执行)
+func (srv *Server) walletNonce(wallet common.Address) (*big.Int, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(walletABI))
+	data, _ := parsedABI.Pack("nonce")
+	out, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &wallet, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("读取钱包 nonce 失败: %v", err)
+	}
+	if len(out) != 32 {
+		code, err := srv.eth().CodeAt(context.Background(), wallet, nil)
+		if err != nil {
+			return nil, fmt.Errorf("查询钱包代码失败: %v", err)
+		}
+		if len(code) == 0 {
+			return new(big.Int), nil
+		}
+		return nil, fmt.Errorf("钱包 %s 不支持 nonce()", wallet.Hex())
+	}
+	return new(big.Int).SetBytes(out), nil
+}
+
+// callChallenge 按钱包当前 nonce 计算调用摘要，作为该调用的签名 challenge
+func (srv *Server) callChallenge(wallet common.Address, callData []byte) (common.Hash, *big.Int, error) {
+	nonce, err := srv.walletNonce(wallet)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	digest, err := walletCallDigest(srv.chainID, wallet, callData, nonce)
+	return digest, nonce, err
+}
+
+// checkCallDigest 签名的 challenge 必须是本次钱包调用的摘要；钱包 nonce 变化 (期间有其它操作) 后需重新获取
+//
+// target 不是钱包自身 (Safe 模块) 时签名由模块合约按其规则验证，没有链上调用 (callData 为 nil) 时
+// challenge 是随机签发的，两种情况都不做摘要核对。4337 账户经 UserOperation 中继的操作见 checkUserOpDigest。
+func (srv *Server) checkCallDigest(data *PasskeyData, wallet common.Address, operation string, target common.Address, callData []byte) error {
+	if target != wallet || callData == nil {
+		return nil
+	}
+	if userOpOperations[operation] && srv.walletTypeFor(wallet).Encoder == walletEncoderAA {
+		return srv.checkUserOpDigest(data, wallet, callData)
+	}
+	cd, _, err := parseClientData(data.WebAuthn.ClientDataJSON, "webauthn.get")
+	if err != nil {
+		return err
+	}
+	digest, nonce, err := srv.callChallenge(wallet, callData)
+	if err != nil {
+		return err
+	}
+	if strings.TrimRight(cd.Challenge, "=") != base64.RawURLEncoding.EncodeToString(digest[:]) {
+		return fmt.Errorf("签名的 challenge 与调用内容或钱包当前 nonce (%s) 不符，请重新获取 challenge", nonce)
+	}
+	return nil
+}
+
+// checkUserOpDigest 4337 账户的签名 challenge 是签发时准备的 UserOperation 的 userOpHash，合约 validateUserOp
+// 按同一哈希验证；这里核对该 UserOperation 属于本钱包，且其调用与提交的请求参数一致 (签名与追踪标记不参与比较)
+func (srv *Server) checkUserOpDigest(data *PasskeyData, wallet common.Address, callData []byte) error {
+	op, err := srv.preparedUserOp(data, false)
+	if err != nil {
+		return err
+	}
+	if op.Sender != wallet {
+		return fmt.Errorf("UserOperation 不属于钱包 %s", wallet.Hex())
+	}
+	prepared, err := walletCallDigest(srv.chainID, wallet, op.CallData, new(big.Int))
+	if err != nil {
+		return err
+	}
+	submitted, err := walletCallDigest(srv.chainID, wallet, callData, new(big.Int))
+	if err != nil {
+		return err
+	}
+	if prepared != submitted {
+		return fmt.Errorf("提交的请求与签名的 UserOperation 不符，请重新获取 challenge")
+	}
+	return nil
+}
+
+// authorizeWalletCall 核对签名覆盖本次钱包调用 (见 checkCallDigest)，再按 authorizeOperation 校验断言
+func (srv *Server) authorizeWalletCall(r *http.Request, data *PasskeyData, wallet common.Address, operation string, target common.Address, callData []byte) error {
+	if err := srv.checkCallDigest(data, wallet, operation, target, callData); err != nil {
+		srv.recordFailedVerification(wallet, err)
+		return err
+	}
+	return srv.authorizeOperation(r, data, wallet, operation)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 类型标识必须与合约中的 *_TYPEHASH 常量逐字一致
+func TestWalletTypeHashes(t *testing.T) {
+	want := map[string]string{
+		"transferERC20":   "PasskeyWallet.transferERC20(address token,address to,uint256 amount,uint256 nonce)",
+		"transferETH":     "PasskeyWallet.transferETH(address to,uint256 amount,uint256 nonce)",
+		"execute":         "PasskeyWallet.execute(address to,uint256 value,bytes data,uint256 nonce)",
+		"executeBatch":    "PasskeyWallet.executeBatch(address[] to,uint256[] values,bytes[] data,uint256 nonce)",
+		"addPublicKey":    "PasskeyWallet.addPublicKey(bytes32 x,bytes32 y,uint256 nonce)",
+		"removePublicKey": "PasskeyWallet.removePublicKey(bytes32 x,bytes32 y,uint256 nonce)",
+		"freeze":          "PasskeyWallet.freeze(uint256 nonce)",
+		"unfreeze":        "PasskeyWallet.unfreeze(uint256 nonce)",
+		"setGuardians":    "PasskeyWallet.setGuardians(address[] newGuardians,uint256 threshold,uint256 nonce)",
+		"cancelRecovery":  "PasskeyWallet.cancelRecovery(uint256 nonce)",
+		"addSchedule":     "PasskeyWallet.addSchedule(address sessionKey,address token,address to,uint256 amount,uint64 interval,uint32 maxRuns,uint64 validUntil,uint256 nonce)",
+	}
+	seen := map[string]bool{}
+	for _, m := range walletSignedMethods {
+		s, ok := want[m.RawName]
+		if !ok {
+			t.Errorf("%s 没有对应的合约类型标识", m.RawName)
+			continue
+		}
+		seen[m.RawName] = true
+		if got := walletTypeHash(m); got != crypto.Keccak256Hash([]byte(s)) {
+			t.Errorf("%s 类型标识不一致，期望 %s", m.RawName, s)
+		}
+	}
+	for name := range want {
+		if !seen[name] {
+			t.Errorf("ABI 中缺少需要签名的方法 %s", name)
+		}
+	}
+}
+
+// 摘要按合约 _digest 的规则从调用数据重算: 签名与末尾的追踪标记不参与，参数或 nonce 变化则摘要不同
+func TestWalletCallDigest(t *testing.T) {
+	chainID := big.NewInt(11155111)
+	wallet := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	nonce := big.NewInt(7)
+	data := []byte{0xa9, 0x05, 0x9c, 0xbb, 0x01}
+
+	callData, err := encodeExecute(benchToken, benchAmount, data, benchSig, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := walletCallDigest(chainID, wallet, callData, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := crypto.Keccak256Hash(
+		crypto.Keccak256([]byte("PasskeyWallet.execute(address to,uint256 value,bytes data,uint256 nonce)")),
+		common.LeftPadBytes(chainID.Bytes(), 32),
+		common.LeftPadBytes(wallet[:], 32),
+		common.LeftPadBytes(benchToken[:], 32),
+		common.LeftPadBytes(benchAmount.Bytes(), 32),
+		crypto.Keccak256(data),
+		common.LeftPadBytes(nonce.Bytes(), 32),
+	)
+	if got != want {
+		t.Fatalf("execute 摘要 = %s, 期望 %s", got.Hex(), want.Hex())
+	}
+
+	unsigned, _ := encodeExecute(benchToken, benchAmount, data, webauthnSignature(&PasskeyData{}), 0)
+	traced := appendTraceTag(bytes.Clone(callData), "0123456789abcdef")
+	if len(traced) == len(callData) {
+		t.Fatal("追踪标记未追加")
+	}
+	for name, cd := range map[string][]byte{"未签名": unsigned, "追踪标记": traced} {
+		if d, err := walletCallDigest(chainID, wallet, cd, nonce); err != nil || d != want {
+			t.Errorf("%s的调用数据摘要 = %s (%v), 期望与签名后一致", name, d.Hex(), err)
+		}
+	}
+
+	other, _ := encodeExecute(benchToken, benchAmount, append(data, 0), benchSig, 0)
+	for name, d := range map[string]func() (common.Hash, error){
+		"data":    func() (common.Hash, error) { return walletCallDigest(chainID, wallet, other, nonce) },
+		"nonce":   func() (common.Hash, error) { return walletCallDigest(chainID, wallet, callData, big.NewInt(8)) },
+		"wallet":  func() (common.Hash, error) { return walletCallDigest(chainID, benchTo, callData, nonce) },
+		"chainId": func() (common.Hash, error) { return walletCallDigest(big.NewInt(1), wallet, callData, nonce) },
+	} {
+		if h, err := d(); err != nil || h == want {
+			t.Errorf("%s 变化后摘要应当不同 (%v)", name, err)
+		}
+	}
+
+	// 各方法都能从调用数据计算摘要
+	guardians := GuardiansRequest{Guardians: []string{benchTo.Hex()}, Threshold: 1}
+	setGuardians, err := guardians.call()
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeze, _ := walletFreezeCall("freeze", &PasskeyData{})
+	addKey, _ := walletKeyCall("addPublicKey", PublicKeyHex{X: "0x01", Y: "0x02"}, &PasskeyData{})
+	transfer, _ := encodeTransferERC20(benchToken, benchTo, benchAmount, benchSig, 0)
+	eth, _ := encodeTransferETH(benchTo, benchAmount, benchSig, 0)
+	schedule := ScheduleRequest{SessionKey: benchTo.Hex(), Interval: 86400, MaxRuns: 12}
+	schedule.Token, schedule.To, schedule.Amount = benchToken.Hex(), benchTo.Hex(), benchAmount.String()
+	addSchedule, err := schedule.call()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digests := map[common.Hash]string{want: "execute"}
+	for name, cd := range map[string][]byte{"setGuardians": setGuardians, "freeze": freeze, "addPublicKey": addKey, "transferERC20": transfer, "transferETH": eth, "addSchedule": addSchedule} {
+		d, err := walletCallDigest(chainID, wallet, cd, nonce)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if prev, dup := digests[d]; dup {
+			t.Errorf("%s 与 %s 的摘要相同", name, prev)
+		}
+		digests[d] = name
+	}
+
+	erc20 := mustParseABI(t, erc20ABI)
+	plain, _ := erc20.Pack("transfer", benchTo, benchAmount)
+	if _, err := walletCallDigest(chainID, wallet, plain, nonce); err == nil {
+		t.Error("不需要签名的方法应当报错")
+	}
+}
+
+// 会话密钥对每次执行的签名按合约 executeScheduled 的规则恢复出会话密钥地址，执行次数不同则签名不能复用
+func TestScheduleRunDigest(t *testing.T) {
+	chainID := big.NewInt(11155111)
+	wallet := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	key, _ := crypto.GenerateKey()
+	sessionKey := crypto.PubkeyToAddress(key.PublicKey)
+
+	digest := scheduleRunDigest(chainID, wallet, sessionKey, 3)
+	want := crypto.Keccak256Hash(
+		crypto.Keccak256([]byte("PasskeyWallet.executeScheduled(address sessionKey,uint256 run)")),
+		common.LeftPadBytes(chainID.Bytes(), 32),
+		common.LeftPadBytes(wallet[:], 32),
+		common.LeftPadBytes(sessionKey[:], 32),
+		common.LeftPadBytes([]byte{3}, 32),
+	)
+	if digest != want {
+		t.Fatalf("执行摘要 = %s, 期望 %s", digest.Hex(), want.Hex())
+	}
+	if scheduleRunDigest(chainID, wallet, sessionKey, 4) == digest {
+		t.Fatal("执行次数变化后摘要应当不同")
+	}
+
+	sig, err := crypto.Sign(accounts.TextHash(digest[:]), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(digest[:]), sig)
+	if err != nil || crypto.PubkeyToAddress(*pub) != sessionKey {
+		t.Fatalf("签名恢复的地址与会话密钥不符 (%v)", err)
+	}
+
+	// 会话密钥不能用于无界的周期任务
+	unbounded := ScheduleRequest{SessionKey: sessionKey.Hex(), Interval: 60}
+	unbounded.Token, unbounded.To, unbounded.Amount = benchToken.Hex(), benchTo.Hex(), "1"
+	if _, err := unbounded.call(); err == nil {
+		t.Error("没有 maxRuns / validUntil 的周期任务应当报错")
+	}
+}
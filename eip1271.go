@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// eip1271MagicValue isValidSignature(bytes32,bytes) 的函数选择器，签名有效时原样返回
+var eip1271MagicValue = [4]byte{0x16, 0x26, 0xba, 0x7e}
+
+// Verify1271Request EIP-1271 验证请求
+// signature 为钱包合约约定的编码，PasskeyWallet 为 abi.encode(r, s)
+type Verify1271Request struct {
+	Wallet    string `json:"wallet"`
+	Hash      string `json:"hash"`
+	Signature string `json:"signature"`
+}
+
+// Verify1271Data EIP-1271 验证结果
+type Verify1271Data struct {
+	Wallet     string `json:"wallet"`
+	MagicValue string `json:"magicValue"`
+	Valid      bool   `json:"valid"`
+}
+
+// isValidSignatureCall 调用钱包合约的 isValidSignature，返回合约给出的 bytes4
+func (srv *Server) isValidSignatureCall(wallet common.Address, hash [32]byte, signature []byte) ([4]byte, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(walletABI))
+	callData, err := parsedABI.Pack("isValidSignature", hash, signature)
+	if err != nil {
+		return [4]byte{}, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+
+	result, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{
+		To:   &wallet,
+		Data: callData,
+	}, nil)
+	if err != nil {
+		return [4]byte{}, fmt.Errorf("调用合约失败: %v", err)
+	}
+	if len(result) == 0 {
+		return [4]byte{}, fmt.Errorf("钱包未部署或不支持 EIP-1271")
+	}
+
+	var magic [4]byte
+	if err := parsedABI.UnpackIntoInterface(&magic, "isValidSignature", result); err != nil {
+		return [4]byte{}, fmt.Errorf("解析结果失败: %v", err)
+	}
+	return magic, nil
+}
+
+// handleVerify1271 以 EIP-1271 标准方式验证钱包签名
+func (srv *Server) handleVerify1271(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+
+	var req Verify1271Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+
+	if !common.IsHexAddress(req.Wallet) {
+		sendError(w, "wallet 地址格式错误")
+		return
+	}
+	hashBytes, err := hexutil.Decode(req.Hash)
+	if err != nil || len(hashBytes) != 32 {
+		sendError(w, "hash 必须是 32 字节十六进制")
+		return
+	}
+	signature, err := hexutil.Decode(req.Signature)
+	if err != nil {
+		sendError(w, "signature 格式错误: "+err.Error())
+		return
+	}
+
+	wallet := common.HexToAddress(req.Wallet)
+	magic, err := srv.isValidSignatureCall(wallet, common.BytesToHash(hashBytes), signature)
+	if err != nil {
+		sendError(w, "验证签名失败: "+err.Error())
+		return
+	}
+
+	valid := magic == eip1271MagicValue
+	message := "签名有效"
+	if !valid {
+		message = "签名无效"
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Message: message,
+		Valid:   &valid,
+		Data: Verify1271Data{
+			Wallet:     wallet.Hex(),
+			MagicValue: hexutil.Encode(magic[:]),
+			Valid:      valid,
+		},
+	})
+}
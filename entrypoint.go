@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// EntryPoint v0.7 ABI (getNonce、balanceOf、handleOps、UserOperationEvent)
+const entryPointABI = `[
+	{
+		"inputs": [{"name": "account", "type": "address"}],
+		"name": "balanceOf",
+		"outputs": [{"type": "uint256"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "sender", "type": "address"},
+			{"name": "key", "type": "uint192"}
+		],
+		"name": "getNonce",
+		"outputs": [{"name": "nonce", "type": "uint256"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{
+				"name": "ops",
+				"type": "tuple[]",
+				"components": [
+					{"name": "sender", "type": "address"},
+					{"name": "nonce", "type": "uint256"},
+					{"name": "initCode", "type": "bytes"},
+					{"name": "callData", "type": "bytes"},
+					{"name": "accountGasLimits", "type": "bytes32"},
+					{"name": "preVerificationGas", "type": "uint256"},
+					{"name": "gasFees", "type": "bytes32"},
+					{"name": "paymasterAndData", "type": "bytes"},
+					{"name": "signature", "type": "bytes"}
+				]
+			},
+			{"name": "beneficiary", "type": "address"}
+		],
+		"name": "handleOps",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"anonymous": false,
+		"inputs": [
+			{"indexed": true, "name": "userOpHash", "type": "bytes32"},
+			{"indexed": true, "name": "sender", "type": "address"},
+			{"indexed": true, "name": "paymaster", "type": "address"},
+			{"indexed": false, "name": "nonce", "type": "uint256"},
+			{"indexed": false, "name": "success", "type": "bool"},
+			{"indexed": false, "name": "actualGasCost", "type": "uint256"},
+			{"indexed": false, "name": "actualGasUsed", "type": "uint256"}
+		],
+		"name": "UserOperationEvent",
+		"type": "event"
+	}
+]`
+
+// 自建 bundler 的 gas 默认值
+const (
+	defaultVerificationGasLimit = 150000 // validateUserOp: P256VERIFY 预编译 + abi.decode
+	userOpCallGasBuffer         = 10000  // callGasLimit 在 eth_estimateGas 基础上的余量
+	userOpFixedOverhead         = 21000  // 单个 op 在 handleOps 中分摊的固定开销
+)
+
+// packedUserOp 与 EntryPoint v0.7 PackedUserOperation 对应的 ABI 结构
+type packedUserOp struct {
+	Sender             common.Address
+	Nonce              *big.Int
+	InitCode           []byte
+	CallData           []byte
+	AccountGasLimits   [32]byte
+	PreVerificationGas *big.Int
+	GasFees            [32]byte
+	PaymasterAndData   []byte
+	Signature          []byte
+}
+
+// packUint128Pair 将两个 uint128 拼接为 bytes32 (高 16 字节为 hi)
+func packUint128Pair(hi, lo *big.Int) [32]byte {
+	var out [32]byte
+	hi.FillBytes(out[:16])
+	lo.FillBytes(out[16:])
+	return out
+}
+
+// pack 转换为链上打包格式
+// accountGasLimits = verificationGasLimit ‖ callGasLimit
+// gasFees          = maxPriorityFeePerGas ‖ maxFeePerGas
+func (op *UserOperation) pack() packedUserOp {
+	var initCode []byte
+	if op.Factory != nil {
+		initCode = append(op.Factory.Bytes(), op.FactoryData...)
+	}
+	var paymasterAndData []byte
+	if op.Paymaster != nil {
+		paymasterAndData = append(paymasterAndData, op.Paymaster.Bytes()...)
+		gasLimits := packUint128Pair(op.PaymasterVerificationGasLimit, op.PaymasterPostOpGasLimit)
+		paymasterAndData = append(paymasterAndData, gasLimits[:]...)
+		paymasterAndData = append(paymasterAndData, op.PaymasterData...)
+	}
+
+	return packedUserOp{
+		Sender:             op.Sender,
+		Nonce:              op.Nonce,
+		InitCode:           initCode,
+		CallData:           op.CallData,
+		AccountGasLimits:   packUint128Pair(op.VerificationGasLimit, op.CallGasLimit),
+		PreVerificationGas: op.PreVerificationGas,
+		GasFees:            packUint128Pair(op.MaxPriorityFeePerGas, op.MaxFeePerGas),
+		PaymasterAndData:   paymasterAndData,
+		Signature:          op.Signature,
+	}
+}
+
+// userOpHash 计算 v0.7 userOpHash
+// keccak256(abi.encode(keccak256(packUserOp(op)), entryPoint, chainId))
+func userOpHash(op *UserOperation, entryPoint common.Address, chainID *big.Int) common.Hash {
+	p := op.pack()
+
+	bytes32Ty, _ := abi.NewType("bytes32", "", nil)
+	addressTy, _ := abi.NewType("address", "", nil)
+	uint256Ty, _ := abi.NewType("uint256", "", nil)
+
+	inner, _ := abi.Arguments{
+		{Type: addressTy}, {Type: uint256Ty}, {Type: bytes32Ty}, {Type: bytes32Ty},
+		{Type: bytes32Ty}, {Type: uint256Ty}, {Type: bytes32Ty}, {Type: bytes32Ty},
+	}.Pack(
+		p.Sender, p.Nonce, crypto.Keccak256Hash(p.InitCode), crypto.Keccak256Hash(p.CallData),
+		p.AccountGasLimits, p.PreVerificationGas, p.GasFees, crypto.Keccak256Hash(p.PaymasterAndData),
+	)
+
+	outer, _ := abi.Arguments{
+		{Type: bytes32Ty}, {Type: addressTy}, {Type: uint256Ty},
+	}.Pack(crypto.Keccak256Hash(inner), entryPoint, chainID)
+
+	return crypto.Keccak256Hash(outer)
+}
+
+// calldataGas 按 EIP-2028 计算 calldata gas (非零字节 16，零字节 4)
+func calldataGas(data []byte) uint64 {
+	var gas uint64
+	for _, b := range data {
+		if b == 0 {
+			gas += 4
+		} else {
+			gas += 16
+		}
+	}
+	return gas
+}
+
+// fillUserOpGas 自建 bundler 时本地计算 gas 字段
+func (srv *Server) fillUserOpGas(op *UserOperation) error {
+	if srv.signer() == nil {
+		return fmt.Errorf("自建 bundler 需要配置中继私钥")
+	}
+	ep := srv.entryPointAddress()
+	callGas, err := srv.eth().EstimateGas(context.Background(), ethereum.CallMsg{
+		From: ep,
+		To:   &op.Sender,
+		Data: op.CallData,
+	})
+	if err != nil {
+		return fmt.Errorf("估算 callGasLimit 失败: %v", err)
+	}
+	op.CallGasLimit = new(big.Int).SetUint64(callGas + userOpCallGasBuffer)
+	op.VerificationGasLimit = srv.verificationGasLimit()
+
+	parsedABI, _ := abi.JSON(strings.NewReader(entryPointABI))
+	encoded, err := parsedABI.Pack("handleOps", []packedUserOp{op.pack()}, common.Address{})
+	if err != nil {
+		return fmt.Errorf("编码 handleOps 失败: %v", err)
+	}
+	op.PreVerificationGas = new(big.Int).SetUint64(userOpFixedOverhead + calldataGas(encoded))
+	return nil
+}
+
+// UserOpStatus 自建 bundler 提交的 UserOperation 状态
+type UserOpStatus struct {
+	UserOpHash    string `json:"userOpHash"`
+	TxHash        string `json:"txHash"`
+	State         string `json:"state"` // pending / included / failed
+	Success       bool   `json:"success"`
+	ActualGasCost string `json:"actualGasCost,omitempty"`
+	ActualGasUsed string `json:"actualGasUsed,omitempty"`
+	BlockNumber   uint64 `json:"blockNumber,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// userOpTracker 跟踪自建 bundler 提交的 op
+type userOpTracker struct {
+	mu  sync.RWMutex
+	ops map[common.Hash]*UserOpStatus
+}
+
+func newUserOpTracker() *userOpTracker {
+	return &userOpTracker{ops: make(map[common.Hash]*UserOpStatus)}
+}
+
+func (t *userOpTracker) get(hash common.Hash) (UserOpStatus, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	st, ok := t.ops[hash]
+	if !ok {
+		return UserOpStatus{}, false
+	}
+	return *st, true
+}
+
+func (t *userOpTracker) update(hash common.Hash, fn func(*UserOpStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.ops[hash]
+	if !ok {
+		st = &UserOpStatus{UserOpHash: hash.Hex()}
+		t.ops[hash] = st
+	}
+	fn(st)
+}
+
+// sendUserOpSelfBundled 未配置外部 bundler 时，由中继账户直接调用 EntryPoint.handleOps
+// 调用前 op 的 gas 字段需已由 fillUserOpGas 填充
+func (srv *Server) sendUserOpSelfBundled(op *UserOperation) (common.Hash, error) {
+	s := srv.signer()
+	if s == nil {
+		return common.Hash{}, fmt.Errorf("自建 bundler 需要配置中继私钥")
+	}
+
+	ep := srv.entryPointAddress()
+	beneficiary := s.Address()
+	parsedABI, _ := abi.JSON(strings.NewReader(entryPointABI))
+	callData, err := parsedABI.Pack("handleOps", []packedUserOp{op.pack()}, beneficiary)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("编码 handleOps 失败: %v", err)
+	}
+
+	opHash := userOpHash(op, ep, srv.chainID)
+	txHash, err := srv.sendTransaction(ep, big.NewInt(0), callData)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	srv.userOps.update(opHash, func(st *UserOpStatus) {
+		st.TxHash = txHash.Hex()
+		st.State = "pending"
+	})
+	go srv.trackUserOpInclusion(opHash, txHash)
+	return opHash, nil
+}
+
+// trackUserOpInclusion 轮询交易回执并解析 UserOperationEvent
+func (srv *Server) trackUserOpInclusion(opHash, txHash common.Hash) {
+	parsedABI, _ := abi.JSON(strings.NewReader(entryPointABI))
+	event := parsedABI.Events["UserOperationEvent"]
+
+	deadline := time.Now().Add(10 * time.Minute)
+	for time.Now().Before(deadline) {
+		time.Sleep(5 * time.Second)
+
+		receipt, err := srv.eth().TransactionReceipt(context.Background(), txHash)
+		if err != nil {
+			continue // 尚未上链
+		}
+
+		srv.userOps.update(opHash, func(st *UserOpStatus) {
+			st.BlockNumber = receipt.BlockNumber.Uint64()
+			st.State = "failed"
+			st.Error = "handleOps 交易中未找到 UserOperationEvent"
+			for _, l := range receipt.Logs {
+				if len(l.Topics) < 2 || l.Topics[0] != event.ID || l.Topics[1] != opHash {
+					continue
+				}
+				var data struct {
+					Nonce         *big.Int
+					Success       bool
+					ActualGasCost *big.Int
+					ActualGasUsed *big.Int
+				}
+				if err := parsedABI.UnpackIntoInterface(&data, "UserOperationEvent", l.Data); err != nil {
+					st.Error = "解析 UserOperationEvent 失败: " + err.Error()
+					return
+				}
+				st.State = "included"
+				st.Success = data.Success
+				st.ActualGasCost = data.ActualGasCost.String()
+				st.ActualGasUsed = data.ActualGasUsed.String()
+				st.Error = ""
+			}
+		})
+		return
+	}
+
+	srv.userOps.update(opHash, func(st *UserOpStatus) {
+		st.Error = "等待上链超时"
+	})
+	log.Printf("UserOperation %s 等待上链超时 (tx %s)", opHash.Hex(), txHash.Hex())
+}
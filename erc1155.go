@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ERC-1155 转账请求的限制
+const (
+	maxERC1155Batch = 100  // 单次请求最多 ID 数
+	maxERC1155Data  = 1024 // data 最大字节数
+)
+
+// ERC-1155 ABI (转账与批量余额查询)
+const erc1155ABI = `[
+	{
+		"inputs": [
+			{"name": "from", "type": "address"},
+			{"name": "to", "type": "address"},
+			{"name": "id", "type": "uint256"},
+			{"name": "value", "type": "uint256"},
+			{"name": "data", "type": "bytes"}
+		],
+		"name": "safeTransferFrom",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "from", "type": "address"},
+			{"name": "to", "type": "address"},
+			{"name": "ids", "type": "uint256[]"},
+			{"name": "values", "type": "uint256[]"},
+			{"name": "data", "type": "bytes"}
+		],
+		"name": "safeBatchTransferFrom",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "accounts", "type": "address[]"},
+			{"name": "ids", "type": "uint256[]"}
+		],
+		"name": "balanceOfBatch",
+		"outputs": [{"type": "uint256[]"}],
+		"stateMutability": "view",
+		"type": "function"
+	}
+]`
+
+// ERC1155TransferRequest ERC-1155 转账请求 (签名 transfer challenge)
+//
+// 一个 ID 时调用 safeTransferFrom，多个 ID 时调用 safeBatchTransferFrom，经钱包的 execute 执行。
+type ERC1155TransferRequest struct {
+	PasskeyData
+	Wallet  string   `json:"wallet"`         // 用户的 PasskeyWallet 合约地址
+	Token   string   `json:"token"`          // ERC-1155 合约地址
+	To      string   `json:"to"`             // 接收地址
+	IDs     []string `json:"ids"`            // 代币 ID (十进制)
+	Amounts []string `json:"amounts"`        // 与 ids 一一对应的数量 (十进制)
+	Data    string   `json:"data,omitempty"` // 原样传给接收合约 onERC1155Received 的数据 (0x 十六进制)
+
+	MaxGasPrice string `json:"maxGasPrice,omitempty"` // 可选: 本次转账接受的最高 gas price (wei)
+
+	requestID string
+}
+
+// erc1155Transfer 解析后的 ERC-1155 转账参数
+type erc1155Transfer struct {
+	ids     []*big.Int
+	amounts []*big.Int
+	data    []byte
+}
+
+// parse 解析并校验 ids / amounts / data
+func (req *ERC1155TransferRequest) parse() (*erc1155Transfer, error) {
+	if len(req.IDs) == 0 || len(req.IDs) != len(req.Amounts) {
+		return nil, fmt.Errorf("ids 与 amounts 不能为空且长度必须相同 (%d / %d)", len(req.IDs), len(req.Amounts))
+	}
+	if len(req.IDs) > maxERC1155Batch {
+		return nil, fmt.Errorf("一次最多转账 %d 个 ID", maxERC1155Batch)
+	}
+	t := &erc1155Transfer{}
+	for i := range req.IDs {
+		id, ok := new(big.Int).SetString(req.IDs[i], 10)
+		if !ok || id.Sign() < 0 || id.BitLen() > 256 {
+			return nil, fmt.Errorf("ids[%d] 格式错误: %s", i, req.IDs[i])
+		}
+		amount, ok := new(big.Int).SetString(req.Amounts[i], 10)
+		if !ok || amount.Sign() <= 0 || amount.BitLen() > 256 {
+			return nil, fmt.Errorf("amounts[%d] 格式错误: %s", i, req.Amounts[i])
+		}
+		t.ids = append(t.ids, id)
+		t.amounts = append(t.amounts, amount)
+	}
+	t.data = []byte{}
+	if req.Data != "" {
+		data, err := hexutil.Decode(req.Data)
+		if err != nil {
+			return nil, fmt.Errorf("data 格式错误 (需要 0x 开头的十六进制): %v", err)
+		}
+		if len(data) > maxERC1155Data {
+			return nil, fmt.Errorf("data 过长: 最多 %d 字节", maxERC1155Data)
+		}
+		t.data = data
+	}
+	return t, nil
+}
+
+// asTransfer 转换为转账请求，复用合规筛查、费用检查与审计 (amount 记为 "id:数量" 列表)
+func (req *ERC1155TransferRequest) asTransfer() *ERC20TransferRequest {
+	pairs := make([]string, len(req.IDs))
+	for i := range req.IDs {
+		amount := ""
+		if i < len(req.Amounts) {
+			amount = req.Amounts[i]
+		}
+		pairs[i] = req.IDs[i] + ":" + amount
+	}
+	return &ERC20TransferRequest{
+		PasskeyData: req.PasskeyData,
+		Wallet:      req.Wallet,
+		Token:       req.Token,
+		To:          req.To,
+		Amount:      strings.Join(pairs, ","),
+		MaxGasPrice: req.MaxGasPrice,
+		requestID:   req.requestID,
+	}
+}
+
+// validateERC1155TransferRequest 校验 ERC-1155 转账请求，并要求钱包持有足够的数量
+func (srv *Server) validateERC1155TransferRequest(req *ERC1155TransferRequest) (*erc1155Transfer, error) {
+	if req.Wallet == "" || req.Token == "" || req.To == "" {
+		return nil, fmt.Errorf("缺少必要参数: wallet, token, to, ids, amounts")
+	}
+	for name, addr := range map[string]string{"wallet": req.Wallet, "token": req.Token, "to": req.To} {
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("%s 地址格式错误: %s", name, addr)
+		}
+	}
+	wallet := common.HexToAddress(req.Wallet)
+	if srv.walletFrozen(wallet) {
+		return nil, fmt.Errorf("钱包已冻结，解除冻结前不能转账")
+	}
+	t, err := req.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	transfer := req.asTransfer()
+	if err := srv.screenTransfer(transfer); err != nil {
+		return nil, err
+	}
+	if err := srv.checkERC1155Balances(common.HexToAddress(req.Token), wallet, t); err != nil {
+		return nil, err
+	}
+	return t, srv.checkTransferFees(transfer)
+}
+
+// checkERC1155Balances 按 balanceOfBatch 检查钱包余额 (同一 ID 出现多次时合计)，不足时提前拒绝
+func (srv *Server) checkERC1155Balances(token, wallet common.Address, t *erc1155Transfer) error {
+	needed := make(map[string]*big.Int)
+	var ids []*big.Int
+	for i, id := range t.ids {
+		key := id.String()
+		if needed[key] == nil {
+			needed[key] = new(big.Int)
+			ids = append(ids, id)
+		}
+		needed[key].Add(needed[key], t.amounts[i])
+	}
+	accounts := make([]common.Address, len(ids))
+	for i := range accounts {
+		accounts[i] = wallet
+	}
+
+	parsedABI, _ := abi.JSON(strings.NewReader(erc1155ABI))
+	callData, _ := parsedABI.Pack("balanceOfBatch", accounts, ids)
+	out, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &token, Data: callData}, nil)
+	if err != nil {
+		return fmt.Errorf("查询 ERC-1155 余额失败: %v", err)
+	}
+	var balances []*big.Int
+	if err := parsedABI.UnpackIntoInterface(&balances, "balanceOfBatch", out); err != nil || len(balances) != len(ids) {
+		return fmt.Errorf("查询 ERC-1155 余额失败: %s 不是 ERC-1155 合约", token.Hex())
+	}
+	for i, id := range ids {
+		if want := needed[id.String()]; balances[i].Cmp(want) < 0 {
+			return fmt.Errorf("ID %s 余额不足: 持有 %s，转账 %s", id, balances[i], want)
+		}
+	}
+	return nil
+}
+
+// erc1155CallData 编码 safeTransferFrom / safeBatchTransferFrom (from 为钱包自身)
+func erc1155CallData(wallet, to common.Address, t *erc1155Transfer) ([]byte, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(erc1155ABI))
+	if len(t.ids) == 1 {
+		return parsedABI.Pack("safeTransferFrom", wallet, to, t.ids[0], t.amounts[0], t.data)
+	}
+	return parsedABI.Pack("safeBatchTransferFrom", wallet, to, t.ids, t.amounts, t.data)
+}
+
+// walletERC1155Call 按钱包类型编码 ERC-1155 转账调用，返回交易目标与调用数据
+func (srv *Server) walletERC1155Call(wt *WalletTypeConfig, req *ERC1155TransferRequest, t *erc1155Transfer) (common.Address, []byte, error) {
+	wallet := common.HexToAddress(req.Wallet)
+	inner, err := erc1155CallData(wallet, common.HexToAddress(req.To), t)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	return srv.walletExecuteCall(wt, wallet, common.HexToAddress(req.Token), big.NewInt(0), inner, &req.PasskeyData, req.requestID)
+}
+
+// sendERC1155Transfer 发送 ERC-1155 转账，提交方式同 sendERC20Transfer
+func (srv *Server) sendERC1155Transfer(req *ERC1155TransferRequest, t *erc1155Transfer) (common.Hash, *BatchInfo, error) {
+	wallet := common.HexToAddress(req.Wallet)
+	wt := srv.walletTypeFor(wallet)
+	target, callData, err := srv.walletERC1155Call(wt, req, t)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	return srv.sendWalletCall(wallet, wt, target, callData, &req.PasskeyData)
+}
+
+// signERC1155Transfer 签名 ERC-1155 转账交易但不广播 (broadcast=false)
+func (srv *Server) signERC1155Transfer(req *ERC1155TransferRequest, t *erc1155Transfer) (*types.Transaction, error) {
+	wt := srv.walletTypeFor(common.HexToAddress(req.Wallet))
+	if wt.Encoder == walletEncoderAA {
+		return nil, fmt.Errorf("4337 账户不支持 broadcast=false")
+	}
+	target, callData, err := srv.walletERC1155Call(wt, req, t)
+	if err != nil {
+		return nil, err
+	}
+	return srv.signWalletCall(target, callData)
+}
+
+// recordERC1155Transfer 每个 ID 记录一条历史 (数量没有精度)
+func (srv *Server) recordERC1155Transfer(req *ERC1155TransferRequest, txHash common.Hash) {
+	for i := range req.IDs {
+		srv.addHistory(HistoryRecord{
+			Type:      "transfer_1155",
+			Wallet:    common.HexToAddress(req.Wallet).Hex(),
+			Token:     common.HexToAddress(req.Token).Hex(),
+			TokenID:   req.IDs[i],
+			To:        common.HexToAddress(req.To).Hex(),
+			Amount:    req.Amounts[i],
+			Formatted: req.Amounts[i],
+			TxHash:    txHash.Hex(),
+		})
+	}
+}
+
+// handleTransferERC1155 中继钱包的 ERC-1155 转账，流程与 /api/transfer 相同
+func (srv *Server) handleTransferERC1155(w http.ResponseWriter, r *http.Request) {
+	if !srv.canRelayTransfer() {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req ERC1155TransferRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	req.requestID = requestIDFrom(r)
+	transfer := req.asTransfer()
+
+	t, err := srv.validateERC1155TransferRequest(&req)
+	if err != nil {
+		srv.audit(auditTransfer1155, transfer, common.Hash{}, err)
+		sendError(w, err.Error())
+		return
+	}
+
+	wallet := common.HexToAddress(req.Wallet)
+	target, callData, err := srv.walletERC1155Call(srv.walletTypeFor(wallet), &req, t)
+	if err != nil {
+		srv.audit(auditTransfer1155, transfer, common.Hash{}, err)
+		sendError(w, err.Error())
+		return
+	}
+	if err := srv.authorizeWalletCall(r, &req.PasskeyData, wallet, opTransfer1155, target, callData); err != nil {
+		srv.audit(auditTransfer1155, transfer, common.Hash{}, err)
+		sendVerificationError(w, err)
+		return
+	}
+
+	if !broadcastRequested(r) {
+		signedTx, err := srv.signERC1155Transfer(&req, t)
+		if err != nil {
+			srv.audit(auditTransfer1155, transfer, common.Hash{}, err)
+			sendError(w, "签名转账交易失败: "+err.Error())
+			return
+		}
+		srv.audit(auditTransfer1155, transfer, signedTx.Hash(), nil)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success:     true,
+			Message:     "交易已签名，未广播",
+			TxHash:      signedTx.Hash().Hex(),
+			SNormalized: req.Signature.Normalized(),
+			Data:        srv.rawTxData(signedTx),
+		})
+		return
+	}
+
+	srv.indexer.track(wallet)
+	txHash, batch, err := srv.sendERC1155Transfer(&req, t)
+	srv.audit(auditTransfer1155, transfer, txHash, err)
+	if err != nil {
+		sendError(w, "ERC-1155 转账失败: "+err.Error())
+		return
+	}
+	srv.recordERC1155Transfer(&req, txHash)
+
+	message := "ERC-1155 转账交易已发送"
+	if srv.walletTypeFor(wallet).Encoder == walletEncoderAA {
+		message = "ERC-1155 转账 UserOperation 已提交 (txHash 为 userOpHash)"
+	}
+	resp := APIResponse{
+		Success:     true,
+		Message:     message,
+		TxHash:      txHash.Hex(),
+		SNormalized: req.Signature.Normalized(),
+		Warnings:    srv.recipientWarnings(wallet, common.HexToAddress(req.To)),
+	}
+	if batch != nil {
+		resp.Data = batch
+	}
+	srv.awaitTransfer(r, &resp, txHash, batch, "ERC-1155 转账")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// nativeToken 原生 ETH 在审计日志、历史记录与按代币配置的项 (min_transfer.tokens、
+// price_oracle.feeds) 中使用零地址表示
+var nativeToken = common.Address{}
+
+// ETHTransferRequest 原生 ETH 转账请求 (签名 transfer challenge)
+type ETHTransferRequest struct {
+	PasskeyData
+	Wallet string `json:"wallet"` // 用户的 PasskeyWallet 合约地址
+	To     string `json:"to"`     // 接收地址
+	Amount string `json:"amount"` // 转账金额 (wei)，从钱包余额中扣除
+
+	MaxGasPrice string `json:"maxGasPrice,omitempty"` // 可选: 本次转账接受的最高 gas price (wei)
+
+	requestID string
+}
+
+// asTransfer 转换为以零地址为代币的转账请求，复用合规筛查、费用检查与审计
+func (req *ETHTransferRequest) asTransfer() *ERC20TransferRequest {
+	return &ERC20TransferRequest{
+		PasskeyData: req.PasskeyData,
+		Wallet:      req.Wallet,
+		Token:       nativeToken.Hex(),
+		To:          req.To,
+		Amount:      req.Amount,
+		MaxGasPrice: req.MaxGasPrice,
+		requestID:   req.requestID,
+	}
+}
+
+// validateETHTransferRequest 校验 ETH 转账请求参数，并要求钱包余额足够
+func (srv *Server) validateETHTransferRequest(req *ETHTransferRequest) error {
+	if req.Wallet == "" || req.To == "" || req.Amount == "" {
+		return fmt.Errorf("缺少必要参数: wallet, to, amount")
+	}
+	for name, addr := range map[string]string{"wallet": req.Wallet, "to": req.To} {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("%s 地址格式错误: %s", name, addr)
+		}
+	}
+	wallet := common.HexToAddress(req.Wallet)
+	if srv.walletFrozen(wallet) {
+		return fmt.Errorf("钱包已冻结，解除冻结前不能转账")
+	}
+
+	amount, ok := new(big.Int).SetString(req.Amount, 10)
+	if !ok || amount.Sign() <= 0 {
+		return fmt.Errorf("金额格式错误: %s", req.Amount)
+	}
+
+	transfer := req.asTransfer()
+	if err := srv.screenTransfer(transfer); err != nil {
+		return err
+	}
+
+	minAmount, err := srv.Config().MinTransfer.minTransferFor(nativeToken)
+	if err != nil {
+		return err
+	}
+	if minAmount != nil && amount.Cmp(minAmount) < 0 {
+		callData, _ := encodeTransferETH(common.HexToAddress(req.To), amount, webauthnSignature(&req.PasskeyData), 0)
+		gasCost := srv.estimateWalletCallCost(wallet, callData, &req.PasskeyData)
+		return fmt.Errorf("转账金额 %s 低于最小值 %s (预估 gas 费用 %s wei，gas/金额比 %s)",
+			amount, minAmount, gasCost, gasToValueRatio(gasCost, amount))
+	}
+
+	// 转出的 ETH 来自钱包余额，中继账户只支付 gas；余额不足时链上必然回滚，提前拒绝 (不消耗签名)
+	balance, err := srv.eth().BalanceAt(context.Background(), wallet, nil)
+	if err != nil {
+		return fmt.Errorf("查询钱包余额失败: %v", err)
+	}
+	if balance.Cmp(amount) < 0 {
+		return fmt.Errorf("钱包 ETH 余额不足: 余额 %s wei，转账 %s wei", balance, amount)
+	}
+	return srv.checkTransferFees(transfer)
+}
+
+// walletETHCall 按钱包类型编码 ETH 转账调用，返回交易目标与调用数据
+func (srv *Server) walletETHCall(wt *WalletTypeConfig, req *ETHTransferRequest) (common.Address, []byte, error) {
+	wallet := common.HexToAddress(req.Wallet)
+	to := common.HexToAddress(req.To)
+	amount, ok := new(big.Int).SetString(req.Amount, 10)
+	if !ok {
+		return common.Address{}, nil, fmt.Errorf("金额格式错误")
+	}
+	if wt.Encoder == walletEncoderSafe {
+		// Safe 模块: execTransaction(safe, to, amount, "", hash, r, s)
+		parsedABI, _ := abi.JSON(strings.NewReader(safePasskeyModuleABI))
+		callData, err := parsedABI.Pack("execTransaction", wallet, to, amount, []byte{},
+			hexToBytes32(req.WebAuthn.MessageHash), hexToBytes32(req.Signature.R), hexToBytes32(req.Signature.S))
+		if err != nil {
+			return common.Address{}, nil, fmt.Errorf("编码调用数据失败: %v", err)
+		}
+		return common.HexToAddress(wt.Module), callData, nil
+	}
+
+	cfg := srv.Config()
+	extra := 0
+	if cfg.TraceCalldata {
+		extra = len(traceTagMagic) + traceIDBytes
+	}
+	// PasskeyWallet.transferETH(to, amount, signature)
+	callData, err := encodeTransferETH(to, amount, webauthnSignature(&req.PasskeyData), extra)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	if cfg.TraceCalldata {
+		callData = appendTraceTag(callData, req.requestID)
+	}
+	return wallet, callData, nil
+}
+
+// sendETHTransfer 发送 ETH 转账，提交方式同 sendERC20Transfer
+//
+// 中继交易的 value 始终为 0: 转出的 ETH 由钱包合约从自身余额支付，gas 按中继账户调用
+// 钱包 (from = 中继账户，to = 钱包) 估算，包含钱包向收款方转账 (及收款合约 receive) 的开销。
+func (srv *Server) sendETHTransfer(req *ETHTransferRequest) (common.Hash, *BatchInfo, error) {
+	wallet := common.HexToAddress(req.Wallet)
+	wt := srv.walletTypeFor(wallet)
+	target, callData, err := srv.walletETHCall(wt, req)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	return srv.sendWalletCall(wallet, wt, target, callData, &req.PasskeyData)
+}
+
+// signETHTransfer 签名 ETH 转账交易但不广播 (broadcast=false)
+func (srv *Server) signETHTransfer(req *ETHTransferRequest) (*types.Transaction, error) {
+	wt := srv.walletTypeFor(common.HexToAddress(req.Wallet))
+	if wt.Encoder == walletEncoderAA {
+		return nil, fmt.Errorf("4337 账户不支持 broadcast=false")
+	}
+	target, callData, err := srv.walletETHCall(wt, req)
+	if err != nil {
+		return nil, err
+	}
+	return srv.signWalletCall(target, callData)
+}
+
+// recordETHTransfer 记录一次 ETH 转账中继 (代币为零地址，精度 18)
+func (srv *Server) recordETHTransfer(req *ETHTransferRequest, txHash common.Hash) {
+	amount, _ := new(big.Int).SetString(req.Amount, 10)
+	precision, locale := srv.formatOptions("", "")
+	srv.addHistory(HistoryRecord{
+		Type:      "transfer_eth",
+		Wallet:    common.HexToAddress(req.Wallet).Hex(),
+		Token:     nativeToken.Hex(),
+		To:        common.HexToAddress(req.To).Hex(),
+		Amount:    req.Amount,
+		Formatted: formatAmount(amount, 18, precision, locale),
+		Decimals:  18,
+		Symbol:    "ETH",
+		TxHash:    txHash.Hex(),
+	})
+}
+
+// handleTransferETH 中继钱包的原生 ETH 转账，流程与 /api/transfer 相同
+func (srv *Server) handleTransferETH(w http.ResponseWriter, r *http.Request) {
+	if !srv.canRelayTransfer() {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req ETHTransferRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	req.requestID = requestIDFrom(r)
+	transfer := req.asTransfer()
+
+	if err := srv.validateETHTransferRequest(&req); err != nil {
+		srv.audit(auditTransferETH, transfer, common.Hash{}, err)
+		sendError(w, err.Error())
+		return
+	}
+
+	wallet := common.HexToAddress(req.Wallet)
+	target, callData, err := srv.walletETHCall(srv.walletTypeFor(wallet), &req)
+	if err != nil {
+		srv.audit(auditTransferETH, transfer, common.Hash{}, err)
+		sendError(w, err.Error())
+		return
+	}
+	if err := srv.authorizeWalletCall(r, &req.PasskeyData, wallet, opTransferETH, target, callData); err != nil {
+		srv.audit(auditTransferETH, transfer, common.Hash{}, err)
+		sendVerificationError(w, err)
+		return
+	}
+
+	if !broadcastRequested(r) {
+		signedTx, err := srv.signETHTransfer(&req)
+		if err != nil {
+			srv.audit(auditTransferETH, transfer, common.Hash{}, err)
+			sendError(w, "签名转账交易失败: "+err.Error())
+			return
+		}
+		srv.audit(auditTransferETH, transfer, signedTx.Hash(), nil)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success:     true,
+			Message:     "交易已签名，未广播",
+			TxHash:      signedTx.Hash().Hex(),
+			SNormalized: req.Signature.Normalized(),
+			Data:        srv.rawTxData(signedTx),
+		})
+		return
+	}
+
+	srv.indexer.track(wallet)
+	txHash, batch, err := srv.sendETHTransfer(&req)
+	srv.audit(auditTransferETH, transfer, txHash, err)
+	if err != nil {
+		// 死信按 ERC20 请求重新提交，ETH 转账失败由调用方重新签名重试
+		sendError(w, "ETH 转账失败: "+err.Error())
+		return
+	}
+	srv.recordETHTransfer(&req, txHash)
+
+	message := "ETH 转账交易已发送"
+	if srv.walletTypeFor(wallet).Encoder == walletEncoderAA {
+		message = "ETH 转账 UserOperation 已提交 (txHash 为 userOpHash)"
+	}
+	resp := APIResponse{
+		Success:     true,
+		Message:     message,
+		TxHash:      txHash.Hex(),
+		SNormalized: req.Signature.Normalized(),
+		Warnings:    srv.recipientWarnings(wallet, common.HexToAddress(req.To)),
+	}
+	if batch != nil {
+		resp.Data = batch
+	}
+	srv.awaitTransfer(r, &resp, txHash, batch, "ETH 转账")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// maxExecuteData 调用数据最大字节数
+const maxExecuteData = 16 * 1024
+
+// ExecuteConfig 通用合约调用 (/api/execute) 的目标合约白名单，未配置时禁用该接口
+//
+//	execute:
+//	  targets:
+//	    - address: "0xRouter..."
+//	      name: "swap router"
+//	      selectors: ["0x3593564c"]         # 允许的函数选择器，留空不限
+//	      max_value: "100000000000000000"   # 单次最多附带的 ETH (wei)，留空不允许附带
+type ExecuteConfig struct {
+	Targets []ExecuteTarget `yaml:"targets"`
+}
+
+// ExecuteTarget 允许钱包调用的合约
+type ExecuteTarget struct {
+	Address   string   `yaml:"address"`
+	Name      string   `yaml:"name"`
+	Selectors []string `yaml:"selectors"`
+	MaxValue  string   `yaml:"max_value"`
+}
+
+// target 查找白名单中的合约
+func (c ExecuteConfig) target(addr common.Address) (*ExecuteTarget, bool) {
+	for i := range c.Targets {
+		if common.IsHexAddress(c.Targets[i].Address) && common.HexToAddress(c.Targets[i].Address) == addr {
+			return &c.Targets[i], true
+		}
+	}
+	return nil, false
+}
+
+// allows 检查函数选择器与附带的 ETH 是否在白名单允许范围内
+func (t *ExecuteTarget) allows(value *big.Int, data []byte) error {
+	if len(t.Selectors) > 0 {
+		if len(data) < 4 {
+			return fmt.Errorf("目标合约 %s 只允许调用指定函数，data 不能为空", t.Address)
+		}
+		selector := hexutil.Encode(data[:4])
+		allowed := false
+		for _, s := range t.Selectors {
+			if strings.EqualFold(s, selector) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("目标合约 %s 不允许调用函数 %s", t.Address, selector)
+		}
+	}
+	if value.Sign() > 0 {
+		maxValue, ok := new(big.Int).SetString(t.MaxValue, 10)
+		if !ok {
+			return fmt.Errorf("目标合约 %s 不允许附带 ETH", t.Address)
+		}
+		if value.Cmp(maxValue) > 0 {
+			return fmt.Errorf("附带的 ETH %s wei 超过目标合约 %s 的上限 %s wei", value, t.Address, maxValue)
+		}
+	}
+	return nil
+}
+
+// ExecuteCall 钱包发起的合约调用
+type ExecuteCall struct {
+	To    string `json:"to"`              // 目标合约，需在 execute.targets 中
+	Value string `json:"value,omitempty"` // 附带的 ETH (wei)，默认 0
+	Data  string `json:"data,omitempty"`  // 调用数据 (0x 十六进制)
+}
+
+// executeCall 解析后的调用
+type executeCall struct {
+	to    common.Address
+	value *big.Int
+	data  []byte
+}
+
+// parse 解析并按白名单校验调用
+func (c *ExecuteCall) parse(cfg ExecuteConfig) (*executeCall, error) {
+	if len(cfg.Targets) == 0 {
+		return nil, fmt.Errorf("未配置 execute.targets，不支持通用合约调用")
+	}
+	if !common.IsHexAddress(c.To) {
+		return nil, fmt.Errorf("to 地址格式错误: %s", c.To)
+	}
+	call := &executeCall{to: common.HexToAddress(c.To), value: new(big.Int), data: []byte{}}
+	if c.Value != "" {
+		value, ok := new(big.Int).SetString(c.Value, 10)
+		if !ok || value.Sign() < 0 || value.BitLen() > 256 {
+			return nil, fmt.Errorf("value 格式错误: %s", c.Value)
+		}
+		call.value = value
+	}
+	if c.Data != "" {
+		data, err := hexutil.Decode(c.Data)
+		if err != nil {
+			return nil, fmt.Errorf("data 格式错误 (需要 0x 开头的十六进制): %v", err)
+		}
+		if len(data) > maxExecuteData {
+			return nil, fmt.Errorf("data 过长: 最多 %d 字节", maxExecuteData)
+		}
+		call.data = data
+	}
+
+	target, ok := cfg.target(call.to)
+	if !ok {
+		return nil, fmt.Errorf("目标合约 %s 不在 execute.targets 白名单中", call.to.Hex())
+	}
+	if err := target.allows(call.value, call.data); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// ExecuteRequest 通用合约调用请求 (签名 execute challenge)
+type ExecuteRequest struct {
+	PasskeyData
+	Wallet string `json:"wallet"` // 用户的 PasskeyWallet 合约地址
+	ExecuteCall
+
+	MaxGasPrice string `json:"maxGasPrice,omitempty"` // 可选: 本次调用接受的最高 gas price (wei)
+
+	requestID string
+}
+
+// asTransfer 转换为转账请求，复用合规筛查、费用检查与审计 (代币与对方均记为目标合约，金额为附带的 ETH)
+func (req *ExecuteRequest) asTransfer() *ERC20TransferRequest {
+	return &ERC20TransferRequest{
+		PasskeyData: req.PasskeyData,
+		Wallet:      req.Wallet,
+		Token:       req.To,
+		To:          req.To,
+		Amount:      req.Value,
+		MaxGasPrice: req.MaxGasPrice,
+		requestID:   req.requestID,
+	}
+}
+
+// validateExecuteRequest 校验调用请求 (白名单、合规筛查、附带 ETH 的余额与费用)
+func (srv *Server) validateExecuteRequest(req *ExecuteRequest) (*executeCall, error) {
+	if !common.IsHexAddress(req.Wallet) {
+		return nil, fmt.Errorf("wallet 地址格式错误: %s", req.Wallet)
+	}
+	wallet := common.HexToAddress(req.Wallet)
+	if srv.walletFrozen(wallet) {
+		return nil, fmt.Errorf("钱包已冻结，解除冻结前不能调用")
+	}
+	call, err := req.ExecuteCall.parse(srv.Config().Execute)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer := req.asTransfer()
+	if err := srv.screenTransfer(transfer); err != nil {
+		return nil, err
+	}
+	if call.value.Sign() > 0 {
+		balance, err := srv.eth().BalanceAt(context.Background(), wallet, nil)
+		if err != nil {
+			return nil, fmt.Errorf("查询钱包余额失败: %v", err)
+		}
+		if balance.Cmp(call.value) < 0 {
+			return nil, fmt.Errorf("钱包 ETH 余额不足: 余额 %s wei，附带 %s wei", balance, call.value)
+		}
+	}
+	return call, srv.checkTransferFees(transfer)
+}
+
+// recordExecute 记录一次合约调用 (代币为零地址，金额为附带的 ETH)
+func (srv *Server) recordExecute(req *ExecuteRequest, call *executeCall, txHash common.Hash) {
+	precision, locale := srv.formatOptions("", "")
+	srv.addHistory(HistoryRecord{
+		Type:      "execute",
+		Wallet:    common.HexToAddress(req.Wallet).Hex(),
+		Token:     nativeToken.Hex(),
+		To:        call.to.Hex(),
+		Amount:    call.value.String(),
+		Formatted: formatAmount(call.value, 18, precision, locale),
+		Decimals:  18,
+		Symbol:    "ETH",
+		TxHash:    txHash.Hex(),
+	})
+}
+
+// handleExecute 中继钱包对白名单合约的任意调用 (swap、质押、mint 等)
+//
+// 先以 {"wallet", "operation": "execute", "call": {to, value, data}} 获取 challenge (即调用摘要)，
+// 签名后提交 {"wallet", "to", "value", "data", ...Passkey 数据}。
+func (srv *Server) handleExecute(w http.ResponseWriter, r *http.Request) {
+	if !srv.canRelayTransfer() {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req ExecuteRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	req.requestID = requestIDFrom(r)
+	transfer := req.asTransfer()
+
+	call, err := srv.validateExecuteRequest(&req)
+	if err != nil {
+		srv.audit(auditExecute, transfer, common.Hash{}, err)
+		sendError(w, err.Error())
+		return
+	}
+
+	wallet := common.HexToAddress(req.Wallet)
+	wt := srv.walletTypeFor(wallet)
+	target, callData, err := srv.walletExecuteCall(wt, wallet, call.to, call.value, call.data, &req.PasskeyData, req.requestID)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	if err := srv.authorizeWalletCall(r, &req.PasskeyData, wallet, opExecute, target, callData); err != nil {
+		srv.audit(auditExecute, transfer, common.Hash{}, err)
+		sendVerificationError(w, err)
+		return
+	}
+
+	if !broadcastRequested(r) {
+		if wt.Encoder == walletEncoderAA {
+			sendError(w, "签名调用交易失败: 4337 账户不支持 broadcast=false")
+			return
+		}
+		signedTx, err := srv.signWalletCall(target, callData)
+		if err != nil {
+			srv.audit(auditExecute, transfer, common.Hash{}, err)
+			sendError(w, "签名调用交易失败: "+err.Error())
+			return
+		}
+		srv.audit(auditExecute, transfer, signedTx.Hash(), nil)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success:     true,
+			Message:     "交易已签名，未广播",
+			TxHash:      signedTx.Hash().Hex(),
+			SNormalized: req.Signature.Normalized(),
+			Data:        srv.rawTxData(signedTx),
+		})
+		return
+	}
+
+	srv.indexer.track(wallet)
+	txHash, batch, err := srv.sendWalletCall(wallet, wt, target, callData, &req.PasskeyData)
+	srv.audit(auditExecute, transfer, txHash, err)
+	if err != nil {
+		sendError(w, "合约调用失败: "+err.Error())
+		return
+	}
+	srv.recordExecute(&req, call, txHash)
+
+	message := "合约调用交易已发送"
+	if wt.Encoder == walletEncoderAA {
+		message = "合约调用 UserOperation 已提交 (txHash 为 userOpHash)"
+	}
+	resp := APIResponse{
+		Success:     true,
+		Message:     message,
+		TxHash:      txHash.Hex(),
+		SNormalized: req.Signature.Normalized(),
+	}
+	if batch != nil {
+		resp.Data = batch
+	}
+	srv.awaitTransfer(r, &resp, txHash, batch, "合约调用")
+	json.NewEncoder(w).Encode(resp)
+}
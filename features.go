@@ -0,0 +1,85 @@
+package main
+
+// Features /api/config 中的能力开关，前端与 SDK 据此调整流程，无需按版本判断
+type Features struct {
+	RelayMode    string `json:"relayMode"`    // 默认钱包类型的中继方式: eoa / 4337
+	UserOps      bool   `json:"userOps"`      // 有钱包类型以 ERC-4337 UserOperation 中继
+	Bundler      string `json:"bundler"`      // external (bundler_rpc) / self (自建) / none
+	Sponsorship  bool   `json:"sponsorship"`  // VerifyingPaymaster 代付 gas
+	P256Verifier string `json:"p256Verifier"` // 链上验证路径: precompile / fallback / none
+	Precompile   bool   `json:"precompile"`   // RIP-7212 / EIP-7951 预编译可用
+
+	Relay          bool `json:"relay"`          // 可中继交易 (已配置中继私钥且非只读)
+	RawTransaction bool `json:"rawTransaction"` // 中继接口支持 ?broadcast=false
+	Batching       bool `json:"batching"`       // 转账聚合已开启
+	OnChainMemo    bool `json:"onChainMemo"`    // 备注上链
+	TraceCalldata  bool `json:"traceCalldata"`  // calldata 附带请求追踪 ID
+	ETHTransfer    bool `json:"ethTransfer"`    // 原生 ETH 转账 (/api/transfer-eth)
+	ERC1155        bool `json:"erc1155"`        // ERC-1155 (批量) 转账 (/api/transfer-1155)
+	MultiTransfer  bool `json:"multiTransfer"`  // 批量转账 (/api/transfer-multi)
+	Execute        bool `json:"execute"`        // 白名单合约调用 (/api/execute)
+	Approve        bool `json:"approve"`        // ERC20 授权 (/api/approve)
+	Permit         bool `json:"permit"`         // EIP-2612 permit 转账 (/api/permit)
+
+	MultiDevice bool `json:"multiDevice"` // 一个钱包多把 Passkey
+	Login       bool `json:"login"`       // 可发现凭证无用户名登录
+	Freeze      bool `json:"freeze"`      // 紧急冻结
+	Recovery    bool `json:"recovery"`    // 社交恢复
+	Indexer     bool `json:"indexer"`     // 转入事件索引 (/api/events)
+
+	Attestation string `json:"attestation"` // 注册要求的 attestation 等级
+
+	MultiChain bool `json:"multiChain"` // 一个服务实例对接多条链
+	NFT        bool `json:"nft"`        // ERC-721 转账 (ERC-1155 见 erc1155)
+}
+
+// features 汇总当前配置与启动探测结果
+func (srv *Server) features() Features {
+	cfg := srv.Config()
+	p256 := srv.P256()
+
+	f := Features{
+		RelayMode:    cfg.RelayMode,
+		Bundler:      "none",
+		P256Verifier: p256.Verifier,
+		Precompile:   p256.Precompile,
+
+		Relay:          !cfg.ReadOnly && srv.canRelayTransfer(),
+		RawTransaction: !cfg.ReadOnly && srv.signer() != nil,
+		Batching:       cfg.Batch.WindowMs > 0,
+		OnChainMemo:    cfg.MemoOnChain,
+		TraceCalldata:  cfg.TraceCalldata,
+		ETHTransfer:    !cfg.ReadOnly && srv.canRelayTransfer(),
+		ERC1155:        !cfg.ReadOnly && srv.canRelayTransfer(),
+		MultiTransfer:  !cfg.ReadOnly && srv.canRelayTransfer(),
+		Execute:        !cfg.ReadOnly && srv.canRelayTransfer() && len(cfg.Execute.Targets) > 0,
+		Approve:        !cfg.ReadOnly && srv.canRelayTransfer(),
+		Permit:         !cfg.ReadOnly && srv.signer() != nil && cfg.PermitContract != "",
+
+		MultiDevice: !cfg.ReadOnly,
+		Login:       true,
+		Freeze:      !cfg.ReadOnly,
+		Recovery:    !cfg.ReadOnly,
+		Indexer:     cfg.Indexer.Enabled,
+
+		Attestation: cfg.WebAuthn.RequiredAttestation,
+
+		MultiChain: len(cfg.Chains) > 0,
+	}
+	if f.Attestation == "" {
+		f.Attestation = attestationLevelNone
+	}
+
+	f.UserOps = cfg.RelayMode == relayModeUserOp
+	for _, wt := range cfg.WalletTypes {
+		f.UserOps = f.UserOps || wt.Encoder == walletEncoderAA
+	}
+	if f.UserOps {
+		f.Bundler = "self"
+		if cfg.AA.BundlerRPC != "" {
+			f.Bundler = "external"
+		}
+		f.Sponsorship = cfg.Paymaster.Address != "" && cfg.Paymaster.SigningKey != ""
+	}
+	return f
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// FormatConfig 金额格式化配置
+type FormatConfig struct {
+	Precision int    `yaml:"precision"` // 小数位数，默认 4
+	Locale    string `yaml:"locale"`    // en / zh / de / fr，默认 en
+}
+
+// localeSeparators 各语言的千分位与小数点
+var localeSeparators = map[string][2]string{
+	"en": {",", "."},
+	"zh": {",", "."},
+	"de": {".", ","},
+	"fr": {" ", ","},
+}
+
+// formatAmount 将最小单位金额按精度和语言格式化为十进制字符串 (截断，不四舍五入)
+func formatAmount(amount *big.Int, decimals uint8, precision int, locale string) string {
+	if amount == nil {
+		return "0"
+	}
+	seps, ok := localeSeparators[locale]
+	if !ok {
+		seps = localeSeparators["en"]
+	}
+
+	neg := amount.Sign() < 0
+	abs := new(big.Int).Abs(amount)
+	div := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	intPart, fracPart := new(big.Int).QuoRem(abs, div, new(big.Int))
+
+	result := groupDigits(intPart.String(), seps[0])
+	if precision > 0 && decimals > 0 {
+		frac := fracPart.String()
+		frac = strings.Repeat("0", int(decimals)-len(frac)) + frac
+		if precision < len(frac) {
+			frac = frac[:precision]
+		}
+		frac = strings.TrimRight(frac, "0")
+		if frac != "" {
+			result += seps[1] + frac
+		}
+	}
+	if neg {
+		result = "-" + result
+	}
+	return result
+}
+
+// groupDigits 每三位插入千分位分隔符
+func groupDigits(digits, sep string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var b strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		b.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if b.Len() > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
+
+// formatOptions 返回请求的精度与语言 (?precision= / ?locale= 覆盖配置)
+func (srv *Server) formatOptions(precision, locale string) (int, string) {
+	cfg := srv.Config().Format
+	p := cfg.Precision
+	if p == 0 {
+		p = 4
+	}
+	if n, err := strconv.Atoi(precision); err == nil && n >= 0 && n <= 36 {
+		p = n
+	}
+	l := cfg.Locale
+	if locale != "" {
+		l = locale
+	}
+	if l == "" {
+		l = "en"
+	}
+	return p, l
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PasskeyWallet 冻结相关 ABI
+const walletFreezeABI = `[
+	{
+		"inputs": [
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "freeze",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "unfreeze",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "frozen",
+		"outputs": [{"type": "bool"}],
+		"stateMutability": "view",
+		"type": "function"
+	}
+]`
+
+// walletFreezeCall 编码钱包的 freeze / unfreeze 调用
+func walletFreezeCall(method string, data *PasskeyData) ([]byte, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(walletFreezeABI))
+	callData, err := parsedABI.Pack(method, webauthnSignature(data))
+	if err != nil {
+		return nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	return callData, nil
+}
+
+// FreezeStatusData GET /api/wallet/{addr}/freeze 返回数据
+type FreezeStatusData struct {
+	Wallet        string `json:"wallet"`
+	Frozen        bool   `json:"frozen"`                  // 服务端登记的状态，决定是否拒绝中继
+	FrozenAt      int64  `json:"frozenAt,omitempty"`      // 冻结时间
+	OnChainFrozen *bool  `json:"onChainFrozen,omitempty"` // 合约 frozen() (旧版钱包不支持时为空)
+}
+
+// walletFrozen 钱包是否已在服务端登记为冻结
+func (srv *Server) walletFrozen(wallet common.Address) bool {
+	var rec walletRecord
+	found, err := getJSON(srv.storage, nsWallets, wallet.Hex(), &rec)
+	return err == nil && found && rec.FrozenAt != 0
+}
+
+// setWalletFrozen 更新钱包登记中的冻结状态
+func (srv *Server) setWalletFrozen(wallet common.Address, frozen bool) error {
+	srv.walletRecordMu.Lock()
+	defer srv.walletRecordMu.Unlock()
+
+	rec, err := srv.loadWalletRecord(wallet)
+	if err != nil {
+		return err
+	}
+	rec.FrozenAt = 0
+	if frozen {
+		rec.FrozenAt = time.Now().Unix()
+	}
+	if err := putJSON(srv.storage, nsWallets, rec.Wallet, rec, 0); err != nil {
+		return fmt.Errorf("更新钱包登记失败: %v", err)
+	}
+	return nil
+}
+
+// onChainFrozen 读取合约的 frozen()
+func (srv *Server) onChainFrozen(wallet common.Address) (bool, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(walletFreezeABI))
+	data, _ := parsedABI.Pack("frozen")
+	out, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &wallet, Data: data}, nil)
+	if err != nil {
+		return false, fmt.Errorf("调用合约失败: %v", err)
+	}
+	result, err := parsedABI.Unpack("frozen", out)
+	if err != nil || len(result) == 0 {
+		return false, fmt.Errorf("解析结果失败: %v", err)
+	}
+	frozen, _ := result[0].(bool)
+	return frozen, nil
+}
+
+// confirmUnfreeze 等待解冻交易上链后才恢复中继，交易失败时保持冻结
+func (srv *Server) confirmUnfreeze(txHash common.Hash, wallet common.Address) {
+	if _, err := srv.waitReceipt(txHash); err != nil {
+		log.Printf("钱包 %s 解冻未生效: %v", wallet.Hex(), err)
+		return
+	}
+	if err := srv.setWalletFrozen(wallet, false); err != nil {
+		log.Printf("钱包 %s 解冻登记失败: %v", wallet.Hex(), err)
+	}
+}
+
+// handleWalletFreeze 紧急冻结 / 解冻钱包 (任一已授权 Passkey 签名 freeze / unfreeze challenge)
+//
+//	GET    /api/wallet/{addr}/freeze   冻结状态
+//	POST   /api/wallet/{addr}/freeze   冻结: 服务端立即拒绝该钱包的转账中继，并中继合约 freeze()
+//	DELETE /api/wallet/{addr}/freeze   解冻: 中继合约 unfreeze()，上链后恢复转账中继
+func (srv *Server) handleWalletFreeze(w http.ResponseWriter, r *http.Request) {
+	addr := r.PathValue("addr")
+	if !common.IsHexAddress(addr) {
+		sendError(w, "钱包地址格式错误: "+addr)
+		return
+	}
+	wallet := common.HexToAddress(addr)
+
+	if r.Method == "GET" {
+		rec, err := srv.loadWalletRecord(wallet)
+		if err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		data := FreezeStatusData{Wallet: wallet.Hex(), Frozen: rec.FrozenAt != 0, FrozenAt: rec.FrozenAt}
+		if frozen, err := srv.onChainFrozen(wallet); err == nil {
+			data.OnChainFrozen = &frozen
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Data:    data,
+		})
+		return
+	}
+
+	freeze := r.Method == "POST" // DELETE 为解冻
+	if srv.signer() == nil {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+	if srv.walletTypeFor(wallet).Encoder == walletEncoderSafe {
+		sendError(w, "该钱包类型不支持冻结")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var data PasskeyData
+	if err := json.Unmarshal(body, &data); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+
+	op, method := opUnfreeze, "unfreeze"
+	if freeze {
+		op, method = opFreeze, "freeze"
+	}
+	callData, err := walletFreezeCall(method, &data)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	// 签名经链上确认有效后才改动服务端状态，否则伪造的断言即可冻结任意钱包
+	if err := srv.authorizeWalletCall(r, &data, wallet, op, wallet, callData); err != nil {
+		sendVerificationError(w, err)
+		return
+	}
+
+	// 冻结在服务端立即生效，不等待上链
+	if freeze {
+		if err := srv.setWalletFrozen(wallet, true); err != nil {
+			sendError(w, "冻结失败: "+err.Error())
+			return
+		}
+	}
+
+	txHash, err := srv.sendTransaction(wallet, big.NewInt(0), callData)
+	if err != nil {
+		if freeze {
+			// 链上冻结失败时服务端仍保持冻结，需用 unfreeze 签名解除
+			sendError(w, "服务端已冻结，但链上冻结交易发送失败: "+err.Error())
+		} else {
+			sendError(w, "解冻失败: "+err.Error())
+		}
+		return
+	}
+
+	message := "钱包已冻结，服务端即刻拒绝转账中继，链上冻结交易已发送"
+	if !freeze {
+		go srv.confirmUnfreeze(txHash, wallet)
+		message = "解冻交易已发送，上链后恢复转账中继"
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success:     true,
+		Message:     message,
+		TxHash:      txHash.Hex(),
+		SNormalized: data.Signature.Normalized(),
+	})
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 这些解析器都直接处理未经认证的请求数据，fuzz 目标只要求不 panic，
+// 并在解析成功时检查结果满足解析器声明的约束。
+//
+//	go test -run '^$' -fuzz FuzzParseAttestationObject -fuzztime 1m
+
+func FuzzParseBytes32(f *testing.F) {
+	for _, s := range []string{"", "0x", "0x1", "0x" + string(bytes.Repeat([]byte("ab"), 32)), "0x" + string(bytes.Repeat([]byte("ab"), 33)), "zz", "0X00ff"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		b, err := parseBytes32(s)
+		if err != nil {
+			if hexToBytes32(s) != ([32]byte{}) {
+				t.Fatalf("格式错误时 hexToBytes32 应返回全零: %q", s)
+			}
+			return
+		}
+		if hexToBytes32(s) != b {
+			t.Fatalf("hexToBytes32 与 parseBytes32 不一致: %q", s)
+		}
+		// 合法输入的数值与 common.FromHex 一致
+		if new(big.Int).SetBytes(b[:]).Cmp(new(big.Int).SetBytes(common.FromHex(s))) != 0 {
+			t.Fatalf("数值不一致: %q", s)
+		}
+	})
+}
+
+func FuzzCBORDecode(f *testing.F) {
+	f.Add([]byte{0xa1, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e'})
+	f.Add([]byte{0x9f, 0xff})
+	f.Add([]byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	f.Add(bytes.Repeat([]byte{0x81}, 64))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, rest, err := cborDecode(data)
+		if err == nil && len(rest) > len(data) {
+			t.Fatalf("剩余字节比输入还长")
+		}
+	})
+}
+
+func FuzzParseCOSEKey(f *testing.F) {
+	f.Add(testCOSEKey(f))
+	f.Add([]byte{0xa0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pub, err := parseCOSEKey(data)
+		if err == nil && !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			t.Fatalf("返回的公钥不在曲线上")
+		}
+	})
+}
+
+func FuzzParseAttestationObject(f *testing.F) {
+	f.Add(testAttestationObject(f))
+	f.Add([]byte{0xa3})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		att, err := parseAttestationObject(data)
+		if err != nil {
+			return
+		}
+		if att.PublicKey == nil || att.Info == nil || !att.Info.Flags.Attested {
+			t.Fatalf("解析成功但缺少凭证数据")
+		}
+		if len(att.AAGUID) != 16 {
+			t.Fatalf("AAGUID 长度错误: %d", len(att.AAGUID))
+		}
+	})
+}
+
+func FuzzParseAuthenticatorData(f *testing.F) {
+	f.Add(make([]byte, authDataMinLength))
+	f.Add([]byte{0x01})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		info, err := parseAuthenticatorData(data)
+		if err == nil && len(data) < authDataMinLength {
+			t.Fatalf("过短的 authenticatorData 被接受")
+		}
+		if err == nil && info.Flags.UserPresent != (data[32]&authFlagUserPresent != 0) {
+			t.Fatalf("UP 标志位解析错误")
+		}
+		checkAuthenticatorData(data, "localhost", true)
+	})
+}
+
+func FuzzParseClientData(f *testing.F) {
+	challenge := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	cd, _ := json.Marshal(clientData{Type: "webauthn.get", Challenge: challenge, Origin: "https://localhost"})
+	f.Add(base64.RawURLEncoding.EncodeToString(cd), "webauthn.get")
+	f.Add("e30", "webauthn.create")
+	f.Add("!!", "")
+	f.Fuzz(func(t *testing.T, encoded, wantType string) {
+		got, raw, err := parseClientData(encoded, wantType)
+		if err != nil {
+			return
+		}
+		if got.Type != wantType || got.Origin == "" || got.CrossOrigin || len(raw) == 0 {
+			t.Fatalf("不满足约束的 clientDataJSON 被接受: %+v", got)
+		}
+	})
+}
+
+func FuzzParseDERSignature(f *testing.F) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	hash := sha256.Sum256([]byte("fuzz"))
+	der, _ := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	f.Add(der)
+	f.Add([]byte{0x30, 0x00})
+	f.Add(append(der, 0x00))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, s, err := parseDERSignature(data)
+		if err != nil {
+			return
+		}
+		n := elliptic.P256().Params().N
+		if r.Sign() <= 0 || r.Cmp(n) >= 0 || s.Sign() <= 0 || s.Cmp(n) >= 0 {
+			t.Fatalf("r/s 超出范围")
+		}
+		// 重新编码后应能再次解析为同一签名
+		again, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+		if err != nil {
+			t.Fatalf("重新编码失败: %v", err)
+		}
+		r2, s2, err := parseDERSignature(again)
+		if err != nil || r2.Cmp(r) != 0 || s2.Cmp(s) != 0 {
+			t.Fatalf("重新编码后解析结果不一致")
+		}
+	})
+}
+
+func FuzzTransferRequestJSON(f *testing.F) {
+	f.Add([]byte(`{"wallet":"0x1","token":"0x2","to":"0x3","amount":"1","signature":{"r":"0x01","s":"0x02"},"publicKey":{"x":"0x1","y":"0x2"}}`))
+	f.Add([]byte(`{"signature":{"der":"MAYCAQECAQE"}}`))
+	f.Add([]byte(`{"publicKey":{"cose":"0xa0"}}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var req ERC20TransferRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return
+		}
+		// 解码成功后签名必须是合法的 bytes32 且为 low-S
+		for _, v := range []string{req.Signature.R, req.Signature.S} {
+			if v == "" {
+				continue
+			}
+			if _, err := parseBytes32(v); err != nil {
+				t.Fatalf("解码后的签名不是 bytes32: %q", v)
+			}
+		}
+		if s := new(big.Int).SetBytes(common.FromHex(req.Signature.S)); s.Cmp(p256HalfN) > 0 && s.Cmp(elliptic.P256().Params().N) < 0 {
+			t.Fatalf("high-S 签名未规范化")
+		}
+		publicKeyFromHex(req.PublicKey)
+	})
+}
+
+// testCOSEKey 生成一个合法的 EC2 / P-256 / ES256 COSE_Key
+func testCOSEKey(tb testing.TB) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	out := []byte{0xa5, 0x01, 0x02, 0x03, 0x26, 0x20, 0x01, 0x21, 0x58, 0x20}
+	out = append(out, key.X.FillBytes(make([]byte, 32))...)
+	out = append(out, 0x22, 0x58, 0x20)
+	return append(out, key.Y.FillBytes(make([]byte, 32))...)
+}
+
+// testAttestationObject 构造 fmt=none 的 attestationObject
+func testAttestationObject(tb testing.TB) []byte {
+	rpIDHash := sha256.Sum256([]byte("localhost"))
+	authData := append(rpIDHash[:], authFlagUserPresent|authFlagUserVerified|authFlagAttested, 0, 0, 0, 1)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = append(authData, 0x00, 0x04, 1, 2, 3, 4)
+	authData = append(authData, testCOSEKey(tb)...)
+
+	out := []byte{0xa3, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e'}
+	out = append(out, 0x67, 'a', 't', 't', 'S', 't', 'm', 't', 0xa0)
+	out = append(out, 0x68, 'a', 'u', 't', 'h', 'D', 'a', 't', 'a', 0x59, byte(len(authData)>>8), byte(len(authData)))
+	return append(out, authData...)
+}
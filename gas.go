@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// gas price 策略
+const (
+	gasStrategySuggested = "suggested" // 节点建议价 (eth_gasPrice，默认)
+	gasStrategyFast      = "fast"      // 下一区块 base fee + 近期小费的高分位
+	gasStrategyFixed     = "fixed"     // 固定价格
+	gasStrategyCapped    = "capped"    // 建议价，但不超过上限
+
+	defaultFastBlocks     = 10
+	defaultFastPercentile = 90
+
+	// feesTooHighMsg 超过费用上限时的错误信息前缀，sendError 据此附带错误码
+	feesTooHighMsg = "网络 gas 费用过高"
+	// errCodeFeesTooHigh 网络费用超过上限的错误码 (APIResponse.Code)，调用方应稍后重试
+	errCodeFeesTooHigh = "fees_too_high"
+)
+
+// GasConfig 中继交易的 gas price 策略
+type GasConfig struct {
+	Strategy   string  `yaml:"strategy"`   // suggested (默认) / fast / fixed / capped
+	Blocks     int     `yaml:"blocks"`     // fast: 参考最近多少个区块，默认 10
+	Percentile float64 `yaml:"percentile"` // fast: 小费分位数 (0-100)，默认 90
+	Price      string  `yaml:"price"`      // fixed: gas price (wei)
+	Cap        string  `yaml:"cap"`        // capped: 上限 (wei)
+
+	MaxGasPrice string `yaml:"max_gas_price"` // 中继愿意支付的最高 gas price (wei)，留空不限
+	MaxFee      string `yaml:"max_fee"`       // 单笔交易的最高费用 gas price × gas limit (wei)，留空不限
+
+	AccessList bool `yaml:"access_list"` // 用 eth_createAccessList 构造 EIP-2930 交易 (gas 更低时才使用)
+
+	Rollup string `yaml:"rollup"` // op / arbitrum / none，留空按 chainId 识别；决定 L1 数据费的估算方式
+}
+
+// GasStrategy 决定中继交易的 gas price
+type GasStrategy interface {
+	GasPrice(ctx context.Context) (*big.Int, error)
+}
+
+// suggestedGas 使用节点的 eth_gasPrice
+type suggestedGas struct {
+	srv *Server
+}
+
+func (g suggestedGas) GasPrice(ctx context.Context) (*big.Int, error) {
+	return g.srv.eth().SuggestGasPrice(ctx)
+}
+
+// fastGas 用 eth_feeHistory 估算: 下一区块的 base fee 加上最近若干区块中
+// 指定分位小费的中位数，比 eth_gasPrice 更快上链
+type fastGas struct {
+	srv        *Server
+	blocks     int
+	percentile float64
+}
+
+func (g fastGas) GasPrice(ctx context.Context) (*big.Int, error) {
+	history, err := g.srv.eth().FeeHistory(ctx, uint64(g.blocks), nil, []float64{g.percentile})
+	if err != nil || len(history.BaseFee) == 0 {
+		// 不支持 EIP-1559 的链退回建议价
+		return suggestedGas{g.srv}.GasPrice(ctx)
+	}
+
+	var tips []*big.Int
+	for _, reward := range history.Reward {
+		if len(reward) > 0 && reward[0] != nil {
+			tips = append(tips, reward[0])
+		}
+	}
+	tip := new(big.Int)
+	if len(tips) > 0 {
+		sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+		tip.Set(tips[len(tips)/2])
+	}
+	// BaseFee 最后一项是下一区块的 base fee
+	nextBase := history.BaseFee[len(history.BaseFee)-1]
+	return new(big.Int).Add(nextBase, tip), nil
+}
+
+// fixedGas 固定 gas price
+type fixedGas struct {
+	price *big.Int
+}
+
+func (g fixedGas) GasPrice(context.Context) (*big.Int, error) {
+	return new(big.Int).Set(g.price), nil
+}
+
+// cappedGas 在另一策略的结果上加上限
+type cappedGas struct {
+	inner GasStrategy
+	cap   *big.Int
+}
+
+func (g cappedGas) GasPrice(ctx context.Context) (*big.Int, error) {
+	price, err := g.inner.GasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if price.Cmp(g.cap) > 0 {
+		return new(big.Int).Set(g.cap), nil
+	}
+	return price, nil
+}
+
+// newGasStrategy 按配置创建策略
+func newGasStrategy(srv *Server, cfg GasConfig) (GasStrategy, error) {
+	wei := func(name, v string) (*big.Int, error) {
+		n, ok := new(big.Int).SetString(v, 10)
+		if !ok || n.Sign() <= 0 {
+			return nil, fmt.Errorf("gas.%s 格式错误: %q", name, v)
+		}
+		return n, nil
+	}
+
+	for name, v := range map[string]string{"max_gas_price": cfg.MaxGasPrice, "max_fee": cfg.MaxFee} {
+		if v != "" {
+			if _, err := wei(name, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch cfg.Rollup {
+	case "", rollupNone, rollupOPStack, rollupArbitrum:
+	default:
+		return nil, fmt.Errorf("未知的 gas.rollup: %s", cfg.Rollup)
+	}
+
+	switch cfg.Strategy {
+	case "", gasStrategySuggested:
+		return suggestedGas{srv}, nil
+	case gasStrategyFast:
+		g := fastGas{srv: srv, blocks: cfg.Blocks, percentile: cfg.Percentile}
+		if g.blocks <= 0 {
+			g.blocks = defaultFastBlocks
+		}
+		if g.percentile == 0 {
+			g.percentile = defaultFastPercentile
+		}
+		if g.percentile < 0 || g.percentile > 100 {
+			return nil, fmt.Errorf("gas.percentile 须在 0-100 之间: %v", g.percentile)
+		}
+		return g, nil
+	case gasStrategyFixed:
+		price, err := wei("price", cfg.Price)
+		if err != nil {
+			return nil, err
+		}
+		return fixedGas{price}, nil
+	case gasStrategyCapped:
+		limit, err := wei("cap", cfg.Cap)
+		if err != nil {
+			return nil, err
+		}
+		return cappedGas{inner: suggestedGas{srv}, cap: limit}, nil
+	default:
+		return nil, fmt.Errorf("未知的 gas.strategy: %s", cfg.Strategy)
+	}
+}
+
+// gasPrice 按当前配置的策略给出中继交易的 gas price
+func (srv *Server) gasPrice(ctx context.Context) (*big.Int, error) {
+	strategy, err := newGasStrategy(srv, srv.Config().Gas)
+	if err != nil {
+		return nil, err
+	}
+	price, err := strategy.GasPrice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取 gas price 失败: %v", err)
+	}
+	return price, nil
+}
+
+// feeCapError 网络费用超过上限
+type feeCapError struct {
+	what          string
+	actual, limit *big.Int
+}
+
+func (e *feeCapError) Error() string {
+	return fmt.Sprintf("%s: %s %s 超过上限 %s wei，请稍后重试", feesTooHighMsg, e.what, e.actual, e.limit)
+}
+
+// isFeesTooHigh 错误信息是否来自费用上限
+func isFeesTooHigh(msg string) bool {
+	return strings.Contains(msg, feesTooHighMsg)
+}
+
+// checkFeeCaps 检查 gas price 与单笔费用是否超过配置的上限 (gasLimit 为 0 时只检查单价)
+// l1Fee 为 rollup 上另计的 L1 数据费，reqCap 为请求自带的 gas price 上限，均可为 nil
+func (srv *Server) checkFeeCaps(gasPrice *big.Int, gasLimit uint64, l1Fee, reqCap *big.Int) error {
+	cfg := srv.Config().Gas
+	if limit, ok := new(big.Int).SetString(cfg.MaxGasPrice, 10); ok && gasPrice.Cmp(limit) > 0 {
+		return &feeCapError{"gas price", gasPrice, limit}
+	}
+	if reqCap != nil && gasPrice.Cmp(reqCap) > 0 {
+		return &feeCapError{"gas price", gasPrice, reqCap}
+	}
+	if limit, ok := new(big.Int).SetString(cfg.MaxFee, 10); ok && gasLimit > 0 {
+		fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))
+		if l1Fee != nil {
+			fee.Add(fee, l1Fee)
+		}
+		if fee.Cmp(limit) > 0 {
+			return &feeCapError{"交易费用", fee, limit}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	defaultHDPath = "m/44'/60'/0'/0" // 中继池助记词的默认派生路径 (之后追加账户序号)
+	hdHardened    = 0x80000000
+)
+
+// HDConfig 由 BIP-39 助记词派生中继池账户，按序号区间确定性生成 (例如每个 worker 一段)
+type HDConfig struct {
+	Mnemonic   string `yaml:"mnemonic"`   // 助记词 (支持 enc:v1:)
+	Passphrase string `yaml:"passphrase"` // BIP-39 密码 (可选，支持 enc:v1:)
+	Path       string `yaml:"path"`       // 派生路径前缀，默认 m/44'/60'/0'/0
+	From       int    `yaml:"from"`       // 起始序号 (含)
+	Count      int    `yaml:"count"`      // 派生账户数
+}
+
+// hdKey BIP-32 扩展私钥
+type hdKey struct {
+	key   []byte // 32 字节私钥
+	chain []byte // 32 字节 chain code
+}
+
+// bip39Seed 助记词 + 密码 → 64 字节种子 (PBKDF2-HMAC-SHA512，2048 轮)
+//
+// 不校验助记词的单词表与校验和，派生出的地址在启动时打印，请与钱包软件核对。
+func bip39Seed(mnemonic, passphrase string) ([]byte, error) {
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key(sha512.New, normalized, []byte("mnemonic"+passphrase), 2048, 64)
+}
+
+func hdMaster(seed []byte) hdKey {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	return hdKey{key: sum[:32], chain: sum[32:]}
+}
+
+// child 派生第 index 个子私钥 (index ≥ 0x80000000 为 hardened)
+func (k hdKey) child(index uint32) (hdKey, error) {
+	mac := hmac.New(sha512.New, k.chain)
+	if index >= hdHardened {
+		mac.Write([]byte{0})
+		mac.Write(k.key)
+	} else {
+		priv, err := crypto.ToECDSA(k.key)
+		if err != nil {
+			return hdKey{}, err
+		}
+		mac.Write(crypto.CompressPubkey(&priv.PublicKey))
+	}
+	var idx [4]byte
+	binary.BigEndian.PutUint32(idx[:], index)
+	mac.Write(idx[:])
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(n) >= 0 {
+		return hdKey{}, fmt.Errorf("序号 %d 派生结果无效", index)
+	}
+	childKey := il.Add(il, new(big.Int).SetBytes(k.key))
+	childKey.Mod(childKey, n)
+	if childKey.Sign() == 0 {
+		return hdKey{}, fmt.Errorf("序号 %d 派生结果无效", index)
+	}
+	return hdKey{key: childKey.FillBytes(make([]byte, 32)), chain: sum[32:]}, nil
+}
+
+// deriveHDKeys 按配置派生 path/from … path/(from+count-1) 的私钥
+func deriveHDKeys(cfg HDConfig) ([]*ecdsa.PrivateKey, error) {
+	if cfg.Mnemonic == "" {
+		return nil, nil
+	}
+	if cfg.Count <= 0 || cfg.From < 0 || cfg.From+cfg.Count > hdHardened {
+		return nil, fmt.Errorf("relayer_pool.hd: count 须大于 0，序号须在 0 到 2^31-1 之间")
+	}
+	path := cfg.Path
+	if path == "" {
+		path = defaultHDPath
+	}
+	base, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("relayer_pool.hd.path 格式错误: %v", err)
+	}
+	seed, err := bip39Seed(cfg.Mnemonic, cfg.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := hdMaster(seed)
+	for _, index := range base {
+		if parent, err = parent.child(index); err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]*ecdsa.PrivateKey, 0, cfg.Count)
+	for i := cfg.From; i < cfg.From+cfg.Count; i++ {
+		child, err := parent.child(uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		key, err := crypto.ToECDSA(child.key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
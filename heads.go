@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// headResubscribeDelay 订阅出错后重新订阅的间隔
+const headResubscribeDelay = 5 * time.Second
+
+// errHeadsResubscribe RPC 重连或切换端点，需要在新连接上重新订阅
+var errHeadsResubscribe = errors.New("RPC 连接已切换")
+
+// headWatcher 通过 eth_subscribe("newHeads") 接收新区块，确认跟踪与事件索引按区块推送而不是定时轮询
+//
+// 只有 websocket / IPC 端点支持订阅；HTTP 端点上 next 退化为按间隔轮询，行为与之前一致。
+// RPC 重连或切换端点后重新订阅。
+type headWatcher struct {
+	srv *Server
+
+	mu         sync.Mutex
+	subscribed bool
+	head       uint64
+	notify     chan struct{} // 下一个区块到达 (或订阅断开) 时关闭
+	resub      chan struct{}
+}
+
+func newHeadWatcher(srv *Server) *headWatcher {
+	h := &headWatcher{srv: srv, notify: make(chan struct{}), resub: make(chan struct{}, 1)}
+	srv.rpc.onReconnect(func(*ethclient.Client) {
+		select {
+		case h.resub <- struct{}{}:
+		default:
+		}
+	})
+	return h
+}
+
+// run 维持订阅直到 ctx 取消
+func (h *headWatcher) run(ctx context.Context) {
+	for {
+		err := h.subscribe(ctx)
+		h.setSubscribed(false)
+		if ctx.Err() != nil {
+			return
+		}
+		var retry <-chan time.Time
+		switch {
+		case errors.Is(err, errHeadsResubscribe):
+			continue
+		case errors.Is(err, rpc.ErrNotificationsUnsupported):
+			// 端点不支持订阅: 等到切换端点后再试
+			log.Println("RPC 端点不支持订阅，按轮询跟踪新区块")
+		default:
+			log.Printf("新区块订阅中断 (%s 后重新订阅): %v", headResubscribeDelay, err)
+			retry = time.After(headResubscribeDelay)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.resub:
+		case <-retry:
+		}
+	}
+}
+
+// subscribe 订阅新区块并分发，直到订阅出错或 ctx 取消
+func (h *headWatcher) subscribe(ctx context.Context) error {
+	heads := make(chan *types.Header, 16)
+	sub, err := h.srv.eth().SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	h.setSubscribed(true)
+	log.Println("已订阅新区块，确认跟踪改为按区块推送")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-h.resub:
+			return errHeadsResubscribe
+		case err := <-sub.Err():
+			if err == nil {
+				err = errors.New("订阅已关闭")
+			}
+			return err
+		case header := <-heads:
+			h.publish(header.Number.Uint64())
+		}
+	}
+}
+
+func (h *headWatcher) setSubscribed(v bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribed == v {
+		return
+	}
+	h.subscribed = v
+	if !v {
+		// 唤醒正在等待的调用方，改为轮询
+		h.head = 0
+		close(h.notify)
+		h.notify = make(chan struct{})
+	}
+}
+
+// publish 记录新区块并唤醒等待者
+func (h *headWatcher) publish(head uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if head > h.head {
+		h.head = head
+	}
+	close(h.notify)
+	h.notify = make(chan struct{})
+}
+
+// latest 订阅中时返回最近收到的区块高度，避免每次再调用 eth_blockNumber
+func (h *headWatcher) latest() (uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.head, h.subscribed && h.head > 0
+}
+
+// next 返回在下一个区块到达时关闭的 channel；未订阅时在 fallback 后关闭 (轮询)
+func (h *headWatcher) next(fallback time.Duration) <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribed {
+		return h.notify
+	}
+	ch := make(chan struct{})
+	time.AfterFunc(fallback, func() { close(ch) })
+	return ch
+}
+
+// blockNumber 当前区块高度，订阅中时直接使用推送的高度
+func (srv *Server) blockNumber(ctx context.Context) (uint64, error) {
+	if head, ok := srv.heads.latest(); ok {
+		return head, nil
+	}
+	return srv.eth().BlockNumber(ctx)
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// HistoryRecord 一次中继操作的记录
+type HistoryRecord struct {
+	Type      string `json:"type"` // transfer / transfer_eth / transfer_1155 / transfer_multi / permit_transfer / execute / approve / increase_allowance，索引的链上转账为 incoming_transfer / outgoing_transfer
+	Wallet    string `json:"wallet"`
+	Token     string `json:"token"`
+	From      string `json:"from,omitempty"`    // 索引的转账: 转出方
+	TokenID   string `json:"tokenId,omitempty"` // ERC-1155 代币 ID
+	To        string `json:"to"`
+	Amount    string `json:"amount"`    // 原始值 (最小单位)
+	Formatted string `json:"formatted"` // 按代币精度格式化的金额
+	Decimals  uint8  `json:"decimals"`
+	Symbol    string `json:"symbol,omitempty"`
+	Memo      string `json:"memo,omitempty"`
+	TxHash    string `json:"txHash"`
+	CreatedAt int64  `json:"createdAt"`
+
+	// 配置 price_oracle 时，交易确认后按确认当天 (UTC) 的价格补充
+	ConfirmedAt int64  `json:"confirmedAt,omitempty"`
+	USDPrice    string `json:"usdPrice,omitempty"` // 代币单价
+	USDValue    string `json:"usdValue,omitempty"` // 转账金额的 USD 价值，保留两位小数
+
+	// 中继交易的链上状态，随确认跟踪更新 (所在区块被重组时回到 pending)
+	Status      string `json:"status,omitempty"` // pending / mined / failed / replaced / stuck
+	BlockNumber uint64 `json:"blockNumber,omitempty"`
+	Final       bool   `json:"final,omitempty"`     // 已达到配置的确认数
+	UpdatedAt   int64  `json:"updatedAt,omitempty"` // 状态最近一次变化的时间
+}
+
+// 单次 /api/history 查询的记录数
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// HistoryFilter /api/history 的筛选条件，空值表示不筛选
+type HistoryFilter struct {
+	Token  string // 代币地址，原生 ETH 转账用 token=eth
+	Status string // 交易状态，final 表示已达到确认数
+	Type   string
+	From   time.Time // UTC 日期，含当天
+	To     time.Time // UTC 日期，含当天；零值表示不限
+}
+
+// HistoryData /api/history 返回数据
+type HistoryData struct {
+	Wallet  string          `json:"wallet"`
+	Records []HistoryRecord `json:"records"` // 按时间倒序
+	Total   int             `json:"total"`   // 符合条件的记录数
+	Offset  int             `json:"offset"`
+	Limit   int             `json:"limit"`
+}
+
+// historyStore 中继历史 (nsHistory，key = wallet/纳秒时间戳)
+//
+// nsHistoryTx 按交易哈希索引记录的 key (批量转账一笔交易对应多条记录)，交易状态变化时据此更新。
+type historyStore struct {
+	st Storage
+	mu sync.Mutex // 串行化读-改-写
+}
+
+func newHistoryStore(st Storage) *historyStore {
+	return &historyStore{st: st}
+}
+
+// add 保存记录，返回存储 key
+func (h *historyStore) add(rec HistoryRecord) (string, error) {
+	now := time.Now()
+	if rec.CreatedAt == 0 {
+		rec.CreatedAt = now.Unix()
+	}
+	key := fmt.Sprintf("%s/%020d", rec.Wallet, now.UnixNano())
+	if err := putJSON(h.st, nsHistory, key, rec, 0); err != nil {
+		return "", err
+	}
+	if rec.TxHash == "" {
+		return key, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var keys []string
+	if _, err := getJSON(h.st, nsHistoryTx, rec.TxHash, &keys); err != nil {
+		return key, err
+	}
+	return key, putJSON(h.st, nsHistoryTx, rec.TxHash, append(keys, key), 0)
+}
+
+// restore 按原 key 写入导入的记录并加入交易索引，key 已存在时返回 false
+func (h *historyStore) restore(key string, rec HistoryRecord) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, found, err := h.st.Get(nsHistory, key); err != nil || found {
+		return false, err
+	}
+	if err := putJSON(h.st, nsHistory, key, rec, 0); err != nil {
+		return false, err
+	}
+	if rec.TxHash == "" {
+		return true, nil
+	}
+	var keys []string
+	if _, err := getJSON(h.st, nsHistoryTx, rec.TxHash, &keys); err != nil {
+		return true, err
+	}
+	return true, putJSON(h.st, nsHistoryTx, rec.TxHash, append(keys, key), 0)
+}
+
+// byTx 交易对应的记录 key
+func (h *historyStore) byTx(txHash string) ([]string, error) {
+	var keys []string
+	_, err := getJSON(h.st, nsHistoryTx, txHash, &keys)
+	return keys, err
+}
+
+// update 读取记录、用 fn 修改后写回，记录不存在时返回 false
+func (h *historyStore) update(key string, fn func(rec *HistoryRecord)) (HistoryRecord, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var rec HistoryRecord
+	found, err := getJSON(h.st, nsHistory, key, &rec)
+	if err != nil || !found {
+		return rec, false, err
+	}
+	fn(&rec)
+	return rec, true, putJSON(h.st, nsHistory, key, rec, 0)
+}
+
+// recordTransfer 记录一次 ERC20 转账中继
+func (srv *Server) recordTransfer(req *ERC20TransferRequest, txHash common.Hash) {
+	token := common.HexToAddress(req.Token)
+	parsedABI, _ := abi.JSON(strings.NewReader(erc20ABI))
+	meta := srv.getTokenMetadata(parsedABI, token)
+	amount, _ := new(big.Int).SetString(req.Amount, 10)
+	precision, locale := srv.formatOptions("", "")
+
+	rec := HistoryRecord{
+		Type:      "transfer",
+		Wallet:    common.HexToAddress(req.Wallet).Hex(),
+		Token:     token.Hex(),
+		To:        common.HexToAddress(req.To).Hex(),
+		Amount:    req.Amount,
+		Formatted: formatAmount(amount, meta.Decimals, precision, locale),
+		Decimals:  meta.Decimals,
+		Symbol:    meta.Symbol,
+		Memo:      req.Memo,
+		TxHash:    txHash.Hex(),
+	}
+	srv.addHistory(rec)
+}
+
+// addHistory 保存记录，代币配置了喂价时在后台等待确认并标注 USD 价值
+func (srv *Server) addHistory(rec HistoryRecord) {
+	// 记录可能在交易上链之后才写入 (等待确认的批量转账、定时任务等)，先带上当前状态
+	if sub, ok := srv.submissions.lookup(common.HexToHash(rec.TxHash)); ok {
+		rec.Status, rec.BlockNumber, rec.Final = sub.Status, sub.BlockNumber, sub.Confirmed
+	}
+	key, err := srv.history.add(rec)
+	if err != nil {
+		log.Printf("记录历史失败: %v", err)
+		return
+	}
+	// 4337 模式下 txHash 是 userOpHash，没有交易回执可等
+	if srv.priceProvider().Supports(common.HexToAddress(rec.Token)) && srv.walletTypeFor(common.HexToAddress(rec.Wallet)).Encoder != walletEncoderAA {
+		go srv.annotatePrice(key, rec)
+	}
+}
+
+// txStatusChanged 中继交易上链、被重组或达到确认数时更新对应的历史记录，并向相关钱包推送事件
+//
+// 没有历史记录的交易 (部署、补充中继账户余额等) 只推送给全局 webhook 与 SSE。
+func (srv *Server) txStatusChanged(sub TxSubmission, typ, message string) {
+	ev := WalletEvent{
+		Type:        typ,
+		From:        sub.From,
+		TxHash:      sub.Hash,
+		BlockNumber: sub.BlockNumber,
+		Timestamp:   time.Now().Unix(),
+		Message:     message,
+	}
+	keys, err := srv.history.byTx(sub.Hash)
+	if err != nil {
+		log.Printf("读取交易 %s 的历史记录失败: %v", sub.Hash, err)
+	}
+	if len(keys) == 0 {
+		srv.notifier.publish(ev, srv.Config().Webhooks)
+		return
+	}
+
+	notified := make(map[string]bool)
+	for _, key := range keys {
+		rec, found, err := srv.history.update(key, func(rec *HistoryRecord) {
+			rec.Status, rec.BlockNumber, rec.Final = sub.Status, sub.BlockNumber, sub.Confirmed
+			rec.UpdatedAt = ev.Timestamp
+		})
+		if err != nil {
+			log.Printf("更新历史记录失败: %v", err)
+		}
+		if !found || notified[rec.Wallet] {
+			continue
+		}
+		notified[rec.Wallet] = true
+		e := ev
+		e.Wallet, e.From = rec.Wallet, rec.Wallet
+		if len(keys) == 1 {
+			e.Token, e.To, e.Amount = rec.Token, rec.To, rec.Amount
+		}
+		srv.publishEvent(e)
+	}
+}
+
+// historyRange 读取钱包在 [from, to] (UTC 日期，含两端) 内的记录，按时间顺序
+func (srv *Server) historyRange(wallet common.Address, from, to time.Time) ([]HistoryRecord, error) {
+	kvs, err := srv.storage.List(nsHistory, wallet.Hex()+"/")
+	if err != nil {
+		return nil, err
+	}
+	end := to.AddDate(0, 0, 1).Unix()
+	records := []HistoryRecord{}
+	for _, kv := range kvs {
+		var rec HistoryRecord
+		if err := json.Unmarshal(kv.Value, &rec); err != nil {
+			continue
+		}
+		if rec.CreatedAt >= from.Unix() && rec.CreatedAt < end {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
+
+// match 记录是否符合筛选条件
+func (f HistoryFilter) match(rec *HistoryRecord) bool {
+	switch {
+	case f.Token != "" && !strings.EqualFold(rec.Token, f.Token):
+		return false
+	case f.Type != "" && rec.Type != f.Type:
+		return false
+	case f.Status == "final" && !rec.Final:
+		return false
+	case f.Status != "" && f.Status != "final" && rec.Status != f.Status:
+		return false
+	}
+	return true
+}
+
+// parseHistoryFilter 解析 /api/history 的查询参数
+func parseHistoryFilter(q url.Values) (HistoryFilter, error) {
+	var f HistoryFilter
+	switch token := q.Get("token"); {
+	case token == "":
+	case strings.EqualFold(token, "eth"):
+		f.Token = nativeToken.Hex()
+	case common.IsHexAddress(token):
+		f.Token = common.HexToAddress(token).Hex()
+	default:
+		return f, fmt.Errorf("token 格式错误: %s", token)
+	}
+	switch f.Status = q.Get("status"); f.Status {
+	case "", txStatusPending, txStatusMined, txStatusFailed, txStatusReplaced, txStatusStuck, "final":
+	default:
+		return f, fmt.Errorf("未知的 status: %s (pending / mined / failed / replaced / stuck / final)", f.Status)
+	}
+	f.Type = q.Get("type")
+
+	var err error
+	if s := q.Get("from"); s != "" {
+		if f.From, err = time.Parse(reportDateFmt, s); err != nil {
+			return f, fmt.Errorf("开始日期格式错误 (YYYY-MM-DD): %s", s)
+		}
+	}
+	if s := q.Get("to"); s != "" {
+		if f.To, err = time.Parse(reportDateFmt, s); err != nil {
+			return f, fmt.Errorf("结束日期格式错误 (YYYY-MM-DD): %s", s)
+		}
+		if f.To.Before(f.From) {
+			return f, fmt.Errorf("结束日期早于开始日期")
+		}
+	}
+	return f, nil
+}
+
+// handleHistory 钱包的中继历史，按时间倒序分页
+//
+//	GET /api/history?wallet=0x...[&token=0x...|eth][&status=mined][&type=transfer][&from=2026-01-01][&to=2026-01-31][&offset=0][&limit=50]
+//
+// 交易本身是公开的链上数据，备注 (memo) 只在带有该钱包会话 (Authorization: Bearer) 时返回。
+func (srv *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if !common.IsHexAddress(q.Get("wallet")) {
+		sendError(w, "缺少参数或地址格式错误: wallet")
+		return
+	}
+	wallet := common.HexToAddress(q.Get("wallet"))
+	filter, err := parseHistoryFilter(q)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset = max(offset, 0)
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	limit = min(limit, maxHistoryLimit)
+
+	to := filter.To
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	records, err := srv.historyRange(wallet, filter.From, to)
+	if err != nil {
+		sendError(w, "读取历史失败: "+err.Error())
+		return
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	sess, ok := srv.sessions.lookup(token)
+	owner := token != "" && ok && sess.Wallet == wallet
+
+	matched := []HistoryRecord{}
+	for i := len(records) - 1; i >= 0; i-- {
+		if filter.match(&records[i]) {
+			matched = append(matched, records[i])
+		}
+	}
+	data := HistoryData{Wallet: wallet.Hex(), Total: len(matched), Offset: offset, Limit: limit, Records: []HistoryRecord{}}
+	if offset < len(matched) {
+		data.Records = matched[offset:min(offset+limit, len(matched))]
+	}
+	if !owner {
+		for i := range data.Records {
+			data.Records[i].Memo = ""
+		}
+	}
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Data: data})
+}
+
+// writeHistoryCSV 按会计记录格式写出历史 (金额为代币单位，USD 按确认当天价格)
+func writeHistoryCSV(w io.Writer, records []HistoryRecord) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time_utc", "confirmed_utc", "type", "wallet", "token", "symbol", "to", "amount_raw", "amount", "usd_price", "usd_value", "memo", "tx_hash", "token_id"})
+	for _, rec := range records {
+		amount := ""
+		if raw, ok := new(big.Int).SetString(rec.Amount, 10); ok {
+			amount = plainDecimal(raw, rec.Decimals)
+		}
+		confirmed := ""
+		if rec.ConfirmedAt > 0 {
+			confirmed = time.Unix(rec.ConfirmedAt, 0).UTC().Format(time.RFC3339)
+		}
+		cw.Write([]string{
+			time.Unix(rec.CreatedAt, 0).UTC().Format(time.RFC3339), confirmed,
+			rec.Type, rec.Wallet, rec.Token, rec.Symbol, rec.To,
+			rec.Amount, amount, rec.USDPrice, rec.USDValue,
+			rec.Memo, rec.TxHash, rec.TokenID,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// handleHistoryExport 导出会话钱包的中继历史 (需要钱包会话)
+//
+//	GET /api/history/export?from=2026-01-01&to=2026-01-31&format=csv
+func (srv *Server) handleHistoryExport(w http.ResponseWriter, r *http.Request) {
+	sess, ok := srv.requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	from, to, err := parseReportRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	format := q.Get("format")
+	if format != "json" && format != "csv" && format != "" {
+		sendError(w, "不支持的导出格式: "+format+" (csv / json)")
+		return
+	}
+	records, err := srv.historyRange(sess.Wallet, from, to)
+	if err != nil {
+		sendError(w, "读取历史失败: "+err.Error())
+		return
+	}
+
+	name := fmt.Sprintf("history-%s-%s_%s", sess.Wallet.Hex(), from.Format(reportDateFmt), to.Format(reportDateFmt))
+	if format == "json" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		json.NewEncoder(w).Encode(APIResponse{Success: true, Data: records})
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+	writeHistoryCSV(w, records)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	idempotencyHeader  = "Idempotency-Key"
+	maxIdempotencyKey  = 255
+	idempotencyTTL     = 24 * time.Hour   // 成功结果保留多久
+	idempotencyLockTTL = 10 * time.Minute // 处理中的占位记录，进程中途退出后过期释放
+)
+
+// idempotencyRecord 幂等键对应的请求指纹与结果 (nsIdempotency，key = 路径 + 幂等键)
+type idempotencyRecord struct {
+	Fingerprint string          `json:"fingerprint"` // 请求体的 sha256
+	Status      int             `json:"status"`      // 0 表示仍在处理
+	Body        json.RawMessage `json:"body,omitempty"`
+	CreatedAt   int64           `json:"createdAt"`
+}
+
+// bufferedWriter 缓存完整响应体，用于保存幂等结果
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (bw *bufferedWriter) WriteHeader(status int) {
+	bw.status = status
+	bw.ResponseWriter.WriteHeader(status)
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	bw.body.Write(b)
+	return bw.ResponseWriter.Write(b)
+}
+
+// idempotent 支持 Idempotency-Key 请求头 (或请求体中的 idempotencyKey 字段)
+//
+// 前端超时重试时，相同的键与请求体直接返回首次成功的响应 (同一个 txHash)，不会再次中继；
+// 相同的键用于不同的请求体时拒绝。只保存成功的响应，失败的请求可以用同一个键重试。
+func (srv *Server) idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			h(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := r.Header.Get(idempotencyHeader)
+		if key == "" {
+			var field struct {
+				IdempotencyKey string `json:"idempotencyKey"`
+			}
+			json.Unmarshal(body, &field)
+			key = field.IdempotencyKey
+		}
+		if key == "" {
+			h(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKey {
+			w.WriteHeader(http.StatusBadRequest)
+			sendError(w, "Idempotency-Key 过长")
+			return
+		}
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		storeKey := r.URL.Path + "/" + key
+
+		// SetNX 占位: 多个实例共享缓存时，同一个键也只会被一个请求处理
+		rec := idempotencyRecord{Fingerprint: fingerprint, CreatedAt: time.Now().Unix()}
+		placeholder, _ := json.Marshal(rec)
+		placed, err := srv.shared.SetNX(nsIdempotency, storeKey, placeholder, idempotencyLockTTL)
+		found := err == nil && !placed
+		if found {
+			rec = idempotencyRecord{}
+			var ok bool
+			if ok, err = getCacheJSON(srv.shared, nsIdempotency, storeKey, &rec); err == nil && !ok {
+				// 已有的记录恰好在 SetNX 之后过期: 按"正在处理"返回，客户端重试即可
+				rec = idempotencyRecord{Fingerprint: fingerprint}
+			}
+		}
+
+		switch {
+		case err != nil:
+			sendError(w, "读取幂等记录失败: "+err.Error())
+			return
+		case found && rec.Fingerprint != fingerprint:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			sendError(w, "Idempotency-Key 已用于不同的请求")
+			return
+		case found && rec.Status == 0:
+			w.WriteHeader(http.StatusConflict)
+			sendError(w, "相同 Idempotency-Key 的请求正在处理，请稍后重试")
+			return
+		case found:
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(rec.Status)
+			w.Write(rec.Body)
+			return
+		}
+
+		bw := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		h(bw, r)
+
+		var resp APIResponse
+		if json.Unmarshal(bw.body.Bytes(), &resp) == nil && resp.Success {
+			rec.Status = bw.status
+			rec.Body = json.RawMessage(bytes.TrimSpace(bw.body.Bytes()))
+			if err := setCacheJSON(srv.shared, nsIdempotency, storeKey, rec, idempotencyTTL); err != nil {
+				log.Printf("保存幂等结果失败: %v", err)
+			}
+			return
+		}
+		if err := srv.shared.Delete(nsIdempotency, storeKey); err != nil {
+			log.Printf("删除幂等记录失败: %v", err)
+		}
+	}
+}
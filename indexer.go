@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// IndexerConfig 事件索引配置
+type IndexerConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	PollInterval int      `yaml:"poll_interval"` // 轮询间隔 (秒)
+	StartBlock   uint64   `yaml:"start_block"`   // 首次运行时开始的区块，0 表示从当前区块开始
+	Wallets      []string `yaml:"wallets"`       // 启动时即跟踪的钱包
+}
+
+// erc20TransferTopic Transfer(address,address,uint256) 事件签名
+var erc20TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// 转账索引
+const (
+	transferIndexerStateKey = "transfers"        // 处理进度 (nsIndexerState)
+	indexerTopicChunk       = 500                // 单次 eth_getLogs 的地址 topic 数上限，钱包更多时分多次查询
+	indexerLogMarkerTTL     = 7 * 24 * time.Hour // 已处理日志标记的保留时间，只需覆盖失败后重新处理的区间
+)
+
+// transferIndexer 按区块读取被跟踪钱包转入、转出的 ERC20 Transfer 日志，推送事件并写入历史
+//
+// 已登记的钱包、中继过转账或建立过会话的钱包自动跟踪。本服务中继的转出已有历史记录，
+// 这里只补充钱包在服务之外发起的转账 (如直接调用合约) 与全部转入。处理进度保存在存储中，
+// 同一条日志只记录一次。订阅了新区块时每个区块处理一次。
+type transferIndexer struct {
+	srv *Server
+
+	mu      sync.Mutex
+	wallets map[common.Address]struct{}
+}
+
+func newTransferIndexer(srv *Server) *transferIndexer {
+	ix := &transferIndexer{
+		srv:     srv,
+		wallets: make(map[common.Address]struct{}),
+	}
+	for _, addr := range srv.Config().Indexer.Wallets {
+		ix.track(common.HexToAddress(addr))
+	}
+	if kvs, err := srv.storage.List(nsWallets, ""); err == nil {
+		for _, kv := range kvs {
+			ix.track(common.HexToAddress(kv.Key))
+		}
+	}
+	return ix
+}
+
+// track 开始跟踪钱包
+func (ix *transferIndexer) track(wallet common.Address) {
+	ix.mu.Lock()
+	ix.wallets[wallet] = struct{}{}
+	ix.mu.Unlock()
+}
+
+// tracked 钱包是否被跟踪
+func (ix *transferIndexer) tracked(wallet common.Address) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	_, ok := ix.wallets[wallet]
+	return ok
+}
+
+func (ix *transferIndexer) trackedTopics() []common.Hash {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	topics := make([]common.Hash, 0, len(ix.wallets))
+	for addr := range ix.wallets {
+		topics = append(topics, common.BytesToHash(addr.Bytes()))
+	}
+	return topics
+}
+
+// lastBlock 已处理到的区块，没有记录时返回 false
+func (ix *transferIndexer) lastBlock() (uint64, bool) {
+	data, ok, err := ix.srv.storage.Get(nsIndexerState, transferIndexerStateKey)
+	if err != nil || !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(string(data), 10, 64)
+	return n, err == nil
+}
+
+func (ix *transferIndexer) setLastBlock(n uint64) {
+	if err := ix.srv.storage.Put(nsIndexerState, transferIndexerStateKey, []byte(strconv.FormatUint(n, 10)), 0); err != nil {
+		log.Printf("保存转账索引进度失败: %v", err)
+	}
+}
+
+// run 后台轮询，直到 ctx 取消；订阅了新区块时每个区块处理一次，不再按 poll_interval 轮询
+func (ix *transferIndexer) run(ctx context.Context) {
+	cfg := ix.srv.Config().Indexer
+	interval := time.Duration(cfg.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+
+	for {
+		if err := ix.poll(ctx); err != nil {
+			log.Printf("索引器轮询失败: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ix.srv.heads.next(interval):
+		}
+	}
+}
+
+// poll 分段处理 (lastBlock, head] 区间内被跟踪钱包的转入、转出
+func (ix *transferIndexer) poll(ctx context.Context) error {
+	head, err := ix.srv.blockNumber(ctx)
+	if err != nil {
+		ix.srv.rpc.reportError(err)
+		return err
+	}
+	last, ok := ix.lastBlock()
+	if !ok {
+		start := ix.srv.Config().Indexer.StartBlock
+		if start == 0 {
+			ix.setLastBlock(head)
+			return nil
+		}
+		last = start - 1
+	}
+
+	topics := ix.trackedTopics()
+	for last < head {
+		to := min(last+defaultIndexerBatchBlocks, head)
+		for i := 0; i < len(topics); i += indexerTopicChunk {
+			chunk := topics[i:min(i+indexerTopicChunk, len(topics))]
+			// topics: [Transfer, from, to]，转入与转出各查询一次
+			for _, filter := range [][][]common.Hash{{{erc20TransferTopic}, nil, chunk}, {{erc20TransferTopic}, chunk}} {
+				logs, err := ix.srv.eth().FilterLogs(ctx, ethereum.FilterQuery{
+					FromBlock: new(big.Int).SetUint64(last + 1),
+					ToBlock:   new(big.Int).SetUint64(to),
+					Topics:    filter,
+				})
+				if err != nil {
+					// 进度不前进，重连后从上次处理的区块继续
+					ix.srv.rpc.reportError(err)
+					return err
+				}
+				for _, l := range logs {
+					ix.handle(l)
+				}
+			}
+		}
+		last = to
+		ix.setLastBlock(last)
+	}
+	return nil
+}
+
+// handle 处理一条 Transfer 日志: 对转账双方中被跟踪的钱包分别推送事件并记录历史
+func (ix *transferIndexer) handle(l types.Log) {
+	from, to, amount, ok := decodeTransferLog(l)
+	if !ok || l.Removed {
+		return
+	}
+	if ix.tracked(to) {
+		ix.record(l, to, "incoming_transfer", from, to, amount)
+	}
+	if ix.tracked(from) {
+		ix.record(l, from, "outgoing_transfer", from, to, amount)
+	}
+}
+
+// record 写入钱包历史并推送事件，同一条日志对同一钱包只处理一次；本服务中继的转出已有记录，跳过
+func (ix *transferIndexer) record(l types.Log, wallet common.Address, typ string, from, to common.Address, amount *big.Int) {
+	srv := ix.srv
+	marker := fmt.Sprintf("log/%s/%s/%d", wallet.Hex(), l.TxHash.Hex(), l.Index)
+	if _, seen, err := srv.storage.Get(nsIndexerState, marker); err != nil || seen {
+		return
+	}
+	if err := srv.storage.Put(nsIndexerState, marker, []byte{1}, indexerLogMarkerTTL); err != nil {
+		log.Printf("保存转账索引记录失败: %v", err)
+		return
+	}
+	if typ == "outgoing_transfer" && srv.relayedBy(l.TxHash, wallet) {
+		return
+	}
+
+	ts := int64(l.BlockTimestamp)
+	if ts == 0 {
+		ts = time.Now().Unix()
+	}
+	parsedABI, _ := abi.JSON(strings.NewReader(erc20ABI))
+	meta := srv.getTokenMetadata(parsedABI, l.Address)
+	precision, locale := srv.formatOptions("", "")
+	srv.history.add(HistoryRecord{
+		Type:        typ,
+		Wallet:      wallet.Hex(),
+		Token:       l.Address.Hex(),
+		From:        from.Hex(),
+		To:          to.Hex(),
+		Amount:      amount.String(),
+		Formatted:   formatAmount(amount, meta.Decimals, precision, locale),
+		Decimals:    meta.Decimals,
+		Symbol:      meta.Symbol,
+		TxHash:      l.TxHash.Hex(),
+		CreatedAt:   ts,
+		Status:      txStatusMined,
+		BlockNumber: l.BlockNumber,
+	})
+	srv.publishEvent(WalletEvent{
+		Type:        typ,
+		Wallet:      wallet.Hex(),
+		Token:       l.Address.Hex(),
+		From:        from.Hex(),
+		To:          to.Hex(),
+		Amount:      amount.String(),
+		TxHash:      l.TxHash.Hex(),
+		BlockNumber: l.BlockNumber,
+		Timestamp:   time.Now().Unix(),
+	})
+}
+
+// relayedBy 本服务是否为该钱包中继过这笔交易: 仍在跟踪的中继交易，或已有历史记录
+func (srv *Server) relayedBy(txHash common.Hash, wallet common.Address) bool {
+	if _, ok := srv.submissions.lookup(txHash); ok {
+		return true
+	}
+	keys, err := srv.history.byTx(txHash.Hex())
+	if err != nil {
+		return false
+	}
+	prefix := wallet.Hex() + "/"
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeTransferLog 解析 ERC20 Transfer 日志
+func decodeTransferLog(l types.Log) (from, to common.Address, amount *big.Int, ok bool) {
+	// ERC721 的 Transfer 有 4 个 topic 且 data 为空，这里只处理 ERC20
+	if len(l.Topics) != 3 || l.Topics[0] != erc20TransferTopic || len(l.Data) != 32 {
+		return from, to, nil, false
+	}
+	from = common.BytesToAddress(l.Topics[1].Bytes())
+	to = common.BytesToAddress(l.Topics[2].Bytes())
+	return from, to, new(big.Int).SetBytes(l.Data), true
+}
+
+// sameAddress 比较两个十六进制地址 (忽略大小写)
+func sameAddress(a, b string) bool {
+	return common.HexToAddress(a) == common.HexToAddress(b)
+}
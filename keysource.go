@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 主中继私钥的外部来源 (容器部署时通过环境变量或挂载的 secret 文件注入)
+const (
+	envPrivateKey     = "PRIVATE_KEY"      // 十六进制私钥 (支持 enc:v1:)
+	envPrivateKeyFile = "PRIVATE_KEY_FILE" // 内容为私钥的文件，如 /run/secrets/relayer_key
+)
+
+// resolvePrivateKey 按优先级确定主中继私钥，写回 cfg.PrivateKey 并返回来源
+//
+// PRIVATE_KEY > PRIVATE_KEY_FILE > private_key > private_key_file。环境变量覆盖配置文件中的
+// 全部私钥设置 (包括 keystore)；配置文件中同时设置多个来源时报错。
+func resolvePrivateKey(cfg *Config) (string, error) {
+	fromEnv := func(source, value string) (string, error) {
+		key, err := decryptValue(cfg.Secrets, strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", source, err)
+		}
+		cfg.PrivateKey, cfg.PrivateKeyFile, cfg.Keystore = key, "", ""
+		return source, nil
+	}
+	if value := os.Getenv(envPrivateKey); value != "" {
+		return fromEnv(envPrivateKey, value)
+	}
+	if path := os.Getenv(envPrivateKeyFile); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("读取 %s 失败: %v", envPrivateKeyFile, err)
+		}
+		return fromEnv(envPrivateKeyFile, string(data))
+	}
+
+	if cfg.PrivateKeyFile == "" {
+		if cfg.PrivateKey != "" {
+			return "private_key", nil
+		}
+		return "", nil
+	}
+	if cfg.PrivateKey != "" {
+		return "", fmt.Errorf("private_key 与 private_key_file 只能配置一个")
+	}
+	data, err := os.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("读取 private_key_file 失败: %v", err)
+	}
+	key, err := decryptValue(cfg.Secrets, strings.TrimSpace(string(data)))
+	if err != nil {
+		return "", fmt.Errorf("private_key_file: %v", err)
+	}
+	cfg.PrivateKey = key
+	return "private_key_file", nil
+}
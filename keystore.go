@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+// envKeystorePassword keystore 密码的环境变量，未设置时在终端提示输入
+const envKeystorePassword = "PASSKEY_KEYSTORE_PASSWORD"
+
+// keystoreUsage -action keystore 的子命令
+const keystoreUsage = `用法: -action keystore <命令>
+
+  import <文件>   读取十六进制私钥 (终端输入或标准输入)，加密写入 geth keystore 文件
+  export <文件>   解密 keystore 文件，把十六进制私钥输出到标准输出`
+
+// loadKeystoreKey 解密 geth 格式的 keystore 文件 (中继私钥，替代明文 private_key)
+func loadKeystoreKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 keystore 失败: %v", err)
+	}
+	password, err := keystorePassword("keystore 密码: ", false)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("解密 keystore 失败: %v", err)
+	}
+	return key.PrivateKey, nil
+}
+
+// keystorePassword 读取 keystore 密码: 优先环境变量，否则在终端提示 (confirm 时要求输入两次)
+func keystorePassword(prompt string, confirm bool) (string, error) {
+	if password, ok := os.LookupEnv(envKeystorePassword); ok {
+		return password, nil
+	}
+	password, err := readPassword(prompt)
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		again, err := readPassword("再次输入: ")
+		if err != nil {
+			return "", err
+		}
+		if again != password {
+			return "", fmt.Errorf("两次输入的密码不一致")
+		}
+	}
+	return password, nil
+}
+
+// stdin 多次读取共用同一个缓冲，避免前一次读取吞掉后面的行
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassword 从终端读取一行，输入期间关闭回显 (stty 不可用时照常读取)
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("读取输入失败: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// runKeystore 导入 / 导出中继私钥的 keystore 文件
+func runKeystore(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("缺少参数\n%s", keystoreUsage)
+	}
+	switch cmd, path := args[0], args[1]; cmd {
+	case "import":
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s 已存在，不会覆盖", path)
+		}
+		line, err := readPassword("私钥 (十六进制): ")
+		if err != nil {
+			return err
+		}
+		privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(line), "0x"))
+		if err != nil {
+			return fmt.Errorf("私钥格式错误: %v", err)
+		}
+		password, err := keystorePassword("设置 keystore 密码: ", true)
+		if err != nil {
+			return err
+		}
+		key := &keystore.Key{
+			Id:         uuid.New(),
+			Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+			PrivateKey: privateKey,
+		}
+		data, err := keystore.EncryptKey(key, password, keystore.StandardScryptN, keystore.StandardScryptP)
+		if err != nil {
+			return fmt.Errorf("加密私钥失败: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("写入 keystore 失败: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "已写入 %s (账户 %s)，在 config.yaml 中配置 keystore: %s 并删除 private_key\n", path, key.Address.Hex(), path)
+		return nil
+	case "export":
+		privateKey, err := loadKeystoreKey(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "账户 %s 的私钥 (请勿泄露):\n", crypto.PubkeyToAddress(privateKey.PublicKey).Hex())
+		fmt.Println(hexutil.Encode(crypto.FromECDSA(privateKey)))
+		return nil
+	default:
+		return fmt.Errorf("未知命令: %s\n%s", cmd, keystoreUsage)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// rollup 类型 (gas.rollup)
+const (
+	rollupNone     = "none"
+	rollupOPStack  = "op"       // Optimism / Base 等 OP-stack 链
+	rollupArbitrum = "arbitrum" // Arbitrum One / Nova
+)
+
+// rollupChains 已知 rollup 的 chainId，gas.rollup 留空时据此识别
+var rollupChains = map[int64]string{
+	10:       rollupOPStack, // OP Mainnet
+	8453:     rollupOPStack, // Base
+	7777777:  rollupOPStack, // Zora
+	34443:    rollupOPStack, // Mode
+	11155420: rollupOPStack, // OP Sepolia
+	84532:    rollupOPStack, // Base Sepolia
+	42161:    rollupArbitrum,
+	42170:    rollupArbitrum, // Nova
+	421614:   rollupArbitrum, // Arbitrum Sepolia
+}
+
+// 预部署合约
+var (
+	opGasPriceOracle = common.HexToAddress("0x420000000000000000000000000000000000000F")
+	arbNodeInterface = common.HexToAddress("0x00000000000000000000000000000000000000C8")
+)
+
+// OP-stack GasPriceOracle ABI (getL1Fee)
+const opGasPriceOracleABI = `[
+	{"inputs":[{"name":"_data","type":"bytes"}],"name":"getL1Fee","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"}
+]`
+
+// Arbitrum NodeInterface ABI (gasEstimateL1Component)，只能通过 eth_call 调用
+const arbNodeInterfaceABI = `[
+	{"inputs":[{"name":"to","type":"address"},{"name":"contractCreation","type":"bool"},{"name":"data","type":"bytes"}],"name":"gasEstimateL1Component","outputs":[{"name":"gasEstimateForL1","type":"uint64"},{"name":"baseFee","type":"uint256"},{"name":"l1BaseFeeEstimate","type":"uint256"}],"stateMutability":"payable","type":"function"}
+]`
+
+// l1Cost 交易在 rollup 上的 L1 数据成本
+//
+// OP-stack 的 L1 数据费在 gas limit × gas price 之外从发送方余额另行扣除；
+// Arbitrum 把 L1 成本折算为 L2 gas，eth_estimateGas 的结果已经包含，Fee 只是按当前 base fee 折算的金额。
+type l1Cost struct {
+	Fee        *big.Int // L1 数据费 (wei)
+	Gas        uint64   // Arbitrum: 折算的 L2 gas
+	InGasLimit bool     // 已计入 gas limit，不再额外支付
+}
+
+// extraFee 需要在 gas limit × gas price 之外另计的费用
+func (c l1Cost) extraFee() *big.Int {
+	if c.Fee == nil || c.InGasLimit {
+		return new(big.Int)
+	}
+	return c.Fee
+}
+
+// rollupKind 当前链的 rollup 类型，gas.rollup 优先
+func (srv *Server) rollupKind() string {
+	if kind := srv.Config().Gas.Rollup; kind != "" {
+		return kind
+	}
+	if kind, ok := rollupChains[srv.chainID.Int64()]; ok {
+		return kind
+	}
+	return rollupNone
+}
+
+// l1Cost 查询未签名交易的 L1 数据成本，非 rollup 链返回零值
+func (srv *Server) l1Cost(ctx context.Context, tx *types.Transaction) (l1Cost, error) {
+	switch srv.rollupKind() {
+	case rollupOPStack:
+		// getL1Fee 按未签名交易的 RLP 编码计算，签名长度由合约按固定值补上
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			return l1Cost{}, err
+		}
+		oracle, _ := abi.JSON(strings.NewReader(opGasPriceOracleABI))
+		data, _ := oracle.Pack("getL1Fee", raw)
+		out, err := srv.eth().CallContract(ctx, ethereum.CallMsg{To: &opGasPriceOracle, Data: data}, nil)
+		if err != nil {
+			srv.rpc.reportError(err)
+			return l1Cost{}, fmt.Errorf("GasPriceOracle.getL1Fee: %v", err)
+		}
+		var fee *big.Int
+		if err := oracle.UnpackIntoInterface(&fee, "getL1Fee", out); err != nil {
+			return l1Cost{}, err
+		}
+		return l1Cost{Fee: fee}, nil
+
+	case rollupArbitrum:
+		var to common.Address
+		if tx.To() != nil {
+			to = *tx.To()
+		}
+		nodeInterface, _ := abi.JSON(strings.NewReader(arbNodeInterfaceABI))
+		data, _ := nodeInterface.Pack("gasEstimateL1Component", to, tx.To() == nil, tx.Data())
+		out, err := srv.eth().CallContract(ctx, ethereum.CallMsg{To: &arbNodeInterface, Data: data}, nil)
+		if err != nil {
+			srv.rpc.reportError(err)
+			return l1Cost{}, fmt.Errorf("NodeInterface.gasEstimateL1Component: %v", err)
+		}
+		values, err := nodeInterface.Unpack("gasEstimateL1Component", out)
+		if err != nil || len(values) != 3 {
+			return l1Cost{}, fmt.Errorf("解析 gasEstimateL1Component 结果失败: %v", err)
+		}
+		gas, _ := values[0].(uint64)
+		baseFee, _ := values[1].(*big.Int)
+		fee := new(big.Int)
+		if baseFee != nil {
+			fee.Mul(baseFee, new(big.Int).SetUint64(gas))
+		}
+		return l1Cost{Fee: fee, Gas: gas, InGasLimit: true}, nil
+	}
+	return l1Cost{}, nil
+}
+
+// l1CostOrZero 查询失败时记录日志并按 0 处理，不阻塞中继
+func (srv *Server) l1CostOrZero(ctx context.Context, tx *types.Transaction) l1Cost {
+	cost, err := srv.l1Cost(ctx, tx)
+	if err != nil {
+		log.Printf("读取 L1 数据费失败: %v", err)
+	}
+	return cost
+}
+
+// relayFee 中继账户发送一笔调用的预估费用: gas price × gas limit + L1 数据费
+func (srv *Server) relayFee(ctx context.Context, to common.Address, data []byte, gasLimit uint64) (*big.Int, l1Cost, *big.Int, error) {
+	gasPrice, err := srv.gasPrice(ctx)
+	if err != nil {
+		return nil, l1Cost{}, nil, err
+	}
+	l1 := srv.l1CostOrZero(ctx, srv.newRelayTx(0, to, big.NewInt(0), gasLimit, gasPrice, data, nil))
+	total := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gasLimit))
+	return gasPrice, l1, total.Add(total, l1.extraFee()), nil
+}
+
+// FeeEstimate /api/estimate 返回数据，金额单位均为 wei
+type FeeEstimate struct {
+	Rollup       string `json:"rollup"`          // none / op / arbitrum
+	GasEstimate  uint64 `json:"gasEstimate"`     // L2 gas，Arbitrum 含 L1 成本折算的 gas
+	Estimated    bool   `json:"estimated"`       // false 表示 eth_estimateGas 失败 (如未签名)，按兜底 gas limit 计算
+	GasPrice     string `json:"gasPrice"`        // 中继交易的 gas price
+	L2Fee        string `json:"l2Fee"`           // gasEstimate × gasPrice
+	L1Fee        string `json:"l1Fee"`           // L1 数据费，非 rollup 链为 0
+	L1Gas        uint64 `json:"l1Gas,omitempty"` // Arbitrum: L1 成本折算的 L2 gas
+	L1InGasLimit bool   `json:"l1InGasLimit"`    // L1 成本已计入 gasEstimate，不再另外支付
+	TotalFee     string `json:"totalFee"`        // 实际支付的总费用: l2Fee + 另计的 L1 数据费
+}
+
+// estimateTransferFee 估算中继一笔转账的 L2 gas、L1 数据费与总费用
+func (srv *Server) estimateTransferFee(ctx context.Context, req *ERC20TransferRequest) (*FeeEstimate, error) {
+	wallet := common.HexToAddress(req.Wallet)
+	wt := srv.walletTypeFor(wallet)
+	if wt.Encoder == walletEncoderAA {
+		return nil, fmt.Errorf("4337 账户的费用由 bundler 按 UserOperation 收取，请使用 /api/simulate 查看预付款")
+	}
+	target, callData, err := srv.walletCall(wt, req)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := srv.walletOverrides(ctx, wallet, &req.PasskeyData)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := ethereum.CallMsg{To: &target, Data: callData}
+	if s := srv.signer(); s != nil {
+		msg.From = s.Address()
+	}
+	gas, err := srv.estimateGasWithOverrides(ctx, msg, overrides)
+	estimated := err == nil
+	if !estimated {
+		// 未签名时钱包必然以 Invalid signature 回滚，按兜底 gas limit 估算
+		if reason := decodeRevert(err); hasSignature(&req.PasskeyData) || !strings.Contains(reason, "Invalid signature") {
+			return nil, fmt.Errorf("预估 gas 失败: %s", reason)
+		}
+		gas = srv.fallbackGasLimit()
+	}
+
+	gasPrice, err := srv.gasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l1 := srv.l1CostOrZero(ctx, srv.newRelayTx(0, target, big.NewInt(0), gas, gasPrice, callData, nil))
+	if !estimated && l1.InGasLimit && l1.Gas > 0 {
+		// Arbitrum 的 L1 成本按 gas 计，兜底值需要加上
+		gas += l1.Gas
+	}
+	l1Fee := l1.Fee
+	if l1Fee == nil {
+		l1Fee = new(big.Int)
+	}
+	l2Fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+	return &FeeEstimate{
+		Rollup:       srv.rollupKind(),
+		GasEstimate:  gas,
+		Estimated:    estimated,
+		GasPrice:     gasPrice.String(),
+		L2Fee:        l2Fee.String(),
+		L1Fee:        l1Fee.String(),
+		L1Gas:        l1.Gas,
+		L1InGasLimit: l1.InGasLimit,
+		TotalFee:     new(big.Int).Add(l2Fee, l1.extraFee()).String(),
+	}, nil
+}
+
+// handleEstimate 估算转账费用，请求体同 /api/transfer (签名可选)
+func (srv *Server) handleEstimate(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+
+	var req ERC20TransferRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	if err := srv.validateTransferRequest(&req); err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	estimate, err := srv.estimateTransferFee(r.Context(), &req)
+	if err != nil {
+		sendError(w, "估算费用失败: "+err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    estimate,
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/usbwallet"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const ledgerDetectTimeout = 30 * time.Second
+
+// ledgerSigner 通过 USB 连接的 Ledger 签名，每笔交易都要在设备上确认
+//
+// 适合在管理员工作站上运行、余额较大的中继账户；设备一次只处理一笔签名，
+// 确认期间其它中继交易排队等待，吞吐量有限。
+type ledgerSigner struct {
+	wallet  accounts.Wallet
+	account accounts.Account
+}
+
+// newLedgerSigner 等待 Ledger 接入并解锁 (Ethereum 应用已打开)，派生 path 对应的账户
+func newLedgerSigner(path string) (Signer, error) {
+	derivation := accounts.DefaultBaseDerivationPath
+	if path != "" {
+		var err error
+		if derivation, err = accounts.ParseDerivationPath(path); err != nil {
+			return nil, fmt.Errorf("signer.ledger_path 格式错误: %v", err)
+		}
+	}
+	hub, err := usbwallet.NewLedgerHub()
+	if err != nil {
+		return nil, fmt.Errorf("初始化 Ledger 失败: %v", err)
+	}
+
+	fmt.Println("等待 Ledger: 请连接设备、解锁并打开 Ethereum 应用...")
+	deadline := time.Now().Add(ledgerDetectTimeout)
+	for {
+		if wallets := hub.Wallets(); len(wallets) > 0 {
+			wallet := wallets[0]
+			if err = wallet.Open(""); err == nil {
+				account, err := wallet.Derive(derivation, true)
+				if err != nil {
+					wallet.Close()
+					return nil, fmt.Errorf("Ledger 派生账户失败: %v", err)
+				}
+				fmt.Printf("Ledger 账户: %s (%s)\n", account.Address.Hex(), derivation)
+				return &ledgerSigner{wallet: wallet, account: account}, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return nil, fmt.Errorf("打开 Ledger 失败: %v", err)
+			}
+			return nil, fmt.Errorf("%s 内未检测到 Ledger", ledgerDetectTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (s *ledgerSigner) Address() common.Address {
+	return s.account.Address
+}
+
+func (s *ledgerSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	to := "(合约创建)"
+	if tx.To() != nil {
+		to = tx.To().Hex()
+	}
+	log.Printf("请在 Ledger 上确认交易: nonce %d, 发往 %s, value %s wei, gas %d × %s wei (调用数据需开启 Blind signing)",
+		tx.Nonce(), to, tx.Value(), tx.Gas(), tx.GasPrice())
+	signed, err := s.wallet.SignTx(s.account, tx, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("Ledger 签名失败 (设备上拒绝或已断开): %v", err)
+	}
+	log.Printf("Ledger 已签名交易 %s", signed.Hash().Hex())
+	return signed, nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"secp256R1-demo/chaintest"
+)
+
+// 压测使用的 Relying Party
+const (
+	loadTestRPID   = "localhost"
+	loadTestOrigin = "http://localhost"
+)
+
+// loadTestStubCode 对任意调用都返回 uint256(1) 的 runtime code
+// 预置在钱包/代币地址上: verifySignature 返回 true，transferERC20 直接成功
+var loadTestStubCode = common.FromHex("0x600160005260206000f3")
+
+// LoadTestOptions loadtest 参数
+type LoadTestOptions struct {
+	Rate      float64       // 每秒发起的转账数
+	Duration  time.Duration // 压测时长
+	Wallets   int           // 软件认证器 (钱包) 数量，同一认证器同时只有一个请求在途
+	BlockTime time.Duration // 模拟链出块间隔
+}
+
+// softAuthenticator 软件 Passkey: 持有 P-256 私钥，按 WebAuthn 格式生成 assertion
+type softAuthenticator struct {
+	mu        sync.Mutex
+	key       *ecdsa.PrivateKey
+	wallet    common.Address
+	signCount uint32
+}
+
+func newSoftAuthenticator(wallet common.Address) *softAuthenticator {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return &softAuthenticator{key: key, wallet: wallet}
+}
+
+// assert 对 challenge 签名，返回与前端 doSign 相同结构的 PasskeyData
+func (a *softAuthenticator) assert(challenge string) (*PasskeyData, error) {
+	a.signCount++
+	rpIDHash := sha256.Sum256([]byte(loadTestRPID))
+	authData := append(rpIDHash[:], authFlagUserPresent|authFlagUserVerified)
+	authData = binary.BigEndian.AppendUint32(authData, a.signCount)
+
+	clientDataJSON, _ := json.Marshal(clientData{Type: "webauthn.get", Challenge: challenge, Origin: loadTestOrigin})
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	messageHash := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	r, s, err := ecdsa.Sign(rand.Reader, a.key, messageHash[:])
+	if err != nil {
+		return nil, fmt.Errorf("签名失败: %v", err)
+	}
+
+	var data PasskeyData
+	data.PublicKey = PublicKeyHex{X: common.BigToHash(a.key.X).Hex(), Y: common.BigToHash(a.key.Y).Hex()}
+	data.Signature.R = common.BigToHash(r).Hex()
+	data.Signature.S = common.BigToHash(s).Hex()
+	data.WebAuthn.AuthenticatorData = "0x" + hex.EncodeToString(authData)
+	data.WebAuthn.ClientDataJSON = base64.RawURLEncoding.EncodeToString(clientDataJSON)
+	data.WebAuthn.MessageHash = common.Hash(messageHash).Hex()
+	return &data, nil
+}
+
+// loadTestResult 单次转账的结果
+type loadTestResult struct {
+	latency time.Duration
+	err     error
+}
+
+// loadTestClient 通过 HTTP 走完整的 challenge → assertion → /api/transfer (→ /api/queue) 流程
+type loadTestClient struct {
+	base  string
+	token common.Address
+	http  *http.Client
+}
+
+// post 发送 JSON 请求，返回 HTTP 状态码与响应
+func (c *loadTestClient) post(path string, body interface{}) (int, *APIResponse, error) {
+	payload, _ := json.Marshal(body)
+	resp, err := c.http.Post(c.base+path, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, err
+	}
+	return decodeLoadTestResponse(resp)
+}
+
+func decodeLoadTestResponse(resp *http.Response) (int, *APIResponse, error) {
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+	var out APIResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("响应解析失败 (HTTP %d)", resp.StatusCode)
+	}
+	return resp.StatusCode, &out, nil
+}
+
+// transfer 由认证器完成一次转账，排队时轮询到最终结果
+func (c *loadTestClient) transfer(a *softAuthenticator) error {
+	req := ERC20TransferRequest{
+		Wallet: a.wallet.Hex(),
+		Token:  c.token.Hex(),
+		To:     common.BigToAddress(big.NewInt(0xdead)).Hex(),
+		Amount: "1",
+	}
+	unsigned, _ := json.Marshal(req)
+	_, res, err := c.post("/api/challenge", ChallengeRequest{Wallet: a.wallet.Hex(), Operation: opTransfer, Request: unsigned})
+	if err != nil {
+		return err
+	}
+	if !res.Success {
+		return fmt.Errorf("%s", res.Message)
+	}
+	var challenge ChallengeData
+	if err := remarshal(res.Data, &challenge); err != nil {
+		return err
+	}
+
+	data, err := a.assert(challenge.Challenge)
+	if err != nil {
+		return err
+	}
+	req.PasskeyData = *data
+	status, res, err := c.post("/api/transfer", req)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusTooManyRequests {
+		return fmt.Errorf("限流拒绝 (HTTP 429)")
+	}
+
+	// 与前端 awaitQueued 相同: 返回 ticket 时轮询直到拿到最终响应
+	for res.Success {
+		var queued QueuedData
+		if err := remarshal(res.Data, &queued); err != nil || queued.Ticket == "" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+		resp, err := c.http.Get(c.base + "/api/queue?ticket=" + queued.Ticket)
+		if err != nil {
+			return err
+		}
+		if _, res, err = decodeLoadTestResponse(resp); err != nil {
+			return err
+		}
+	}
+	if !res.Success {
+		return fmt.Errorf("%s", res.Message)
+	}
+	return nil
+}
+
+// remarshal 把 APIResponse.Data (map) 转成具体类型
+func remarshal(v interface{}, out interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// runLoadTest 在本地模拟链上按固定速率发起软件认证器签名的转账，输出吞吐、延迟分位与失败分类
+// 钱包与代币地址预置桩合约，链上不做 P-256 验证；服务端的 challenge/authenticatorData/signCount
+// 校验、限流排队与中继 nonce 管理均按真实路径执行
+func runLoadTest(base *Config, opts LoadTestOptions) error {
+	if opts.Rate <= 0 || opts.Duration <= 0 || opts.Wallets <= 0 {
+		return fmt.Errorf("rate、duration、wallets 必须大于 0")
+	}
+	if opts.BlockTime <= 0 {
+		opts.BlockTime = time.Second
+	}
+
+	token := common.BigToAddress(big.NewInt(0x70ce))
+	alloc := types.GenesisAlloc{token: {Code: loadTestStubCode}}
+	authenticators := make([]*softAuthenticator, opts.Wallets)
+	for i := range authenticators {
+		wallet := common.BigToAddress(big.NewInt(int64(0x10000 + i)))
+		alloc[wallet] = types.Account{Code: loadTestStubCode}
+		authenticators[i] = newSoftAuthenticator(wallet)
+	}
+
+	chain, endpoint, err := chaintest.NewWithRPC(alloc)
+	if err != nil {
+		return err
+	}
+	defer chain.Close()
+
+	conn, err := dialRPC(RPCClientConfig{}, endpoint)
+	if err != nil {
+		return fmt.Errorf("连接模拟链失败: %v", err)
+	}
+	defer conn.Close()
+
+	// 只沿用配置文件中影响中继吞吐的部分，其余 (webhook、索引、合规导出等) 不在压测中启用
+	cfg := &Config{
+		RPC:           endpoint,
+		CacheTTL:      10,
+		RelayMode:     relayModeEOA,
+		TraceCalldata: base.TraceCalldata,
+		MemoOnChain:   base.MemoOnChain,
+		RateLimit:     base.RateLimit,
+		WebAuthn:      WebAuthnConfig{RPID: loadTestRPID, Origins: []string{loadTestOrigin}},
+	}
+	srv := NewServer(cfg, conn, chaintest.ChainID, newKeySigner(chain.Relayer), newMemoryStorage(), newMemoryCache())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.limiter.run(ctx)
+	go func() {
+		ticker := time.NewTicker(opts.BlockTime)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				chain.Backend.Commit()
+			}
+		}
+	}()
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	client := &loadTestClient{base: ts.URL, token: token, http: &http.Client{Timeout: time.Minute}}
+
+	fmt.Printf("压测: %.1f 笔/秒, %s, %d 个认证器, 出块间隔 %s\n", opts.Rate, opts.Duration, opts.Wallets, opts.BlockTime)
+
+	var (
+		mu      sync.Mutex
+		results []loadTestResult
+		wg      sync.WaitGroup
+	)
+	record := func(res loadTestResult) {
+		mu.Lock()
+		results = append(results, res)
+		mu.Unlock()
+	}
+
+	interval := time.Duration(float64(time.Second) / opts.Rate)
+	ticker := time.NewTicker(interval)
+	deadline := time.After(opts.Duration)
+	start := time.Now()
+	next := 0
+loop:
+	for {
+		select {
+		case <-deadline:
+			break loop
+		case <-ticker.C:
+		}
+
+		// 认证器串行签名 (signCount 递增)，全部在途时记为客户端积压
+		var a *softAuthenticator
+		for i := 0; i < len(authenticators); i++ {
+			candidate := authenticators[(next+i)%len(authenticators)]
+			if candidate.mu.TryLock() {
+				a = candidate
+				next = (next + i + 1) % len(authenticators)
+				break
+			}
+		}
+		if a == nil {
+			record(loadTestResult{err: fmt.Errorf("认证器全部在途 (客户端积压)")})
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer a.mu.Unlock()
+			begin := time.Now()
+			err := client.transfer(a)
+			record(loadTestResult{latency: time.Since(begin), err: err})
+		}()
+	}
+	ticker.Stop()
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	chain.Backend.Commit()
+	mined, err := chain.Client.NonceAt(context.Background(), chain.RelayerAddress(), nil)
+	if err != nil {
+		return fmt.Errorf("查询中继 nonce 失败: %v", err)
+	}
+
+	printLoadTestReport(results, elapsed, mined)
+	return nil
+}
+
+// printLoadTestReport 输出吞吐、成功请求的延迟分位与失败分类
+func printLoadTestReport(results []loadTestResult, elapsed time.Duration, mined uint64) {
+	var latencies []time.Duration
+	failures := make(map[string]int)
+	for _, res := range results {
+		if res.err == nil {
+			latencies = append(latencies, res.latency)
+			continue
+		}
+		// 按错误前缀归类，去掉地址、金额等易变部分
+		reason, _, _ := strings.Cut(res.err.Error(), ":")
+		failures[reason]++
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	fmt.Printf("\n发起: %d 笔, 成功: %d 笔, 失败: %d 笔, 用时 %s\n",
+		len(results), len(latencies), len(results)-len(latencies), elapsed.Round(time.Millisecond))
+	fmt.Printf("吞吐: %.2f 笔/秒 (成功), 上链交易: %d 笔\n", float64(len(latencies))/elapsed.Seconds(), mined)
+
+	if len(latencies) > 0 {
+		percentile := func(p float64) time.Duration {
+			idx := int(float64(len(latencies))*p+0.5) - 1
+			return latencies[max(0, min(idx, len(latencies)-1))]
+		}
+		fmt.Printf("延迟: p50 %s, p90 %s, p99 %s, max %s\n",
+			percentile(0.50).Round(time.Millisecond), percentile(0.90).Round(time.Millisecond),
+			percentile(0.99).Round(time.Millisecond), latencies[len(latencies)-1].Round(time.Millisecond))
+	}
+
+	if len(failures) > 0 {
+		reasons := make([]string, 0, len(failures))
+		for reason := range failures {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool { return failures[reasons[i]] > failures[reasons[j]] })
+		fmt.Println("失败分类:")
+		for _, reason := range reasons {
+			fmt.Printf("  %6d  %s\n", failures[reason], reason)
+		}
+	}
+}
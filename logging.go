@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLoggedBody 单个请求/响应体最多记录的字节数
+const maxLoggedBody = 16 * 1024
+
+// sensitiveKeys JSON 与查询参数中需要脱敏的字段 (小写、去掉 _ 和 - 后比较)
+//
+// 不含单独的 token: 请求中的 token 是代币合约地址，排查问题时最需要它。
+var sensitiveKeys = map[string]bool{
+	"privatekey":    true,
+	"signingkey":    true,
+	"apikey":        true,
+	"sessiontoken":  true,
+	"authorization": true,
+	"secret":        true,
+	"password":      true,
+	"passphrase":    true,
+	"mnemonic":      true,
+	"admintoken":    true,
+}
+
+func isSensitiveKey(key string) bool {
+	k := strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	return sensitiveKeys[k] || strings.HasSuffix(k, "secret") || strings.HasSuffix(k, "privatekey")
+}
+
+// sessionPaths 响应中以 token 字段返回会话凭证的接口，这些响应的 token 同样脱敏
+var sessionPaths = map[string]bool{
+	"/api/session":      true,
+	"/api/login/finish": true,
+}
+
+// redactJSON 递归替换敏感字段 (及 extra 中的字段)，非 JSON 内容只记录长度
+func redactJSON(data []byte, extra ...string) string {
+	if len(data) == 0 {
+		return ""
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Sprintf("<非 JSON 内容，%d 字节>", len(data))
+	}
+	out, _ := json.Marshal(redactValue(v, extra))
+	return string(out)
+}
+
+func redactValue(v interface{}, extra []string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if isSensitiveKey(k) || slices.Contains(extra, k) {
+				t[k] = "[REDACTED]"
+			} else {
+				t[k] = redactValue(val, extra)
+			}
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = redactValue(t[i], extra)
+		}
+	}
+	return v
+}
+
+// redactQuery 按参数名脱敏查询字符串，保留参数顺序
+func redactQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		key, _, found := strings.Cut(part, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if found && isSensitiveKey(name) {
+			parts[i] = key + "=[REDACTED]"
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// redactHeaders 复制请求头并脱敏认证相关字段
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if isSensitiveKey(k) || strings.EqualFold(k, "Cookie") || strings.EqualFold(k, "X-Api-Key") {
+			out[k] = "[REDACTED]"
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+// recordingWriter 记录响应状态码与响应体
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.body.Len() < maxLoggedBody {
+		rw.body.Write(b[:min(len(b), maxLoggedBody-rw.body.Len())])
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// payloadLogger 开启时记录完整请求/响应 (脱敏)，SSE 等流式接口跳过
+func (srv *Server) payloadLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !srv.logPayloads.Load() || !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/events" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		reqBody, _ := io.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBody), r.Body))
+
+		rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		var responseKeys []string
+		if sessionPaths[r.URL.Path] {
+			responseKeys = []string{"token"}
+		}
+		headers, _ := json.Marshal(redactHeaders(r.Header))
+		log.Printf("[payload] id=%s %s %s?%s status=%d duration=%s headers=%s request=%s response=%s",
+			requestIDFrom(r), r.Method, r.URL.Path, redactQuery(r.URL.RawQuery), rw.status, time.Since(start),
+			headers, redactJSON(reqBody), redactJSON(rw.body.Bytes(), responseKeys...))
+	})
+}
+
+// redactingWriter 日志输出前替换已登记的密钥 (含 0x 前缀、大小写变体)
+type redactingWriter struct {
+	out io.Writer
+
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// logRedactor 进程日志的脱敏输出，main 启动时通过 log.SetOutput 安装
+var logRedactor = &redactingWriter{out: os.Stderr}
+
+// registerLogSecret 登记需要从日志中隐去的值 (私钥等)，过短的值忽略
+func registerLogSecret(secret string) {
+	secret = strings.TrimPrefix(strings.TrimSpace(secret), "0x")
+	if len(secret) < 16 {
+		return
+	}
+	logRedactor.mu.Lock()
+	defer logRedactor.mu.Unlock()
+	for _, s := range []string{secret, strings.ToLower(secret), strings.ToUpper(secret)} {
+		if !slices.Contains(logRedactor.secrets, s) {
+			logRedactor.secrets = append(logRedactor.secrets, s)
+		}
+	}
+}
+
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	rw.mu.RLock()
+	line := p
+	for _, s := range rw.secrets {
+		if bytes.Contains(line, []byte(s)) {
+			line = bytes.ReplaceAll(line, []byte(s), []byte("[REDACTED]"))
+		}
+	}
+	rw.mu.RUnlock()
+	if _, err := rw.out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// loginTTL 登录 challenge 有效期
+const loginTTL = 2 * time.Minute
+
+// loginChallenge 登录 challenge 记录 (nsChallenges，key = login/<challenge>)，不绑定钱包
+type loginChallenge struct {
+	RPID string `json:"rpId"`
+}
+
+// requestOptions PublicKeyCredentialRequestOptions (二进制字段为 base64url)
+// allowCredentials 为空: 由浏览器列出该 RP 下的可发现凭证，用户选择后即可确定钱包
+type requestOptions struct {
+	Challenge        string   `json:"challenge"`
+	RPID             string   `json:"rpId"`
+	AllowCredentials []string `json:"allowCredentials"`
+	UserVerification string   `json:"userVerification"`
+	Timeout          int      `json:"timeout"`
+}
+
+// LoginFinishRequest /api/login/finish 请求: 断言数据 + 凭证 rawId
+type LoginFinishRequest struct {
+	PasskeyData
+	CredentialID string `json:"credentialId"` // assertion.rawId (base64url)
+	UserHandle   string `json:"userHandle"`   // assertion.response.userHandle (base64url)，可选
+}
+
+// LoginData /api/login/finish 返回数据
+type LoginData struct {
+	SessionData
+	CredentialID string       `json:"credentialId"`
+	UserName     string       `json:"userName"`
+	PublicKey    PublicKeyHex `json:"publicKey"`
+	WalletType   string       `json:"walletType"`
+}
+
+// handleLoginBegin 签发不绑定钱包的登录 challenge
+func (srv *Server) handleLoginBegin(w http.ResponseWriter, r *http.Request) {
+	challenge := make([]byte, 32)
+	rand.Read(challenge)
+	opts := requestOptions{
+		Challenge:        base64.RawURLEncoding.EncodeToString(challenge),
+		RPID:             srv.rpID(r),
+		AllowCredentials: []string{},
+		UserVerification: "required",
+		Timeout:          int(loginTTL / time.Millisecond),
+	}
+	if err := setCacheJSON(srv.shared, nsChallenges, "login/"+opts.Challenge, loginChallenge{RPID: opts.RPID}, loginTTL); err != nil {
+		sendError(w, "保存 challenge 失败: "+err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    opts,
+	})
+}
+
+// handleLoginFinish 按 credentialId 找到注册时保存的凭证与钱包，本地验签后签发会话
+func (srv *Server) handleLoginFinish(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req LoginFinishRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	if req.CredentialID == "" {
+		sendError(w, "缺少参数: credentialId")
+		return
+	}
+
+	cd, _, err := parseClientData(req.WebAuthn.ClientDataJSON, "webauthn.get")
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	var record loginChallenge
+	if !srv.takeChallenge("login/"+strings.TrimRight(cd.Challenge, "="), &record) {
+		sendError(w, "challenge 无效、已过期或已使用，请重新登录")
+		return
+	}
+	if !srv.originAllowed(cd.Origin, record.RPID) {
+		sendError(w, "origin 不被允许: "+cd.Origin)
+		return
+	}
+	// 登录等同于出示钱包所有权，始终要求 UV
+	if _, err := checkAuthenticatorData(common.FromHex(req.WebAuthn.AuthenticatorData), record.RPID, true); err != nil {
+		sendVerificationError(w, err)
+		return
+	}
+
+	credID := strings.TrimRight(req.CredentialID, "=")
+	var cred Credential
+	found, err := getJSON(srv.storage, nsCredentials, credID, &cred)
+	if err != nil {
+		sendError(w, "读取凭证失败: "+err.Error())
+		return
+	}
+	if !found || cred.ID == "" {
+		sendError(w, "未找到该 Passkey 对应的钱包，请先注册")
+		return
+	}
+	if cred.RevokedAt != 0 {
+		sendError(w, "该 Passkey 已从钱包撤销")
+		return
+	}
+	if cred.Wallet == "" || cred.Pending {
+		sendError(w, "该 Passkey 的钱包尚未创建完成或尚未授权，请稍后再试")
+		return
+	}
+	if req.UserHandle != "" && cred.UserHandle != "" && strings.TrimRight(req.UserHandle, "=") != cred.UserHandle {
+		sendError(w, "userHandle 与凭证不一致")
+		return
+	}
+
+	// 只接受钱包当前已授权的凭证 (社交恢复后旧凭证失效)
+	wallet := common.HexToAddress(cred.Wallet)
+	if srv.signingCredential(wallet, &req.PasskeyData) != cred.ID {
+		srv.recordFailedVerification(wallet, fmt.Errorf("登录签名无效"))
+		sendError(w, "签名无效或该 Passkey 未被钱包授权")
+		return
+	}
+	if err := srv.advanceSignCount(wallet, &req.PasskeyData); err != nil {
+		srv.recordFailedVerification(wallet, err)
+		sendVerificationError(w, err)
+		return
+	}
+
+	srv.indexer.track(wallet)
+	token, expires, err := srv.sessions.create(wallet)
+	if err != nil {
+		sendError(w, "保存会话失败: "+err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success:     true,
+		Message:     "登录成功",
+		SNormalized: req.Signature.Normalized(),
+		Data: LoginData{
+			SessionData: SessionData{
+				Token:   token,
+				Wallet:  wallet.Hex(),
+				Expires: expires.Unix(),
+			},
+			CredentialID: cred.ID,
+			UserName:     cred.UserName,
+			PublicKey:    cred.PublicKey,
+			WalletType:   cred.WalletType,
+		},
+	})
+}
@@ -8,19 +8,12 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"math/big"
-	"net/http"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/ethereum/go-ethereum"
-	"github.com/ethereum/go-ethereum/accounts/abi"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"gopkg.in/yaml.v3"
 )
 
@@ -33,20 +26,78 @@ type Config struct {
 	ChainID    int64  `yaml:"chain_id"`
 	Contract   string `yaml:"contract"`
 	PrivateKey string `yaml:"private_key"`
+	Keystore   string `yaml:"keystore"` // 加密的 geth keystore 文件，替代明文 private_key
 	Port       int    `yaml:"port"`
+	CacheTTL   int    `yaml:"cache_ttl"` // 响应缓存时间 (秒)
+
+	RPCFallbacks []string        `yaml:"rpc_fallbacks"` // 备用 RPC 地址，rpc 出错或落后时自动切换
+	RPCClient    RPCClientConfig `yaml:"rpc_client"`    // RPC 请求超时与暂时性错误重试
+
+	Chains []ChainConfig `yaml:"chains"` // 额外接入的链，请求通过 chainId 选择，未指定时使用顶层配置的链
+
+	PrivateKeyFile string       `yaml:"private_key_file"` // 从文件读取私钥 (Docker / K8s secret)，环境变量 PRIVATE_KEY / PRIVATE_KEY_FILE 优先
+	Signer         SignerConfig `yaml:"signer"`           // 主中继账户的签名方式 (私钥或 Ledger)
+
+	MinTransfer MinTransferConfig `yaml:"min_transfer"` // 最小转账金额
+	PriceOracle PriceOracleConfig `yaml:"price_oracle"` // 代币 USD 价格，用于余额、预演与历史记录估值
+	Indexer     IndexerConfig     `yaml:"indexer"`      // 转入事件索引
+	Webhooks    []string          `yaml:"webhooks"`     // 运营方 webhook 地址
+	MemoOnChain bool              `yaml:"memo_onchain"` // 备注通过 execute 附加到 token.transfer calldata 上链
+
+	TraceCalldata bool `yaml:"trace_calldata"` // 在钱包调用数据末尾附加请求追踪 ID
+
+	RelayMode string          `yaml:"relay_mode"` // eoa (默认) 或 4337
+	AA        AAConfig        `yaml:"aa"`         // ERC-4337 bundler 配置
+	Paymaster PaymasterConfig `yaml:"paymaster"`  // VerifyingPaymaster 代付
+
+	WalletTypes   []WalletTypeConfig  `yaml:"wallet_types"`   // 额外的钱包类型 (工厂 + 中继编码)，注册时按 walletType 选择
+	WalletIndexer WalletIndexerConfig `yaml:"wallet_indexer"` // WalletCreated 事件索引，写入钱包登记
+
+	Format FormatConfig `yaml:"format"` // 响应中的金额格式化
+
+	Batch BatchConfig `yaml:"batch"` // 转账聚合 (Multicall3 / 批量 handleOps)
+
+	RateLimit RateLimitConfig `yaml:"rate_limit"` // 中继接口限流 (拒绝或排队)
+
+	Retry RetryConfig `yaml:"retry"` // 未上链交易提价重发
+
+	Confirmations       uint64 `yaml:"confirmations"`        // 转账等待多少个确认后才返回，0 为广播后立即返回
+	ConfirmationTimeout int    `yaml:"confirmation_timeout"` // 等待确认的最长时间 (秒)，默认 120
+
+	RelayerPool RelayerPoolConfig `yaml:"relayer_pool"` // 多个中继账户分担交易
+
+	Gas GasConfig `yaml:"gas"` // 中继交易的 gas price 策略
+
+	Treasury TreasuryConfig `yaml:"treasury"` // 中继账户余额不足时自动充值
+
+	Secrets SecretsConfig `yaml:"secrets"` // 加密配置值 (enc:v1:) 的主密钥来源
+
+	Compliance ComplianceConfig `yaml:"compliance"` // 地址筛查与合规报告导出
+
+	ReadOnly bool `yaml:"read_only"` // 只读部署: 禁用所有改变状态的接口
+
+	Storage StorageConfig `yaml:"storage"` // 存储后端
+	Cache   CacheConfig   `yaml:"cache"`   // 缓存后端 (challenge、幂等键等)，多实例部署时使用 redis 共享
+
+	Execute ExecuteConfig `yaml:"execute"` // 通用合约调用的目标白名单
+
+	TokenList TokenListConfig `yaml:"token_list"` // /api/tokens 返回的代币列表
+
+	PermitContract string `yaml:"permit_contract"` // PermitTransfer 合约 (contract/PermitTransfer.sol)，用于 EIP-2612 permit 转账
+
+	WalletTemplate string `yaml:"wallet_template"` // 任一已部署的 PasskeyWallet，预演未部署钱包时复制其代码
+
+	WebAuthn WebAuthnConfig `yaml:"webauthn"` // Passkey 注册 (Relying Party) 配置
+
+	AdminToken  string `yaml:"admin_token"`  // 管理接口 Bearer token，留空则禁用管理接口
+	LogPayloads bool   `yaml:"log_payloads"` // 启动时是否记录完整请求/响应 (自动脱敏)
 }
 
 // PasskeyData 前端导出的数据结构
 type PasskeyData struct {
-	PublicKey struct {
-		X string `json:"x"`
-		Y string `json:"y"`
-	} `json:"publicKey"`
-	Signature struct {
-		R string `json:"r"`
-		S string `json:"s"`
-	} `json:"signature"`
-	WebAuthn struct {
+	PublicKey PublicKeyHex  `json:"publicKey"`
+	Signature P256Signature `json:"signature"`
+	WebAuthn  struct {
 		AuthenticatorData string `json:"authenticatorData"`
 		ClientDataJSON    string `json:"clientDataJSON"`
 		MessageHash       string `json:"messageHash"`
@@ -60,22 +111,75 @@ type ERC20TransferRequest struct {
 	Token  string `json:"token"`  // ERC20 代币合约地址
 	To     string `json:"to"`     // 接收地址
 	Amount string `json:"amount"` // 转账金额 (wei 单位)
-}
+	Memo   string `json:"memo"`   // 可选备注 (发票号等)，用于对账
+
+	MaxGasPrice string `json:"maxGasPrice,omitempty"` // 可选: 本次转账接受的最高 gas price (wei)，低于全局上限时生效
 
-// CreateWalletRequest 创建钱包请求
-type CreateWalletRequest struct {
-	PublicKey struct {
-		X string `json:"x"`
-		Y string `json:"y"`
-	} `json:"publicKey"`
+	requestID string // 追踪 ID，trace_calldata 开启时附加到调用数据末尾
 }
 
-// APIResponse API 响应结构
+// APIResponse API 响应结构 (所有接口统一使用)
 type APIResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	TxHash  string `json:"txHash,omitempty"`
-	Valid   *bool  `json:"valid,omitempty"`
+	Success     bool        `json:"success"`
+	Message     string      `json:"message"`
+	Code        string      `json:"code,omitempty"` // 需要调用方区别处理的错误类型 (如 upstream_rate_limited)
+	TxHash      string      `json:"txHash,omitempty"`
+	Valid       *bool       `json:"valid,omitempty"`
+	SNormalized bool        `json:"sNormalized,omitempty"` // 请求签名的 s 位于曲线阶的上半部分，已规范化为 low-S
+	Data        interface{} `json:"data,omitempty"`        // 各接口的类型化数据
+	Warnings    []string    `json:"warnings,omitempty"`    // 不阻断请求的提示
+}
+
+// ConfigData /api/config 返回数据
+type ConfigData struct {
+	Contract string      `json:"contract"`
+	ChainID  string      `json:"chainId"`
+	RPC      string      `json:"rpc"`
+	ReadOnly bool        `json:"readOnly"`
+	P256     P256Support `json:"p256"` // 链上 P-256 验证能力，前端/合约据此选择验证器
+
+	WalletTypes []string `json:"walletTypes"` // 可选的 walletType，第一个为默认类型
+
+	Features Features `json:"features"` // 已启用的能力
+}
+
+// ChainData /api/chain 返回数据
+type ChainData struct {
+	ChainID     string `json:"chainId"`
+	BlockNumber uint64 `json:"blockNumber"`
+	GasPrice    string `json:"gasPrice"`
+}
+
+// BalanceData /api/balance 返回数据
+type BalanceData struct {
+	Balance   string `json:"balance"`   // 原始值 (最小单位)
+	Formatted string `json:"formatted"` // 按 decimals / precision / locale 格式化
+	Symbol    string `json:"symbol"`
+	Decimals  uint8  `json:"decimals"`
+	USDPrice  string `json:"usdPrice,omitempty"` // 配置了 price_oracle 时的代币单价
+	USDValue  string `json:"usdValue,omitempty"` // 余额的 USD 价值，保留两位小数
+}
+
+// RawTxData broadcast=false 时返回的已签名交易，可直接用 eth_sendRawTransaction 提交
+type RawTxData struct {
+	RawTransaction string `json:"rawTransaction"`
+	TxHash         string `json:"txHash"`
+	From           string `json:"from"`
+	Nonce          uint64 `json:"nonce"`
+}
+
+// VerifyRequest /api/verify 请求，传 credentialId 时使用注册时保存的公钥
+type VerifyRequest struct {
+	PasskeyData
+	CredentialID string `json:"credentialId"`
+}
+
+// VerifyData /api/verify 返回数据
+type VerifyData struct {
+	Valid       bool         `json:"valid"`
+	MessageHash string       `json:"messageHash"` // 服务端重算的签名载荷
+	PublicKey   PublicKeyHex `json:"publicKey"`
+	KeySource   string       `json:"keySource"` // credential (已注册凭证) 或 request (请求自带，仅证明签名与该公钥匹配)
 }
 
 // PasskeyWalletFactory ABI
@@ -90,12 +194,42 @@ const factoryABI = `[
 		"stateMutability": "nonpayable",
 		"type": "function"
 	},
+	{
+		"inputs": [
+			{"name": "xs", "type": "bytes32[]"},
+			{"name": "ys", "type": "bytes32[]"}
+		],
+		"name": "createWallets",
+		"outputs": [{"name": "created", "type": "address[]"}],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"anonymous": false,
+		"inputs": [
+			{"indexed": true, "name": "wallet", "type": "address"},
+			{"indexed": false, "name": "x", "type": "bytes32"},
+			{"indexed": false, "name": "y", "type": "bytes32"}
+		],
+		"name": "WalletCreated",
+		"type": "event"
+	},
 	{
 		"inputs": [{"name": "", "type": "address"}],
 		"name": "wallets",
 		"outputs": [{"type": "address"}],
 		"stateMutability": "view",
 		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "x", "type": "bytes32"},
+			{"name": "y", "type": "bytes32"}
+		],
+		"name": "getWallet",
+		"outputs": [{"type": "address"}],
+		"stateMutability": "view",
+		"type": "function"
 	}
 ]`
 
@@ -106,15 +240,48 @@ const walletABI = `[
 			{"name": "token", "type": "address"},
 			{"name": "to", "type": "address"},
 			{"name": "amount", "type": "uint256"},
-			{"name": "hash", "type": "bytes32"},
-			{"name": "r", "type": "bytes32"},
-			{"name": "s", "type": "bytes32"}
+			{"name": "signature", "type": "bytes"}
 		],
 		"name": "transferERC20",
 		"outputs": [],
 		"stateMutability": "nonpayable",
 		"type": "function"
 	},
+	{
+		"inputs": [
+			{"name": "to", "type": "address"},
+			{"name": "amount", "type": "uint256"},
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "transferETH",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "to", "type": "address"},
+			{"name": "value", "type": "uint256"},
+			{"name": "data", "type": "bytes"},
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "execute",
+		"outputs": [{"type": "bytes"}],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "to", "type": "address[]"},
+			{"name": "values", "type": "uint256[]"},
+			{"name": "data", "type": "bytes[]"},
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "executeBatch",
+		"outputs": [{"name": "results", "type": "bytes[]"}],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
 	{
 		"inputs": [
 			{"name": "hash", "type": "bytes32"},
@@ -126,6 +293,16 @@ const walletABI = `[
 		"stateMutability": "view",
 		"type": "function"
 	},
+	{
+		"inputs": [
+			{"name": "hash", "type": "bytes32"},
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "isValidSignature",
+		"outputs": [{"name": "magicValue", "type": "bytes4"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
 	{
 		"inputs": [],
 		"name": "getPublicKey",
@@ -180,13 +357,6 @@ const erc20ABI = `[
 	}
 ]`
 
-var (
-	config     *Config
-	ethClient  *ethclient.Client
-	privateKey *ecdsa.PrivateKey
-	chainID    *big.Int
-)
-
 func loadConfig(filename string) (*Config, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
@@ -204,448 +374,280 @@ func loadConfig(filename string) (*Config, error) {
 
 func main() {
 	configFile := flag.String("config", "config.yaml", "配置文件路径")
-	action := flag.String("action", "server", "操作: server, call, verify")
+	action := flag.String("action", "server", "操作: server, call, verify, create-wallets, deploy-impl, set-impl, verify-impl, gen-master-key, encrypt-secret, keystore, compliance-report, registry-export, registry-import, loadtest, admin")
+	keys := flag.String("keys", "", "create-wallets: 公钥列表 JSON 文件 ([{\"x\": ..., \"y\": ...}])")
+	artifact := flag.String("artifact", "", "deploy-impl: 新实现合约的编译产物 (JSON)；-dev: 工厂合约的编译产物")
+	impl := flag.String("impl", "", "set-impl / verify-impl: 实现合约地址")
+	factory := flag.String("factory", "", "set-impl / verify-impl: 工厂地址 (默认为配置中的 contract)")
+	dryRun := flag.Bool("dry-run", false, "升级命令只打印变更，不发送交易")
+	from := flag.String("from", "", "compliance-report: 开始日期 YYYY-MM-DD (默认当天, UTC)")
+	to := flag.String("to", "", "compliance-report: 结束日期 YYYY-MM-DD (默认同开始日期)")
+	format := flag.String("format", "csv", "compliance-report: csv 或 json；registry-export: json (默认) 或 csv")
+	out := flag.String("out", "", "compliance-report / registry-export: 输出文件 (默认标准输出)")
+	in := flag.String("in", "", "registry-import: 导入文件 (registry-export 导出的 JSON 或 CSV)")
+	withHistory := flag.Bool("history", false, "registry-export: 同时导出转账历史 (仅 json)")
+	rate := flag.Float64("rate", 10, "loadtest: 每秒发起的转账数")
+	duration := flag.Duration("duration", 30*time.Second, "loadtest: 压测时长")
+	wallets := flag.Int("wallets", 50, "loadtest: 软件认证器 (钱包) 数量")
+	blockTime := flag.Duration("block-time", time.Second, "loadtest: 模拟链出块间隔")
+	adminServer := flag.String("server", "", "admin: 服务地址 (默认 http://localhost:<配置端口>)")
+	dev := flag.Bool("dev", false, "server: 本地开发模式，连接 anvil / hardhat 节点，自动部署合约并充值测试资金")
+	adminToken := flag.String("token", "", "admin: 管理接口 token (默认读取 "+envAdminToken+" 或配置 admin_token)")
 	flag.Parse()
 
-	var err error
-	config, err = loadConfig(*configFile)
-	if err != nil {
-		log.Fatalf("加载配置文件失败: %v", err)
-	}
-
-	if config.RPC == "" {
-		config.RPC = "https://ethereum-sepolia-rpc.publicnode.com"
-	}
-	if config.Port == 0 {
-		config.Port = 8080
-	}
-
-	ethClient, err = ethclient.Dial(config.RPC)
-	if err != nil {
-		log.Fatalf("连接节点失败: %v", err)
-	}
-	defer ethClient.Close()
-
-	chainID, err = ethClient.NetworkID(context.Background())
-	if err != nil {
-		log.Fatalf("获取链 ID 失败: %v", err)
-	}
-
-	if config.PrivateKey != "" {
-		privateKey, err = crypto.HexToECDSA(strings.TrimPrefix(config.PrivateKey, "0x"))
-		if err != nil {
-			log.Fatalf("私钥格式错误: %v", err)
-		}
-	}
-
-	fmt.Printf("链 ID: %s\n", chainID.String())
-	fmt.Printf("合约地址: %s\n", config.Contract)
-	if privateKey != nil {
-		fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
-		fmt.Printf("中继账户: %s\n", fromAddress.Hex())
-	}
+	// 私钥等登记过的密钥不会出现在日志中
+	log.SetOutput(logRedactor)
 
+	// 密钥仪式 / 压测 / 远程管理: 不需要连接节点，配置文件可以不存在
 	switch *action {
-	case "server":
-		startServer()
-	case "call":
-		runCall()
-	case "verify":
-		runVerify()
-	default:
-		log.Fatalf("未知操作: %s", *action)
-	}
-}
-
-func startServer() {
-	http.HandleFunc("/", handleIndex)
-	http.HandleFunc("/api/verify", handleVerify)
-	http.HandleFunc("/api/send", handleSend)
-	http.HandleFunc("/api/transfer", handleTransfer)
-	http.HandleFunc("/api/balance", handleBalance)
-	http.HandleFunc("/api/config", handleConfig)
-	http.HandleFunc("/api/create-wallet", handleCreateWallet)
-
-	addr := fmt.Sprintf(":%d", config.Port)
-	fmt.Printf("\n服务器启动: http://localhost%s\n", addr)
-	fmt.Println("打开浏览器访问上述地址，使用指纹/Face ID 进行签名测试")
-
-	log.Fatal(http.ListenAndServe(addr, nil))
-}
-
-func handleIndex(w http.ResponseWriter, r *http.Request) {
-	data, err := webFS.ReadFile("web/index.html")
-	if err != nil {
-		http.Error(w, "页面加载失败", http.StatusInternalServerError)
+	case "gen-master-key":
+		runGenMasterKey()
 		return
-	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write(data)
-}
-
-func handleConfig(w http.ResponseWriter, r *http.Request) {
-	setCORSHeaders(w)
-	w.Header().Set("Content-Type", "application/json")
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"contract": config.Contract,
-		"chainId":  chainID.String(),
-		"rpc":      config.RPC,
-	})
-}
-
-func handleVerify(w http.ResponseWriter, r *http.Request) {
-	setCORSHeaders(w)
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method == "OPTIONS" {
+	case "loadtest":
+		// 使用本地模拟链，配置文件只提供 rate_limit 等中继参数
+		config, err := loadConfig(*configFile)
+		if err != nil {
+			config = &Config{}
+		}
+		opts := LoadTestOptions{Rate: *rate, Duration: *duration, Wallets: *wallets, BlockTime: *blockTime}
+		if err := runLoadTest(config, opts); err != nil {
+			log.Fatalf("压测失败: %v", err)
+		}
 		return
-	}
-	if r.Method != "POST" {
-		sendError(w, "只支持 POST 请求")
+	case "encrypt-secret":
+		config, err := loadConfig(*configFile)
+		if err != nil {
+			config = &Config{}
+		}
+		if err := runEncryptSecret(config.Secrets); err != nil {
+			log.Fatalf("加密失败: %v", err)
+		}
 		return
-	}
-
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		sendError(w, "读取请求失败")
+	case "keystore":
+		if err := runKeystore(flag.Args()); err != nil {
+			log.Fatal(err)
+		}
 		return
-	}
-
-	var data PasskeyData
-	if err := json.Unmarshal(body, &data); err != nil {
-		sendError(w, "JSON 解析失败: "+err.Error())
+	case "admin":
+		// 只用配置中的端口与 admin_token (可能已加密)，解密失败时仍可通过 -token 指定
+		config, err := loadConfig(*configFile)
+		if err != nil {
+			config = &Config{}
+		}
+		if err := decryptSecrets(config); err != nil {
+			config.AdminToken = ""
+		}
+		if err := runAdmin(config, *adminServer, *adminToken, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
 		return
 	}
 
-	// PasskeyWallet 模式下，验证需要通过钱包合约
-	sendError(w, "请使用 /api/transfer 接口，验证集成在转账流程中")
-}
-
-func handleSend(w http.ResponseWriter, r *http.Request) {
-	setCORSHeaders(w)
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method == "OPTIONS" {
-		return
+	if *dev && *action != "server" {
+		log.Fatalf("-dev 只支持 server 操作")
 	}
-	if r.Method != "POST" {
-		sendError(w, "只支持 POST 请求")
-		return
-	}
-	if privateKey == nil {
-		sendError(w, "未配置私钥，无法发送交易")
-		return
-	}
-
-	body, err := io.ReadAll(r.Body)
+	config, err := loadConfig(*configFile)
 	if err != nil {
-		sendError(w, "读取请求失败")
-		return
-	}
-
-	var data PasskeyData
-	if err := json.Unmarshal(body, &data); err != nil {
-		sendError(w, "JSON 解析失败: "+err.Error())
-		return
-	}
-
-	// PasskeyWallet 模式下，请使用 /api/transfer
-	sendError(w, "请使用 /api/transfer 接口")
-}
-
-// handleTransfer 处理 ERC20 转账请求
-func handleTransfer(w http.ResponseWriter, r *http.Request) {
-	setCORSHeaders(w)
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-	if r.Method != "POST" {
-		sendError(w, "只支持 POST 请求")
-		return
+		// 开发模式下配置文件可以不存在
+		if !*dev {
+			log.Fatalf("加载配置文件失败: %v", err)
+		}
+		config = &Config{}
 	}
-	if privateKey == nil {
-		sendError(w, "未配置私钥，无法发送交易")
-		return
+	if err := decryptSecrets(config); err != nil {
+		log.Fatalf("解密配置失败: %v", err)
 	}
-
-	body, err := io.ReadAll(r.Body)
+	keySource, err := resolvePrivateKey(config)
 	if err != nil {
-		sendError(w, "读取请求失败")
-		return
-	}
-
-	var req ERC20TransferRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		sendError(w, "JSON 解析失败: "+err.Error())
-		return
+		log.Fatalf("加载中继私钥失败: %v", err)
 	}
-
-	// 验证参数
-	if req.Wallet == "" || req.Token == "" || req.To == "" || req.Amount == "" {
-		sendError(w, "缺少必要参数: wallet, token, to, amount")
-		return
+	var devNode *devChain
+	if *dev {
+		if devNode, err = prepareDevConfig(config); err != nil {
+			log.Fatalf("开发模式: %v", err)
+		}
+		if keySource == "" && config.PrivateKey != "" {
+			keySource = "开发模式临时生成"
+		}
 	}
-
-	// 发送 ERC20 转账交易
-	txHash, err := sendERC20Transfer(&req)
-	if err != nil {
-		sendError(w, "ERC20 转账失败: "+err.Error())
-		return
+	for _, value := range sensitiveConfigValues(config) {
+		registerLogSecret(value)
 	}
 
-	json.NewEncoder(w).Encode(APIResponse{
-		Success: true,
-		Message: "ERC20 转账交易已发送",
-		TxHash:  txHash.Hex(),
-	})
-}
-
-// handleBalance 查询 ERC20 余额
-func handleBalance(w http.ResponseWriter, r *http.Request) {
-	setCORSHeaders(w)
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method == "OPTIONS" {
-		return
+	if config.RPC == "" {
+		config.RPC = "https://ethereum-sepolia-rpc.publicnode.com"
 	}
-
-	token := r.URL.Query().Get("token")
-	address := r.URL.Query().Get("address")
-
-	if token == "" || address == "" {
-		sendError(w, "缺少参数: token, address")
-		return
+	if config.Port == 0 {
+		config.Port = 8080
 	}
-
-	balance, symbol, decimals, err := getERC20Balance(token, address)
-	if err != nil {
-		sendError(w, "查询余额失败: "+err.Error())
-		return
+	if config.CacheTTL == 0 {
+		config.CacheTTL = 10
 	}
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":  true,
-		"balance":  balance.String(),
-		"symbol":   symbol,
-		"decimals": decimals,
-	})
-}
-
-func setCORSHeaders(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-}
-
-func sendError(w http.ResponseWriter, msg string) {
-	json.NewEncoder(w).Encode(APIResponse{
-		Success: false,
-		Message: msg,
-	})
-}
-
-func verifySignatureCall(data *PasskeyData, walletAddr string) (bool, error) {
-	hash := hexToBytes32(data.WebAuthn.MessageHash)
-	r := hexToBytes32(data.Signature.R)
-	s := hexToBytes32(data.Signature.S)
-
-	parsedABI, _ := abi.JSON(strings.NewReader(walletABI))
-	callData, err := parsedABI.Pack("verifySignature", hash, r, s)
-	if err != nil {
-		return false, fmt.Errorf("编码调用数据失败: %v", err)
+	if config.RelayMode == "" {
+		config.RelayMode = relayModeEOA
 	}
-
-	wallet := common.HexToAddress(walletAddr)
-	result, err := ethClient.CallContract(context.Background(), ethereum.CallMsg{
-		To:   &wallet,
-		Data: callData,
-	}, nil)
-	if err != nil {
-		return false, fmt.Errorf("调用合约失败: %v", err)
+	if err := validateWalletTypes(config.WalletTypes); err != nil {
+		log.Fatalf("配置错误: %v", err)
 	}
 
-	var valid bool
-	err = parsedABI.UnpackIntoInterface(&valid, "verifySignature", result)
+	conn, err := dialRPC(config.RPCClient, config.RPC, config.RPCFallbacks...)
 	if err != nil {
-		return false, fmt.Errorf("解析结果失败: %v", err)
+		log.Fatalf("连接节点失败: %v", err)
 	}
+	defer conn.Close()
 
-	return valid, nil
-}
-
-func sendVerifyTransaction(data *PasskeyData, walletAddr string) (common.Hash, error) {
-	hash := hexToBytes32(data.WebAuthn.MessageHash)
-	r := hexToBytes32(data.Signature.R)
-	s := hexToBytes32(data.Signature.S)
-
-	parsedABI, _ := abi.JSON(strings.NewReader(walletABI))
-	callData, err := parsedABI.Pack("verifySignature", hash, r, s)
+	chainID, err := conn.get().NetworkID(context.Background())
 	if err != nil {
-		return common.Hash{}, fmt.Errorf("编码调用数据失败: %v", err)
+		log.Fatalf("获取链 ID 失败: %v", err)
 	}
 
-	return sendTransaction(common.HexToAddress(walletAddr), big.NewInt(0), callData)
-}
-
-// handleCreateWallet 创建 PasskeyWallet
-func handleCreateWallet(w http.ResponseWriter, r *http.Request) {
-	setCORSHeaders(w)
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
-	if r.Method != "POST" {
-		sendError(w, "只支持 POST 请求")
-		return
+	var privateKey *ecdsa.PrivateKey
+	switch {
+	case config.PrivateKey != "" && config.Keystore != "":
+		log.Fatalf("配置错误: private_key 与 keystore 只能配置一个")
+	case config.PrivateKey != "":
+		privateKey, err = crypto.HexToECDSA(strings.TrimPrefix(config.PrivateKey, "0x"))
+		if err != nil {
+			log.Fatalf("私钥格式错误: %v", err)
+		}
+	case config.Keystore != "":
+		privateKey, err = loadKeystoreKey(config.Keystore)
+		if err != nil {
+			log.Fatalf("加载中继私钥失败: %v", err)
+		}
 	}
-	if privateKey == nil {
-		sendError(w, "未配置私钥，无法发送交易")
-		return
+	if privateKey != nil {
+		registerLogSecret(hex.EncodeToString(crypto.FromECDSA(privateKey)))
+	}
+	signer := newKeySigner(privateKey)
+	switch config.Signer.Type {
+	case "", signerTypeKey:
+	case signerTypeLedger, signerTypeClef, signerTypeWeb3Signer:
+		if privateKey != nil {
+			log.Fatalf("配置错误: signer.type 为 %s 时不能同时配置 private_key / keystore", config.Signer.Type)
+		}
+		// 只读部署不签名，不需要连接设备 / 签名服务
+		if config.ReadOnly {
+			break
+		}
+		if config.Signer.Type == signerTypeLedger {
+			signer, err = newLedgerSigner(config.Signer.LedgerPath)
+		} else {
+			signer, err = newRemoteSigner(config.Signer.Type, config.Signer.URL, config.Signer.Address)
+		}
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+	default:
+		log.Fatalf("配置错误: 未知的 signer.type: %s", config.Signer.Type)
 	}
-
-	body, err := io.ReadAll(r.Body)
+	poolKeys, err := parseRelayerKeys(config.RelayerPool)
 	if err != nil {
-		sendError(w, "读取请求失败")
-		return
+		log.Fatalf("配置错误: %v", err)
 	}
-
-	var req CreateWalletRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		sendError(w, "JSON 解析失败: "+err.Error())
-		return
+	// 只配置了助记词时，第一个派生账户作为主中继账户
+	if signer == nil && len(config.RelayerPool.Keys) == 0 && len(poolKeys) > 0 {
+		privateKey, poolKeys = poolKeys[0], poolKeys[1:]
+		signer = newKeySigner(privateKey)
 	}
-
-	x := hexToBytes32(req.PublicKey.X)
-	y := hexToBytes32(req.PublicKey.Y)
-
-	// 调用 Factory.createWallet(x, y)
-	parsedABI, _ := abi.JSON(strings.NewReader(factoryABI))
-	callData, err := parsedABI.Pack("createWallet", x, y)
-	if err != nil {
-		sendError(w, "编码调用数据失败: "+err.Error())
-		return
+	if len(poolKeys) > 0 && signer == nil {
+		log.Fatalf("配置错误: relayer_pool.keys 需要同时配置主中继账户 (private_key、keystore 或 signer)")
 	}
-
-	txHash, err := sendTransaction(common.HexToAddress(config.Contract), big.NewInt(0), callData)
-	if err != nil {
-		sendError(w, "创建钱包失败: "+err.Error())
-		return
+	if _, err := newGasStrategy(nil, config.Gas); err != nil {
+		log.Fatalf("配置错误: %v", err)
 	}
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "钱包创建交易已发送，请等待确认后查询钱包地址",
-		"txHash":  txHash.Hex(),
-	})
-}
-
-// sendERC20Transfer 发送 ERC20 转账交易 (调用 PasskeyWallet.transferERC20)
-func sendERC20Transfer(req *ERC20TransferRequest) (common.Hash, error) {
-	// 解析参数
-	wallet := common.HexToAddress(req.Wallet)
-	token := common.HexToAddress(req.Token)
-	to := common.HexToAddress(req.To)
-	amount, ok := new(big.Int).SetString(req.Amount, 10)
-	if !ok {
-		return common.Hash{}, fmt.Errorf("金额格式错误")
-	}
-
-	hash := hexToBytes32(req.WebAuthn.MessageHash)
-	r := hexToBytes32(req.Signature.R)
-	s := hexToBytes32(req.Signature.S)
-
-	// 调用 PasskeyWallet.transferERC20(token, to, amount, hash, r, s)
-	parsedABI, _ := abi.JSON(strings.NewReader(walletABI))
-	callData, err := parsedABI.Pack("transferERC20",
-		token, to, amount, hash, r, s)
-	if err != nil {
-		return common.Hash{}, fmt.Errorf("编码调用数据失败: %v", err)
+	switch config.RelayerPool.Strategy {
+	case "", relayerStrategyRoundRobin, relayerStrategyLeastPending:
+	default:
+		log.Fatalf("配置错误: 未知的 relayer_pool.strategy: %s", config.RelayerPool.Strategy)
 	}
 
-	// 发送到用户的钱包合约地址
-	return sendTransaction(wallet, big.NewInt(0), callData)
-}
-
-// getERC20Balance 查询 ERC20 余额
-func getERC20Balance(tokenAddr, userAddr string) (*big.Int, string, uint8, error) {
-	token := common.HexToAddress(tokenAddr)
-	user := common.HexToAddress(userAddr)
-
-	parsedABI, _ := abi.JSON(strings.NewReader(erc20ABI))
-
-	// 查询余额
-	balanceData, _ := parsedABI.Pack("balanceOf", user)
-	balanceResult, err := ethClient.CallContract(context.Background(), ethereum.CallMsg{
-		To:   &token,
-		Data: balanceData,
-	}, nil)
-	if err != nil {
-		return nil, "", 0, err
-	}
-
-	var balance *big.Int
-	parsedABI.UnpackIntoInterface(&balance, "balanceOf", balanceResult)
-
-	// 查询符号
-	symbolData, _ := parsedABI.Pack("symbol")
-	symbolResult, _ := ethClient.CallContract(context.Background(), ethereum.CallMsg{
-		To:   &token,
-		Data: symbolData,
-	}, nil)
-	var symbol string
-	parsedABI.UnpackIntoInterface(&symbol, "symbol", symbolResult)
-
-	// 查询精度
-	decimalsData, _ := parsedABI.Pack("decimals")
-	decimalsResult, _ := ethClient.CallContract(context.Background(), ethereum.CallMsg{
-		To:   &token,
-		Data: decimalsData,
-	}, nil)
-	var decimals uint8
-	parsedABI.UnpackIntoInterface(&decimals, "decimals", decimalsResult)
-
-	return balance, symbol, decimals, nil
-}
-
-func sendTransaction(to common.Address, value *big.Int, data []byte) (common.Hash, error) {
-	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
-
-	nonce, err := ethClient.PendingNonceAt(context.Background(), fromAddress)
-	if err != nil {
-		return common.Hash{}, fmt.Errorf("获取 nonce 失败: %v", err)
+	fmt.Printf("链 ID: %s\n", chainID.String())
+	fmt.Printf("合约地址: %s\n", config.Contract)
+	if config.ReadOnly {
+		fmt.Println("只读模式: 中继与写入接口已禁用")
+	} else if signer != nil {
+		fmt.Printf("中继账户: %s\n", signer.Address().Hex())
+		if keySource != "" {
+			fmt.Printf("中继私钥来源: %s\n", keySource)
+		}
+		for _, key := range poolKeys {
+			fmt.Printf("中继池账户: %s\n", crypto.PubkeyToAddress(key.PublicKey).Hex())
+		}
 	}
 
-	gasPrice, err := ethClient.SuggestGasPrice(context.Background())
+	st, err := openStorage(config.Storage)
 	if err != nil {
-		return common.Hash{}, fmt.Errorf("获取 gas price 失败: %v", err)
+		log.Fatalf("打开存储失败: %v", err)
 	}
+	defer st.Close()
 
-	gasLimit, err := ethClient.EstimateGas(context.Background(), ethereum.CallMsg{
-		From:  fromAddress,
-		To:    &to,
-		Value: value,
-		Data:  data,
-	})
+	cache, err := openCache(config.Cache)
 	if err != nil {
-		gasLimit = 300000 // ERC20 转账可能需要更多 gas
+		log.Fatalf("打开缓存失败: %v", err)
 	}
+	defer cache.Close()
 
-	tx := types.NewTransaction(nonce, to, value, gasLimit, gasPrice, data)
-	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), privateKey)
-	if err != nil {
-		return common.Hash{}, fmt.Errorf("签名交易失败: %v", err)
+	srv := NewServer(config, conn, chainID, signer, st, cache)
+	if devNode != nil {
+		if err := srv.setupDev(devNode, *artifact); err != nil {
+			log.Fatalf("开发模式: %v", err)
+		}
 	}
+	srv.DetectP256()
 
-	err = ethClient.SendTransaction(context.Background(), signedTx)
-	if err != nil {
-		return common.Hash{}, fmt.Errorf("发送交易失败: %v", err)
+	switch *action {
+	case "server":
+		chains := newChainRegistry(srv)
+		for _, chain := range config.Chains {
+			chainSrv, err := openChain(config, chain, signer, st, cache)
+			if err != nil {
+				log.Fatalf("配置错误: %v", err)
+			}
+			if err := chains.add(chainSrv, chain.Name); err != nil {
+				log.Fatalf("配置错误: chains: %v", err)
+			}
+			fmt.Printf("已接入链 %s (%d)，合约地址: %s\n", chain.Name, chain.ChainID, chainSrv.Config().Contract)
+		}
+		if devNode != nil {
+			printDevInfo(srv)
+		}
+		log.Fatal(chains.Start())
+	case "call":
+		runCall()
+	case "verify":
+		runVerify()
+	case "create-wallets":
+		if err := runCreateWallets(srv, *keys); err != nil {
+			log.Fatalf("批量创建钱包失败: %v", err)
+		}
+	case "deploy-impl", "set-impl", "verify-impl":
+		opts := UpgradeOptions{Artifact: *artifact, Impl: *impl, Factory: *factory, DryRun: *dryRun}
+		if err := runUpgrade(srv, *action, opts); err != nil {
+			log.Fatalf("升级失败: %v", err)
+		}
+	case "compliance-report":
+		if err := runComplianceReport(srv, *from, *to, *format, *out); err != nil {
+			log.Fatalf("导出合规报告失败: %v", err)
+		}
+	case "registry-export":
+		// -format 的默认值 csv 属于合规报告，未显式指定时导出完整的 JSON
+		registryFormat := "json"
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "format" {
+				registryFormat = *format
+			}
+		})
+		if err := runRegistryExport(srv, registryFormat, *out, *withHistory); err != nil {
+			log.Fatalf("导出钱包登记失败: %v", err)
+		}
+	case "registry-import":
+		if err := runRegistryImport(srv, *in); err != nil {
+			log.Fatalf("导入钱包登记失败: %v", err)
+		}
+	default:
+		log.Fatalf("未知操作: %s", *action)
 	}
-
-	return signedTx.Hash(), nil
 }
 
 func runCall() {
@@ -675,10 +677,26 @@ func loadPasskeyData(filename string) (*PasskeyData, error) {
 	return &data, nil
 }
 
-func hexToBytes32(s string) [32]byte {
-	s = strings.TrimPrefix(s, "0x")
-	b, _ := hex.DecodeString(s)
+// parseBytes32 严格解析 bytes32 十六进制 (可带 0x)，不足 32 字节时左侧补零
+func parseBytes32(s string) ([32]byte, error) {
 	var result [32]byte
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return result, fmt.Errorf("十六进制格式错误: %v", err)
+	}
+	if len(b) > 32 {
+		return result, fmt.Errorf("长度超过 32 字节: %d", len(b))
+	}
 	copy(result[32-len(b):], b)
+	return result, nil
+}
+
+// hexToBytes32 解析 bytes32 十六进制，格式错误时返回全零 (调用方应先用 parseBytes32 校验不可信输入)
+func hexToBytes32(s string) [32]byte {
+	result, _ := parseBytes32(s)
 	return result
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFS 各方言的建表与升级脚本: migrations/<dialect>/<版本>_<说明>.sql
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+// migrationLockID postgres 多个实例同时启动时用于串行化迁移的 advisory lock
+const migrationLockID = 0x70617373 // "pass"
+
+// migration 一个版本的升级脚本
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// loadMigrations 读取方言的全部脚本，按版本升序；版本号重复或文件名不合规时报错
+func loadMigrations(dialect string) ([]migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("没有 %s 的迁移脚本: %v", dialect, err)
+	}
+	var list []migration
+	seen := make(map[int]string)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		num, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(num)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("迁移脚本文件名应为 <版本>_<说明>.sql: %s", name)
+		}
+		if prev, ok := seen[version]; ok {
+			return nil, fmt.Errorf("迁移脚本版本重复: %s / %s", prev, name)
+		}
+		seen[version] = name
+		data, err := migrationFS.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, migration{Version: version, Name: strings.TrimSuffix(name, ".sql"), SQL: string(data)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// migrate 按版本依次执行尚未应用的脚本，每个脚本与版本记录在同一事务中提交
+//
+// 已应用的版本记录在 schema_migrations 中。数据库版本高于程序内置的最新版本 (回退到旧版本程序) 时拒绝启动，
+// 避免旧代码读写新格式的数据。
+func (s *sqlStorage) migrate() error {
+	migrations, err := loadMigrations(s.dialect)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("创建 schema_migrations 失败: %v", err)
+	}
+
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("读取数据库版本失败: %v", err)
+	}
+	if latest := migrations[len(migrations)-1].Version; current > latest {
+		return fmt.Errorf("数据库版本 %d 高于程序支持的版本 %d，请使用更新的程序", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := s.apply(m); err != nil {
+			return fmt.Errorf("执行迁移 %s 失败: %v", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// apply 在事务中执行一个脚本并记录版本；postgres 先取 advisory lock，其它实例已应用时跳过
+func (s *sqlStorage) apply(m migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if s.dialect == sqlDialectPostgres {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(` + strconv.Itoa(migrationLockID) + `)`); err != nil {
+			return err
+		}
+	}
+	var applied int
+	if err := tx.QueryRow(s.query(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), m.Version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(s.query(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+		m.Version, m.Name, time.Now().Unix()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("已应用数据库迁移 %s", m.Name)
+	return nil
+}
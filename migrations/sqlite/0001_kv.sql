@@ -0,0 +1,8 @@
+-- 命名空间键值表，全部持久化数据 (凭证、钱包登记、历史等) 按 ns 存放
+CREATE TABLE IF NOT EXISTS kv (
+    ns TEXT NOT NULL,
+    k TEXT NOT NULL,
+    v BLOB NOT NULL,
+    expires_at BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (ns, k)
+);
@@ -0,0 +1,2 @@
+-- 清理过期数据 (List 时按 ns 删除 expires_at 已过的行) 只需扫描带过期时间的行
+CREATE INDEX IF NOT EXISTS kv_expires ON kv (ns, expires_at) WHERE expires_at <> 0;
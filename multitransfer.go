@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// maxMultiTransferItems 单次批量转账最多项数
+const maxMultiTransferItems = 20
+
+// 批量转账单项的执行结果
+const (
+	multiItemPending    = "pending"     // 未等待上链 (?async=true 或 4337)
+	multiItemOK         = "ok"          // 已执行
+	multiItemFailed     = "failed"      // 本项调用失败，整笔回滚
+	multiItemRolledBack = "rolled_back" // 其它项失败，本项随整笔回滚
+)
+
+// MultiTransferItem 批量转账中的一项，token 为零地址表示原生 ETH
+type MultiTransferItem struct {
+	Token  string `json:"token"`
+	To     string `json:"to"`
+	Amount string `json:"amount"` // 最小单位 (ETH 为 wei)
+}
+
+// MultiTransferRequest 批量转账请求: 一次 Passkey 签名授权多笔转账，经钱包的 executeBatch 原子执行
+type MultiTransferRequest struct {
+	PasskeyData
+	Wallet string              `json:"wallet"` // 用户的 PasskeyWallet 合约地址
+	Items  []MultiTransferItem `json:"items"`
+
+	MaxGasPrice string `json:"maxGasPrice,omitempty"` // 可选: 本次转账接受的最高 gas price (wei)
+
+	requestID string
+}
+
+// MultiTransferResult 批量转账单项结果
+type MultiTransferResult struct {
+	Index       int    `json:"index"`
+	Token       string `json:"token"`
+	To          string `json:"to"`
+	Amount      string `json:"amount"`
+	Status      string `json:"status"`                // pending / ok / failed / rolled_back
+	Transferred string `json:"transferred,omitempty"` // 按回执中的 Transfer 事件实际到账的数量 (扣费代币可能少于 amount)
+	LogIndex    *uint  `json:"logIndex,omitempty"`    // 对应 Transfer 事件在区块中的序号，ETH 没有事件
+}
+
+// MultiTransferData /api/transfer-multi 返回数据
+type MultiTransferData struct {
+	Items []MultiTransferResult `json:"items"`
+	Tx    *TxStatusData         `json:"tx,omitempty"`
+	Batch *BatchInfo            `json:"batch,omitempty"` // 开启聚合时所在的批次
+}
+
+// asTransfer 第 i 项转换为转账请求，复用合规筛查、费用检查与审计
+func (req *MultiTransferRequest) asTransfer(i int) *ERC20TransferRequest {
+	item := req.Items[i]
+	return &ERC20TransferRequest{
+		PasskeyData: req.PasskeyData,
+		Wallet:      req.Wallet,
+		Token:       item.Token,
+		To:          item.To,
+		Amount:      item.Amount,
+		MaxGasPrice: req.MaxGasPrice,
+		requestID:   req.requestID,
+	}
+}
+
+// auditMultiTransfer 每项记录一条审计日志 (同一交易哈希)
+func (srv *Server) auditMultiTransfer(req *MultiTransferRequest, txHash common.Hash, err error) {
+	if len(req.Items) == 0 {
+		srv.audit(auditTransferMulti, &ERC20TransferRequest{Wallet: req.Wallet, requestID: req.requestID}, txHash, err)
+		return
+	}
+	for i := range req.Items {
+		srv.audit(auditTransferMulti, req.asTransfer(i), txHash, err)
+	}
+}
+
+// validateMultiTransferRequest 校验批量转账请求，按代币合计检查钱包余额
+func (srv *Server) validateMultiTransferRequest(req *MultiTransferRequest) error {
+	if req.Wallet == "" || len(req.Items) == 0 {
+		return fmt.Errorf("缺少必要参数: wallet, items")
+	}
+	if len(req.Items) > maxMultiTransferItems {
+		return fmt.Errorf("一次最多 %d 笔转账", maxMultiTransferItems)
+	}
+	if !common.IsHexAddress(req.Wallet) {
+		return fmt.Errorf("wallet 地址格式错误: %s", req.Wallet)
+	}
+	wallet := common.HexToAddress(req.Wallet)
+	if srv.walletFrozen(wallet) {
+		return fmt.Errorf("钱包已冻结，解除冻结前不能转账")
+	}
+
+	minTransfer := srv.Config().MinTransfer
+	needed := make(map[common.Address]*big.Int)
+	var tokens []common.Address
+	for i, item := range req.Items {
+		if !common.IsHexAddress(item.Token) {
+			return fmt.Errorf("items[%d].token 地址格式错误: %s", i, item.Token)
+		}
+		if !common.IsHexAddress(item.To) {
+			return fmt.Errorf("items[%d].to 地址格式错误: %s", i, item.To)
+		}
+		amount, ok := new(big.Int).SetString(item.Amount, 10)
+		if !ok || amount.Sign() <= 0 || amount.BitLen() > 256 {
+			return fmt.Errorf("items[%d].amount 格式错误: %s", i, item.Amount)
+		}
+		if err := srv.screenTransfer(req.asTransfer(i)); err != nil {
+			return err
+		}
+
+		token := common.HexToAddress(item.Token)
+		minAmount, err := minTransfer.minTransferFor(token)
+		if err != nil {
+			return err
+		}
+		if minAmount != nil && amount.Cmp(minAmount) < 0 {
+			return fmt.Errorf("items[%d] 金额 %s 低于最小值 %s", i, amount, minAmount)
+		}
+		if needed[token] == nil {
+			needed[token] = new(big.Int)
+			tokens = append(tokens, token)
+		}
+		needed[token].Add(needed[token], amount)
+	}
+
+	// 任一代币余额不足时整笔必然回滚，提前拒绝 (不消耗签名)
+	for _, token := range tokens {
+		var (
+			balance *big.Int
+			err     error
+		)
+		if token == nativeToken {
+			balance, err = srv.eth().BalanceAt(context.Background(), wallet, nil)
+		} else {
+			balance, _, _, err = srv.getERC20Balance(token.Hex(), req.Wallet)
+		}
+		if err != nil {
+			return fmt.Errorf("查询 %s 余额失败: %v", token.Hex(), err)
+		}
+		if balance.Cmp(needed[token]) < 0 {
+			return fmt.Errorf("%s 余额不足: 持有 %s，合计转账 %s", token.Hex(), balance, needed[token])
+		}
+	}
+	return srv.checkTransferFees(req.asTransfer(0))
+}
+
+// walletMultiTransferCall 编码 executeBatch: ERC20 项调用 token.transfer，ETH 项直接向接收方转账
+func (srv *Server) walletMultiTransferCall(wt *WalletTypeConfig, req *MultiTransferRequest) (common.Address, []byte, error) {
+	if wt.Encoder == walletEncoderSafe {
+		return common.Address{}, nil, fmt.Errorf("Safe 钱包不支持批量转账")
+	}
+	erc20, _ := abi.JSON(strings.NewReader(erc20ABI))
+	targets := make([]common.Address, len(req.Items))
+	values := make([]*big.Int, len(req.Items))
+	data := make([][]byte, len(req.Items))
+	for i, item := range req.Items {
+		amount, ok := new(big.Int).SetString(item.Amount, 10)
+		if !ok {
+			return common.Address{}, nil, fmt.Errorf("金额格式错误")
+		}
+		token := common.HexToAddress(item.Token)
+		to := common.HexToAddress(item.To)
+		if token == nativeToken {
+			targets[i], values[i], data[i] = to, amount, []byte{}
+			continue
+		}
+		inner, err := erc20.Pack("transfer", to, amount)
+		if err != nil {
+			return common.Address{}, nil, fmt.Errorf("编码调用数据失败: %v", err)
+		}
+		targets[i], values[i], data[i] = token, big.NewInt(0), inner
+	}
+
+	parsedABI, _ := abi.JSON(strings.NewReader(walletABI))
+	callData, err := parsedABI.Pack("executeBatch", targets, values, data, webauthnSignature(&req.PasskeyData))
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	if srv.Config().TraceCalldata {
+		callData = appendTraceTag(callData, req.requestID)
+	}
+	return common.HexToAddress(req.Wallet), callData, nil
+}
+
+// multiTransferResults 按回执解码每项结果: ERC20 项按顺序匹配 Transfer(wallet → to) 事件，
+// 交易失败时按 revert 原因 ("Batch call N failed") 标出失败的一项
+func multiTransferResults(req *MultiTransferRequest, receipt *types.Receipt, revertReason string) []MultiTransferResult {
+	wallet := common.HexToAddress(req.Wallet)
+	results := pendingMultiTransferResults(req)
+	if receipt == nil {
+		return results
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		failed := -1
+		if at := strings.Index(revertReason, "Batch call "); at >= 0 {
+			fmt.Sscanf(revertReason[at:], "Batch call %d failed", &failed)
+		}
+		for i := range results {
+			results[i].Status = multiItemRolledBack
+			if i == failed {
+				results[i].Status = multiItemFailed
+			}
+		}
+		return results
+	}
+
+	next := 0
+	for i, item := range req.Items {
+		results[i].Status = multiItemOK
+		token := common.HexToAddress(item.Token)
+		if token == nativeToken {
+			results[i].Transferred = item.Amount
+			continue
+		}
+		to := common.HexToAddress(item.To)
+		for ; next < len(receipt.Logs); next++ {
+			lg := receipt.Logs[next]
+			if lg.Address != token || len(lg.Topics) != 3 || lg.Topics[0] != erc20TransferTopic ||
+				common.BytesToAddress(lg.Topics[1][:]) != wallet || common.BytesToAddress(lg.Topics[2][:]) != to {
+				continue
+			}
+			logIndex := lg.Index
+			results[i].Transferred = new(big.Int).SetBytes(lg.Data).String()
+			results[i].LogIndex = &logIndex
+			next++
+			break
+		}
+	}
+	return results
+}
+
+// pendingMultiTransferResults 未上链时的结果
+func pendingMultiTransferResults(req *MultiTransferRequest) []MultiTransferResult {
+	results := make([]MultiTransferResult, len(req.Items))
+	for i, item := range req.Items {
+		results[i] = MultiTransferResult{
+			Index:  i,
+			Token:  common.HexToAddress(item.Token).Hex(),
+			To:     common.HexToAddress(item.To).Hex(),
+			Amount: item.Amount,
+			Status: multiItemPending,
+		}
+	}
+	return results
+}
+
+// awaitMultiTransfer 等待交易上链 (至少 1 个确认，配置了 confirmations 时按配置)，返回交易状态与回执
+func (srv *Server) awaitMultiTransfer(ctx context.Context, txHash common.Hash) (*TxStatusData, *types.Receipt, error) {
+	depth := srv.Config().Confirmations
+	if depth == 0 {
+		depth = 1
+	}
+	status, err := srv.awaitConfirmations(ctx, txHash, depth)
+	if err != nil || status.MinedHash == "" {
+		return status, nil, err
+	}
+	receipt, err := srv.eth().TransactionReceipt(ctx, common.HexToHash(status.MinedHash))
+	if err != nil {
+		return status, nil, err
+	}
+	return status, receipt, nil
+}
+
+// recordMultiTransfer 每项记录一条历史
+func (srv *Server) recordMultiTransfer(req *MultiTransferRequest, txHash common.Hash) {
+	erc20, _ := abi.JSON(strings.NewReader(erc20ABI))
+	precision, locale := srv.formatOptions("", "")
+	for _, item := range req.Items {
+		token := common.HexToAddress(item.Token)
+		decimals, symbol := uint8(18), "ETH"
+		if token != nativeToken {
+			meta := srv.getTokenMetadata(erc20, token)
+			decimals, symbol = meta.Decimals, meta.Symbol
+		}
+		amount, _ := new(big.Int).SetString(item.Amount, 10)
+		srv.addHistory(HistoryRecord{
+			Type:      "transfer_multi",
+			Wallet:    common.HexToAddress(req.Wallet).Hex(),
+			Token:     token.Hex(),
+			To:        common.HexToAddress(item.To).Hex(),
+			Amount:    item.Amount,
+			Formatted: formatAmount(amount, decimals, precision, locale),
+			Decimals:  decimals,
+			Symbol:    symbol,
+			TxHash:    txHash.Hex(),
+		})
+	}
+}
+
+// handleTransferMulti 中继钱包的批量转账 (ERC20 与 ETH 可混合)，一次签名、一笔交易原子执行
+//
+// 默认等待交易上链后按回执返回每项结果；?async=true 立即返回，每项为 pending。
+func (srv *Server) handleTransferMulti(w http.ResponseWriter, r *http.Request) {
+	if !srv.canRelayTransfer() {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req MultiTransferRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	req.requestID = requestIDFrom(r)
+
+	if err := srv.validateMultiTransferRequest(&req); err != nil {
+		srv.auditMultiTransfer(&req, common.Hash{}, err)
+		sendError(w, err.Error())
+		return
+	}
+
+	wallet := common.HexToAddress(req.Wallet)
+	wt := srv.walletTypeFor(wallet)
+	target, callData, err := srv.walletMultiTransferCall(wt, &req)
+	if err != nil {
+		srv.auditMultiTransfer(&req, common.Hash{}, err)
+		sendError(w, err.Error())
+		return
+	}
+	if err := srv.authorizeWalletCall(r, &req.PasskeyData, wallet, opTransferMulti, target, callData); err != nil {
+		srv.auditMultiTransfer(&req, common.Hash{}, err)
+		sendVerificationError(w, err)
+		return
+	}
+
+	if !broadcastRequested(r) {
+		if wt.Encoder == walletEncoderAA {
+			sendError(w, "签名转账交易失败: 4337 账户不支持 broadcast=false")
+			return
+		}
+		signedTx, err := srv.signWalletCall(target, callData)
+		if err != nil {
+			srv.auditMultiTransfer(&req, common.Hash{}, err)
+			sendError(w, "签名转账交易失败: "+err.Error())
+			return
+		}
+		srv.auditMultiTransfer(&req, signedTx.Hash(), nil)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success:     true,
+			Message:     "交易已签名，未广播",
+			TxHash:      signedTx.Hash().Hex(),
+			SNormalized: req.Signature.Normalized(),
+			Data:        srv.rawTxData(signedTx),
+		})
+		return
+	}
+
+	srv.indexer.track(wallet)
+	txHash, batch, err := srv.sendWalletCall(wallet, wt, target, callData, &req.PasskeyData)
+	srv.auditMultiTransfer(&req, txHash, err)
+	if err != nil {
+		sendError(w, "批量转账失败: "+err.Error())
+		return
+	}
+	srv.recordMultiTransfer(&req, txHash)
+
+	var warnings []string
+	seen := make(map[string]bool)
+	for _, item := range req.Items {
+		for _, warning := range srv.recipientWarnings(wallet, common.HexToAddress(item.To)) {
+			if !seen[warning] {
+				seen[warning] = true
+				warnings = append(warnings, warning)
+			}
+		}
+	}
+	data := MultiTransferData{Items: pendingMultiTransferResults(&req), Batch: batch}
+	resp := APIResponse{
+		Success:     true,
+		Message:     fmt.Sprintf("批量转账交易已发送 (%d 笔)", len(req.Items)),
+		TxHash:      txHash.Hex(),
+		SNormalized: req.Signature.Normalized(),
+		Warnings:    warnings,
+		Data:        &data,
+	}
+
+	switch {
+	case wt.Encoder == walletEncoderAA:
+		resp.Message = "批量转账 UserOperation 已提交 (txHash 为 userOpHash)，结果经 /api/userop 查询"
+	case asyncRequested(r):
+		resp.Message += "，上链后可经 /api/tx/" + txHash.Hex() + " 查询"
+	default:
+		status, receipt, err := srv.awaitMultiTransfer(r.Context(), txHash)
+		data.Tx = status
+		switch {
+		case err != nil:
+			resp.Message = "批量转账交易已发送，等待上链超时: " + err.Error()
+		case receipt == nil:
+			resp.Success = false
+			resp.Message = "批量转账未上链: nonce 已被其它交易占用"
+		case receipt.Status != types.ReceiptStatusSuccessful:
+			resp.Success = false
+			resp.Message = "批量转账执行失败，全部回滚"
+			if status.RevertReason != "" {
+				resp.Message += ": " + status.RevertReason
+			}
+			data.Items = multiTransferResults(&req, receipt, status.RevertReason)
+		default:
+			resp.Message = fmt.Sprintf("批量转账已执行 (%d 笔，%d 个确认)", len(req.Items), status.Confirmations)
+			data.Items = multiTransferResults(&req, receipt, "")
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// nonceManager 在内存中维护中继账户的下一个 nonce
+//
+// 并发的中继请求各自调用 PendingNonceAt 会拿到同一个 nonce，后发送的交易被节点拒绝
+// (或替换前一笔)。这里在锁内分配 nonce，每次提交占用一个；首次使用、中继私钥被替换、
+// 或发送失败导致无法判断链上状态时，下一次分配前重新从链上同步。
+type nonceManager struct {
+	srv    *Server
+	signer func() Signer // 账户签名者 (主中继账户随热加载变化)
+
+	mu     sync.Mutex
+	from   common.Address
+	next   uint64
+	synced bool
+}
+
+func newNonceManager(srv *Server, signer func() Signer) *nonceManager {
+	return &nonceManager{srv: srv, signer: signer}
+}
+
+// syncLocked 从链上读取 pending nonce，调用方持有 mu
+func (nm *nonceManager) syncLocked(from common.Address) error {
+	nonce, err := nm.srv.eth().PendingNonceAt(context.Background(), from)
+	if err != nil {
+		nm.srv.rpc.reportError(err)
+		return fmt.Errorf("获取 nonce 失败: %v", err)
+	}
+	if nm.synced && nm.from == from && nonce != nm.next {
+		log.Printf("中继账户 %s nonce 重新同步: 本地 %d，链上 %d", from.Hex(), nm.next, nonce)
+	}
+	nm.from, nm.next, nm.synced = from, nonce, true
+	return nil
+}
+
+// prepareLocked 确保本地 nonce 属于当前中继账户且已同步
+func (nm *nonceManager) prepareLocked() (common.Address, error) {
+	signer := nm.signer()
+	if signer == nil {
+		return common.Address{}, fmt.Errorf("未配置私钥")
+	}
+	from := signer.Address()
+	if !nm.synced || nm.from != from {
+		if err := nm.syncLocked(from); err != nil {
+			return common.Address{}, err
+		}
+	}
+	return from, nil
+}
+
+// reserve 占用下一个 nonce，发送结束后必须调用 complete
+func (nm *nonceManager) reserve() (uint64, error) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	if _, err := nm.prepareLocked(); err != nil {
+		return 0, err
+	}
+	nonce := nm.next
+	nm.next++
+	return nonce, nil
+}
+
+// peek 返回下一个 nonce 但不占用，用于只签名不广播的交易 (broadcast=false)
+func (nm *nonceManager) peek() (uint64, error) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	if _, err := nm.prepareLocked(); err != nil {
+		return 0, err
+	}
+	return nm.next, nil
+}
+
+// complete 报告占用的 nonce 的发送结果
+//
+// 发送失败时，若它是最后分配的 nonce 直接归还；否则后面已有交易占用了更大的 nonce，
+// 留下的空洞只能靠重新同步填补 (节点的 pending nonce 会停在空洞处)。
+// nonce 过低 / 已知交易等错误说明本地计数与链上不一致，同样重新同步。
+func (nm *nonceManager) complete(nonce uint64, err error) {
+	if err == nil {
+		return
+	}
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+
+	if nm.synced && nonce+1 == nm.next && !isNonceError(err) {
+		nm.next = nonce
+		return
+	}
+	nm.synced = false
+}
+
+// resync 丢弃本地计数，下一次分配前从链上重新读取
+func (nm *nonceManager) resync() {
+	nm.mu.Lock()
+	nm.synced = false
+	nm.mu.Unlock()
+}
+
+// isNonceError 节点返回的 nonce 相关错误
+func isNonceError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"nonce too low", "nonce too high", "already known", "replacement transaction underpriced"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// WalletEvent 推送给前端 / webhook 的钱包事件
+type WalletEvent struct {
+	Type        string `json:"type"` // incoming_transfer / outgoing_transfer / relayer_topup / treasury_alert / tx_mined / tx_reorged / tx_confirmed ...
+	Wallet      string `json:"wallet"`
+	Token       string `json:"token"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Amount      string `json:"amount"`
+	TxHash      string `json:"txHash"`
+	BlockNumber uint64 `json:"blockNumber"`
+	Timestamp   int64  `json:"timestamp"`
+	Message     string `json:"message,omitempty"` // 运营告警说明
+}
+
+// notifier 事件分发: SSE 订阅者 + webhook
+type notifier struct {
+	mu          sync.Mutex
+	subscribers map[chan WalletEvent]struct{}
+	httpClient  *http.Client // 运营方配置的 webhook
+	ownerClient *http.Client // 钱包所有者注册的 webhook，只能连接公网地址
+}
+
+func newNotifier() *notifier {
+	return &notifier{
+		subscribers: make(map[chan WalletEvent]struct{}),
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		ownerClient: newPublicHTTPClient(10 * time.Second),
+	}
+}
+
+// errBlockedAddress webhook 指向内网、回环、链路本地等地址
+var errBlockedAddress = errors.New("不允许连接内网、回环或链路本地地址")
+
+// blockedIP 不允许所有者 webhook 连接的地址 (防止 SSRF 访问内网服务、云元数据接口)
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// newPublicHTTPClient 只连接公网地址的 HTTP 客户端
+//
+// 在建立连接时检查解析后的 IP (DNS 重绑定同样被拦截)，不使用环境变量中的代理，不跟随重定向。
+func newPublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return fmt.Errorf("%s: %w", address, errBlockedAddress)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// subscribe 注册 SSE 订阅，返回取消函数
+func (n *notifier) subscribe() (chan WalletEvent, func()) {
+	ch := make(chan WalletEvent, 16)
+	n.mu.Lock()
+	n.subscribers[ch] = struct{}{}
+	n.mu.Unlock()
+
+	return ch, func() {
+		n.mu.Lock()
+		delete(n.subscribers, ch)
+		n.mu.Unlock()
+	}
+}
+
+// publish 广播事件，慢订阅者的事件直接丢弃，webhook 异步投递
+func (n *notifier) publish(ev WalletEvent, webhooks []string) {
+	n.mu.Lock()
+	for ch := range n.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+	n.mu.Unlock()
+
+	for _, url := range webhooks {
+		go n.postWebhook(url, ev)
+	}
+}
+
+func (n *notifier) postWebhook(url string, ev WalletEvent) {
+	n.postSignedWebhook(n.httpClient, url, "", ev)
+}
+
+// postSignedWebhook 投递事件，secret 非空时附带 X-Signature-256: sha256=HMAC(secret, body)
+func (n *notifier) postSignedWebhook(client *http.Client, url, secret string, ev WalletEvent) {
+	body, _ := json.Marshal(ev)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("webhook 地址无效 %s: %v", url, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("webhook 投递失败 %s: %v", url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("webhook 投递失败 %s: HTTP %d", url, resp.StatusCode)
+	}
+}
+
+// handleEvents SSE 事件流，可用 ?wallet= 过滤
+func (srv *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "不支持流式响应", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	filter := r.URL.Query().Get("wallet")
+	ch, cancel := srv.notifier.subscribe()
+	defer cancel()
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-ch:
+			if filter != "" && !sameAddress(filter, ev.Wallet) {
+				continue
+			}
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			flusher.Flush()
+		}
+	}
+}
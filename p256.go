@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// P-256 验证合约地址
+var (
+	p256PrecompileAddress = common.HexToAddress("0x0000000000000000000000000000000000000100") // RIP-7212 / EIP-7951
+	p256FallbackVerifier  = common.HexToAddress("0xc2b78104907F722DABAc4C69f826a522B2754De4") // Daimo P256Verifier (Solidity 实现)
+)
+
+// 不同验证路径下的默认 gas
+const (
+	precompileVerifyGasLimit = 300000 // 预编译验证约 3450 gas，整笔转账的兜底 gas limit
+	fallbackVerifyGasLimit   = 700000 // Solidity 实现验证约 330k gas
+	fallbackVerificationGas  = 500000 // 4337 validateUserOp 使用 Solidity 验证时的 verificationGasLimit
+)
+
+// P256Support 链上 P-256 验证能力
+type P256Support struct {
+	Precompile       bool   `json:"precompile"`       // 0x100 预编译可用
+	FallbackVerifier bool   `json:"fallbackVerifier"` // Daimo P256Verifier 已部署
+	Verifier         string `json:"verifier"`         // precompile / fallback / none
+}
+
+// detectP256Support 用一组现生成的签名探测 0x100 预编译与 Solidity 验证合约
+func detectP256Support(ctx context.Context, srv *Server) P256Support {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	hash := sha256.Sum256([]byte("p256 precompile probe"))
+	r, s, _ := ecdsa.Sign(rand.Reader, key, hash[:])
+
+	input := make([]byte, 160)
+	copy(input[0:32], hash[:])
+	r.FillBytes(input[32:64])
+	s.FillBytes(input[64:96])
+	key.X.FillBytes(input[96:128])
+	key.Y.FillBytes(input[128:160])
+
+	probe := func(addr common.Address) bool {
+		out, err := srv.eth().CallContract(ctx, ethereum.CallMsg{To: &addr, Data: input}, nil)
+		return err == nil && len(out) == 32 && new(big.Int).SetBytes(out).Cmp(big.NewInt(1)) == 0
+	}
+
+	support := P256Support{
+		Precompile:       probe(p256PrecompileAddress),
+		FallbackVerifier: probe(p256FallbackVerifier),
+		Verifier:         "none",
+	}
+	switch {
+	case support.Precompile:
+		support.Verifier = "precompile"
+	case support.FallbackVerifier:
+		support.Verifier = "fallback"
+	}
+	return support
+}
+
+// DetectP256 启动时探测并记录链上 P-256 验证能力
+func (srv *Server) DetectP256() P256Support {
+	support := detectP256Support(context.Background(), srv)
+	srv.mu.Lock()
+	srv.p256 = support
+	srv.mu.Unlock()
+
+	switch support.Verifier {
+	case "precompile":
+		log.Println("P-256 验证: RIP-7212 预编译 (0x100) 可用")
+	case "fallback":
+		log.Println("P-256 验证: 未检测到预编译，使用 Solidity P256Verifier (gas 较高)")
+	default:
+		log.Println("警告: 当前链既没有 P-256 预编译也没有 P256Verifier，链上签名验证将失败")
+	}
+	return support
+}
+
+// P256 返回探测结果
+func (srv *Server) P256() P256Support {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	return srv.p256
+}
+
+// fallbackGasLimit 估算失败时的兜底 gas limit，按验证路径区分
+func (srv *Server) fallbackGasLimit() uint64 {
+	if srv.P256().Verifier == "fallback" {
+		return fallbackVerifyGasLimit
+	}
+	return precompileVerifyGasLimit
+}
+
+// verificationGasLimit 4337 validateUserOp 的 gas 上限，按验证路径区分
+func (srv *Server) verificationGasLimit() *big.Int {
+	if srv.P256().Verifier == "fallback" {
+		return big.NewInt(fallbackVerificationGas)
+	}
+	return big.NewInt(defaultVerificationGasLimit)
+}
+
+// publicKeyFromHex 把十六进制坐标转换为 P-256 公钥，并检查点在曲线上
+func publicKeyFromHex(k PublicKeyHex) (*ecdsa.PublicKey, error) {
+	x, y := common.FromHex(k.X), common.FromHex(k.Y)
+	if len(x) == 0 || len(x) > 32 || len(y) == 0 || len(y) > 32 {
+		return nil, fmt.Errorf("公钥坐标长度无效")
+	}
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, fmt.Errorf("公钥不在 P-256 曲线上")
+	}
+	return pub, nil
+}
+
+// verifyP256Local 本地重算 WebAuthn 签名载荷 sha256(authenticatorData || sha256(clientDataJSON))
+// 并用 crypto/ecdsa 验证 (r, s)，不依赖 RPC 与链上验证合约
+func verifyP256Local(data *PasskeyData, pub *ecdsa.PublicKey) (bool, [32]byte, error) {
+	_, clientDataRaw, err := parseClientData(data.WebAuthn.ClientDataJSON, "webauthn.get")
+	if err != nil {
+		return false, [32]byte{}, err
+	}
+	authData := common.FromHex(data.WebAuthn.AuthenticatorData)
+	if len(authData) < authDataMinLength {
+		return false, [32]byte{}, fmt.Errorf("authenticatorData 长度不足: %d 字节", len(authData))
+	}
+
+	clientDataHash := sha256.Sum256(clientDataRaw)
+	messageHash := sha256.Sum256(append(authData, clientDataHash[:]...))
+	if data.WebAuthn.MessageHash != "" && !bytes.Equal(messageHash[:], common.FromHex(data.WebAuthn.MessageHash)) {
+		return false, messageHash, fmt.Errorf("messageHash 与 authenticatorData/clientDataJSON 不一致")
+	}
+
+	r := new(big.Int).SetBytes(common.FromHex(data.Signature.R))
+	s := new(big.Int).SetBytes(common.FromHex(data.Signature.S))
+	return ecdsa.Verify(pub, messageHash[:], r, s), messageHash, nil
+}
+
+// p256HalfN P-256 曲线阶的一半，s 大于它时为 high-S
+var p256HalfN = new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+// P256Signature 十六进制 (r, s)
+//
+// WebAuthn 认证器可能给出 high-S 签名，部分链上验证器只接受 low-S，
+// 解析时统一把 s 换成 n - s (签名依然有效)，打包 calldata 时无需再处理。
+type P256Signature struct {
+	R string `json:"r"`
+	S string `json:"s"`
+
+	normalized bool
+}
+
+// UnmarshalJSON 解析 (r, s) 并把 high-S 规范化为 low-S
+// 也接受 {"der": "..."}，即 WebAuthn 断言中原始的 DER 签名 (base64url 或 0x 开头的十六进制)
+func (sig *P256Signature) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		R   string `json:"r"`
+		S   string `json:"s"`
+		DER string `json:"der"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*sig = P256Signature{R: raw.R, S: raw.S}
+
+	if raw.DER != "" {
+		var der []byte
+		var err error
+		if strings.HasPrefix(raw.DER, "0x") {
+			der, err = hex.DecodeString(raw.DER[2:])
+		} else {
+			der, err = decodeB64URL(raw.DER)
+		}
+		if err != nil {
+			return fmt.Errorf("der 编码无效: %v", err)
+		}
+		r, s, err := parseDERSignature(der)
+		if err != nil {
+			return err
+		}
+		parsed := P256Signature{R: common.BigToHash(r).Hex(), S: common.BigToHash(s).Hex()}
+		if (raw.R != "" || raw.S != "") && (common.HexToHash(raw.R).Hex() != parsed.R || common.HexToHash(raw.S).Hex() != parsed.S) {
+			return fmt.Errorf("r/s 与 der 签名不一致")
+		}
+		*sig = parsed
+	}
+	for name, v := range map[string]string{"r": sig.R, "s": sig.S} {
+		if v == "" {
+			continue
+		}
+		if _, err := parseBytes32(v); err != nil {
+			return fmt.Errorf("签名 %s 无效: %v", name, err)
+		}
+	}
+
+	s := new(big.Int).SetBytes(common.FromHex(sig.S))
+	if s.Cmp(p256HalfN) > 0 && s.Cmp(elliptic.P256().Params().N) < 0 {
+		sig.S = common.BigToHash(new(big.Int).Sub(elliptic.P256().Params().N, s)).Hex()
+		sig.normalized = true
+	}
+	return nil
+}
+
+// parseDERSignature 解析 ASN.1 DER 编码的 ECDSA 签名 SEQUENCE { r INTEGER, s INTEGER }
+// 要求 r、s 在 [1, n) 范围内且没有多余字节
+func parseDERSignature(der []byte) (*big.Int, *big.Int, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("DER 签名解析失败: %v", err)
+	}
+	if len(rest) > 0 {
+		return nil, nil, fmt.Errorf("DER 签名末尾有 %d 字节多余数据", len(rest))
+	}
+	n := elliptic.P256().Params().N
+	if sig.R.Sign() <= 0 || sig.R.Cmp(n) >= 0 || sig.S.Sign() <= 0 || sig.S.Cmp(n) >= 0 {
+		return nil, nil, fmt.Errorf("DER 签名的 r/s 超出范围")
+	}
+	return sig.R, sig.S, nil
+}
+
+// Normalized 解析时 s 是否被规范化
+func (sig P256Signature) Normalized() bool {
+	return sig.normalized
+}
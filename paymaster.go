@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// PaymasterConfig VerifyingPaymaster 代付配置
+type PaymasterConfig struct {
+	Address                string   `yaml:"address"`                     // VerifyingPaymaster 合约地址
+	SigningKey             string   `yaml:"signing_key"`                 // 代付签名私钥 (paymaster 的 verifyingSigner)
+	ValiditySeconds        int64    `yaml:"validity_seconds"`            // 签名有效期，默认 600
+	VerificationGasLimit   uint64   `yaml:"verification_gas_limit"`      // 默认 100000
+	PostOpGasLimit         uint64   `yaml:"post_op_gas_limit"`           // 默认 50000
+	MaxOpsPerWalletPerDay  int      `yaml:"max_ops_per_wallet_per_day"`  // 0 表示不限
+	MaxCostPerWalletPerDay string   `yaml:"max_cost_per_wallet_per_day"` // 每个钱包每天最多代付的 gas 费用 (wei)
+	Wallets                []string `yaml:"wallets"`                     // 仅为这些钱包代付，留空表示全部
+}
+
+// sponsorshipUsage 钱包当天的代付用量
+type sponsorshipUsage struct {
+	Ops  int    `json:"ops"`
+	Cost string `json:"cost"` // wei
+}
+
+// paymasterSigner 为 UserOperation 生成 VerifyingPaymaster 的 paymasterAndData
+type paymasterSigner struct {
+	srv *Server
+}
+
+// config 返回补全默认值的配置与签名私钥，未配置时 ok 为 false
+func (p *paymasterSigner) config() (PaymasterConfig, *ecdsa.PrivateKey, bool) {
+	cfg := p.srv.Config().Paymaster
+	if cfg.Address == "" || cfg.SigningKey == "" {
+		return cfg, nil, false
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(cfg.SigningKey, "0x"))
+	if err != nil {
+		log.Printf("paymaster signing_key 格式错误: %v", err)
+		return cfg, nil, false
+	}
+	if cfg.ValiditySeconds == 0 {
+		cfg.ValiditySeconds = 600
+	}
+	if cfg.VerificationGasLimit == 0 {
+		cfg.VerificationGasLimit = 100000
+	}
+	if cfg.PostOpGasLimit == 0 {
+		cfg.PostOpGasLimit = 50000
+	}
+	return cfg, key, true
+}
+
+// allowed 按每钱包策略判断是否代付
+func (p *paymasterSigner) allowed(cfg PaymasterConfig, op *UserOperation) error {
+	if len(cfg.Wallets) > 0 {
+		found := false
+		for _, w := range cfg.Wallets {
+			if common.HexToAddress(w) == op.Sender {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("钱包不在代付名单中")
+		}
+	}
+
+	usage := p.usage(op.Sender)
+	if cfg.MaxOpsPerWalletPerDay > 0 && usage.Ops >= cfg.MaxOpsPerWalletPerDay {
+		return fmt.Errorf("今日代付次数已达上限 %d", cfg.MaxOpsPerWalletPerDay)
+	}
+	if cfg.MaxCostPerWalletPerDay != "" {
+		limit, ok := new(big.Int).SetString(cfg.MaxCostPerWalletPerDay, 10)
+		used, _ := new(big.Int).SetString(usage.Cost, 10)
+		if ok && used != nil && used.Cmp(limit) >= 0 {
+			return fmt.Errorf("今日代付费用已达上限 %s wei", limit)
+		}
+	}
+	return nil
+}
+
+// attach 符合策略时填入 paymaster 字段 (占位签名)，返回是否代付
+func (p *paymasterSigner) attach(op *UserOperation) bool {
+	cfg, _, ok := p.config()
+	if !ok {
+		return false
+	}
+	if err := p.allowed(cfg, op); err != nil {
+		log.Printf("钱包 %s 不代付: %v", op.Sender.Hex(), err)
+		return false
+	}
+
+	paymaster := common.HexToAddress(cfg.Address)
+	op.Paymaster = &paymaster
+	op.PaymasterVerificationGasLimit = new(big.Int).SetUint64(cfg.VerificationGasLimit)
+	op.PaymasterPostOpGasLimit = new(big.Int).SetUint64(cfg.PostOpGasLimit)
+	op.PaymasterData = append(encodeValidity(0, 0), make([]byte, 65)...)
+	return true
+}
+
+// sign 在 gas 字段确定后签名 paymasterData = abi.encode(validUntil, validAfter) ‖ signature
+func (p *paymasterSigner) sign(op *UserOperation, chainID *big.Int) error {
+	cfg, key, ok := p.config()
+	if !ok {
+		return fmt.Errorf("paymaster 未配置")
+	}
+
+	now := time.Now().Unix()
+	validUntil, validAfter := uint64(now+cfg.ValiditySeconds), uint64(now-60)
+	hash := paymasterHash(op, common.HexToAddress(cfg.Address), chainID, validUntil, validAfter)
+
+	sig, err := crypto.Sign(accounts.TextHash(hash.Bytes()), key)
+	if err != nil {
+		return fmt.Errorf("paymaster 签名失败: %v", err)
+	}
+	sig[64] += 27
+
+	op.PaymasterData = append(encodeValidity(validUntil, validAfter), sig...)
+	return nil
+}
+
+// recordUsage 记录代付用量 (按最大可能费用计)
+func (p *paymasterSigner) recordUsage(op *UserOperation) {
+	usage := p.usage(op.Sender)
+	used, ok := new(big.Int).SetString(usage.Cost, 10)
+	if !ok {
+		used = new(big.Int)
+	}
+	gas := new(big.Int).Add(op.CallGasLimit, op.VerificationGasLimit)
+	gas.Add(gas, op.PreVerificationGas)
+	gas.Add(gas, op.PaymasterVerificationGasLimit)
+	gas.Add(gas, op.PaymasterPostOpGasLimit)
+	used.Add(used, gas.Mul(gas, op.MaxFeePerGas))
+
+	usage.Ops++
+	usage.Cost = used.String()
+	if err := putJSON(p.srv.storage, nsPolicies, sponsorshipKey(op.Sender), usage, 48*time.Hour); err != nil {
+		log.Printf("记录代付用量失败: %v", err)
+	}
+}
+
+func (p *paymasterSigner) usage(wallet common.Address) sponsorshipUsage {
+	usage := sponsorshipUsage{Cost: "0"}
+	getJSON(p.srv.storage, nsPolicies, sponsorshipKey(wallet), &usage)
+	return usage
+}
+
+func sponsorshipKey(wallet common.Address) string {
+	return "sponsorship/" + wallet.Hex() + "/" + time.Now().UTC().Format("2006-01-02")
+}
+
+// encodeValidity abi.encode(uint48 validUntil, uint48 validAfter)
+func encodeValidity(validUntil, validAfter uint64) []byte {
+	out := make([]byte, 64)
+	new(big.Int).SetUint64(validUntil).FillBytes(out[:32])
+	new(big.Int).SetUint64(validAfter).FillBytes(out[32:])
+	return out
+}
+
+// paymasterHash 与 VerifyingPaymaster (v0.7) 的 getHash 一致
+func paymasterHash(op *UserOperation, paymaster common.Address, chainID *big.Int, validUntil, validAfter uint64) common.Hash {
+	p := op.pack()
+
+	bytes32Ty, _ := abi.NewType("bytes32", "", nil)
+	addressTy, _ := abi.NewType("address", "", nil)
+	uint256Ty, _ := abi.NewType("uint256", "", nil)
+	uint48Ty, _ := abi.NewType("uint48", "", nil)
+
+	// paymasterAndData[20:52] = paymasterVerificationGasLimit ‖ paymasterPostOpGasLimit
+	pmGasLimits := new(big.Int).SetBytes(p.PaymasterAndData[20:52])
+
+	encoded, _ := abi.Arguments{
+		{Type: addressTy}, {Type: uint256Ty}, {Type: bytes32Ty}, {Type: bytes32Ty},
+		{Type: bytes32Ty}, {Type: uint256Ty}, {Type: uint256Ty}, {Type: bytes32Ty},
+		{Type: uint256Ty}, {Type: addressTy}, {Type: uint48Ty}, {Type: uint48Ty},
+	}.Pack(
+		p.Sender, p.Nonce, crypto.Keccak256Hash(p.InitCode), crypto.Keccak256Hash(p.CallData),
+		p.AccountGasLimits, pmGasLimits, p.PreVerificationGas, p.GasFees,
+		chainID, paymaster, new(big.Int).SetUint64(validUntil), new(big.Int).SetUint64(validAfter),
+	)
+	return crypto.Keccak256Hash(encoded)
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// permitMinLifetime permit 的 deadline 至少还剩多久，留出交易上链的时间
+const permitMinLifetime = 2 * time.Minute
+
+// auditPermitTransfer permit 转账的审计动作
+const auditPermitTransfer = "permit_transfer"
+
+var (
+	permitTypeHash = crypto.Keccak256Hash([]byte("Permit(address owner,address spender,uint256 value,uint256 nonce,uint256 deadline)"))
+	eip712TypeHash = crypto.Keccak256Hash([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+)
+
+// EIP-2612 代币 ABI (探测与 EIP-712 域)
+const erc20PermitABI = `[
+	{
+		"inputs": [],
+		"name": "DOMAIN_SEPARATOR",
+		"outputs": [{"type": "bytes32"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [{"name": "owner", "type": "address"}],
+		"name": "nonces",
+		"outputs": [{"type": "uint256"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "name",
+		"outputs": [{"type": "string"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "version",
+		"outputs": [{"type": "string"}],
+		"stateMutability": "view",
+		"type": "function"
+	}
+]`
+
+// PermitTransfer 合约 ABI (contract/PermitTransfer.sol)
+const permitTransferABI = `[
+	{
+		"inputs": [
+			{"name": "token", "type": "address"},
+			{"name": "from", "type": "address"},
+			{"name": "to", "type": "address"},
+			{"name": "value", "type": "uint256"},
+			{"name": "deadline", "type": "uint256"},
+			{"name": "v", "type": "uint8"},
+			{"name": "r", "type": "bytes32"},
+			{"name": "s", "type": "bytes32"}
+		],
+		"name": "permitAndTransfer",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	}
+]`
+
+// PermitInfo GET /api/permit 返回数据: 代币是否支持 EIP-2612，以及签名需要的 EIP-712 参数
+type PermitInfo struct {
+	Token           string `json:"token"`
+	Supported       bool   `json:"supported"`
+	Reason          string `json:"reason,omitempty"` // 不支持的原因
+	Name            string `json:"name,omitempty"`
+	Version         string `json:"version,omitempty"` // 代币没有 version() 时为 "1"
+	ChainID         int64  `json:"chainId"`
+	DomainSeparator string `json:"domainSeparator,omitempty"`
+	DomainMatches   bool   `json:"domainMatches"`   // 按 name / version / chainId / 代币地址算出的域与 DOMAIN_SEPARATOR() 一致
+	Spender         string `json:"spender"`         // permit 的 spender (permit_contract)
+	Nonce           string `json:"nonce,omitempty"` // 指定 owner 时返回其当前 nonce
+}
+
+// PermitTransferRequest POST /api/permit 请求: owner 离线签名的 permit，中继执行 permit + transferFrom
+type PermitTransferRequest struct {
+	Token     string `json:"token"`
+	Owner     string `json:"owner"`     // 代币持有人 (签名 permit 的 EOA)
+	To        string `json:"to"`        // 接收地址 (如用户的 PasskeyWallet)
+	Amount    string `json:"amount"`    // 转账金额 (最小单位)，即 permit 的 value
+	Deadline  int64  `json:"deadline"`  // permit 的 deadline (unix 秒)
+	Signature string `json:"signature"` // eth_signTypedData_v4 返回的 65 字节签名
+
+	MaxGasPrice string `json:"maxGasPrice,omitempty"` // 可选: 本次转账接受的最高 gas price (wei)
+
+	requestID string
+}
+
+// asTransfer 转换为转账请求，复用合规筛查、费用检查与审计 (钱包记为 owner)
+func (req *PermitTransferRequest) asTransfer() *ERC20TransferRequest {
+	return &ERC20TransferRequest{
+		Wallet:      req.Owner,
+		Token:       req.Token,
+		To:          req.To,
+		Amount:      req.Amount,
+		MaxGasPrice: req.MaxGasPrice,
+		requestID:   req.requestID,
+	}
+}
+
+// permitSpender 配置的 PermitTransfer 合约，未配置时返回 false
+func (srv *Server) permitSpender() (common.Address, bool) {
+	addr := srv.Config().PermitContract
+	if !common.IsHexAddress(addr) {
+		return common.Address{}, false
+	}
+	return common.HexToAddress(addr), true
+}
+
+// callPermitView 调用代币的无参数或单地址参数 view 方法，返回原始结果
+func (srv *Server) callPermitView(parsedABI abi.ABI, token common.Address, method string, args ...interface{}) ([]byte, error) {
+	data, err := parsedABI.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	return srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &token, Data: data}, nil)
+}
+
+// probePermit 通过 DOMAIN_SEPARATOR() 与 nonces(owner) 探测代币是否支持 EIP-2612
+//
+// 两个方法都返回 32 字节才认为支持；name() / version() 只用于核对域，缺失不影响签名
+// (签名按链上 DOMAIN_SEPARATOR 计算)。
+func (srv *Server) probePermit(token, owner common.Address) *PermitInfo {
+	info := &PermitInfo{Token: token.Hex(), ChainID: srv.chainID.Int64()}
+	if spender, ok := srv.permitSpender(); ok {
+		info.Spender = spender.Hex()
+	}
+	parsedABI, _ := abi.JSON(strings.NewReader(erc20PermitABI))
+
+	domain, err := srv.callPermitView(parsedABI, token, "DOMAIN_SEPARATOR")
+	if err != nil || len(domain) != 32 {
+		info.Reason = "代币没有 DOMAIN_SEPARATOR()"
+		return info
+	}
+	nonce, err := srv.callPermitView(parsedABI, token, "nonces", owner)
+	if err != nil || len(nonce) != 32 {
+		info.Reason = "代币没有 nonces(address)"
+		return info
+	}
+	info.Supported = true
+	info.DomainSeparator = hexutil.Encode(domain)
+	info.Nonce = new(big.Int).SetBytes(nonce).String()
+
+	info.Version = "1"
+	if out, err := srv.callPermitView(parsedABI, token, "version"); err == nil {
+		if res, err := parsedABI.Unpack("version", out); err == nil && len(res) == 1 {
+			info.Version = res[0].(string)
+		}
+	}
+	if out, err := srv.callPermitView(parsedABI, token, "name"); err == nil {
+		if res, err := parsedABI.Unpack("name", out); err == nil && len(res) == 1 {
+			info.Name = res[0].(string)
+		}
+	}
+	expected := crypto.Keccak256Hash(
+		eip712TypeHash[:],
+		crypto.Keccak256([]byte(info.Name)),
+		crypto.Keccak256([]byte(info.Version)),
+		common.LeftPadBytes(srv.chainID.Bytes(), 32),
+		common.LeftPadBytes(token[:], 32),
+	)
+	info.DomainMatches = expected == common.BytesToHash(domain)
+	return info
+}
+
+// permitDigest EIP-712 摘要: keccak256("\x19\x01" || domainSeparator || hashStruct(Permit))
+func permitDigest(domain common.Hash, owner, spender common.Address, value, nonce, deadline *big.Int) common.Hash {
+	structHash := crypto.Keccak256(
+		permitTypeHash[:],
+		common.LeftPadBytes(owner[:], 32),
+		common.LeftPadBytes(spender[:], 32),
+		common.LeftPadBytes(value.Bytes(), 32),
+		common.LeftPadBytes(nonce.Bytes(), 32),
+		common.LeftPadBytes(deadline.Bytes(), 32),
+	)
+	return crypto.Keccak256Hash([]byte("\x19\x01"), domain[:], structHash)
+}
+
+// validatePermitTransfer 校验请求，并在本地按链上 DOMAIN_SEPARATOR 与当前 nonce 恢复签名者
+// 返回拆分后的签名 (v 为 27/28)
+func (srv *Server) validatePermitTransfer(req *PermitTransferRequest) (v uint8, r, s common.Hash, err error) {
+	if req.Token == "" || req.Owner == "" || req.To == "" || req.Amount == "" || req.Signature == "" {
+		return 0, r, s, fmt.Errorf("缺少必要参数: token, owner, to, amount, deadline, signature")
+	}
+	for name, addr := range map[string]string{"token": req.Token, "owner": req.Owner, "to": req.To} {
+		if !common.IsHexAddress(addr) {
+			return 0, r, s, fmt.Errorf("%s 地址格式错误: %s", name, addr)
+		}
+	}
+	amount, ok := new(big.Int).SetString(req.Amount, 10)
+	if !ok || amount.Sign() <= 0 || amount.BitLen() > 256 {
+		return 0, r, s, fmt.Errorf("金额格式错误: %s", req.Amount)
+	}
+	if time.Unix(req.Deadline, 0).Before(time.Now().Add(permitMinLifetime)) {
+		return 0, r, s, fmt.Errorf("permit 已过期或即将过期 (deadline 至少需要晚于当前 %s)", permitMinLifetime)
+	}
+	sig, err := hexutil.Decode(req.Signature)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return 0, r, s, fmt.Errorf("signature 需要 65 字节十六进制")
+	}
+
+	transfer := req.asTransfer()
+	if err := srv.screenTransfer(transfer); err != nil {
+		return 0, r, s, err
+	}
+
+	spender, _ := srv.permitSpender()
+	token := common.HexToAddress(req.Token)
+	owner := common.HexToAddress(req.Owner)
+	info := srv.probePermit(token, owner)
+	if !info.Supported {
+		return 0, r, s, fmt.Errorf("代币不支持 EIP-2612 permit: %s", info.Reason)
+	}
+
+	// 签名 v 为 27/28 (钱包返回) 或 0/1
+	v = sig[64]
+	if v < 27 {
+		v += 27
+	}
+	nonce, _ := new(big.Int).SetString(info.Nonce, 10)
+	digest := permitDigest(common.HexToHash(info.DomainSeparator), owner, spender, amount, nonce, big.NewInt(req.Deadline))
+	recoverable := append(append([]byte{}, sig[:64]...), v-27)
+	pub, err := crypto.SigToPub(digest[:], recoverable)
+	if err != nil || crypto.PubkeyToAddress(*pub) != owner {
+		return 0, r, s, fmt.Errorf("permit 签名与 owner 不符 (spender 应为 %s，nonce 应为 %s)", spender.Hex(), info.Nonce)
+	}
+
+	balance, _, _, err := srv.getERC20Balance(req.Token, req.Owner)
+	if err != nil {
+		return 0, r, s, fmt.Errorf("查询余额失败: %v", err)
+	}
+	if balance.Cmp(amount) < 0 {
+		return 0, r, s, fmt.Errorf("余额不足: 持有 %s，转账 %s", balance, amount)
+	}
+	if err := srv.checkTransferFees(transfer); err != nil {
+		return 0, r, s, err
+	}
+	return v, common.BytesToHash(sig[:32]), common.BytesToHash(sig[32:64]), nil
+}
+
+// handlePermit EIP-2612 permit 转账
+//
+//	GET  /api/permit?token=0x..&owner=0x..  探测代币是否支持 permit，返回签名所需的 EIP-712 域与 nonce
+//	POST /api/permit                        中继在一笔交易中执行 permit + transferFrom
+func (srv *Server) handlePermit(w http.ResponseWriter, r *http.Request) {
+	spender, ok := srv.permitSpender()
+	if !ok {
+		sendError(w, "未配置 permit_contract，不支持 permit 转账")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		token := r.URL.Query().Get("token")
+		owner := r.URL.Query().Get("owner")
+		if !common.IsHexAddress(token) {
+			sendError(w, "token 地址格式错误: "+token)
+			return
+		}
+		if owner != "" && !common.IsHexAddress(owner) {
+			sendError(w, "owner 地址格式错误: "+owner)
+			return
+		}
+		info := srv.probePermit(common.HexToAddress(token), common.HexToAddress(owner))
+		if owner == "" {
+			info.Nonce = ""
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Data:    info,
+		})
+
+	case "POST":
+		if srv.signer() == nil {
+			sendError(w, "未配置私钥，无法发送交易")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req PermitTransferRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		req.requestID = requestIDFrom(r)
+		transfer := req.asTransfer()
+
+		v, sigR, sigS, err := srv.validatePermitTransfer(&req)
+		if err != nil {
+			srv.audit(auditPermitTransfer, transfer, common.Hash{}, err)
+			sendError(w, err.Error())
+			return
+		}
+
+		amount, _ := new(big.Int).SetString(req.Amount, 10)
+		parsedABI, _ := abi.JSON(strings.NewReader(permitTransferABI))
+		callData, err := parsedABI.Pack("permitAndTransfer",
+			common.HexToAddress(req.Token), common.HexToAddress(req.Owner), common.HexToAddress(req.To),
+			amount, big.NewInt(req.Deadline), v, sigR, sigS)
+		if err != nil {
+			sendError(w, "编码调用数据失败: "+err.Error())
+			return
+		}
+		if cfg := srv.Config(); cfg.TraceCalldata {
+			callData = appendTraceTag(callData, req.requestID)
+		}
+
+		var txHash common.Hash
+		if err = srv.dryRun(spender, callData); err == nil {
+			txHash, err = srv.sendTransaction(spender, big.NewInt(0), callData)
+		}
+		srv.audit(auditPermitTransfer, transfer, txHash, err)
+		if err != nil {
+			sendError(w, "permit 转账失败: "+err.Error())
+			return
+		}
+		srv.recordPermitTransfer(&req, txHash)
+
+		resp := APIResponse{
+			Success:  true,
+			Message:  "permit 转账交易已发送",
+			TxHash:   txHash.Hex(),
+			Warnings: srv.recipientWarnings(common.HexToAddress(req.Owner), common.HexToAddress(req.To)),
+		}
+		srv.awaitTransfer(r, &resp, txHash, nil, "permit 转账")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// recordPermitTransfer 记录一次 permit 转账 (钱包记为 owner)
+func (srv *Server) recordPermitTransfer(req *PermitTransferRequest, txHash common.Hash) {
+	token := common.HexToAddress(req.Token)
+	parsedABI, _ := abi.JSON(strings.NewReader(erc20ABI))
+	meta := srv.getTokenMetadata(parsedABI, token)
+	amount, _ := new(big.Int).SetString(req.Amount, 10)
+	precision, locale := srv.formatOptions("", "")
+	srv.addHistory(HistoryRecord{
+		Type:      "permit_transfer",
+		Wallet:    common.HexToAddress(req.Owner).Hex(),
+		Token:     token.Hex(),
+		To:        common.HexToAddress(req.To).Hex(),
+		Amount:    req.Amount,
+		Formatted: formatAmount(amount, meta.Decimals, precision, locale),
+		Decimals:  meta.Decimals,
+		Symbol:    meta.Symbol,
+		TxHash:    txHash.Hex(),
+	})
+}
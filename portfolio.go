@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 单次组合查询的上限 (aggregate3 的 gas 与返回数据随 代币数 × 地址数 增长)
+const (
+	maxPortfolioTokens    = 50
+	maxPortfolioAddresses = 50
+	maxPortfolioPairs     = 500
+)
+
+// PortfolioRequest POST /api/portfolio 请求体 (GET 时用逗号分隔的 tokens / addresses 参数)
+type PortfolioRequest struct {
+	Tokens    []string `json:"tokens"` // 零地址表示原生 ETH
+	Addresses []string `json:"addresses"`
+	Precision string   `json:"precision,omitempty"`
+	Locale    string   `json:"locale,omitempty"`
+}
+
+// PortfolioToken 代币信息
+type PortfolioToken struct {
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Decimals uint8  `json:"decimals"`
+	USDPrice string `json:"usdPrice,omitempty"`
+}
+
+// PortfolioBalance 某地址持有的某代币
+type PortfolioBalance struct {
+	Token     string `json:"token"`
+	Balance   string `json:"balance,omitempty"`
+	Formatted string `json:"formatted,omitempty"`
+	USDValue  string `json:"usdValue,omitempty"`
+	Error     string `json:"error,omitempty"` // 该项调用回滚 (不是 ERC20 等)
+}
+
+// PortfolioAccount 一个地址的全部余额
+type PortfolioAccount struct {
+	Address  string             `json:"address"`
+	Balances []PortfolioBalance `json:"balances"`
+	USDTotal string             `json:"usdTotal,omitempty"` // 有价格的代币合计
+}
+
+// PortfolioData /api/portfolio 返回数据
+type PortfolioData struct {
+	Tokens   []PortfolioToken   `json:"tokens"`
+	Accounts []PortfolioAccount `json:"accounts"`
+}
+
+// splitList 解析逗号分隔的查询参数
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// parsePortfolioAddresses 校验并去重地址
+func parsePortfolioAddresses(field string, list []string, limit int) ([]common.Address, error) {
+	if len(list) == 0 {
+		return nil, fmt.Errorf("缺少参数: %s", field)
+	}
+	var out []common.Address
+	seen := make(map[common.Address]bool)
+	for _, s := range list {
+		if !common.IsHexAddress(s) {
+			return nil, fmt.Errorf("地址格式错误: %s", s)
+		}
+		addr := common.HexToAddress(s)
+		if !seen[addr] {
+			seen[addr] = true
+			out = append(out, addr)
+		}
+	}
+	if len(out) > limit {
+		return nil, fmt.Errorf("%s 最多 %d 个", field, limit)
+	}
+	return out, nil
+}
+
+// portfolio 用一次 Multicall3 aggregate3 eth_call 读取 tokens × addresses 的余额，
+// 未缓存的代币 symbol / decimals 也放在同一次调用中
+func (srv *Server) portfolio(tokens, addrs []common.Address, precision int, locale string) (*PortfolioData, error) {
+	mcABI, _ := abi.JSON(strings.NewReader(multicall3ABI))
+	erc20, _ := abi.JSON(strings.NewReader(erc20ABI))
+
+	var calls []multicall3Call
+	add := func(target common.Address, data []byte) int {
+		calls = append(calls, multicall3Call{Target: target, AllowFailure: true, CallData: data})
+		return len(calls) - 1
+	}
+
+	type metaCall struct{ symbol, decimals int }
+	metaCalls := make(map[common.Address]metaCall)
+	metas := make(map[common.Address]tokenMetadata)
+	symbolData, _ := erc20.Pack("symbol")
+	decimalsData, _ := erc20.Pack("decimals")
+	for _, token := range tokens {
+		if token == (common.Address{}) {
+			metas[token] = tokenMetadata{Symbol: "ETH", Decimals: 18}
+			continue
+		}
+		if meta, ok := srv.cachedTokenMetadata(token); ok {
+			metas[token] = meta
+			continue
+		}
+		metaCalls[token] = metaCall{symbol: add(token, symbolData), decimals: add(token, decimalsData)}
+	}
+
+	balanceIdx := make([][]int, len(addrs))
+	for i, addr := range addrs {
+		balanceIdx[i] = make([]int, len(tokens))
+		for j, token := range tokens {
+			if token == (common.Address{}) {
+				data, _ := mcABI.Pack("getEthBalance", addr)
+				balanceIdx[i][j] = add(multicall3Address, data)
+			} else {
+				data, _ := erc20.Pack("balanceOf", addr)
+				balanceIdx[i][j] = add(token, data)
+			}
+		}
+	}
+
+	data, err := mcABI.Pack("aggregate3", calls)
+	if err != nil {
+		return nil, fmt.Errorf("编码 multicall 失败: %v", err)
+	}
+	out, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &multicall3Address, Data: data}, nil)
+	if err != nil {
+		srv.rpc.reportError(err)
+		return nil, fmt.Errorf("查询余额失败: %v", decodeRevert(err))
+	}
+	var results []multicall3Result
+	if err := mcABI.UnpackIntoInterface(&results, "aggregate3", out); err != nil || len(results) != len(calls) {
+		return nil, fmt.Errorf("解析 multicall 结果失败 (链上是否部署了 Multicall3?)")
+	}
+
+	for token, mc := range metaCalls {
+		var meta tokenMetadata
+		symbolOK := results[mc.symbol].Success && erc20.UnpackIntoInterface(&meta.Symbol, "symbol", results[mc.symbol].ReturnData) == nil
+		decimalsOK := results[mc.decimals].Success && erc20.UnpackIntoInterface(&meta.Decimals, "decimals", results[mc.decimals].ReturnData) == nil
+		if symbolOK && decimalsOK {
+			srv.setTokenMetadata(token, meta)
+		}
+		metas[token] = meta
+	}
+
+	result := &PortfolioData{}
+	prices := make([]*usdPrice, len(tokens))
+	for j, token := range tokens {
+		meta := metas[token]
+		info := PortfolioToken{Address: token.Hex(), Symbol: meta.Symbol, Decimals: meta.Decimals}
+		if price, err := srv.latestUSDPrice(token); err == nil && price != nil {
+			prices[j] = price
+			answer, _ := new(big.Int).SetString(price.Answer, 10)
+			info.USDPrice = plainDecimal(answer, price.Decimals)
+		}
+		result.Tokens = append(result.Tokens, info)
+	}
+
+	for i, addr := range addrs {
+		account := PortfolioAccount{Address: addr.Hex(), Balances: make([]PortfolioBalance, 0, len(tokens))}
+		total, priced := new(big.Rat), false
+		for j, token := range tokens {
+			item := PortfolioBalance{Token: token.Hex()}
+			res := results[balanceIdx[i][j]]
+			if !res.Success || len(res.ReturnData) < 32 {
+				item.Error = "查询余额失败"
+				account.Balances = append(account.Balances, item)
+				continue
+			}
+			balance := new(big.Int).SetBytes(res.ReturnData[:32])
+			decimals := metas[token].Decimals
+			item.Balance = balance.String()
+			item.Formatted = formatAmount(balance, decimals, precision, locale)
+			if prices[j] != nil {
+				_, item.USDValue = prices[j].usd(balance, decimals)
+				if v, ok := new(big.Rat).SetString(item.USDValue); ok {
+					total.Add(total, v)
+					priced = true
+				}
+			}
+			account.Balances = append(account.Balances, item)
+		}
+		if priced {
+			account.USDTotal = total.FloatString(2)
+		}
+		result.Accounts = append(result.Accounts, account)
+	}
+	return result, nil
+}
+
+// handlePortfolio 多个地址在多个代币上的余额 (一次 Multicall3 调用)
+//
+//	GET  /api/portfolio?tokens=0xA,0xB&addresses=0x1,0x2[&precision=&locale=]
+//	POST /api/portfolio {"tokens": [...], "addresses": [...]}
+func (srv *Server) handlePortfolio(w http.ResponseWriter, r *http.Request) {
+	var req PortfolioRequest
+	switch r.Method {
+	case "GET":
+		q := r.URL.Query()
+		req = PortfolioRequest{
+			Tokens:    splitList(q.Get("tokens")),
+			Addresses: splitList(q.Get("addresses")),
+			Precision: q.Get("precision"),
+			Locale:    q.Get("locale"),
+		}
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+	}
+
+	tokens, err := parsePortfolioAddresses("tokens", req.Tokens, maxPortfolioTokens)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	addrs, err := parsePortfolioAddresses("addresses", req.Addresses, maxPortfolioAddresses)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	if len(tokens)*len(addrs) > maxPortfolioPairs {
+		sendError(w, fmt.Sprintf("代币数 × 地址数最多 %d", maxPortfolioPairs))
+		return
+	}
+
+	precision, locale := srv.formatOptions(req.Precision, req.Locale)
+	data, err := srv.portfolio(tokens, addrs, precision, locale)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Data: data})
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PriceOracleConfig 代币 USD 价格来源
+//
+//	price_oracle:
+//	  provider: "chainlink"      # chainlink (默认，读取 feeds 中的喂价合约) / coingecko
+//	  cache_ttl: 60              # 最新价格的缓存秒数
+//	  feeds:
+//	    "0x代币地址": "0x<代币>/USD 喂价合约地址"
+//	  coingecko:
+//	    platform: "ethereum"     # 资产平台 id，按合约地址查询代币价格
+//	    native_id: "ethereum"    # 原生 ETH (零地址) 对应的币种 id
+//	    api_key: ""
+type PriceOracleConfig struct {
+	Provider  string            `yaml:"provider"`
+	CacheTTL  int               `yaml:"cache_ttl"`
+	Feeds     map[string]string `yaml:"feeds"` // 代币地址 -> <代币>/USD 喂价合约地址
+	CoinGecko CoinGeckoConfig   `yaml:"coingecko"`
+}
+
+// CoinGeckoConfig CoinGecko simple price API
+type CoinGeckoConfig struct {
+	BaseURL  string `yaml:"base_url"` // 默认公共 API，pro key 需改为 https://pro-api.coingecko.com/api/v3
+	APIKey   string `yaml:"api_key"`
+	Platform string `yaml:"platform"`
+	NativeID string `yaml:"native_id"`
+}
+
+const (
+	priceProviderChainlink = "chainlink"
+	priceProviderCoinGecko = "coingecko"
+
+	defaultPriceCacheTTL    = 60 * time.Second
+	defaultCoinGeckoBaseURL = "https://api.coingecko.com/api/v3"
+	coinGeckoDecimals       = 8 // CoinGecko 返回浮点数，按 8 位小数 (与 Chainlink USD 喂价一致) 换算为整数
+)
+
+// PriceProvider 代币 USD 价格来源
+type PriceProvider interface {
+	// Name 来源名称，用于缓存 key 与日志
+	Name() string
+	// Supports 是否能为该代币报价 (零地址为原生 ETH)
+	Supports(token common.Address) bool
+	// Quote 读取最新价格
+	Quote(ctx context.Context, token common.Address) (*usdPrice, error)
+}
+
+// chainlinkAggregatorABI AggregatorV3Interface 中用到的方法
+const chainlinkAggregatorABI = `[
+	{"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"stateMutability":"view","type":"function"},
+	{"inputs":[],"name":"latestRoundData","outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}],"stateMutability":"view","type":"function"}
+]`
+
+// usdPrice 代币的 USD 价格
+//
+// 历史记录按天缓存 (nsPrices，key = token/日期): 取当天第一次用到时的价格，当天后续的记录沿用同一价格，便于对账。
+type usdPrice struct {
+	Answer    string `json:"answer"`   // 喂价原始值
+	Decimals  uint8  `json:"decimals"` // 喂价精度
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// usd 将金额换算为 USD，返回单价与总价的十进制字符串
+func (p usdPrice) usd(amount *big.Int, tokenDecimals uint8) (price, value string) {
+	answer, _ := new(big.Int).SetString(p.Answer, 10)
+	if answer == nil || amount == nil {
+		return "", ""
+	}
+	total := new(big.Rat).Mul(scaled(answer, p.Decimals), scaled(amount, tokenDecimals))
+	return plainDecimal(answer, p.Decimals), total.FloatString(2)
+}
+
+// scaled 返回 v / 10^decimals
+func scaled(v *big.Int, decimals uint8) *big.Rat {
+	return new(big.Rat).SetFrac(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+}
+
+// plainDecimal 不带千分位、不截断的十进制字符串，用于导出
+func plainDecimal(v *big.Int, decimals uint8) string {
+	s := scaled(v, decimals).FloatString(int(decimals))
+	if decimals > 0 {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// priceFeed 返回代币配置的喂价合约
+func (srv *Server) priceFeed(token common.Address) (common.Address, bool) {
+	for addr, feed := range srv.Config().PriceOracle.Feeds {
+		if common.HexToAddress(addr) == token {
+			return common.HexToAddress(feed), true
+		}
+	}
+	return common.Address{}, false
+}
+
+// chainlinkPrices 从 Chainlink AggregatorV3 喂价合约读取价格
+type chainlinkPrices struct {
+	srv *Server
+}
+
+func (p chainlinkPrices) Name() string { return priceProviderChainlink }
+
+func (p chainlinkPrices) Supports(token common.Address) bool {
+	_, ok := p.srv.priceFeed(token)
+	return ok
+}
+
+func (p chainlinkPrices) Quote(ctx context.Context, token common.Address) (*usdPrice, error) {
+	feed, ok := p.srv.priceFeed(token)
+	if !ok {
+		return nil, fmt.Errorf("代币 %s 未配置喂价", token.Hex())
+	}
+	parsedABI, _ := abi.JSON(strings.NewReader(chainlinkAggregatorABI))
+	call := func(method string) ([]interface{}, error) {
+		data, _ := parsedABI.Pack(method)
+		out, err := p.srv.eth().CallContract(ctx, ethereum.CallMsg{To: &feed, Data: data}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return parsedABI.Unpack(method, out)
+	}
+	dec, err := call("decimals")
+	if err != nil {
+		return nil, fmt.Errorf("读取喂价精度失败: %v", err)
+	}
+	round, err := call("latestRoundData")
+	if err != nil {
+		return nil, fmt.Errorf("读取喂价失败: %v", err)
+	}
+	answer := round[1].(*big.Int)
+	if answer.Sign() <= 0 {
+		return nil, fmt.Errorf("喂价无效: %s", answer)
+	}
+	return &usdPrice{
+		Answer:    answer.String(),
+		Decimals:  dec[0].(uint8),
+		UpdatedAt: round[3].(*big.Int).Int64(),
+	}, nil
+}
+
+// coinGeckoPrices 从 CoinGecko simple price API 读取价格
+type coinGeckoPrices struct {
+	cfg    CoinGeckoConfig
+	client *http.Client
+}
+
+func (p coinGeckoPrices) Name() string { return priceProviderCoinGecko }
+
+func (p coinGeckoPrices) Supports(token common.Address) bool {
+	if token == (common.Address{}) {
+		return true
+	}
+	return p.cfg.Platform != ""
+}
+
+func (p coinGeckoPrices) Quote(ctx context.Context, token common.Address) (*usdPrice, error) {
+	base := strings.TrimRight(p.cfg.BaseURL, "/")
+	if base == "" {
+		base = defaultCoinGeckoBaseURL
+	}
+	var (
+		endpoint string
+		key      string
+	)
+	if token == (common.Address{}) {
+		key = p.cfg.NativeID
+		if key == "" {
+			key = "ethereum"
+		}
+		endpoint = base + "/simple/price?ids=" + url.QueryEscape(key)
+	} else {
+		if p.cfg.Platform == "" {
+			return nil, fmt.Errorf("未配置 price_oracle.coingecko.platform")
+		}
+		key = strings.ToLower(token.Hex())
+		endpoint = base + "/simple/token_price/" + url.PathEscape(p.cfg.Platform) + "?contract_addresses=" + key
+	}
+	endpoint += "&vs_currencies=usd&include_last_updated_at=true"
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.APIKey != "" {
+		if strings.Contains(base, "pro-api.") {
+			req.Header.Set("x-cg-pro-api-key", p.cfg.APIKey)
+		} else {
+			req.Header.Set("x-cg-demo-api-key", p.cfg.APIKey)
+		}
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 CoinGecko 失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CoinGecko 返回 HTTP %d", resp.StatusCode)
+	}
+
+	var body map[string]struct {
+		USD           json.Number `json:"usd"`
+		LastUpdatedAt int64       `json:"last_updated_at"`
+	}
+	dec := json.NewDecoder(io.LimitReader(resp.Body, 1<<20))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		return nil, fmt.Errorf("解析 CoinGecko 响应失败: %v", err)
+	}
+	quote, ok := body[key]
+	if !ok || quote.USD == "" {
+		return nil, fmt.Errorf("CoinGecko 没有 %s 的价格", key)
+	}
+	value, ok := new(big.Rat).SetString(quote.USD.String())
+	if !ok || value.Sign() <= 0 {
+		return nil, fmt.Errorf("CoinGecko 价格无效: %s", quote.USD)
+	}
+	value.Mul(value, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(coinGeckoDecimals), nil)))
+	answer := new(big.Int).Quo(value.Num(), value.Denom())
+	return &usdPrice{Answer: answer.String(), Decimals: coinGeckoDecimals, UpdatedAt: quote.LastUpdatedAt}, nil
+}
+
+// priceProvider 按配置返回价格来源
+func (srv *Server) priceProvider() PriceProvider {
+	cfg := srv.Config().PriceOracle
+	if cfg.Provider == priceProviderCoinGecko {
+		return coinGeckoPrices{cfg: cfg.CoinGecko, client: srv.prices.client}
+	}
+	return chainlinkPrices{srv: srv}
+}
+
+// priceCache 最新价格的内存缓存，避免每次查询余额都读喂价 / 请求 CoinGecko
+type priceCache struct {
+	client *http.Client
+
+	mu      sync.Mutex
+	entries map[string]cachedPrice
+}
+
+type cachedPrice struct {
+	price     *usdPrice
+	fetchedAt time.Time
+}
+
+func newPriceCache() *priceCache {
+	return &priceCache{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		entries: make(map[string]cachedPrice),
+	}
+}
+
+func (c *priceCache) get(key string, ttl time.Duration) (*usdPrice, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Since(e.fetchedAt) >= ttl {
+		return nil, false
+	}
+	return e.price, true
+}
+
+func (c *priceCache) put(key string, price *usdPrice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cachedPrice{price: price, fetchedAt: time.Now()}
+}
+
+func (c *priceCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cachedPrice)
+}
+
+// latestUSDPrice 返回代币的最新价格 (缓存 price_oracle.cache_ttl 秒)；没有价格来源时返回 nil
+func (srv *Server) latestUSDPrice(token common.Address) (*usdPrice, error) {
+	p := srv.priceProvider()
+	if !p.Supports(token) {
+		return nil, nil
+	}
+	ttl := defaultPriceCacheTTL
+	if s := srv.Config().PriceOracle.CacheTTL; s > 0 {
+		ttl = time.Duration(s) * time.Second
+	}
+	key := p.Name() + "/" + token.Hex()
+	if price, ok := srv.prices.get(key, ttl); ok {
+		return price, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	price, err := p.Quote(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	srv.prices.put(key, price)
+	return price, nil
+}
+
+// usdValue 按最新价格换算金额，取不到价格时返回空字符串 (仅记录日志，不影响调用方)
+func (srv *Server) usdValue(token common.Address, amount *big.Int, decimals uint8) (price, value string) {
+	p, err := srv.latestUSDPrice(token)
+	if err != nil {
+		log.Printf("读取 %s 的 USD 价格失败: %v", token.Hex(), err)
+		return "", ""
+	}
+	if p == nil {
+		return "", ""
+	}
+	return p.usd(amount, decimals)
+}
+
+// dailyUSDPrice 返回代币在 day (UTC) 的价格，当天首次调用时读取最新价格并缓存
+//
+// 价格来源只能读到最新值，过去某天没有缓存时无法补齐。
+func (srv *Server) dailyUSDPrice(token common.Address, day time.Time) (*usdPrice, error) {
+	key := token.Hex() + "/" + day.UTC().Format(reportDateFmt)
+	var cached usdPrice
+	if found, err := getJSON(srv.storage, nsPrices, key, &cached); err != nil {
+		return nil, err
+	} else if found {
+		return &cached, nil
+	}
+	if day.UTC().Format(reportDateFmt) != time.Now().UTC().Format(reportDateFmt) {
+		return nil, fmt.Errorf("没有 %s 的价格缓存", key)
+	}
+
+	price, err := srv.latestUSDPrice(token)
+	if err != nil {
+		return nil, err
+	}
+	if price == nil {
+		return nil, fmt.Errorf("代币 %s 没有价格来源", token.Hex())
+	}
+	if err := putJSON(srv.storage, nsPrices, key, price, 0); err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+// annotatePrice 等待交易确认，按确认区块当天的价格给历史记录补上 USD 金额
+func (srv *Server) annotatePrice(key string, rec HistoryRecord) {
+	receipt, err := srv.waitReceipt(common.HexToHash(rec.TxHash))
+	if err != nil {
+		log.Printf("历史记录 %s 未标注价格: %v", key, err)
+		return
+	}
+	header, err := srv.eth().HeaderByNumber(context.Background(), receipt.BlockNumber)
+	if err != nil {
+		log.Printf("历史记录 %s 未标注价格: 读取区块失败: %v", key, err)
+		return
+	}
+	confirmedAt := time.Unix(int64(header.Time), 0)
+	price, err := srv.dailyUSDPrice(common.HexToAddress(rec.Token), confirmedAt)
+	if err != nil {
+		log.Printf("历史记录 %s 未标注价格: %v", key, err)
+		return
+	}
+
+	amount, _ := new(big.Int).SetString(rec.Amount, 10)
+	usdPrice, usdValue := price.usd(amount, rec.Decimals)
+	// 重新读取后再写回，不覆盖期间更新的交易状态
+	_, _, err = srv.history.update(key, func(rec *HistoryRecord) {
+		rec.ConfirmedAt = confirmedAt.Unix()
+		rec.USDPrice, rec.USDValue = usdPrice, usdValue
+	})
+	if err != nil {
+		log.Printf("更新历史记录失败: %v", err)
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 超限处理方式
+const (
+	rateLimitReject = "reject" // 直接拒绝 (429)
+	rateLimitQueue  = "queue"  // 排队，返回位置与预计等待时间
+)
+
+const (
+	defaultMaxQueue = 100
+	queuedResultTTL = 10 * time.Minute // 排队请求完成后结果保留时间
+)
+
+// RateLimitConfig 中继接口限流配置 (全局令牌桶，限制中继账户的总吞吐)
+type RateLimitConfig struct {
+	PerMinute int    `yaml:"per_minute" json:"perMinute"` // 每分钟最多处理的中继请求数，0 为不限制
+	Burst     int    `yaml:"burst" json:"burst"`          // 允许的突发请求数，默认 1
+	Mode      string `yaml:"mode" json:"mode"`            // reject (默认) 或 queue
+	MaxQueue  int    `yaml:"max_queue" json:"maxQueue"`   // queue 模式下最多排队数，超出仍然拒绝，默认 100
+}
+
+// QueuedData 排队响应 (POST 返回，GET /api/queue?ticket= 在完成前也返回该结构)
+type QueuedData struct {
+	Ticket     string `json:"ticket"`
+	Position   int    `json:"position"`   // 从 1 开始
+	ETASeconds int64  `json:"etaSeconds"` // 预计开始处理前的等待时间
+}
+
+// queuedRequest 等待处理的请求 (请求体已缓存)
+type queuedRequest struct {
+	ticket  string
+	handler http.HandlerFunc
+	req     *http.Request
+	queued  time.Time
+	dropped func() // 被管理员移除时调用 (服务端内部发起的中继用于结束本次执行)
+}
+
+// queuedResult 排队请求的处理结果，原样返回给轮询方
+type queuedResult struct {
+	status int
+	header http.Header
+	body   []byte
+	done   time.Time
+}
+
+// resultRecorder 记录排队请求的响应
+type resultRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *resultRecorder) Header() http.Header         { return rr.header }
+func (rr *resultRecorder) Write(b []byte) (int, error) { return rr.body.Write(b) }
+func (rr *resultRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+}
+
+// relayLimiter 中继限流器，参数每次从当前配置读取 (支持热更新)
+type relayLimiter struct {
+	srv *Server
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	queue   []*queuedRequest
+	current string // 正在处理的 ticket
+	results map[string]*queuedResult
+	wake    chan struct{}
+}
+
+func newRelayLimiter(srv *Server) *relayLimiter {
+	return &relayLimiter{
+		srv:     srv,
+		results: make(map[string]*queuedResult),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// refill 按时间补充令牌，返回令牌间隔 (需持有锁)
+func (l *relayLimiter) refill(cfg RateLimitConfig, now time.Time) time.Duration {
+	interval := time.Minute / time.Duration(cfg.PerMinute)
+	burst := float64(max(cfg.Burst, 1))
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens += float64(now.Sub(l.last)) / float64(interval)
+	}
+	l.tokens = math.Min(l.tokens, burst)
+	l.last = now
+	return interval
+}
+
+// untilToken 距离下一个令牌可用的时间 (需持有锁且已 refill)
+func (l *relayLimiter) untilToken(interval time.Duration) time.Duration {
+	if l.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - l.tokens) * float64(interval))
+}
+
+// eta 排在第 position 位的请求预计等待时间 (需持有锁且已 refill)
+func (l *relayLimiter) eta(position int, interval time.Duration) int64 {
+	wait := l.untilToken(interval) + time.Duration(position-1)*interval
+	return int64(math.Ceil(wait.Seconds()))
+}
+
+// rateLimited 包装中继接口: 有令牌时直接处理；否则按配置拒绝或排队
+func (srv *Server) rateLimited(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := srv.Config().RateLimit
+		if cfg.PerMinute <= 0 {
+			h(w, r)
+			return
+		}
+
+		l := srv.limiter
+		l.mu.Lock()
+		interval := l.refill(cfg, time.Now())
+		// 已有排队请求时新请求也要排队，保证先到先处理
+		if len(l.queue) == 0 && l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			h(w, r)
+			return
+		}
+
+		maxQueue := cfg.MaxQueue
+		if maxQueue <= 0 {
+			maxQueue = defaultMaxQueue
+		}
+		if cfg.Mode != rateLimitQueue || len(l.queue) >= maxQueue {
+			retry := l.eta(len(l.queue)+1, interval)
+			l.mu.Unlock()
+			w.Header().Set("Retry-After", strconv.FormatInt(max(retry, 1), 10))
+			w.WriteHeader(http.StatusTooManyRequests)
+			sendError(w, fmt.Sprintf("请求过于频繁，请 %d 秒后重试", max(retry, 1)))
+			return
+		}
+		l.mu.Unlock()
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		// 排队请求在原连接返回后才处理，不能沿用请求的 context
+		queued := r.Clone(context.Background())
+		queued.Body = io.NopCloser(bytes.NewReader(body))
+
+		ticketBytes := make([]byte, 16)
+		rand.Read(ticketBytes)
+		qr := &queuedRequest{ticket: hex.EncodeToString(ticketBytes), handler: h, req: queued, queued: time.Now()}
+
+		l.mu.Lock()
+		l.queue = append(l.queue, qr)
+		data := QueuedData{Ticket: qr.ticket, Position: len(l.queue), ETASeconds: l.eta(len(l.queue), interval)}
+		l.mu.Unlock()
+		select {
+		case l.wake <- struct{}{}:
+		default:
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("请求已排队 (第 %d 位，预计 %d 秒后处理)，请通过 GET /api/queue?ticket= 查询结果", data.Position, data.ETASeconds),
+			Data:    data,
+		})
+	}
+}
+
+// submitInternal 服务端内部发起的中继 (定时转账) 与中继接口共用令牌桶和队列
+//
+// 有令牌且无人排队时立即执行；否则不论 mode 都进入队列 (内部任务无法被拒绝后重试)，
+// 由 run 按令牌速率执行。path 只用于管理接口展示。
+func (l *relayLimiter) submitInternal(path string, exec func(), dropped func()) {
+	cfg := l.srv.Config().RateLimit
+	if cfg.PerMinute <= 0 {
+		exec()
+		return
+	}
+
+	l.mu.Lock()
+	l.refill(cfg, time.Now())
+	if len(l.queue) == 0 && l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		exec()
+		return
+	}
+	ticketBytes := make([]byte, 16)
+	rand.Read(ticketBytes)
+	req, _ := http.NewRequest("POST", path, nil)
+	l.queue = append(l.queue, &queuedRequest{
+		ticket:  hex.EncodeToString(ticketBytes),
+		handler: func(http.ResponseWriter, *http.Request) { exec() },
+		req:     req,
+		queued:  time.Now(),
+		dropped: dropped,
+	})
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run 按令牌速率依次处理排队请求
+func (l *relayLimiter) run(ctx context.Context) {
+	for {
+		l.mu.Lock()
+		if len(l.queue) == 0 {
+			l.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.wake:
+			}
+			continue
+		}
+
+		cfg := l.srv.Config().RateLimit
+		if cfg.PerMinute <= 0 {
+			// 限流被关闭时立即处理剩余请求
+			l.tokens = 1
+		} else {
+			l.refill(cfg, time.Now())
+		}
+		if l.tokens < 1 {
+			wait := l.untilToken(time.Minute / time.Duration(cfg.PerMinute))
+			l.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		qr := l.queue[0]
+		l.queue = l.queue[1:]
+		l.tokens--
+		l.current = qr.ticket
+		l.mu.Unlock()
+
+		l.process(qr)
+	}
+}
+
+// process 执行排队请求并保存结果
+func (l *relayLimiter) process(qr *queuedRequest) {
+	rec := &resultRecorder{header: make(http.Header)}
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("排队请求 %s 处理失败: %v", qr.ticket, p)
+				rec.body.Reset()
+				rec.header.Set("Content-Type", "application/json")
+				sendError(rec, "请求处理失败")
+			}
+		}()
+		qr.handler(rec, qr.req)
+	}()
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	l.mu.Lock()
+	l.storeResultLocked(qr.ticket, &queuedResult{status: rec.status, header: rec.header, body: rec.body.Bytes(), done: time.Now()})
+	l.current = ""
+	l.mu.Unlock()
+}
+
+// storeResultLocked 保存处理结果并清理过期结果 (需持有锁)
+func (l *relayLimiter) storeResultLocked(ticket string, res *queuedResult) {
+	for t, old := range l.results {
+		if res.done.Sub(old.done) > queuedResultTTL {
+			delete(l.results, t)
+		}
+	}
+	l.results[ticket] = res
+}
+
+// QueueEntry 管理接口中的一个排队请求
+type QueueEntry struct {
+	Ticket   string `json:"ticket"`
+	Position int    `json:"position"`
+	Path     string `json:"path"`
+	QueuedAt int64  `json:"queuedAt"`
+}
+
+// QueueStatusData /api/admin/queue 返回数据
+type QueueStatusData struct {
+	Length     int          `json:"length"`
+	Processing string       `json:"processing,omitempty"` // 正在处理的 ticket
+	Completed  int          `json:"completed"`            // 保留中的处理结果数
+	Entries    []QueueEntry `json:"entries"`
+}
+
+// status 返回排队状态快照
+func (l *relayLimiter) status() QueueStatusData {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data := QueueStatusData{
+		Length:     len(l.queue),
+		Processing: l.current,
+		Completed:  len(l.results),
+		Entries:    []QueueEntry{},
+	}
+	for i, qr := range l.queue {
+		data.Entries = append(data.Entries, QueueEntry{
+			Ticket:   qr.ticket,
+			Position: i + 1,
+			Path:     qr.req.URL.Path,
+			QueuedAt: qr.queued.Unix(),
+		})
+	}
+	return data
+}
+
+// drop 从队列中移除尚未处理的请求，轮询方随后查询到取消结果
+func (l *relayLimiter) drop(ticket string) bool {
+	l.mu.Lock()
+	for i, qr := range l.queue {
+		if qr.ticket != ticket {
+			continue
+		}
+		l.queue = append(l.queue[:i], l.queue[i+1:]...)
+		rec := &resultRecorder{header: make(http.Header)}
+		rec.header.Set("Content-Type", "application/json")
+		sendError(rec, "请求已被管理员从队列中移除")
+		l.storeResultLocked(ticket, &queuedResult{status: http.StatusOK, header: rec.header, body: rec.body.Bytes(), done: time.Now()})
+		l.mu.Unlock()
+		if qr.dropped != nil {
+			qr.dropped()
+		}
+		return true
+	}
+	l.mu.Unlock()
+	return false
+}
+
+// handleQueue 查询排队请求: 仍在排队时返回位置与 ETA，完成后原样返回处理结果
+func (srv *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	ticket := r.URL.Query().Get("ticket")
+	if ticket == "" {
+		sendError(w, "缺少参数: ticket")
+		return
+	}
+
+	l := srv.limiter
+	l.mu.Lock()
+	if res, ok := l.results[ticket]; ok {
+		l.mu.Unlock()
+		for k, v := range res.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(res.status)
+		w.Write(res.body)
+		return
+	}
+	if ticket == l.current {
+		l.mu.Unlock()
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "处理中",
+			Data:    QueuedData{Ticket: ticket},
+		})
+		return
+	}
+	for i, qr := range l.queue {
+		if qr.ticket != ticket {
+			continue
+		}
+		interval := time.Minute
+		if cfg := srv.Config().RateLimit; cfg.PerMinute > 0 {
+			interval = l.refill(cfg, time.Now())
+		}
+		data := QueuedData{Ticket: ticket, Position: i + 1, ETASeconds: l.eta(i+1, interval)}
+		l.mu.Unlock()
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "排队中",
+			Data:    data,
+		})
+		return
+	}
+	l.mu.Unlock()
+	sendError(w, "未找到排队请求 (可能已过期): "+ticket)
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// PasskeyWallet 社交恢复相关 ABI
+const recoveryABI = `[
+	{
+		"inputs": [
+			{"name": "newGuardians", "type": "address[]"},
+			{"name": "threshold", "type": "uint256"},
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "setGuardians",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "getGuardians",
+		"outputs": [{"type": "address[]"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "guardianThreshold",
+		"outputs": [{"type": "uint256"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "newX", "type": "bytes32"},
+			{"name": "newY", "type": "bytes32"}
+		],
+		"name": "recoveryHash",
+		"outputs": [{"type": "bytes32"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "pendingRecovery",
+		"outputs": [
+			{"name": "x", "type": "bytes32"},
+			{"name": "y", "type": "bytes32"},
+			{"name": "executeAfter", "type": "uint64"}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "newX", "type": "bytes32"},
+			{"name": "newY", "type": "bytes32"},
+			{"name": "signatures", "type": "bytes[]"}
+		],
+		"name": "initiateRecovery",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "executeRecovery",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "cancelRecovery",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	}
+]`
+
+// 恢复流程状态
+const (
+	recoveryCollecting = "collecting" // 收集守护人签名
+	recoveryInitiated  = "initiated"  // 已上链发起，等待时间锁
+	recoveryExecuted   = "executed"   // 已提交 executeRecovery
+	recoveryCancelled  = "cancelled"
+)
+
+// RecoveryState 持久化的恢复流程 (nsRecovery，key = wallet)
+type RecoveryState struct {
+	Wallet       string            `json:"wallet"`
+	NewX         string            `json:"newX"`
+	NewY         string            `json:"newY"`
+	Approvals    map[string]string `json:"approvals"` // 守护人地址 → 签名
+	Status       string            `json:"status"`
+	TxHash       string            `json:"txHash,omitempty"`
+	ExecuteAfter int64             `json:"executeAfter,omitempty"`
+	UpdatedAt    int64             `json:"updatedAt"`
+}
+
+// RecoveryInfo GET /api/recovery 返回数据
+type RecoveryInfo struct {
+	Guardians []string       `json:"guardians"`
+	Threshold uint64         `json:"threshold"`
+	Digest    string         `json:"digest,omitempty"` // 传入 x/y 时返回守护人需 personal_sign 的摘要
+	State     *RecoveryState `json:"state,omitempty"`
+}
+
+// GuardiansRequest 设置守护人请求 (所有者 Passkey 签名)
+type GuardiansRequest struct {
+	PasskeyData
+	Wallet    string   `json:"wallet"`
+	Guardians []string `json:"guardians"`
+	Threshold uint64   `json:"threshold"`
+}
+
+// call 校验守护人与门限，编码 setGuardians 调用
+func (req *GuardiansRequest) call() ([]byte, error) {
+	if req.Threshold == 0 || req.Threshold > uint64(len(req.Guardians)) {
+		return nil, fmt.Errorf("threshold 必须在 1 到守护人数量之间")
+	}
+	guardians := make([]common.Address, 0, len(req.Guardians))
+	for _, g := range req.Guardians {
+		if !common.IsHexAddress(g) {
+			return nil, fmt.Errorf("守护人地址格式错误: %s", g)
+		}
+		guardians = append(guardians, common.HexToAddress(g))
+	}
+	return recoveryCall("setGuardians", guardians, new(big.Int).SetUint64(req.Threshold), webauthnSignature(&req.PasskeyData))
+}
+
+// RecoveryApproval 守护人提交的恢复签名
+type RecoveryApproval struct {
+	Wallet    string `json:"wallet"`
+	NewX      string `json:"newX"`
+	NewY      string `json:"newY"`
+	Signature string `json:"signature"` // 对 digest 的 personal_sign 签名
+}
+
+// recoveryManager 编排恢复流程: 收集签名 → 发起 → 时间锁到期后执行
+type recoveryManager struct {
+	srv *Server
+	mu  sync.Mutex // 串行化同一时间的状态读写
+}
+
+func newRecoveryManager(srv *Server) *recoveryManager {
+	return &recoveryManager{srv: srv}
+}
+
+func (rm *recoveryManager) load(wallet common.Address) (*RecoveryState, error) {
+	var state RecoveryState
+	ok, err := getJSON(rm.srv.storage, nsRecovery, wallet.Hex(), &state)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (rm *recoveryManager) save(state *RecoveryState) error {
+	state.UpdatedAt = time.Now().Unix()
+	return putJSON(rm.srv.storage, nsRecovery, state.Wallet, state, 0)
+}
+
+// call 对钱包执行只读调用并解包结果
+func (rm *recoveryManager) call(wallet common.Address, out interface{}, method string, args ...interface{}) error {
+	parsedABI, _ := abi.JSON(strings.NewReader(recoveryABI))
+	data, err := parsedABI.Pack(method, args...)
+	if err != nil {
+		return fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	result, err := rm.srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &wallet, Data: data}, nil)
+	if err != nil {
+		return fmt.Errorf("调用合约失败: %v", err)
+	}
+	if err := parsedABI.UnpackIntoInterface(out, method, result); err != nil {
+		return fmt.Errorf("解析结果失败: %v", err)
+	}
+	return nil
+}
+
+// transact 由中继账户调用钱包的恢复方法
+func (rm *recoveryManager) transact(wallet common.Address, method string, args ...interface{}) (common.Hash, error) {
+	data, err := recoveryCall(method, args...)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return rm.srv.sendTransaction(wallet, big.NewInt(0), data)
+}
+
+// recoveryCall 编码钱包社交恢复相关调用
+func recoveryCall(method string, args ...interface{}) ([]byte, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(recoveryABI))
+	data, err := parsedABI.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	return data, nil
+}
+
+// guardians 读取链上守护人与门限
+func (rm *recoveryManager) guardians(wallet common.Address) ([]common.Address, uint64, error) {
+	var list []common.Address
+	if err := rm.call(wallet, &list, "getGuardians"); err != nil {
+		return nil, 0, err
+	}
+	var threshold *big.Int
+	if err := rm.call(wallet, &threshold, "guardianThreshold"); err != nil {
+		return nil, 0, err
+	}
+	return list, threshold.Uint64(), nil
+}
+
+// digest 守护人需签名的恢复摘要
+func (rm *recoveryManager) digest(wallet common.Address, x, y [32]byte) (common.Hash, error) {
+	var hash [32]byte
+	err := rm.call(wallet, &hash, "recoveryHash", x, y)
+	return hash, err
+}
+
+// approve 记录一份守护人签名，达到门限时立即上链发起恢复
+func (rm *recoveryManager) approve(req *RecoveryApproval) (*RecoveryState, error) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	wallet := common.HexToAddress(req.Wallet)
+	x, y := hexToBytes32(req.NewX), hexToBytes32(req.NewY)
+
+	digest, err := rm.digest(wallet, x, y)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := hexutil.Decode(req.Signature)
+	if err != nil || len(sig) != 65 {
+		return nil, fmt.Errorf("signature 必须是 65 字节十六进制")
+	}
+	recoverable := append([]byte{}, sig...)
+	if recoverable[64] >= 27 {
+		recoverable[64] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(digest.Bytes()), recoverable)
+	if err != nil {
+		return nil, fmt.Errorf("恢复签名者失败: %v", err)
+	}
+	signer := crypto.PubkeyToAddress(*pub)
+
+	guardians, threshold, err := rm.guardians(wallet)
+	if err != nil {
+		return nil, err
+	}
+	isGuardian := false
+	for _, g := range guardians {
+		if g == signer {
+			isGuardian = true
+		}
+	}
+	if !isGuardian {
+		return nil, fmt.Errorf("%s 不是该钱包的守护人", signer.Hex())
+	}
+
+	state, err := rm.load(wallet)
+	if err != nil {
+		return nil, err
+	}
+	newKey := common.Hash(x).Hex() + common.Hash(y).Hex()
+	if state == nil || state.Status != recoveryCollecting || state.NewX+state.NewY != newKey {
+		if state != nil && state.Status == recoveryInitiated {
+			return nil, fmt.Errorf("已有进行中的恢复，需等待执行或由所有者取消")
+		}
+		state = &RecoveryState{
+			Wallet:    wallet.Hex(),
+			NewX:      common.Hash(x).Hex(),
+			NewY:      common.Hash(y).Hex(),
+			Approvals: make(map[string]string),
+			Status:    recoveryCollecting,
+		}
+	}
+	state.Approvals[signer.Hex()] = hexutil.Encode(sig)
+
+	if uint64(len(state.Approvals)) >= threshold {
+		// 合约要求签名按签名者地址升序排列
+		signers := make([]common.Address, 0, len(state.Approvals))
+		for addr := range state.Approvals {
+			signers = append(signers, common.HexToAddress(addr))
+		}
+		sort.Slice(signers, func(i, j int) bool { return bytes.Compare(signers[i][:], signers[j][:]) < 0 })
+		sigs := make([][]byte, 0, len(signers))
+		for _, addr := range signers {
+			sigs = append(sigs, hexutil.MustDecode(state.Approvals[addr.Hex()]))
+		}
+
+		txHash, err := rm.transact(wallet, "initiateRecovery", x, y, sigs)
+		if err != nil {
+			return nil, err
+		}
+		state.Status = recoveryInitiated
+		state.TxHash = txHash.Hex()
+	}
+
+	if err := rm.save(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// run 定期检查已发起的恢复，时间锁到期后提交 executeRecovery
+func (rm *recoveryManager) run(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			rm.tick(now.Unix())
+		}
+	}
+}
+
+func (rm *recoveryManager) tick(now int64) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	kvs, err := rm.srv.storage.List(nsRecovery, "")
+	if err != nil {
+		return
+	}
+	for _, kv := range kvs {
+		var state RecoveryState
+		if json.Unmarshal(kv.Value, &state) != nil || state.Status != recoveryInitiated {
+			continue
+		}
+
+		wallet := common.HexToAddress(state.Wallet)
+		var pending struct {
+			X            [32]byte
+			Y            [32]byte
+			ExecuteAfter uint64
+		}
+		if err := rm.call(wallet, &pending, "pendingRecovery"); err != nil || pending.ExecuteAfter == 0 {
+			continue // initiateRecovery 尚未上链
+		}
+		state.ExecuteAfter = int64(pending.ExecuteAfter)
+		if now < state.ExecuteAfter {
+			rm.save(&state)
+			continue
+		}
+
+		txHash, err := rm.transact(wallet, "executeRecovery")
+		if err != nil {
+			log.Printf("执行恢复失败 %s: %v", state.Wallet, err)
+			continue
+		}
+		state.Status = recoveryExecuted
+		state.TxHash = txHash.Hex()
+		rm.save(&state)
+		rm.srv.resetSignCount(wallet)
+		rm.srv.clearWalletCredentials(wallet)
+		log.Printf("钱包 %s 恢复已执行: %s", state.Wallet, txHash.Hex())
+	}
+}
+
+// handleRecovery 守护人恢复
+//
+//	GET  /api/recovery?wallet=...[&x=...&y=...]   守护人、门限、待签摘要与流程状态
+//	POST /api/recovery                            守护人提交签名 {wallet, newX, newY, signature}
+func (srv *Server) handleRecovery(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		q := r.URL.Query()
+		if !common.IsHexAddress(q.Get("wallet")) {
+			sendError(w, "wallet 地址格式错误")
+			return
+		}
+		wallet := common.HexToAddress(q.Get("wallet"))
+		guardians, threshold, err := srv.recovery.guardians(wallet)
+		if err != nil {
+			sendError(w, "读取守护人失败: "+err.Error())
+			return
+		}
+		info := RecoveryInfo{Threshold: threshold, Guardians: make([]string, 0, len(guardians))}
+		for _, g := range guardians {
+			info.Guardians = append(info.Guardians, g.Hex())
+		}
+		if q.Get("x") != "" && q.Get("y") != "" {
+			digest, err := srv.recovery.digest(wallet, hexToBytes32(q.Get("x")), hexToBytes32(q.Get("y")))
+			if err != nil {
+				sendError(w, "计算恢复摘要失败: "+err.Error())
+				return
+			}
+			info.Digest = digest.Hex()
+		}
+		if info.State, err = srv.recovery.load(wallet); err != nil {
+			sendError(w, "读取恢复状态失败: "+err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Data:    info,
+		})
+
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req RecoveryApproval
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		if !common.IsHexAddress(req.Wallet) {
+			sendError(w, "wallet 地址格式错误")
+			return
+		}
+		if req.NewX == "" || req.NewY == "" {
+			sendError(w, "缺少参数: newX/newY")
+			return
+		}
+		state, err := srv.recovery.approve(&req)
+		if err != nil {
+			sendError(w, "提交恢复签名失败: "+err.Error())
+			return
+		}
+		message := fmt.Sprintf("已收到 %d 份守护人签名", len(state.Approvals))
+		if state.Status == recoveryInitiated {
+			message = "已达到门限，恢复已发起，时间锁到期后自动执行"
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: message,
+			TxHash:  state.TxHash,
+			Data:    state,
+		})
+	}
+}
+
+// handleGuardians 所有者设置守护人 (签名 guardians challenge)，同时作废进行中的恢复
+func (srv *Server) handleGuardians(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req GuardiansRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	if !common.IsHexAddress(req.Wallet) {
+		sendError(w, "wallet 地址格式错误")
+		return
+	}
+	callData, err := req.call()
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	wallet := common.HexToAddress(req.Wallet)
+	if err := srv.authorizeWalletCall(r, &req.PasskeyData, wallet, opGuardians, wallet, callData); err != nil {
+		sendVerificationError(w, err)
+		return
+	}
+	txHash, err := srv.sendTransaction(wallet, big.NewInt(0), callData)
+	if err != nil {
+		sendError(w, "设置守护人失败: "+err.Error())
+		return
+	}
+	srv.storage.Delete(nsRecovery, wallet.Hex())
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success:     true,
+		Message:     "守护人设置交易已发送",
+		TxHash:      txHash.Hex(),
+		SNormalized: req.Signature.Normalized(),
+	})
+}
+
+// handleCancelRecovery 所有者取消进行中的恢复 (签名 cancel-recovery challenge)
+func (srv *Server) handleCancelRecovery(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req SessionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	if !common.IsHexAddress(req.Wallet) {
+		sendError(w, "wallet 地址格式错误")
+		return
+	}
+
+	wallet := common.HexToAddress(req.Wallet)
+	callData, err := recoveryCall("cancelRecovery", webauthnSignature(&req.PasskeyData))
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	if err := srv.authorizeWalletCall(r, &req.PasskeyData, wallet, opCancelRecovery, wallet, callData); err != nil {
+		sendVerificationError(w, err)
+		return
+	}
+	txHash, err := srv.sendTransaction(wallet, big.NewInt(0), callData)
+	if err != nil {
+		sendError(w, "取消恢复失败: "+err.Error())
+		return
+	}
+
+	srv.recovery.mu.Lock()
+	if state, err := srv.recovery.load(wallet); err == nil && state != nil {
+		state.Status = recoveryCancelled
+		state.TxHash = txHash.Hex()
+		srv.recovery.save(state)
+	}
+	srv.recovery.mu.Unlock()
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success:     true,
+		Message:     "取消恢复交易已发送",
+		TxHash:      txHash.Hex(),
+		SNormalized: req.Signature.Normalized(),
+	})
+}
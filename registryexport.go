@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 钱包登记导出格式
+const (
+	registryExportVersion = 1
+	maxRegistryImportSize = 256 << 20 // POST /api/admin/registry 请求体上限
+)
+
+// registryCSVHeader CSV 只包含钱包登记，每个钱包一行，凭证 ID 以 ; 分隔
+var registryCSVHeader = []string{"wallet", "type", "factory", "user_name", "public_key_x", "public_key_y", "credentials", "tx_hash", "created_at", "frozen_at"}
+
+// RegistryExport 钱包登记的完整备份 (JSON)
+//
+// 包含钱包登记与全部凭证，可选包含转账历史。导入时已存在的条目保持不变，
+// 公钥索引与转账索引按导入的钱包重建。
+type RegistryExport struct {
+	Version     int            `json:"version"`
+	ChainID     string         `json:"chainId"`
+	ExportedAt  int64          `json:"exportedAt"`
+	Wallets     []walletRecord `json:"wallets"`
+	Credentials []Credential   `json:"credentials"`
+	History     []HistoryEntry `json:"history,omitempty"`
+}
+
+// HistoryEntry 导出的历史记录，保留存储 key 以便导入时去重并保持顺序
+type HistoryEntry struct {
+	Key    string        `json:"key"`
+	Record HistoryRecord `json:"record"`
+}
+
+// RegistryImportResult 导入结果: 新增条目数与已存在而跳过的条目数
+type RegistryImportResult struct {
+	Wallets     int `json:"wallets"`
+	Credentials int `json:"credentials"`
+	History     int `json:"history"`
+	Skipped     int `json:"skipped"`
+}
+
+// exportRegistry 读取全部钱包登记与凭证，withHistory 时同时读取转账历史
+func (srv *Server) exportRegistry(withHistory bool) (*RegistryExport, error) {
+	exp := &RegistryExport{
+		Version:     registryExportVersion,
+		ChainID:     srv.chainID.String(),
+		ExportedAt:  time.Now().Unix(),
+		Wallets:     []walletRecord{},
+		Credentials: []Credential{},
+	}
+	kvs, err := srv.storage.List(nsWallets, "")
+	if err != nil {
+		return nil, fmt.Errorf("读取钱包登记失败: %v", err)
+	}
+	for _, kv := range kvs {
+		var rec walletRecord
+		if json.Unmarshal(kv.Value, &rec) == nil {
+			exp.Wallets = append(exp.Wallets, rec)
+		}
+	}
+	if kvs, err = srv.storage.List(nsCredentials, ""); err != nil {
+		return nil, fmt.Errorf("读取凭证失败: %v", err)
+	}
+	for _, kv := range kvs {
+		var cred Credential
+		if json.Unmarshal(kv.Value, &cred) == nil {
+			exp.Credentials = append(exp.Credentials, cred)
+		}
+	}
+	if !withHistory {
+		return exp, nil
+	}
+	if kvs, err = srv.storage.List(nsHistory, ""); err != nil {
+		return nil, fmt.Errorf("读取转账历史失败: %v", err)
+	}
+	exp.History = []HistoryEntry{}
+	for _, kv := range kvs {
+		var rec HistoryRecord
+		if json.Unmarshal(kv.Value, &rec) == nil {
+			exp.History = append(exp.History, HistoryEntry{Key: kv.Key, Record: rec})
+		}
+	}
+	return exp, nil
+}
+
+// writeRegistryExport 按 json / csv 写出，csv 只包含钱包登记
+func writeRegistryExport(w io.Writer, format string, exp *RegistryExport) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(exp)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(registryCSVHeader)
+		for _, rec := range exp.Wallets {
+			cw.Write([]string{
+				rec.Wallet, rec.Type, rec.Factory, rec.UserName,
+				rec.PublicKey.X, rec.PublicKey.Y, strings.Join(rec.Credentials, ";"), rec.TxHash,
+				strconv.FormatInt(rec.CreatedAt, 10), strconv.FormatInt(rec.FrozenAt, 10),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("不支持的导出格式: %s (json / csv)", format)
+}
+
+// parseRegistryExport 解析导出文件，以 { 开头的按 JSON 解析，否则按 CSV 解析
+func parseRegistryExport(data []byte) (*RegistryExport, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var exp RegistryExport
+		if err := json.Unmarshal(trimmed, &exp); err != nil {
+			return nil, fmt.Errorf("JSON 解析失败: %v", err)
+		}
+		if exp.Version != registryExportVersion {
+			return nil, fmt.Errorf("不支持的导出版本: %d", exp.Version)
+		}
+		return &exp, nil
+	}
+
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("CSV 解析失败: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("导入文件为空")
+	}
+	col := make(map[string]int)
+	for i, name := range rows[0] {
+		col[strings.TrimSpace(name)] = i
+	}
+	if _, ok := col["wallet"]; !ok {
+		return nil, fmt.Errorf("CSV 缺少 wallet 列")
+	}
+	exp := &RegistryExport{Version: registryExportVersion}
+	for n, row := range rows[1:] {
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		rec := walletRecord{
+			Wallet:      get("wallet"),
+			Type:        get("type"),
+			Factory:     get("factory"),
+			UserName:    get("user_name"),
+			PublicKey:   PublicKeyHex{X: get("public_key_x"), Y: get("public_key_y")},
+			Credentials: []string{},
+			TxHash:      get("tx_hash"),
+		}
+		if ids := get("credentials"); ids != "" {
+			rec.Credentials = strings.Split(ids, ";")
+		}
+		if v := get("created_at"); v != "" {
+			if rec.CreatedAt, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("第 %d 行 created_at 格式错误: %s", n+2, v)
+			}
+		}
+		if v := get("frozen_at"); v != "" {
+			if rec.FrozenAt, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("第 %d 行 frozen_at 格式错误: %s", n+2, v)
+			}
+		}
+		exp.Wallets = append(exp.Wallets, rec)
+	}
+	return exp, nil
+}
+
+// importRegistry 写入导出文件中尚不存在的钱包、凭证与历史，并重建公钥索引
+//
+// 校验全部钱包地址后才开始写入；JSON 导出来自其它链时拒绝导入。
+func (srv *Server) importRegistry(exp *RegistryExport) (*RegistryImportResult, error) {
+	if exp.ChainID != "" && exp.ChainID != srv.chainID.String() {
+		return nil, fmt.Errorf("导出文件来自链 %s，当前链为 %s", exp.ChainID, srv.chainID)
+	}
+	for _, rec := range exp.Wallets {
+		if !common.IsHexAddress(rec.Wallet) {
+			return nil, fmt.Errorf("钱包地址格式错误: %s", rec.Wallet)
+		}
+	}
+	for _, cred := range exp.Credentials {
+		if cred.ID == "" {
+			return nil, fmt.Errorf("凭证缺少 id")
+		}
+	}
+	for _, entry := range exp.History {
+		if entry.Key == "" {
+			return nil, fmt.Errorf("历史记录缺少 key")
+		}
+	}
+
+	res := &RegistryImportResult{}
+	for _, cred := range exp.Credentials {
+		var existing Credential
+		found, err := getJSON(srv.storage, nsCredentials, cred.ID, &existing)
+		if err != nil {
+			return res, fmt.Errorf("读取凭证失败: %v", err)
+		}
+		if found {
+			res.Skipped++
+			continue
+		}
+		if err := putJSON(srv.storage, nsCredentials, cred.ID, cred, 0); err != nil {
+			return res, fmt.Errorf("写入凭证失败: %v", err)
+		}
+		res.Credentials++
+	}
+
+	srv.walletRecordMu.Lock()
+	for _, rec := range exp.Wallets {
+		wallet := common.HexToAddress(rec.Wallet)
+		rec.Wallet = wallet.Hex()
+		if rec.Credentials == nil {
+			rec.Credentials = []string{}
+		}
+		var existing walletRecord
+		found, err := getJSON(srv.storage, nsWallets, rec.Wallet, &existing)
+		if err != nil {
+			srv.walletRecordMu.Unlock()
+			return res, fmt.Errorf("读取钱包登记失败: %v", err)
+		}
+		if found {
+			res.Skipped++
+		} else {
+			if err := putJSON(srv.storage, nsWallets, rec.Wallet, rec, 0); err != nil {
+				srv.walletRecordMu.Unlock()
+				return res, fmt.Errorf("写入钱包登记失败: %v", err)
+			}
+			res.Wallets++
+		}
+		srv.indexWalletKey(rec.PublicKey, wallet, "")
+		srv.indexer.track(wallet)
+	}
+	srv.walletRecordMu.Unlock()
+
+	// 已关联钱包的有效凭证按自己的公钥登记，覆盖上面不带凭证 ID 的创建公钥索引
+	for _, cred := range exp.Credentials {
+		if cred.Wallet != "" && !cred.Pending && cred.RevokedAt == 0 {
+			srv.indexWalletKey(cred.PublicKey, common.HexToAddress(cred.Wallet), cred.ID)
+		}
+	}
+
+	for _, entry := range exp.History {
+		added, err := srv.history.restore(entry.Key, entry.Record)
+		if err != nil {
+			return res, fmt.Errorf("写入转账历史失败: %v", err)
+		}
+		if added {
+			res.History++
+		} else {
+			res.Skipped++
+		}
+	}
+	log.Printf("已导入钱包登记: %d 个钱包、%d 个凭证、%d 条历史，跳过 %d 条已存在的记录",
+		res.Wallets, res.Credentials, res.History, res.Skipped)
+	return res, nil
+}
+
+// handleAdminRegistry 导出 / 导入钱包登记
+//
+//	GET  /api/admin/registry?format=json&history=true   导出 (csv 只包含钱包登记)
+//	POST /api/admin/registry                             导入 JSON 或 CSV 导出文件
+func (srv *Server) handleAdminRegistry(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		q := r.URL.Query()
+		format := q.Get("format")
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			sendError(w, "不支持的导出格式: "+format+" (json / csv)")
+			return
+		}
+		exp, err := srv.exportRegistry(q.Get("history") == "true" && format == "json")
+		if err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		name := "registry-" + time.Now().UTC().Format(reportDateFmt)
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.`+format+`"`)
+		w.Header().Set("X-Record-Count", strconv.Itoa(len(exp.Wallets)))
+		writeRegistryExport(w, format, exp)
+	case "POST":
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRegistryImportSize))
+		if err != nil {
+			sendError(w, "读取请求失败: "+err.Error())
+			return
+		}
+		exp, err := parseRegistryExport(data)
+		if err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		res, err := srv.importRegistry(exp)
+		if err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{Success: true, Data: res})
+	}
+}
+
+// runRegistryExport 命令行导出，out 为空时写到标准输出
+func runRegistryExport(srv *Server, format, out string, withHistory bool) error {
+	if format != "json" && format != "csv" {
+		return fmt.Errorf("不支持的导出格式: %s (json / csv)", format)
+	}
+	if withHistory && format != "json" {
+		return fmt.Errorf("转账历史只能导出为 json")
+	}
+	exp, err := srv.exportRegistry(withHistory)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("创建导出文件失败: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeRegistryExport(w, format, exp); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已导出 %d 个钱包、%d 个凭证、%d 条历史\n", len(exp.Wallets), len(exp.Credentials), len(exp.History))
+	return nil
+}
+
+// runRegistryImport 命令行导入 JSON / CSV 导出文件
+func runRegistryImport(srv *Server, path string) error {
+	if path == "" {
+		return fmt.Errorf("缺少参数: -in <导出文件>")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取导入文件失败: %v", err)
+	}
+	exp, err := parseRegistryExport(data)
+	if err != nil {
+		return err
+	}
+	res, err := srv.importRegistry(exp)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "已导入 %d 个钱包、%d 个凭证、%d 条历史，跳过 %d 条已存在的记录\n",
+		res.Wallets, res.Credentials, res.History, res.Skipped)
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 中继池的账户选择策略
+const (
+	relayerStrategyRoundRobin   = "round-robin"   // 依次轮换 (默认)
+	relayerStrategyLeastPending = "least-pending" // 选在途交易最少的账户
+)
+
+// RelayerPoolConfig 额外的中继私钥，与 private_key 一起分担中继交易
+//
+// 每个账户的 nonce 独立分配，一笔交易卡住只阻塞同一账户的后续交易。
+type RelayerPoolConfig struct {
+	Keys     []string `yaml:"keys"`     // 额外中继私钥 (支持 enc:v1:)，修改需重启
+	HD       HDConfig `yaml:"hd"`       // 由助记词派生的中继账户，排在 keys 之后
+	Strategy string   `yaml:"strategy"` // round-robin (默认) 或 least-pending
+}
+
+// parseRelayerKeys 解析 relayer_pool.keys 并派生 relayer_pool.hd 的账户
+func parseRelayerKeys(cfg RelayerPoolConfig) ([]*ecdsa.PrivateKey, error) {
+	keys := make([]*ecdsa.PrivateKey, 0, len(cfg.Keys)+cfg.HD.Count)
+	for i, hexKey := range cfg.Keys {
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("relayer_pool.keys[%d] 格式错误: %v", i, err)
+		}
+		keys = append(keys, key)
+	}
+	derived, err := deriveHDKeys(cfg.HD)
+	if err != nil {
+		return nil, err
+	}
+	return append(keys, derived...), nil
+}
+
+// relayer 中继池中的一个账户
+type relayer struct {
+	signer   func() Signer // 主账户随 SetSigner 变化，其余固定
+	nonces   *nonceManager
+	primary  bool
+	inflight atomic.Int64 // 已选中但尚未广播完成的交易数
+}
+
+// address 账户地址，未配置私钥时为零地址
+func (r *relayer) address() common.Address {
+	signer := r.signer()
+	if signer == nil {
+		return common.Address{}
+	}
+	return signer.Address()
+}
+
+// relayerPool 在多个中继账户间分配交易
+//
+// 第一个成员是 private_key 对应的主账户 (共用 srv.nonces)，只签名不广播、管理员操作
+// 与 treasury 充值仍只使用主账户。
+type relayerPool struct {
+	srv     *Server
+	members []*relayer
+
+	mu   sync.Mutex
+	next int
+}
+
+func newRelayerPool(srv *Server) *relayerPool {
+	p := &relayerPool{srv: srv}
+	p.members = append(p.members, &relayer{signer: srv.signer, nonces: srv.nonces, primary: true})
+
+	// main 启动时已校验格式
+	keys, _ := parseRelayerKeys(srv.Config().RelayerPool)
+	seen := make(map[common.Address]bool)
+	if primary := srv.signer(); primary != nil {
+		seen[primary.Address()] = true
+	}
+	for _, key := range keys {
+		fixed := newKeySigner(key)
+		if seen[fixed.Address()] {
+			continue
+		}
+		seen[fixed.Address()] = true
+		getSigner := func() Signer { return fixed }
+		p.members = append(p.members, &relayer{signer: getSigner, nonces: newNonceManager(srv, getSigner)})
+	}
+	return p
+}
+
+// pick 按配置的策略选择一个可用账户，调用方用完后须调用 release
+//
+// 正在轮换的主账户不参与分配；没有其它账户时等待轮换结束。
+func (p *relayerPool) pick() (*relayer, error) {
+	var available []*relayer
+	for {
+		available = available[:0]
+		for _, r := range p.members {
+			if r.signer() != nil && !p.srv.rotation.draining(r) {
+				available = append(available, r)
+			}
+		}
+		if len(available) > 0 {
+			break
+		}
+		wait := p.srv.rotation.wait()
+		if wait == nil {
+			return nil, fmt.Errorf("未配置私钥")
+		}
+		select {
+		case <-wait:
+		case <-time.After(rotationWaitTimeout):
+			return nil, fmt.Errorf("中继账户轮换中，请稍后重试")
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	start := p.next % len(available)
+	p.next++
+	chosen := available[start]
+	if p.srv.Config().RelayerPool.Strategy == relayerStrategyLeastPending {
+		counts := p.srv.submissions.pendingCounts()
+		best := -1
+		// 从轮换位置开始找，在途数相同时仍然轮换
+		for i := range available {
+			r := available[(start+i)%len(available)]
+			n := counts[r.address()] + int(r.inflight.Load())
+			if best < 0 || n < best {
+				chosen, best = r, n
+			}
+		}
+	}
+	chosen.inflight.Add(1)
+	return chosen, nil
+}
+
+// release 交易已广播 (或失败)，不再计入在途
+func (p *relayerPool) release(r *relayer) {
+	r.inflight.Add(-1)
+}
+
+// lookup 按地址查找账户 (提价重发、取消交易时使用)
+func (p *relayerPool) lookup(addr common.Address) (*relayer, bool) {
+	for _, r := range p.members {
+		if r.signer() != nil && r.address() == addr {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// resync 所有账户下一次分配前重新同步 nonce
+func (p *relayerPool) resync() {
+	for _, r := range p.members {
+		r.nonces.resync()
+	}
+}
+
+// RelayerStatus /api/admin/relayers 中的一个账户
+type RelayerStatus struct {
+	Address   string  `json:"address"`
+	Primary   bool    `json:"primary"`
+	Balance   string  `json:"balance,omitempty"` // wei
+	NextNonce *uint64 `json:"nextNonce,omitempty"`
+	Pending   int     `json:"pending"` // 已广播未上链的交易数
+	Error     string  `json:"error,omitempty"`
+}
+
+// RelayersData /api/admin/relayers 返回数据
+type RelayersData struct {
+	Strategy string          `json:"strategy"`
+	Relayers []RelayerStatus `json:"relayers"`
+}
+
+// handleAdminRelayers 中继池各账户的余额、nonce 与在途交易数
+func (srv *Server) handleAdminRelayers(w http.ResponseWriter, r *http.Request) {
+	data := RelayersData{Strategy: srv.Config().RelayerPool.Strategy, Relayers: []RelayerStatus{}}
+	if data.Strategy == "" {
+		data.Strategy = relayerStrategyRoundRobin
+	}
+	counts := srv.submissions.pendingCounts()
+	var members []*relayer
+	var addrs []common.Address
+	for _, m := range srv.relayers.members {
+		if m.signer() != nil {
+			members = append(members, m)
+			addrs = append(addrs, m.address())
+		}
+	}
+	// 各账户的余额在一次 batch 请求中读取
+	states, batchErr := srv.accountStates(r.Context(), addrs)
+	for i, m := range members {
+		addr := addrs[i]
+		status := RelayerStatus{Address: addr.Hex(), Primary: m.primary, Pending: counts[addr]}
+		switch {
+		case batchErr != nil:
+			status.Error = batchErr.Error()
+		case states[i].Err != nil:
+			status.Error = states[i].Err.Error()
+		default:
+			status.Balance = states[i].Balance.String()
+		}
+		if nonce, err := m.nonces.peek(); err == nil {
+			status.NextNonce = &nonce
+		} else {
+			status.Error = err.Error()
+		}
+		data.Relayers = append(data.Relayers, status)
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    data,
+	})
+}
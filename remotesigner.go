@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 远程签名服务
+const (
+	signerTypeClef       = "clef"       // Clef 外部签名 API (account_signTransaction)
+	signerTypeWeb3Signer = "web3signer" // web3signer eth1 模式 (eth_signTransaction)
+
+	remoteSignTimeout = 2 * time.Minute // Clef 默认需要人工确认，留足时间
+)
+
+// remoteSigner 把签名交给独立主机上的签名服务，中继进程不接触私钥
+//
+// 签名结果会重新恢复发送方地址核对，签名服务返回其它账户的签名时拒绝使用。
+type remoteSigner struct {
+	kind    string
+	address common.Address
+	clef    *external.ExternalSigner // clef
+	client  *rpc.Client              // web3signer
+}
+
+// newRemoteSigner 连接签名服务，address 为空时使用服务上唯一的账户
+func newRemoteSigner(kind, url, address string) (Signer, error) {
+	if url == "" {
+		return nil, fmt.Errorf("signer.type 为 %s 时需要配置 signer.url", kind)
+	}
+	s := &remoteSigner{kind: kind}
+	var available []common.Address
+	switch kind {
+	case signerTypeClef:
+		clef, err := external.NewExternalSigner(url)
+		if err != nil {
+			return nil, fmt.Errorf("连接 Clef 失败: %v", err)
+		}
+		s.clef = clef
+		if address == "" {
+			for _, account := range clef.Accounts() {
+				available = append(available, account.Address)
+			}
+		}
+	case signerTypeWeb3Signer:
+		client, err := rpc.Dial(url)
+		if err != nil {
+			return nil, fmt.Errorf("连接 web3signer 失败: %v", err)
+		}
+		s.client = client
+		if address == "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := client.CallContext(ctx, &available, "eth_accounts"); err != nil {
+				return nil, fmt.Errorf("web3signer 列出账户失败: %v", err)
+			}
+		}
+	}
+
+	switch {
+	case address != "":
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("signer.address 格式错误: %s", address)
+		}
+		s.address = common.HexToAddress(address)
+	case len(available) == 1:
+		s.address = available[0]
+	default:
+		return nil, fmt.Errorf("签名服务上有 %d 个账户，请通过 signer.address 指定", len(available))
+	}
+	return s, nil
+}
+
+func (s *remoteSigner) Address() common.Address {
+	return s.address
+}
+
+func (s *remoteSigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	var (
+		signed *types.Transaction
+		err    error
+	)
+	if s.clef != nil {
+		signed, err = s.clef.SignTx(accounts.Account{Address: s.address}, tx, chainID)
+	} else {
+		signed, err = s.web3SignerSign(tx, chainID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s 签名失败: %v", s.kind, err)
+	}
+
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+	if err != nil || sender != s.address {
+		return nil, fmt.Errorf("%s 返回的签名与账户 %s 不符", s.kind, s.address.Hex())
+	}
+	if signed.Nonce() != tx.Nonce() || signed.Gas() != tx.Gas() || signed.GasPrice().Cmp(tx.GasPrice()) != 0 {
+		return nil, fmt.Errorf("%s 修改了交易的 nonce 或 gas", s.kind)
+	}
+	return signed, nil
+}
+
+// web3SignerSign eth_signTransaction，返回 RLP 编码的已签名交易
+func (s *remoteSigner) web3SignerSign(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args := map[string]interface{}{
+		"from":     s.address,
+		"gas":      hexutil.Uint64(tx.Gas()),
+		"gasPrice": (*hexutil.Big)(tx.GasPrice()),
+		"value":    (*hexutil.Big)(tx.Value()),
+		"nonce":    hexutil.Uint64(tx.Nonce()),
+		"data":     hexutil.Bytes(tx.Data()),
+		"chainId":  (*hexutil.Big)(chainID),
+	}
+	if tx.To() != nil {
+		args["to"] = tx.To()
+	}
+	if tx.Type() == types.AccessListTxType {
+		args["accessList"] = tx.AccessList()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteSignTimeout)
+	defer cancel()
+	var raw hexutil.Bytes
+	if err := s.client.CallContext(ctx, &raw, "eth_signTransaction", args); err != nil {
+		return nil, err
+	}
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("签名结果无法解码: %v", err)
+	}
+	return signed, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 风险快照统计窗口与保留时间
+const (
+	riskCounterpartyWindow = 30 * 24 * time.Hour // 对手方统计窗口
+	riskFailureTTL         = 30 * 24 * time.Hour // 验证失败记录保留时间
+	riskSnapshotTTL        = 90 * 24 * time.Hour // 快照保留时间
+	riskTrendWindow        = 7 * 24 * time.Hour  // 返回的趋势区间
+	riskSnapshotBucket     = "2006010215"        // 每个钱包每小时保留一份快照
+)
+
+// 风险等级
+const (
+	riskLow    = "low"
+	riskMedium = "medium"
+	riskHigh   = "high"
+)
+
+// RiskFactor 单项启发式规则的命中情况
+type RiskFactor struct {
+	Name   string `json:"name"`   // age / velocity_1h / velocity_24h / new_counterparties / failed_verifications
+	Value  int64  `json:"value"`  // 观测值
+	Points int    `json:"points"` // 计入总分的分值，未命中为 0
+	Reason string `json:"reason,omitempty"`
+}
+
+// RiskSnapshot 钱包活动风险快照 (nsRisk，key = snapshot/<wallet>/<小时>)
+type RiskSnapshot struct {
+	Wallet              string       `json:"wallet"`
+	Score               int          `json:"score"` // 0-100
+	Level               string       `json:"level"` // low / medium / high
+	FirstSeen           int64        `json:"firstSeen,omitempty"`
+	AgeHours            int64        `json:"ageHours"`
+	Transfers1h         int          `json:"transfers1h"`
+	Transfers24h        int          `json:"transfers24h"`
+	Counterparties      int          `json:"counterparties"`    // 30 天内的不同收款地址
+	NewCounterparties   int          `json:"newCounterparties"` // 24 小时内首次出现的收款地址
+	FailedVerifications int          `json:"failedVerifications24h"`
+	Factors             []RiskFactor `json:"factors"`
+	CreatedAt           int64        `json:"createdAt"`
+}
+
+// RiskPoint 趋势中的一个点
+type RiskPoint struct {
+	Time  int64  `json:"time"`
+	Score int    `json:"score"`
+	Level string `json:"level"`
+}
+
+// RiskData /api/wallet/{addr}/risk 返回数据
+type RiskData struct {
+	Snapshot RiskSnapshot `json:"snapshot"`
+	Trend    []RiskPoint  `json:"trend"` // 最近 7 天每小时一份，按时间升序
+}
+
+// riskFailure 一次签名验证失败 (nsRisk，key = failure/<wallet>/<纳秒时间戳>)
+type riskFailure struct {
+	Time   int64  `json:"time"`
+	Reason string `json:"reason"`
+}
+
+// recordFailedVerification 记录签名验证失败，供风险快照统计
+func (srv *Server) recordFailedVerification(wallet common.Address, err error) {
+	now := time.Now()
+	key := fmt.Sprintf("failure/%s/%020d", wallet.Hex(), now.UnixNano())
+	if err := putJSON(srv.storage, nsRisk, key, riskFailure{Time: now.Unix(), Reason: err.Error()}, riskFailureTTL); err != nil {
+		log.Printf("写入验证失败记录失败: %v", err)
+	}
+}
+
+// riskSnapshot 根据中继历史与验证失败记录计算当前快照
+func (srv *Server) riskSnapshot(wallet common.Address, now time.Time) (*RiskSnapshot, error) {
+	snap := &RiskSnapshot{Wallet: wallet.Hex(), CreatedAt: now.Unix()}
+
+	records, err := srv.storage.List(nsHistory, wallet.Hex()+"/")
+	if err != nil {
+		return nil, fmt.Errorf("读取历史失败: %v", err)
+	}
+	firstSeen := make(map[string]int64) // 收款地址 -> 首次转账时间
+	lastSeen := make(map[string]int64)  // 收款地址 -> 最近一次转账时间
+	for _, kv := range records {
+		var rec HistoryRecord
+		if err := json.Unmarshal(kv.Value, &rec); err != nil {
+			continue
+		}
+		if snap.FirstSeen == 0 || rec.CreatedAt < snap.FirstSeen {
+			snap.FirstSeen = rec.CreatedAt
+		}
+		age := now.Sub(time.Unix(rec.CreatedAt, 0))
+		if age <= time.Hour {
+			snap.Transfers1h++
+		}
+		if age <= 24*time.Hour {
+			snap.Transfers24h++
+		}
+		if t, ok := firstSeen[rec.To]; !ok || rec.CreatedAt < t {
+			firstSeen[rec.To] = rec.CreatedAt
+		}
+		lastSeen[rec.To] = max(lastSeen[rec.To], rec.CreatedAt)
+	}
+	for to, t := range firstSeen {
+		if now.Sub(time.Unix(t, 0)) <= 24*time.Hour {
+			snap.NewCounterparties++
+		}
+		if now.Sub(time.Unix(lastSeen[to], 0)) <= riskCounterpartyWindow {
+			snap.Counterparties++
+		}
+	}
+	if snap.FirstSeen > 0 {
+		snap.AgeHours = int64(now.Sub(time.Unix(snap.FirstSeen, 0)).Hours())
+	}
+
+	failures, err := srv.storage.List(nsRisk, "failure/"+wallet.Hex()+"/")
+	if err != nil {
+		return nil, fmt.Errorf("读取验证失败记录失败: %v", err)
+	}
+	for _, kv := range failures {
+		var f riskFailure
+		if json.Unmarshal(kv.Value, &f) == nil && now.Sub(time.Unix(f.Time, 0)) <= 24*time.Hour {
+			snap.FailedVerifications++
+		}
+	}
+
+	snap.Factors = riskFactors(snap)
+	for _, f := range snap.Factors {
+		snap.Score += f.Points
+	}
+	snap.Score = min(snap.Score, 100)
+	switch {
+	case snap.Score >= 60:
+		snap.Level = riskHigh
+	case snap.Score >= 30:
+		snap.Level = riskMedium
+	default:
+		snap.Level = riskLow
+	}
+	return snap, nil
+}
+
+// riskFactors 各项启发式规则，分值相加即总分
+func riskFactors(snap *RiskSnapshot) []RiskFactor {
+	age := RiskFactor{Name: "age", Value: snap.AgeHours}
+	switch {
+	case snap.FirstSeen == 0:
+		age.Points, age.Reason = 10, "没有中继记录"
+	case snap.AgeHours < 24:
+		age.Points, age.Reason = 20, "首次活动不足 1 天"
+	case snap.AgeHours < 7*24:
+		age.Points, age.Reason = 10, "首次活动不足 7 天"
+	}
+
+	v1h := RiskFactor{Name: "velocity_1h", Value: int64(snap.Transfers1h)}
+	if snap.Transfers1h > 5 {
+		v1h.Points, v1h.Reason = 15, "1 小时内转账超过 5 笔"
+	}
+	v24h := RiskFactor{Name: "velocity_24h", Value: int64(snap.Transfers24h)}
+	if snap.Transfers24h > 20 {
+		v24h.Points, v24h.Reason = 15, "24 小时内转账超过 20 笔"
+	}
+
+	counterparties := RiskFactor{Name: "new_counterparties", Value: int64(snap.NewCounterparties)}
+	if snap.NewCounterparties > 5 {
+		counterparties.Points, counterparties.Reason = 15, "24 小时内新增收款地址超过 5 个"
+	}
+
+	failed := RiskFactor{Name: "failed_verifications", Value: int64(snap.FailedVerifications)}
+	switch {
+	case snap.FailedVerifications >= 10:
+		failed.Points, failed.Reason = 40, "24 小时内签名验证失败 10 次以上"
+	case snap.FailedVerifications >= 3:
+		failed.Points, failed.Reason = 20, "24 小时内签名验证失败 3 次以上"
+	}
+
+	return []RiskFactor{age, v1h, v24h, counterparties, failed}
+}
+
+// saveRiskSnapshot 保存快照，同一小时内只保留最新一份
+func (srv *Server) saveRiskSnapshot(snap *RiskSnapshot) error {
+	bucket := time.Unix(snap.CreatedAt, 0).UTC().Format(riskSnapshotBucket)
+	return putJSON(srv.storage, nsRisk, "snapshot/"+snap.Wallet+"/"+bucket, snap, riskSnapshotTTL)
+}
+
+// riskTrend 读取 since 之后保存的快照
+func (srv *Server) riskTrend(wallet common.Address, since time.Time) ([]RiskPoint, error) {
+	kvs, err := srv.storage.List(nsRisk, "snapshot/"+wallet.Hex()+"/")
+	if err != nil {
+		return nil, fmt.Errorf("读取快照失败: %v", err)
+	}
+	trend := []RiskPoint{}
+	for _, kv := range kvs {
+		var snap RiskSnapshot
+		if json.Unmarshal(kv.Value, &snap) != nil || snap.CreatedAt < since.Unix() {
+			continue
+		}
+		trend = append(trend, RiskPoint{Time: snap.CreatedAt, Score: snap.Score, Level: snap.Level})
+	}
+	return trend, nil
+}
+
+// handleWalletRisk 计算并保存钱包风险快照，同时返回最近 7 天的趋势 (管理接口)
+//
+//	GET /api/wallet/{addr}/risk
+func (srv *Server) handleWalletRisk(w http.ResponseWriter, r *http.Request) {
+	addr := r.PathValue("addr")
+	if !common.IsHexAddress(addr) {
+		sendError(w, "钱包地址格式错误: "+addr)
+		return
+	}
+	wallet := common.HexToAddress(addr)
+
+	now := time.Now()
+	snap, err := srv.riskSnapshot(wallet, now)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	if err := srv.saveRiskSnapshot(snap); err != nil {
+		log.Printf("保存风险快照失败: %v", err)
+	}
+	trend, err := srv.riskTrend(wallet, now.Add(-riskTrendWindow))
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Message: "风险等级: " + snap.Level,
+		Data:    RiskData{Snapshot: *snap, Trend: trend},
+	})
+}
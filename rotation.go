@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 主中继账户轮换的阶段
+const (
+	rotationDraining = "draining" // 旧账户不再接收新交易，等待在途交易上链
+	rotationSweeping = "sweeping" // 把旧账户剩余的 ETH 转到新账户
+	rotationDone     = "done"
+	rotationFailed   = "failed"
+
+	rotationDrainTimeout = 10 * time.Minute
+	rotationWaitTimeout  = 5 * time.Minute // 轮换期间没有其它中继账户时，新请求最多等待多久
+	rotationPollInterval = 3 * time.Second
+	rotationStatusKey    = "rotation"
+)
+
+// RotateRequest POST /api/admin/rotate 请求
+type RotateRequest struct {
+	PrivateKey string `json:"privateKey"` // 新中继私钥 (支持 enc:v1:)
+}
+
+// RotationStatus 最近一次主中继账户轮换
+type RotationStatus struct {
+	OldAddress string `json:"oldAddress"`
+	NewAddress string `json:"newAddress"`
+	Stage      string `json:"stage"`
+	SweepTx    string `json:"sweepTx,omitempty"`
+	Swept      string `json:"swept,omitempty"` // 转到新账户的 ETH (wei)
+	Error      string `json:"error,omitempty"`
+	StartedAt  int64  `json:"startedAt"`
+	UpdatedAt  int64  `json:"updatedAt"`
+}
+
+// keyRotation 不停机更换主中继账户 (private_key)
+//
+// 旧账户先停止接收新交易 (有中继池时新请求由其它账户处理，否则排队等待)，等在途交易
+// 全部上链后把剩余 ETH 转到新账户，确认后再切换签名者，之后的交易都由新账户签名。
+type keyRotation struct {
+	srv *Server
+
+	mu       sync.Mutex
+	status   *RotationStatus
+	switched chan struct{} // 轮换进行中时非 nil，结束 (成功或失败) 后关闭
+	cancel   context.CancelFunc
+}
+
+func newKeyRotation(srv *Server) *keyRotation {
+	return &keyRotation{srv: srv}
+}
+
+// draining 该账户是否正在轮换，不应再分配新交易
+func (k *keyRotation) draining(r *relayer) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return r.primary && k.switched != nil
+}
+
+// wait 轮换进行中时返回结束信号，否则返回 nil
+func (k *keyRotation) wait() <-chan struct{} {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.switched
+}
+
+// current 最近一次轮换的状态 (副本)，内存中没有时读取存储
+func (k *keyRotation) current() (*RotationStatus, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.status != nil {
+		st := *k.status
+		return &st, nil
+	}
+	var st RotationStatus
+	found, err := getJSON(k.srv.storage, nsPolicies, rotationStatusKey, &st)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// start 校验新私钥并在后台开始轮换
+func (k *keyRotation) start(hexKey string) (*RotationStatus, error) {
+	hexKey, err := decryptValue(k.srv.Config().Secrets, hexKey)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(hexKey), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("私钥格式错误: %v", err)
+	}
+	registerLogSecret(hexKey)
+	next := newKeySigner(privateKey)
+	old := k.srv.signer()
+	if old == nil {
+		return nil, fmt.Errorf("未配置私钥，直接在配置中设置 private_key 即可")
+	}
+	if next.Address() == old.Address() {
+		return nil, fmt.Errorf("新私钥与当前中继账户相同")
+	}
+	if _, ok := k.srv.relayers.lookup(next.Address()); ok {
+		return nil, fmt.Errorf("%s 已在中继池中", next.Address().Hex())
+	}
+
+	k.mu.Lock()
+	if k.switched != nil {
+		k.mu.Unlock()
+		return nil, fmt.Errorf("已有轮换正在进行")
+	}
+	now := time.Now().Unix()
+	k.status = &RotationStatus{
+		OldAddress: old.Address().Hex(),
+		NewAddress: next.Address().Hex(),
+		Stage:      rotationDraining,
+		StartedAt:  now,
+		UpdatedAt:  now,
+	}
+	k.switched = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	k.cancel = cancel
+	st := *k.status
+	k.persistLocked()
+	k.mu.Unlock()
+
+	log.Printf("开始轮换中继账户: %s -> %s", st.OldAddress, st.NewAddress)
+	go k.run(ctx, old, next)
+	return &st, nil
+}
+
+// abort 排空阶段取消轮换，旧账户恢复接收交易
+func (k *keyRotation) abort() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.switched == nil {
+		return fmt.Errorf("没有正在进行的轮换")
+	}
+	if k.status.Stage != rotationDraining {
+		return fmt.Errorf("已开始转移余额，无法取消")
+	}
+	k.cancel()
+	return nil
+}
+
+func (k *keyRotation) run(ctx context.Context, old, next Signer) {
+	defer k.cancel()
+
+	err := k.drain(ctx, old.Address())
+	if err == nil {
+		k.update(func(st *RotationStatus) { st.Stage = rotationSweeping })
+		err = k.sweep(ctx, old, next.Address())
+	}
+
+	k.mu.Lock()
+	if err != nil {
+		k.status.Stage = rotationFailed
+		k.status.Error = err.Error()
+	} else {
+		// 先换签名者再放行排队的请求，之后分配的 nonce 都属于新账户
+		k.srv.SetSigner(next)
+		k.srv.nonces.resync()
+		k.status.Stage = rotationDone
+	}
+	k.status.UpdatedAt = time.Now().Unix()
+	st := *k.status
+	k.persistLocked()
+	close(k.switched)
+	k.switched = nil
+	k.mu.Unlock()
+
+	message := fmt.Sprintf("中继账户已轮换: %s -> %s，请在重启前把 private_key 更新为新私钥", st.OldAddress, st.NewAddress)
+	if err != nil {
+		message = fmt.Sprintf("中继账户轮换失败，继续使用 %s: %v", st.OldAddress, err)
+	}
+	log.Println(message)
+	k.srv.treasury.notify(WalletEvent{Type: "relayer_rotation", From: st.OldAddress, To: st.NewAddress, TxHash: st.SweepTx, Message: message, Timestamp: time.Now().Unix()})
+}
+
+// drain 等待旧账户的在途交易全部上链
+func (k *keyRotation) drain(ctx context.Context, from common.Address) error {
+	primary := k.srv.relayers.members[0]
+	ticker := time.NewTicker(rotationPollInterval)
+	defer ticker.Stop()
+	timeout := time.After(rotationDrainTimeout)
+	for {
+		if primary.inflight.Load() == 0 && k.srv.submissions.pendingCounts()[from] == 0 {
+			confirmed, err1 := k.srv.eth().NonceAt(ctx, from, nil)
+			pending, err2 := k.srv.eth().PendingNonceAt(ctx, from)
+			if err1 == nil && err2 == nil && confirmed == pending {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("管理员已取消")
+		case <-timeout:
+			return fmt.Errorf("%s 内旧账户仍有未上链的交易", rotationDrainTimeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep 扣除转账手续费后把旧账户的全部余额转到新账户，并等待上链
+func (k *keyRotation) sweep(ctx context.Context, old Signer, to common.Address) error {
+	balance, err := k.srv.eth().BalanceAt(ctx, old.Address(), nil)
+	if err != nil {
+		return fmt.Errorf("查询旧账户余额失败: %v", err)
+	}
+	gasPrice, err := k.srv.gasPrice(ctx)
+	if err != nil {
+		return err
+	}
+	amount := new(big.Int).Sub(balance, new(big.Int).Mul(gasPrice, big.NewInt(treasuryTransferGas)))
+	if amount.Sign() <= 0 {
+		log.Printf("旧中继账户余额 %s wei 不足以支付转账手续费，跳过余额转移", balance)
+		return nil
+	}
+
+	nonce, err := k.srv.nonces.reserve()
+	if err != nil {
+		return err
+	}
+	tx := k.srv.newRelayTx(nonce, to, amount, treasuryTransferGas, gasPrice, nil, nil)
+	signedTx, err := old.SignTx(tx, k.srv.chainID)
+	if err == nil {
+		err = k.srv.broadcast(signedTx)
+	}
+	k.srv.nonces.complete(nonce, err)
+	if err != nil {
+		return fmt.Errorf("转移余额失败: %v", err)
+	}
+	k.update(func(st *RotationStatus) {
+		st.SweepTx = signedTx.Hash().Hex()
+		st.Swept = amount.String()
+	})
+	if _, err := k.srv.waitReceipt(signedTx.Hash()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (k *keyRotation) update(fn func(st *RotationStatus)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	fn(k.status)
+	k.status.UpdatedAt = time.Now().Unix()
+	k.persistLocked()
+}
+
+// persistLocked 保存状态供重启后查询，调用方持有 k.mu
+func (k *keyRotation) persistLocked() {
+	if err := putJSON(k.srv.storage, nsPolicies, rotationStatusKey, k.status, 0); err != nil {
+		log.Printf("保存轮换状态失败: %v", err)
+	}
+}
+
+// handleAdminRotate 主中继账户轮换
+//
+//	GET    查看最近一次轮换
+//	POST   {"privateKey": "0x..."} 开始轮换
+//	DELETE 排空阶段取消轮换
+func (srv *Server) handleAdminRotate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		st, err := srv.rotation.current()
+		if err != nil {
+			sendError(w, "读取轮换状态失败: "+err.Error())
+			return
+		}
+		resp := APIResponse{Success: true}
+		if st == nil {
+			resp.Message = "没有轮换记录"
+		} else {
+			resp.Data = st
+		}
+		json.NewEncoder(w).Encode(resp)
+
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req RotateRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		st, err := srv.rotation.start(req.PrivateKey)
+		if err != nil {
+			sendError(w, "轮换失败: "+err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "已开始轮换，旧账户的在途交易上链并转移余额后切换到新账户",
+			Data:    st,
+		})
+
+	case "DELETE":
+		if err := srv.rotation.abort(); err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "已取消轮换",
+		})
+	}
+}
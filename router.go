@@ -0,0 +1,109 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// middleware 包装单个接口的中间件 (mutating、idempotent、rateLimited、adminOnly)
+type middleware func(http.HandlerFunc) http.HandlerFunc
+
+// router 按方法与路径注册接口，路径参数用 {name} 声明，handler 中通过 r.PathValue 读取
+//
+// 同一路径未注册的方法统一返回 405 (带 Allow 头)；with 派生的分组共用一个 mux，只叠加中间件。
+type router struct {
+	mux     *http.ServeMux
+	methods map[string][]string // 路径 -> 已注册的方法
+	chain   []middleware
+}
+
+func newRouter() *router {
+	return &router{mux: http.NewServeMux(), methods: make(map[string][]string)}
+}
+
+// with 返回叠加了中间件的分组，先传入的在外层
+func (rt *router) with(mw ...middleware) *router {
+	return &router{mux: rt.mux, methods: rt.methods, chain: append(slices.Clip(rt.chain), mw...)}
+}
+
+// handle 注册接口，methods 为空格分隔的方法列表，如 "GET POST"
+func (rt *router) handle(methods, path string, h http.HandlerFunc) {
+	for i := len(rt.chain) - 1; i >= 0; i-- {
+		h = rt.chain[i](h)
+	}
+	if _, ok := rt.methods[path]; !ok {
+		rt.mux.HandleFunc(path, rt.methodNotAllowed(path))
+	}
+	for _, m := range strings.Fields(methods) {
+		rt.mux.HandleFunc(m+" "+path, h)
+		rt.methods[path] = append(rt.methods[path], m)
+		if m == "GET" {
+			// ServeMux 的 GET 模式同样匹配 HEAD，handler 只处理注册的方法
+			rt.mux.HandleFunc("HEAD "+path, rt.methodNotAllowed(path))
+		}
+	}
+}
+
+func (rt *router) get(path string, h http.HandlerFunc)  { rt.handle("GET", path, h) }
+func (rt *router) post(path string, h http.HandlerFunc) { rt.handle("POST", path, h) }
+
+// methodNotAllowed 路径已注册但方法不匹配
+func (rt *router) methodNotAllowed(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		methods := rt.methods[path]
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		sendError(w, "只支持 "+strings.Join(methods, "/")+" 请求")
+	}
+}
+
+// apiNotFound 未注册的 /api/ 路径返回 JSON 错误 (不再落到首页)
+func apiNotFound(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotFound)
+	sendError(w, "接口不存在: "+r.URL.Path)
+}
+
+// apiHeaders 为 /api/ 接口统一设置 CORS 头与 JSON 响应类型，并直接应答 CORS 预检
+//
+// 管理接口 (/api/admin/) 只供服务端调用，不返回 CORS 头。返回 CSV、事件流的 handler 自行覆盖 Content-Type。
+func apiHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/api/admin/") {
+			setCORSHeaders(w)
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recovered 捕获 handler 中的 panic: 记录请求 ID 与堆栈并返回 500，而不是直接断开连接
+func recovered(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			log.Printf("[panic] id=%s %s %s: %v\n%s", requestIDFrom(r), r.Method, r.URL.Path, p, debug.Stack())
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			sendError(w, "服务器内部错误")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// rpcBatchLimit 单个 batch 请求最多包含的调用数 (多数节点服务商限制在 100 左右)，超出时分多次发送
+const rpcBatchLimit = 100
+
+// rpcBatch 一组只读 JSON-RPC 请求，由 sendBatch 通过 rpc.BatchCall 在一次往返中发送
+//
+// 每个请求单独记录错误: 某个合约调用回滚不影响同一批的其它结果。
+//
+//	var b rpcBatch
+//	var out hexutil.Bytes
+//	i := b.call(token, data, &out)
+//	if err := srv.sendBatch(ctx, &b); err != nil { ... }
+//	if err := b.err(i); err != nil { ... }
+type rpcBatch struct {
+	elems []rpc.BatchElem
+}
+
+// add 加入一个请求，result 为结果指针；返回序号，发送后用 err(i) 取该请求的错误
+func (b *rpcBatch) add(result interface{}, method string, args ...interface{}) int {
+	b.elems = append(b.elems, rpc.BatchElem{Method: method, Args: args, Result: result})
+	return len(b.elems) - 1
+}
+
+// call 加入 eth_call (latest)
+func (b *rpcBatch) call(to common.Address, data []byte, out *hexutil.Bytes) int {
+	arg := map[string]interface{}{"to": to, "data": hexutil.Bytes(data)}
+	return b.add(out, "eth_call", arg, "latest")
+}
+
+// balance 加入 eth_getBalance (latest)
+func (b *rpcBatch) balance(addr common.Address, out *hexutil.Big) int {
+	return b.add(out, "eth_getBalance", addr, "latest")
+}
+
+// nonce 加入 eth_getTransactionCount，pending 为 true 时包含交易池中的交易
+func (b *rpcBatch) nonce(addr common.Address, pending bool, out *hexutil.Uint64) int {
+	block := "latest"
+	if pending {
+		block = "pending"
+	}
+	return b.add(out, "eth_getTransactionCount", addr, block)
+}
+
+// err 第 i 个请求的错误
+func (b *rpcBatch) err(i int) error {
+	return b.elems[i].Error
+}
+
+// sendBatch 发送 batch 中的全部请求，只有整个请求失败 (连接错误等) 时返回 error
+func (srv *Server) sendBatch(ctx context.Context, b *rpcBatch) error {
+	client := srv.eth().Client()
+	for start := 0; start < len(b.elems); start += rpcBatchLimit {
+		end := min(start+rpcBatchLimit, len(b.elems))
+		if err := client.BatchCallContext(ctx, b.elems[start:end]); err != nil {
+			srv.rpc.reportError(err)
+			return fmt.Errorf("批量 RPC 请求失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// accountState 账户余额与 nonce
+type accountState struct {
+	Balance      *big.Int
+	Nonce        uint64 // 已上链的 nonce
+	PendingNonce uint64 // 含交易池中的交易
+	Err          error
+}
+
+// accountStates 一次往返读取多个账户的余额与 nonce (中继池、卡住交易检查等)
+func (srv *Server) accountStates(ctx context.Context, addrs []common.Address) ([]accountState, error) {
+	var b rpcBatch
+	balances := make([]hexutil.Big, len(addrs))
+	nonces := make([]hexutil.Uint64, len(addrs))
+	pending := make([]hexutil.Uint64, len(addrs))
+	for i, addr := range addrs {
+		b.balance(addr, &balances[i])
+		b.nonce(addr, false, &nonces[i])
+		b.nonce(addr, true, &pending[i])
+	}
+	if err := srv.sendBatch(ctx, &b); err != nil {
+		return nil, err
+	}
+
+	states := make([]accountState, len(addrs))
+	for i := range addrs {
+		for j := 3 * i; j < 3*i+3; j++ {
+			if err := b.err(j); err != nil && states[i].Err == nil {
+				states[i].Err = err
+			}
+		}
+		states[i].Balance = balances[i].ToInt()
+		states[i].Nonce = uint64(nonces[i])
+		states[i].PendingNonce = uint64(pending[i])
+	}
+	return states, nil
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 重连退避与故障切换参数
+const (
+	redialMinBackoff    = time.Second
+	redialMaxBackoff    = time.Minute
+	rpcHealthCheckEvery = 30 * time.Second
+	rpcProbeTimeout     = 10 * time.Second
+	rpcFailoverCooldown = time.Minute // 出错或落后的端点在冷却期内不参与切换
+	rpcMaxBlockLag      = 5           // 当前端点落后最新区块超过该数量时切换
+)
+
+// rpcEndpoint 一个 RPC 端点的状态
+type rpcEndpoint struct {
+	url           string
+	client        *ethclient.Client // nil 表示尚未连接或上次出错后已关闭
+	head          uint64            // 最近一次健康检查读到的区块高度
+	cooldownUntil time.Time
+}
+
+// RPCEndpointStatus /api/admin/stats 中的端点状态
+type RPCEndpointStatus struct {
+	URL           string `json:"url"`
+	Active        bool   `json:"active"`
+	Head          uint64 `json:"head,omitempty"`
+	CooldownUntil int64  `json:"cooldownUntil,omitempty"` // unix 秒，冷却中的端点不参与切换
+	Circuit       string `json:"circuit"`                 // 熔断状态 closed / open / half_open
+}
+
+// rpcConn 可自动重连、按健康状况在多个端点间切换的 RPC 客户端
+//
+// 配置了备用端点时，健康检查会探测每个端点的区块高度: 当前端点出错或落后超过 rpcMaxBlockLag
+// 时进入冷却并切换到其它可用端点；调用方上报连接错误时同样立即切换。所有端点都不可用时
+// 在后台按指数退避轮流重新拨号。切换后执行 onReconnect 回调 (重新订阅等)。
+type rpcConn struct {
+	throttle *rpcThrottle // 跨重连 / 切换保留限流状态
+	metrics  *rpcMetrics  // 按方法统计，按端点熔断；其下是超时重试与限流
+
+	mu        sync.RWMutex
+	endpoints []*rpcEndpoint
+	active    int
+	client    *ethclient.Client // 当前端点的 client
+	hooks     []func(*ethclient.Client)
+
+	redialing atomic.Bool
+	closed    chan struct{}
+}
+
+// dialRPC 按顺序连接 url 与备用端点，第一个连上的作为当前端点，并启动健康检查
+func dialRPC(opts RPCClientConfig, url string, fallbacks ...string) (*rpcConn, error) {
+	c := &rpcConn{throttle: newRPCThrottle(), closed: make(chan struct{})}
+	c.metrics = newRPCMetrics(newRPCRetry(c.throttle, opts))
+	for _, u := range append([]string{url}, fallbacks...) {
+		if u != "" {
+			c.endpoints = append(c.endpoints, &rpcEndpoint{url: u})
+		}
+	}
+	if len(c.endpoints) == 0 {
+		return nil, errors.New("未配置 RPC 地址")
+	}
+
+	var lastErr error
+	for i, ep := range c.endpoints {
+		client, err := c.dial(ep.url)
+		if err != nil {
+			log.Printf("连接 RPC %s 失败: %v", ep.url, err)
+			ep.cooldownUntil = time.Now().Add(rpcFailoverCooldown)
+			lastErr = err
+			continue
+		}
+		ep.client = client
+		c.active, c.client = i, client
+		break
+	}
+	if c.client == nil {
+		return nil, lastErr
+	}
+	go c.healthLoop()
+	return c, nil
+}
+
+// dial 建立新连接，HTTP 端点依次经过统计 / 熔断、超时重试与限流 transport
+func (c *rpcConn) dial(url string) (*ethclient.Client, error) {
+	client, err := rpc.DialOptions(context.Background(), url, rpc.WithHTTPClient(&http.Client{Transport: c.metrics}))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(client), nil
+}
+
+// probe 连接 (如需要) 并读取区块高度
+func (c *rpcConn) probe(ep *rpcEndpoint) (*ethclient.Client, uint64, error) {
+	c.mu.RLock()
+	client := ep.client
+	c.mu.RUnlock()
+	if client == nil {
+		var err error
+		if client, err = c.dial(ep.url); err != nil {
+			return nil, 0, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rpcProbeTimeout)
+	defer cancel()
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return client, 0, err
+	}
+	return client, head, nil
+}
+
+// get 返回当前 client
+func (c *rpcConn) get() *ethclient.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// onReconnect 注册重连 / 切换成功后的回调
+func (c *rpcConn) onReconnect(fn func(*ethclient.Client)) {
+	c.mu.Lock()
+	c.hooks = append(c.hooks, fn)
+	c.mu.Unlock()
+}
+
+// reportError 调用方上报错误，连接类错误触发切换 (没有可用的备用端点时后台重连)
+func (c *rpcConn) reportError(err error) {
+	if !isConnectionError(err) {
+		return
+	}
+	c.mu.RLock()
+	from := c.active
+	c.mu.RUnlock()
+	if !c.failover(from, err) {
+		c.triggerRedial(err)
+	}
+}
+
+// markFailed 端点进入冷却，关闭其备用连接 (当前端点的 client 由切换方关闭)
+func (c *rpcConn) markFailed(i int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ep := c.endpoints[i]
+	ep.cooldownUntil = time.Now().Add(rpcFailoverCooldown)
+	if i != c.active && ep.client != nil {
+		ep.client.Close()
+		ep.client = nil
+	}
+}
+
+// failover 当前端点 from 进入冷却，依次尝试其它不在冷却期的端点，返回是否已切换
+func (c *rpcConn) failover(from int, cause error) bool {
+	c.mu.Lock()
+	if c.active != from {
+		c.mu.Unlock()
+		return true // 其它调用方已经切换过
+	}
+	if len(c.endpoints) == 1 {
+		c.mu.Unlock()
+		return false
+	}
+	now := time.Now()
+	c.endpoints[from].cooldownUntil = now.Add(rpcFailoverCooldown)
+	var candidates []int
+	for k := 1; k < len(c.endpoints); k++ {
+		i := (from + k) % len(c.endpoints)
+		if now.After(c.endpoints[i].cooldownUntil) {
+			candidates = append(candidates, i)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, i := range candidates {
+		client, _, err := c.probe(c.endpoints[i])
+		if err != nil {
+			if client != nil {
+				c.mu.Lock()
+				if c.endpoints[i].client == nil {
+					client.Close()
+				}
+				c.mu.Unlock()
+			}
+			c.markFailed(i)
+			continue
+		}
+		log.Printf("RPC %s 异常，切换到 %s: %v", c.endpoints[from].url, c.endpoints[i].url, cause)
+		return c.switchTo(from, i, client)
+	}
+	return false
+}
+
+// switchTo 把当前端点从 from 切换到 i，from 的连接关闭后在健康检查时重新拨号
+func (c *rpcConn) switchTo(from, i int, client *ethclient.Client) bool {
+	c.mu.Lock()
+	if c.active != from {
+		c.mu.Unlock()
+		return true
+	}
+	old := c.endpoints[from]
+	oldClient := old.client
+	old.client = nil
+	c.endpoints[i].client = client
+	c.active, c.client = i, client
+	hooks := append([]func(*ethclient.Client){}, c.hooks...)
+	c.mu.Unlock()
+	if oldClient != nil && oldClient != client {
+		oldClient.Close()
+	}
+
+	for _, fn := range hooks {
+		fn(client)
+	}
+	return true
+}
+
+func (c *rpcConn) triggerRedial(cause error) {
+	if !c.redialing.CompareAndSwap(false, true) {
+		return
+	}
+	log.Printf("RPC 连接异常，开始重连: %v", cause)
+	go c.redial()
+}
+
+// redial 指数退避轮流重连所有端点 (忽略冷却)，直到成功或 Close
+func (c *rpcConn) redial() {
+	defer c.redialing.Store(false)
+
+	backoff := redialMinBackoff
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-time.After(backoff):
+		}
+
+		c.mu.RLock()
+		from := c.active
+		c.mu.RUnlock()
+		var lastErr error
+		for k := 0; k < len(c.endpoints); k++ {
+			i := (from + k) % len(c.endpoints)
+			client, err := c.dial(c.endpoints[i].url)
+			if err == nil {
+				ctx, cancel := context.WithTimeout(context.Background(), rpcProbeTimeout)
+				_, err = client.BlockNumber(ctx)
+				cancel()
+				if err != nil {
+					client.Close()
+				}
+			}
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			c.mu.Lock()
+			c.endpoints[from].client = c.client // 由 switchTo 关闭
+			c.endpoints[i].cooldownUntil = time.Time{}
+			c.mu.Unlock()
+			c.switchTo(from, i, client)
+			log.Printf("RPC 已重新连接: %s", c.endpoints[i].url)
+			return
+		}
+		log.Printf("RPC 重连失败 (%s 后重试): %v", backoff, lastErr)
+		backoff = min(backoff*2, redialMaxBackoff)
+	}
+}
+
+// healthLoop 定期探测连接，websocket 断开后 client 不会自行恢复
+func (c *rpcConn) healthLoop() {
+	ticker := time.NewTicker(rpcHealthCheckEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+			c.checkHealth()
+		}
+	}
+}
+
+// checkHealth 探测各端点的区块高度，当前端点出错或明显落后时切换
+func (c *rpcConn) checkHealth() {
+	if c.redialing.Load() {
+		return
+	}
+	c.mu.RLock()
+	active := c.active
+	c.mu.RUnlock()
+
+	// 只有一个端点时保持原有行为: 只探测当前连接，出错后重连
+	if len(c.endpoints) == 1 {
+		ctx, cancel := context.WithTimeout(context.Background(), rpcProbeTimeout)
+		_, err := c.get().BlockNumber(ctx)
+		cancel()
+		if err != nil {
+			c.reportError(err)
+		}
+		return
+	}
+
+	var (
+		best     uint64
+		bestIdx  = -1
+		clients  = make([]*ethclient.Client, len(c.endpoints))
+		activeOK bool
+	)
+	now := time.Now()
+	for i, ep := range c.endpoints {
+		c.mu.RLock()
+		cooling := now.Before(ep.cooldownUntil)
+		c.mu.RUnlock()
+		if cooling && i != active {
+			continue
+		}
+		client, head, err := c.probe(ep)
+		if err != nil {
+			if i == active {
+				if !c.failover(active, err) {
+					c.triggerRedial(err)
+				}
+				return
+			}
+			if client != nil {
+				c.mu.RLock()
+				owned := ep.client == client
+				c.mu.RUnlock()
+				if !owned {
+					client.Close()
+				}
+			}
+			c.markFailed(i)
+			continue
+		}
+		c.mu.Lock()
+		ep.head = head
+		if i != active && ep.client == nil {
+			ep.client = client
+		}
+		c.mu.Unlock()
+		clients[i] = client
+		if i == active {
+			activeOK = true
+		}
+		if head > best {
+			best, bestIdx = head, i
+		}
+	}
+
+	c.mu.RLock()
+	activeHead := c.endpoints[active].head
+	c.mu.RUnlock()
+	if activeOK && bestIdx >= 0 && bestIdx != active && best > activeHead+rpcMaxBlockLag {
+		log.Printf("RPC %s 落后 %d 个区块，切换到 %s", c.endpoints[active].url, best-activeHead, c.endpoints[bestIdx].url)
+		c.mu.Lock()
+		c.endpoints[active].cooldownUntil = now.Add(rpcFailoverCooldown)
+		c.mu.Unlock()
+		c.switchTo(active, bestIdx, clients[bestIdx])
+	}
+}
+
+// status 各端点的状态
+func (c *rpcConn) status() []RPCEndpointStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]RPCEndpointStatus, 0, len(c.endpoints))
+	for i, ep := range c.endpoints {
+		st := RPCEndpointStatus{URL: redactRPCURL(ep.url), Active: i == c.active, Head: ep.head, Circuit: c.metrics.circuit(ep.url)}
+		if time.Now().Before(ep.cooldownUntil) {
+			st.CooldownUntil = ep.cooldownUntil.Unix()
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// redactRPCURL 去掉 URL 中可能包含 API key 的路径与查询参数
+func redactRPCURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "***"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Close 停止健康检查并关闭所有连接
+func (c *rpcConn) Close() {
+	close(c.closed)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ep := range c.endpoints {
+		if ep.client != nil && ep.client != c.client {
+			ep.client.Close()
+		}
+	}
+	c.client.Close()
+}
+
+// isConnectionError 判断是否为连接层面的错误 (而非合约回滚等业务错误)
+func isConnectionError(err error) bool {
+	if err == nil || isUpstreamRateLimited(err.Error()) {
+		return false
+	}
+	if errors.Is(err, rpc.ErrClientQuit) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe") ||
+		strings.Contains(msg, "use of closed network connection") || strings.Contains(msg, "websocket: close")
+}
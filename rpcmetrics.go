@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 熔断参数
+const (
+	rpcBreakerThreshold = 5                // 连续失败多少次后熔断
+	rpcBreakerOpenFor   = 30 * time.Second // 熔断持续时间，之后放行一个探测请求
+
+	// rpcUnavailableMsg 熔断期间快速失败的错误信息前缀，sendError 据此附带错误码
+	rpcUnavailableMsg = "RPC 暂不可用"
+	// errCodeRPCUnavailable 上游 RPC 熔断中的错误码 (APIResponse.Code)，调用方应稍后重试
+	errCodeRPCUnavailable = "rpc_unavailable"
+)
+
+// 熔断状态 (RPCEndpointStatus.Circuit)
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// RPCMethodStats /api/admin/stats 中单个 JSON-RPC 方法的统计
+type RPCMethodStats struct {
+	Method    string  `json:"method"`
+	Calls     int64   `json:"calls"`
+	Errors    int64   `json:"errors"` // 传输错误、HTTP 错误与 JSON-RPC 错误响应 (含合约回滚)
+	ErrorRate float64 `json:"errorRate"`
+	AvgMs     float64 `json:"avgMs"`
+	MaxMs     int64   `json:"maxMs"`
+}
+
+type rpcMethodCounter struct {
+	calls, errors int64
+	total, max    time.Duration
+}
+
+// rpcBreaker 单个端点的熔断器
+type rpcBreaker struct {
+	failures  int
+	openUntil time.Time
+	probing   bool // 半开状态下已放行探测请求
+}
+
+func (b *rpcBreaker) state(now time.Time) string {
+	switch {
+	case b.failures < rpcBreakerThreshold:
+		return circuitClosed
+	case now.Before(b.openUntil):
+		return circuitOpen
+	default:
+		return circuitHalfOpen
+	}
+}
+
+// rpcMetrics 记录每个 JSON-RPC 方法的耗时与错误率，并按端点熔断的 HTTP transport
+//
+// 端点连续 rpcBreakerThreshold 次请求失败 (连接错误、超时、HTTP 5xx) 后熔断 rpcBreakerOpenFor，
+// 期间请求立即返回 rpcUnavailableMsg 错误，而不是每个 handler 各自等到超时；该错误属于连接错误，
+// 有备用端点时会触发切换。熔断结束后放行一个探测请求，成功则恢复。JSON-RPC 错误 (如合约回滚)
+// 只计入统计，不触发熔断。与 rpcThrottle 一样只作用于 HTTP 端点。
+type rpcMetrics struct {
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	methods  map[string]*rpcMethodCounter
+	breakers map[string]*rpcBreaker // key = endpointKey
+}
+
+func newRPCMetrics(next http.RoundTripper) *rpcMetrics {
+	return &rpcMetrics{
+		next:     next,
+		methods:  make(map[string]*rpcMethodCounter),
+		breakers: make(map[string]*rpcBreaker),
+	}
+}
+
+// endpointKey 熔断按端点区分 (不含查询参数)
+func endpointKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// rpcMessage JSON-RPC 请求 / 响应中用到的字段
+type rpcMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// parseRPCMessages 解析单个或批量 JSON-RPC 消息
+func parseRPCMessages(raw []byte) []rpcMessage {
+	var msgs []rpcMessage
+	if err := json.Unmarshal(raw, &msgs); err != nil {
+		var single rpcMessage
+		if json.Unmarshal(raw, &single) != nil {
+			return nil
+		}
+		msgs = []rpcMessage{single}
+	}
+	return msgs
+}
+
+// allow 熔断中返回错误；半开状态只放行一个探测请求
+func (m *rpcMetrics) allow(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.breakers[key]
+	if b == nil {
+		return nil
+	}
+	now := time.Now()
+	switch b.state(now) {
+	case circuitOpen:
+		return fmt.Errorf("%s: 连续 %d 次请求失败，熔断中 (%s 后重试)", rpcUnavailableMsg, b.failures, b.openUntil.Sub(now).Round(time.Second))
+	case circuitHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%s: 熔断恢复探测中", rpcUnavailableMsg)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// result 记录请求结果，更新熔断状态
+func (m *rpcMetrics) result(key string, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.breakers[key]
+	if b == nil {
+		b = &rpcBreaker{}
+		m.breakers[key] = b
+	}
+	if !failed {
+		if b.failures >= rpcBreakerThreshold {
+			log.Printf("RPC %s 已恢复，解除熔断", redactRPCURL(key))
+		}
+		*b = rpcBreaker{}
+		return
+	}
+	b.failures++
+	b.probing = false
+	if b.failures >= rpcBreakerThreshold {
+		if b.failures == rpcBreakerThreshold {
+			log.Printf("RPC %s 连续 %d 次请求失败，熔断 %s", redactRPCURL(key), b.failures, rpcBreakerOpenFor)
+		}
+		b.openUntil = time.Now().Add(rpcBreakerOpenFor)
+	}
+}
+
+// record 按方法累计耗时与错误
+func (m *rpcMetrics) record(methods []string, errored map[int]bool, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, method := range methods {
+		c := m.methods[method]
+		if c == nil {
+			c = &rpcMethodCounter{}
+			m.methods[method] = c
+		}
+		c.calls++
+		if errored[i] || errored[-1] {
+			c.errors++
+		}
+		c.total += elapsed
+		c.max = max(c.max, elapsed)
+	}
+}
+
+// RoundTrip 熔断检查、转发并记录结果
+func (m *rpcMetrics) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := endpointKey(req.URL)
+	if err := m.allow(key); err != nil {
+		return nil, err
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	reqs := parseRPCMessages(body)
+	methods := make([]string, len(reqs))
+	index := make(map[string]int, len(reqs))
+	for i, msg := range reqs {
+		methods[i] = msg.Method
+		index[string(msg.ID)] = i
+	}
+
+	start := time.Now()
+	resp, err := m.next.RoundTrip(req)
+	elapsed := time.Since(start)
+	errored := make(map[int]bool) // -1 表示整个请求失败
+	defer func() { m.record(methods, errored, elapsed) }()
+
+	if err != nil {
+		errored[-1] = true
+		// 调用方主动取消不算端点故障
+		m.result(key, !errors.Is(err, context.Canceled))
+		return nil, err
+	}
+	if resp.StatusCode >= 500 {
+		errored[-1] = true
+		m.result(key, true)
+		return resp, nil
+	}
+	m.result(key, false)
+	if resp.StatusCode != http.StatusOK {
+		errored[-1] = true
+		return resp, nil
+	}
+
+	raw, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+	if err != nil {
+		errored[-1] = true
+		return resp, nil
+	}
+	for _, msg := range parseRPCMessages(raw) {
+		if len(msg.Error) > 0 && string(msg.Error) != "null" {
+			if i, ok := index[string(msg.ID)]; ok {
+				errored[i] = true
+			}
+		}
+	}
+	return resp, nil
+}
+
+// circuit 端点的熔断状态
+func (m *rpcMetrics) circuit(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return circuitClosed
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b := m.breakers[endpointKey(u)]; b != nil {
+		return b.state(time.Now())
+	}
+	return circuitClosed
+}
+
+// snapshot 按方法名排序的统计
+func (m *rpcMetrics) snapshot() []RPCMethodStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]RPCMethodStats, 0, len(m.methods))
+	for method, c := range m.methods {
+		st := RPCMethodStats{Method: method, Calls: c.calls, Errors: c.errors, MaxMs: c.max.Milliseconds()}
+		if c.calls > 0 {
+			st.ErrorRate = float64(c.errors) / float64(c.calls)
+			st.AvgMs = math.Round(float64(c.total.Microseconds())/float64(c.calls)) / 1000
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Method < out[j].Method })
+	return out
+}
+
+// isRPCUnavailable 错误信息是否来自熔断
+func isRPCUnavailable(msg string) bool {
+	return strings.Contains(msg, rpcUnavailableMsg)
+}
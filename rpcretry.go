@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RPC 请求超时与重试的默认值
+const (
+	defaultRPCTimeout     = 15 // 秒
+	defaultRPCMaxAttempts = 3
+	defaultRPCBaseDelay   = 200  // 毫秒
+	defaultRPCMaxDelay    = 3000 // 毫秒
+)
+
+// RPCClientConfig 单次 RPC 请求的超时与暂时性错误重试
+//
+//	rpc_client:
+//	  timeout: 15        # 单次请求超时 (秒)
+//	  max_attempts: 3    # 暂时性错误最多尝试次数 (含首次)，1 为不重试
+//	  base_delay: 200    # 首次重试前的等待 (毫秒)，之后每次翻倍并加抖动
+//	  max_delay: 3000    # 重试等待上限 (毫秒)
+type RPCClientConfig struct {
+	Timeout     int `yaml:"timeout"`
+	MaxAttempts int `yaml:"max_attempts"`
+	BaseDelay   int `yaml:"base_delay"`
+	MaxDelay    int `yaml:"max_delay"`
+}
+
+// withDefaults 补上未配置的项
+func (c RPCClientConfig) withDefaults() RPCClientConfig {
+	if c.Timeout <= 0 {
+		c.Timeout = defaultRPCTimeout
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultRPCMaxAttempts
+	}
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = defaultRPCBaseDelay
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = defaultRPCMaxDelay
+	}
+	c.MaxDelay = max(c.MaxDelay, c.BaseDelay)
+	return c
+}
+
+// rpcNoRetryMethods 重试可能产生副作用的方法: 超时的广播实际上可能已被节点接收
+var rpcNoRetryMethods = map[string]bool{
+	"eth_sendRawTransaction": true,
+	"eth_sendTransaction":    true,
+}
+
+// rpcRetry 给每次 HTTP RPC 请求加上超时，遇到暂时性错误 (连接错误、超时、HTTP 502/503/504)
+// 时按指数退避加抖动重试
+//
+// 调用方大多使用 context.Background()，没有这一层时卡住的节点会让请求一直等下去。
+// 超时按单次尝试计算，调用方自己的 ctx 取消或到期时不再重试。限流 (429) 由 rpcThrottle 处理。
+// websocket 端点不经过这里。
+type rpcRetry struct {
+	next http.RoundTripper
+	cfg  RPCClientConfig
+}
+
+func newRPCRetry(next http.RoundTripper, cfg RPCClientConfig) *rpcRetry {
+	return &rpcRetry{next: next, cfg: cfg.withDefaults()}
+}
+
+// backoff 第 attempt 次重试前的等待: base × 2^attempt，不超过上限，取其一半再加随机抖动
+func (t *rpcRetry) backoff(attempt int) time.Duration {
+	d := time.Duration(t.cfg.BaseDelay) * time.Millisecond << attempt
+	if limit := time.Duration(t.cfg.MaxDelay) * time.Millisecond; d > limit || d <= 0 {
+		d = limit
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// attempt 发送一次请求并读完响应体，超时覆盖读取过程
+func (t *rpcRetry) attempt(req *http.Request, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), time.Duration(t.cfg.Timeout)*time.Second)
+	defer cancel()
+	r := req.Clone(ctx)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && req.Context().Err() == nil {
+			err = fmt.Errorf("RPC 请求超时 (%ds): %w", t.cfg.Timeout, err)
+		}
+		return nil, err
+	}
+	raw, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+	return resp, nil
+}
+
+// RoundTrip 发送请求，暂时性错误时退避重试
+func (t *rpcRetry) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	attempts := t.cfg.MaxAttempts
+	for _, msg := range parseRPCMessages(body) {
+		if rpcNoRetryMethods[msg.Method] {
+			attempts = 1
+		}
+	}
+
+	for i := 0; ; i++ {
+		resp, err := t.attempt(req, body)
+		transient := err != nil
+		if err == nil {
+			switch resp.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				transient = true
+			}
+		}
+		if !transient || i+1 >= attempts || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		delay := t.backoff(i)
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+		}
+		log.Printf("RPC 请求失败 (%s 后第 %d 次重试): %s", delay.Round(time.Millisecond), i+1, reason)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 上游限流处理参数
+const (
+	rpcThrottleMaxRetries  = 4
+	rpcThrottleBaseBackoff = 500 * time.Millisecond
+	rpcThrottleMinDelay    = 50 * time.Millisecond
+	rpcThrottleMaxDelay    = 2 * time.Second
+
+	// upstreamRateLimitedMsg 重试用尽后返回给 ethclient 的错误信息前缀，sendError 据此附带错误码
+	upstreamRateLimitedMsg = "upstream rate limited"
+	// errCodeUpstreamRateLimited 上游 RPC 限流的错误码 (APIResponse.Code)
+	errCodeUpstreamRateLimited = "upstream_rate_limited"
+)
+
+// rpcThrottle 识别上游限流 (HTTP 429 / JSON-RPC -32005) 的 HTTP transport
+//
+// 公共节点 (如默认的 Sepolia 端点) 限流很激进。被限流时加大请求间隔并带抖动重试，
+// 之后每次成功逐步缩短间隔；重试用尽后把响应改写为带 upstreamRateLimitedMsg 的
+// JSON-RPC 错误，接口层据此返回明确的错误码而不是笼统的 "查询失败"。
+// 只作用于 HTTP 端点，websocket 连接不经过这里。
+type rpcThrottle struct {
+	next http.RoundTripper
+
+	mu     sync.Mutex
+	delay  time.Duration // 当前请求最小间隔，0 表示不限
+	nextAt time.Time
+
+	limited atomic.Int64 // 累计被限流次数
+}
+
+func newRPCThrottle() *rpcThrottle {
+	return &rpcThrottle{next: http.DefaultTransport}
+}
+
+// wait 按当前间隔排队
+func (t *rpcThrottle) wait(req *http.Request) error {
+	t.mu.Lock()
+	now := time.Now()
+	at := t.nextAt
+	if at.Before(now) {
+		at = now
+	}
+	t.nextAt = at.Add(t.delay)
+	t.mu.Unlock()
+
+	if d := time.Until(at); d > 0 {
+		return sleepThrottled(req, d)
+	}
+	return nil
+}
+
+// sleepThrottled 等待 d；期间请求被取消时返回限流错误 (而不是超时)，
+// 避免被当作连接故障触发重连
+func sleepThrottled(req *http.Request, d time.Duration) error {
+	select {
+	case <-req.Context().Done():
+		return fmt.Errorf("%s: %v", upstreamRateLimitedMsg, req.Context().Err())
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// penalize 被限流后加倍请求间隔
+func (t *rpcThrottle) penalize() {
+	t.limited.Add(1)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old := t.delay
+	t.delay = min(max(t.delay*2, rpcThrottleMinDelay), rpcThrottleMaxDelay)
+	if t.delay != old {
+		log.Printf("上游 RPC 限流，请求间隔调整为 %s", t.delay)
+	}
+}
+
+// relax 请求成功后逐步缩短间隔
+func (t *rpcThrottle) relax() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.delay == 0 {
+		return
+	}
+	t.delay = t.delay * 9 / 10
+	if t.delay < rpcThrottleMinDelay/2 {
+		t.delay = 0
+		log.Println("上游 RPC 限流已解除")
+	}
+}
+
+// RoundTrip 发送请求，被限流时退避重试
+func (t *rpcThrottle) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(req); err != nil {
+			return nil, err
+		}
+		r := req.Clone(req.Context())
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		resp, err := t.next.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+
+		limited, reason, err := rateLimitedResponse(resp)
+		if err != nil {
+			return nil, err
+		}
+		if !limited {
+			t.relax()
+			return resp, nil
+		}
+		t.penalize()
+		if attempt >= rpcThrottleMaxRetries {
+			return upstreamRateLimitedResponse(resp, body, reason), nil
+		}
+
+		backoff := rpcThrottleBaseBackoff << attempt
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && time.Duration(secs)*time.Second > backoff {
+			backoff = time.Duration(secs) * time.Second
+		}
+		backoff += time.Duration(rand.Int63n(int64(backoff) / 2)) // 抖动，避免并发请求同时重试
+		if err := sleepThrottled(req, backoff); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rpcErrorMessage JSON-RPC 响应中的 error 字段
+type rpcErrorMessage struct {
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// rateLimitedResponse 判断响应是否为限流: HTTP 429，或 JSON-RPC 错误码 -32005 / 限流提示
+// 读取过的响应体会被还原，调用方仍可正常读取
+func rateLimitedResponse(resp *http.Response) (bool, string, error) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true, resp.Status, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, "", nil
+	}
+	raw, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+	if err != nil {
+		return false, "", err
+	}
+
+	var msgs []rpcErrorMessage
+	if err := json.Unmarshal(raw, &msgs); err != nil {
+		var single rpcErrorMessage
+		if json.Unmarshal(raw, &single) != nil {
+			return false, "", nil
+		}
+		msgs = []rpcErrorMessage{single}
+	}
+	for _, m := range msgs {
+		if m.Error == nil {
+			continue
+		}
+		text := strings.ToLower(m.Error.Message)
+		// 部分节点对 eth_getLogs 结果过多也返回 -32005，重试无济于事
+		if strings.Contains(text, "query returned more than") {
+			continue
+		}
+		if m.Error.Code == -32005 || m.Error.Code == 429 || strings.Contains(text, "rate limit") || strings.Contains(text, "too many requests") {
+			return true, m.Error.Message, nil
+		}
+	}
+	return false, "", nil
+}
+
+// upstreamRateLimitedResponse 重试用尽后改写为 JSON-RPC 错误 (按请求 id 逐个返回)
+func upstreamRateLimitedResponse(resp *http.Response, reqBody []byte, reason string) *http.Response {
+	resp.Body.Close()
+
+	type rpcID struct {
+		ID json.RawMessage `json:"id"`
+	}
+	type rpcErr struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Error   struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	build := func(id json.RawMessage) rpcErr {
+		e := rpcErr{JSONRPC: "2.0", ID: id}
+		e.Error.Code = -32005
+		e.Error.Message = fmt.Sprintf("%s: %s", upstreamRateLimitedMsg, reason)
+		return e
+	}
+
+	var out []byte
+	var batch []rpcID
+	if err := json.Unmarshal(reqBody, &batch); err == nil {
+		errs := make([]rpcErr, len(batch))
+		for i, r := range batch {
+			errs[i] = build(r.ID)
+		}
+		out, _ = json.Marshal(errs)
+	} else {
+		var single rpcID
+		json.Unmarshal(reqBody, &single)
+		out, _ = json.Marshal(build(single.ID))
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(out)),
+		ContentLength: int64(len(out)),
+		Request:       resp.Request,
+	}
+}
+
+// isUpstreamRateLimited 错误信息是否来自重试用尽的上游限流
+func isUpstreamRateLimited(msg string) bool {
+	return strings.Contains(msg, upstreamRateLimitedMsg)
+}
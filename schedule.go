@@ -0,0 +1,582 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// PasskeyWallet 定时转账相关 ABI
+const walletScheduleABI = `[
+	{
+		"inputs": [
+			{"name": "sessionKey", "type": "address"},
+			{"name": "token", "type": "address"},
+			{"name": "to", "type": "address"},
+			{"name": "amount", "type": "uint256"},
+			{"name": "interval", "type": "uint64"},
+			{"name": "maxRuns", "type": "uint32"},
+			{"name": "validUntil", "type": "uint64"},
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "addSchedule",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "sessionKey", "type": "address"},
+			{"name": "sessionSignature", "type": "bytes"}
+		],
+		"name": "executeScheduled",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [{"name": "sessionKey", "type": "address"}],
+		"name": "schedules",
+		"outputs": [
+			{"name": "token", "type": "address"},
+			{"name": "to", "type": "address"},
+			{"name": "amount", "type": "uint256"},
+			{"name": "nextRun", "type": "uint64"},
+			{"name": "interval", "type": "uint64"},
+			{"name": "validUntil", "type": "uint64"},
+			{"name": "maxRuns", "type": "uint32"},
+			{"name": "runs", "type": "uint32"}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	}
+]`
+
+// scheduleRunTypeHash 会话密钥对每次执行的签名摘要类型，与合约 SCHEDULED_RUN_TYPEHASH 一致
+var scheduleRunTypeHash = crypto.Keccak256Hash([]byte("PasskeyWallet.executeScheduled(address sessionKey,uint256 run)"))
+
+// ScheduleRequest 定时/周期转账请求
+//
+// Passkey 签名 schedule challenge，授权钱包登记一把只属于本任务的会话密钥 (addSchedule)，签名覆盖
+// token / to / amount / interval / maxRuns / validUntil；之后每次执行由服务端用会话密钥签名 executeScheduled，
+// 合约按登记的参数转账并约束次数、周期与截止时间。会话密钥由 /api/challenge 生成，地址随 challenge 返回。
+type ScheduleRequest struct {
+	ERC20TransferRequest
+	SessionKey string `json:"sessionKey"` // /api/challenge 返回的会话密钥地址
+	RunAt      int64  `json:"runAt"`      // 首次执行时间 (unix 秒)
+	Interval   int64  `json:"interval"`   // 周期 (秒)，0 表示一次性
+	MaxRuns    int    `json:"maxRuns"`    // 最多执行次数，0 表示不限 (受 ValidUntil 约束)
+	ValidUntil int64  `json:"validUntil"` // 预授权截止时间 (unix 秒)
+}
+
+// call 编码钱包的 addSchedule 调用
+func (req *ScheduleRequest) call() ([]byte, error) {
+	for name, addr := range map[string]string{"token": req.Token, "to": req.To, "sessionKey": req.SessionKey} {
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("%s 地址格式错误: %s", name, addr)
+		}
+	}
+	amount, ok := new(big.Int).SetString(req.Amount, 10)
+	if !ok || amount.Sign() <= 0 {
+		return nil, fmt.Errorf("金额格式错误: %s", req.Amount)
+	}
+	if req.Interval < 0 || req.MaxRuns < 0 || req.ValidUntil < 0 {
+		return nil, fmt.Errorf("interval / maxRuns / validUntil 不能为负数")
+	}
+	if req.MaxRuns > math.MaxUint32 {
+		return nil, fmt.Errorf("maxRuns 过大: %d", req.MaxRuns)
+	}
+	if req.Interval > 0 && req.MaxRuns == 0 && req.ValidUntil == 0 {
+		return nil, fmt.Errorf("周期转账需要设置 maxRuns 或 validUntil")
+	}
+
+	parsedABI, _ := abi.JSON(strings.NewReader(walletScheduleABI))
+	callData, err := parsedABI.Pack("addSchedule",
+		common.HexToAddress(req.SessionKey), common.HexToAddress(req.Token), common.HexToAddress(req.To), amount,
+		uint64(req.Interval), uint32(req.MaxRuns), uint64(req.ValidUntil), webauthnSignature(&req.PasskeyData))
+	if err != nil {
+		return nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	return callData, nil
+}
+
+// scheduleKeyPrefix 待登记的会话密钥在 nsChallenges 中的 key 前缀 (与 challenge 同样过期)
+const scheduleKeyPrefix = "schedule-key/"
+
+// issueScheduleKey 为定时转账生成会话密钥，把地址写入待签名的请求，私钥保存到 challenge 过期
+func (srv *Server) issueScheduleKey(body json.RawMessage) (json.RawMessage, string, error) {
+	fields := map[string]json.RawMessage{}
+	if err := decodeChallengeRequest(body, &fields); err != nil {
+		return nil, "", err
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("生成会话密钥失败: %v", err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey).Hex()
+	if err := setCacheJSON(srv.shared, nsChallenges, scheduleKeyPrefix+addr, hex.EncodeToString(crypto.FromECDSA(key)), assertionTTL); err != nil {
+		return nil, "", fmt.Errorf("保存会话密钥失败: %v", err)
+	}
+	fields["sessionKey"], _ = json.Marshal(addr)
+	out, err := json.Marshal(fields)
+	return out, addr, err
+}
+
+// takeScheduleKey 取出 challenge 时生成的会话密钥，只能使用一次
+func (srv *Server) takeScheduleKey(addr common.Address) (*ecdsa.PrivateKey, error) {
+	var keyHex string
+	if !srv.takeChallenge(scheduleKeyPrefix+addr.Hex(), &keyHex) {
+		return nil, fmt.Errorf("会话密钥不存在或已过期，请重新获取 challenge")
+	}
+	return crypto.HexToECDSA(keyHex)
+}
+
+// scheduleRunDigest 会话密钥每次执行签名的摘要: keccak256(abi.encode(typeHash, chainId, wallet, sessionKey, run))
+func scheduleRunDigest(chainID *big.Int, wallet, sessionKey common.Address, run uint64) common.Hash {
+	return crypto.Keccak256Hash(
+		scheduleRunTypeHash[:],
+		common.LeftPadBytes(chainID.Bytes(), 32),
+		common.LeftPadBytes(wallet[:], 32),
+		common.LeftPadBytes(sessionKey[:], 32),
+		common.LeftPadBytes(new(big.Int).SetUint64(run).Bytes(), 32),
+	)
+}
+
+// scheduleRuns 读取钱包中会话密钥已执行的次数，未登记时报错
+func (srv *Server) scheduleRuns(wallet, sessionKey common.Address) (uint64, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(walletScheduleABI))
+	data, _ := parsedABI.Pack("schedules", sessionKey)
+	out, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &wallet, Data: data}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("读取定时转账登记失败: %v", err)
+	}
+	result, err := parsedABI.Unpack("schedules", out)
+	if err != nil || len(result) != 8 {
+		return 0, fmt.Errorf("解析定时转账登记失败: %v", err)
+	}
+	if amount, _ := result[2].(*big.Int); amount == nil || amount.Sign() == 0 {
+		return 0, fmt.Errorf("会话密钥 %s 未在钱包中登记", sessionKey.Hex())
+	}
+	runs, _ := result[7].(uint32)
+	return uint64(runs), nil
+}
+
+// sendScheduledRun 用会话密钥签名一次 executeScheduled，预执行后由中继账户发送到钱包
+func (srv *Server) sendScheduledRun(wallet common.Address, key *ecdsa.PrivateKey, requestID string) (common.Hash, error) {
+	if key == nil {
+		return common.Hash{}, fmt.Errorf("任务没有会话密钥，请重新创建")
+	}
+	sessionKey := crypto.PubkeyToAddress(key.PublicKey)
+	run, err := srv.scheduleRuns(wallet, sessionKey)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	digest := scheduleRunDigest(srv.chainID, wallet, sessionKey, run)
+	sig, err := crypto.Sign(accounts.TextHash(digest[:]), key)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("会话密钥签名失败: %v", err)
+	}
+	sig[64] += 27
+
+	parsedABI, _ := abi.JSON(strings.NewReader(walletScheduleABI))
+	callData, err := parsedABI.Pack("executeScheduled", sessionKey, sig)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	if srv.Config().TraceCalldata {
+		callData = appendTraceTag(callData, requestID)
+	}
+	if err := srv.dryRun(wallet, callData); err != nil {
+		return common.Hash{}, err
+	}
+	return srv.sendTransaction(wallet, big.NewInt(0), callData)
+}
+
+// ScheduledTransfer 已保存的定时转账任务
+type ScheduledTransfer struct {
+	ID         string   `json:"id"`
+	Wallet     string   `json:"wallet"`
+	Token      string   `json:"token"`
+	To         string   `json:"to"`
+	Amount     string   `json:"amount"`
+	SessionKey string   `json:"sessionKey"` // 钱包中登记的会话密钥地址
+	NextRun    int64    `json:"nextRun"`
+	Interval   int64    `json:"interval"`
+	MaxRuns    int      `json:"maxRuns"`
+	ValidUntil int64    `json:"validUntil"`
+	Runs       int      `json:"runs"`
+	TxHashes   []string `json:"txHashes"`
+	LastError  string   `json:"lastError,omitempty"`
+	Done       bool     `json:"done"`
+
+	request ERC20TransferRequest // 转账参数 (不含 Passkey 签名)，每次执行前重新校验
+	key     *ecdsa.PrivateKey    // 会话密钥
+	queued  bool                 // 本次执行已提交给限流队列，尚未完成
+}
+
+// doneScheduleTTL 已结束的任务在存储中的保留时间
+const doneScheduleTTL = 30 * 24 * time.Hour
+
+// scheduleRecord 存储中的任务 (nsSchedules，key = id)，附带转账参数与会话密钥
+type scheduleRecord struct {
+	ScheduledTransfer
+	Request ERC20TransferRequest `json:"request"`
+	Key     string               `json:"key,omitempty"` // 会话密钥私钥 (hex)，只能执行本任务登记的转账
+}
+
+// scheduler 定时转账调度器，任务保存在 Storage 中，重启后继续执行
+type scheduler struct {
+	srv *Server
+
+	mu   sync.Mutex
+	jobs map[string]*ScheduledTransfer
+}
+
+func newScheduler(srv *Server) *scheduler {
+	sc := &scheduler{srv: srv, jobs: make(map[string]*ScheduledTransfer)}
+	kvs, err := srv.storage.List(nsSchedules, "")
+	if err != nil {
+		log.Printf("读取定时转账任务失败: %v", err)
+		return sc
+	}
+	for _, kv := range kvs {
+		var rec scheduleRecord
+		if err := json.Unmarshal(kv.Value, &rec); err != nil {
+			log.Printf("定时转账任务 %s 解析失败: %v", kv.Key, err)
+			continue
+		}
+		job := rec.ScheduledTransfer
+		job.request = rec.Request
+		if key, err := crypto.HexToECDSA(rec.Key); err == nil {
+			job.key = key
+		} else if !job.Done {
+			// 旧版任务保存的是一次性 Passkey 签名，无法重复执行
+			job.Done = true
+			job.LastError = "任务没有会话密钥，请重新创建"
+			sc.saveLocked(&job)
+		}
+		sc.jobs[job.ID] = &job
+	}
+	return sc
+}
+
+// saveLocked 写入任务的当前状态，已结束的任务保留 doneScheduleTTL (需持有 mu)
+func (sc *scheduler) saveLocked(job *ScheduledTransfer) {
+	var ttl time.Duration
+	if job.Done {
+		ttl = doneScheduleTTL
+	}
+	rec := scheduleRecord{ScheduledTransfer: *job, Request: job.request}
+	if job.key != nil {
+		rec.Key = hex.EncodeToString(crypto.FromECDSA(job.key))
+	}
+	if err := putJSON(sc.srv.storage, nsSchedules, job.ID, rec, ttl); err != nil {
+		log.Printf("保存定时转账任务 %s 失败: %v", job.ID, err)
+	}
+}
+
+// add 保存任务并返回副本 (任务可能立即到期，调度器会并发修改原对象)
+func (sc *scheduler) add(req *ScheduleRequest, key *ecdsa.PrivateKey) ScheduledTransfer {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+
+	request := req.ERC20TransferRequest
+	request.PasskeyData = PasskeyData{}
+
+	job := &ScheduledTransfer{
+		ID:         hex.EncodeToString(buf),
+		Wallet:     common.HexToAddress(req.Wallet).Hex(),
+		Token:      common.HexToAddress(req.Token).Hex(),
+		To:         common.HexToAddress(req.To).Hex(),
+		Amount:     req.Amount,
+		SessionKey: crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		NextRun:    req.RunAt,
+		Interval:   req.Interval,
+		MaxRuns:    req.MaxRuns,
+		ValidUntil: req.ValidUntil,
+		TxHashes:   []string{},
+		request:    request,
+		key:        key,
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.jobs[job.ID] = job
+	sc.saveLocked(job)
+	return *job
+}
+
+// list 返回钱包的全部任务 (副本)，按下次执行时间排序
+func (sc *scheduler) list(wallet common.Address) []ScheduledTransfer {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	list := []ScheduledTransfer{}
+	for _, job := range sc.jobs {
+		if common.HexToAddress(job.Wallet) == wallet {
+			list = append(list, *job)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].NextRun < list[j].NextRun })
+	return list
+}
+
+func (sc *scheduler) cancel(wallet common.Address, id string) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	job, ok := sc.jobs[id]
+	if !ok || common.HexToAddress(job.Wallet) != wallet {
+		return false
+	}
+	delete(sc.jobs, id)
+	if _, err := sc.srv.storage.Delete(nsSchedules, id); err != nil {
+		log.Printf("删除定时转账任务 %s 失败: %v", id, err)
+	}
+	return true
+}
+
+// active 未结束的任务数
+func (sc *scheduler) active() int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	n := 0
+	for _, job := range sc.jobs {
+		if !job.Done {
+			n++
+		}
+	}
+	return n
+}
+
+// run 每秒检查到期任务，直到 ctx 取消
+func (sc *scheduler) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, job := range sc.due(now.Unix()) {
+				sc.dispatch(job)
+			}
+		}
+	}
+}
+
+// due 返回到期且未在排队的任务，并标记为已排队
+func (sc *scheduler) due(now int64) []*ScheduledTransfer {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	var due []*ScheduledTransfer
+	for _, job := range sc.jobs {
+		if !job.Done && !job.queued && job.NextRun <= now {
+			job.queued = true
+			due = append(due, job)
+		}
+	}
+	return due
+}
+
+// dispatch 经中继限流 / 队列执行一次任务，与 /api/transfer 共用中继吞吐
+//
+// 管理员从队列中移除时本次执行记为失败，按周期推进到下一次。
+func (sc *scheduler) dispatch(job *ScheduledTransfer) {
+	sc.srv.limiter.submitInternal("/api/schedule",
+		func() { sc.execute(job, time.Now().Unix()) },
+		func() {
+			sc.mu.Lock()
+			defer sc.mu.Unlock()
+			sc.finishLocked(job, common.Hash{}, fmt.Errorf("已被管理员从队列中移除"), false)
+		})
+}
+
+// execute 用会话密钥执行一次转账并推进下次执行时间
+func (sc *scheduler) execute(job *ScheduledTransfer, now int64) {
+	sc.mu.Lock()
+	if sc.jobs[job.ID] != job {
+		// 排队期间已被取消
+		sc.mu.Unlock()
+		return
+	}
+	expired := job.ValidUntil > 0 && now > job.ValidUntil
+	req := job.request
+	req.requestID = job.ID // 定时任务以任务 ID 作为追踪 ID
+	key := job.key
+	sc.mu.Unlock()
+
+	var txHash common.Hash
+	var err error
+	if !expired {
+		err = sc.srv.validateTransferRequest(&req)
+		if err == nil {
+			txHash, err = sc.srv.sendScheduledRun(common.HexToAddress(job.Wallet), key, req.requestID)
+		}
+		sc.srv.audit(auditScheduledTransfer, &req, txHash, err)
+		if err == nil {
+			sc.srv.recordTransfer(&req, txHash)
+		}
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.finishLocked(job, txHash, err, expired)
+}
+
+// finishLocked 记录一次执行结果并推进下次执行时间 (需持有 mu)
+func (sc *scheduler) finishLocked(job *ScheduledTransfer, txHash common.Hash, err error, expired bool) {
+	job.queued = false
+	if sc.jobs[job.ID] != job {
+		// 执行期间已被取消
+		return
+	}
+	switch {
+	case expired:
+		job.Done = true
+		job.LastError = "预授权已过期"
+	case err != nil:
+		job.LastError = err.Error()
+		log.Printf("定时转账 %s 执行失败: %v", job.ID, err)
+	default:
+		job.LastError = ""
+		job.TxHashes = append(job.TxHashes, txHash.Hex())
+	}
+
+	job.Runs++
+	if job.Interval <= 0 || (job.MaxRuns > 0 && job.Runs >= job.MaxRuns) {
+		job.Done = true
+	}
+	job.NextRun += job.Interval
+	if job.ValidUntil > 0 && job.NextRun > job.ValidUntil {
+		job.Done = true
+	}
+	sc.saveLocked(job)
+}
+
+// handleSchedule 定时/周期转账 (需要钱包会话)
+//
+//	GET    /api/schedule          列出任务
+//	POST   /api/schedule          创建任务
+//	DELETE /api/schedule?id=...   取消任务
+func (srv *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	sess, ok := srv.requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Data:    srv.scheduler.list(sess.Wallet),
+		})
+
+	case "POST":
+		if !srv.canRelayTransfer() {
+			sendError(w, "未配置私钥，无法发送交易")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req ScheduleRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		if err := srv.validateTransferRequest(&req.ERC20TransferRequest); err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		wallet := common.HexToAddress(req.Wallet)
+		if wallet != sess.Wallet {
+			sendError(w, "只能为当前会话的钱包创建定时转账")
+			return
+		}
+		if req.Memo != "" {
+			sendError(w, "定时转账不支持备注")
+			return
+		}
+		if srv.walletTypeFor(wallet).Encoder == walletEncoderSafe {
+			sendError(w, "该钱包类型不支持定时转账")
+			return
+		}
+		now := time.Now().Unix()
+		if req.RunAt < now {
+			req.RunAt = now
+		}
+		if req.ValidUntil > 0 && req.ValidUntil < req.RunAt {
+			sendError(w, "validUntil 早于首次执行时间")
+			return
+		}
+		callData, err := req.call()
+		if err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		// Passkey 只授权登记会话密钥，签名覆盖会话密钥与全部转账约束
+		if err := srv.authorizeWalletCall(r, &req.PasskeyData, wallet, opSchedule, wallet, callData); err != nil {
+			sendVerificationError(w, err)
+			return
+		}
+		key, err := srv.takeScheduleKey(common.HexToAddress(req.SessionKey))
+		if err != nil {
+			sendError(w, err.Error())
+			return
+		}
+
+		txHash, err := srv.sendTransaction(wallet, big.NewInt(0), callData)
+		if err != nil {
+			sendError(w, "登记会话密钥失败: "+err.Error())
+			return
+		}
+		// 登记上链后才开始调度，否则首次执行时钱包中还没有会话密钥
+		if _, err := srv.waitReceipt(txHash); err != nil {
+			sendError(w, "登记会话密钥失败: "+err.Error())
+			return
+		}
+
+		job := srv.scheduler.add(&req, key)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success:     true,
+			Message:     "定时转账已创建",
+			TxHash:      txHash.Hex(),
+			SNormalized: req.Signature.Normalized(),
+			Data:        job,
+		})
+
+	case "DELETE":
+		id := r.URL.Query().Get("id")
+		if !srv.scheduler.cancel(sess.Wallet, id) {
+			sendError(w, "任务不存在: "+id)
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "定时转账已取消",
+		})
+	}
+}
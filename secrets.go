@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+)
+
+// 加密配置值的前缀: enc:v1:base64(nonce ‖ AES-256-GCM 密文)
+const encryptedPrefix = "enc:v1:"
+
+// 主密钥来源 (按顺序): 环境变量、密钥文件、KMS 命令
+const (
+	envMasterKey     = "PASSKEY_MASTER_KEY"      // 64 位十六进制
+	envMasterKeyFile = "PASSKEY_MASTER_KEY_FILE" // 内容为 64 位十六进制的文件
+)
+
+// SecretsConfig 配置加密
+type SecretsConfig struct {
+	// KMSCommand 输出十六进制主密钥的命令，通过 sh -c 执行，例如
+	// aws kms decrypt --ciphertext-blob fileb://master.key.enc --query Plaintext --output text | base64 -d
+	KMSCommand string `yaml:"kms_command"`
+	// RequireEncrypted 为 true 时，私钥类配置仍为明文则拒绝启动
+	RequireEncrypted bool `yaml:"require_encrypted"`
+}
+
+// loadMasterKey 读取 32 字节主密钥
+func loadMasterKey(cfg SecretsConfig) ([]byte, error) {
+	var raw, source string
+	switch {
+	case os.Getenv(envMasterKey) != "":
+		raw, source = os.Getenv(envMasterKey), envMasterKey
+	case os.Getenv(envMasterKeyFile) != "":
+		data, err := os.ReadFile(os.Getenv(envMasterKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("读取主密钥文件失败: %v", err)
+		}
+		raw, source = string(data), envMasterKeyFile
+	case cfg.KMSCommand != "":
+		out, err := exec.Command("sh", "-c", cfg.KMSCommand).Output()
+		if err != nil {
+			return nil, fmt.Errorf("执行 kms_command 失败: %v", err)
+		}
+		raw, source = string(out), "kms_command"
+	default:
+		return nil, fmt.Errorf("未提供主密钥: 请设置 %s、%s 或 secrets.kms_command", envMasterKey, envMasterKeyFile)
+	}
+
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(raw), "0x"))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s 提供的主密钥必须是 32 字节十六进制", source)
+	}
+	return key, nil
+}
+
+func newSecretsAEAD(masterKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret 加密单个配置值
+func encryptSecret(masterKey []byte, plaintext string) (string, error) {
+	aead, err := newSecretsAEAD(masterKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret 解密单个配置值
+func decryptSecret(aead cipher.AEAD, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("密文格式错误")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败 (主密钥不匹配或密文被篡改)")
+	}
+	return string(plaintext), nil
+}
+
+// encryptedField 配置中待解密的字段
+type encryptedField struct {
+	path  string // yaml 路径，用于错误提示
+	value reflect.Value
+}
+
+// decryptSecrets 就地解密配置中所有 enc:v1: 开头的字符串 (包括嵌套结构与列表)
+// 没有加密值时不需要主密钥
+func decryptSecrets(cfg *Config) error {
+	var fields []encryptedField
+	collectEncrypted(reflect.ValueOf(cfg).Elem(), "", &fields)
+
+	encrypted := make(map[string]bool)
+	if len(fields) > 0 {
+		masterKey, err := loadMasterKey(cfg.Secrets)
+		if err != nil {
+			return err
+		}
+		aead, err := newSecretsAEAD(masterKey)
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			plaintext, err := decryptSecret(aead, field.value.String())
+			if err != nil {
+				return fmt.Errorf("%s: %v", field.path, err)
+			}
+			field.value.SetString(plaintext)
+			encrypted[field.path] = true
+		}
+	}
+
+	if cfg.Secrets.RequireEncrypted {
+		for path, value := range sensitiveConfigValues(cfg) {
+			if value != "" && !encrypted[path] {
+				return fmt.Errorf("secrets.require_encrypted 已开启，但 %s 仍是明文", path)
+			}
+		}
+	}
+	return nil
+}
+
+// collectEncrypted 递归收集加密的字符串字段 (map 中的值不支持加密)
+func collectEncrypted(v reflect.Value, path string, fields *[]encryptedField) {
+	switch v.Kind() {
+	case reflect.String:
+		if strings.HasPrefix(v.String(), encryptedPrefix) {
+			*fields = append(*fields, encryptedField{path: path, value: v})
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name == "" {
+				name = strings.ToLower(t.Field(i).Name)
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			collectEncrypted(v.Field(i), name, fields)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectEncrypted(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	}
+}
+
+// sensitiveConfigValues require_encrypted 要求加密的配置项
+func sensitiveConfigValues(cfg *Config) map[string]string {
+	values := map[string]string{
+		"private_key":           cfg.PrivateKey,
+		"paymaster.signing_key": cfg.Paymaster.SigningKey,
+		"treasury.private_key":  cfg.Treasury.PrivateKey,
+		"admin_token":           cfg.AdminToken,
+	}
+	values["relayer_pool.hd.mnemonic"] = cfg.RelayerPool.HD.Mnemonic
+	for i, key := range cfg.RelayerPool.Keys {
+		values[fmt.Sprintf("relayer_pool.keys[%d]", i)] = key
+	}
+	for i, chain := range cfg.Chains {
+		values[fmt.Sprintf("chains[%d].private_key", i)] = chain.PrivateKey
+	}
+	return values
+}
+
+// runGenMasterKey 生成新的主密钥 (密钥仪式第一步)
+func runGenMasterKey() {
+	key := make([]byte, 32)
+	rand.Read(key)
+	fmt.Println(hex.EncodeToString(key))
+	fmt.Fprintf(os.Stderr, "请离线保存该主密钥 (或交给 KMS 加密保管)，启动时通过 %s / %s / secrets.kms_command 提供\n", envMasterKey, envMasterKeyFile)
+}
+
+// runEncryptSecret 从标准输入读取明文 (每行一个)，输出可直接写入 config.yaml 的密文
+func runEncryptSecret(cfg SecretsConfig) error {
+	masterKey, err := loadMasterKey(cfg)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		value, err := encryptSecret(masterKey, line)
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+	}
+	return scanner.Err()
+}
+
+// decryptValue 解密单个 enc:v1: 值，明文原样返回 (用于配置文件之外传入的密钥)
+func decryptValue(cfg SecretsConfig, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	masterKey, err := loadMasterKey(cfg)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newSecretsAEAD(masterKey)
+	if err != nil {
+		return "", err
+	}
+	return decryptSecret(aead, value)
+}
@@ -0,0 +1,672 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Server 后端服务，持有全部运行时依赖
+//
+// config 与中继 Signer 可能在运行期被替换 (热加载)，读取时需持有 mu；
+// RPC client 由 rpcConn 管理 (断线自动重连)，chainID 在构造后不再变化。
+type Server struct {
+	mu       sync.RWMutex
+	config   *Config
+	txSigner Signer
+
+	rpc     *rpcConn
+	chainID *big.Int
+
+	cache     *responseCache
+	tokenMeta sync.Map // common.Address -> tokenMetadata
+	prices    *priceCache
+
+	storage     Storage
+	shared      Cache // challenge、幂等键、代币元数据、余额 (多实例部署时共享)
+	sessions    *sessionStore
+	addressBook *addressBook
+	notifier    *notifier
+	webhooks    *walletWebhooks
+	indexer     *transferIndexer
+	wallets     *walletIndexer
+	scheduler   *scheduler
+	history     *historyStore
+	userOps     *userOpTracker
+	paymaster   *paymasterSigner
+	recovery    *recoveryManager
+	batcher     *batcher
+	limiter     *relayLimiter
+	treasury    *treasury
+	nonces      *nonceManager // 主中继账户 (private_key)
+	relayers    *relayerPool
+	submissions *submissionQueue
+	rotation    *keyRotation
+	tokenList   *tokenList
+	heads       *headWatcher
+
+	signCountMu    sync.Mutex // 保证同一时刻只有一个请求推进 signCount
+	walletRecordMu sync.Mutex // 串行化钱包登记 (nsWallets) 的读改写
+	deadLetterMu   sync.Mutex // 串行化死信重新提交，避免同一条死信被并发中继两次
+	blocklist      blocklist  // 合规名单文件缓存 (compliance.blocklist_file)
+
+	p256       P256Support // 启动时探测的 P-256 验证能力
+	walletCode []byte      // PasskeyWallet runtime code，用于预演未部署的钱包
+	dev        *devChain   // -dev 模式的本地链，nil 表示未开启
+
+	logPayloads atomic.Bool                     // 完整请求/响应日志开关 (可通过管理接口切换)
+	maintenance atomic.Pointer[MaintenanceData] // 维护模式，nil 表示未开启 (可通过管理接口切换)
+	started     time.Time
+}
+
+// NewServer 创建服务实例，signer 可为 nil (只读模式)
+func NewServer(cfg *Config, conn *rpcConn, chainID *big.Int, signer Signer, st Storage, c Cache) *Server {
+	srv := &Server{
+		config:      cfg,
+		txSigner:    signer,
+		rpc:         conn,
+		chainID:     chainID,
+		cache:       newResponseCache(time.Duration(cfg.CacheTTL) * time.Second),
+		storage:     st,
+		shared:      c,
+		sessions:    newSessionStore(st),
+		addressBook: newAddressBook(st),
+		notifier:    newNotifier(),
+		webhooks:    newWalletWebhooks(st),
+		history:     newHistoryStore(st),
+		userOps:     newUserOpTracker(),
+		started:     time.Now(),
+	}
+	srv.indexer = newTransferIndexer(srv)
+	srv.wallets = newWalletIndexer(srv)
+	srv.scheduler = newScheduler(srv)
+	srv.paymaster = &paymasterSigner{srv: srv}
+	srv.recovery = newRecoveryManager(srv)
+	srv.batcher = newBatcher(srv)
+	srv.limiter = newRelayLimiter(srv)
+	srv.treasury = newTreasury(srv)
+	srv.nonces = newNonceManager(srv, srv.signer)
+	srv.relayers = newRelayerPool(srv)
+	srv.submissions = newSubmissionQueue(srv)
+	srv.rotation = newKeyRotation(srv)
+	srv.tokenList = newTokenList(srv)
+	srv.prices = newPriceCache()
+	srv.heads = newHeadWatcher(srv)
+	// 重连后可能换到了另一个节点，pending nonce 以新节点为准
+	conn.onReconnect(func(*ethclient.Client) { srv.relayers.resync() })
+	srv.logPayloads.Store(cfg.LogPayloads)
+	return srv
+}
+
+// eth 返回当前 RPC client (重连后会变化，不要长期持有)
+func (srv *Server) eth() *ethclient.Client {
+	return srv.rpc.get()
+}
+
+// Config 返回当前配置快照
+func (srv *Server) Config() Config {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	return *srv.config
+}
+
+// SetConfig 替换当前配置并清空缓存
+func (srv *Server) SetConfig(cfg *Config) {
+	srv.mu.Lock()
+	srv.config = cfg
+	srv.mu.Unlock()
+	srv.invalidateCaches()
+}
+
+// signer 返回当前主中继账户的签名者，未配置时为 nil
+func (srv *Server) signer() Signer {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	return srv.txSigner
+}
+
+// canRelayTransfer 是否具备中继转账的条件 (4337 模式且配置了外部 bundler 时无需中继私钥)
+func (srv *Server) canRelayTransfer() bool {
+	cfg := srv.Config()
+	return srv.signer() != nil || (cfg.RelayMode == relayModeUserOp && cfg.AA.BundlerRPC != "")
+}
+
+// SetSigner 替换主中继账户的签名者 (如切换到 KMS)
+func (srv *Server) SetSigner(signer Signer) {
+	srv.mu.Lock()
+	srv.txSigner = signer
+	srv.mu.Unlock()
+}
+
+// invalidateCaches 清空响应缓存和进程内的代币元数据缓存
+func (srv *Server) invalidateCaches() {
+	srv.cache.invalidate()
+	srv.tokenMeta.Clear()
+	srv.prices.clear()
+}
+
+// Handler 返回注册好全部路由的 HTTP handler，公共中间件 (请求 ID、panic 恢复) 作用于全部请求
+func (srv *Server) Handler() http.Handler {
+	return srv.requestIDs(recovered(srv.routes()))
+}
+
+// routes 注册全部路由，外加本链的请求日志与 CORS / JSON 响应头 (多链时由 chainRegistry 按 chainId 分发)
+//
+// 会改变状态的接口挂在 write 分组 (只读 / 维护模式检查)，发起中继交易的接口挂在 relay 分组
+// (另加幂等键与限流)，管理接口挂在 admin 分组 (校验 admin_token)。
+func (srv *Server) routes() http.Handler {
+	rt := newRouter()
+	write := rt.with(srv.mutating)
+	relay := write.with(srv.idempotent, srv.rateLimited)
+	admin := rt.with(srv.adminOnly)
+
+	rt.get("/{$}", srv.handleIndex)
+	rt.mux.HandleFunc("/api/", apiNotFound)
+
+	rt.post("/api/verify", srv.handleVerify)
+	rt.post("/api/verify1271", srv.handleVerify1271)
+	rt.post("/api/simulate", srv.handleSimulate)
+	rt.post("/api/estimate", srv.handleEstimate)
+	write.post("/api/send", srv.handleSend)
+	write.post("/api/challenge", srv.handleChallenge)
+	relay.post("/api/transfer", srv.handleTransfer)
+	relay.post("/api/transfer-eth", srv.handleTransferETH)
+	relay.post("/api/transfer-1155", srv.handleTransferERC1155)
+	relay.post("/api/transfer-multi", srv.handleTransferMulti)
+	relay.post("/api/execute", srv.handleExecute)
+	relay.post("/api/approve", srv.handleApprove)
+	relay.handle("GET POST", "/api/permit", srv.handlePermit)
+	rt.get("/api/allowance", srv.handleAllowance)
+
+	rt.get("/api/balance", srv.handleBalance)
+	rt.handle("GET POST", "/api/portfolio", srv.handlePortfolio)
+	rt.get("/api/tokens", srv.handleTokens)
+	rt.get("/api/config", srv.handleConfig)
+	rt.get("/api/chain", srv.handleChain)
+	rt.get("/api/userop", srv.handleUserOpStatus)
+	rt.get("/api/tx/{hash}", srv.handleTxStatus)
+	rt.get("/api/trace", srv.handleTrace)
+	rt.get("/api/queue", srv.handleQueue)
+	rt.get("/api/events", srv.handleEvents)
+
+	write.with(srv.idempotent).post("/api/create-wallet", srv.handleCreateWallet)
+	relay.post("/api/create-wallets", srv.handleCreateWallets)
+	write.post("/api/register/begin", srv.handleRegisterBegin)
+	relay.post("/api/register/finish", srv.handleRegisterFinish)
+	rt.post("/api/login/begin", srv.handleLoginBegin)
+	rt.post("/api/login/finish", srv.handleLoginFinish)
+	rt.post("/api/session", srv.handleSession)
+
+	rt.get("/api/history", srv.handleHistory)
+	rt.get("/api/history/export", srv.handleHistoryExport)
+	write.handle("GET POST DELETE", "/api/addressbook", srv.handleAddressBook)
+	write.handle("GET POST DELETE", "/api/webhooks", srv.handleWebhooks)
+	write.handle("GET POST DELETE", "/api/schedule", srv.handleSchedule)
+
+	write.handle("GET POST", "/api/recovery", srv.handleRecovery)
+	write.post("/api/recovery/guardians", srv.handleGuardians)
+	write.post("/api/recovery/cancel", srv.handleCancelRecovery)
+
+	rt.get("/api/wallet", srv.handleWallet)
+	rt.get("/api/wallet/lookup", srv.handleWalletLookup)
+	admin.get("/api/wallet/{addr}/risk", srv.handleWalletRisk)
+	write.handle("GET POST", "/api/wallet/{addr}/credentials", srv.handleWalletCredentials)
+	write.handle("DELETE", "/api/wallet/{addr}/credentials/{id}", srv.handleRevokeCredential)
+	write.handle("GET POST DELETE", "/api/wallet/{addr}/freeze", srv.handleWalletFreeze)
+
+	admin.handle("GET POST", "/api/admin/logging", srv.handleAdminLogging)
+	admin.get("/api/admin/compliance", srv.handleAdminCompliance)
+	admin.handle("GET POST", "/api/admin/registry", srv.handleAdminRegistry)
+	admin.handle("GET POST", "/api/admin/maintenance", srv.handleAdminMaintenance)
+	admin.handle("GET POST", "/api/admin/policies", srv.handleAdminPolicies)
+	admin.handle("GET DELETE", "/api/admin/queue", srv.handleAdminQueue)
+	admin.handle("GET POST DELETE", "/api/admin/deadletter", srv.handleAdminDeadLetter)
+	admin.get("/api/admin/stats", srv.handleAdminStats)
+	admin.handle("GET POST", "/api/admin/stuck", srv.handleAdminStuck)
+	admin.get("/api/admin/relayers", srv.handleAdminRelayers)
+	admin.handle("GET POST DELETE", "/api/admin/rotate", srv.handleAdminRotate)
+
+	return srv.payloadLogger(apiHeaders(rt.mux))
+}
+
+// mutating 包装会改变状态的接口: 只读部署或维护模式下拒绝 GET 以外的请求
+func (srv *Server) mutating(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			h(w, r)
+			return
+		}
+		if srv.Config().ReadOnly {
+			w.WriteHeader(http.StatusForbidden)
+			sendError(w, "只读模式: 该接口已禁用")
+			return
+		}
+		if m := srv.maintenance.Load(); m != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			sendError(w, m.message())
+			return
+		}
+		h(w, r)
+	}
+}
+
+// startWorkers 启动后台任务 (定时转账、恢复、排队、充值、索引等)
+func (srv *Server) startWorkers() {
+	if !srv.Config().ReadOnly {
+		srv.submissions.restore(context.Background())
+		go srv.scheduler.run(context.Background())
+		go srv.recovery.run(context.Background())
+		go srv.limiter.run(context.Background())
+		go srv.treasury.run(context.Background())
+		go srv.submissions.run(context.Background())
+	}
+	go srv.heads.run(context.Background())
+	go srv.runComplianceExports(context.Background())
+	if srv.Config().Indexer.Enabled {
+		go srv.indexer.run(context.Background())
+	}
+	if srv.Config().WalletIndexer.Enabled {
+		go srv.wallets.run(context.Background())
+	}
+}
+
+func (srv *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	data, err := webFS.ReadFile("web/index.html")
+	if err != nil {
+		http.Error(w, "页面加载失败", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
+
+func (srv *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	srv.cache.serveCached(w, r, cacheKeyConfig, func() (interface{}, error) {
+		config := srv.Config()
+		return APIResponse{
+			Success: true,
+			Data: ConfigData{
+				Contract: config.Contract,
+				ChainID:  srv.chainID.String(),
+				RPC:      config.RPC,
+				ReadOnly: config.ReadOnly,
+				P256:     srv.P256(),
+
+				WalletTypes: walletTypeNames(config.WalletTypes),
+
+				Features: srv.features(),
+			},
+		}, nil
+	})
+}
+
+// handleChain 查询链元数据 (最新区块、gas price)
+func (srv *Server) handleChain(w http.ResponseWriter, r *http.Request) {
+	err := srv.cache.serveCached(w, r, cacheKeyChain, func() (interface{}, error) {
+		blockNumber, err := srv.eth().BlockNumber(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("获取区块高度失败: %v", err)
+		}
+		gasPrice, err := srv.eth().SuggestGasPrice(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("获取 gas price 失败: %v", err)
+		}
+		return APIResponse{
+			Success: true,
+			Data: ChainData{
+				ChainID:     srv.chainID.String(),
+				BlockNumber: blockNumber,
+				GasPrice:    gasPrice.String(),
+			},
+		}, nil
+	})
+	if err != nil {
+		sendError(w, err.Error())
+	}
+}
+
+func (srv *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+
+	var req VerifyRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+
+	// 本地验证，不调用链上合约，RPC 不可用时同样可用
+	key, source := req.PublicKey, "request"
+	if req.CredentialID != "" {
+		var cred Credential
+		found, err := getJSON(srv.storage, nsCredentials, strings.TrimRight(req.CredentialID, "="), &cred)
+		if err != nil {
+			sendError(w, "读取凭证失败: "+err.Error())
+			return
+		}
+		if !found {
+			sendError(w, "凭证不存在: "+req.CredentialID)
+			return
+		}
+		if cred.RevokedAt != 0 {
+			sendError(w, "凭证已撤销: "+req.CredentialID)
+			return
+		}
+		key, source = cred.PublicKey, "credential"
+	}
+	pub, err := publicKeyFromHex(key)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	if _, err := checkAuthenticatorData(common.FromHex(req.WebAuthn.AuthenticatorData), srv.rpID(r), srv.Config().WebAuthn.RequireUV); err != nil {
+		sendVerificationError(w, err)
+		return
+	}
+	valid, messageHash, err := verifyP256Local(&req.PasskeyData, pub)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	message := "签名有效"
+	if !valid {
+		message = "签名无效"
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success:     true,
+		Message:     message,
+		Valid:       &valid,
+		SNormalized: req.Signature.Normalized(),
+		Data: VerifyData{
+			Valid:       valid,
+			MessageHash: common.Hash(messageHash).Hex(),
+			PublicKey:   key,
+			KeySource:   source,
+		},
+	})
+}
+
+func (srv *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	if srv.signer() == nil {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+
+	var data PasskeyData
+	if err := json.Unmarshal(body, &data); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+
+	// PasskeyWallet 模式下，请使用 /api/transfer
+	sendError(w, "请使用 /api/transfer 接口")
+}
+
+// handleTransfer 处理 ERC20 转账请求
+func (srv *Server) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	if !srv.canRelayTransfer() {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+
+	var req ERC20TransferRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	req.requestID = requestIDFrom(r)
+
+	// 验证参数
+	if err := srv.validateTransferRequest(&req); err != nil {
+		srv.audit(auditTransfer, &req, common.Hash{}, err)
+		sendError(w, err.Error())
+		return
+	}
+
+	wallet := common.HexToAddress(req.Wallet)
+	target, callData, err := srv.walletCall(srv.walletTypeFor(wallet), &req)
+	if err != nil {
+		srv.audit(auditTransfer, &req, common.Hash{}, err)
+		sendError(w, err.Error())
+		return
+	}
+	if err := srv.authorizeWalletCall(r, &req.PasskeyData, wallet, opTransfer, target, callData); err != nil {
+		srv.audit(auditTransfer, &req, common.Hash{}, err)
+		sendVerificationError(w, err)
+		return
+	}
+
+	// broadcast=false: 只返回签名后的原始交易，由调用方自行提交
+	if !broadcastRequested(r) {
+		signedTx, err := srv.signERC20Transfer(&req)
+		if err != nil {
+			srv.audit(auditTransfer, &req, common.Hash{}, err)
+			sendError(w, "签名转账交易失败: "+err.Error())
+			return
+		}
+		srv.audit(auditTransfer, &req, signedTx.Hash(), nil)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success:     true,
+			Message:     "交易已签名，未广播",
+			TxHash:      signedTx.Hash().Hex(),
+			SNormalized: req.Signature.Normalized(),
+			Data:        srv.rawTxData(signedTx),
+		})
+		return
+	}
+
+	// 发送 ERC20 转账交易
+	srv.indexer.track(common.HexToAddress(req.Wallet))
+	txHash, batch, err := srv.sendERC20Transfer(&req)
+	srv.audit(auditTransfer, &req, txHash, err)
+	if err != nil {
+		// 费用超过上限由调用方稍后重试，预执行回滚是请求本身的问题，都不进入死信
+		if !isFeesTooHigh(err.Error()) && !strings.Contains(err.Error(), dryRunRevertMsg) {
+			srv.deadLetter(auditTransfer, &req, err)
+		}
+		sendError(w, "ERC20 转账失败: "+err.Error())
+		return
+	}
+	srv.recordTransfer(&req, txHash)
+
+	message := "ERC20 转账交易已发送"
+	if srv.walletTypeFor(common.HexToAddress(req.Wallet)).Encoder == walletEncoderAA {
+		message = "ERC20 转账 UserOperation 已提交 (txHash 为 userOpHash)"
+	}
+	resp := APIResponse{
+		Success:     true,
+		Message:     message,
+		TxHash:      txHash.Hex(),
+		SNormalized: req.Signature.Normalized(),
+		Warnings:    srv.recipientWarnings(common.HexToAddress(req.Wallet), common.HexToAddress(req.To)),
+	}
+	if batch != nil {
+		resp.Data = batch
+	}
+
+	srv.awaitTransfer(r, &resp, txHash, batch, "ERC20 转账")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// authorizeOperation 校验操作断言 (见 checkAssertion)，签名确认有效后推进 signCount；
+// 失败时记入钱包的验证失败次数
+//
+// 已部署的钱包经合约 verifySignature 确认，未部署的钱包用服务端登记的公钥本地验签。
+// 链上确认因 RPC 故障失败时直接返回错误，不放行未经确认的签名。
+func (srv *Server) authorizeOperation(r *http.Request, data *PasskeyData, wallet common.Address, operation string) error {
+	if err := srv.checkAssertion(r, data, wallet, operation); err != nil {
+		srv.recordFailedVerification(wallet, err)
+		return err
+	}
+	valid, err := srv.verifySignatureCall(data, wallet.Hex())
+	if err != nil {
+		code, cerr := srv.eth().CodeAt(r.Context(), wallet, nil)
+		if cerr != nil {
+			return fmt.Errorf("链上验证签名失败: %v", cerr)
+		}
+		if len(code) > 0 {
+			return fmt.Errorf("链上验证签名失败: %v", err)
+		}
+		valid, err = srv.verifyRegisteredKey(wallet, data)
+	}
+	switch {
+	case err != nil:
+	case !valid:
+		err = fmt.Errorf("签名无效")
+	default:
+		err = srv.advanceSignCount(wallet, data)
+	}
+	if err != nil {
+		srv.recordFailedVerification(wallet, err)
+	}
+	return err
+}
+
+// awaitTransfer 配置了 confirmations 时等待足够的确认，按结果改写响应；?async=true 立即返回，
+// 之后经 /api/tx/{hash} 查询 (submission.confirmed 表示已达到确认数)
+func (srv *Server) awaitTransfer(r *http.Request, resp *APIResponse, txHash common.Hash, batch *BatchInfo, label string) {
+	depth := srv.Config().Confirmations
+	if _, tracked := srv.submissions.lookup(txHash); depth == 0 || !tracked {
+		return
+	}
+	if asyncRequested(r) {
+		resp.Message += "，确认后可经 /api/tx/" + txHash.Hex() + " 查询"
+		return
+	}
+	status, err := srv.awaitConfirmations(r.Context(), txHash, depth)
+	switch {
+	case err != nil:
+		resp.Message = label + "交易已发送，等待确认超时: " + err.Error()
+	case status.Status == txStatusMined:
+		resp.Message = fmt.Sprintf("%s已确认 (%d 个确认)", label, status.Confirmations)
+	case status.Status == txStatusFailed:
+		resp.Success = false
+		resp.Message = label + "执行失败"
+		if status.RevertReason != "" {
+			resp.Message += ": " + status.RevertReason
+		}
+	default:
+		resp.Success = false
+		resp.Message = label + "未上链: nonce 已被其它交易占用"
+	}
+	if batch == nil {
+		resp.Data = status
+	}
+}
+
+// handleBalance 查询 ERC20 余额
+func (srv *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	address := r.URL.Query().Get("address")
+
+	if token == "" || address == "" {
+		sendError(w, "缺少参数: token, address")
+		return
+	}
+
+	var (
+		balance  *big.Int
+		symbol   string
+		decimals uint8
+		err      error
+	)
+	// 余额可按 cache.balance_ttl 缓存，代币元数据已缓存时不需要访问节点
+	tokenAddr, user := common.HexToAddress(token), common.HexToAddress(address)
+	meta, cached := srv.cachedTokenMetadata(tokenAddr)
+	if balance = srv.cachedBalance(tokenAddr, user); balance != nil && cached {
+		symbol, decimals = meta.Symbol, meta.Decimals
+	} else {
+		balance, symbol, decimals, err = srv.getERC20Balance(token, address)
+		if err != nil {
+			sendError(w, "查询余额失败: "+err.Error())
+			return
+		}
+		srv.storeBalance(tokenAddr, user, balance)
+	}
+
+	precision, locale := srv.formatOptions(r.URL.Query().Get("precision"), r.URL.Query().Get("locale"))
+	data := BalanceData{
+		Balance:   balance.String(),
+		Formatted: formatAmount(balance, decimals, precision, locale),
+		Symbol:    symbol,
+		Decimals:  decimals,
+	}
+	data.USDPrice, data.USDValue = srv.usdValue(tokenAddr, balance, decimals)
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    data,
+	})
+}
+
+func setCORSHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, Idempotency-Key, X-Chain-ID")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Idempotent-Replayed")
+}
+
+func sendError(w http.ResponseWriter, msg string) {
+	resp := APIResponse{
+		Success: false,
+		Message: msg,
+	}
+	// 上游 RPC 限流是暂时性的，调用方可以按错误码稍后重试
+	if isUpstreamRateLimited(msg) {
+		resp.Code = errCodeUpstreamRateLimited
+	}
+	if isFeesTooHigh(msg) {
+		resp.Code = errCodeFeesTooHigh
+	}
+	if isRPCUnavailable(msg) {
+		resp.Code = errCodeRPCUnavailable
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleCreateWallet 创建 PasskeyWallet
+func (srv *Server) handleCreateWallet(w http.ResponseWriter, r *http.Request) {
+	// 不再接受客户端直接提交的公钥，必须经过 WebAuthn 注册流程校验
+	sendError(w, "请使用 /api/register/begin (可传 walletType) 与 /api/register/finish 完成 Passkey 注册后创建钱包")
+}
+
+// handleUserOpStatus 查询自建 bundler 提交的 UserOperation 状态 (?hash=userOpHash)
+func (srv *Server) handleUserOpStatus(w http.ResponseWriter, r *http.Request) {
+	hash := r.URL.Query().Get("hash")
+	st, ok := srv.userOps.get(common.HexToHash(hash))
+	if !ok {
+		sendError(w, "未找到 UserOperation: "+hash)
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		TxHash:  st.TxHash,
+		Data:    st,
+	})
+}
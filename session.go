@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// sessionTTL 会话有效期
+const sessionTTL = 30 * time.Minute
+
+// session 钱包会话 (由 Passkey 签名建立)
+type session struct {
+	Wallet  common.Address
+	Expires time.Time
+}
+
+// sessionStore 会话存储 (nsSessions，token → session)
+type sessionStore struct {
+	st Storage
+}
+
+func newSessionStore(st Storage) *sessionStore {
+	return &sessionStore{st: st}
+}
+
+// create 为钱包签发新的会话 token
+func (ss *sessionStore) create(wallet common.Address) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	expires := time.Now().Add(sessionTTL)
+
+	err := putJSON(ss.st, nsSessions, token, session{Wallet: wallet, Expires: expires}, sessionTTL)
+	return token, expires, err
+}
+
+// lookup 查找未过期的会话
+func (ss *sessionStore) lookup(token string) (session, bool) {
+	var sess session
+	ok, err := getJSON(ss.st, nsSessions, token, &sess)
+	if err != nil || !ok || time.Now().After(sess.Expires) {
+		return session{}, false
+	}
+	return sess, true
+}
+
+// SessionRequest 建立会话请求 (对 /api/challenge 签发的 session challenge 的 Passkey 签名)
+type SessionRequest struct {
+	PasskeyData
+	Wallet string `json:"wallet"`
+}
+
+// SessionData /api/session 返回数据
+type SessionData struct {
+	Token   string `json:"token"`
+	Wallet  string `json:"wallet"`
+	Expires int64  `json:"expires"`
+}
+
+// handleSession 验证 Passkey 签名后签发钱包会话
+func (srv *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+
+	var req SessionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	if !common.IsHexAddress(req.Wallet) {
+		sendError(w, "wallet 地址格式错误")
+		return
+	}
+
+	wallet := common.HexToAddress(req.Wallet)
+	if err := srv.checkAssertion(r, &req.PasskeyData, wallet, opSession); err != nil {
+		srv.recordFailedVerification(wallet, err)
+		sendVerificationError(w, err)
+		return
+	}
+
+	// 通过钱包合约 verifySignature 确认签名者即钱包所有者
+	valid, err := srv.verifySignatureCall(&req.PasskeyData, req.Wallet)
+	if err != nil {
+		sendError(w, "验证签名失败: "+err.Error())
+		return
+	}
+	if !valid {
+		srv.recordFailedVerification(wallet, fmt.Errorf("签名无效"))
+		sendError(w, "签名无效")
+		return
+	}
+	if err := srv.advanceSignCount(wallet, &req.PasskeyData); err != nil {
+		srv.recordFailedVerification(wallet, err)
+		sendVerificationError(w, err)
+		return
+	}
+
+	srv.indexer.track(wallet)
+	token, expires, err := srv.sessions.create(wallet)
+	if err != nil {
+		sendError(w, "保存会话失败: "+err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success:     true,
+		Message:     "会话已建立",
+		SNormalized: req.Signature.Normalized(),
+		Data: SessionData{
+			Token:   token,
+			Wallet:  wallet.Hex(),
+			Expires: expires.Unix(),
+		},
+	})
+}
+
+// requireSession 从 Authorization: Bearer <token> 中解析会话
+func (srv *Server) requireSession(w http.ResponseWriter, r *http.Request) (session, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	sess, ok := srv.sessions.lookup(token)
+	if token == "" || !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		sendError(w, "会话无效或已过期，请重新用 Passkey 签名登录")
+		return session{}, false
+	}
+	return sess, true
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Cache 短期状态: challenge、幂等键、代币元数据、余额
+//
+// 与 Storage 不同，缓存中的值允许丢失，不支持列举。默认使用进程内实现；
+// 多实例部署配置 cache.driver: redis，在一个实例上签发的 challenge 可以在另一个实例上使用，
+// 同一个幂等键只会被一个实例处理。
+type Cache interface {
+	// Get 读取值，不存在或已过期时 ok 为 false
+	Get(ns, key string) (value []byte, ok bool, err error)
+	// Set 写入值，ttl 为 0 表示不过期
+	Set(ns, key string, value []byte, ttl time.Duration) error
+	// SetNX 只在 key 不存在时写入，返回是否写入
+	SetNX(ns, key string, value []byte, ttl time.Duration) (bool, error)
+	// Take 读取并删除 (原子操作)，用于一次性 challenge
+	Take(ns, key string) (value []byte, ok bool, err error)
+	Delete(ns, key string) error
+	Close() error
+}
+
+// 缓存命名空间
+const (
+	nsChallenges  = "challenges"
+	nsIdempotency = "idempotency"
+	nsTokenMeta   = "tokenmeta"
+	nsBalances    = "balances"
+)
+
+// tokenMetaTTL 共享缓存中代币元数据的有效期 (symbol / decimals 基本不变，进程内另有一级缓存)
+const tokenMetaTTL = 24 * time.Hour
+
+// CacheConfig 缓存后端配置
+type CacheConfig struct {
+	Driver     string `yaml:"driver"`      // memory (默认) / redis
+	URL        string `yaml:"url"`         // redis://[:password@]host:6379/0，rediss:// 使用 TLS
+	Prefix     string `yaml:"prefix"`      // redis key 前缀，默认 passkey:
+	BalanceTTL int    `yaml:"balance_ttl"` // GET /api/balance 的余额缓存时间 (秒)，0 表示不缓存
+}
+
+// cacheDrivers 已注册的缓存后端
+var cacheDrivers = map[string]func(cfg CacheConfig) (Cache, error){
+	"memory": func(CacheConfig) (Cache, error) { return newMemoryCache(), nil },
+}
+
+// registerCacheDriver 注册缓存后端 (由可选后端在 init 中调用)
+func registerCacheDriver(name string, open func(cfg CacheConfig) (Cache, error)) {
+	cacheDrivers[name] = open
+}
+
+// openCache 按配置打开缓存后端
+func openCache(cfg CacheConfig) (Cache, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		driver = "memory"
+	}
+	open, ok := cacheDrivers[driver]
+	if !ok {
+		return nil, fmt.Errorf("未知缓存后端: %s", driver)
+	}
+	return open(cfg)
+}
+
+// memoryCache 进程内缓存 (默认)
+type memoryCache struct {
+	mu     sync.Mutex
+	data   map[string]memoryEntry
+	writes int // 每 1024 次写入清理一次过期条目
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{data: make(map[string]memoryEntry)}
+}
+
+func (m *memoryCache) Get(ns, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.data[ns+"/"+key]
+	if !ok || e.expired(time.Now()) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// setLocked 写入并定期清理过期条目，调用方持有 mu
+func (m *memoryCache) setLocked(k string, value []byte, ttl time.Duration) {
+	e := memoryEntry{value: value}
+	now := time.Now()
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	m.data[k] = e
+	if m.writes++; m.writes%1024 == 0 {
+		for k, e := range m.data {
+			if e.expired(now) {
+				delete(m.data, k)
+			}
+		}
+	}
+}
+
+func (m *memoryCache) Set(ns, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setLocked(ns+"/"+key, value, ttl)
+	return nil
+}
+
+func (m *memoryCache) SetNX(ns, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := ns + "/" + key
+	if e, ok := m.data[k]; ok && !e.expired(time.Now()) {
+		return false, nil
+	}
+	m.setLocked(k, value, ttl)
+	return true, nil
+}
+
+func (m *memoryCache) Take(ns, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := ns + "/" + key
+	e, ok := m.data[k]
+	if !ok {
+		return nil, false, nil
+	}
+	delete(m.data, k)
+	if e.expired(time.Now()) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+func (m *memoryCache) Delete(ns, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, ns+"/"+key)
+	return nil
+}
+
+func (m *memoryCache) Close() error {
+	return nil
+}
+
+// chainCache 给命名空间加上 chainId 前缀，多条链共用一个缓存后端
+type chainCache struct {
+	Cache
+	prefix string
+}
+
+func newChainCache(c Cache, chainID int64) Cache {
+	return chainCache{Cache: c, prefix: fmt.Sprintf("chain/%d/", chainID)}
+}
+
+func (c chainCache) Get(ns, key string) ([]byte, bool, error) {
+	return c.Cache.Get(c.prefix+ns, key)
+}
+
+func (c chainCache) Set(ns, key string, value []byte, ttl time.Duration) error {
+	return c.Cache.Set(c.prefix+ns, key, value, ttl)
+}
+
+func (c chainCache) SetNX(ns, key string, value []byte, ttl time.Duration) (bool, error) {
+	return c.Cache.SetNX(c.prefix+ns, key, value, ttl)
+}
+
+func (c chainCache) Take(ns, key string) ([]byte, bool, error) {
+	return c.Cache.Take(c.prefix+ns, key)
+}
+
+func (c chainCache) Delete(ns, key string) error {
+	return c.Cache.Delete(c.prefix+ns, key)
+}
+
+// Close 共用的后端由默认链关闭
+func (c chainCache) Close() error { return nil }
+
+// setCacheJSON 序列化为 JSON 后写入缓存
+func setCacheJSON(c Cache, ns, key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Set(ns, key, data, ttl)
+}
+
+// getCacheJSON 读取并反序列化缓存中的 JSON 值
+func getCacheJSON(c Cache, ns, key string, v interface{}) (bool, error) {
+	data, ok, err := c.Get(ns, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// cachedBalance 读取缓存的余额，未配置 balance_ttl 或未命中时返回 nil
+func (srv *Server) cachedBalance(token, user common.Address) *big.Int {
+	if srv.Config().Cache.BalanceTTL <= 0 {
+		return nil
+	}
+	data, ok, err := srv.shared.Get(nsBalances, token.Hex()+"/"+user.Hex())
+	if err != nil || !ok {
+		return nil
+	}
+	balance, ok := new(big.Int).SetString(string(data), 10)
+	if !ok {
+		return nil
+	}
+	return balance
+}
+
+// storeBalance 按 balance_ttl 缓存余额
+func (srv *Server) storeBalance(token, user common.Address, balance *big.Int) {
+	ttl := srv.Config().Cache.BalanceTTL
+	if ttl <= 0 || balance == nil {
+		return
+	}
+	srv.shared.Set(nsBalances, token.Hex()+"/"+user.Hex(), []byte(balance.String()), time.Duration(ttl)*time.Second)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// signCountRecord 钱包 Passkey 最近一次被接受的 signCount
+// (nsCredentials，key = signcount/<wallet>/<credentialId>)
+//
+// 断言不携带 credentialId，按钱包已授权凭证本地验签找出签名者；找不到 (登记前创建的钱包)
+// 时按钱包记录，key = signcount/<wallet>。社交恢复更换公钥后清除记录。
+type signCountRecord struct {
+	Count     uint32 `json:"count"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// signCountError signCount 未递增，可能是被克隆的凭证
+type signCountError struct {
+	stored, got uint32
+}
+
+func (e *signCountError) Error() string {
+	return fmt.Sprintf("signCount 未递增 (已记录 %d，本次 %d)，拒绝该签名", e.stored, e.got)
+}
+
+func (e *signCountError) warning() string {
+	return "检测到 signCount 回退或重复，该 Passkey 可能已被克隆，请检查设备并考虑通过社交恢复更换公钥"
+}
+
+func signCountKey(wallet common.Address, credentialID string) string {
+	if credentialID == "" {
+		return "signcount/" + wallet.Hex()
+	}
+	return "signcount/" + wallet.Hex() + "/" + credentialID
+}
+
+// advanceSignCount 在签名已确认有效后调用: 计数必须严格递增，
+// 两次都为 0 说明认证器不实现计数器 (如同步 Passkey)，直接放行
+func (srv *Server) advanceSignCount(wallet common.Address, data *PasskeyData) error {
+	info, err := parseAuthenticatorData(common.FromHex(data.WebAuthn.AuthenticatorData))
+	if err != nil {
+		return err
+	}
+
+	key := signCountKey(wallet, srv.signingCredential(wallet, data))
+
+	srv.signCountMu.Lock()
+	defer srv.signCountMu.Unlock()
+
+	var rec signCountRecord
+	if _, err := getJSON(srv.storage, nsCredentials, key, &rec); err != nil {
+		return fmt.Errorf("读取 signCount 失败: %v", err)
+	}
+	if info.SignCount == 0 && rec.Count == 0 {
+		return nil
+	}
+	if info.SignCount <= rec.Count {
+		log.Printf("钱包 %s signCount 未递增: 已记录 %d，本次 %d", wallet.Hex(), rec.Count, info.SignCount)
+		return &signCountError{stored: rec.Count, got: info.SignCount}
+	}
+
+	rec = signCountRecord{Count: info.SignCount, UpdatedAt: time.Now().Unix()}
+	if err := putJSON(srv.storage, nsCredentials, key, rec, 0); err != nil {
+		return fmt.Errorf("保存 signCount 失败: %v", err)
+	}
+	return nil
+}
+
+// resetSignCount 钱包公钥更换后清除全部计数
+func (srv *Server) resetSignCount(wallet common.Address) {
+	srv.signCountMu.Lock()
+	defer srv.signCountMu.Unlock()
+	srv.storage.Delete(nsCredentials, signCountKey(wallet, ""))
+	kvs, _ := srv.storage.List(nsCredentials, signCountKey(wallet, "")+"/")
+	for _, kv := range kvs {
+		srv.storage.Delete(nsCredentials, kv.Key)
+	}
+}
+
+// resetCredentialSignCount 凭证撤销后清除其计数
+func (srv *Server) resetCredentialSignCount(wallet common.Address, credentialID string) {
+	srv.signCountMu.Lock()
+	defer srv.signCountMu.Unlock()
+	srv.storage.Delete(nsCredentials, signCountKey(wallet, credentialID))
+}
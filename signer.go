@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 中继主账户的签名后端
+const (
+	signerTypeKey    = "key"    // private_key / keystore (默认)
+	signerTypeLedger = "ledger" // Ledger 硬件钱包 (USB HID)
+)
+
+// SignerConfig 中继主账户的签名方式
+type SignerConfig struct {
+	Type       string `yaml:"type"`        // key (默认) / ledger / clef / web3signer
+	LedgerPath string `yaml:"ledger_path"` // ledger: BIP-44 派生路径，默认 m/44'/60'/0'/0/0
+	URL        string `yaml:"url"`         // clef / web3signer: 签名服务地址 (http(s):// 或 IPC 路径)
+	Address    string `yaml:"address"`     // clef / web3signer: 签名账户，服务上只有一个账户时可省略
+}
+
+// Signer 中继交易的签名者
+//
+// 默认由配置中的私钥实现 (keySigner)；KMS / HSM / 远程签名服务实现这两个方法后
+// 通过 NewServer 或 SetSigner 接入，nonce 分配、提价重发、取消交易等中继逻辑不需要改动。
+type Signer interface {
+	// Address 签名账户地址
+	Address() common.Address
+	// SignTx 对交易签名，chainID 用于 EIP-155 重放保护
+	SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// keySigner 用本地私钥签名
+type keySigner struct {
+	key  *ecdsa.PrivateKey
+	addr common.Address
+}
+
+// newKeySigner 包装本地私钥，key 为 nil 时返回 nil (未配置私钥)
+func newKeySigner(key *ecdsa.PrivateKey) Signer {
+	if key == nil {
+		return nil
+	}
+	return &keySigner{key: key, addr: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+func (s *keySigner) Address() common.Address {
+	return s.addr
+}
+
+func (s *keySigner) SignTx(tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
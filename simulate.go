@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// SimulationResult /api/simulate 返回数据
+type SimulationResult struct {
+	Mode                string `json:"mode"`           // eoa / 4337
+	Counterfactual      bool   `json:"counterfactual"` // 钱包尚未部署，按状态覆盖预演
+	Valid               bool   `json:"valid"`
+	SignatureChecked    bool   `json:"signatureChecked"` // 请求未携带签名时不检查
+	SigFailure          bool   `json:"sigFailure"`
+	InsufficientDeposit bool   `json:"insufficientDeposit"`
+	Deposit             string `json:"deposit,omitempty"`         // 钱包 (或 paymaster) 在 EntryPoint 的存款
+	RequiredPrefund     string `json:"requiredPrefund,omitempty"` // 按 gas 上限 × maxFeePerGas 计算
+	Sponsored           bool   `json:"sponsored"`
+	GasTooLow           bool   `json:"gasTooLow"`
+	GasEstimate         uint64 `json:"gasEstimate,omitempty"`
+	GasPrice            string `json:"gasPrice,omitempty"`     // 中继交易的 gas price (wei)
+	L1Fee               string `json:"l1Fee,omitempty"`        // rollup 上的 L1 数据费 (wei)，Arbitrum 已包含在 gasEstimate 中
+	EstimatedFee        string `json:"estimatedFee,omitempty"` // gas price × gas + OP-stack L1 数据费 (wei)
+	RevertReason        string `json:"revertReason,omitempty"`
+	USDPrice            string `json:"usdPrice,omitempty"` // 配置了 price_oracle 时的代币单价
+	USDValue            string `json:"usdValue,omitempty"` // 转账金额的 USD 价值，保留两位小数
+}
+
+// hasSignature 请求是否携带了 Passkey 签名
+func hasSignature(data *PasskeyData) bool {
+	return strings.TrimPrefix(data.Signature.R, "0x") != "" && strings.TrimPrefix(data.WebAuthn.MessageHash, "0x") != ""
+}
+
+// decodeRevert 从 eth_call / eth_estimateGas 错误中解析 revert 原因
+func decodeRevert(err error) string {
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if s, ok := dataErr.ErrorData().(string); ok {
+			if data, decodeErr := hex.DecodeString(strings.TrimPrefix(s, "0x")); decodeErr == nil {
+				if reason, unpackErr := abi.UnpackRevert(data); unpackErr == nil {
+					return reason
+				}
+			}
+		}
+	}
+	return err.Error()
+}
+
+// dryRunRevertMsg 预执行回滚的错误信息前缀 (用户侧错误，不写入死信)
+const dryRunRevertMsg = "交易预执行失败"
+
+// isReverted 错误是否为合约执行回滚 (而不是节点 / 网络错误)
+func isReverted(err error) bool {
+	var dataErr rpc.DataError
+	return errors.As(err, &dataErr) || strings.Contains(err.Error(), "execution reverted")
+}
+
+// dryRun 占用 nonce 与 gas 之前，以中继账户身份 eth_call 预执行调用数据
+//
+// 会回滚的交易直接返回解析出的原因，不再广播一笔注定失败的交易
+// (signTransaction 在 EstimateGas 失败时会退回 fallbackGasLimit，掩盖了回滚)。
+// 节点错误不阻断发送，交给后续流程处理。
+func (srv *Server) dryRun(target common.Address, callData []byte) error {
+	msg := ethereum.CallMsg{To: &target, Data: callData}
+	if s := srv.signer(); s != nil {
+		msg.From = s.Address()
+	}
+	_, err := srv.eth().CallContract(context.Background(), msg, nil)
+	if err != nil && isReverted(err) {
+		return fmt.Errorf("%s: %s", dryRunRevertMsg, decodeRevert(err))
+	}
+	return nil
+}
+
+// isOutOfGas 是否为 gas 不足导致的失败
+func isOutOfGas(reason string) bool {
+	r := strings.ToLower(reason)
+	return strings.Contains(r, "out of gas") || strings.Contains(r, "gas too low") || strings.Contains(r, "intrinsic gas")
+}
+
+// simulateTransfer 在签名前 (或提交前) 预演一次转账
+//
+// EntryPoint v0.7 已移除链上 simulateValidation，这里按其检查项分别用 eth_call 复现:
+// 签名 (verifySignature)、预付款 (EntryPoint.balanceOf)、执行 gas (eth_estimateGas)。
+func (srv *Server) simulateTransfer(req *ERC20TransferRequest) (*SimulationResult, error) {
+	cfg := srv.Config()
+	result := &SimulationResult{Mode: cfg.RelayMode}
+
+	wallet := common.HexToAddress(req.Wallet)
+	overrides, err := srv.walletOverrides(context.Background(), wallet, &req.PasskeyData)
+	if err != nil {
+		return nil, err
+	}
+	result.Counterfactual = overrides != nil
+
+	if hasSignature(&req.PasskeyData) {
+		result.SignatureChecked = true
+		valid, err := srv.verifySignatureCallWith(&req.PasskeyData, req.Wallet, overrides)
+		if err != nil {
+			return nil, err
+		}
+		result.SigFailure = !valid
+	}
+
+	wt := srv.walletTypeFor(wallet)
+	target, callData, err := srv.walletCall(wt, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4337 账户由 EntryPoint 调用钱包，其余由中继账户调用 (safe-module 调用模块)
+	from := srv.entryPointAddress()
+	if wt.Encoder != walletEncoderAA {
+		if s := srv.signer(); s != nil {
+			from = s.Address()
+		}
+	}
+	gas, err := srv.estimateGasWithOverrides(context.Background(), ethereum.CallMsg{
+		From: from,
+		To:   &target,
+		Data: callData,
+	}, overrides)
+	if err != nil {
+		result.RevertReason = decodeRevert(err)
+		result.GasTooLow = isOutOfGas(result.RevertReason)
+		// 未签名时钱包必然以 Invalid signature 回滚，此时无法预演执行，只检查预付款
+		if !result.SignatureChecked && strings.Contains(result.RevertReason, "Invalid signature") {
+			result.RevertReason = ""
+			gas = srv.fallbackGasLimit()
+		}
+	} else {
+		result.GasEstimate = gas
+	}
+
+	if wt.Encoder == walletEncoderAA {
+		if err := srv.simulatePrefund(req, callData, gas, result); err != nil {
+			return nil, err
+		}
+	} else if gas > 0 {
+		gasPrice, l1, total, err := srv.relayFee(context.Background(), target, callData, gas)
+		if err != nil {
+			return nil, err
+		}
+		result.GasPrice, result.EstimatedFee = gasPrice.String(), total.String()
+		if l1.Fee != nil {
+			result.L1Fee = l1.Fee.String()
+		}
+	}
+
+	token := common.HexToAddress(req.Token)
+	if amount, ok := new(big.Int).SetString(req.Amount, 10); ok {
+		erc20, _ := abi.JSON(strings.NewReader(erc20ABI))
+		result.USDPrice, result.USDValue = srv.usdValue(token, amount, srv.getTokenMetadata(erc20, token).Decimals)
+	}
+
+	result.Valid = !result.SigFailure && !result.InsufficientDeposit && !result.GasTooLow && result.RevertReason == ""
+	return result, nil
+}
+
+// simulatePrefund 检查钱包 (或 paymaster) 在 EntryPoint 的存款是否足够支付本次 op
+func (srv *Server) simulatePrefund(req *ERC20TransferRequest, callData []byte, callGas uint64, result *SimulationResult) error {
+	wallet := common.HexToAddress(req.Wallet)
+	op, err := srv.buildUserOp(wallet, callData)
+	if err != nil {
+		return err
+	}
+	op.CallGasLimit = new(big.Int).SetUint64(callGas + userOpCallGasBuffer)
+	op.VerificationGasLimit = srv.verificationGasLimit()
+	op.PreVerificationGas = big.NewInt(userOpFixedOverhead)
+
+	payer := wallet
+	result.Sponsored = srv.paymaster.attach(op)
+	if result.Sponsored {
+		payer = *op.Paymaster
+	}
+
+	required := new(big.Int).Add(op.CallGasLimit, op.VerificationGasLimit)
+	required.Add(required, op.PreVerificationGas)
+	if result.Sponsored {
+		required.Add(required, op.PaymasterVerificationGasLimit)
+		required.Add(required, op.PaymasterPostOpGasLimit)
+	}
+	required.Mul(required, op.MaxFeePerGas)
+
+	parsedABI, _ := abi.JSON(strings.NewReader(entryPointABI))
+	data, _ := parsedABI.Pack("balanceOf", payer)
+	ep := srv.entryPointAddress()
+	out, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &ep, Data: data}, nil)
+	if err != nil {
+		return fmt.Errorf("查询 EntryPoint 存款失败: %v", err)
+	}
+	var deposit *big.Int
+	if err := parsedABI.UnpackIntoInterface(&deposit, "balanceOf", out); err != nil {
+		return fmt.Errorf("解析 EntryPoint 存款失败: %v", err)
+	}
+
+	// 未代付时钱包可在 validateUserOp 中用自身 ETH 余额补足预付款
+	available := new(big.Int).Set(deposit)
+	if !result.Sponsored {
+		balance, err := srv.eth().BalanceAt(context.Background(), wallet, nil)
+		if err == nil {
+			available.Add(available, balance)
+		}
+	}
+
+	result.Deposit = deposit.String()
+	result.RequiredPrefund = required.String()
+	result.InsufficientDeposit = available.Cmp(required) < 0
+	return nil
+}
+
+// handleSimulate 预演转账，返回签名、预付款、gas 检查结果
+func (srv *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+
+	var req ERC20TransferRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	if err := srv.validateTransferRequest(&req); err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	result, err := srv.simulateTransfer(&req)
+	if err != nil {
+		sendError(w, "预演失败: "+err.Error())
+		return
+	}
+
+	message := "预演通过"
+	if !result.Valid {
+		message = "预演未通过"
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success:     true,
+		Message:     message,
+		Valid:       &result.Valid,
+		SNormalized: req.Signature.Normalized(),
+		Data:        result,
+	})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage 命名空间键值存储
+//
+// 凭证、交易日志、策略、会话、地址簿等都按命名空间存放在这里 (challenge 等短期状态见 Cache)，
+// 默认使用 SQLite (storage_sql.go)；后端通过 registerStorageDriver 注册，memory 不落盘，供测试与 -dev 使用。
+type Storage interface {
+	// Get 读取值，不存在或已过期时 ok 为 false
+	Get(ns, key string) (value []byte, ok bool, err error)
+	// Put 写入值，ttl 为 0 表示不过期
+	Put(ns, key string, value []byte, ttl time.Duration) error
+	// Delete 删除值，返回是否存在
+	Delete(ns, key string) (bool, error)
+	// List 按 key 升序列出命名空间中以 prefix 开头的值
+	List(ns, prefix string) ([]KV, error)
+	Close() error
+}
+
+// KV 键值对
+type KV struct {
+	Key   string
+	Value []byte
+}
+
+// 命名空间
+const (
+	nsCredentials  = "credentials"
+	nsJournal      = "journal"
+	nsPolicies     = "policies"
+	nsSessions     = "sessions"
+	nsAddressBook  = "addressbook"
+	nsHistory      = "history"
+	nsHistoryTx    = "historytx"
+	nsWebhooks     = "webhooks"
+	nsRecovery     = "recovery"
+	nsRisk         = "risk"
+	nsWallets      = "wallets"
+	nsWalletKeys   = "walletkeys"
+	nsIndexerState = "indexerstate"
+	nsDeadLetter   = "deadletter"
+	nsPrices       = "prices"
+	nsPendingTx    = "pendingtx"
+	nsSchedules    = "schedules"
+)
+
+// StorageConfig 存储后端配置
+type StorageConfig struct {
+	Driver string `yaml:"driver"` // sqlite (默认) / postgres / memory
+	DSN    string `yaml:"dsn"`    // 后端连接串
+}
+
+// storageDrivers 已注册的存储后端
+var storageDrivers = map[string]func(cfg StorageConfig) (Storage, error){
+	"memory": func(StorageConfig) (Storage, error) { return newMemoryStorage(), nil },
+}
+
+// registerStorageDriver 注册存储后端 (由可选后端在 init 中调用)
+func registerStorageDriver(name string, open func(cfg StorageConfig) (Storage, error)) {
+	storageDrivers[name] = open
+}
+
+// openStorage 按配置打开存储后端
+func openStorage(cfg StorageConfig) (Storage, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		driver = sqlDialectSQLite
+	}
+	open, ok := storageDrivers[driver]
+	if !ok {
+		return nil, fmt.Errorf("未知存储后端: %s", driver)
+	}
+	return open(cfg)
+}
+
+// getJSON 读取并反序列化 JSON 值
+func getJSON(st Storage, ns, key string, v interface{}) (bool, error) {
+	data, ok, err := st.Get(ns, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// putJSON 序列化为 JSON 后写入
+func putJSON(st Storage, ns, key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return st.Put(ns, key, data, ttl)
+}
+
+// memoryStorage 进程内存储 (无依赖，重启后数据丢失)
+type memoryStorage struct {
+	mu   sync.RWMutex
+	data map[string]map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{data: make(map[string]map[string]memoryEntry)}
+}
+
+func (m *memoryStorage) Get(ns, key string) ([]byte, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.data[ns][key]
+	if !ok || e.expired(time.Now()) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+func (m *memoryStorage) Put(ns, key string, value []byte, ttl time.Duration) error {
+	e := memoryEntry{value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data[ns] == nil {
+		m.data[ns] = make(map[string]memoryEntry)
+	}
+	m.data[ns][key] = e
+	return nil
+}
+
+func (m *memoryStorage) Delete(ns, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.data[ns][key]
+	if !ok {
+		return false, nil
+	}
+	delete(m.data[ns], key)
+	return !e.expired(time.Now()), nil
+}
+
+func (m *memoryStorage) List(ns, prefix string) ([]KV, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	list := []KV{}
+	for key, e := range m.data[ns] {
+		if e.expired(now) {
+			delete(m.data[ns], key)
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			list = append(list, KV{Key: key, Value: e.value})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+func (m *memoryStorage) Close() error {
+	return nil
+}
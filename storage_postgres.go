@@ -0,0 +1,6 @@
+//go:build postgres
+
+package main
+
+// Postgres 驱动，storage.driver: postgres
+import _ "github.com/jackc/pgx/v5/stdlib"
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQL 存储方言
+const (
+	sqlDialectSQLite   = "sqlite"
+	sqlDialectPostgres = "postgres"
+
+	defaultSQLiteDSN = "wallet.db"
+)
+
+// sqlDrivers 方言对应的 database/sql 驱动名与编译标签 (sqlite 默认编译进程序，没有标签)
+var sqlDrivers = map[string]struct{ driver, tag string }{
+	sqlDialectSQLite:   {"sqlite", ""},      // modernc.org/sqlite (纯 Go，无需 cgo)
+	sqlDialectPostgres: {"pgx", "postgres"}, // github.com/jackc/pgx/v5/stdlib
+}
+
+func init() {
+	for dialect := range sqlDrivers {
+		registerStorageDriver(dialect, func(cfg StorageConfig) (Storage, error) {
+			return openSQLStorage(dialect, cfg.DSN)
+		})
+	}
+}
+
+// sqlStorage 基于 database/sql 的持久化存储 (storage.driver: sqlite / postgres)
+//
+// 全部命名空间共用一张 kv 表，expires_at 为过期时间 (Unix 毫秒)，0 表示不过期；
+// 过期的行读取时忽略，List 时顺带清理。sqlite 驱动默认包含，postgres 驱动需 go build -tags postgres。
+type sqlStorage struct {
+	db      *sql.DB
+	dialect string
+}
+
+// openSQLStorage 连接数据库并执行迁移 (migrate.go)，sqlite 未配置 dsn 时使用当前目录下的 wallet.db
+func openSQLStorage(dialect, dsn string) (*sqlStorage, error) {
+	d := sqlDrivers[dialect]
+	if !slices.Contains(sql.Drivers(), d.driver) {
+		return nil, fmt.Errorf("当前程序未包含 %s 驱动，请使用 go build -tags %s 重新编译", dialect, d.tag)
+	}
+	if dsn == "" {
+		if dialect != sqlDialectSQLite {
+			return nil, fmt.Errorf("storage.dsn 不能为空")
+		}
+		dsn = defaultSQLiteDSN
+	}
+	db, err := sql.Open(d.driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := &sqlStorage{db: db, dialect: dialect}
+	if dialect == sqlDialectSQLite {
+		// SQLite 同一时间只允许一个写入者，单连接避免 "database is locked"
+		db.SetMaxOpenConns(1)
+	}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化 %s 存储失败: %v", dialect, err)
+	}
+	return s, nil
+}
+
+// query 把 ? 占位符换成 postgres 的 $n
+func (s *sqlStorage) query(q string) string {
+	if s.dialect != sqlDialectPostgres {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range q {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (s *sqlStorage) Get(ns, key string) ([]byte, bool, error) {
+	var value []byte
+	err := s.db.QueryRow(s.query(`SELECT v FROM kv WHERE ns = ? AND k = ? AND (expires_at = 0 OR expires_at > ?)`),
+		ns, key, time.Now().UnixMilli()).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *sqlStorage) Put(ns, key string, value []byte, ttl time.Duration) error {
+	var expires int64
+	if ttl > 0 {
+		expires = time.Now().Add(ttl).UnixMilli()
+	}
+	_, err := s.db.Exec(s.query(`INSERT INTO kv (ns, k, v, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (ns, k) DO UPDATE SET v = excluded.v, expires_at = excluded.expires_at`),
+		ns, key, value, expires)
+	return err
+}
+
+func (s *sqlStorage) Delete(ns, key string) (bool, error) {
+	var expires int64
+	err := s.db.QueryRow(s.query(`DELETE FROM kv WHERE ns = ? AND k = ? RETURNING expires_at`), ns, key).Scan(&expires)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return expires == 0 || expires > time.Now().UnixMilli(), nil
+}
+
+// likeEscape 转义 LIKE 模式中的特殊字符
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (s *sqlStorage) List(ns, prefix string) ([]KV, error) {
+	now := time.Now().UnixMilli()
+	if _, err := s.db.Exec(s.query(`DELETE FROM kv WHERE ns = ? AND expires_at <> 0 AND expires_at <= ?`), ns, now); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(s.query(`SELECT k, v FROM kv WHERE ns = ? AND k LIKE ? ESCAPE '\'`), ns, likeEscape(prefix)+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []KV{}
+	for rows.Next() {
+		var kv KV
+		if err := rows.Scan(&kv.Key, &kv.Value); err != nil {
+			return nil, err
+		}
+		// SQLite 的 LIKE 对 ASCII 不区分大小写
+		if strings.HasPrefix(kv.Key, prefix) {
+			list = append(list, kv)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// 按字节序排序，与 memoryStorage 一致 (postgres 的默认排序规则与区域设置有关)
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+func (s *sqlStorage) Close() error {
+	return s.db.Close()
+}
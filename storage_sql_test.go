@@ -0,0 +1,156 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStorageContract 各存储后端共同的行为: 读写、过期、删除、按前缀有序列出
+func testStorageContract(t *testing.T, st Storage) {
+	t.Helper()
+
+	if _, ok, err := st.Get("ns", "missing"); err != nil || ok {
+		t.Fatalf("读取不存在的键: ok=%v err=%v", ok, err)
+	}
+	if err := st.Put("ns", "a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Put("ns", "a", []byte("2"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := st.Get("ns", "a"); err != nil || !ok || string(v) != "2" {
+		t.Fatalf("覆盖写入后读取 = %q, %v, %v", v, ok, err)
+	}
+	if _, ok, _ := st.Get("other", "a"); ok {
+		t.Fatal("命名空间之间不应互相可见")
+	}
+
+	// 过期的值读取不到，List 也不返回
+	if err := st.Put("ns", "expired", []byte("x"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, ok, _ := st.Get("ns", "expired"); ok {
+		t.Fatal("已过期的值仍可读取")
+	}
+
+	// 前缀中的 LIKE 通配符按字面匹配，大小写敏感，结果按 key 字节序
+	for _, k := range []string{"p/b", "p/a", "p/A", "p_x", "p%y", "q/a"} {
+		if err := st.Put("ns", k, []byte(k), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for prefix, want := range map[string]string{
+		"p/": "p/A,p/a,p/b",
+		"p_": "p_x",
+		"p%": "p%y",
+		"P/": "",
+	} {
+		kvs, err := st.List("ns", prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := []string{}
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		if got := strings.Join(keys, ","); got != want {
+			t.Errorf("List(%q) = %s, 期望 %s", prefix, got, want)
+		}
+	}
+
+	if existed, err := st.Delete("ns", "a"); err != nil || !existed {
+		t.Fatalf("删除存在的键: existed=%v err=%v", existed, err)
+	}
+	if existed, err := st.Delete("ns", "a"); err != nil || existed {
+		t.Fatalf("重复删除: existed=%v err=%v", existed, err)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	testStorageContract(t, newMemoryStorage())
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "wallet.db")
+	st, err := openSQLStorage(sqlDialectSQLite, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorageContract(t, st)
+
+	// 重新打开后数据仍在，迁移不会重复执行
+	if err := st.Put("ns", "persist", []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+	st, err = openSQLStorage(sqlDialectSQLite, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if v, ok, err := st.Get("ns", "persist"); err != nil || !ok || string(v) != "v" {
+		t.Fatalf("重新打开后读取 = %q, %v, %v", v, ok, err)
+	}
+}
+
+func TestOpenStorageDefaultsToSQLite(t *testing.T) {
+	t.Chdir(t.TempDir())
+	st, err := openStorage(StorageConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if _, ok := st.(*sqlStorage); !ok {
+		t.Fatalf("默认存储为 %T，期望 sqlite", st)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for dialect := range sqlDrivers {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatalf("%s: %v", dialect, err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("%s: 没有迁移脚本", dialect)
+		}
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("%s: 第 %d 个脚本 %s 的版本为 %d，版本号应从 1 连续递增", dialect, i+1, m.Name, m.Version)
+			}
+		}
+	}
+	if _, err := loadMigrations("mysql"); err == nil {
+		t.Error("不存在的方言应返回错误")
+	}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "wallet.db")
+	st, err := openSQLStorage(sqlDialectSQLite, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, _ := loadMigrations(sqlDialectSQLite)
+	latest := migrations[len(migrations)-1].Version
+
+	var version, count int
+	if err := st.db.QueryRow(`SELECT MAX(version), COUNT(*) FROM schema_migrations`).Scan(&version, &count); err != nil {
+		t.Fatal(err)
+	}
+	if version != latest || count != len(migrations) {
+		t.Fatalf("schema_migrations: 最新版本 %d、%d 条记录，期望 %d、%d", version, count, latest, len(migrations))
+	}
+
+	// 数据库版本高于程序内置版本 (回退到旧程序) 时拒绝启动
+	if _, err := st.db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'future', 0)`, latest+1); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+	if _, err := openSQLStorage(sqlDialectSQLite, dsn); err == nil || !strings.Contains(err.Error(), "高于程序支持的版本") {
+		t.Fatalf("数据库版本过高时应拒绝打开: %v", err)
+	}
+}
@@ -0,0 +1,4 @@
+package main
+
+// SQLite 驱动 (纯 Go，无需 cgo)，默认存储后端 storage.driver: sqlite
+import _ "modernc.org/sqlite"
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	stuckAfter   = 5 * time.Minute // 广播后多久未上链视为卡住
+	cancelTxGas  = 21000
+	cancelBumpPc = 20 // 取消交易相对原交易的最低提价百分比
+)
+
+// StuckTx 卡住的 nonce
+type StuckTx struct {
+	Nonce    uint64 `json:"nonce"`
+	Reason   string `json:"reason"` // gap: 交易池中没有该 nonce 的交易；pending: 已广播但长时间未上链
+	Hash     string `json:"hash,omitempty"`
+	GasPrice string `json:"gasPrice,omitempty"`
+	Age      int64  `json:"ageSeconds,omitempty"`
+}
+
+// StuckData /api/admin/stuck 返回数据
+type StuckData struct {
+	Relayer        string    `json:"relayer"`
+	ConfirmedNonce uint64    `json:"confirmedNonce"` // 已上链的交易数 (下一个待确认的 nonce)
+	PendingNonce   uint64    `json:"pendingNonce"`   // 节点交易池视角的下一个 nonce
+	LocalNonce     uint64    `json:"localNonce"`     // nonceManager 将分配的下一个 nonce
+	Stuck          []StuckTx `json:"stuck"`
+}
+
+// CancelRequest /api/admin/stuck 取消请求
+type CancelRequest struct {
+	Relayer  string `json:"relayer,omitempty"` // 中继池账户地址，留空为主中继账户
+	Nonce    uint64 `json:"nonce"`
+	GasPrice string `json:"gasPrice,omitempty"` // wei，留空时自动提价
+}
+
+// stuckTransactions 检查中继账户是否有卡住的 nonce
+//
+// 确认 nonce 到本地 nonce 之间的每个 nonce 都应有一笔在途交易: 节点交易池之外的
+// nonce 是空洞 (发送失败或被节点丢弃)，会阻塞其后全部交易；已广播但超过 stuckAfter
+// 仍未上链的一般是 gas price 过低。
+func (srv *Server) stuckTransactions(ctx context.Context, r *relayer) (*StuckData, error) {
+	from := r.address()
+	states, err := srv.accountStates(ctx, []common.Address{from})
+	if err == nil {
+		err = states[0].Err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取 nonce 失败: %v", err)
+	}
+	confirmed, pending := states[0].Nonce, states[0].PendingNonce
+	local, err := r.nonces.peek()
+	if err != nil {
+		return nil, err
+	}
+
+	data := &StuckData{Relayer: from.Hex(), ConfirmedNonce: confirmed, PendingNonce: pending, LocalNonce: local, Stuck: []StuckTx{}}
+	tracked := srv.submissions.byNonce(from)
+	now := time.Now()
+	for nonce := confirmed; nonce < max(local, pending); nonce++ {
+		sub, ok := tracked[nonce]
+		switch {
+		case nonce >= pending:
+			// 节点交易池从 pending 处断开，之后的交易都在等这个 nonce
+			st := StuckTx{Nonce: nonce, Reason: "gap"}
+			if ok {
+				st.Hash, st.GasPrice = sub.Hashes[len(sub.Hashes)-1], sub.GasPrice
+			}
+			data.Stuck = append(data.Stuck, st)
+		case ok && now.Sub(time.Unix(sub.SubmittedAt, 0)) > stuckAfter:
+			data.Stuck = append(data.Stuck, StuckTx{
+				Nonce:    nonce,
+				Reason:   "pending",
+				Hash:     sub.Hashes[len(sub.Hashes)-1],
+				GasPrice: sub.GasPrice,
+				Age:      int64(now.Sub(time.Unix(sub.SubmittedAt, 0)).Seconds()),
+			})
+		}
+	}
+	return data, nil
+}
+
+// cancelNonce 用同一 nonce 发送 0 值转给自己的交易，替换卡住的交易或填补空洞
+func (srv *Server) cancelNonce(ctx context.Context, r *relayer, nonce uint64, gasPrice *big.Int) (*types.Transaction, error) {
+	signer := r.signer()
+	if signer == nil {
+		return nil, fmt.Errorf("未配置私钥")
+	}
+	from := signer.Address()
+	confirmed, err := srv.eth().NonceAt(ctx, from, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取 nonce 失败: %v", err)
+	}
+	if nonce < confirmed {
+		return nil, fmt.Errorf("nonce %d 已上链", nonce)
+	}
+	local, err := r.nonces.peek()
+	if err != nil {
+		return nil, err
+	}
+	if nonce >= local {
+		return nil, fmt.Errorf("nonce %d 尚未分配 (下一个 nonce 为 %d)", nonce, local)
+	}
+
+	if gasPrice == nil {
+		suggested, err := srv.gasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		gasPrice = suggested
+		// 替换交易池中的交易时必须比原交易高出足够幅度
+		if sub, ok := srv.submissions.byNonce(from)[nonce]; ok {
+			old, _ := new(big.Int).SetString(sub.GasPrice, 10)
+			if old != nil {
+				bumped := new(big.Int).Mul(old, big.NewInt(100+cancelBumpPc))
+				bumped.Div(bumped, big.NewInt(100))
+				if bumped.Cmp(gasPrice) > 0 {
+					gasPrice = bumped
+				}
+			}
+		}
+	}
+
+	tx := types.NewTransaction(nonce, from, big.NewInt(0), cancelTxGas, gasPrice, nil)
+	signedTx, err := signer.SignTx(tx, srv.chainID)
+	if err != nil {
+		return nil, fmt.Errorf("签名交易失败: %v", err)
+	}
+	srv.submissions.track(from, signedTx)
+	if err := srv.broadcast(signedTx); err != nil {
+		srv.submissions.forget(signedTx.Hash())
+		return nil, err
+	}
+	log.Printf("已发送取消交易: nonce %d, gas price %s, %s", nonce, gasPrice, signedTx.Hash().Hex())
+	return signedTx, nil
+}
+
+// handleAdminStuck 卡住的中继交易
+//
+//	GET  /api/admin/stuck                                列出各中继账户的空洞与长时间未上链的 nonce
+//	POST /api/admin/stuck {"nonce":12,"gasPrice":"..."}  以 0 值自转账取消该 nonce (relayer 指定中继池账户)
+func (srv *Server) handleAdminStuck(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		list := []*StuckData{}
+		for _, m := range srv.relayers.members {
+			if m.signer() == nil {
+				continue
+			}
+			data, err := srv.stuckTransactions(r.Context(), m)
+			if err != nil {
+				sendError(w, err.Error())
+				return
+			}
+			list = append(list, data)
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Data:    list,
+		})
+
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req CancelRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		var gasPrice *big.Int
+		if req.GasPrice != "" {
+			var ok bool
+			if gasPrice, ok = new(big.Int).SetString(req.GasPrice, 10); !ok || gasPrice.Sign() <= 0 {
+				sendError(w, "gasPrice 格式错误: "+req.GasPrice)
+				return
+			}
+		}
+		target := srv.relayers.members[0]
+		if req.Relayer != "" {
+			var ok bool
+			if target, ok = srv.relayers.lookup(common.HexToAddress(req.Relayer)); !ok {
+				sendError(w, "不是中继池中的账户: "+req.Relayer)
+				return
+			}
+		}
+		signedTx, err := srv.cancelNonce(r.Context(), target, req.Nonce, gasPrice)
+		if err != nil {
+			sendError(w, "取消失败: "+err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("已发送 nonce %d 的取消交易 (gas price %s)", req.Nonce, signedTx.GasPrice()),
+			TxHash:  signedTx.Hash().Hex(),
+		})
+	}
+}
+
+// byNonce 返回某账户未结束的跟踪记录 (副本)，按 nonce 索引
+func (q *submissionQueue) byNonce(from common.Address) map[uint64]TxSubmission {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := make(map[uint64]TxSubmission)
+	for _, sub := range q.byHash {
+		if sub.done() || common.HexToAddress(sub.From) != from {
+			continue
+		}
+		// 同一 nonce 可能有取消交易，保留最近一笔
+		if prev, ok := out[sub.Nonce]; ok && prev.SubmittedAt > sub.SubmittedAt {
+			continue
+		}
+		cp := *sub
+		cp.Hashes = append([]string(nil), sub.Hashes...)
+		out[sub.Nonce] = cp
+	}
+	return out
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	defaultRetryMaxAttempts = 5
+	defaultRetryBumpPercent = 12 // 节点替换交易要求至少提价 10%
+	submissionPollInterval  = 3 * time.Second
+	submissionKeep          = time.Hour // 结束后保留多久供查询
+)
+
+// 已广播交易的状态
+const (
+	txStatusPending  = "pending"  // 等待上链
+	txStatusMined    = "mined"    // 已上链且执行成功
+	txStatusFailed   = "failed"   // 已上链但执行失败
+	txStatusReplaced = "replaced" // nonce 已被其它交易占用 (不是本服务的任何一次提交)
+	txStatusStuck    = "stuck"    // 已达到最大重发次数或 gas price 上限，仍在等待
+)
+
+// 中继交易状态变化时推送的事件 (WalletEvent.Type)
+const (
+	txEventMined     = "tx_mined"     // 已上链 (尚未达到确认数)
+	txEventFailed    = "tx_failed"    // 已上链但执行失败
+	txEventReplaced  = "tx_replaced"  // nonce 被其它交易占用
+	txEventReorged   = "tx_reorged"   // 所在区块被重组
+	txEventConfirmed = "tx_confirmed" // 达到配置的确认数，不再跟踪
+)
+
+// RetryConfig 未上链交易的提价重发
+type RetryConfig struct {
+	Window      int    `yaml:"window"`        // 广播后多少秒未上链则提价重发，0 为不重发
+	MaxAttempts int    `yaml:"max_attempts"`  // 最多广播次数 (含首次)，默认 5
+	BumpPercent int    `yaml:"bump_percent"`  // 每次提价百分比，默认 12 (节点要求至少 10%)
+	MaxGasPrice string `yaml:"max_gas_price"` // 提价上限 (wei)，留空表示不限
+}
+
+// TxSubmission 中继账户广播的一笔交易及其重发记录
+//
+// Hash 是首次广播的哈希，接口返回给调用方的也是它；提价重发后上链的可能是
+// Hashes 中的任一笔，按哪个哈希都能查到同一条记录。
+type TxSubmission struct {
+	Hash        string   `json:"hash"`
+	Hashes      []string `json:"hashes"` // 每次广播的哈希，最后一个是当前有效的替换交易
+	From        string   `json:"from"`
+	Nonce       uint64   `json:"nonce"`
+	GasPrice    string   `json:"gasPrice"` // 当前 gas price (wei)
+	Attempts    int      `json:"attempts"`
+	Status      string   `json:"status"`
+	MinedHash   string   `json:"minedHash,omitempty"` // 实际上链的哈希
+	BlockNumber uint64   `json:"blockNumber,omitempty"`
+	BlockHash   string   `json:"blockHash,omitempty"` // 所在区块，变化说明发生了重组
+	Error       string   `json:"error,omitempty"`
+	SubmittedAt int64    `json:"submittedAt"`
+	UpdatedAt   int64    `json:"updatedAt"`
+
+	AccessList    bool   `json:"accessList,omitempty"` // EIP-2930 交易 (gas.access_list)
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	Confirmed     bool   `json:"confirmed"` // 已达到配置的确认数 (confirmations 为 0 时上链即确认)，此后不再跟踪重组
+
+	tx          *types.Transaction // 最近一次广播的交易，重发时沿用其它字段
+	broadcastAt time.Time
+}
+
+// done 是否已有最终结果
+func (s *TxSubmission) done() bool {
+	return s.Status == txStatusMined || s.Status == txStatusFailed || s.Status == txStatusReplaced
+}
+
+// settled 已有最终结果且不再需要跟踪确认数
+func (s *TxSubmission) settled() bool {
+	return s.Status == txStatusReplaced || (s.done() && s.Confirmed)
+}
+
+// submissionQueue 跟踪中继账户广播的交易，超时未上链时用同一 nonce 提价重发
+type submissionQueue struct {
+	srv *Server
+
+	mu     sync.Mutex
+	byHash map[common.Hash]*TxSubmission // 任一次广播的哈希 -> 记录
+}
+
+func newSubmissionQueue(srv *Server) *submissionQueue {
+	return &submissionQueue{srv: srv, byHash: make(map[common.Hash]*TxSubmission)}
+}
+
+// track 登记即将广播的交易并写入交易日志，广播失败时调用方须调用 forget
+func (q *submissionQueue) track(from common.Address, tx *types.Transaction) {
+	now := time.Now()
+	sub := &TxSubmission{
+		Hash:        tx.Hash().Hex(),
+		Hashes:      []string{tx.Hash().Hex()},
+		From:        from.Hex(),
+		Nonce:       tx.Nonce(),
+		GasPrice:    tx.GasPrice().String(),
+		AccessList:  tx.Type() == types.AccessListTxType,
+		Attempts:    1,
+		Status:      txStatusPending,
+		SubmittedAt: now.Unix(),
+		UpdatedAt:   now.Unix(),
+		tx:          tx,
+		broadcastAt: now,
+	}
+	q.mu.Lock()
+	q.byHash[tx.Hash()] = sub
+	q.persistLocked(sub)
+	q.mu.Unlock()
+}
+
+// lookup 按任一次广播的哈希查询 (副本)
+func (q *submissionQueue) lookup(hash common.Hash) (TxSubmission, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	sub, ok := q.byHash[hash]
+	if !ok {
+		return TxSubmission{}, false
+	}
+	cp := *sub
+	cp.Hashes = append([]string(nil), sub.Hashes...)
+	return cp, true
+}
+
+// hashes 返回与 hash 属于同一笔提交的全部哈希，未跟踪时只有 hash 本身
+func (q *submissionQueue) hashes(hash common.Hash) []common.Hash {
+	sub, ok := q.lookup(hash)
+	if !ok {
+		return []common.Hash{hash}
+	}
+	out := make([]common.Hash, len(sub.Hashes))
+	for i, h := range sub.Hashes {
+		out[i] = common.HexToHash(h)
+	}
+	return out
+}
+
+// pending 返回仍需检查的记录，并清理结束已久的记录
+func (q *submissionQueue) pending(now time.Time) []*TxSubmission {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	seen := make(map[*TxSubmission]bool)
+	var list []*TxSubmission
+	for hash, sub := range q.byHash {
+		if sub.settled() {
+			if now.Sub(time.Unix(sub.UpdatedAt, 0)) > submissionKeep {
+				delete(q.byHash, hash)
+			}
+			continue
+		}
+		if !seen[sub] {
+			seen[sub] = true
+			list = append(list, sub)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Nonce < list[j].Nonce })
+	return list
+}
+
+// pendingCounts 各账户未结束 (pending / stuck) 的交易数
+func (q *submissionQueue) pendingCounts() map[common.Address]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	seen := make(map[*TxSubmission]bool)
+	counts := make(map[common.Address]int)
+	for _, sub := range q.byHash {
+		if sub.done() || seen[sub] {
+			continue
+		}
+		seen[sub] = true
+		counts[common.HexToAddress(sub.From)]++
+	}
+	return counts
+}
+
+// run 每个新区块 (未订阅时按 submissionPollInterval) 检查未结束的交易
+func (q *submissionQueue) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.srv.heads.next(submissionPollInterval):
+		}
+		now := time.Now()
+		for _, sub := range q.pending(now) {
+			q.check(ctx, sub, now)
+		}
+	}
+}
+
+// check 查询回执；超过重发窗口仍未上链时提价重发
+func (q *submissionQueue) check(ctx context.Context, sub *TxSubmission, now time.Time) {
+	q.mu.Lock()
+	hashes := append([]string(nil), sub.Hashes...)
+	tx, broadcastAt, attempts := sub.tx, sub.broadcastAt, sub.Attempts
+	from := common.HexToAddress(sub.From)
+	mined := sub.done()
+	q.mu.Unlock()
+
+	if mined {
+		q.confirm(ctx, sub)
+		return
+	}
+
+	findReceipt := func() bool {
+		for _, h := range hashes {
+			receipt, err := q.srv.eth().TransactionReceipt(ctx, common.HexToHash(h))
+			if err != nil {
+				continue
+			}
+			q.finish(sub, receiptStatus(receipt), h, receipt.BlockNumber.Uint64(), receipt.BlockHash.Hex(), "")
+			return true
+		}
+		return false
+	}
+	if findReceipt() {
+		q.confirm(ctx, sub)
+		return
+	}
+	// nonce 已被确认但不是我们的任何一笔: 被外部交易替换
+	// (回执可能在两次查询之间出现，确认前再查一次)
+	if confirmed, err := q.srv.eth().NonceAt(ctx, from, nil); err == nil && confirmed > tx.Nonce() {
+		if !findReceipt() {
+			q.finish(sub, txStatusReplaced, "", 0, "", "nonce 已被其它交易占用")
+		}
+		return
+	}
+
+	cfg := q.srv.Config().Retry
+	if cfg.Window <= 0 || now.Sub(broadcastAt) < time.Duration(cfg.Window)*time.Second {
+		return
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+	if attempts >= maxAttempts {
+		q.markStuck(sub, fmt.Sprintf("已重发 %d 次仍未上链", attempts))
+		return
+	}
+
+	replacement, err := q.bump(ctx, tx, from, cfg)
+	if err != nil {
+		q.markStuck(sub, err.Error())
+		return
+	}
+	if err := q.srv.broadcast(replacement); err != nil {
+		// 替换交易被拒绝 (如价格不足) 时等下一个窗口再试
+		q.mu.Lock()
+		sub.Error = err.Error()
+		sub.broadcastAt = now
+		sub.UpdatedAt = now.Unix()
+		q.persistLocked(sub)
+		q.mu.Unlock()
+		log.Printf("重发交易 %s (nonce %d) 失败: %v", sub.Hash, tx.Nonce(), err)
+		return
+	}
+
+	q.mu.Lock()
+	sub.tx = replacement
+	sub.Hashes = append(sub.Hashes, replacement.Hash().Hex())
+	sub.GasPrice = replacement.GasPrice().String()
+	sub.Attempts++
+	sub.Error = ""
+	sub.broadcastAt = now
+	sub.UpdatedAt = now.Unix()
+	q.byHash[replacement.Hash()] = sub
+	q.persistLocked(sub)
+	q.mu.Unlock()
+	log.Printf("交易 %s (nonce %d) 未在 %d 秒内上链，已提价重发: %s, gas price %s",
+		sub.Hash, tx.Nonce(), cfg.Window, replacement.Hash().Hex(), replacement.GasPrice())
+}
+
+// bump 用同一 nonce 与调用数据签名提价后的替换交易
+func (q *submissionQueue) bump(ctx context.Context, tx *types.Transaction, from common.Address, cfg RetryConfig) (*types.Transaction, error) {
+	r, ok := q.srv.relayers.lookup(from)
+	if !ok {
+		return nil, fmt.Errorf("中继私钥已更换，无法重发")
+	}
+	signer := r.signer()
+
+	percent := cfg.BumpPercent
+	if percent <= 0 {
+		percent = defaultRetryBumpPercent
+	}
+	gasPrice := new(big.Int).Mul(tx.GasPrice(), big.NewInt(int64(100+percent)))
+	gasPrice.Div(gasPrice, big.NewInt(100))
+	// 网络价格已经涨过提价幅度时直接用当前价格
+	if suggested, err := q.srv.gasPrice(ctx); err == nil && suggested.Cmp(gasPrice) > 0 {
+		gasPrice = suggested
+	}
+	if cfg.MaxGasPrice != "" {
+		limit, ok := new(big.Int).SetString(cfg.MaxGasPrice, 10)
+		if ok && gasPrice.Cmp(limit) > 0 {
+			return nil, fmt.Errorf("提价后的 gas price %s 超过上限 %s", gasPrice, limit)
+		}
+	}
+	if tx.To() == nil {
+		return nil, fmt.Errorf("合约创建交易不支持重发")
+	}
+	replacement := q.srv.newRelayTx(tx.Nonce(), *tx.To(), tx.Value(), tx.Gas(), gasPrice, tx.Data(), tx.AccessList())
+	if err := q.srv.checkFeeCaps(gasPrice, tx.Gas(), q.srv.l1CostOrZero(ctx, replacement).extraFee(), nil); err != nil {
+		return nil, err
+	}
+	signed, err := signer.SignTx(replacement, q.srv.chainID)
+	if err != nil {
+		return nil, fmt.Errorf("签名替换交易失败: %v", err)
+	}
+	return signed, nil
+}
+
+// receiptStatus 回执对应的交易状态
+func receiptStatus(receipt *types.Receipt) string {
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return txStatusFailed
+	}
+	return txStatusMined
+}
+
+// confirm 更新已上链交易的确认数，达到 confirmations 后才算最终确认并停止跟踪
+//
+// 确认前每个区块都重新查询回执: 回执消失 (所在区块被重组掉) 时回到 pending 重新等待上链；
+// 回执所在区块的哈希变化说明交易被重组后打包进了另一个区块，确认数从新区块重新计算。
+func (q *submissionQueue) confirm(ctx context.Context, sub *TxSubmission) {
+	q.mu.Lock()
+	minedHash := sub.MinedHash
+	q.mu.Unlock()
+
+	receipt, err := q.srv.eth().TransactionReceipt(ctx, common.HexToHash(minedHash))
+	if errors.Is(err, ethereum.NotFound) {
+		q.mu.Lock()
+		log.Printf("交易 %s 所在区块已被重组，重新等待上链", minedHash)
+		sub.Status, sub.MinedHash, sub.BlockNumber, sub.BlockHash = txStatusPending, "", 0, ""
+		sub.Confirmations, sub.Confirmed = 0, false
+		sub.broadcastAt = time.Now()
+		sub.UpdatedAt = time.Now().Unix()
+		q.persistLocked(sub)
+		snapshot := *sub
+		q.mu.Unlock()
+		q.srv.txStatusChanged(snapshot, txEventReorged, "所在区块已被重组，交易重新等待上链")
+		return
+	}
+	if err != nil {
+		return
+	}
+	head, err := q.srv.blockNumber(ctx)
+	if err != nil {
+		return
+	}
+
+	block := receipt.BlockNumber.Uint64()
+	blockHash := receipt.BlockHash.Hex()
+	var confirmations uint64
+	if head >= block {
+		confirmations = head - block + 1
+	}
+	q.mu.Lock()
+	reorged := sub.BlockHash != "" && sub.BlockHash != blockHash
+	if !reorged && confirmations == sub.Confirmations && block == sub.BlockNumber {
+		q.mu.Unlock()
+		return
+	}
+	if reorged {
+		log.Printf("交易 %s 所在区块已被重组，重新打包在区块 %d", minedHash, block)
+	}
+	wasConfirmed := sub.Confirmed
+	sub.Status = receiptStatus(receipt)
+	sub.BlockNumber, sub.BlockHash = block, blockHash
+	sub.Confirmations = confirmations
+	sub.Confirmed = confirmations >= q.srv.Config().Confirmations
+	sub.UpdatedAt = time.Now().Unix()
+	q.persistLocked(sub)
+	snapshot := *sub
+	q.mu.Unlock()
+
+	if reorged {
+		q.srv.txStatusChanged(snapshot, txEventReorged, fmt.Sprintf("交易被重组后重新打包在区块 %d", block))
+	}
+	if snapshot.Confirmed && !wasConfirmed {
+		q.srv.txStatusChanged(snapshot, txEventConfirmed, fmt.Sprintf("已达到 %d 个确认", confirmations))
+	}
+}
+
+func (q *submissionQueue) finish(sub *TxSubmission, status, minedHash string, block uint64, blockHash, reason string) {
+	q.mu.Lock()
+	sub.Status = status
+	sub.MinedHash = minedHash
+	sub.BlockNumber = block
+	sub.BlockHash = blockHash
+	sub.Error = reason
+	sub.UpdatedAt = time.Now().Unix()
+	q.persistLocked(sub)
+	snapshot := *sub
+	q.mu.Unlock()
+
+	switch status {
+	case txStatusMined:
+		q.srv.txStatusChanged(snapshot, txEventMined, fmt.Sprintf("已打包在区块 %d", block))
+	case txStatusFailed:
+		q.srv.txStatusChanged(snapshot, txEventFailed, fmt.Sprintf("已打包在区块 %d，执行失败", block))
+	case txStatusReplaced:
+		q.srv.txStatusChanged(snapshot, txEventReplaced, reason)
+	}
+}
+
+func (q *submissionQueue) markStuck(sub *TxSubmission, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if sub.Status != txStatusStuck {
+		log.Printf("交易 %s (nonce %d) 停止重发: %s", sub.Hash, sub.Nonce, reason)
+	}
+	sub.Status = txStatusStuck
+	sub.Error = reason
+	sub.UpdatedAt = time.Now().Unix()
+	q.persistLocked(sub)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// tokenListTTL 远程代币列表的缓存时间
+const tokenListTTL = 10 * time.Minute
+
+// TokenListConfig 前端可选的代币列表
+//
+//	token_list:
+//	  name: "Passkey Demo"
+//	  url: "https://tokens.example.com/list.json"   # tokenlists.org 格式，也可以是本地文件路径
+//	  tokens:                                        # 额外的代币，按字段覆盖 url 中同链同地址的条目
+//	    - chain_id: 11155111
+//	      address: "0xEca6..."
+//	      symbol: "TEST"
+//	      decimals: 18
+//	      logo_uri: "https://..."
+type TokenListConfig struct {
+	Name   string           `yaml:"name"`
+	URL    string           `yaml:"url"`
+	Tokens []TokenListEntry `yaml:"tokens"`
+}
+
+// TokenListEntry 配置中的代币，chain_id 留空为当前链；symbol / decimals 留空时从链上读取
+type TokenListEntry struct {
+	ChainID  int64  `yaml:"chain_id"`
+	Address  string `yaml:"address"`
+	Symbol   string `yaml:"symbol"`
+	Name     string `yaml:"name"`
+	Decimals *uint8 `yaml:"decimals"`
+	LogoURI  string `yaml:"logo_uri"`
+}
+
+// TokenInfo tokenlists.org 格式的代币条目
+type TokenInfo struct {
+	ChainID  int64  `json:"chainId"`
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Decimals uint8  `json:"decimals"`
+	LogoURI  string `json:"logoURI,omitempty"`
+}
+
+// TokenListData GET /api/tokens 返回数据
+type TokenListData struct {
+	Name    string      `json:"name"`
+	ChainID int64       `json:"chainId"`
+	Tokens  []TokenInfo `json:"tokens"`
+}
+
+// tokenList 缓存远程列表
+type tokenList struct {
+	srv    *Server
+	client *http.Client
+
+	mu        sync.Mutex
+	url       string
+	remote    []TokenInfo
+	fetchedAt time.Time
+}
+
+func newTokenList(srv *Server) *tokenList {
+	return &tokenList{srv: srv, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// load 读取 tokenlists.org 格式的列表 (http(s) 地址或本地文件)
+func (l *tokenList) load(url string) ([]TokenInfo, error) {
+	var (
+		raw []byte
+		err error
+	)
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		resp, err := l.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		if raw, err = io.ReadAll(io.LimitReader(resp.Body, 10<<20)); err != nil {
+			return nil, err
+		}
+	} else if raw, err = os.ReadFile(url); err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Tokens []TokenInfo `json:"tokens"`
+	}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("代币列表格式错误: %v", err)
+	}
+	return list.Tokens, nil
+}
+
+// remoteTokens 返回缓存的远程列表，过期后重新读取；读取失败时沿用旧列表
+func (l *tokenList) remoteTokens(url string) []TokenInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if url == "" {
+		return nil
+	}
+	if url == l.url && time.Since(l.fetchedAt) < tokenListTTL {
+		return l.remote
+	}
+	tokens, err := l.load(url)
+	if err != nil {
+		log.Printf("读取代币列表 %s 失败: %v", url, err)
+		if url != l.url {
+			return nil
+		}
+		l.fetchedAt = time.Now() // 失败后同样等待一个 TTL 再重试
+		return l.remote
+	}
+	l.url, l.remote, l.fetchedAt = url, tokens, time.Now()
+	return tokens
+}
+
+// tokens 返回指定链的代币: 远程列表在前，配置中的条目按字段覆盖同地址的远程条目
+func (l *tokenList) tokens(chainID int64) []TokenInfo {
+	cfg := l.srv.Config()
+	current := l.srv.chainID.Int64()
+	erc20, _ := abi.JSON(strings.NewReader(erc20ABI))
+
+	var out []TokenInfo
+	index := make(map[common.Address]int)
+	add := func(t TokenInfo) {
+		if t.ChainID != chainID || !common.IsHexAddress(t.Address) {
+			return
+		}
+		addr := common.HexToAddress(t.Address)
+		t.Address = addr.Hex()
+		if i, ok := index[addr]; ok {
+			out[i] = t
+			return
+		}
+		index[addr] = len(out)
+		out = append(out, t)
+	}
+
+	for _, t := range l.remoteTokens(cfg.TokenList.URL) {
+		add(t)
+	}
+	for _, e := range cfg.TokenList.Tokens {
+		if e.ChainID == 0 {
+			e.ChainID = current
+		}
+		if e.ChainID != chainID || !common.IsHexAddress(e.Address) {
+			continue
+		}
+		// 配置中留空的字段沿用远程列表的同一代币；不在远程列表中且缺 symbol / decimals 时读取链上 (仅限当前链)
+		t := TokenInfo{ChainID: e.ChainID, Address: e.Address}
+		if i, ok := index[common.HexToAddress(e.Address)]; ok {
+			t = out[i]
+		} else if e.ChainID == current && (e.Symbol == "" || e.Decimals == nil) {
+			meta := l.srv.getTokenMetadata(erc20, common.HexToAddress(e.Address))
+			t.Symbol, t.Decimals = meta.Symbol, meta.Decimals
+		}
+		if e.Symbol != "" {
+			t.Symbol = e.Symbol
+		}
+		if e.Name != "" {
+			t.Name = e.Name
+		}
+		if e.Decimals != nil {
+			t.Decimals = *e.Decimals
+		}
+		if e.LogoURI != "" {
+			t.LogoURI = e.LogoURI
+		}
+		if t.Name == "" {
+			t.Name = t.Symbol
+		}
+		add(t)
+	}
+	if out == nil {
+		out = []TokenInfo{}
+	}
+	return out
+}
+
+// handleTokens 代币列表 (tokenlists.org 格式)，前端据此选择代币
+//
+//	GET /api/tokens?chainId=11155111   chainId 默认为当前链
+func (srv *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	chainID := srv.chainID.Int64()
+	if v := r.URL.Query().Get("chainId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			sendError(w, "chainId 格式错误: "+v)
+			return
+		}
+		chainID = id
+	}
+
+	srv.cache.serveCached(w, r, cacheKeyTokens+"/"+strconv.FormatInt(chainID, 10), func() (interface{}, error) {
+		name := srv.Config().TokenList.Name
+		if name == "" {
+			name = "secp256R1-demo"
+		}
+		return APIResponse{
+			Success: true,
+			Data: TokenListData{
+				Name:    name,
+				ChainID: chainID,
+				Tokens:  srv.tokenList.tokens(chainID),
+			},
+		}, nil
+	})
+}
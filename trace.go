@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 上链追踪标签: "trc1" ++ 8 字节请求 ID，附加在钱包调用数据之后
+// Solidity 解码会忽略 ABI 参数之后的多余字节，不影响执行
+const (
+	traceTagMagic = "trc1"
+	traceIDBytes  = 8
+)
+
+var traceIDPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// requestIDs 为每个 /api/ 请求分配追踪 ID，写入请求与响应的 X-Request-ID 头
+//
+// 客户端提供 16 位十六进制 X-Request-ID 时直接沿用，提供其他格式时取其 keccak256 前 8 字节；
+// 未提供时取 keccak256(method, path, body) 前 8 字节，可由审计日志中的原始请求重新计算。
+func (srv *Server) requestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/events" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id := strings.ToLower(r.Header.Get("X-Request-ID"))
+		switch {
+		case traceIDPattern.MatchString(id):
+		case id != "":
+			id = hex.EncodeToString(crypto.Keccak256([]byte(id))[:traceIDBytes])
+		default:
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			id = hex.EncodeToString(crypto.Keccak256([]byte(r.Method), []byte(r.URL.Path), body)[:traceIDBytes])
+		}
+
+		r.Header.Set("X-Request-ID", id)
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDFrom 读取 requestIDs 分配的追踪 ID
+func requestIDFrom(r *http.Request) string {
+	return r.Header.Get("X-Request-ID")
+}
+
+// appendTraceTag 在调用数据末尾附加追踪标签，id 不是 16 位十六进制时原样返回
+func appendTraceTag(data []byte, id string) []byte {
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != traceIDBytes {
+		return data
+	}
+	return append(append(data, traceTagMagic...), raw...)
+}
+
+// extractTraceTags 在交易 input 中查找追踪标签
+// 4337 / 批量交易中标签位于内层 calldata，按魔数扫描
+func extractTraceTags(input []byte) []string {
+	var ids []string
+	magic := []byte(traceTagMagic)
+	for i := 0; ; {
+		j := bytes.Index(input[i:], magic)
+		if j < 0 {
+			break
+		}
+		start := i + j + len(magic)
+		if start+traceIDBytes > len(input) {
+			break
+		}
+		ids = append(ids, hex.EncodeToString(input[start:start+traceIDBytes]))
+		i = start + traceIDBytes
+	}
+	return ids
+}
+
+// TraceData /api/trace 返回数据
+type TraceData struct {
+	TxHash     string   `json:"txHash"`
+	RequestIDs []string `json:"requestIds"`
+}
+
+// handleTrace 从交易 input 中解析请求追踪 ID，用于争议时关联审计日志
+func (srv *Server) handleTrace(w http.ResponseWriter, r *http.Request) {
+	txParam := r.URL.Query().Get("tx")
+	if len(common.FromHex(txParam)) != common.HashLength {
+		sendError(w, "tx 必须是交易哈希")
+		return
+	}
+	txHash := common.HexToHash(txParam)
+	tx, _, err := srv.eth().TransactionByHash(context.Background(), txHash)
+	if err != nil {
+		sendError(w, "查询交易失败: "+err.Error())
+		return
+	}
+
+	ids := extractTraceTags(tx.Data())
+	if ids == nil {
+		ids = []string{}
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    TraceData{TxHash: txHash.Hex(), RequestIDs: ids},
+	})
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	defaultTreasuryInterval = 60 // 秒
+	treasuryAlertInterval   = time.Hour
+	treasuryTransferGas     = 21000
+)
+
+// TreasuryConfig 中继账户自动充值配置
+type TreasuryConfig struct {
+	PrivateKey  string `yaml:"private_key"`  // treasury EOA 私钥，留空则禁用自动充值
+	MinBalance  string `yaml:"min_balance"`  // 中继账户余额低于该值 (wei) 时充值
+	TopUpAmount string `yaml:"topup_amount"` // 每次充值金额 (wei)
+	MaxPerDay   string `yaml:"max_per_day"`  // 每天最多充值总额 (wei)，留空表示不限
+	Interval    int    `yaml:"interval"`     // 检查间隔 (秒)，默认 60
+}
+
+// treasury 监控中继账户余额，不足时从 treasury 账户转入 ETH
+type treasury struct {
+	srv *Server
+
+	mu      sync.Mutex
+	pending common.Hash          // 尚未确认的充值交易，确认前不再充值
+	alerted map[string]time.Time // 告警类型 -> 上次发送时间，避免重复告警
+}
+
+func newTreasury(srv *Server) *treasury {
+	return &treasury{srv: srv, alerted: make(map[string]time.Time)}
+}
+
+// config 解析配置，未配置或格式错误时 ok 为 false
+func (t *treasury) config() (cfg TreasuryConfig, key Signer, minBalance, amount *big.Int, ok bool) {
+	cfg = t.srv.Config().Treasury
+	if cfg.PrivateKey == "" {
+		return cfg, nil, nil, nil, false
+	}
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(cfg.PrivateKey, "0x"))
+	if err != nil {
+		log.Printf("treasury private_key 格式错误: %v", err)
+		return cfg, nil, nil, nil, false
+	}
+	minBalance, ok1 := new(big.Int).SetString(cfg.MinBalance, 10)
+	amount, ok2 := new(big.Int).SetString(cfg.TopUpAmount, 10)
+	if !ok1 || !ok2 || amount.Sign() <= 0 {
+		log.Printf("treasury min_balance / topup_amount 格式错误")
+		return cfg, nil, nil, nil, false
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultTreasuryInterval
+	}
+	return cfg, newKeySigner(privateKey), minBalance, amount, true
+}
+
+// run 定期检查中继账户余额
+func (t *treasury) run(ctx context.Context) {
+	cfg, _, _, _, ok := t.config()
+	if !ok {
+		return
+	}
+	log.Printf("已启用中继账户自动充值，每 %d 秒检查一次", cfg.Interval)
+
+	ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		if err := t.check(ctx); err != nil {
+			t.alert("topup_failed", fmt.Sprintf("中继账户自动充值失败: %v", err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check 余额低于阈值时充值一次
+func (t *treasury) check(ctx context.Context) error {
+	cfg, key, minBalance, amount, ok := t.config()
+	relayerSigner := t.srv.signer()
+	if !ok || relayerSigner == nil {
+		return nil
+	}
+	relayer := relayerSigner.Address()
+	from := key.Address()
+
+	t.mu.Lock()
+	pending := t.pending
+	t.mu.Unlock()
+	if pending != (common.Hash{}) {
+		if _, err := t.srv.eth().TransactionReceipt(ctx, pending); errors.Is(err, ethereum.NotFound) {
+			return nil
+		}
+		t.mu.Lock()
+		t.pending = common.Hash{}
+		t.mu.Unlock()
+	}
+
+	balance, err := t.srv.eth().BalanceAt(ctx, relayer, nil)
+	if err != nil {
+		return fmt.Errorf("查询中继账户余额失败: %v", err)
+	}
+	if balance.Cmp(minBalance) >= 0 {
+		return nil
+	}
+
+	used := t.usedToday()
+	if cfg.MaxPerDay != "" {
+		limit, ok := new(big.Int).SetString(cfg.MaxPerDay, 10)
+		if ok && new(big.Int).Add(used, amount).Cmp(limit) > 0 {
+			t.alert("daily_cap", fmt.Sprintf("中继账户余额 %s wei 低于阈值，但今日充值已达上限 %s wei", balance, limit))
+			return nil
+		}
+	}
+
+	gasPrice, err := t.srv.gasPrice(ctx)
+	if err != nil {
+		return err
+	}
+	treasuryBalance, err := t.srv.eth().BalanceAt(ctx, from, nil)
+	if err != nil {
+		return fmt.Errorf("查询 treasury 余额失败: %v", err)
+	}
+	need := new(big.Int).Add(amount, new(big.Int).Mul(gasPrice, big.NewInt(treasuryTransferGas)))
+	if treasuryBalance.Cmp(need) < 0 {
+		t.alert("treasury_low", fmt.Sprintf("treasury %s 余额 %s wei 不足以充值 %s wei", from.Hex(), treasuryBalance, amount))
+		return nil
+	}
+
+	nonce, err := t.srv.eth().PendingNonceAt(ctx, from)
+	if err != nil {
+		return fmt.Errorf("获取 treasury nonce 失败: %v", err)
+	}
+	txHash, err := t.srv.signAndSend(key, nonce, relayer, amount, nil)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.pending = txHash
+	t.mu.Unlock()
+	t.recordUsage(new(big.Int).Add(used, amount))
+
+	log.Printf("中继账户余额 %s wei 低于阈值，已从 treasury 充值 %s wei: %s", balance, amount, txHash.Hex())
+	t.notify(WalletEvent{
+		Type:      "relayer_topup",
+		Wallet:    relayer.Hex(),
+		From:      from.Hex(),
+		To:        relayer.Hex(),
+		Amount:    amount.String(),
+		TxHash:    txHash.Hex(),
+		Timestamp: time.Now().Unix(),
+	})
+	return nil
+}
+
+// alert 记录并向运营方 webhook 发送告警，同类告警每小时最多一次
+func (t *treasury) alert(kind, message string) {
+	log.Println(message)
+
+	t.mu.Lock()
+	last, seen := t.alerted[kind]
+	if seen && time.Since(last) < treasuryAlertInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.alerted[kind] = time.Now()
+	t.mu.Unlock()
+
+	t.notify(WalletEvent{Type: "treasury_alert", Message: message, Timestamp: time.Now().Unix()})
+}
+
+// notify 只投递给运营方 webhook，不进入面向钱包的 SSE
+func (t *treasury) notify(ev WalletEvent) {
+	for _, url := range t.srv.Config().Webhooks {
+		go t.srv.notifier.postWebhook(url, ev)
+	}
+}
+
+func (t *treasury) usedToday() *big.Int {
+	var used string
+	getJSON(t.srv.storage, nsPolicies, treasuryUsageKey(), &used)
+	v, ok := new(big.Int).SetString(used, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return v
+}
+
+func (t *treasury) recordUsage(total *big.Int) {
+	if err := putJSON(t.srv.storage, nsPolicies, treasuryUsageKey(), total.String(), 48*time.Hour); err != nil {
+		log.Printf("记录 treasury 充值用量失败: %v", err)
+	}
+}
+
+func treasuryUsageKey() string {
+	return "treasury/" + time.Now().UTC().Format("2006-01-02")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// txJournalEntry 持久化的中继交易 (nsPendingTx，key = 首次广播的哈希)
+//
+// 广播前写入，之后每次重发 / 状态变化都会更新；结束后保留 submissionKeep 供查询。
+// RawTx 是最近一次签名的交易，调用数据中带有用户签名，重启后可以原样重新广播。
+type txJournalEntry struct {
+	TxSubmission
+	RawTx string `json:"rawTx"`
+}
+
+// persistLocked 把记录写入存储，调用方持有 q.mu
+func (q *submissionQueue) persistLocked(sub *TxSubmission) {
+	raw, err := sub.tx.MarshalBinary()
+	if err != nil {
+		log.Printf("交易日志编码失败 %s: %v", sub.Hash, err)
+		return
+	}
+	var ttl time.Duration
+	if sub.done() {
+		ttl = submissionKeep
+	}
+	entry := txJournalEntry{TxSubmission: *sub, RawTx: hexutil.Encode(raw)}
+	if err := putJSON(q.srv.storage, nsPendingTx, sub.Hash, entry, ttl); err != nil {
+		log.Printf("写入交易日志失败 %s: %v", sub.Hash, err)
+	}
+}
+
+// forget 广播失败的交易不再跟踪
+func (q *submissionQueue) forget(hash common.Hash) {
+	q.mu.Lock()
+	delete(q.byHash, hash)
+	q.mu.Unlock()
+	if _, err := q.srv.storage.Delete(nsPendingTx, hash.Hex()); err != nil {
+		log.Printf("删除交易日志失败 %s: %v", hash.Hex(), err)
+	}
+}
+
+// restore 启动时从日志恢复跟踪记录，并按 nonce 顺序重新广播未结束的交易
+//
+// 节点重启或交易被挤出交易池后，这些交易不重新广播就会永久卡住后续 nonce；
+// 已上链或 nonce 已被占用的交易广播会被节点拒绝，由 check 随后更新状态。
+func (q *submissionQueue) restore(ctx context.Context) {
+	kvs, err := q.srv.storage.List(nsPendingTx, "")
+	if err != nil {
+		log.Printf("读取交易日志失败: %v", err)
+		return
+	}
+
+	var pending []*TxSubmission
+	q.mu.Lock()
+	for _, kv := range kvs {
+		var entry txJournalEntry
+		if err := json.Unmarshal(kv.Value, &entry); err != nil {
+			log.Printf("交易日志 %s 解析失败: %v", kv.Key, err)
+			continue
+		}
+		raw, err := hexutil.Decode(entry.RawTx)
+		tx := new(types.Transaction)
+		if err == nil {
+			err = tx.UnmarshalBinary(raw)
+		}
+		if err != nil {
+			log.Printf("交易日志 %s 中的交易无法解码: %v", kv.Key, err)
+			continue
+		}
+
+		sub := entry.TxSubmission
+		sub.tx = tx
+		sub.broadcastAt = time.Now()
+		restored := &sub
+		for _, h := range sub.Hashes {
+			q.byHash[common.HexToHash(h)] = restored
+		}
+		if !sub.done() {
+			pending = append(pending, restored)
+		}
+	}
+	q.mu.Unlock()
+
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].From != pending[j].From {
+			return pending[i].From < pending[j].From
+		}
+		return pending[i].Nonce < pending[j].Nonce
+	})
+	for _, sub := range pending {
+		if err := q.srv.eth().SendTransaction(ctx, sub.tx); err != nil && !isNonceError(err) {
+			log.Printf("重新广播交易 %s (nonce %d) 失败: %v", sub.Hash, sub.Nonce, err)
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("从交易日志恢复 %d 笔未上链的交易并重新广播", len(pending))
+	}
+}
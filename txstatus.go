@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	defaultConfirmationTimeout = 120         // 秒
+	confirmationPollInterval   = time.Second // 未订阅新区块时的轮询间隔
+)
+
+// TxStatusData /api/tx/{hash} 返回数据
+type TxStatusData struct {
+	Hash          string `json:"hash"`
+	Status        string `json:"status"`              // pending / mined / failed (跟踪中的交易还可能是 replaced / stuck)
+	MinedHash     string `json:"minedHash,omitempty"` // 实际上链的哈希 (提价重发时可能与 hash 不同)
+	BlockNumber   uint64 `json:"blockNumber,omitempty"`
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	GasUsed       uint64 `json:"gasUsed,omitempty"`
+	GasPrice      string `json:"gasPrice,omitempty"` // 实际支付的 gas price (wei)
+	Fee           string `json:"fee,omitempty"`      // gasUsed * gasPrice (wei)
+	RevertReason  string `json:"revertReason,omitempty"`
+	AccessList    bool   `json:"accessList"` // 是否为带 access list 的 EIP-2930 交易
+
+	Submission *TxSubmission `json:"submission,omitempty"` // 本服务广播的交易附带重发记录
+}
+
+// txStatus 查询交易状态；本服务广播过的交易会同时检查全部替换交易
+func (srv *Server) txStatus(ctx context.Context, hash common.Hash) (*TxStatusData, error) {
+	data := &TxStatusData{Hash: hash.Hex()}
+	if sub, ok := srv.submissions.lookup(hash); ok {
+		data.Submission = &sub
+	}
+
+	for _, h := range srv.submissions.hashes(hash) {
+		// 没有回执 (含节点仍在建立交易索引) 时继续查下一个哈希
+		receipt, err := srv.eth().TransactionReceipt(ctx, h)
+		if err != nil {
+			srv.rpc.reportError(err)
+			continue
+		}
+		data.Status = txStatusMined
+		data.MinedHash = h.Hex()
+		data.BlockNumber = receipt.BlockNumber.Uint64()
+		data.GasUsed = receipt.GasUsed
+		data.AccessList = receipt.Type == types.AccessListTxType
+		if receipt.EffectiveGasPrice != nil {
+			data.GasPrice = receipt.EffectiveGasPrice.String()
+			data.Fee = new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed)).String()
+		}
+		if head, err := srv.blockNumber(ctx); err == nil && head >= data.BlockNumber {
+			data.Confirmations = head - data.BlockNumber + 1
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			data.Status = txStatusFailed
+			data.RevertReason = srv.replayRevert(ctx, h, receipt.BlockNumber)
+		}
+		if data.Submission != nil {
+			// 后台检查可能还没轮到这笔交易
+			data.Submission.Status = data.Status
+		}
+		return data, nil
+	}
+
+	if data.Submission != nil {
+		data.Status = data.Submission.Status
+		data.AccessList = data.Submission.AccessList
+		return data, nil
+	}
+	// 节点知道这笔交易但还没有回执: 在交易池中 (或刚打包、回执尚未索引)
+	tx, _, err := srv.eth().TransactionByHash(ctx, hash)
+	if err != nil {
+		srv.rpc.reportError(err)
+		return nil, err
+	}
+	data.Status = txStatusPending
+	data.AccessList = tx.Type() == types.AccessListTxType
+	return data, nil
+}
+
+// awaitConfirmations 等待交易达到 depth 个确认或执行失败
+//
+// 超时 (confirmation_timeout) 或请求取消时返回最近一次查到的状态与错误，交易仍由后台继续跟踪。
+func (srv *Server) awaitConfirmations(ctx context.Context, hash common.Hash, depth uint64) (*TxStatusData, error) {
+	timeout := srv.Config().ConfirmationTimeout
+	if timeout <= 0 {
+		timeout = defaultConfirmationTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	var last *TxStatusData
+	for {
+		if data, err := srv.txStatus(ctx, hash); err == nil {
+			last = data
+			switch {
+			case data.Status == txStatusFailed, data.Status == txStatusReplaced:
+				return data, nil
+			case data.Status == txStatusMined && data.Confirmations >= depth:
+				return data, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			if last == nil {
+				last = &TxStatusData{Hash: hash.Hex(), Status: txStatusPending}
+			}
+			return last, fmt.Errorf("%d 秒内未达到 %d 个确认", timeout, depth)
+		case <-srv.heads.next(confirmationPollInterval):
+		}
+	}
+}
+
+// replayRevert 在交易所在区块的父状态上重放调用，解析 revert 原因
+// (同一区块中排在前面的交易可能影响结果，重放成功时返回空)
+func (srv *Server) replayRevert(ctx context.Context, hash common.Hash, block *big.Int) string {
+	tx, _, err := srv.eth().TransactionByHash(ctx, hash)
+	if err != nil {
+		return ""
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(srv.chainID), tx)
+	if err != nil {
+		return ""
+	}
+	msg := ethereum.CallMsg{From: from, To: tx.To(), Gas: tx.Gas(), Value: tx.Value(), Data: tx.Data()}
+	parent := new(big.Int).Sub(block, big.NewInt(1))
+	if _, err := srv.eth().CallContract(ctx, msg, parent); err != nil {
+		return decodeRevert(err)
+	}
+	return ""
+}
+
+// handleTxStatus 查询交易状态、gas 消耗与 revert 原因
+//
+//	GET /api/tx/{hash}
+func (srv *Server) handleTxStatus(w http.ResponseWriter, r *http.Request) {
+	hash, err := parseBytes32(r.PathValue("hash"))
+	if err != nil {
+		sendError(w, "交易哈希格式错误")
+		return
+	}
+	data, err := srv.txStatus(r.Context(), common.Hash(hash))
+	if errors.Is(err, ethereum.NotFound) {
+		sendError(w, "未找到该交易")
+		return
+	}
+	if err != nil {
+		sendError(w, "查询交易失败: "+err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    data,
+	})
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// 支持实现合约指针的工厂 (clone 工厂用 setImplementation，beacon 用 upgradeTo)
+// 当前 PasskeyWalletFactory 直接 new PasskeyWallet，没有实现指针
+const upgradeableFactoryABI = `[
+	{
+		"inputs": [],
+		"name": "implementation",
+		"outputs": [{"type": "address"}],
+		"stateMutability": "view",
+		"type": "function"
+	},
+	{
+		"inputs": [{"name": "newImplementation", "type": "address"}],
+		"name": "setImplementation",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [{"name": "newImplementation", "type": "address"}],
+		"name": "upgradeTo",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	}
+]`
+
+// UpgradeOptions 升级命令参数
+type UpgradeOptions struct {
+	Artifact string // 编译产物 (solc / foundry / hardhat JSON)
+	Impl     string // 实现合约地址
+	Factory  string // 工厂地址，默认为配置中的 contract
+	DryRun   bool   // 只打印变更，不发送交易
+}
+
+// contractArtifact 编译产物中用到的字段
+type contractArtifact struct {
+	ABI      abi.ABI
+	Bytecode []byte
+}
+
+// loadArtifact 读取编译产物，bytecode 兼容字符串与 {"object": ...} 两种格式
+func loadArtifact(filename string) (*contractArtifact, error) {
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		ABI      json.RawMessage `json:"abi"`
+		Bytecode json.RawMessage `json:"bytecode"`
+	}
+	if err := json.Unmarshal(file, &raw); err != nil {
+		return nil, fmt.Errorf("解析编译产物失败: %v", err)
+	}
+
+	parsed, err := abi.JSON(bytes.NewReader(raw.ABI))
+	if err != nil {
+		return nil, fmt.Errorf("解析 ABI 失败: %v", err)
+	}
+
+	var code string
+	if err := json.Unmarshal(raw.Bytecode, &code); err != nil {
+		var obj struct {
+			Object string `json:"object"`
+		}
+		if err := json.Unmarshal(raw.Bytecode, &obj); err != nil {
+			return nil, fmt.Errorf("解析 bytecode 失败: %v", err)
+		}
+		code = obj.Object
+	}
+	if !strings.HasPrefix(code, "0x") {
+		code = "0x" + code
+	}
+	bytecode, err := hexutil.Decode(code)
+	if err != nil {
+		return nil, fmt.Errorf("bytecode 格式错误: %v", err)
+	}
+
+	return &contractArtifact{ABI: parsed, Bytecode: bytecode}, nil
+}
+
+// diffABI 按函数/事件签名比较两份 ABI，返回 "+ 新增" / "- 删除" 行
+func diffABI(oldABI, newABI abi.ABI) []string {
+	signatures := func(a abi.ABI) map[string]bool {
+		sigs := make(map[string]bool)
+		for _, m := range a.Methods {
+			sigs["function "+m.Sig] = true
+		}
+		for _, e := range a.Events {
+			sigs["event "+e.Sig] = true
+		}
+		return sigs
+	}
+	oldSigs, newSigs := signatures(oldABI), signatures(newABI)
+
+	var lines []string
+	for sig := range oldSigs {
+		if !newSigs[sig] {
+			lines = append(lines, "- "+sig)
+		}
+	}
+	for sig := range newSigs {
+		if !oldSigs[sig] {
+			lines = append(lines, "+ "+sig)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+	return lines
+}
+
+// missingSelectors 返回 runtime code 中找不到的后端所需函数
+// solc 的函数分发表用 PUSH4 selector，按 0x63 ++ selector 查找
+func missingSelectors(code []byte, required abi.ABI) []string {
+	var missing []string
+	for _, m := range required.Methods {
+		if !bytes.Contains(code, append([]byte{0x63}, m.ID...)) {
+			missing = append(missing, m.Sig)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// deployContract 由中继账户发送合约创建交易
+func (srv *Server) deployContract(bytecode []byte) (common.Hash, common.Address, error) {
+	s := srv.signer()
+	if s == nil {
+		return common.Hash{}, common.Address{}, fmt.Errorf("未配置私钥")
+	}
+	from := s.Address()
+	ctx := context.Background()
+
+	gasPrice, err := srv.gasPrice(ctx)
+	if err != nil {
+		return common.Hash{}, common.Address{}, err
+	}
+	gasLimit, err := srv.eth().EstimateGas(ctx, ethereum.CallMsg{From: from, Data: bytecode})
+	if err != nil {
+		return common.Hash{}, common.Address{}, fmt.Errorf("估算部署 gas 失败: %v", decodeRevert(err))
+	}
+	l1 := srv.l1CostOrZero(ctx, types.NewContractCreation(0, big.NewInt(0), gasLimit, gasPrice, bytecode))
+	if err := srv.checkFeeCaps(gasPrice, gasLimit, l1.extraFee(), nil); err != nil {
+		return common.Hash{}, common.Address{}, err
+	}
+	nonce, err := srv.nonces.reserve()
+	if err != nil {
+		return common.Hash{}, common.Address{}, err
+	}
+
+	tx := types.NewContractCreation(nonce, big.NewInt(0), gasLimit, gasPrice, bytecode)
+	signedTx, err := s.SignTx(tx, srv.chainID)
+	if err == nil {
+		err = srv.eth().SendTransaction(ctx, signedTx)
+	}
+	srv.nonces.complete(nonce, err)
+	if err != nil {
+		return common.Hash{}, common.Address{}, fmt.Errorf("发送交易失败: %v", err)
+	}
+	return signedTx.Hash(), crypto.CreateAddress(from, nonce), nil
+}
+
+// waitReceipt 轮询交易回执，最多等待 3 分钟 (提价重发的替换交易也算)
+func (srv *Server) waitReceipt(txHash common.Hash) (*types.Receipt, error) {
+	deadline := time.Now().Add(3 * time.Minute)
+	for time.Now().Before(deadline) {
+		for _, h := range srv.submissions.hashes(txHash) {
+			receipt, err := srv.eth().TransactionReceipt(context.Background(), h)
+			if err != nil {
+				continue
+			}
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				return receipt, fmt.Errorf("交易执行失败: %s", h.Hex())
+			}
+			return receipt, nil
+		}
+		<-srv.heads.next(3 * time.Second)
+	}
+	return nil, fmt.Errorf("等待交易上链超时: %s", txHash.Hex())
+}
+
+// factoryImplementation 读取工厂当前的实现合约地址
+func (srv *Server) factoryImplementation(factory common.Address) (common.Address, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(upgradeableFactoryABI))
+	data, _ := parsedABI.Pack("implementation")
+	out, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &factory, Data: data}, nil)
+	if err != nil || len(out) == 0 {
+		return common.Address{}, fmt.Errorf("工厂 %s 不支持 implementation()，无法升级 (直接部署钱包的工厂不是 clone/beacon 工厂)", factory.Hex())
+	}
+	var impl common.Address
+	if err := parsedABI.UnpackIntoInterface(&impl, "implementation", out); err != nil {
+		return common.Address{}, fmt.Errorf("解析实现地址失败: %v", err)
+	}
+	return impl, nil
+}
+
+// upgradeCallData 依次用 eth_call 探测 setImplementation / upgradeTo，返回第一个不回滚的调用数据
+func (srv *Server) upgradeCallData(factory, impl common.Address) ([]byte, string, error) {
+	s := srv.signer()
+	if s == nil {
+		return nil, "", fmt.Errorf("未配置私钥")
+	}
+	from := s.Address()
+
+	parsedABI, _ := abi.JSON(strings.NewReader(upgradeableFactoryABI))
+	var lastErr error
+	for _, method := range []string{"setImplementation", "upgradeTo"} {
+		data, _ := parsedABI.Pack(method, impl)
+		_, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{From: from, To: &factory, Data: data}, nil)
+		if err == nil {
+			return data, method, nil
+		}
+		lastErr = fmt.Errorf("%s: %s", method, decodeRevert(err))
+	}
+	return nil, "", fmt.Errorf("工厂拒绝更新实现合约 (中继账户是否为 owner?): %v", lastErr)
+}
+
+// verifyImplementation 检查实现合约是否包含后端调用的全部函数
+func (srv *Server) verifyImplementation(impl common.Address) error {
+	code, err := srv.eth().CodeAt(context.Background(), impl, nil)
+	if err != nil {
+		return fmt.Errorf("读取合约代码失败: %v", err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("%s 未部署合约", impl.Hex())
+	}
+
+	required, _ := abi.JSON(strings.NewReader(walletABI))
+	if missing := missingSelectors(code, required); len(missing) > 0 {
+		return fmt.Errorf("实现合约缺少后端所需函数: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// runUpgrade 合约升级命令: deploy-impl / set-impl / verify-impl
+func runUpgrade(srv *Server, action string, opts UpgradeOptions) error {
+	if opts.Factory == "" {
+		opts.Factory = srv.Config().Contract
+	}
+
+	switch action {
+	case "deploy-impl":
+		if opts.Artifact == "" {
+			return fmt.Errorf("需要 -artifact 指定编译产物")
+		}
+		artifact, err := loadArtifact(opts.Artifact)
+		if err != nil {
+			return err
+		}
+		current, _ := abi.JSON(strings.NewReader(walletABI))
+		fmt.Println("ABI 变更 (相对后端使用的 walletABI):")
+		printLines(diffABI(current, artifact.ABI))
+		if opts.DryRun {
+			fmt.Println("dry-run: 未发送部署交易")
+			return nil
+		}
+
+		txHash, addr, err := srv.deployContract(artifact.Bytecode)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("部署交易: %s\n", txHash.Hex())
+		if _, err := srv.waitReceipt(txHash); err != nil {
+			return err
+		}
+		fmt.Printf("新实现合约: %s\n", addr.Hex())
+		return srv.verifyImplementation(addr)
+
+	case "set-impl":
+		if !common.IsHexAddress(opts.Impl) || !common.IsHexAddress(opts.Factory) {
+			return fmt.Errorf("需要 -impl 与工厂地址")
+		}
+		factory, impl := common.HexToAddress(opts.Factory), common.HexToAddress(opts.Impl)
+		current, err := srv.factoryImplementation(factory)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("工厂 %s 实现合约: %s → %s\n", factory.Hex(), current.Hex(), impl.Hex())
+		if err := srv.verifyImplementation(impl); err != nil {
+			return err
+		}
+
+		data, method, err := srv.upgradeCallData(factory, impl)
+		if err != nil {
+			return err
+		}
+		if opts.DryRun {
+			fmt.Printf("dry-run: 将调用 %s(%s)，未发送交易\n", method, impl.Hex())
+			return nil
+		}
+		txHash, err := srv.sendTransaction(factory, big.NewInt(0), data)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("升级交易: %s\n", txHash.Hex())
+		if _, err := srv.waitReceipt(txHash); err != nil {
+			return err
+		}
+		return runUpgrade(srv, "verify-impl", UpgradeOptions{Impl: impl.Hex(), Factory: factory.Hex()})
+
+	case "verify-impl":
+		impl := common.HexToAddress(opts.Impl)
+		if !common.IsHexAddress(opts.Impl) {
+			// 未指定时检查工厂当前指向的实现
+			current, err := srv.factoryImplementation(common.HexToAddress(opts.Factory))
+			if err != nil {
+				return err
+			}
+			impl = current
+		} else if common.IsHexAddress(opts.Factory) {
+			if current, err := srv.factoryImplementation(common.HexToAddress(opts.Factory)); err == nil && current != impl {
+				return fmt.Errorf("工厂仍指向 %s，而不是 %s", current.Hex(), impl.Hex())
+			}
+		}
+		if err := srv.verifyImplementation(impl); err != nil {
+			return err
+		}
+		fmt.Printf("实现合约 %s 校验通过: 后端所需函数齐全\n", impl.Hex())
+		return nil
+	}
+	return fmt.Errorf("未知升级操作: %s", action)
+}
+
+func printLines(lines []string) {
+	if len(lines) == 0 {
+		fmt.Println("  (无变更)")
+		return
+	}
+	for _, line := range lines {
+		fmt.Println("  " + line)
+	}
+}
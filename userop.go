@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 中继模式
+const (
+	relayModeEOA      = "eoa"                                        // 中继 EOA 直接发送交易 (默认)
+	relayModeUserOp   = "4337"                                       // 封装为 ERC-4337 UserOperation 提交给 bundler
+	defaultEntryPoint = "0x0000000071727De22E5E9d8BAf0edAc6f37da032" // EntryPoint v0.7
+)
+
+// AAConfig ERC-4337 配置
+type AAConfig struct {
+	BundlerRPC string `yaml:"bundler_rpc"` // bundler JSON-RPC 地址，留空时由本服务自建 bundler
+	EntryPoint string `yaml:"entry_point"` // EntryPoint 合约地址，默认 v0.7
+}
+
+// UserOperation ERC-4337 v0.7 UserOperation (bundler RPC 的非打包格式)
+type UserOperation struct {
+	Sender                        common.Address
+	Nonce                         *big.Int
+	Factory                       *common.Address
+	FactoryData                   []byte
+	CallData                      []byte
+	CallGasLimit                  *big.Int
+	VerificationGasLimit          *big.Int
+	PreVerificationGas            *big.Int
+	MaxFeePerGas                  *big.Int
+	MaxPriorityFeePerGas          *big.Int
+	Paymaster                     *common.Address
+	PaymasterVerificationGasLimit *big.Int
+	PaymasterPostOpGasLimit       *big.Int
+	PaymasterData                 []byte
+	Signature                     []byte
+}
+
+// MarshalJSON 按 bundler RPC 约定输出十六进制字段
+func (op *UserOperation) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{
+		"sender":               op.Sender,
+		"nonce":                (*hexutil.Big)(op.Nonce),
+		"callData":             hexutil.Bytes(op.CallData),
+		"callGasLimit":         (*hexutil.Big)(op.CallGasLimit),
+		"verificationGasLimit": (*hexutil.Big)(op.VerificationGasLimit),
+		"preVerificationGas":   (*hexutil.Big)(op.PreVerificationGas),
+		"maxFeePerGas":         (*hexutil.Big)(op.MaxFeePerGas),
+		"maxPriorityFeePerGas": (*hexutil.Big)(op.MaxPriorityFeePerGas),
+		"signature":            hexutil.Bytes(op.Signature),
+	}
+	if op.Factory != nil {
+		m["factory"] = op.Factory
+		m["factoryData"] = hexutil.Bytes(op.FactoryData)
+	}
+	if op.Paymaster != nil {
+		m["paymaster"] = op.Paymaster
+		m["paymasterVerificationGasLimit"] = (*hexutil.Big)(op.PaymasterVerificationGasLimit)
+		m["paymasterPostOpGasLimit"] = (*hexutil.Big)(op.PaymasterPostOpGasLimit)
+		m["paymasterData"] = hexutil.Bytes(op.PaymasterData)
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON 解析 MarshalJSON 输出的十六进制字段
+func (op *UserOperation) UnmarshalJSON(input []byte) error {
+	var dec struct {
+		Sender                        common.Address  `json:"sender"`
+		Nonce                         *hexutil.Big    `json:"nonce"`
+		Factory                       *common.Address `json:"factory"`
+		FactoryData                   hexutil.Bytes   `json:"factoryData"`
+		CallData                      hexutil.Bytes   `json:"callData"`
+		CallGasLimit                  *hexutil.Big    `json:"callGasLimit"`
+		VerificationGasLimit          *hexutil.Big    `json:"verificationGasLimit"`
+		PreVerificationGas            *hexutil.Big    `json:"preVerificationGas"`
+		MaxFeePerGas                  *hexutil.Big    `json:"maxFeePerGas"`
+		MaxPriorityFeePerGas          *hexutil.Big    `json:"maxPriorityFeePerGas"`
+		Paymaster                     *common.Address `json:"paymaster"`
+		PaymasterVerificationGasLimit *hexutil.Big    `json:"paymasterVerificationGasLimit"`
+		PaymasterPostOpGasLimit       *hexutil.Big    `json:"paymasterPostOpGasLimit"`
+		PaymasterData                 hexutil.Bytes   `json:"paymasterData"`
+		Signature                     hexutil.Bytes   `json:"signature"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*op = UserOperation{
+		Sender:                        dec.Sender,
+		Nonce:                         dec.Nonce.ToInt(),
+		Factory:                       dec.Factory,
+		FactoryData:                   dec.FactoryData,
+		CallData:                      dec.CallData,
+		CallGasLimit:                  dec.CallGasLimit.ToInt(),
+		VerificationGasLimit:          dec.VerificationGasLimit.ToInt(),
+		PreVerificationGas:            dec.PreVerificationGas.ToInt(),
+		MaxFeePerGas:                  dec.MaxFeePerGas.ToInt(),
+		MaxPriorityFeePerGas:          dec.MaxPriorityFeePerGas.ToInt(),
+		Paymaster:                     dec.Paymaster,
+		PaymasterVerificationGasLimit: dec.PaymasterVerificationGasLimit.ToInt(),
+		PaymasterPostOpGasLimit:       dec.PaymasterPostOpGasLimit.ToInt(),
+		PaymasterData:                 dec.PaymasterData,
+		Signature:                     dec.Signature,
+	}
+	return nil
+}
+
+// userOpGasEstimate eth_estimateUserOperationGas 返回值
+type userOpGasEstimate struct {
+	PreVerificationGas   *hexutil.Big `json:"preVerificationGas"`
+	VerificationGasLimit *hexutil.Big `json:"verificationGasLimit"`
+	CallGasLimit         *hexutil.Big `json:"callGasLimit"`
+}
+
+// userOpPlaceholderSignature 准备 UserOperation 时的占位签名: 与真实 WebAuthn 断言编码后长度相当且全为非零字节，
+// 使按 calldata 计算的 preVerificationGas 不低于签名后的实际开销。合约验证时判定签名无效，不影响估算。
+func userOpPlaceholderSignature() []byte {
+	filled := func(n int) []byte { return bytes.Repeat([]byte{0xff}, n) }
+	var data PasskeyData
+	data.WebAuthn.AuthenticatorData = hexutil.Encode(filled(64))
+	data.WebAuthn.ClientDataJSON = base64.RawURLEncoding.EncodeToString(filled(384))
+	data.Signature = P256Signature{R: hexutil.Encode(filled(32)), S: hexutil.Encode(filled(32))}
+	return webauthnSignature(&data)
+}
+
+// entryPointAddress 返回配置的 EntryPoint 地址
+func (srv *Server) entryPointAddress() common.Address {
+	if ep := srv.Config().AA.EntryPoint; ep != "" {
+		return common.HexToAddress(ep)
+	}
+	return common.HexToAddress(defaultEntryPoint)
+}
+
+// getUserOpNonce 查询 EntryPoint 中钱包的 nonce (key = 0)
+func (srv *Server) getUserOpNonce(sender common.Address) (*big.Int, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(entryPointABI))
+	callData, err := parsedABI.Pack("getNonce", sender, big.NewInt(0))
+	if err != nil {
+		return nil, err
+	}
+
+	ep := srv.entryPointAddress()
+	result, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{
+		To:   &ep,
+		Data: callData,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("查询 EntryPoint nonce 失败: %v", err)
+	}
+
+	var nonce *big.Int
+	if err := parsedABI.UnpackIntoInterface(&nonce, "getNonce", result); err != nil {
+		return nil, fmt.Errorf("解析 EntryPoint nonce 失败: %v", err)
+	}
+	return nonce, nil
+}
+
+// buildUserOp 构造调用钱包 callData 的 UserOperation，并填充 nonce 与手续费 (签名为占位签名)
+func (srv *Server) buildUserOp(wallet common.Address, callData []byte) (*UserOperation, error) {
+	nonce, err := srv.getUserOpNonce(wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	tip, err := srv.eth().SuggestGasTipCap(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("获取 gas tip 失败: %v", err)
+	}
+	head, err := srv.eth().HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取最新区块失败: %v", err)
+	}
+	maxFee := new(big.Int).Add(tip, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+
+	return &UserOperation{
+		Sender:               wallet,
+		Nonce:                nonce,
+		CallData:             callData,
+		CallGasLimit:         big.NewInt(0),
+		VerificationGasLimit: big.NewInt(0),
+		PreVerificationGas:   big.NewInt(0),
+		MaxFeePerGas:         maxFee,
+		MaxPriorityFeePerGas: tip,
+		Signature:            userOpPlaceholderSignature(),
+	}, nil
+}
+
+// prepareUserOp 构造 UserOperation 并确定 gas 与 paymaster 字段，之后只需填入签名即可提交
+//
+// 钱包签名的 challenge 就是 userOpHash，覆盖这里确定的全部字段，所以提交前不能再改动。
+func (srv *Server) prepareUserOp(wallet common.Address, callData []byte) (*UserOperation, error) {
+	op, err := srv.buildUserOp(wallet, callData)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先用占位签名填入 paymaster 字段，保证 gas 估算包含 paymaster 验证开销
+	sponsored := srv.paymaster.attach(op)
+
+	if bundlerURL := srv.Config().AA.BundlerRPC; bundlerURL != "" {
+		bundler, err := rpc.DialContext(context.Background(), bundlerURL)
+		if err != nil {
+			return nil, fmt.Errorf("连接 bundler 失败: %v", err)
+		}
+		defer bundler.Close()
+		if err := srv.estimateUserOpGas(bundler, op); err != nil {
+			return nil, err
+		}
+		// 占位签名在合约中提前判定无效，估算值不含 P-256 验证开销
+		if floor := srv.verificationGasLimit(); op.VerificationGasLimit.Cmp(floor) < 0 {
+			op.VerificationGasLimit = floor
+		}
+	} else if err := srv.fillUserOpGas(op); err != nil {
+		return nil, err
+	}
+
+	if sponsored {
+		if err := srv.paymaster.sign(op, srv.chainID); err != nil {
+			return nil, err
+		}
+	}
+	return op, nil
+}
+
+// sendUserOp 提交已签名的 UserOperation，返回 userOpHash
+// 配置了 bundler_rpc 时交给外部 bundler，否则自建 bundler (开启聚合时合并为批量 handleOps)
+func (srv *Server) sendUserOp(op *UserOperation) (common.Hash, *BatchInfo, error) {
+	var opHash common.Hash
+	var batch *BatchInfo
+	var err error
+	switch bundlerURL := srv.Config().AA.BundlerRPC; {
+	case bundlerURL != "":
+		bundler, dialErr := rpc.DialContext(context.Background(), bundlerURL)
+		if dialErr != nil {
+			return common.Hash{}, nil, fmt.Errorf("连接 bundler 失败: %v", dialErr)
+		}
+		defer bundler.Close()
+		opHash, err = srv.submitUserOpToBundler(bundler, op)
+	case srv.batcher.enabled():
+		opHash, batch, err = srv.batcher.submitUserOp(op)
+	default:
+		opHash, err = srv.sendUserOpSelfBundled(op)
+	}
+	if err == nil && op.Paymaster != nil {
+		srv.paymaster.recordUsage(op)
+	}
+	return opHash, batch, err
+}
+
+// preparedUserOpKey 已准备的 UserOperation 在 nsChallenges 中的 key，按签名 challenge (base64url 的 userOpHash) 索引
+func preparedUserOpKey(challenge string) string {
+	return "userop/" + strings.TrimRight(challenge, "=")
+}
+
+// prepareUserOpChallenge 为 4337 账户的钱包调用准备 UserOperation 并保存到 challenge 过期，返回 userOpHash 作为签名 challenge
+func (srv *Server) prepareUserOpChallenge(wallet common.Address, callData []byte) (common.Hash, *big.Int, error) {
+	op, err := srv.prepareUserOp(wallet, callData)
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	hash := userOpHash(op, srv.entryPointAddress(), srv.chainID)
+	if err := setCacheJSON(srv.shared, nsChallenges, preparedUserOpKey(base64.RawURLEncoding.EncodeToString(hash[:])), op, assertionTTL); err != nil {
+		return common.Hash{}, nil, fmt.Errorf("保存 UserOperation 失败: %v", err)
+	}
+	return hash, op.Nonce, nil
+}
+
+// preparedUserOp 读取断言 challenge 对应的已准备 UserOperation；take 为 true 时同时删除，保证只提交一次
+func (srv *Server) preparedUserOp(data *PasskeyData, take bool) (*UserOperation, error) {
+	cd, _, err := parseClientData(data.WebAuthn.ClientDataJSON, "webauthn.get")
+	if err != nil {
+		return nil, err
+	}
+	key := preparedUserOpKey(cd.Challenge)
+	var op UserOperation
+	var ok bool
+	if take {
+		ok = srv.takeChallenge(key, &op)
+	} else {
+		ok, err = getCacheJSON(srv.shared, nsChallenges, key, &op)
+	}
+	if err != nil || !ok {
+		return nil, fmt.Errorf("UserOperation 未准备或已过期，请重新获取 challenge")
+	}
+	return &op, nil
+}
+
+// estimateUserOpGas 通过 bundler 估算 gas 字段
+func (srv *Server) estimateUserOpGas(bundler *rpc.Client, op *UserOperation) error {
+	var est userOpGasEstimate
+	if err := bundler.CallContext(context.Background(), &est, "eth_estimateUserOperationGas", op, srv.entryPointAddress()); err != nil {
+		return fmt.Errorf("估算 UserOperation gas 失败: %v", err)
+	}
+	op.PreVerificationGas = est.PreVerificationGas.ToInt()
+	op.VerificationGasLimit = est.VerificationGasLimit.ToInt()
+	op.CallGasLimit = est.CallGasLimit.ToInt()
+	return nil
+}
+
+// submitUserOpToBundler 提交 UserOperation 给外部 bundler
+func (srv *Server) submitUserOpToBundler(bundler *rpc.Client, op *UserOperation) (common.Hash, error) {
+	var opHash common.Hash
+	if err := bundler.CallContext(context.Background(), &opHash, "eth_sendUserOperation", op, srv.entryPointAddress()); err != nil {
+		return common.Hash{}, fmt.Errorf("提交 UserOperation 失败: %v", err)
+	}
+	return opHash, nil
+}
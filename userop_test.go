@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 签发 challenge 时准备的 UserOperation 经 JSON 保存后取回，userOpHash 必须不变 (签名覆盖的就是它)
+func TestUserOperationJSONRoundTrip(t *testing.T) {
+	paymaster := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	callData, err := encodeTransferERC20(benchToken, benchTo, benchAmount, webauthnSignature(&PasskeyData{}), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := &UserOperation{
+		Sender:                        common.HexToAddress("0x00000000000000000000000000000000000000aa"),
+		Nonce:                         new(big.Int).Lsh(big.NewInt(1), 70),
+		CallData:                      callData,
+		CallGasLimit:                  big.NewInt(120000),
+		VerificationGasLimit:          big.NewInt(400000),
+		PreVerificationGas:            big.NewInt(52000),
+		MaxFeePerGas:                  big.NewInt(3_000_000_000),
+		MaxPriorityFeePerGas:          big.NewInt(1_000_000_000),
+		Paymaster:                     &paymaster,
+		PaymasterVerificationGasLimit: big.NewInt(60000),
+		PaymasterPostOpGasLimit:       big.NewInt(10000),
+		PaymasterData:                 append(encodeValidity(1700000000, 1699999000), bytes.Repeat([]byte{0x11}, 65)...),
+		Signature:                     userOpPlaceholderSignature(),
+	}
+	ep := common.HexToAddress(defaultEntryPoint)
+	chainID := big.NewInt(11155111)
+
+	encoded, err := json.Marshal(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded UserOperation
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := userOpHash(&decoded, ep, chainID), userOpHash(op, ep, chainID); got != want {
+		t.Fatalf("userOpHash 经 JSON 往返后变化: %s != %s", got.Hex(), want.Hex())
+	}
+	again, _ := json.Marshal(&decoded)
+	if !bytes.Equal(encoded, again) {
+		t.Fatalf("JSON 往返不一致\n got %s\nwant %s", again, encoded)
+	}
+
+	// 签名不参与 userOpHash，但占位签名不能短于真实断言，否则按它估算的 preVerificationGas 偏低
+	decoded.Signature = webauthnSignature(benchPasskey())
+	if userOpHash(&decoded, ep, chainID) != userOpHash(op, ep, chainID) {
+		t.Fatal("签名不应影响 userOpHash")
+	}
+	if len(op.Signature) < len(decoded.Signature) {
+		t.Fatalf("占位签名 %d 字节，短于真实签名 %d 字节", len(op.Signature), len(decoded.Signature))
+	}
+}
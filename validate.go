@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MinTransferConfig 最小转账金额配置 (wei 单位字符串)
+//
+//	min_transfer:
+//	  default: "1000000000000000"          # 链级默认值
+//	  tokens:
+//	    "0xToken...": "1000000000000000000" # 单个代币覆盖
+type MinTransferConfig struct {
+	Default string            `yaml:"default" json:"default"`
+	Tokens  map[string]string `yaml:"tokens" json:"tokens"`
+}
+
+// minTransferFor 返回代币的最小转账金额，未配置时返回 nil
+func (c MinTransferConfig) minTransferFor(token common.Address) (*big.Int, error) {
+	raw := c.Default
+	for addr, v := range c.Tokens {
+		if common.HexToAddress(addr) == token {
+			raw = v
+			break
+		}
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	minAmount, ok := new(big.Int).SetString(raw, 10)
+	if !ok {
+		return nil, fmt.Errorf("min_transfer 配置格式错误: %s", raw)
+	}
+	return minAmount, nil
+}
+
+// maxMemoLength 转账备注最大长度 (字节)
+const maxMemoLength = 256
+
+// validateTransferRequest 校验 ERC20 转账请求参数
+func (srv *Server) validateTransferRequest(req *ERC20TransferRequest) error {
+	if req.Wallet == "" || req.Token == "" || req.To == "" || req.Amount == "" {
+		return fmt.Errorf("缺少必要参数: wallet, token, to, amount")
+	}
+	for name, addr := range map[string]string{"wallet": req.Wallet, "token": req.Token, "to": req.To} {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("%s 地址格式错误: %s", name, addr)
+		}
+	}
+
+	if srv.walletFrozen(common.HexToAddress(req.Wallet)) {
+		return fmt.Errorf("钱包已冻结，解除冻结前不能转账")
+	}
+
+	if len(req.Memo) > maxMemoLength {
+		return fmt.Errorf("备注过长: 最多 %d 字节", maxMemoLength)
+	}
+
+	amount, ok := new(big.Int).SetString(req.Amount, 10)
+	if !ok || amount.Sign() <= 0 {
+		return fmt.Errorf("金额格式错误: %s", req.Amount)
+	}
+
+	if err := srv.screenTransfer(req); err != nil {
+		return err
+	}
+
+	token := common.HexToAddress(req.Token)
+	minAmount, err := srv.Config().MinTransfer.minTransferFor(token)
+	if err != nil {
+		return err
+	}
+	if minAmount != nil && amount.Cmp(minAmount) < 0 {
+		gasCost := srv.estimateTransferGasCost(req, amount)
+		return fmt.Errorf("转账金额 %s 低于最小值 %s (预估 gas 费用 %s wei，gas/金额比 %s)",
+			amount, minAmount, gasCost, gasToValueRatio(gasCost, amount))
+	}
+	return srv.checkTransferFees(req)
+}
+
+// checkTransferFees 接受转账前按当前网络价格检查费用上限，超过时拒绝 (不消耗签名)
+func (srv *Server) checkTransferFees(req *ERC20TransferRequest) error {
+	var reqCap *big.Int
+	if req.MaxGasPrice != "" {
+		var ok bool
+		if reqCap, ok = new(big.Int).SetString(req.MaxGasPrice, 10); !ok || reqCap.Sign() <= 0 {
+			return fmt.Errorf("maxGasPrice 格式错误: %s", req.MaxGasPrice)
+		}
+	}
+	cfg := srv.Config().Gas
+	if reqCap == nil && cfg.MaxGasPrice == "" && cfg.MaxFee == "" {
+		return nil
+	}
+	gasPrice, err := srv.gasPrice(context.Background())
+	if err != nil {
+		return err
+	}
+	return srv.checkFeeCaps(gasPrice, 0, nil, reqCap)
+}
+
+// estimateTransferGasCost 估算一次 transferERC20 中继的 gas 费用 (wei)
+func (srv *Server) estimateTransferGasCost(req *ERC20TransferRequest, amount *big.Int) *big.Int {
+	parsedABI, _ := abi.JSON(strings.NewReader(walletABI))
+	callData, _ := parsedABI.Pack("transferERC20",
+		common.HexToAddress(req.Token), common.HexToAddress(req.To), amount, webauthnSignature(&req.PasskeyData))
+	return srv.estimateWalletCallCost(common.HexToAddress(req.Wallet), callData, &req.PasskeyData)
+}
+
+// estimateWalletCallCost 估算中继账户调用钱包的费用 (wei)，rollup 上包含 L1 数据费
+// 估算失败时按 fallbackGasLimit 计算，与 sendTransaction 的兜底值一致
+func (srv *Server) estimateWalletCallCost(wallet common.Address, callData []byte, data *PasskeyData) *big.Int {
+	gasLimit := srv.fallbackGasLimit()
+	if callData != nil {
+		msg := ethereum.CallMsg{To: &wallet, Data: callData}
+		if s := srv.signer(); s != nil {
+			msg.From = s.Address()
+		}
+		overrides, _ := srv.walletOverrides(context.Background(), wallet, data)
+		if estimated, err := srv.estimateGasWithOverrides(context.Background(), msg, overrides); err == nil {
+			gasLimit = estimated
+		}
+	}
+
+	_, _, total, err := srv.relayFee(context.Background(), wallet, callData, gasLimit)
+	if err != nil {
+		return big.NewInt(0)
+	}
+	return total
+}
+
+// gasToValueRatio 计算 gas 费用与转账金额 (最小单位) 的比值
+func gasToValueRatio(gasCost, amount *big.Int) string {
+	if amount.Sign() == 0 {
+		return "∞"
+	}
+	ratio := new(big.Float).Quo(new(big.Float).SetInt(gasCost), new(big.Float).SetInt(amount))
+	return ratio.Text('g', 4)
+}
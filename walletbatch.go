@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 批量创建钱包的限制
+const (
+	walletBatchChunk = 25  // 每笔交易创建的钱包数 (约 25 × 600k gas)
+	maxWalletBatch   = 500 // 单次请求最多公钥数
+)
+
+// PublicKeyHex P-256 公钥坐标，请求中也可以直接传原始 COSE_Key (见 UnmarshalJSON)
+type PublicKeyHex struct {
+	X string `json:"x"`
+	Y string `json:"y"`
+}
+
+// BatchCreateWalletRequest 批量创建钱包请求
+type BatchCreateWalletRequest struct {
+	PublicKeys []PublicKeyHex `json:"publicKeys"`
+	WalletType string         `json:"walletType"` // 默认 default
+}
+
+// WalletBatchChunk 一笔批量创建交易，覆盖 publicKeys[From:To]
+type WalletBatchChunk struct {
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+	Method string `json:"method"` // createWallets / multicall
+	TxHash string `json:"txHash"`
+	Error  string `json:"error,omitempty"`
+
+	RawTransaction string `json:"rawTransaction,omitempty"` // broadcast=false 时返回签名后的原始交易
+}
+
+// createWalletsBatch 按 walletBatchChunk 分段创建钱包，各段用连续 nonce 依次发送
+// broadcast 为 false 时只签名，各段原始交易需按 nonce 顺序提交
+//
+// 工厂支持 createWallets 时直接调用，否则 (旧版工厂) 经 Multicall3 聚合 createWallet。
+// 某段发送失败后不再继续，已发送的段不受影响。
+func (srv *Server) createWalletsBatch(wt *WalletTypeConfig, keys []PublicKeyHex, broadcast bool) ([]WalletBatchChunk, error) {
+	factory := common.HexToAddress(wt.Factory)
+	// 只签名时各段使用从当前 nonce 开始的连续 nonce，不占用 nonceManager 的计数
+	nonce, err := srv.relayerNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []WalletBatchChunk
+	for from := 0; from < len(keys); from += walletBatchChunk {
+		to := min(from+walletBatchChunk, len(keys))
+		chunk := WalletBatchChunk{From: from, To: to}
+
+		target, data, method, err := srv.walletBatchCallData(factory, keys[from:to])
+		if err == nil {
+			var signedTx *types.Transaction
+			if broadcast {
+				signedTx, err = srv.relayTransaction(target, big.NewInt(0), data, true)
+			} else {
+				signedTx, err = srv.relayTransactionAt(nonce, target, big.NewInt(0), data, false)
+			}
+			if err == nil {
+				chunk.TxHash = signedTx.Hash().Hex()
+				if broadcast {
+					go srv.registerWallets(signedTx.Hash(), wt, "")
+				} else {
+					chunk.RawTransaction = srv.rawTxData(signedTx).RawTransaction
+				}
+			}
+		}
+		chunk.Method = method
+		if err != nil {
+			chunk.Error = err.Error()
+			chunk.TxHash = ""
+			chunks = append(chunks, chunk)
+			break
+		}
+		nonce++
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// walletBatchCallData 选择批量创建方式并编码调用数据
+func (srv *Server) walletBatchCallData(factory common.Address, keys []PublicKeyHex) (common.Address, []byte, string, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(factoryABI))
+
+	xs := make([][32]byte, len(keys))
+	ys := make([][32]byte, len(keys))
+	for i, k := range keys {
+		xs[i], ys[i] = hexToBytes32(k.X), hexToBytes32(k.Y)
+	}
+	data, err := parsedABI.Pack("createWallets", xs, ys)
+	if err != nil {
+		return common.Address{}, nil, "", fmt.Errorf("编码调用数据失败: %v", err)
+	}
+
+	msg := ethereum.CallMsg{To: &factory, Data: data}
+	if s := srv.signer(); s != nil {
+		msg.From = s.Address()
+	}
+	if _, err := srv.eth().CallContract(context.Background(), msg, nil); err == nil {
+		return factory, data, "createWallets", nil
+	}
+
+	mcABI, _ := abi.JSON(strings.NewReader(multicall3ABI))
+	calls := make([]multicall3Call, len(keys))
+	for i := range keys {
+		callData, _ := parsedABI.Pack("createWallet", xs[i], ys[i])
+		calls[i] = multicall3Call{Target: factory, AllowFailure: false, CallData: callData}
+	}
+	data, err = mcABI.Pack("aggregate3", calls)
+	if err != nil {
+		return common.Address{}, nil, "", fmt.Errorf("编码 multicall 失败: %v", err)
+	}
+	return multicall3Address, data, "multicall", nil
+}
+
+// walletsFromReceipt 从回执的 WalletCreated 事件中取出 (公钥 → 钱包地址)
+func walletsFromReceipt(receipt *types.Receipt) map[PublicKeyHex]common.Address {
+	parsedABI, _ := abi.JSON(strings.NewReader(factoryABI))
+	event := parsedABI.Events["WalletCreated"]
+
+	created := make(map[PublicKeyHex]common.Address)
+	for _, l := range receipt.Logs {
+		if len(l.Topics) < 2 || l.Topics[0] != event.ID {
+			continue
+		}
+		var data struct {
+			X [32]byte
+			Y [32]byte
+		}
+		if err := parsedABI.UnpackIntoInterface(&data, "WalletCreated", l.Data); err != nil {
+			continue
+		}
+		key := PublicKeyHex{X: common.Hash(data.X).Hex(), Y: common.Hash(data.Y).Hex()}
+		created[key] = common.BytesToAddress(l.Topics[1].Bytes())
+	}
+	return created
+}
+
+// validatePublicKeys 检查公钥列表
+func validatePublicKeys(keys []PublicKeyHex) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("缺少参数: publicKeys")
+	}
+	if len(keys) > maxWalletBatch {
+		return fmt.Errorf("单次最多创建 %d 个钱包", maxWalletBatch)
+	}
+	for i, k := range keys {
+		if strings.TrimPrefix(k.X, "0x") == "" || strings.TrimPrefix(k.Y, "0x") == "" {
+			return fmt.Errorf("publicKeys[%d] 缺少 x/y", i)
+		}
+	}
+	return nil
+}
+
+// handleCreateWallets 批量创建钱包 (迁移已有用户)，返回每段交易哈希
+func (srv *Server) handleCreateWallets(w http.ResponseWriter, r *http.Request) {
+	if srv.signer() == nil {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+
+	var req BatchCreateWalletRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+	if err := validatePublicKeys(req.PublicKeys); err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	wt, err := srv.walletType(req.WalletType)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	broadcast := broadcastRequested(r)
+	chunks, err := srv.createWalletsBatch(wt, req.PublicKeys, broadcast)
+	if err != nil {
+		sendError(w, "批量创建钱包失败: "+err.Error())
+		return
+	}
+
+	resp := APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("已发送 %d 笔批量创建交易，钱包地址见各交易的 WalletCreated 事件", len(chunks)),
+		Data:    chunks,
+	}
+	if !broadcast {
+		resp.Message = fmt.Sprintf("已签名 %d 笔批量创建交易，未广播，请按 nonce 顺序提交", len(chunks))
+	}
+	if last := chunks[len(chunks)-1]; last.Error != "" {
+		resp.Success = false
+		resp.Message = fmt.Sprintf("第 %d 段发送失败，publicKeys[%d:] 未创建: %s", len(chunks), last.From, last.Error)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// runCreateWallets 命令行批量创建: 读取公钥 JSON 数组，等待各段上链并打印钱包地址
+func runCreateWallets(srv *Server, filename string) error {
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var keys []PublicKeyHex
+	if err := json.Unmarshal(file, &keys); err != nil {
+		return fmt.Errorf("解析公钥文件失败: %v", err)
+	}
+	if err := validatePublicKeys(keys); err != nil {
+		return err
+	}
+
+	wt, _ := srv.walletType("")
+	chunks, err := srv.createWalletsBatch(wt, keys, true)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if chunk.Error != "" {
+			return fmt.Errorf("publicKeys[%d:] 未创建: %s", chunk.From, chunk.Error)
+		}
+		fmt.Printf("[%d, %d) %s 交易: %s\n", chunk.From, chunk.To, chunk.Method, chunk.TxHash)
+		receipt, err := srv.waitReceipt(common.HexToHash(chunk.TxHash))
+		if err != nil {
+			return err
+		}
+		created := walletsFromReceipt(receipt)
+		for _, k := range keys[chunk.From:chunk.To] {
+			key := PublicKeyHex{X: common.Hash(hexToBytes32(k.X)).Hex(), Y: common.Hash(hexToBytes32(k.Y)).Hex()}
+			fmt.Printf("  %s %s → %s\n", key.X, key.Y, created[key].Hex())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 单次 eth_getLogs 的默认区块跨度 (多数节点服务商限制在数千个区块以内)
+const defaultIndexerBatchBlocks = 2000
+
+// WalletIndexerConfig WalletCreated 事件索引配置
+//
+// 索引全部钱包类型的工厂，包括不经过本服务创建的钱包 (直接调用工厂、其它实例创建等)，
+// 写入钱包登记与公钥索引。处理进度保存在存储中，重启后从上次的区块继续。
+type WalletIndexerConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	StartBlock   uint64 `yaml:"start_block"`   // 首次运行时开始回填的区块 (工厂部署区块)，0 表示从当前区块开始
+	PollInterval int    `yaml:"poll_interval"` // 轮询间隔 (秒)，订阅了新区块时每个区块处理一次
+	BatchBlocks  uint64 `yaml:"batch_blocks"`  // 单次 eth_getLogs 的区块跨度，默认 2000
+}
+
+// walletIndexerStateKey 处理进度 (nsIndexerState)
+const walletIndexerStateKey = "wallets"
+
+// walletIndexer 监听工厂的 WalletCreated 事件，解析公钥与钱包地址的对应关系并写入钱包登记
+type walletIndexer struct {
+	srv *Server
+}
+
+func newWalletIndexer(srv *Server) *walletIndexer {
+	return &walletIndexer{srv: srv}
+}
+
+// factories 全部钱包类型的工厂地址与类型名
+func (ix *walletIndexer) factories() map[common.Address]string {
+	cfg := ix.srv.Config()
+	out := make(map[common.Address]string)
+	if common.IsHexAddress(cfg.Contract) {
+		out[common.HexToAddress(cfg.Contract)] = defaultWalletType
+	}
+	for _, wt := range cfg.WalletTypes {
+		if _, ok := out[common.HexToAddress(wt.Factory)]; !ok {
+			out[common.HexToAddress(wt.Factory)] = wt.Name
+		}
+	}
+	return out
+}
+
+// lastBlock 已处理到的区块，没有记录时返回 false
+func (ix *walletIndexer) lastBlock() (uint64, bool) {
+	data, ok, err := ix.srv.storage.Get(nsIndexerState, walletIndexerStateKey)
+	if err != nil || !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(string(data), 10, 64)
+	return n, err == nil
+}
+
+func (ix *walletIndexer) setLastBlock(n uint64) {
+	if err := ix.srv.storage.Put(nsIndexerState, walletIndexerStateKey, []byte(strconv.FormatUint(n, 10)), 0); err != nil {
+		log.Printf("保存钱包索引进度失败: %v", err)
+	}
+}
+
+// run 后台回填并跟踪新区块，直到 ctx 取消
+func (ix *walletIndexer) run(ctx context.Context) {
+	cfg := ix.srv.Config().WalletIndexer
+	interval := time.Duration(cfg.PollInterval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	for {
+		if err := ix.poll(ctx); err != nil {
+			log.Printf("钱包索引失败: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ix.srv.heads.next(interval):
+		}
+	}
+}
+
+// poll 按 batch_blocks 分段处理 (lastBlock, head] 区间内的 WalletCreated 事件
+func (ix *walletIndexer) poll(ctx context.Context) error {
+	head, err := ix.srv.blockNumber(ctx)
+	if err != nil {
+		ix.srv.rpc.reportError(err)
+		return err
+	}
+	cfg := ix.srv.Config().WalletIndexer
+	last, ok := ix.lastBlock()
+	if !ok {
+		if cfg.StartBlock == 0 {
+			ix.setLastBlock(head)
+			return nil
+		}
+		last = cfg.StartBlock - 1
+	}
+	batch := cfg.BatchBlocks
+	if batch == 0 {
+		batch = defaultIndexerBatchBlocks
+	}
+
+	factories := ix.factories()
+	addrs := make([]common.Address, 0, len(factories))
+	for addr := range factories {
+		addrs = append(addrs, addr)
+	}
+	parsedABI, _ := abi.JSON(strings.NewReader(factoryABI))
+	event := parsedABI.Events["WalletCreated"]
+
+	for last < head {
+		to := min(last+batch, head)
+		if len(addrs) > 0 {
+			logs, err := ix.srv.eth().FilterLogs(ctx, ethereum.FilterQuery{
+				FromBlock: new(big.Int).SetUint64(last + 1),
+				ToBlock:   new(big.Int).SetUint64(to),
+				Addresses: addrs,
+				Topics:    [][]common.Hash{{event.ID}},
+			})
+			if err != nil {
+				// 进度不前进，下次从同一区块继续
+				ix.srv.rpc.reportError(err)
+				return err
+			}
+			for _, l := range logs {
+				if l.Removed {
+					continue
+				}
+				ix.index(parsedABI, l, factories[l.Address])
+			}
+		}
+		last = to
+		ix.setLastBlock(last)
+	}
+	return nil
+}
+
+// index 登记一个 WalletCreated 事件: 已登记的钱包只补全公钥索引
+func (ix *walletIndexer) index(parsedABI abi.ABI, l types.Log, typ string) {
+	if len(l.Topics) < 2 {
+		return
+	}
+	var data struct {
+		X [32]byte
+		Y [32]byte
+	}
+	if err := parsedABI.UnpackIntoInterface(&data, "WalletCreated", l.Data); err != nil {
+		return
+	}
+	wallet := common.BytesToAddress(l.Topics[1].Bytes())
+	key := PublicKeyHex{X: common.Hash(data.X).Hex(), Y: common.Hash(data.Y).Hex()}
+	srv := ix.srv
+
+	srv.walletRecordMu.Lock()
+	defer srv.walletRecordMu.Unlock()
+
+	var rec walletRecord
+	found, err := getJSON(srv.storage, nsWallets, wallet.Hex(), &rec)
+	if err != nil {
+		log.Printf("读取钱包登记 %s 失败: %v", wallet.Hex(), err)
+		return
+	}
+	if found {
+		if rec.PublicKey.X == "" {
+			rec.PublicKey = key
+			if err := putJSON(srv.storage, nsWallets, rec.Wallet, rec, 0); err != nil {
+				log.Printf("更新钱包登记 %s 失败: %v", rec.Wallet, err)
+			}
+		}
+		var credentialID string
+		if len(rec.Credentials) > 0 {
+			credentialID = rec.Credentials[0]
+		}
+		srv.indexWalletKey(key, wallet, credentialID)
+		return
+	}
+
+	rec = walletRecord{
+		Wallet:      wallet.Hex(),
+		Type:        typ,
+		Factory:     l.Address.Hex(),
+		Credentials: []string{},
+		PublicKey:   key,
+		TxHash:      l.TxHash.Hex(),
+		CreatedAt:   time.Now().Unix(),
+	}
+	// 由本服务发起但未等到回执 (如期间重启) 的创建交易: 按交易哈希找回注册时的凭证
+	credentialID := srv.credentialByTx(l.TxHash, key)
+	if credentialID != "" {
+		rec.Credentials = append(rec.Credentials, credentialID)
+		srv.updateCredential(credentialID, func(cred *Credential) {
+			cred.Wallet = rec.Wallet
+			rec.UserName = cred.UserName
+		})
+	}
+	if err := putJSON(srv.storage, nsWallets, rec.Wallet, rec, 0); err != nil {
+		log.Printf("登记钱包 %s 失败: %v", rec.Wallet, err)
+		return
+	}
+	srv.indexWalletKey(key, wallet, credentialID)
+	srv.indexer.track(wallet)
+	log.Printf("已索引钱包 %s (区块 %d)", rec.Wallet, l.BlockNumber)
+}
+
+// credentialByTx 查找由该交易创建钱包、公钥一致且尚未关联钱包的凭证
+func (srv *Server) credentialByTx(txHash common.Hash, key PublicKeyHex) string {
+	kvs, err := srv.storage.List(nsCredentials, "")
+	if err != nil {
+		return ""
+	}
+	for _, kv := range kvs {
+		var cred Credential
+		if json.Unmarshal(kv.Value, &cred) != nil || cred.Wallet != "" || cred.RevokedAt != 0 {
+			continue
+		}
+		if common.HexToHash(cred.TxHash) == txHash && strings.EqualFold(cred.PublicKey.X, key.X) && strings.EqualFold(cred.PublicKey.Y, key.Y) {
+			return cred.ID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PasskeyWallet 多设备公钥相关 ABI
+const walletKeysABI = `[
+	{
+		"inputs": [
+			{"name": "x", "type": "bytes32"},
+			{"name": "y", "type": "bytes32"},
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "addPublicKey",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [
+			{"name": "x", "type": "bytes32"},
+			{"name": "y", "type": "bytes32"},
+			{"name": "signature", "type": "bytes"}
+		],
+		"name": "removePublicKey",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
+	{
+		"inputs": [],
+		"name": "getPublicKeys",
+		"outputs": [
+			{"name": "xs", "type": "bytes32[]"},
+			{"name": "ys", "type": "bytes32[]"}
+		],
+		"stateMutability": "view",
+		"type": "function"
+	}
+]`
+
+// CredentialInfo 钱包凭证列表中的一项
+type CredentialInfo struct {
+	ID        string       `json:"id"`
+	PublicKey PublicKeyHex `json:"publicKey"`
+	UserName  string       `json:"userName"`
+	Pending   bool         `json:"pending,omitempty"`
+	CreatedAt int64        `json:"createdAt"`
+}
+
+// WalletCredentialsData GET /api/wallet/{addr}/credentials 返回数据
+type WalletCredentialsData struct {
+	Wallet      string           `json:"wallet"`
+	Credentials []CredentialInfo `json:"credentials"`
+	OnChainKeys []PublicKeyHex   `json:"onChainKeys,omitempty"` // 合约 getPublicKeys() (旧版钱包不支持时为空)
+}
+
+// AddCredentialRequest 添加设备请求: 由已授权的 Passkey 签名 add-key challenge
+type AddCredentialRequest struct {
+	PasskeyData
+	CredentialID string `json:"credentialId"` // 新设备经 /api/register/begin (带 wallet) 注册得到的凭证
+}
+
+// loadWalletRecord 读取钱包登记，没有登记的钱包返回默认类型的空记录
+func (srv *Server) loadWalletRecord(wallet common.Address) (*walletRecord, error) {
+	var rec walletRecord
+	found, err := getJSON(srv.storage, nsWallets, wallet.Hex(), &rec)
+	if err != nil {
+		return nil, fmt.Errorf("读取钱包登记失败: %v", err)
+	}
+	if !found {
+		wt, _ := srv.walletType("")
+		rec = walletRecord{Wallet: wallet.Hex(), Type: wt.Name, Factory: common.HexToAddress(wt.Factory).Hex()}
+	}
+	if rec.Credentials == nil {
+		rec.Credentials = []string{}
+	}
+	return &rec, nil
+}
+
+// updateCredential 读改写一条凭证记录，记录不存在时忽略
+func (srv *Server) updateCredential(id string, fn func(*Credential)) {
+	var cred Credential
+	if found, err := getJSON(srv.storage, nsCredentials, id, &cred); err != nil || !found {
+		return
+	}
+	fn(&cred)
+	if err := putJSON(srv.storage, nsCredentials, id, cred, 0); err != nil {
+		log.Printf("更新凭证 %s 失败: %v", id, err)
+	}
+}
+
+// walletCredential 读取属于钱包的凭证
+func (srv *Server) walletCredential(wallet common.Address, id string) (*Credential, error) {
+	var cred Credential
+	found, err := getJSON(srv.storage, nsCredentials, id, &cred)
+	if err != nil {
+		return nil, fmt.Errorf("读取凭证失败: %v", err)
+	}
+	if !found || cred.RevokedAt != 0 || !strings.EqualFold(cred.Wallet, wallet.Hex()) {
+		return nil, fmt.Errorf("凭证不属于该钱包或已撤销: %s", id)
+	}
+	return &cred, nil
+}
+
+// signingCredential 在钱包已授权的凭证中找出本次断言的签名者 (本地验签)，找不到时返回空
+func (srv *Server) signingCredential(wallet common.Address, data *PasskeyData) string {
+	rec, err := srv.loadWalletRecord(wallet)
+	if err != nil {
+		return ""
+	}
+	for _, id := range rec.Credentials {
+		var cred Credential
+		if found, err := getJSON(srv.storage, nsCredentials, id, &cred); err != nil || !found {
+			continue
+		}
+		pub, err := publicKeyFromHex(cred.PublicKey)
+		if err != nil {
+			continue
+		}
+		if valid, _, err := verifyP256Local(data, pub); err == nil && valid {
+			return id
+		}
+	}
+	return ""
+}
+
+// verifyRegisteredKey 用服务端登记的公钥 (创建钱包的公钥与已授权凭证) 本地验签，
+// 用于无法链上验证的未部署钱包；没有任何登记公钥时返回错误
+func (srv *Server) verifyRegisteredKey(wallet common.Address, data *PasskeyData) (bool, error) {
+	rec, err := srv.loadWalletRecord(wallet)
+	if err != nil {
+		return false, err
+	}
+	keys := []PublicKeyHex{}
+	if rec.PublicKey.X != "" {
+		keys = append(keys, rec.PublicKey)
+	}
+	for _, id := range rec.Credentials {
+		var cred Credential
+		if found, err := getJSON(srv.storage, nsCredentials, id, &cred); err == nil && found && cred.RevokedAt == 0 {
+			keys = append(keys, cred.PublicKey)
+		}
+	}
+	if len(keys) == 0 {
+		return false, fmt.Errorf("钱包 %s 未部署且没有登记公钥，无法验证签名", wallet.Hex())
+	}
+	for _, key := range keys {
+		pub, err := publicKeyFromHex(key)
+		if err != nil {
+			continue
+		}
+		valid, _, err := verifyP256Local(data, pub)
+		if err != nil {
+			return false, err
+		}
+		if valid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// onChainKeys 读取钱包合约中的全部公钥
+func (srv *Server) onChainKeys(wallet common.Address) ([]PublicKeyHex, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(walletKeysABI))
+	data, _ := parsedABI.Pack("getPublicKeys")
+	out, err := srv.eth().CallContract(context.Background(), ethereum.CallMsg{To: &wallet, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("调用合约失败: %v", err)
+	}
+	var result struct {
+		Xs [][32]byte
+		Ys [][32]byte
+	}
+	if err := parsedABI.UnpackIntoInterface(&result, "getPublicKeys", out); err != nil {
+		return nil, fmt.Errorf("解析结果失败: %v", err)
+	}
+	keys := make([]PublicKeyHex, 0, len(result.Xs))
+	for i := range result.Xs {
+		keys = append(keys, PublicKeyHex{X: common.Hash(result.Xs[i]).Hex(), Y: common.Hash(result.Ys[i]).Hex()})
+	}
+	return keys, nil
+}
+
+// walletKeyCall 编码钱包的 addPublicKey / removePublicKey 调用
+func walletKeyCall(method string, key PublicKeyHex, data *PasskeyData) ([]byte, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(walletKeysABI))
+	callData, err := parsedABI.Pack(method, hexToBytes32(key.X), hexToBytes32(key.Y), webauthnSignature(data))
+	if err != nil {
+		return nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	return callData, nil
+}
+
+// credentialKeyCall 增删凭证对应的钱包调用，待添加的凭证撤销时不上链，返回 nil
+func (srv *Server) credentialKeyCall(wallet common.Address, credentialID string, add bool, data *PasskeyData) (*Credential, []byte, error) {
+	cred, err := srv.walletCredential(wallet, strings.TrimRight(credentialID, "="))
+	if err != nil {
+		return nil, nil, err
+	}
+	if add {
+		if !cred.Pending {
+			return nil, nil, fmt.Errorf("该凭证已授权")
+		}
+		callData, err := walletKeyCall("addPublicKey", cred.PublicKey, data)
+		return cred, callData, err
+	}
+	if cred.Pending {
+		return cred, nil, nil
+	}
+	callData, err := walletKeyCall("removePublicKey", cred.PublicKey, data)
+	return cred, callData, err
+}
+
+// confirmCredentialChange 等待增删公钥的交易上链后更新钱包登记与凭证记录
+func (srv *Server) confirmCredentialChange(txHash common.Hash, wallet common.Address, id string, added bool) {
+	if _, err := srv.waitReceipt(txHash); err != nil {
+		log.Printf("钱包 %s 凭证 %s 变更未生效: %v", wallet.Hex(), id, err)
+		return
+	}
+
+	srv.walletRecordMu.Lock()
+	defer srv.walletRecordMu.Unlock()
+
+	rec, err := srv.loadWalletRecord(wallet)
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	credentials := []string{}
+	for _, c := range rec.Credentials {
+		if c != id {
+			credentials = append(credentials, c)
+		}
+	}
+	if added {
+		credentials = append(credentials, id)
+	}
+	rec.Credentials = credentials
+	if err := putJSON(srv.storage, nsWallets, rec.Wallet, rec, 0); err != nil {
+		log.Printf("更新钱包登记 %s 失败: %v", rec.Wallet, err)
+	}
+
+	var key PublicKeyHex
+	srv.updateCredential(id, func(cred *Credential) {
+		cred.Pending = false
+		if added {
+			cred.TxHash = txHash.Hex()
+		} else {
+			cred.RevokedAt = time.Now().Unix()
+		}
+		key = cred.PublicKey
+	})
+	if added {
+		srv.indexWalletKey(key, wallet, id)
+	} else {
+		srv.unindexWalletKey(key)
+	}
+	if !added {
+		srv.resetCredentialSignCount(wallet, id)
+	}
+}
+
+// clearWalletCredentials 社交恢复更换公钥后，合约已撤销全部设备公钥，登记同步清空
+func (srv *Server) clearWalletCredentials(wallet common.Address) {
+	srv.walletRecordMu.Lock()
+	defer srv.walletRecordMu.Unlock()
+
+	rec, err := srv.loadWalletRecord(wallet)
+	if err != nil {
+		return
+	}
+	// 创建钱包时的公钥同样已被替换
+	srv.unindexWalletKey(rec.PublicKey)
+	if len(rec.Credentials) == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	for _, id := range rec.Credentials {
+		srv.updateCredential(id, func(cred *Credential) {
+			cred.RevokedAt = now
+			srv.unindexWalletKey(cred.PublicKey)
+		})
+	}
+	rec.Credentials = []string{}
+	if err := putJSON(srv.storage, nsWallets, rec.Wallet, rec, 0); err != nil {
+		log.Printf("更新钱包登记 %s 失败: %v", rec.Wallet, err)
+	}
+}
+
+// handleWalletCredentials 钱包的多设备凭证
+//
+//	GET  /api/wallet/{addr}/credentials   已授权与待添加的凭证，以及链上公钥
+//	POST /api/wallet/{addr}/credentials   添加新设备 {credentialId, ...add-key 签名}
+func (srv *Server) handleWalletCredentials(w http.ResponseWriter, r *http.Request) {
+	addr := r.PathValue("addr")
+	if !common.IsHexAddress(addr) {
+		sendError(w, "钱包地址格式错误: "+addr)
+		return
+	}
+	wallet := common.HexToAddress(addr)
+
+	switch r.Method {
+	case "GET":
+		rec, err := srv.loadWalletRecord(wallet)
+		if err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		data := WalletCredentialsData{Wallet: wallet.Hex(), Credentials: []CredentialInfo{}}
+		kvs, err := srv.storage.List(nsCredentials, "")
+		if err != nil {
+			sendError(w, "读取凭证失败: "+err.Error())
+			return
+		}
+		for _, kv := range kvs {
+			var cred Credential
+			if json.Unmarshal(kv.Value, &cred) != nil || cred.ID == "" || cred.RevokedAt != 0 || !strings.EqualFold(cred.Wallet, wallet.Hex()) {
+				continue
+			}
+			active := false
+			for _, id := range rec.Credentials {
+				active = active || id == cred.ID
+			}
+			if !active && !cred.Pending {
+				continue
+			}
+			data.Credentials = append(data.Credentials, CredentialInfo{
+				ID:        cred.ID,
+				PublicKey: cred.PublicKey,
+				UserName:  cred.UserName,
+				Pending:   !active,
+				CreatedAt: cred.CreatedAt,
+			})
+		}
+		if keys, err := srv.onChainKeys(wallet); err == nil {
+			data.OnChainKeys = keys
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Data:    data,
+		})
+
+	case "POST":
+		if srv.signer() == nil {
+			sendError(w, "未配置私钥，无法发送交易")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req AddCredentialRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		cred, callData, err := srv.credentialKeyCall(wallet, req.CredentialID, true, &req.PasskeyData)
+		if err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		if err := srv.authorizeWalletCall(r, &req.PasskeyData, wallet, opAddKey, wallet, callData); err != nil {
+			sendVerificationError(w, err)
+			return
+		}
+
+		txHash, err := srv.sendTransaction(wallet, big.NewInt(0), callData)
+		if err != nil {
+			sendError(w, "添加设备失败: "+err.Error())
+			return
+		}
+		go srv.confirmCredentialChange(txHash, wallet, cred.ID, true)
+
+		json.NewEncoder(w).Encode(APIResponse{
+			Success:     true,
+			Message:     "添加设备交易已发送，上链后该 Passkey 即可签名",
+			TxHash:      txHash.Hex(),
+			SNormalized: req.Signature.Normalized(),
+		})
+	}
+}
+
+// handleRevokeCredential 撤销钱包的一个凭证 (任一已授权 Passkey 签名 revoke-key challenge)
+//
+//	DELETE /api/wallet/{addr}/credentials/{id}
+func (srv *Server) handleRevokeCredential(w http.ResponseWriter, r *http.Request) {
+	if srv.signer() == nil {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+
+	addr := r.PathValue("addr")
+	if !common.IsHexAddress(addr) {
+		sendError(w, "钱包地址格式错误: "+addr)
+		return
+	}
+	wallet := common.HexToAddress(addr)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var data PasskeyData
+	if err := json.Unmarshal(body, &data); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+
+	cred, callData, err := srv.credentialKeyCall(wallet, r.PathValue("id"), false, &data)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	if !cred.Pending {
+		rec, err := srv.loadWalletRecord(wallet)
+		if err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		if len(rec.Credentials) <= 1 {
+			sendError(w, "不能撤销钱包唯一的凭证")
+			return
+		}
+	}
+	// 作废待添加的凭证同样需要已授权 Passkey 的签名
+	if err := srv.authorizeWalletCall(r, &data, wallet, opRevokeKey, wallet, callData); err != nil {
+		sendVerificationError(w, err)
+		return
+	}
+	if cred.Pending {
+		// 尚未上链，直接作废
+		srv.updateCredential(cred.ID, func(c *Credential) { c.RevokedAt = time.Now().Unix() })
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "待添加的凭证已作废",
+		})
+		return
+	}
+	txHash, err := srv.sendTransaction(wallet, big.NewInt(0), callData)
+	if err != nil {
+		sendError(w, "撤销凭证失败: "+err.Error())
+		return
+	}
+	go srv.confirmCredentialChange(txHash, wallet, cred.ID, false)
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success:     true,
+		Message:     "撤销凭证交易已发送",
+		TxHash:      txHash.Hex(),
+		SNormalized: data.Signature.Normalized(),
+	})
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// walletKeyEntry 公钥 → 钱包索引 (nsWalletKeys，key = walletKeyID)
+type walletKeyEntry struct {
+	Wallet       string `json:"wallet"`
+	CredentialID string `json:"credentialId,omitempty"` // 批量创建的钱包为空
+}
+
+// walletKeyID 公钥索引的 key: x、y 各 32 字节的小写十六进制 (不带 0x)
+func walletKeyID(key PublicKeyHex) (string, error) {
+	if key.X == "" || key.Y == "" {
+		return "", fmt.Errorf("缺少公钥")
+	}
+	x, err := parseBytes32(key.X)
+	if err != nil {
+		return "", fmt.Errorf("公钥 x 格式错误: %v", err)
+	}
+	y, err := parseBytes32(key.Y)
+	if err != nil {
+		return "", fmt.Errorf("公钥 y 格式错误: %v", err)
+	}
+	return common.Hash(x).Hex()[2:] + common.Hash(y).Hex()[2:], nil
+}
+
+// indexWalletKey 登记公钥所属的钱包，公钥上链 (创建钱包 / 添加设备) 后调用
+func (srv *Server) indexWalletKey(key PublicKeyHex, wallet common.Address, credentialID string) {
+	id, err := walletKeyID(key)
+	if err != nil {
+		return
+	}
+	entry := walletKeyEntry{Wallet: wallet.Hex(), CredentialID: credentialID}
+	if err := putJSON(srv.storage, nsWalletKeys, id, entry, 0); err != nil {
+		log.Printf("登记钱包 %s 的公钥失败: %v", wallet.Hex(), err)
+	}
+}
+
+// unindexWalletKey 公钥被移除 (撤销设备 / 社交恢复) 后删除索引
+func (srv *Server) unindexWalletKey(key PublicKeyHex) {
+	id, err := walletKeyID(key)
+	if err != nil {
+		return
+	}
+	if _, err := srv.storage.Delete(nsWalletKeys, id); err != nil {
+		log.Printf("删除公钥索引失败: %v", err)
+	}
+}
+
+// lookupWallet 按凭证 ID 或公钥查找钱包登记，found 为 false 表示没有对应的钱包
+func (srv *Server) lookupWallet(credentialID string, key PublicKeyHex) (*walletRecord, bool, error) {
+	var wallet string
+	if credentialID != "" {
+		var cred Credential
+		found, err := getJSON(srv.storage, nsCredentials, credentialID, &cred)
+		if err != nil {
+			return nil, false, fmt.Errorf("读取凭证失败: %v", err)
+		}
+		if !found || cred.RevokedAt != 0 || cred.Pending {
+			return nil, false, nil
+		}
+		if cred.Wallet == "" {
+			return nil, false, fmt.Errorf("钱包创建交易尚未确认: %s", cred.TxHash)
+		}
+		wallet = cred.Wallet
+	} else {
+		id, err := walletKeyID(key)
+		if err != nil {
+			return nil, false, err
+		}
+		var entry walletKeyEntry
+		found, err := getJSON(srv.storage, nsWalletKeys, id, &entry)
+		if err != nil {
+			return nil, false, fmt.Errorf("读取公钥索引失败: %v", err)
+		}
+		if !found {
+			return nil, false, nil
+		}
+		wallet = entry.Wallet
+	}
+
+	var rec walletRecord
+	found, err := getJSON(srv.storage, nsWallets, common.HexToAddress(wallet).Hex(), &rec)
+	if err != nil {
+		return nil, false, fmt.Errorf("读取钱包登记失败: %v", err)
+	}
+	if !found {
+		return nil, false, nil
+	}
+	if rec.Credentials == nil {
+		rec.Credentials = []string{}
+	}
+	return &rec, true, nil
+}
+
+// handleWalletLookup 按凭证或公钥查找钱包，前端不需要自己保存钱包地址
+//
+//	GET /api/wallet/lookup?credentialId=<base64url>
+//	GET /api/wallet/lookup?x=0x...&y=0x...
+func (srv *Server) handleWalletLookup(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	credentialID := q.Get("credentialId")
+	key := PublicKeyHex{X: q.Get("x"), Y: q.Get("y")}
+	if credentialID == "" && (key.X == "" || key.Y == "") {
+		sendError(w, "缺少参数: credentialId 或 x / y")
+		return
+	}
+
+	rec, found, err := srv.lookupWallet(credentialID, key)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	if !found {
+		sendError(w, "未找到钱包")
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Data: rec})
+}
+
+// GET /api/wallet 返回的钱包地址来源
+const (
+	walletSourceFactory  = "factory"  // 工厂合约 getWallet / wallets
+	walletSourceRegistry = "registry" // 服务端钱包登记 (旧版工厂没有 getWallet)
+)
+
+// WalletAddressData GET /api/wallet 返回数据
+type WalletAddressData struct {
+	Wallet   string `json:"wallet"`
+	Type     string `json:"type"`
+	Factory  string `json:"factory"`
+	Source   string `json:"source"`   // factory / registry
+	Deployed bool   `json:"deployed"` // 地址上已有合约代码
+}
+
+// factoryWallet 按钱包类型的顺序 (默认类型在前) 调用各工厂的 getter，返回第一个非零地址
+//
+// 工厂没有该方法 (旧版工厂、其它钱包类型的工厂) 时调用回滚或返回值无法解析，跳过该工厂；
+// 节点 / 网络错误直接返回，调用方据此区分 "未找到" 与 "RPC 不可用"。
+func (srv *Server) factoryWallet(ctx context.Context, method string, args ...interface{}) (*WalletAddressData, bool, error) {
+	cfg := srv.Config()
+	type candidate struct {
+		factory common.Address
+		typ     string
+	}
+	var candidates []candidate
+	if common.IsHexAddress(cfg.Contract) {
+		candidates = append(candidates, candidate{common.HexToAddress(cfg.Contract), defaultWalletType})
+	}
+	for _, wt := range cfg.WalletTypes {
+		candidates = append(candidates, candidate{common.HexToAddress(wt.Factory), wt.Name})
+	}
+
+	parsedABI, _ := abi.JSON(strings.NewReader(factoryABI))
+	data, err := parsedABI.Pack(method, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	seen := make(map[common.Address]bool)
+	for _, c := range candidates {
+		if seen[c.factory] {
+			continue
+		}
+		seen[c.factory] = true
+		out, err := srv.eth().CallContract(ctx, ethereum.CallMsg{To: &c.factory, Data: data}, nil)
+		if err != nil {
+			if isReverted(err) {
+				continue
+			}
+			srv.rpc.reportError(err)
+			return nil, false, fmt.Errorf("查询工厂合约失败: %v", err)
+		}
+		values, err := parsedABI.Unpack(method, out)
+		if err != nil || len(values) != 1 {
+			continue
+		}
+		if wallet, ok := values[0].(common.Address); ok && wallet != (common.Address{}) {
+			return &WalletAddressData{Wallet: wallet.Hex(), Type: c.typ, Factory: c.factory.Hex(), Source: walletSourceFactory}, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// handleWallet 按公钥或创建者查询已部署的钱包地址: 先查工厂合约，工厂不支持时回退到钱包登记
+//
+//	GET /api/wallet?x=0x...&y=0x...   工厂 getWallet(x, y)
+//	GET /api/wallet?owner=0x...       工厂 wallets(owner)，owner 为调用 createWallet 的地址
+//	                                  (经本服务中继创建的钱包 owner 是中继账户，请按公钥查询)
+func (srv *Server) handleWallet(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	var (
+		data  *WalletAddressData
+		found bool
+		err   error
+	)
+	switch owner := q.Get("owner"); {
+	case owner != "":
+		if !common.IsHexAddress(owner) {
+			sendError(w, "owner 地址格式错误: "+owner)
+			return
+		}
+		if data, found, err = srv.factoryWallet(ctx, "wallets", common.HexToAddress(owner)); err != nil {
+			sendError(w, err.Error())
+			return
+		}
+	case q.Get("x") != "" && q.Get("y") != "":
+		key := PublicKeyHex{X: q.Get("x"), Y: q.Get("y")}
+		x, err := parseBytes32(key.X)
+		if err != nil {
+			sendError(w, "公钥 x 格式错误: "+err.Error())
+			return
+		}
+		y, err := parseBytes32(key.Y)
+		if err != nil {
+			sendError(w, "公钥 y 格式错误: "+err.Error())
+			return
+		}
+		if data, found, err = srv.factoryWallet(ctx, "getWallet", x, y); err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		if !found {
+			rec, ok, err := srv.lookupWallet("", key)
+			if err != nil {
+				sendError(w, err.Error())
+				return
+			}
+			if ok {
+				data = &WalletAddressData{Wallet: rec.Wallet, Type: rec.Type, Factory: rec.Factory, Source: walletSourceRegistry}
+				found = true
+			}
+		}
+	default:
+		sendError(w, "缺少参数: x / y 或 owner")
+		return
+	}
+	if !found {
+		sendError(w, "未找到钱包 (创建交易可能尚未上链)")
+		return
+	}
+
+	code, err := srv.eth().CodeAt(ctx, common.HexToAddress(data.Wallet), nil)
+	if err != nil {
+		srv.rpc.reportError(err)
+		sendError(w, "查询钱包代码失败: "+err.Error())
+		return
+	}
+	data.Deployed = len(code) > 0
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Data: data})
+}
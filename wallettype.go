@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 钱包类型的中继编码方式
+const (
+	walletEncoderPasskey = "passkey"     // PasskeyWallet: 中继直接调用钱包的 transferERC20 / execute
+	walletEncoderAA      = "4337"        // 4337 账户: 调用数据同上，封装为 UserOperation 提交
+	walletEncoderSafe    = "safe-module" // Safe + Passkey 模块: 交易发给模块的 execTransaction
+)
+
+// defaultWalletType 未指定 walletType 时使用 contract + relay_mode
+const defaultWalletType = "default"
+
+// WalletTypeConfig 一种钱包类型 (工厂 + 中继编码方式)
+//
+// 工厂需实现 createWallet(x, y) / createWallets(xs, ys) 与 WalletCreated 事件 (同 PasskeyWalletFactory)。
+type WalletTypeConfig struct {
+	Name    string `yaml:"name"`
+	Factory string `yaml:"factory"`
+	Encoder string `yaml:"encoder"` // passkey (默认) / 4337 / safe-module
+	Module  string `yaml:"module"`  // safe-module: Passkey 模块地址
+}
+
+// Safe Passkey 模块 ABI: 模块校验 P-256 签名后通过 execTransactionFromModule 执行
+const safePasskeyModuleABI = `[
+	{
+		"inputs": [
+			{"name": "safe", "type": "address"},
+			{"name": "to", "type": "address"},
+			{"name": "value", "type": "uint256"},
+			{"name": "data", "type": "bytes"},
+			{"name": "hash", "type": "bytes32"},
+			{"name": "r", "type": "bytes32"},
+			{"name": "s", "type": "bytes32"}
+		],
+		"name": "execTransaction",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	}
+]`
+
+// walletRecord 钱包登记 (nsWallets，key = 钱包地址)，创建交易上链后写入
+type walletRecord struct {
+	Wallet      string       `json:"wallet"`
+	Type        string       `json:"type"`
+	Factory     string       `json:"factory"`
+	Credentials []string     `json:"credentials"`        // 链上已授权的凭证 (credentialId)，批量创建的钱包为空
+	PublicKey   PublicKeyHex `json:"publicKey"`          // 创建钱包时的公钥
+	UserName    string       `json:"userName,omitempty"` // 创建钱包的 Passkey 注册时填写的用户名
+	TxHash      string       `json:"txHash"`
+	CreatedAt   int64        `json:"createdAt"`
+	FrozenAt    int64        `json:"frozenAt,omitempty"` // 非 0 表示已冻结，服务端拒绝中继转账
+}
+
+// walletType 按名称查找钱包类型，空名称返回由 contract / relay_mode 构成的默认类型
+func (srv *Server) walletType(name string) (*WalletTypeConfig, error) {
+	cfg := srv.Config()
+	if name == "" || name == defaultWalletType {
+		wt := &WalletTypeConfig{Name: defaultWalletType, Factory: cfg.Contract, Encoder: walletEncoderPasskey}
+		if cfg.RelayMode == relayModeUserOp {
+			wt.Encoder = walletEncoderAA
+		}
+		return wt, nil
+	}
+	for _, wt := range cfg.WalletTypes {
+		if wt.Name == name {
+			if wt.Encoder == "" {
+				wt.Encoder = walletEncoderPasskey
+			}
+			return &wt, nil
+		}
+	}
+	return nil, fmt.Errorf("未知钱包类型: %s", name)
+}
+
+// walletTypeNames 可选的钱包类型名称，默认类型在前
+func walletTypeNames(types []WalletTypeConfig) []string {
+	names := []string{defaultWalletType}
+	for _, wt := range types {
+		names = append(names, wt.Name)
+	}
+	return names
+}
+
+// validateWalletTypes 启动时检查 wallet_types 配置
+func validateWalletTypes(types []WalletTypeConfig) error {
+	seen := make(map[string]bool)
+	for _, wt := range types {
+		if wt.Name == "" || wt.Name == defaultWalletType || seen[wt.Name] {
+			return fmt.Errorf("wallet_types: 名称 %q 为空、重复或与默认类型冲突", wt.Name)
+		}
+		seen[wt.Name] = true
+		if !common.IsHexAddress(wt.Factory) {
+			return fmt.Errorf("wallet_types.%s: factory 地址格式错误", wt.Name)
+		}
+		switch wt.Encoder {
+		case "", walletEncoderPasskey, walletEncoderAA:
+		case walletEncoderSafe:
+			if !common.IsHexAddress(wt.Module) {
+				return fmt.Errorf("wallet_types.%s: safe-module 需要配置 module 地址", wt.Name)
+			}
+		default:
+			return fmt.Errorf("wallet_types.%s: 未知 encoder %s", wt.Name, wt.Encoder)
+		}
+	}
+	return nil
+}
+
+// walletTypeFor 返回钱包登记的类型，没有登记 (如迁移前创建的钱包) 时使用默认类型
+func (srv *Server) walletTypeFor(wallet common.Address) *WalletTypeConfig {
+	var rec walletRecord
+	if found, err := getJSON(srv.storage, nsWallets, wallet.Hex(), &rec); err == nil && found {
+		if wt, err := srv.walletType(rec.Type); err == nil {
+			return wt
+		}
+		log.Printf("钱包 %s 登记的类型 %s 已不在配置中，使用默认类型", wallet.Hex(), rec.Type)
+	}
+	wt, _ := srv.walletType("")
+	return wt
+}
+
+// walletCall 按钱包类型编码转账调用，返回交易目标与调用数据
+func (srv *Server) walletCall(wt *WalletTypeConfig, req *ERC20TransferRequest) (common.Address, []byte, error) {
+	wallet := common.HexToAddress(req.Wallet)
+	if wt.Encoder != walletEncoderSafe {
+		callData, err := srv.erc20TransferCallData(req)
+		return wallet, callData, err
+	}
+
+	// Safe 模块: execTransaction(safe, token, 0, transfer(to, amount) ++ memo, hash, r, s)
+	amount, ok := new(big.Int).SetString(req.Amount, 10)
+	if !ok {
+		return common.Address{}, nil, fmt.Errorf("金额格式错误")
+	}
+	var memo []byte
+	if srv.Config().MemoOnChain {
+		memo = []byte(req.Memo)
+	}
+	transferData, err := encodeERC20TransferWithSuffix(common.HexToAddress(req.To), amount, memo)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	parsedABI, _ := abi.JSON(strings.NewReader(safePasskeyModuleABI))
+	callData, err := parsedABI.Pack("execTransaction", wallet, common.HexToAddress(req.Token), big.NewInt(0), transferData,
+		hexToBytes32(req.WebAuthn.MessageHash), hexToBytes32(req.Signature.R), hexToBytes32(req.Signature.S))
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	return common.HexToAddress(wt.Module), callData, nil
+}
+
+// walletExecuteCall 把对 to 的任意调用编码为钱包调用，返回交易目标与调用数据
+//
+// PasskeyWallet / 4337 账户为 execute(to, value, data, signature)，Safe 模块为
+// execTransaction(safe, to, value, data, hash, r, s)。
+func (srv *Server) walletExecuteCall(wt *WalletTypeConfig, wallet, to common.Address, value *big.Int, data []byte, passkey *PasskeyData, requestID string) (common.Address, []byte, error) {
+	if wt.Encoder == walletEncoderSafe {
+		parsedABI, _ := abi.JSON(strings.NewReader(safePasskeyModuleABI))
+		callData, err := parsedABI.Pack("execTransaction", wallet, to, value, data,
+			hexToBytes32(passkey.WebAuthn.MessageHash), hexToBytes32(passkey.Signature.R), hexToBytes32(passkey.Signature.S))
+		if err != nil {
+			return common.Address{}, nil, fmt.Errorf("编码调用数据失败: %v", err)
+		}
+		return common.HexToAddress(wt.Module), callData, nil
+	}
+
+	cfg := srv.Config()
+	extra := 0
+	if cfg.TraceCalldata {
+		extra = len(traceTagMagic) + traceIDBytes
+	}
+	callData, err := encodeExecute(to, value, data, webauthnSignature(passkey), extra)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	if cfg.TraceCalldata {
+		callData = appendTraceTag(callData, requestID)
+	}
+	return wallet, callData, nil
+}
+
+// registerWallets 等待创建交易上链，按 WalletCreated 事件登记钱包类型
+// credentialID 仅在单个钱包创建时传入
+func (srv *Server) registerWallets(txHash common.Hash, wt *WalletTypeConfig, credentialID string) {
+	receipt, err := srv.waitReceipt(txHash)
+	if err != nil {
+		log.Printf("登记钱包失败: %v", err)
+		return
+	}
+	srv.walletRecordMu.Lock()
+	defer srv.walletRecordMu.Unlock()
+	for key, wallet := range walletsFromReceipt(receipt) {
+		rec := walletRecord{
+			Wallet:      wallet.Hex(),
+			Type:        wt.Name,
+			Factory:     common.HexToAddress(wt.Factory).Hex(),
+			Credentials: []string{},
+			PublicKey:   key,
+			TxHash:      txHash.Hex(),
+			CreatedAt:   time.Now().Unix(),
+		}
+		if credentialID != "" {
+			rec.Credentials = append(rec.Credentials, credentialID)
+			srv.updateCredential(credentialID, func(cred *Credential) {
+				cred.Wallet = rec.Wallet
+				rec.UserName = cred.UserName
+			})
+		}
+		if err := putJSON(srv.storage, nsWallets, rec.Wallet, rec, 0); err != nil {
+			log.Printf("登记钱包 %s 失败: %v", rec.Wallet, err)
+		}
+		srv.indexWalletKey(key, wallet, credentialID)
+		srv.indexer.track(wallet)
+		if srv.dev != nil {
+			go srv.fundDevWallet(wallet)
+		}
+	}
+}
@@ -0,0 +1,573 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// registrationTTL 注册 challenge 有效期
+const registrationTTL = 5 * time.Minute
+
+// coseAlgES256 COSE 算法 ES256 (P-256 + SHA-256)
+const coseAlgES256 = -7
+
+// WebAuthnConfig Relying Party 配置
+type WebAuthnConfig struct {
+	RPID      string   `yaml:"rp_id"`      // 默认取请求 Host (不含端口)
+	RPName    string   `yaml:"rp_name"`    // 默认 "Passkey Wallet"
+	Origins   []string `yaml:"origins"`    // 允许的 origin，留空时要求 origin 的域名等于 rp_id 或为其子域名
+	RequireUV bool     `yaml:"require_uv"` // 转账/会话签名是否要求 UV (注册始终要求)
+
+	RequiredAttestation string   `yaml:"required_attestation"` // 注册要求的 attestation 等级: none (默认) / attested / trusted
+	AttestationRoots    []string `yaml:"attestation_roots"`    // 验证 attestation 证书链的根证书 (PEM 文件)，如 Apple / Google / TPM 厂商 / FIDO MDS 根证书
+}
+
+// registrationChallenge 注册 challenge 记录 (nsChallenges，key = register/<challenge>)
+type registrationChallenge struct {
+	RPID       string `json:"rpId"`
+	UserID     string `json:"userId"`
+	UserName   string `json:"userName"`
+	WalletType string `json:"walletType,omitempty"`
+	Wallet     string `json:"wallet,omitempty"` // 为已有钱包添加设备
+}
+
+// Credential 已注册的 Passkey 凭证 (nsCredentials，key = credentialId)
+type Credential struct {
+	ID          string            `json:"id"` // base64url
+	PublicKey   PublicKeyHex      `json:"publicKey"`
+	UserName    string            `json:"userName"`
+	UserHandle  string            `json:"userHandle,omitempty"` // 注册时的 user.id (base64url)，登录断言中的 userHandle
+	Format      string            `json:"format"`               // attestation 格式
+	Attestation attestationResult `json:"attestation"`
+	SignCount   uint32            `json:"signCount"`
+	TxHash      string            `json:"txHash"` // 创建钱包或添加公钥的交易
+	WalletType  string            `json:"walletType"`
+	Wallet      string            `json:"wallet,omitempty"`  // 所属钱包，创建交易上链 / 公钥添加后写入
+	Pending     bool              `json:"pending,omitempty"` // 新设备凭证，等待已授权 Passkey 签名添加
+	RevokedAt   int64             `json:"revokedAt,omitempty"`
+	CreatedAt   int64             `json:"createdAt"`
+}
+
+// RegisterBeginRequest /api/register/begin 请求
+type RegisterBeginRequest struct {
+	UserName   string `json:"userName"`
+	WalletType string `json:"walletType"` // 钱包类型 (见 /api/config 的 walletTypes)，默认 default
+	Wallet     string `json:"wallet"`     // 为已有钱包注册新设备: 不创建钱包，凭证等待已授权 Passkey 添加
+}
+
+// RegisterFinishRequest /api/register/finish 请求 (字段均为 base64url)
+type RegisterFinishRequest struct {
+	CredentialID      string `json:"credentialId"`
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AttestationObject string `json:"attestationObject"`
+}
+
+// RegisterFinishData /api/register/finish 返回数据
+type RegisterFinishData struct {
+	CredentialID string            `json:"credentialId"`
+	PublicKey    PublicKeyHex      `json:"publicKey"`
+	Attestation  attestationResult `json:"attestation"`
+
+	RawTransaction *RawTxData `json:"rawTransaction,omitempty"` // broadcast=false 时返回
+}
+
+// creationOptions PublicKeyCredentialCreationOptions (二进制字段为 base64url)
+type creationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		Name string `json:"name"`
+		ID   string `json:"id"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	AuthenticatorSelection struct {
+		AuthenticatorAttachment string `json:"authenticatorAttachment"`
+		UserVerification        string `json:"userVerification"`
+		ResidentKey             string `json:"residentKey"`
+		RequireResidentKey      bool   `json:"requireResidentKey"`
+	} `json:"authenticatorSelection"`
+	Timeout     int    `json:"timeout"`
+	Attestation string `json:"attestation"`
+}
+
+// clientData clientDataJSON 中用到的字段
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// parseClientData 解码并严格校验 clientDataJSON，返回解析结果与原始字节 (用于计算 clientDataHash)
+// challenge 与 origin 的匹配由调用方完成
+func parseClientData(encoded, wantType string) (*clientData, []byte, error) {
+	raw, err := decodeB64URL(encoded)
+	if err != nil || len(raw) == 0 {
+		return nil, nil, fmt.Errorf("clientDataJSON 不是有效的 base64url")
+	}
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, nil, fmt.Errorf("clientDataJSON 解析失败: %v", err)
+	}
+	if cd.Type != wantType {
+		return nil, nil, fmt.Errorf("clientDataJSON.type 必须是 %s，实际为 %q", wantType, cd.Type)
+	}
+	challenge, err := decodeB64URL(cd.Challenge)
+	if err != nil || len(challenge) != 32 {
+		return nil, nil, fmt.Errorf("clientDataJSON.challenge 不是服务端签发的 32 字节 challenge")
+	}
+	if cd.Origin == "" {
+		return nil, nil, fmt.Errorf("clientDataJSON 缺少 origin")
+	}
+	if cd.CrossOrigin {
+		return nil, nil, fmt.Errorf("不接受跨域 iframe 中产生的签名")
+	}
+	return &cd, raw, nil
+}
+
+// rpID 返回配置的 RP ID，未配置时取请求 Host
+func (srv *Server) rpID(r *http.Request) string {
+	if id := srv.Config().WebAuthn.RPID; id != "" {
+		return id
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
+
+// originAllowed 检查 clientDataJSON 中的 origin
+func (srv *Server) originAllowed(origin, rpID string) bool {
+	if allowed := srv.Config().WebAuthn.Origins; len(allowed) > 0 {
+		for _, o := range allowed {
+			if o == origin {
+				return true
+			}
+		}
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if u.Scheme != "https" && host != "localhost" {
+		return false
+	}
+	return host == rpID || strings.HasSuffix(host, "."+rpID)
+}
+
+// decodeB64URL 兼容带 / 不带填充的 base64url
+func decodeB64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// parsedAttestation 解析后的 attestationObject
+type parsedAttestation struct {
+	Format       string
+	AttStmt      map[interface{}]interface{}
+	AuthData     []byte
+	Info         *AuthenticatorDataInfo
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    *ecdsa.PublicKey
+	Extensions   map[interface{}]interface{} // 认证器扩展输出 (ED 标志位)
+}
+
+// parseAttestationObject 解码 navigator.credentials.create 返回的原始 attestationObject，
+// 拆出 fmt、attStmt、authData，并解析 authData 中的凭证 ID、COSE 公钥与扩展
+func parseAttestationObject(raw []byte) (*parsedAttestation, error) {
+	v, trailing, err := cborDecode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("attestationObject 解码失败: %v", err)
+	}
+	if len(trailing) > 0 {
+		return nil, fmt.Errorf("attestationObject 末尾有 %d 字节多余数据", len(trailing))
+	}
+	obj, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("attestationObject 不是 CBOR 映射")
+	}
+	att := &parsedAttestation{}
+	if att.Format, ok = obj["fmt"].(string); !ok || att.Format == "" {
+		return nil, fmt.Errorf("attestationObject 缺少 fmt")
+	}
+	if att.AttStmt, ok = obj["attStmt"].(map[interface{}]interface{}); !ok {
+		return nil, fmt.Errorf("attestationObject 缺少 attStmt")
+	}
+	if att.AuthData, ok = obj["authData"].([]byte); !ok {
+		return nil, fmt.Errorf("attestationObject 缺少 authData")
+	}
+
+	// authData: rpIdHash(32) flags(1) signCount(4) [aaguid(16) credIdLen(2) credId COSE_Key] [extensions]
+	att.Info, err = parseAuthenticatorData(att.AuthData)
+	if err != nil {
+		return nil, err
+	}
+	if !att.Info.Flags.Attested {
+		return nil, fmt.Errorf("authData 缺少 attestedCredentialData")
+	}
+	rest := att.AuthData[authDataMinLength:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("attestedCredentialData 长度不足")
+	}
+	att.AAGUID = rest[:16]
+	credLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < credLen {
+		return nil, fmt.Errorf("credentialId 长度无效")
+	}
+	att.CredentialID, rest = rest[:credLen], rest[credLen:]
+
+	// COSE_Key 没有长度前缀，先完整解码一次确定边界，剩余部分为扩展
+	_, ext, err := cborDecode(rest)
+	if err != nil {
+		return nil, fmt.Errorf("COSE 公钥解码失败: %v", err)
+	}
+	att.PublicKey, err = parseCOSEKey(rest[:len(rest)-len(ext)])
+	if err != nil {
+		return nil, err
+	}
+	if att.Info.Flags.Extensions {
+		v, trailing, err := cborDecode(ext)
+		if err != nil {
+			return nil, fmt.Errorf("authData 扩展解码失败: %v", err)
+		}
+		if att.Extensions, ok = v.(map[interface{}]interface{}); !ok || len(trailing) > 0 {
+			return nil, fmt.Errorf("authData 扩展格式无效")
+		}
+	} else if len(ext) > 0 {
+		return nil, fmt.Errorf("authData 末尾有 %d 字节多余数据", len(ext))
+	}
+	return att, nil
+}
+
+// parseCOSEKey 解析 EC2 / P-256 / ES256 的 COSE_Key
+func parseCOSEKey(raw []byte) (*ecdsa.PublicKey, error) {
+	v, _, err := cborDecode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("COSE 公钥解码失败: %v", err)
+	}
+	key, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("COSE 公钥不是 CBOR 映射")
+	}
+	if kty, _ := key[int64(1)].(int64); kty != 2 {
+		return nil, fmt.Errorf("公钥类型不是 EC2")
+	}
+	if alg, _ := key[int64(3)].(int64); alg != coseAlgES256 {
+		return nil, fmt.Errorf("公钥算法不是 ES256")
+	}
+	if crv, _ := key[int64(-1)].(int64); crv != 1 {
+		return nil, fmt.Errorf("公钥曲线不是 P-256")
+	}
+	x, _ := key[int64(-2)].([]byte)
+	y, _ := key[int64(-3)].([]byte)
+	if len(x) != 32 || len(y) != 32 {
+		return nil, fmt.Errorf("公钥坐标长度无效")
+	}
+
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, fmt.Errorf("公钥不在 P-256 曲线上")
+	}
+	return pub, nil
+}
+
+// UnmarshalJSON 同时接受 {"x","y"} 坐标和 {"cose": "..."} 原始 COSE_Key
+// cose 可以是 base64url 或 0x 开头的十六进制，解析后填入 x/y
+func (k *PublicKeyHex) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		X    string `json:"x"`
+		Y    string `json:"y"`
+		COSE string `json:"cose"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*k = PublicKeyHex{X: raw.X, Y: raw.Y}
+	if raw.COSE == "" {
+		return nil
+	}
+
+	var der []byte
+	var err error
+	if strings.HasPrefix(raw.COSE, "0x") {
+		der, err = hex.DecodeString(raw.COSE[2:])
+	} else {
+		der, err = decodeB64URL(raw.COSE)
+	}
+	if err != nil {
+		return fmt.Errorf("cose 编码无效: %v", err)
+	}
+	pub, err := parseCOSEKey(der)
+	if err != nil {
+		return err
+	}
+
+	parsed := PublicKeyHex{X: common.BigToHash(pub.X).Hex(), Y: common.BigToHash(pub.Y).Hex()}
+	if raw.X != "" || raw.Y != "" {
+		if common.HexToHash(raw.X).Hex() != parsed.X || common.HexToHash(raw.Y).Hex() != parsed.Y {
+			return fmt.Errorf("x/y 与 cose 公钥不一致")
+		}
+	}
+	*k = parsed
+	return nil
+}
+
+// createWalletTx 调用钱包类型对应工厂的 createWallet(x, y)，broadcast 为 false 时只签名
+func (srv *Server) createWalletTx(wt *WalletTypeConfig, x, y [32]byte, broadcast bool) (*types.Transaction, error) {
+	parsedABI, _ := abi.JSON(strings.NewReader(factoryABI))
+	callData, err := parsedABI.Pack("createWallet", x, y)
+	if err != nil {
+		return nil, fmt.Errorf("编码调用数据失败: %v", err)
+	}
+	return srv.relayTransaction(common.HexToAddress(wt.Factory), big.NewInt(0), callData, broadcast)
+}
+
+// handleRegisterBegin 签发注册 challenge 并返回 PublicKeyCredentialCreationOptions
+func (srv *Server) handleRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req RegisterBeginRequest
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+	}
+	if req.UserName == "" {
+		req.UserName = "passkey-user"
+	}
+	wt, err := srv.walletType(req.WalletType)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	if req.Wallet != "" {
+		if !common.IsHexAddress(req.Wallet) {
+			sendError(w, "wallet 地址格式错误: "+req.Wallet)
+			return
+		}
+		req.Wallet = common.HexToAddress(req.Wallet).Hex()
+		wt = srv.walletTypeFor(common.HexToAddress(req.Wallet))
+	}
+
+	challenge := make([]byte, 32)
+	rand.Read(challenge)
+	userID := make([]byte, 16)
+	rand.Read(userID)
+
+	cfg := srv.Config().WebAuthn
+	var opts creationOptions
+	opts.Challenge = base64.RawURLEncoding.EncodeToString(challenge)
+	opts.RP.Name = cfg.RPName
+	if opts.RP.Name == "" {
+		opts.RP.Name = "Passkey Wallet"
+	}
+	opts.RP.ID = srv.rpID(r)
+	opts.User.ID = base64.RawURLEncoding.EncodeToString(userID)
+	opts.User.Name = req.UserName
+	opts.User.DisplayName = req.UserName
+	opts.PubKeyCredParams = append(opts.PubKeyCredParams, struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	}{"public-key", coseAlgES256})
+	opts.AuthenticatorSelection.AuthenticatorAttachment = "platform"
+	opts.AuthenticatorSelection.UserVerification = "required"
+	// 可发现凭证: 新浏览器中无需用户名即可用 /api/login 找回钱包
+	opts.AuthenticatorSelection.ResidentKey = "required"
+	opts.AuthenticatorSelection.RequireResidentKey = true
+	opts.Timeout = int(registrationTTL / time.Millisecond)
+	opts.Attestation = "none"
+	if cfg.RequiredAttestation != "" && cfg.RequiredAttestation != attestationLevelNone {
+		// 不请求 direct 时浏览器会把 attestation 替换为 none
+		opts.Attestation = "direct"
+	}
+
+	record := registrationChallenge{RPID: opts.RP.ID, UserID: opts.User.ID, UserName: req.UserName, WalletType: wt.Name, Wallet: req.Wallet}
+	if err := setCacheJSON(srv.shared, nsChallenges, "register/"+opts.Challenge, record, registrationTTL); err != nil {
+		sendError(w, "保存 challenge 失败: "+err.Error())
+		return
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Data:    opts,
+	})
+}
+
+// handleRegisterFinish 校验 attestation，提取 COSE 公钥后创建钱包
+func (srv *Server) handleRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	if srv.signer() == nil {
+		sendError(w, "未配置私钥，无法发送交易")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, "读取请求失败")
+		return
+	}
+	var req RegisterFinishRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		sendError(w, "JSON 解析失败: "+err.Error())
+		return
+	}
+
+	cd, clientDataRaw, err := parseClientData(req.ClientDataJSON, "webauthn.create")
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	attRaw, err := decodeB64URL(req.AttestationObject)
+	if err != nil {
+		sendError(w, "attestationObject 格式错误")
+		return
+	}
+
+	var record registrationChallenge
+	if !srv.takeChallenge("register/"+strings.TrimRight(cd.Challenge, "="), &record) {
+		sendError(w, "challenge 无效或已过期，请重新开始注册")
+		return
+	}
+	if !srv.originAllowed(cd.Origin, record.RPID) {
+		sendError(w, "origin 不被允许: "+cd.Origin)
+		return
+	}
+
+	att, err := parseAttestationObject(attRaw)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	// 注册时始终要求 UV
+	if _, err := checkAuthenticatorData(att.AuthData, record.RPID, true); err != nil {
+		sendVerificationError(w, err)
+		return
+	}
+	cfg := srv.Config().WebAuthn
+	roots, err := loadAttestationRoots(cfg.AttestationRoots)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	clientDataHash := sha256.Sum256(clientDataRaw)
+	attResult, err := verifyAttestation(att, clientDataHash[:], roots)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+	if err := enforceAttestationLevel(cfg.RequiredAttestation, attResult); err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	credID := base64.RawURLEncoding.EncodeToString(att.CredentialID)
+	if req.CredentialID != "" && strings.TrimRight(req.CredentialID, "=") != credID {
+		sendError(w, "credentialId 与 attestation 不一致")
+		return
+	}
+	if _, exists, _ := srv.storage.Get(nsCredentials, credID); exists {
+		sendError(w, "该凭证已注册")
+		return
+	}
+
+	wt, err := srv.walletType(record.WalletType)
+	if err != nil {
+		sendError(w, err.Error())
+		return
+	}
+
+	var x, y [32]byte
+	att.PublicKey.X.FillBytes(x[:])
+	att.PublicKey.Y.FillBytes(y[:])
+	cred := Credential{
+		ID:          credID,
+		PublicKey:   PublicKeyHex{X: common.Hash(x).Hex(), Y: common.Hash(y).Hex()},
+		UserName:    record.UserName,
+		UserHandle:  record.UserID,
+		Format:      att.Format,
+		Attestation: *attResult,
+		SignCount:   att.Info.SignCount,
+		WalletType:  wt.Name,
+		CreatedAt:   time.Now().Unix(),
+	}
+
+	// 为已有钱包注册的新设备: 不创建钱包，等待已授权 Passkey 签名添加
+	if record.Wallet != "" {
+		cred.Wallet = record.Wallet
+		cred.Pending = true
+		if err := putJSON(srv.storage, nsCredentials, credID, cred, 0); err != nil {
+			sendError(w, "保存凭证失败: "+err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "新设备 Passkey 已验证，请用已授权的 Passkey 签名 add-key challenge 后调用 POST /api/wallet/" + record.Wallet + "/credentials",
+			Data:    RegisterFinishData{CredentialID: credID, PublicKey: cred.PublicKey, Attestation: *attResult},
+		})
+		return
+	}
+
+	broadcast := broadcastRequested(r)
+	signedTx, err := srv.createWalletTx(wt, x, y, broadcast)
+	if err != nil {
+		sendError(w, "创建钱包失败: "+err.Error())
+		return
+	}
+	txHash := signedTx.Hash()
+
+	cred.TxHash = txHash.Hex()
+	if err := putJSON(srv.storage, nsCredentials, credID, cred, 0); err != nil {
+		sendError(w, "保存凭证失败: "+err.Error())
+		return
+	}
+	if broadcast {
+		go srv.registerWallets(txHash, wt, credID)
+	}
+
+	data := RegisterFinishData{CredentialID: credID, PublicKey: cred.PublicKey, Attestation: *attResult}
+	message := "Passkey 已验证，钱包创建交易已发送，请等待确认后查询钱包地址"
+	if !broadcast {
+		raw := srv.rawTxData(signedTx)
+		data.RawTransaction = &raw
+		message = "Passkey 已验证，钱包创建交易已签名，未广播"
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Message: message,
+		TxHash:  txHash.Hex(),
+		Data:    data,
+	})
+}
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"secp256R1-demo/chaintest"
+)
+
+// loadTestRejectCode 对任意调用都返回 uint256(0) 的 runtime code: verifySignature 返回 false
+var loadTestRejectCode = common.FromHex("0x600060005260206000f3")
+
+// resign 按修改后的 authenticatorData / clientDataJSON 重新计算 messageHash 并用认证器私钥签名
+func resign(t *testing.T, a *softAuthenticator, data *PasskeyData) {
+	t.Helper()
+	authData := common.FromHex(data.WebAuthn.AuthenticatorData)
+	clientDataJSON, err := decodeB64URL(data.WebAuthn.ClientDataJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	messageHash := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	r, s, err := ecdsa.Sign(rand.Reader, a.key, messageHash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Signature.R = common.BigToHash(r).Hex()
+	data.Signature.S = common.BigToHash(s).Hex()
+	data.WebAuthn.MessageHash = common.Hash(messageHash).Hex()
+}
+
+// withOrigin 改写断言的 origin 后重新签名
+func withOrigin(t *testing.T, a *softAuthenticator, data *PasskeyData, origin string) *PasskeyData {
+	t.Helper()
+	raw, _ := decodeB64URL(data.WebAuthn.ClientDataJSON)
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		t.Fatal(err)
+	}
+	cd.Origin = origin
+	raw, _ = json.Marshal(cd)
+	data.WebAuthn.ClientDataJSON = base64.RawURLEncoding.EncodeToString(raw)
+	resign(t, a, data)
+	return data
+}
+
+// randomChallenge 服务端没有签发过的 challenge
+func randomChallenge() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// newAuthTestServer 在本地模拟链上启动服务 (RP 与压测相同)，返回服务与走 HTTP 的客户端
+func newAuthTestServer(t *testing.T, alloc types.GenesisAlloc) (*Server, *loadTestClient) {
+	t.Helper()
+	chain, endpoint, err := chaintest.NewWithRPC(alloc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.Close() })
+	conn, err := dialRPC(RPCClientConfig{}, endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+
+	cfg := &Config{
+		RPC:       endpoint,
+		CacheTTL:  10,
+		RelayMode: relayModeEOA,
+		WebAuthn:  WebAuthnConfig{RPID: loadTestRPID, Origins: []string{loadTestOrigin}},
+	}
+	srv := NewServer(cfg, conn, chaintest.ChainID, newKeySigner(chain.Relayer), newMemoryStorage(), newMemoryCache())
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return srv, &loadTestClient{base: ts.URL, http: &http.Client{Timeout: time.Minute}}
+}
+
+// issueChallenge 经 /api/challenge 获取钱包操作的 challenge
+func issueChallenge(t *testing.T, c *loadTestClient, wallet common.Address, operation string) string {
+	t.Helper()
+	_, res, err := c.post("/api/challenge", ChallengeRequest{Wallet: wallet.Hex(), Operation: operation})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Success {
+		t.Fatalf("获取 %s challenge 失败: %s", operation, res.Message)
+	}
+	var challenge ChallengeData
+	if err := remarshal(res.Data, &challenge); err != nil {
+		t.Fatal(err)
+	}
+	return challenge.Challenge
+}
+
+// registerWallet 登记钱包与创建时的公钥 (未部署钱包据此本地验签)
+func registerWallet(t *testing.T, srv *Server, wallet common.Address, a *softAuthenticator) {
+	t.Helper()
+	rec := walletRecord{
+		Wallet:    wallet.Hex(),
+		PublicKey: PublicKeyHex{X: common.BigToHash(a.key.X).Hex(), Y: common.BigToHash(a.key.Y).Hex()},
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := putJSON(srv.storage, nsWallets, wallet.Hex(), rec, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 断言校验: challenge 一次性且绑定钱包与操作，origin / rpId / messageHash 必须一致，signCount 必须递增；
+// 已部署钱包由合约 verifySignature 验签，未部署钱包按登记的公钥本地验签
+func TestAuthorizeOperation(t *testing.T) {
+	deployed := common.BigToAddress(big.NewInt(0x10000))
+	rejecting := common.BigToAddress(big.NewInt(0x10001))
+	undeployed := common.BigToAddress(big.NewInt(0x10002))
+	unregistered := common.BigToAddress(big.NewInt(0x10003))
+	srv, c := newAuthTestServer(t, types.GenesisAlloc{
+		deployed:  {Code: loadTestStubCode},
+		rejecting: {Code: loadTestRejectCode},
+	})
+
+	owner := newSoftAuthenticator(deployed)
+	holder := newSoftAuthenticator(undeployed)
+	stranger := newSoftAuthenticator(undeployed)
+	registerWallet(t, srv, undeployed, holder)
+	r := httptest.NewRequest("POST", loadTestOrigin+"/api/session", nil)
+
+	sign := func(t *testing.T, a *softAuthenticator, wallet common.Address, operation string) *PasskeyData {
+		data, err := a.assert(issueChallenge(t, c, wallet, operation))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	cases := []struct {
+		name    string
+		wallet  common.Address
+		prepare func(t *testing.T) *PasskeyData
+		wantErr string
+	}{
+		{
+			name:    "有效断言",
+			wallet:  deployed,
+			prepare: func(t *testing.T) *PasskeyData { return sign(t, owner, deployed, opSession) },
+		},
+		{
+			name:   "origin 不符",
+			wallet: deployed,
+			prepare: func(t *testing.T) *PasskeyData {
+				return withOrigin(t, owner, sign(t, owner, deployed, opSession), "https://evil.example")
+			},
+			wantErr: "origin 不被允许",
+		},
+		{
+			name:   "challenge 重复使用",
+			wallet: deployed,
+			prepare: func(t *testing.T) *PasskeyData {
+				data := sign(t, owner, deployed, opSession)
+				if err := srv.authorizeOperation(r, data, deployed, opSession); err != nil {
+					t.Fatalf("首次使用应当通过: %v", err)
+				}
+				return data
+			},
+			wantErr: "challenge 无效、已过期或已使用",
+		},
+		{
+			name:   "未签发的 challenge",
+			wallet: deployed,
+			prepare: func(t *testing.T) *PasskeyData {
+				data, _ := owner.assert(randomChallenge())
+				return data
+			},
+			wantErr: "challenge 无效、已过期或已使用",
+		},
+		{
+			name:    "challenge 属于其它操作",
+			wallet:  deployed,
+			prepare: func(t *testing.T) *PasskeyData { return sign(t, owner, deployed, opFreeze) },
+			wantErr: "challenge 与钱包或操作不匹配",
+		},
+		{
+			name:    "challenge 属于其它钱包",
+			wallet:  deployed,
+			prepare: func(t *testing.T) *PasskeyData { return sign(t, owner, rejecting, opSession) },
+			wantErr: "challenge 与钱包或操作不匹配",
+		},
+		{
+			name:   "rpId 不符",
+			wallet: deployed,
+			prepare: func(t *testing.T) *PasskeyData {
+				data := sign(t, owner, deployed, opSession)
+				authData := common.FromHex(data.WebAuthn.AuthenticatorData)
+				other := sha256.Sum256([]byte("evil.example"))
+				copy(authData, other[:])
+				data.WebAuthn.AuthenticatorData = common.Bytes2Hex(authData)
+				resign(t, owner, data)
+				return data
+			},
+			wantErr: "rpIdHash 与 RP ID",
+		},
+		{
+			name:   "messageHash 与签名内容不一致",
+			wallet: deployed,
+			prepare: func(t *testing.T) *PasskeyData {
+				data := sign(t, owner, deployed, opSession)
+				data.WebAuthn.MessageHash = common.Hash{1}.Hex()
+				return data
+			},
+			wantErr: "messageHash",
+		},
+		{
+			name:   "signCount 未递增",
+			wallet: deployed,
+			prepare: func(t *testing.T) *PasskeyData {
+				if err := srv.authorizeOperation(r, sign(t, owner, deployed, opSession), deployed, opSession); err != nil {
+					t.Fatalf("首次使用应当通过: %v", err)
+				}
+				owner.signCount-- // 克隆的凭证重复使用同一计数
+				return sign(t, owner, deployed, opSession)
+			},
+			wantErr: "signCount 未递增",
+		},
+		{
+			name:    "链上验签失败",
+			wallet:  rejecting,
+			prepare: func(t *testing.T) *PasskeyData { return sign(t, owner, rejecting, opSession) },
+			wantErr: "签名无效",
+		},
+		{
+			name:    "未部署钱包按登记公钥验签",
+			wallet:  undeployed,
+			prepare: func(t *testing.T) *PasskeyData { return sign(t, holder, undeployed, opSession) },
+		},
+		{
+			name:    "未部署钱包其它公钥签名",
+			wallet:  undeployed,
+			prepare: func(t *testing.T) *PasskeyData { return sign(t, stranger, undeployed, opSession) },
+			wantErr: "签名无效",
+		},
+		{
+			name:    "未部署且未登记的钱包",
+			wallet:  unregistered,
+			prepare: func(t *testing.T) *PasskeyData { return sign(t, stranger, unregistered, opSession) },
+			wantErr: "未部署且没有登记公钥",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := srv.authorizeOperation(r, tc.prepare(t), tc.wallet, opSession)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("应当通过: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("错误 = %v, 期望包含 %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// 冻结: 只有覆盖 freeze 摘要、由钱包公钥签名的断言才能改动服务端冻结状态
+func TestWalletFreezeAuthorization(t *testing.T) {
+	deployed := common.BigToAddress(big.NewInt(0x10000))
+	rejecting := common.BigToAddress(big.NewInt(0x10001))
+	undeployed := common.BigToAddress(big.NewInt(0x10002))
+	srv, c := newAuthTestServer(t, types.GenesisAlloc{
+		deployed:  {Code: loadTestStubCode},
+		rejecting: {Code: loadTestRejectCode},
+	})
+
+	owner := newSoftAuthenticator(deployed)
+	holder := newSoftAuthenticator(undeployed)
+	stranger := newSoftAuthenticator(undeployed)
+	registerWallet(t, srv, undeployed, holder)
+
+	sign := func(t *testing.T, a *softAuthenticator, challenge string) *PasskeyData {
+		data, err := a.assert(challenge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	cases := []struct {
+		name    string
+		wallet  common.Address
+		prepare func(t *testing.T) *PasskeyData
+		wantErr string
+	}{
+		{
+			name:   "unfreeze 的 challenge",
+			wallet: deployed,
+			prepare: func(t *testing.T) *PasskeyData {
+				return sign(t, owner, issueChallenge(t, c, deployed, opUnfreeze))
+			},
+			wantErr: "签名的 challenge 与调用内容",
+		},
+		{
+			name:    "未签发的 challenge",
+			wallet:  deployed,
+			prepare: func(t *testing.T) *PasskeyData { return sign(t, owner, randomChallenge()) },
+			wantErr: "签名的 challenge 与调用内容",
+		},
+		{
+			name:   "伪造的断言",
+			wallet: rejecting,
+			prepare: func(t *testing.T) *PasskeyData {
+				return sign(t, stranger, issueChallenge(t, c, rejecting, opFreeze))
+			},
+			wantErr: "签名无效",
+		},
+		{
+			name:   "未部署钱包其它公钥签名",
+			wallet: undeployed,
+			prepare: func(t *testing.T) *PasskeyData {
+				return sign(t, stranger, issueChallenge(t, c, undeployed, opFreeze))
+			},
+			wantErr: "签名无效",
+		},
+		{
+			name:   "未部署钱包按登记公钥冻结",
+			wallet: undeployed,
+			prepare: func(t *testing.T) *PasskeyData {
+				return sign(t, holder, issueChallenge(t, c, undeployed, opFreeze))
+			},
+		},
+		{
+			name:   "有效断言",
+			wallet: deployed,
+			prepare: func(t *testing.T) *PasskeyData {
+				return sign(t, owner, issueChallenge(t, c, deployed, opFreeze))
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, res, err := c.post("/api/wallet/"+tc.wallet.Hex()+"/freeze", tc.prepare(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantErr == "" {
+				if !res.Success {
+					t.Fatalf("应当冻结成功: %s", res.Message)
+				}
+				if !srv.walletFrozen(tc.wallet) {
+					t.Fatal("冻结成功但服务端未登记冻结")
+				}
+				return
+			}
+			if res.Success || !strings.Contains(res.Message, tc.wantErr) {
+				t.Fatalf("响应 = %v %q, 期望失败并包含 %q", res.Success, res.Message, tc.wantErr)
+			}
+			if srv.walletFrozen(tc.wallet) {
+				t.Fatal("授权失败却改动了服务端冻结状态")
+			}
+		})
+	}
+}
+
+// testAttestation 软件认证器的注册数据: authData 携带 AAGUID，clientDataHash 为任意固定值
+type testAttestation struct {
+	authData       []byte
+	clientDataHash []byte
+	aaguid         []byte
+	cred           *ecdsa.PrivateKey
+}
+
+func newTestAttestation(t *testing.T) *testAttestation {
+	t.Helper()
+	cred, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	aaguid := []byte("soft-authnr-0001")
+	rpIDHash := sha256.Sum256([]byte(loadTestRPID))
+	authData := append(rpIDHash[:], authFlagUserPresent|authFlagUserVerified|authFlagAttested)
+	authData = binary.BigEndian.AppendUint32(authData, 0)
+	authData = append(authData, aaguid...)
+	authData = binary.BigEndian.AppendUint16(authData, 4)
+	authData = append(authData, "cred"...)
+	clientDataHash := sha256.Sum256([]byte(`{"type":"webauthn.create"}`))
+	return &testAttestation{authData: authData, clientDataHash: clientDataHash[:], aaguid: aaguid, cred: cred}
+}
+
+func (ta *testAttestation) signedData() []byte {
+	return append(append([]byte{}, ta.authData...), ta.clientDataHash...)
+}
+
+// parsed 组装 verifyAttestation 的输入
+func (ta *testAttestation) parsed(format string, attStmt map[interface{}]interface{}) *parsedAttestation {
+	return &parsedAttestation{Format: format, AttStmt: attStmt, AuthData: ta.authData, AAGUID: ta.aaguid, PublicKey: &ta.cred.PublicKey}
+}
+
+// signES256 ES256 (ASN.1 DER) 签名
+func signES256(t *testing.T, key *ecdsa.PrivateKey, data []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// issueCert 签发证书，parent 为 nil 时自签名
+func issueCert(t *testing.T, tmpl *x509.Certificate, key *ecdsa.PrivateKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// aaguidExtension id-fido-gen-ce-aaguid 证书扩展
+func aaguidExtension(aaguid []byte) pkix.Extension {
+	value, _ := asn1.Marshal(aaguid)
+	return pkix.Extension{Id: oidFIDOAAGUID, Value: value}
+}
+
+// tpmPubArea 凭证公钥的 TPMT_PUBLIC (ECC P-256，nameAlg SHA-256)
+func tpmPubArea(pub *ecdsa.PublicKey) []byte {
+	var x, y [32]byte
+	pub.X.FillBytes(x[:])
+	pub.Y.FillBytes(y[:])
+	out := binary.BigEndian.AppendUint16(nil, tpmAlgECC)
+	out = binary.BigEndian.AppendUint16(out, 0x000B) // nameAlg SHA-256
+	out = binary.BigEndian.AppendUint32(out, 0x00060072)
+	out = binary.BigEndian.AppendUint16(out, 0) // authPolicy
+	out = binary.BigEndian.AppendUint16(out, tpmAlgNull)
+	out = binary.BigEndian.AppendUint16(out, tpmAlgNull)
+	out = binary.BigEndian.AppendUint16(out, tpmECCNistP256)
+	out = binary.BigEndian.AppendUint16(out, tpmAlgNull)
+	out = binary.BigEndian.AppendUint16(out, 32)
+	out = append(out, x[:]...)
+	out = binary.BigEndian.AppendUint16(out, 32)
+	return append(out, y[:]...)
+}
+
+// tpmCertInfo TPMS_ATTEST (TPM_ST_ATTEST_CERTIFY)
+func tpmCertInfo(magic uint32, extraData, name []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, magic)
+	out = binary.BigEndian.AppendUint16(out, tpmStAttestCertify)
+	out = binary.BigEndian.AppendUint16(out, 0) // qualifiedSigner
+	out = binary.BigEndian.AppendUint16(out, uint16(len(extraData)))
+	out = append(out, extraData...)
+	out = append(out, make([]byte, 17+8)...) // clockInfo, firmwareVersion
+	out = binary.BigEndian.AppendUint16(out, uint16(len(name)))
+	out = append(out, name...)
+	return binary.BigEndian.AppendUint16(out, 0) // qualifiedName
+}
+
+// attestation 格式校验: 签名、证书字段、AAGUID 扩展与 TPM certInfo 任一不符都应拒绝
+func TestVerifyAttestation(t *testing.T) {
+	ta := newTestAttestation(t)
+
+	rootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	root := issueCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Soft Attestation Root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, rootKey, nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	otherRootKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherRoot := issueCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Other Root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, otherRootKey, nil, nil)
+
+	attKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	packedCert := func(aaguid []byte) *x509.Certificate {
+		return issueCert(t, &x509.Certificate{
+			Subject: pkix.Name{
+				Country:            []string{"CN"},
+				Organization:       []string{"Soft Authenticator"},
+				OrganizationalUnit: []string{"Authenticator Attestation"},
+				CommonName:         "Soft Authenticator Attestation",
+			},
+			BasicConstraintsValid: true,
+			ExtraExtensions:       []pkix.Extension{aaguidExtension(aaguid)},
+		}, attKey, root, rootKey)
+	}
+	packed := func(cert *x509.Certificate, data []byte) *parsedAttestation {
+		return ta.parsed("packed", map[interface{}]interface{}{
+			"alg": int64(coseAlgES256),
+			"sig": signES256(t, attKey, data),
+			"x5c": []interface{}{cert.Raw},
+		})
+	}
+
+	aikCert := func(aaguid []byte, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+		return issueCert(t, &x509.Certificate{
+			BasicConstraintsValid: true,
+			UnknownExtKeyUsage:    []asn1.ObjectIdentifier{oidTCGKPAIKCertificate},
+			ExtraExtensions:       []pkix.Extension{aaguidExtension(aaguid)},
+		}, attKey, parent, parentKey)
+	}
+	pubArea := tpmPubArea(&ta.cred.PublicKey)
+	extraData := sha256.Sum256(ta.signedData())
+	nameHash := sha256.Sum256(pubArea)
+	name := append([]byte{0x00, 0x0B}, nameHash[:]...)
+	tpm := func(cert *x509.Certificate, certInfo []byte) *parsedAttestation {
+		return ta.parsed("tpm", map[interface{}]interface{}{
+			"ver":      "2.0",
+			"alg":      int64(coseAlgES256),
+			"sig":      signES256(t, attKey, certInfo),
+			"x5c":      []interface{}{cert.Raw},
+			"certInfo": certInfo,
+			"pubArea":  pubArea,
+		})
+	}
+	validCertInfo := tpmCertInfo(tpmGeneratedValue, extraData[:], name)
+
+	cases := []struct {
+		name     string
+		att      *parsedAttestation
+		roots    *x509.CertPool
+		wantType string
+		hardware bool
+		wantErr  string
+	}{
+		{name: "none", att: ta.parsed("none", map[interface{}]interface{}{}), wantType: attestationTypeNone},
+		{name: "none 带 attStmt", att: ta.parsed("none", map[interface{}]interface{}{"alg": int64(-7)}), wantErr: "attStmt 必须为空"},
+		{
+			name: "packed 自签名",
+			att: ta.parsed("packed", map[interface{}]interface{}{
+				"alg": int64(coseAlgES256), "sig": signES256(t, ta.cred, ta.signedData()),
+			}),
+			wantType: attestationTypeSelf,
+		},
+		{
+			name: "packed 自签名不覆盖 clientDataHash",
+			att: ta.parsed("packed", map[interface{}]interface{}{
+				"alg": int64(coseAlgES256), "sig": signES256(t, ta.cred, ta.authData),
+			}),
+			wantErr: "签名无效",
+		},
+		{name: "packed 证书", att: packed(packedCert(ta.aaguid), ta.signedData()), wantType: attestationTypeBasic},
+		{name: "packed 证书链可信", att: packed(packedCert(ta.aaguid), ta.signedData()), roots: roots, wantType: attestationTypeTrusted, hardware: true},
+		{name: "packed AAGUID 不一致", att: packed(packedCert([]byte("other-authnr-002")), ta.signedData()), wantErr: "AAGUID"},
+		{name: "tpm", att: tpm(aikCert(ta.aaguid, root, rootKey), validCertInfo), wantType: attestationTypeBasic, hardware: true},
+		{name: "tpm 证书链可信", att: tpm(aikCert(ta.aaguid, root, rootKey), validCertInfo), roots: roots, wantType: attestationTypeTrusted, hardware: true},
+		{name: "tpm 证书链不可信", att: tpm(aikCert(ta.aaguid, otherRoot, otherRootKey), validCertInfo), roots: roots, wantErr: "证书链验证失败"},
+		{name: "tpm AAGUID 不一致", att: tpm(aikCert([]byte("other-authnr-002"), root, rootKey), validCertInfo), wantErr: "AAGUID"},
+		{name: "tpm certInfo.magic 无效", att: tpm(aikCert(ta.aaguid, root, rootKey), tpmCertInfo(0x12345678, extraData[:], name)), wantErr: "certInfo.magic"},
+		{
+			name:    "tpm certInfo.extraData 不匹配",
+			att:     tpm(aikCert(ta.aaguid, root, rootKey), tpmCertInfo(tpmGeneratedValue, ta.clientDataHash, name)),
+			wantErr: "certInfo.extraData",
+		},
+		{
+			name:    "tpm certInfo.attested.name 不匹配",
+			att:     tpm(aikCert(ta.aaguid, root, rootKey), tpmCertInfo(tpmGeneratedValue, extraData[:], append([]byte{0x00, 0x0B}, extraData[:]...))),
+			wantErr: "certInfo.attested.name",
+		},
+		{name: "tpm certInfo 截断", att: tpm(aikCert(ta.aaguid, root, rootKey), validCertInfo[:40]), wantErr: "certInfo 解析失败"},
+		{
+			name: "tpm certInfo 签名无效",
+			att: func() *parsedAttestation {
+				att := tpm(aikCert(ta.aaguid, root, rootKey), validCertInfo)
+				att.AttStmt["sig"] = signES256(t, attKey, pubArea)
+				return att
+			}(),
+			wantErr: "签名无效",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := verifyAttestation(tc.att, ta.clientDataHash, tc.roots)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("错误 = %v, 期望包含 %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Type != tc.wantType || res.Hardware != tc.hardware {
+				t.Fatalf("结果 = %+v, 期望 type=%s hardware=%v", res, tc.wantType, tc.hardware)
+			}
+		})
+	}
+}
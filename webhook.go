@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// maxWalletWebhooks 每个钱包最多注册的 webhook 数
+const maxWalletWebhooks = 5
+
+// WalletWebhook 钱包所有者注册的 webhook
+// Secret 只在创建时返回，投递时用于 HMAC-SHA256 签名 (X-Signature-256 头)
+type WalletWebhook struct {
+	ID        string `json:"id"`
+	URL       string `json:"url"`
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// walletWebhooks 按钱包隔离的 webhook (nsWebhooks，key = wallet/id)
+type walletWebhooks struct {
+	st Storage
+}
+
+func newWalletWebhooks(st Storage) *walletWebhooks {
+	return &walletWebhooks{st: st}
+}
+
+func walletWebhookKey(wallet common.Address, id string) string {
+	return wallet.Hex() + "/" + id
+}
+
+// list 返回钱包的全部 webhook (含 secret)
+func (wh *walletWebhooks) list(wallet common.Address) ([]WalletWebhook, error) {
+	kvs, err := wh.st.List(nsWebhooks, walletWebhookKey(wallet, ""))
+	if err != nil {
+		return nil, err
+	}
+	list := make([]WalletWebhook, 0, len(kvs))
+	for _, kv := range kvs {
+		var hook WalletWebhook
+		if err := json.Unmarshal(kv.Value, &hook); err != nil {
+			return nil, err
+		}
+		list = append(list, hook)
+	}
+	return list, nil
+}
+
+// add 注册 webhook 并生成签名密钥
+func (wh *walletWebhooks) add(wallet common.Address, hookURL string) (WalletWebhook, error) {
+	existing, err := wh.list(wallet)
+	if err != nil {
+		return WalletWebhook{}, err
+	}
+	if len(existing) >= maxWalletWebhooks {
+		return WalletWebhook{}, fmt.Errorf("每个钱包最多注册 %d 个 webhook", maxWalletWebhooks)
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	secret := make([]byte, 32)
+	rand.Read(secret)
+
+	hook := WalletWebhook{
+		ID:        hex.EncodeToString(id),
+		URL:       hookURL,
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now().Unix(),
+	}
+	return hook, putJSON(wh.st, nsWebhooks, walletWebhookKey(wallet, hook.ID), hook, 0)
+}
+
+// remove 删除 webhook，返回是否存在
+func (wh *walletWebhooks) remove(wallet common.Address, id string) (bool, error) {
+	return wh.st.Delete(nsWebhooks, walletWebhookKey(wallet, id))
+}
+
+// checkWebhookURL 只接受 http/https 绝对地址，且主机解析后的地址都不能是内网、回环或链路本地地址
+//
+// 投递时 ownerClient 会在连接时再检查一次，注册时检查只是让错误的地址尽早失败。
+func checkWebhookURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("url 必须是 http/https 地址")
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("无法解析 webhook 主机 %s", u.Hostname())
+	}
+	for _, ip := range ips {
+		if blockedIP(ip) {
+			return fmt.Errorf("webhook %s", errBlockedAddress)
+		}
+	}
+	return nil
+}
+
+// publishEvent 广播事件: SSE 订阅者、运营方 webhook，以及该钱包所有者注册的 webhook
+func (srv *Server) publishEvent(ev WalletEvent) {
+	srv.notifier.publish(ev, srv.Config().Webhooks)
+
+	hooks, err := srv.webhooks.list(common.HexToAddress(ev.Wallet))
+	if err != nil {
+		return
+	}
+	for _, hook := range hooks {
+		go srv.notifier.postSignedWebhook(srv.notifier.ownerClient, hook.URL, hook.Secret, ev)
+	}
+}
+
+// handleWebhooks 钱包 webhook 管理 (需要钱包会话)
+//
+//	GET    /api/webhooks           列出 (不含 secret)
+//	POST   /api/webhooks           {url} 注册，返回 secret
+//	DELETE /api/webhooks?id=...    删除
+func (srv *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	sess, ok := srv.requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		list, err := srv.webhooks.list(sess.Wallet)
+		if err != nil {
+			sendError(w, "读取 webhook 失败: "+err.Error())
+			return
+		}
+		for i := range list {
+			list[i].Secret = ""
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Data:    list,
+		})
+
+	case "POST":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendError(w, "读取请求失败")
+			return
+		}
+		var req struct {
+			URL string `json:"url"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			sendError(w, "JSON 解析失败: "+err.Error())
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		err = checkWebhookURL(ctx, req.URL)
+		cancel()
+		if err != nil {
+			sendError(w, err.Error())
+			return
+		}
+		hook, err := srv.webhooks.add(sess.Wallet, req.URL)
+		if err != nil {
+			sendError(w, "注册 webhook 失败: "+err.Error())
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "已注册，请保存 secret 用于校验 X-Signature-256",
+			Data:    hook,
+		})
+
+	case "DELETE":
+		id := r.URL.Query().Get("id")
+		removed, err := srv.webhooks.remove(sess.Wallet, id)
+		if err != nil {
+			sendError(w, "删除失败: "+err.Error())
+			return
+		}
+		if !removed {
+			sendError(w, "webhook 不存在: "+id)
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: true,
+			Message: "已删除",
+		})
+	}
+}